@@ -28,6 +28,9 @@ type Config struct {
 	SegmentKey  string
 	AnonymousID string
 	Dir         string // Dir for storing state
+
+	// Sender sends flushed events somewhere other than Segment, if set
+	Sender func(events []*Event) error
 }
 
 // Client provides a thin layer over Segment's client for tracking CLI metrics.
@@ -186,7 +189,7 @@ func (a *Client) ConditionalFlush(aboveSize int, aboveDuration time.Duration) er
 	}
 }
 
-// Flush the events to Segment, removing them from disk.
+// Flush the events to Segment (or Sender, if set), removing them from disk.
 // FIXME (bfirsh): two clients could potentially flush at the same time. Maybe this needs a lock, or something.
 func (a *Client) Flush() error {
 	if err := a.Close(); err != nil {
@@ -198,6 +201,22 @@ func (a *Client) Flush() error {
 		return errors.Wrap(err, "reading events")
 	}
 
+	if a.Sender != nil {
+		if err := a.Sender(events); err != nil {
+			return errors.Wrap(err, "sending events")
+		}
+	} else if err := a.sendToSegment(events); err != nil {
+		return err
+	}
+
+	if err := a.Touch(); err != nil {
+		return errors.Wrap(err, "touching")
+	}
+
+	return os.Remove(filepath.Join(a.Dir, "events"))
+}
+
+func (a *Client) sendToSegment(events []*Event) error {
 	client := segment.New(a.SegmentKey)
 
 	for _, event := range events {
@@ -215,12 +234,7 @@ func (a *Client) Flush() error {
 	if err := client.Close(); err != nil {
 		return errors.Wrap(err, "closing client")
 	}
-
-	if err := a.Touch(); err != nil {
-		return errors.Wrap(err, "touching")
-	}
-
-	return os.Remove(filepath.Join(a.Dir, "events"))
+	return nil
 }
 
 // Close the underlying file descriptor(s).
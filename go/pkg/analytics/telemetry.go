@@ -0,0 +1,111 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/settings"
+)
+
+// CommandResult is what is recorded by telemetry about a command that was run
+type CommandResult struct {
+	Command  string
+	Duration time.Duration
+
+	// The kind of repository the command used (e.g. "s3"), or empty if it didn't use one
+	Backend string
+
+	// The code of the error the command failed with (e.g. "PERMISSION_DENIED"),
+	// "other" if it failed with an error without a code, or empty if it succeeded
+	ErrorClass string
+}
+
+// telemetryPayload is the body of the request sent to the telemetry endpoint
+type telemetryPayload struct {
+	AnonymousID string   `json:"anonymous_id"`
+	Events      []*Event `json:"events"`
+}
+
+// TrackTelemetry records the result of a command, if the user has opted in to
+// telemetry with `keepsake analytics on --telemetry`. Like analytics, events are
+// buffered on disk and periodically sent to the telemetry endpoint in a batch.
+//
+// Any errors are assumed to be non-fatal and just sent to logs.
+func TrackTelemetry(result CommandResult) error {
+	if os.Getenv("REPLICATE_NO_ANALYTICS") != "" || os.Getenv("KEEPSAKE_NO_ANALYTICS") != "" {
+		return nil
+	}
+	endpoint := TelemetryEndpoint()
+	if endpoint == "" {
+		return nil
+	}
+
+	userSettings, err := settings.LoadUserSettings()
+	if err != nil {
+		return err
+	}
+	if !userSettings.AnalyticsEnabled || !userSettings.TelemetryEnabled {
+		return nil
+	}
+
+	settingsDir, err := settings.UserSettingsDir()
+	if err != nil {
+		return err
+	}
+	client, err := NewClient(&Config{
+		Dir:         filepath.Join(settingsDir, "telemetry"),
+		AnonymousID: userSettings.AnalyticsID,
+		Sender:      telemetrySender(endpoint, userSettings.AnalyticsID),
+	})
+	if err != nil {
+		return err
+	}
+	if err := client.Track("Command Result", map[string]interface{}{
+		// Update analytics.mdx in the docs if you add anything here
+		"command":          result.Command,
+		"duration_seconds": result.Duration.Seconds(),
+		"backend":          result.Backend,
+		"error_class":      result.ErrorClass,
+		"keepsake_version": global.Version,
+	}); err != nil {
+		return err
+	}
+	return client.ConditionalFlush(15, 5*time.Minute)
+}
+
+// TelemetryEndpoint returns the URL telemetry is sent to, or an empty string if
+// it isn't configured
+func TelemetryEndpoint() string {
+	if endpoint := os.Getenv("KEEPSAKE_TELEMETRY_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return global.TelemetryEndpoint
+}
+
+// telemetrySender returns a function that POSTs events as JSON to endpoint
+func telemetrySender(endpoint string, anonymousID string) func(events []*Event) error {
+	return func(events []*Event) error {
+		body, err := json.Marshal(&telemetryPayload{AnonymousID: anonymousID, Events: events})
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("telemetry endpoint %s returned status %d", endpoint, resp.StatusCode)
+		}
+		console.Debug("telemetry: sent %d events to %s", len(events), endpoint)
+		return nil
+	}
+}
@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetrySender(t *testing.T) {
+	var payload telemetryPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	send := telemetrySender(server.URL, "9f3027bb-0eb8-917d-e5bf-c6c1bdb1fd0a")
+	err := send([]*Event{{
+		Event:      "Command Result",
+		Properties: map[string]interface{}{"command": "keepsake ls", "error_class": "PERMISSION_DENIED"},
+		Timestamp:  time.Now(),
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "9f3027bb-0eb8-917d-e5bf-c6c1bdb1fd0a", payload.AnonymousID)
+	require.Len(t, payload.Events, 1)
+	require.Equal(t, "keepsake ls", payload.Events[0].Properties["command"])
+	require.Equal(t, "PERMISSION_DENIED", payload.Events[0].Properties["error_class"])
+
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+	require.Error(t, telemetrySender(failingServer.URL, "abc")(nil))
+}
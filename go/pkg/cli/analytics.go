@@ -5,11 +5,14 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/keepsake/go/pkg/analytics"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
 	"github.com/replicate/keepsake/go/pkg/settings"
 )
 
 func newAnalyticsCommand() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "analytics <on|off>",
 		Short: "Enable or disable analytics",
 		Long: `The Keepsake CLI sends anonymous analytics about commands you run.
@@ -28,10 +31,17 @@ These analytics really help us, and we'd really appreciate it if you left it on.
 But, if you want to opt out, you can run this command:
 
 keepsake analytics off
+
+You can also opt in to telemetry with "keepsake analytics on --telemetry". This also sends
+how long each command took, the kind of repository it used (e.g. "s3"), and the kind of
+error it failed with (e.g. "PERMISSION_DENIED"), if any. Telemetry is sent to the endpoint
+in KEEPSAKE_TELEMETRY_ENDPOINT, and is turned off again by "keepsake analytics off".
 `,
 		Run:  handleErrors(analyticsCommand),
 		Args: cobra.ExactArgs(1),
 	}
+	cmd.Flags().Bool("telemetry", false, "With 'on', also send telemetry about command durations and failures")
+	return cmd
 }
 
 func analyticsCommand(cmd *cobra.Command, args []string) error {
@@ -40,15 +50,31 @@ func analyticsCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	telemetry, err := cmd.Flags().GetBool("telemetry")
+	if err != nil {
+		return err
+	}
+
 	switch args[0] {
 	case "on":
 		userSettings.AnalyticsEnabled = true
+		if telemetry {
+			userSettings.TelemetryEnabled = true
+			if analytics.TelemetryEndpoint() == "" {
+				console.Warn("Telemetry is enabled, but it won't be sent anywhere until KEEPSAKE_TELEMETRY_ENDPOINT is set")
+			}
+		}
 	case "off":
 		userSettings.AnalyticsEnabled = false
+		userSettings.TelemetryEnabled = false
 	default:
 		return fmt.Errorf("You need to pass either 'on' or 'off' as an argument.")
 	}
 
+	if global.DryRun {
+		console.Info("Would turn analytics %s", args[0])
+		return nil
+	}
 	if err := userSettings.Save(); err != nil {
 		return err
 	}
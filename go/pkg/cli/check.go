@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type checkOpts struct {
+	baseline      string
+	metric        string
+	goal          string
+	minDelta      string
+	repositoryURL string
+}
+
+func newCheckCommand() *cobra.Command {
+	var opts checkOpts
+
+	cmd := &cobra.Command{
+		Use:   "check [experiment or checkpoint ID]",
+		Short: "Fail if an experiment's metric regressed compared to a baseline",
+		Long: `Compare a metric of an experiment or checkpoint with a baseline, and exit with an
+error if it got worse by more than --min-delta, so it can be used as a quality gate in CI.
+
+The experiment defaults to the most recently created one. For an experiment, its best
+checkpoint for the metric is used. The metric defaults to the primary metric, and whether
+bigger or smaller values are better defaults to its goal.
+
+--min-delta is how much the metric must improve by, as a number, or a percentage of the
+baseline. A negative value is how much it can get worse by. For example, -0.5% allows
+it to be up to 0.5% worse than the baseline.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return check(opts, args, os.Stdout)
+		}),
+		Args: cobra.MaximumNArgs(1),
+		Example: `Fail if the latest experiment's val_acc is more than 0.5% worse than a1b2c3d's:
+$ keepsake check --baseline a1b2c3d --metric val_acc --min-delta -0.5%
+
+Fail if e4f5a6b doesn't improve on the baseline's loss by at least 0.01:
+$ keepsake check e4f5a6b --baseline a1b2c3d --metric loss --goal minimize --min-delta 0.01`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.baseline, "baseline", "", "ID of the experiment or checkpoint to compare with (required)")
+	cmd.Flags().StringVar(&opts.metric, "metric", "", "Metric to compare. Default: the primary metric")
+	cmd.Flags().StringVar(&opts.goal, "goal", "", "Whether the metric should be 'maximize'd or 'minimize'd. Default: the goal of the primary metric")
+	cmd.Flags().StringVar(&opts.minDelta, "min-delta", "0", "How much the metric must improve by, as a number or a percentage of the baseline, e.g. 0.01 or -0.5%")
+
+	return cmd
+}
+
+func check(opts checkOpts, args []string, out io.Writer) error {
+	if opts.baseline == "" {
+		return fmt.Errorf("Pass the experiment or checkpoint to compare with with --baseline")
+	}
+	minDelta, relative, err := parseMinDelta(opts.minDelta)
+	if err != nil {
+		return err
+	}
+	if opts.goal != "" && opts.goal != string(project.GoalMaximize) && opts.goal != string(project.GoalMinimize) {
+		return fmt.Errorf("Invalid value for --goal: %q. It must be '%s' or '%s'.", opts.goal, project.GoalMaximize, project.GoalMinimize)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+
+	baseline, err := proj.CheckpointOrExperimentFromPrefix(opts.baseline)
+	if err != nil {
+		return err
+	}
+	var run *project.CheckpointOrExperiment
+	if len(args) == 1 {
+		if run, err = proj.CheckpointOrExperimentFromPrefix(args[0]); err != nil {
+			return err
+		}
+	} else {
+		if run, err = latestExperiment(proj, baseline.Experiment); err != nil {
+			return err
+		}
+	}
+
+	metric, goal, err := checkMetricAndGoal(opts.metric, project.MetricGoal(opts.goal), run, baseline)
+	if err != nil {
+		return err
+	}
+	runChk, err := checkpointForMetric(run, metric, goal)
+	if err != nil {
+		return err
+	}
+	baselineChk, err := checkpointForMetric(baseline, metric, goal)
+	if err != nil {
+		return err
+	}
+	value, _ := runChk.MetricValue(metric)
+	baselineValue, _ := baselineChk.MetricValue(metric)
+
+	passed, improvement, required := checkImprovement(value, baselineValue, goal, minDelta, relative)
+	summary := fmt.Sprintf("%s of checkpoint %s is %s, compared to %s for baseline checkpoint %s (%s): an improvement of %s, and at least %s is required",
+		metric, runChk.ShortID(), formatMetric(value), formatMetric(baselineValue), baselineChk.ShortID(), goal, formatMetric(improvement), formatMetric(required))
+	if !passed {
+		return fmt.Errorf("%s regressed: %s", metric, summary)
+	}
+	fmt.Fprintf(out, "Passed: %s\n", summary)
+	return nil
+}
+
+// parseMinDelta parses --min-delta, returning whether it is a fraction of the
+// baseline
+func parseMinDelta(s string) (minDelta float64, relative bool, err error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		s, relative = strings.TrimSuffix(s, "%"), true
+	}
+	minDelta, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("Invalid value for --min-delta: %q. It must be a number, or a percentage like -0.5%%.", s)
+	}
+	if relative {
+		minDelta /= 100
+	}
+	return minDelta, relative, nil
+}
+
+// checkImprovement returns whether value improves on baseline by at least
+// minDelta (a fraction of baseline, if relative), how much it improved by, and
+// how much it had to improve by. Improvements are negative if value is worse.
+func checkImprovement(value float64, baseline float64, goal project.MetricGoal, minDelta float64, relative bool) (passed bool, improvement float64, required float64) {
+	improvement = value - baseline
+	if goal == project.GoalMinimize {
+		improvement = -improvement
+	}
+	required = minDelta
+	if relative {
+		required = minDelta * math.Abs(baseline)
+	}
+	return improvement >= required, improvement, required
+}
+
+// latestExperiment returns the most recently created experiment, other than
+// the baseline
+func latestExperiment(proj *project.Project, baseline *project.Experiment) (*project.CheckpointOrExperiment, error) {
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	var latest *project.Experiment
+	for _, exp := range experiments {
+		if exp.ID != baseline.ID && (latest == nil || exp.Created.After(latest.Created)) {
+			latest = exp
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("There are no experiments to compare with the baseline")
+	}
+	return &project.CheckpointOrExperiment{Experiment: latest}, nil
+}
+
+// checkMetricAndGoal fills in the metric and goal from the primary metric of
+// the run or baseline, if they weren't passed
+func checkMetricAndGoal(metric string, goal project.MetricGoal, checked ...*project.CheckpointOrExperiment) (string, project.MetricGoal, error) {
+	for _, c := range checked {
+		chk := c.Checkpoint
+		if chk == nil {
+			chk = c.Experiment.BestCheckpoint()
+		}
+		if chk == nil || chk.PrimaryMetric == nil {
+			continue
+		}
+		if metric == "" {
+			metric = chk.PrimaryMetric.Name
+		}
+		if goal == "" && chk.PrimaryMetric.Name == metric {
+			goal = chk.PrimaryMetric.Goal
+		}
+	}
+	if metric == "" {
+		return "", "", fmt.Errorf("Neither experiment has a primary metric, so pass the metric to compare with --metric")
+	}
+	if goal == "" {
+		return "", "", fmt.Errorf("%s isn't a primary metric, so pass whether it should be maximized or minimized with --goal", metric)
+	}
+	return metric, goal, nil
+}
+
+// checkpointForMetric returns the checkpoint, or the experiment's best
+// checkpoint for metric
+func checkpointForMetric(c *project.CheckpointOrExperiment, metric string, goal project.MetricGoal) (*project.Checkpoint, error) {
+	if c.Checkpoint != nil {
+		if _, ok := c.Checkpoint.MetricValue(metric); !ok {
+			return nil, fmt.Errorf("Checkpoint %s doesn't have a number for %s", c.Checkpoint.ShortID(), metric)
+		}
+		return c.Checkpoint, nil
+	}
+	chk := c.Experiment.BestCheckpointFor(metric, goal)
+	if chk == nil {
+		return nil, fmt.Errorf("Experiment %s doesn't have any checkpoints with a number for %s", c.Experiment.ShortID(), metric)
+	}
+	return chk, nil
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func TestParseMinDelta(t *testing.T) {
+	minDelta, relative, err := parseMinDelta("0.01")
+	require.NoError(t, err)
+	require.Equal(t, 0.01, minDelta)
+	require.False(t, relative)
+
+	minDelta, relative, err = parseMinDelta("-0.5%")
+	require.NoError(t, err)
+	require.InDelta(t, -0.005, minDelta, 1e-12)
+	require.True(t, relative)
+
+	_, _, err = parseMinDelta("a lot")
+	require.Error(t, err)
+}
+
+func TestCheckImprovement(t *testing.T) {
+	// maximize, allowed to be 0.5% worse than 0.9, i.e. 0.0045
+	passed, improvement, required := checkImprovement(0.896, 0.9, project.GoalMaximize, -0.005, true)
+	require.True(t, passed)
+	require.InDelta(t, -0.004, improvement, 1e-12)
+	require.InDelta(t, -0.0045, required, 1e-12)
+
+	passed, _, _ = checkImprovement(0.895, 0.9, project.GoalMaximize, -0.005, true)
+	require.False(t, passed)
+
+	// minimize, must improve by 0.01
+	passed, improvement, _ = checkImprovement(0.28, 0.3, project.GoalMinimize, 0.01, false)
+	require.True(t, passed)
+	require.InDelta(t, 0.02, improvement, 1e-12)
+
+	passed, _, _ = checkImprovement(0.295, 0.3, project.GoalMinimize, 0.01, false)
+	require.False(t, passed)
+
+	// no tolerance
+	passed, _, _ = checkImprovement(0.3, 0.3, project.GoalMinimize, 0, false)
+	require.True(t, passed)
+}
+
+func TestCheckMetricAndGoal(t *testing.T) {
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	exp := &project.Experiment{ID: "1eeeeeeeee", Checkpoints: []*project.Checkpoint{{
+		ID:            "1ccccccccc",
+		Metrics:       param.ValueMap{"loss": param.Float(0.3), "accuracy": param.Float(0.9)},
+		PrimaryMetric: primaryMetric,
+	}}}
+	run := &project.CheckpointOrExperiment{Experiment: exp}
+	noCheckpoints := &project.CheckpointOrExperiment{Experiment: &project.Experiment{ID: "2eeeeeeeee"}}
+
+	metric, goal, err := checkMetricAndGoal("", "", noCheckpoints, run)
+	require.NoError(t, err)
+	require.Equal(t, "loss", metric)
+	require.Equal(t, project.GoalMinimize, goal)
+
+	_, _, err = checkMetricAndGoal("accuracy", "", run)
+	require.Error(t, err)
+
+	metric, goal, err = checkMetricAndGoal("accuracy", project.GoalMaximize, run)
+	require.NoError(t, err)
+	require.Equal(t, "accuracy", metric)
+	require.Equal(t, project.GoalMaximize, goal)
+
+	_, _, err = checkMetricAndGoal("", "", noCheckpoints)
+	require.Error(t, err)
+
+	chk, err := checkpointForMetric(run, "accuracy", project.GoalMaximize)
+	require.NoError(t, err)
+	require.Equal(t, "1ccccccccc", chk.ID)
+	_, err = checkpointForMetric(run, "f1", project.GoalMaximize)
+	require.Error(t, err)
+}
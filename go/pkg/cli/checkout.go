@@ -1,15 +1,21 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"text/tabwriter"
 
 	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/keepsake/go/pkg/concurrency"
 	"github.com/replicate/keepsake/go/pkg/console"
 	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
 	"github.com/replicate/keepsake/go/pkg/project"
 )
 
@@ -18,24 +24,54 @@ type checkoutOpts struct {
 	force           bool
 	repositoryURL   string
 	checkoutPath    string
+	into            string
+	concurrency     int
+}
+
+type checkoutJob struct {
+	experiment *project.Experiment
+	checkpoint *project.Checkpoint
+	dir        string
 }
 
 func newCheckoutCommand() *cobra.Command {
 	var opts checkoutOpts
 
 	cmd := &cobra.Command{
-		Use:   "checkout <experiment or checkpoint ID>",
+		Use:   "checkout <experiment or checkpoint ID>...",
 		Short: "Copy files from an experiment or checkpoint into the project directory",
+		Long: `Copy files from an experiment or checkpoint into the project directory.
+
+With --into, several experiments or checkpoints can be checked out at the same
+time, each into a subdirectory of --into named after the checkpoint's ID, e.g. to
+evaluate an ensemble. Each checkpoint's files are downloaded to
+` + checkpointCacheDir + ` in the project directory, like "keepsake
+prefetch", and hard-linked from there, so checkpoints that were already
+downloaded aren't downloaded again and don't take up more space. The files are
+shared with the cache, so replace them instead of changing them in place.`,
 		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			if opts.into != "" {
+				return checkoutInto(opts, args, os.Stdout)
+			}
+			if len(args) > 1 {
+				return fmt.Errorf("To check out more than one experiment or checkpoint, pass --into with the directory to check them out into")
+			}
 			return checkoutCheckpoint(opts, args)
 		}),
-		Args: cobra.ExactArgs(1),
+		Args: cobra.MinimumNArgs(1),
+		Example: `Check out the files of a checkpoint into the project directory:
+$ keepsake checkout 1c2d3e4
+
+Check out three checkpoints into ensemble/<checkpoint ID>/, for evaluation:
+$ keepsake checkout 1c2d3e4 5f6a7b8 9c0d1e2 --into ensemble/`,
 	}
 
 	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
 	cmd.Flags().StringVarP(&opts.outputDirectory, "output-directory", "o", "", "Output directory (defaults to working directory or directory with keepsake.yaml in it)")
 	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Force checkout without prompt, even if the directory is not empty")
 	cmd.Flags().StringVarP(&opts.checkoutPath, "path", "", "", "A specific file or directory to checkout (defaults to all files or directory in checkpoint/experiment)")
+	cmd.Flags().StringVar(&opts.into, "into", "", "Check out each experiment or checkpoint into a subdirectory of this directory, named after its ID")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 4, "How many experiments or checkpoints to check out at the same time, with --into")
 
 	return cmd
 }
@@ -180,6 +216,18 @@ func checkoutCheckpoint(opts checkoutOpts, args []string) error {
 		}
 	}
 
+	if global.DryRun {
+		what := "experiment " + experiment.ShortID()
+		if checkpoint != nil {
+			what = "checkpoint " + checkpoint.ShortID()
+		}
+		if opts.checkoutPath != "" {
+			what = fmt.Sprintf("%s from %s", opts.checkoutPath, what)
+		}
+		console.Info("Would check out %s to %s, overwriting any files that already exist", what, outputDir)
+		return nil
+	}
+
 	err = validateOrCreateOutputDir(outputDir)
 	if err != nil {
 		return err
@@ -206,3 +254,117 @@ func checkoutCheckpoint(opts checkoutOpts, args []string) error {
 		return proj.CheckoutFileOrDirectory(checkpoint, experiment, outputDir, checkoutPath)
 	}
 }
+
+// checkoutInto checks out each experiment or checkpoint in prefixes into its
+// own subdirectory of opts.into, several at a time. Checkpoints' files are
+// downloaded to the checkpoint cache and hard-linked from there. It carries on
+// if some of them fail, and returns an error at the end.
+func checkoutInto(opts checkoutOpts, prefixes []string, out io.Writer) error {
+	if opts.outputDirectory != "" || opts.checkoutPath != "" {
+		return fmt.Errorf("--output-directory and --path can't be used with --into")
+	}
+	if opts.concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	jobs := []*checkoutJob{}
+	seen := map[string]bool{}
+	for _, prefix := range prefixes {
+		experiment, checkpoint, err := getExperimentAndCheckpoint(prefix, proj, projectDir)
+		if err != nil {
+			return err
+		}
+		id := experiment.ID
+		if checkpoint != nil {
+			id = checkpoint.ID
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		jobs = append(jobs, &checkoutJob{experiment: experiment, checkpoint: checkpoint, dir: filepath.Join(opts.into, id)})
+	}
+
+	if global.DryRun {
+		for _, job := range jobs {
+			console.Info("Would check out %s to %s", checkoutJobDescription(job), job.dir)
+		}
+		return nil
+	}
+	for _, job := range jobs {
+		if err := overwriteDisplayPathPrompt(job.dir, opts.force); err != nil {
+			return err
+		}
+	}
+	cache, err := files.OpenCache(filepath.Join(projectDir, checkpointCacheDir), checkpointCacheVersion)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	failed := 0
+	queue := concurrency.NewWorkerQueue(context.Background(), opts.concurrency)
+	for _, job := range jobs {
+		job := job
+		err := queue.Go(func() error {
+			console.Info("Checking out %s to %s...", checkoutJobDescription(job), job.dir)
+			if err := runCheckoutJob(proj, job, cache); err != nil {
+				console.Warn("Failed to check out %s: %s", checkoutJobDescription(job), err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to check out %d of %d experiments or checkpoints", failed, len(jobs))
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, job := range jobs {
+		id := job.experiment.ID
+		if job.checkpoint != nil {
+			id = job.checkpoint.ID
+		}
+		fmt.Fprintf(w, "%s\t%s\n", id, job.dir)
+	}
+	return w.Flush()
+}
+
+func checkoutJobDescription(job *checkoutJob) string {
+	if job.checkpoint != nil {
+		return "checkpoint " + job.checkpoint.ShortID()
+	}
+	return "experiment " + job.experiment.ShortID()
+}
+
+// runCheckoutJob checks out job's checkpoint and its experiment, downloading
+// the checkpoint's files to cache first if they aren't already there
+func runCheckoutJob(proj *project.Project, job *checkoutJob, cache *files.Cache) error {
+	if err := validateOrCreateOutputDir(job.dir); err != nil {
+		return err
+	}
+	if job.checkpoint == nil || job.checkpoint.Path == "" {
+		return proj.CheckoutCheckpoint(job.checkpoint, job.experiment, job.dir, true)
+	}
+	cached := &prefetchJob{experiment: job.experiment, checkpoint: job.checkpoint, dir: filepath.Join(cache.Dir, job.checkpoint.ID)}
+	if err := fetchCheckpoint(proj, cache, cached); err != nil {
+		return err
+	}
+	return proj.CheckoutCheckpointFromCache(job.checkpoint, job.experiment, job.dir, cached.dir)
+}
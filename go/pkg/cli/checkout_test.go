@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/replicate/keepsake/go/pkg/config"
 	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
 	"github.com/replicate/keepsake/go/pkg/hash"
 	"github.com/replicate/keepsake/go/pkg/project"
 	"github.com/replicate/keepsake/go/pkg/repository"
@@ -213,3 +215,70 @@ func TestCheckout(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, rand3, string(contents))
 }
+
+func TestCheckoutInto(t *testing.T) {
+	repoDir, err := files.TempDir("test-checkout-into")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	projectDir, err := files.TempDir("test-checkout-into-project")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	oldProjectDirectory := global.ProjectDirectory
+	global.ProjectDirectory = projectDir
+	defer func() { global.ProjectDirectory = oldProjectDirectory }()
+
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	experiment := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: time.Now().UTC(),
+		Config:  &config.Config{},
+		Path:    "train.py",
+		Checkpoints: []*project.Checkpoint{
+			{ID: "1ccccccccc", Created: time.Now().UTC(), Path: "model.pth"},
+			{ID: "2ccccccccc", Created: time.Now().UTC(), Path: "model.pth"},
+		},
+	}
+	require.NoError(t, experiment.Save(repo))
+
+	codeDir, err := files.TempDir("test-checkout-into-code")
+	require.NoError(t, err)
+	defer os.RemoveAll(codeDir)
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "model.pth"), []byte("weights"), 0644))
+	require.NoError(t, repo.PutPathTar(codeDir, "experiments/1eeeeeeeee.tar.gz", "train.py"))
+	require.NoError(t, repo.PutPathTar(codeDir, "checkpoints/1ccccccccc.tar.gz", "model.pth"))
+	require.NoError(t, repo.PutPathTar(codeDir, "checkpoints/2ccccccccc.tar.gz", "model.pth"))
+
+	intoDir := path.Join(projectDir, "ensemble")
+	opts := checkoutOpts{
+		into:          intoDir,
+		concurrency:   2,
+		force:         true,
+		repositoryURL: "file://" + repoDir,
+	}
+	out := new(bytes.Buffer)
+	require.NoError(t, checkoutInto(opts, []string{"1cc", "2cc", "1cc"}, out))
+	require.Equal(t, "1ccccccccc  "+path.Join(intoDir, "1ccccccccc")+"\n2ccccccccc  "+path.Join(intoDir, "2ccccccccc")+"\n", out.String())
+
+	for _, id := range []string{"1ccccccccc", "2ccccccccc"} {
+		contents, err := ioutil.ReadFile(path.Join(intoDir, id, "train.py"))
+		require.NoError(t, err)
+		require.Equal(t, "print(1)", string(contents))
+
+		// checkpoint files are hard links to the cache
+		checkedOut, err := os.Stat(path.Join(intoDir, id, "model.pth"))
+		require.NoError(t, err)
+		cached, err := os.Stat(path.Join(projectDir, checkpointCacheDir, id, "model.pth"))
+		require.NoError(t, err)
+		require.True(t, os.SameFile(checkedOut, cached))
+	}
+
+	// checking out again uses the cache
+	require.NoError(t, os.RemoveAll(path.Join(repoDir, "checkpoints")))
+	require.NoError(t, checkoutInto(opts, []string{"1cc"}, new(bytes.Buffer)))
+
+	opts.checkoutPath = "model.pth"
+	require.Error(t, checkoutInto(opts, []string{"1cc"}, new(bytes.Buffer)))
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/github"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/table"
+)
+
+// ciReportMarker is hidden in the comment, so it can be found and updated
+const ciReportMarker = "<!-- keepsake-ci-report -->"
+
+type ciReportOpts struct {
+	githubPR      int
+	githubRepo    string
+	since         time.Duration
+	baseline      string
+	repositoryURL string
+}
+
+func newCIReportCommand() *cobra.Command {
+	var opts ciReportOpts
+
+	cmd := &cobra.Command{
+		Use:   "ci-report [experiment ID...]",
+		Short: "Report the experiments run in CI on a GitHub pull request",
+		Long: `Write a Markdown summary of the experiments run in CI, with their params, metrics,
+and how their primary metric compares to a baseline, and post it on a GitHub pull request.
+
+The experiments are the ones passed as arguments, and the ones created within --since.
+The baseline is the experiment passed with --baseline, or otherwise the best experiment
+with the same primary metric that isn't part of this run.
+
+The report is posted as a comment on the pull request passed with --github-pr, using the
+token in the GITHUB_TOKEN environment variable. If the pull request already has a report,
+it is updated instead of adding another comment. Without --github-pr, the report is printed.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return ciReport(opts, args, os.Stdout)
+		}),
+		Example: `In a GitHub Actions workflow, report the experiments created in the last hour:
+$ keepsake ci-report --since 1h --github-pr ${{ github.event.pull_request.number }}
+
+Print a report comparing an experiment to a particular baseline:
+$ keepsake ci-report --baseline a1b2c3d e4f5a6b`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().IntVar(&opts.githubPR, "github-pr", 0, "Number of the pull request to post the report on")
+	cmd.Flags().StringVar(&opts.githubRepo, "github-repo", os.Getenv("GITHUB_REPOSITORY"), "GitHub repository the pull request is in, as <owner>/<name>. Default: the GITHUB_REPOSITORY environment variable")
+	cmd.Flags().DurationVar(&opts.since, "since", 0, "Report the experiments created in this long ago, e.g. 1h")
+	cmd.Flags().StringVar(&opts.baseline, "baseline", "", "ID of the experiment to compare with. Default: the best experiment that isn't part of this run")
+
+	return cmd
+}
+
+func ciReport(opts ciReportOpts, args []string, out io.Writer) error {
+	if len(args) == 0 && opts.since == 0 {
+		return fmt.Errorf("Pass the IDs of the experiments to report, or --since to report the experiments created recently")
+	}
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+
+	runs, err := ciReportExperiments(proj, args, opts.since)
+	if err != nil {
+		return err
+	}
+	var baseline *project.Experiment
+	if opts.baseline != "" {
+		if baseline, err = proj.ExperimentFromPrefix(opts.baseline); err != nil {
+			return err
+		}
+	} else {
+		experiments, err := proj.Experiments()
+		if err != nil {
+			return err
+		}
+		baseline = bestBaseline(experiments, runs)
+	}
+	report := ciReportMarkdown(runs, baseline)
+
+	if opts.githubPR == 0 {
+		fmt.Fprint(out, report)
+		return nil
+	}
+	if opts.githubRepo == "" {
+		return fmt.Errorf("Pass the GitHub repository the pull request is in with --github-repo, or set GITHUB_REPOSITORY")
+	}
+	if global.DryRun {
+		fmt.Fprint(out, report)
+		console.Info("Would post the report above on %s#%d", opts.githubRepo, opts.githubPR)
+		return nil
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return fmt.Errorf("Set the GITHUB_TOKEN environment variable to a token that can comment on pull requests in %s", opts.githubRepo)
+	}
+	apiURL := os.Getenv("GITHUB_API_URL")
+	if apiURL == "" {
+		apiURL = github.DefaultAPIURL
+	}
+	client := &github.Client{APIURL: apiURL, Repository: opts.githubRepo, Token: token}
+	comment, created, err := client.UpsertComment(opts.githubPR, ciReportMarker, report)
+	if err != nil {
+		return err
+	}
+	if created {
+		console.Info("Posted the report on %s#%d: %s", opts.githubRepo, opts.githubPR, comment.HTMLURL)
+	} else {
+		console.Info("Updated the report on %s#%d: %s", opts.githubRepo, opts.githubPR, comment.HTMLURL)
+	}
+	return nil
+}
+
+// ciReportExperiments returns the experiments with the IDs in prefixes, and
+// the ones created within since, oldest first
+func ciReportExperiments(proj *project.Project, prefixes []string, since time.Duration) ([]*project.Experiment, error) {
+	byID := map[string]*project.Experiment{}
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		byID[exp.ID] = exp
+	}
+	if since > 0 {
+		experiments, err := proj.Experiments()
+		if err != nil {
+			return nil, err
+		}
+		cutoff := time.Now().Add(-since)
+		for _, exp := range experiments {
+			if exp.Created.After(cutoff) {
+				byID[exp.ID] = exp
+			}
+		}
+	}
+	if len(byID) == 0 {
+		return nil, fmt.Errorf("No experiments were created in the last %s", since)
+	}
+	runs := []*project.Experiment{}
+	for _, exp := range byID {
+		runs = append(runs, exp)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Created.Before(runs[j].Created)
+	})
+	return runs, nil
+}
+
+// bestBaseline returns the experiment that isn't in runs with the best value
+// of the primary metric of the runs, or nil if there isn't one
+func bestBaseline(experiments []*project.Experiment, runs []*project.Experiment) *project.Experiment {
+	var metric *project.PrimaryMetric
+	isRun := map[string]bool{}
+	for _, exp := range runs {
+		isRun[exp.ID] = true
+		if chk := exp.BestCheckpoint(); chk != nil && metric == nil {
+			metric = chk.PrimaryMetric
+		}
+	}
+	if metric == nil {
+		return nil
+	}
+	var best *project.Experiment
+	var bestValue float64
+	for _, exp := range experiments {
+		if isRun[exp.ID] {
+			continue
+		}
+		chk := exp.BestCheckpoint()
+		if chk == nil || chk.PrimaryMetric == nil || chk.PrimaryMetric.Name != metric.Name {
+			continue
+		}
+		value, ok := chk.PrimaryMetricValue()
+		if ok && (best == nil || metric.Goal.IsBetter(value, bestValue)) {
+			best, bestValue = exp, value
+		}
+	}
+	return best
+}
+
+func ciReportMarkdown(runs []*project.Experiment, baseline *project.Experiment) string {
+	var baselineChk *project.Checkpoint
+	if baseline != nil {
+		baselineChk = baseline.BestCheckpoint()
+	}
+
+	var b strings.Builder
+	b.WriteString(ciReportMarker + "\n")
+	b.WriteString("### Keepsake experiments\n\n")
+	b.WriteString("| Experiment | Params | Checkpoint | Metrics | Compared to baseline |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, exp := range runs {
+		params := []string{}
+		for _, p := range exp.SortedParams() {
+			params = append(params, p.Name+"="+p.Value.ShortString(20, 5))
+		}
+		chk := exp.BestCheckpoint()
+		if chk == nil {
+			chk = exp.LatestCheckpoint()
+		}
+		checkpoint, metrics := "–", "–"
+		if chk != nil {
+			checkpoint = fmt.Sprintf("`%s` (step %d)", chk.ShortID(), chk.Step)
+			metricStrings := []string{}
+			for _, m := range chk.SortedMetrics() {
+				metricStrings = append(metricStrings, m.Name+"="+m.Value.ShortString(20, 5))
+			}
+			if len(metricStrings) > 0 {
+				metrics = strings.Join(metricStrings, ", ")
+			}
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n",
+			exp.ShortID(),
+			table.MarkdownCell(strings.Join(params, ", ")),
+			checkpoint,
+			table.MarkdownCell(metrics),
+			compareToBaseline(chk, baselineChk))
+	}
+
+	b.WriteString("\n")
+	if baselineChk == nil || baselineChk.PrimaryMetric == nil {
+		b.WriteString("There is no baseline to compare with.\n")
+	} else {
+		value, _ := baselineChk.PrimaryMetricValue()
+		fmt.Fprintf(&b, "Baseline: experiment `%s`, checkpoint `%s`, with %s=%s (%s).\n", baseline.ShortID(), baselineChk.ShortID(), baselineChk.PrimaryMetric.Name, formatMetric(value), baselineChk.PrimaryMetric.Goal)
+	}
+	return b.String()
+}
+
+func compareToBaseline(chk *project.Checkpoint, baselineChk *project.Checkpoint) string {
+	if chk == nil || baselineChk == nil || chk.PrimaryMetric == nil || baselineChk.PrimaryMetric == nil || chk.PrimaryMetric.Name != baselineChk.PrimaryMetric.Name {
+		return "–"
+	}
+	value, ok := chk.PrimaryMetricValue()
+	baselineValue, baselineOK := baselineChk.PrimaryMetricValue()
+	if !ok || !baselineOK {
+		return "–"
+	}
+	delta := fmt.Sprintf("%s%s", signOf(value-baselineValue), formatMetric(value-baselineValue))
+	switch {
+	case value == baselineValue:
+		return fmt.Sprintf("%s: same", chk.PrimaryMetric.Name)
+	case chk.PrimaryMetric.Goal.IsBetter(value, baselineValue):
+		return fmt.Sprintf("%s: %s, better", chk.PrimaryMetric.Name, delta)
+	default:
+		return fmt.Sprintf("%s: %s, worse", chk.PrimaryMetric.Name, delta)
+	}
+}
+
+func signOf(f float64) string {
+	if f > 0 {
+		return "+"
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func TestCIReportMarkdown(t *testing.T) {
+	created, _ := time.Parse(time.RFC3339, "2020-10-07T12:00:00Z")
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	newExperiment := func(id string, params param.ValueMap, losses ...float64) *project.Experiment {
+		exp := &project.Experiment{ID: id, Created: created, Params: params}
+		for i, loss := range losses {
+			exp.Checkpoints = append(exp.Checkpoints, &project.Checkpoint{
+				ID:            id[:1] + string(rune('a'+i)) + "cccccccc",
+				Step:          int64(i),
+				Metrics:       param.ValueMap{"loss": param.Float(loss)},
+				PrimaryMetric: primaryMetric,
+			})
+		}
+		return exp
+	}
+	old := newExperiment("1eeeeeeeee", nil, 0.5)
+	best := newExperiment("2eeeeeeeee", nil, 0.4, 0.3)
+	better := newExperiment("3eeeeeeeee", param.ValueMap{"lr": param.Float(0.01), "note": param.String("a|b")}, 0.25)
+	worse := newExperiment("4eeeeeeeee", param.ValueMap{"lr": param.Float(0.1)}, 0.35)
+	noCheckpoints := newExperiment("5eeeeeeeee", nil)
+
+	runs := []*project.Experiment{better, worse, noCheckpoints}
+	baseline := bestBaseline([]*project.Experiment{old, best, better, worse, noCheckpoints}, runs)
+	require.Equal(t, best, baseline)
+
+	require.Equal(t, `<!-- keepsake-ci-report -->
+### Keepsake experiments
+
+| Experiment | Params | Checkpoint | Metrics | Compared to baseline |
+| --- | --- | --- | --- | --- |
+| `+"`3eeeeee`"+` | lr=0.01, note=a\|b | `+"`3accccc`"+` (step 0) | loss=0.25 | loss: -0.05, better |
+| `+"`4eeeeee`"+` | lr=0.1 | `+"`4accccc`"+` (step 0) | loss=0.35 | loss: +0.05, worse |
+| `+"`5eeeeee`"+` |  | – | – | – |
+
+Baseline: experiment `+"`2eeeeee`"+`, checkpoint `+"`2bccccc`"+`, with loss=0.3 (minimize).
+`, ciReportMarkdown(runs, baseline))
+
+	require.Contains(t, ciReportMarkdown(runs, nil), "There is no baseline to compare with.")
+}
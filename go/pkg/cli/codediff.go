@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/textdiff"
+)
+
+// codeDiffContext is how many unchanged lines are shown around changes, like
+// diff -u
+const codeDiffContext = 3
+
+// printCodeDiff downloads the code that was saved with exp1 and exp2, and
+// writes a unified diff of it to out
+func printCodeDiff(out io.Writer, au aurora.Aurora, proj *project.Project, exp1 *project.Experiment, exp2 *project.Experiment) error {
+	fmt.Fprintf(out, "%s\n", au.Bold("Code"))
+	if exp1.ID == exp2.ID {
+		fmt.Fprintf(out, "%s\n", au.Faint("(no difference, both are in experiment "+exp1.ShortID()+")"))
+		return nil
+	}
+	for _, exp := range []*project.Experiment{exp1, exp2} {
+		if exp.Path == "" {
+			fmt.Fprintf(out, "%s\n", au.Faint("(experiment "+exp.ShortID()+" didn't save its code, so it can't be compared. Pass the 'path' argument to 'init()' to save it.)"))
+			return nil
+		}
+	}
+
+	dirs := []string{}
+	for _, exp := range []*project.Experiment{exp1, exp2} {
+		dir, err := files.TempDir("diff-" + exp.ShortID())
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if err := proj.FetchExperimentFiles(exp, dir); err != nil {
+			return err
+		}
+		dirs = append(dirs, dir)
+	}
+	return writeDirDiff(out, au, dirs[0], dirs[1], exp1.ShortID(), exp2.ShortID())
+}
+
+// writeDirDiff writes a unified diff of the files in dir1 and dir2 to out. The
+// files are named a/<path> and b/<path>, like git diff, so the diff can be
+// applied with patch -p1.
+func writeDirDiff(out io.Writer, au aurora.Aurora, dir1 string, dir2 string, name1 string, name2 string) error {
+	paths1, err := listRegularFiles(dir1)
+	if err != nil {
+		return err
+	}
+	paths2, err := listRegularFiles(dir2)
+	if err != nil {
+		return err
+	}
+	paths := []string{}
+	for p := range paths1 {
+		paths = append(paths, p)
+	}
+	for p := range paths2 {
+		if !paths1[p] {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	changed := 0
+	for _, p := range paths {
+		var data1, data2 []byte
+		oldName, newName := "a/"+p, "b/"+p
+		if paths1[p] {
+			if data1, err = ioutil.ReadFile(filepath.Join(dir1, p)); err != nil {
+				return err
+			}
+		} else {
+			oldName = "/dev/null"
+		}
+		if paths2[p] {
+			if data2, err = ioutil.ReadFile(filepath.Join(dir2, p)); err != nil {
+				return err
+			}
+		} else {
+			newName = "/dev/null"
+		}
+		if paths1[p] && paths2[p] && bytes.Equal(data1, data2) {
+			continue
+		}
+		changed++
+
+		fmt.Fprintf(out, "%s\n", au.Bold(fmt.Sprintf("diff %s/%s %s/%s", name1, p, name2, p)))
+		if isBinary(data1) || isBinary(data2) {
+			fmt.Fprintf(out, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		fmt.Fprintf(out, "%s\n%s\n", au.Bold("--- "+oldName), au.Bold("+++ "+newName))
+		lines := textdiff.Lines(textdiff.SplitLines(string(data1)), textdiff.SplitLines(string(data2)))
+		for _, hunk := range textdiff.Hunks(lines, codeDiffContext) {
+			fmt.Fprintf(out, "%s\n", au.Cyan(hunk.Header()))
+			for _, line := range hunk.Lines {
+				writeDiffLine(out, au, line)
+			}
+		}
+	}
+	if changed == 0 {
+		fmt.Fprintf(out, "%s\n", au.Faint("(no difference)"))
+	}
+	return nil
+}
+
+func writeDiffLine(out io.Writer, au aurora.Aurora, line textdiff.Line) {
+	text := strings.TrimSuffix(line.Text, "\n")
+	switch line.Op {
+	case textdiff.Delete:
+		fmt.Fprintf(out, "%s\n", au.Red("-"+text))
+	case textdiff.Insert:
+		fmt.Fprintf(out, "%s\n", au.Green("+"+text))
+	default:
+		fmt.Fprintf(out, " %s\n", text)
+	}
+	if !strings.HasSuffix(line.Text, "\n") {
+		fmt.Fprintln(out, `\ No newline at end of file`)
+	}
+}
+
+// listRegularFiles returns the paths of the files in dir, relative to it and
+// with forward slashes
+func listRegularFiles(dir string) (map[string]bool, error) {
+	paths := map[string]bool{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		paths[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return paths, err
+}
+
+// isBinary returns true if data looks like it isn't text, the same way git
+// decides, by looking for a null byte near the start
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
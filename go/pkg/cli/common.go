@@ -4,13 +4,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/keepsake/go/pkg/analytics"
 	"github.com/replicate/keepsake/go/pkg/config"
 	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
 	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/project"
 	"github.com/replicate/keepsake/go/pkg/repository"
 )
 
@@ -79,9 +85,59 @@ func getProjectDir() (string, error) {
 	return projectDir, nil
 }
 
+// getProjectConfig loads keepsake.yaml from projectDir, returning an empty config
+// if it doesn't exist (e.g. if the repository was passed with --repository)
+func getProjectConfig(projectDir string) (*config.Config, error) {
+	conf, _, err := config.FindConfigInWorkingDir(projectDir)
+	if err != nil {
+		if errors.IsConfigNotFound(err) {
+			conf = &config.Config{}
+		} else {
+			return nil, err
+		}
+	}
+	if template := os.Getenv("KEEPSAKE_TEMPLATE"); template != "" {
+		conf.Template = template
+	}
+	return conf, nil
+}
+
+// newProject returns a project for repo, configured with keepsake.yaml if
+// there is one in projectDir, so sensitive params are masked and derived
+// metrics and metric units are shown
+func newProject(repo repository.Repository, projectDir string) (*project.Project, error) {
+	if projectDir == "" {
+		return project.NewProject(repo, projectDir), nil
+	}
+	conf, err := getProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return project.NewProjectWithConfig(repo, projectDir, conf), nil
+}
+
+// getCostConfig returns the prices in keepsake.yaml for estimating experiment costs
+func getCostConfig(projectDir string) (*config.CostConfig, error) {
+	conf, err := getProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Cost == nil {
+		return nil, fmt.Errorf(`No prices are configured to estimate costs with. Add them to keepsake.yaml, for example:
+
+cost:
+  hourly_price: 3.06
+  storage_price_per_gb_month: 0.023`)
+	}
+	return conf.Cost, nil
+}
+
 // getRepository returns the project's repository, with caching if needed
 // This is not in repository package so we can do user interface stuff around syncing
 func getRepository(repositoryURL, projectDir string) (repository.Repository, error) {
+	if scheme, _, _, err := repository.SplitURL(repositoryURL); err == nil {
+		repositoryBackend = string(scheme)
+	}
 	needsCaching, err := repository.NeedsCaching(repositoryURL)
 	if err != nil {
 		return nil, err
@@ -90,7 +146,46 @@ func getRepository(repositoryURL, projectDir string) (repository.Repository, err
 	if needsCaching && projectDir != "" {
 		console.Info("Fetching new data from %q...", repositoryURL)
 	}
-	repo, err := repository.ForURL(repositoryURL, projectDir)
+	conf, err := getRepositoryConfig(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	files.ConfigureScratch(conf.ScratchOptions(projectDir))
+	repository.ConfigureHTTP(conf.HTTPOptions())
+	repository.ConfigureTimeouts(conf.Timeouts())
+	repository.ConfigureDefaultIgnore(!conf.DisableDefaultIgnore)
+	repo, err := repository.ForURLs(repositoryURL, conf.ArtifactRepository, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	// Check before anything is read or written, so an old version of Keepsake
+	// can't misread or write incompatible metadata to a shared repository
+	spec, err := repository.LoadSpec(repo)
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil {
+		if err := spec.CheckCompatible(repo.RootURL(), global.Version); err != nil {
+			return nil, err
+		}
+	}
+	if replicas := conf.PreferredArtifactReplicas(getRegionPreference(conf)); len(replicas) > 0 {
+		replicaRepos := []repository.Repository{}
+		for _, replica := range replicas {
+			replicaRepo, err := repository.ForURL(replica.Repository, projectDir)
+			if err != nil {
+				return nil, err
+			}
+			replicaRepos = append(replicaRepos, replicaRepo)
+		}
+		repo = repository.NewReplicaRepository(repo, replicaRepos)
+	}
+	// Inside the transfer log, so injected failures are retried
+	repo, err = wrapForChaos(repo)
+	if err != nil {
+		return nil, err
+	}
+	repo, err = wrapForTransferLog(repo)
 	if err != nil {
 		return nil, err
 	}
@@ -105,7 +200,107 @@ func getRepository(repositoryURL, projectDir string) (repository.Repository, err
 			return nil, err
 		}
 	}
-	return repo, nil
+	return wrapForReadOnly(wrapForDryRun(wrapForWriteOnce(repo, spec)), conf), nil
+}
+
+// wrapForWriteOnce returns a repository that writes new versions instead of
+// overwriting or deleting anything, if the repository is write-once. It wraps
+// the metadata cache, so the cache has all the versions too.
+func wrapForWriteOnce(repo repository.Repository, spec *repository.Spec) repository.Repository {
+	if spec != nil && spec.WriteOnce {
+		return repository.NewWriteOnceRepository(repo)
+	}
+	return repo
+}
+
+// wrapForReadOnly returns a repository that fails instead of writing or
+// deleting anything, if --read-only is set or read_only is set in conf.
+// It is the outermost wrapper, so nothing is written to the metadata cache
+// either.
+func wrapForReadOnly(repo repository.Repository, conf *config.Config) repository.Repository {
+	if global.ReadOnly || conf.ReadOnly {
+		return repository.NewReadOnlyRepository(repo)
+	}
+	return repo
+}
+
+var transferManifest *os.File
+
+// wrapForTransferLog returns a repository that logs every transfer and writes
+// it to the transfer manifest, if --verbose-transfers is set
+func wrapForTransferLog(repo repository.Repository) (repository.Repository, error) {
+	if !global.VerboseTransfers {
+		return repo, nil
+	}
+	if transferManifest == nil {
+		manifestPath := global.TransferManifest
+		if manifestPath == "" {
+			manifestPath = filepath.Join(os.TempDir(), fmt.Sprintf("keepsake-transfers-%s.jsonl", time.Now().Format("20060102-150405")))
+		}
+		f, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open transfer manifest: %w", err)
+		}
+		console.Info("Writing transfer manifest to %s", manifestPath)
+		transferManifest = f
+	}
+	return repository.NewTransferLogRepository(repo, transferManifest), nil
+}
+
+// wrapForChaos returns a repository that injects failures into a fraction of
+// operations, if KEEPSAKE_CHAOS_RATE is set, to test how they are handled
+func wrapForChaos(repo repository.Repository) (repository.Repository, error) {
+	opts, err := repository.ParseChaosOptions(os.Getenv("KEEPSAKE_CHAOS_RATE"), os.Getenv("KEEPSAKE_CHAOS_FAILURES"), os.Getenv("KEEPSAKE_CHAOS_SEED"))
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		return repo, nil
+	}
+	console.Warn("Injecting failures into %.0f%% of operations on %s, because KEEPSAKE_CHAOS_RATE is set", opts.Rate*100, repo.RootURL())
+	return repository.NewChaosRepository(repo, *opts), nil
+}
+
+// wrapForDryRun returns a repository that prints what would be written or
+// deleted instead of doing it, if --dry-run is set
+func wrapForDryRun(repo repository.Repository) repository.Repository {
+	if global.DryRun {
+		return repository.NewDryRunRepository(repo)
+	}
+	return repo
+}
+
+// getRepositoryConfig returns keepsake.yaml if repositoryURL is the repository
+// it is configured for, so options like artifact_repository aren't applied to
+// a repository passed with --repository. Otherwise, it returns an empty config.
+func getRepositoryConfig(repositoryURL, projectDir string) (*config.Config, error) {
+	if projectDir == "" {
+		return &config.Config{}, nil
+	}
+	conf, err := getProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Repository != repositoryURL {
+		return &config.Config{}, nil
+	}
+	return conf, nil
+}
+
+// getRegionPreference returns the regions to read artifacts from, from the
+// KEEPSAKE_REGION_PREFERENCE environment variable (a comma-separated list), or
+// region_preference in keepsake.yaml
+func getRegionPreference(conf *config.Config) []string {
+	if env := os.Getenv("KEEPSAKE_REGION_PREFERENCE"); env != "" {
+		regions := []string{}
+		for _, region := range strings.Split(env, ",") {
+			if region = strings.TrimSpace(region); region != "" {
+				regions = append(regions, region)
+			}
+		}
+		return regions
+	}
+	return conf.RegionPreference
 }
 
 // handlErrors wraps a cobra function, and will print and exit on error
@@ -114,8 +309,34 @@ func getRepository(repositoryURL, projectDir string) (repository.Repository, err
 // That behavior can be disabled with SilenceUsage option, but then Cobra arg/flag errors don't display usage. (sigh)
 func handleErrors(f func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
-		if err := f(cmd, args); err != nil {
-			console.Fatal(err.Error())
+		start := time.Now()
+		err := f(cmd, args)
+		trackTelemetry(cmd, time.Since(start), err)
+		if err != nil {
+			// console.Fatal exits, so PersistentPostRun doesn't get a chance to
+			stopProfiling()
+			console.Fatal("%s", explainError(err))
+		}
+	}
+}
+
+// repositoryBackend is the scheme of the repository the current command used, for telemetry
+var repositoryBackend = ""
+
+func trackTelemetry(cmd *cobra.Command, duration time.Duration, err error) {
+	errorClass := ""
+	if err != nil {
+		errorClass = errors.Code(err)
+		if errorClass == "" {
+			errorClass = "other"
 		}
 	}
+	if err := analytics.TrackTelemetry(analytics.CommandResult{
+		Command:    cmd.CommandPath(),
+		Duration:   duration,
+		Backend:    repositoryBackend,
+		ErrorClass: errorClass,
+	}); err != nil {
+		console.Debug("telemetry error: %s", err)
+	}
 }
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type costOpts struct {
+	groupBy       string
+	repositoryURL string
+}
+
+func newCostCommand() *cobra.Command {
+	var opts costOpts
+
+	cmd := &cobra.Command{
+		Use:   "cost",
+		Short: "Report the estimated cost of experiments in this project",
+		Long: `Report the estimated cost of experiments in this project, grouped by user or host.
+
+Costs are estimated from the prices in the "cost" section of keepsake.yaml. Compute is
+charged from when an experiment started until its latest checkpoint (or until now, if it
+is still running), and storage is charged for the size of its files since it started.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return cost(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Report costs per user:
+$ keepsake cost
+
+Report costs per machine:
+$ keepsake cost --group-by host`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.groupBy, "group-by", "user", "What to group costs by: 'user' or 'host'")
+
+	return cmd
+}
+
+func cost(opts costOpts, out io.Writer) error {
+	if opts.groupBy != "user" && opts.groupBy != "host" {
+		return fmt.Errorf("Invalid value for --group-by: %q. It must be 'user' or 'host'.", opts.groupBy)
+	}
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	prices, err := getCostConfig(projectDir)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	return costReport(out, proj, prices, opts.groupBy)
+}
+
+func costReport(out io.Writer, proj *project.Project, prices *config.CostConfig, groupBy string) error {
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return err
+	}
+	costs, err := proj.ExperimentCosts(prices)
+	if err != nil {
+		return err
+	}
+
+	groupCosts := map[string]*project.Cost{}
+	groupCounts := map[string]int{}
+	total := &project.Cost{}
+	for _, exp := range experiments {
+		group := exp.User
+		if groupBy == "host" {
+			group = exp.Host
+		}
+		if _, ok := groupCosts[group]; !ok {
+			groupCosts[group] = &project.Cost{}
+		}
+		groupCosts[group].Add(costs[exp.ID])
+		groupCounts[group]++
+		total.Add(costs[exp.ID])
+	}
+
+	groups := []string{}
+	for group := range groupCosts {
+		groups = append(groups, group)
+	}
+	// most expensive first
+	sort.Slice(groups, func(i, j int) bool {
+		return groupCosts[groups[i]].Total() > groupCosts[groups[j]].Total()
+	})
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tEXPERIMENTS\tRUNTIME\tSTORAGE\tCOMPUTE COST\tSTORAGE COST\tTOTAL COST\n", strings.ToUpper(groupBy))
+	for _, group := range groups {
+		writeCostRow(w, group, groupCounts[group], groupCosts[group])
+	}
+	writeCostRow(w, "(total)", len(experiments), total)
+	return w.Flush()
+}
+
+func writeCostRow(w *tabwriter.Writer, name string, numExperiments int, cost *project.Cost) {
+	if name == "" {
+		name = "(unknown)"
+	}
+	fmt.Fprintf(w, "%s\t%d\t%.1fh\t%s\t%.2f\t%.2f\t%.2f\n", name, numExperiments, cost.RuntimeHours, console.FormatBytes(uint64(cost.StorageBytes)), cost.Compute, cost.Storage, cost.Total())
+}
@@ -26,6 +26,15 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 	if global.Verbose {
 		console.SetLevel(console.DebugLevel)
 	}
+	if err := startProfiling(); err != nil {
+		return err
+	}
+	defer stopProfiling()
+	if global.PprofAddr != "" {
+		if err := servePprof(global.PprofAddr); err != nil {
+			return err
+		}
+	}
 
 	projectGetter := func() (proj *project.Project, err error) {
 		repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
@@ -36,8 +45,12 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return nil, err
 		}
-		proj = project.NewProject(repo, projectDir)
-		return proj, err
+		conf, err := getProjectConfig(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		proj = project.NewProjectWithConfig(repo, projectDir, conf)
+		return proj, nil
 	}
 
 	if err := shared.Serve(projectGetter, socketPath); err != nil {
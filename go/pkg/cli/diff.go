@@ -15,6 +15,7 @@ import (
 	"github.com/replicate/keepsake/go/pkg/console"
 	"github.com/replicate/keepsake/go/pkg/param"
 	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/table"
 )
 
 func newDiffCommand() *cobra.Command {
@@ -23,13 +24,23 @@ func newDiffCommand() *cobra.Command {
 		Short: "Compare two experiments or checkpoints",
 		Long: `Compare two experiments or checkpoints.
 
-If an experiment ID is passed, it will pick the best checkpoint from that experiment. If a primary metric is not defined in keepsake.yaml, it will use the latest checkpoint.`,
+If an experiment ID is passed, it will pick the best checkpoint from that experiment. If a primary metric is not defined in keepsake.yaml, it will use the latest checkpoint.
+
+With --code, the code that was saved with each experiment is downloaded and the differences are shown as a unified diff, so you can see which code change went with a change in metrics. The output goes through $PAGER (or less) when it is a terminal.`,
 		Run:  handleErrors(diffCheckpoints),
 		Args: cobra.ExactArgs(2),
+		Example: `Compare the best checkpoints of two experiments, including their code:
+$ keepsake diff --code 1c2d3e4 5f6a7b8
+
+Save the code changes as a patch:
+$ keepsake diff --code 1c2d3e4 5f6a7b8 > changes.patch`,
 	}
 
 	// We should have a --json flag here, see https://github.com/replicate/keepsake/issues/338
 	addRepositoryURLFlag(cmd)
+	cmd.Flags().String("format", "", "Output the differences as a table in this format: 'csv', 'md' (Markdown), or 'html'")
+	cmd.Flags().Bool("code", false, "Also show the differences in the code saved with each experiment, as a unified diff")
+	cmd.Flags().Bool("no-pager", false, "Don't page the output of --code")
 
 	return cmd
 }
@@ -50,7 +61,58 @@ func diffCheckpoints(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	proj := project.NewProject(repo, projectDir)
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	formatString, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	code, err := cmd.Flags().GetBool("code")
+	if err != nil {
+		return err
+	}
+	noPager, err := cmd.Flags().GetBool("no-pager")
+	if err != nil {
+		return err
+	}
+	if code && formatString != "" {
+		return fmt.Errorf("--code can't be used with --format")
+	}
+	if code {
+		exp1, com1, err := loadCheckpoint(proj, prefix1)
+		if err != nil {
+			return err
+		}
+		exp2, com2, err := loadCheckpoint(proj, prefix2)
+		if err != nil {
+			return err
+		}
+		// no colors in patch files
+		au := aurora.NewAurora(os.Getenv("NO_COLOR") == "" && console.IsTTY(os.Stdout))
+		write := func(out io.Writer) error {
+			if err := printCheckpointDiff(out, au, proj, exp1, com1, exp2, com2); err != nil {
+				return err
+			}
+			return printCodeDiff(out, au, proj, exp1, exp2)
+		}
+		if noPager {
+			return write(os.Stdout)
+		}
+		return withPager(write)
+	}
+	if formatString != "" {
+		format, err := table.ParseFormat(formatString)
+		if err != nil {
+			return err
+		}
+		t, err := diffTable(proj, prefix1, prefix2)
+		if err != nil {
+			return err
+		}
+		return t.Write(os.Stdout, format)
+	}
 	au := getAurora()
 	return printDiff(os.Stdout, au, proj, prefix1, prefix2)
 }
@@ -73,7 +135,10 @@ func printDiff(out io.Writer, au aurora.Aurora, proj *project.Project, prefix1 s
 	if err != nil {
 		return err
 	}
+	return printCheckpointDiff(out, au, proj, exp1, com1, exp2, com2)
+}
 
+func printCheckpointDiff(out io.Writer, au aurora.Aurora, proj *project.Project, exp1 *project.Experiment, com1 *project.Checkpoint, exp2 *project.Experiment, com2 *project.Checkpoint) error {
 	// min width for 3 columns in 78 char terminal
 	w := tabwriter.NewWriter(out, 78/3, 8, 2, ' ', 0)
 
@@ -101,47 +166,126 @@ func printDiff(out io.Writer, au aurora.Aurora, proj *project.Project, prefix1 s
 
 	heading(w, au, "Metrics")
 	// TODO(bfirsh): put primary metric first
-	printMapDiff(w, au, paramMapToStringMap(com1.Metrics), paramMapToStringMap(com2.Metrics))
+	printMetricsDiff(w, au, proj, com1, com2)
 	br(w)
 
 	return w.Flush()
 }
 
-func printMapDiff(w *tabwriter.Writer, au aurora.Aurora, map1, map2 map[string]string) {
-	diffMap := mapString(map1, map2)
+// diffTable returns the differences between two experiments or checkpoints as
+// a table, with a row for each difference
+func diffTable(proj *project.Project, prefix1 string, prefix2 string) (*table.Table, error) {
+	exp1, com1, err := loadCheckpoint(proj, prefix1)
+	if err != nil {
+		return nil, err
+	}
+	exp2, com2, err := loadCheckpoint(proj, prefix2)
+	if err != nil {
+		return nil, err
+	}
 
-	// sort the keys
-	type keyVal struct {
-		key   string
-		value []*string
+	t := table.New("section", "name", com1.ShortID(), com2.ShortID())
+	t.AddRow("Experiment", "ID", exp1.ShortID(), exp2.ShortID())
+	sections := []struct {
+		name       string
+		map1, map2 map[string]string
+	}{
+		{"Experiment", experimentToMap(exp1), experimentToMap(exp2)},
+		{"Params", paramMapToStringMap(exp1.Params), paramMapToStringMap(exp2.Params)},
+		{"Python Packages", exp1.PythonPackages, exp2.PythonPackages},
+		{"Checkpoint", checkpointToMap(com1), checkpointToMap(com2)},
+		{"Metrics", paramMapToStringMap(com1.Metrics), paramMapToStringMap(com2.Metrics)},
+	}
+	for _, section := range sections {
+		if section.name == "Checkpoint" {
+			t.AddRow("Checkpoint", "ID", com1.ShortID(), com2.ShortID())
+		}
+		// same HACK as printDiff
+		if section.name == "Experiment" && exp1.ID == exp2.ID {
+			continue
+		}
+		for _, row := range sortedMapDiff(section.map1, section.map2) {
+			t.AddRow(section.name, row.key, row.left, row.right)
+		}
 	}
-	keyVals := []keyVal{}
+	return t, nil
+}
+
+type mapDiffRow struct {
+	key   string
+	left  string
+	right string
+}
+
+// sortedMapDiff returns the keys with different values in map1 and map2, sorted by key
+func sortedMapDiff(map1, map2 map[string]string) []mapDiffRow {
+	diffMap := mapString(map1, map2)
+
+	rows := []mapDiffRow{}
 	for k, v := range diffMap {
-		keyVals = append(keyVals, keyVal{k, v})
+		row := mapDiffRow{key: k, left: "(not set)", right: "(not set)"}
+		if v[0] != nil {
+			row.left = *(v[0])
+		}
+		if v[1] != nil {
+			row.right = *(v[1])
+		}
+		rows = append(rows, row)
 	}
-	sort.Slice(keyVals, func(i, j int) bool {
-		return keyVals[i].key < keyVals[j].key
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].key < rows[j].key
 	})
+	return rows
+}
 
-	if len(keyVals) > 0 {
-		for _, kv := range keyVals {
-			left := "(not set)"
-			right := "(not set)"
-			if kv.value[0] != nil {
-				left = *(kv.value[0])
-			}
-			if kv.value[1] != nil {
-				right = *(kv.value[1])
-			}
+func printMapDiff(w *tabwriter.Writer, au aurora.Aurora, map1, map2 map[string]string) {
+	rows := sortedMapDiff(map1, map2)
+	if len(rows) > 0 {
+		for _, row := range rows {
 			// Truncate to 50, which seems ball-park sensible figure to make this fit in a wide terminal
 			// At some point when we have a clever responsive tabwriter, we can adjust this based on terminal width!
-			fmt.Fprintf(w, "%s:\t%s\t%s\n", kv.key, param.Truncate(left, 50), param.Truncate(right, 50))
+			fmt.Fprintf(w, "%s:\t%s\t%s\n", row.key, param.Truncate(row.left, 50), param.Truncate(row.right, 50))
 		}
 	} else {
 		fmt.Fprintf(w, "%s\t\t\n", au.Faint("(no difference)"))
 	}
 }
 
+// printMetricsDiff is printMapDiff for metrics, with their units. Values in
+// the second checkpoint are green if they are better than the first, and red
+// if they are worse, when it is known whether higher or lower is better.
+func printMetricsDiff(w *tabwriter.Writer, au aurora.Aurora, proj *project.Project, com1, com2 *project.Checkpoint) {
+	rows := sortedMapDiff(metricsToStringMap(proj, com1), metricsToStringMap(proj, com2))
+	if len(rows) == 0 {
+		fmt.Fprintf(w, "%s\t\t\n", au.Faint("(no difference)"))
+		return
+	}
+	for _, row := range rows {
+		right := param.Truncate(row.right, 50)
+		v1, ok1 := com1.MetricValue(row.key)
+		v2, ok2 := com2.MetricValue(row.key)
+		if goal, ok := proj.MetricGoal(com2, row.key); ok && ok1 && ok2 {
+			if goal.IsBetter(v2, v1) {
+				right = au.Green(right).String()
+			} else if goal.IsBetter(v1, v2) {
+				right = au.Red(right).String()
+			}
+		}
+		// the colored value is last, so its escape codes don't throw off
+		// the alignment of the columns
+		fmt.Fprintf(w, "%s:\t%s\t%s\n", row.key, param.Truncate(row.left, 50), right)
+	}
+}
+
+// metricsToStringMap formats a checkpoint's metrics with their units
+func metricsToStringMap(proj *project.Project, chk *project.Checkpoint) map[string]string {
+	result := make(map[string]string)
+	for name, v := range chk.Metrics {
+		result[name] = proj.Config().MetricConfig(name).FormatValue(v, v.String())
+	}
+	return result
+}
+
 // Returns a map of checkpoint things we want to show in diff
 func checkpointToMap(checkpoint *project.Checkpoint) map[string]string {
 	return map[string]string{
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 	"github.com/stretchr/testify/require"
 
 	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/files"
 	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+	"github.com/replicate/keepsake/go/pkg/table"
 	"github.com/replicate/keepsake/go/pkg/testutil"
 )
 
@@ -103,6 +108,59 @@ metric-3:                 (not set)                      0.5
 	require.Equal(t, expected, actual)
 }
 
+func TestDiffMetricUnits(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo := createShowTestData(t, workingDir, &config.Config{})
+	keepsakeYAML := `repository: file://` + path.Join(workingDir, ".keepsake") + `
+metrics:
+  metric-1:
+    unit: "%"
+    goal: maximize
+`
+	require.NoError(t, ioutil.WriteFile(path.Join(workingDir, "keepsake.yaml"), []byte(keepsakeYAML), 0644))
+	proj, err := newProject(repo, workingDir)
+	require.NoError(t, err)
+
+	au := aurora.NewAurora(true)
+	out := new(bytes.Buffer)
+	require.NoError(t, printDiff(out, au, proj, "2c", "3c"))
+	// 0.02 is better than 0.01
+	require.Contains(t, out.String(), "0.01%")
+	require.Contains(t, out.String(), au.Green("0.02%").String())
+
+	out = new(bytes.Buffer)
+	require.NoError(t, printDiff(out, au, proj, "3c", "2c"))
+	require.Contains(t, out.String(), au.Red("0.01%").String())
+}
+
+func TestDiffTable(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	conf := &config.Config{}
+	repo := createShowTestData(t, workingDir, conf)
+	proj := project.NewProject(repo, workingDir)
+
+	tbl, err := diffTable(proj, "1e", "3c")
+	require.NoError(t, err)
+	out := new(bytes.Buffer)
+	require.NoError(t, tbl.Write(out, table.FormatMarkdown))
+
+	expected := `
+| section | name | 2cccccc | 3cccccc |
+| --- | --- | --- | --- |
+| Experiment | ID | 1eeeeee | 1eeeeee |
+| Checkpoint | ID | 2cccccc | 3cccccc |
+| Checkpoint | Created | Mon, 02 Jan 2006 23:00:05 +08 | Mon, 02 Jan 2006 23:01:05 +08 |
+| Metrics | metric-1 | 0.01 | 0.02 |
+`
+	require.Equal(t, expected[1:], out.String())
+}
+
 func TestMapString(t *testing.T) {
 	// string pointer helpers
 	baz := "baz"
@@ -146,3 +204,70 @@ func TestMapString(t *testing.T) {
 		"different": "bop",
 	}))
 }
+
+func TestCodeDiff(t *testing.T) {
+	repoDir, err := files.TempDir("test-code-diff")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := project.NewProject(repo, repoDir)
+
+	codeFiles := []map[string]string{{
+		"train.py":  "import torch\n\nlr = 0.01\nlayers = 2\nprint(lr)\n",
+		"old.py":    "x = 1\n",
+		"model.bin": "\x00\x01",
+	}, {
+		"train.py":  "import torch\n\nlr = 0.02\nlayers = 2\nprint(lr)",
+		"new.py":    "y = 2\n",
+		"model.bin": "\x00\x02",
+	}}
+	experiments := []*project.Experiment{}
+	for i, id := range []string{"1eeeeeeeee", "2eeeeeeeee"} {
+		codeDir, err := files.TempDir("test-code-diff-code")
+		require.NoError(t, err)
+		defer os.RemoveAll(codeDir)
+		require.NoError(t, os.MkdirAll(path.Join(codeDir, "src"), 0755))
+		for name, contents := range codeFiles[i] {
+			require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "src", name), []byte(contents), 0644))
+		}
+		exp := &project.Experiment{ID: id, Created: time.Now().UTC(), Config: &config.Config{}, Path: "src"}
+		require.NoError(t, exp.Save(repo))
+		require.NoError(t, repo.PutPathTar(codeDir, "experiments/"+id+".tar.gz", "src"))
+		experiments = append(experiments, exp)
+	}
+
+	out := new(bytes.Buffer)
+	require.NoError(t, printCodeDiff(out, aurora.NewAurora(false), proj, experiments[0], experiments[1]))
+	expected := `Code
+diff 1eeeeee/src/model.bin 2eeeeee/src/model.bin
+Binary files a/src/model.bin and b/src/model.bin differ
+diff 1eeeeee/src/new.py 2eeeeee/src/new.py
+--- /dev/null
++++ b/src/new.py
+@@ -0,0 +1 @@
++y = 2
+diff 1eeeeee/src/old.py 2eeeeee/src/old.py
+--- a/src/old.py
++++ /dev/null
+@@ -1 +0,0 @@
+-x = 1
+diff 1eeeeee/src/train.py 2eeeeee/src/train.py
+--- a/src/train.py
++++ b/src/train.py
+@@ -1,5 +1,5 @@
+ import torch
+ 
+-lr = 0.01
++lr = 0.02
+ layers = 2
+-print(lr)
++print(lr)
+\ No newline at end of file
+`
+	require.Equal(t, expected, out.String())
+
+	out = new(bytes.Buffer)
+	require.NoError(t, printCodeDiff(out, aurora.NewAurora(false), proj, experiments[0], experiments[0]))
+	require.Equal(t, "Code\n(no difference, both are in experiment 1eeeeee)\n", out.String())
+}
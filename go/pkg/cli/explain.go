@@ -0,0 +1,95 @@
+package cli
+
+import (
+	goerrors "errors"
+	"strings"
+	"syscall"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/global"
+)
+
+// explanation is a short description of a common failure, and how to fix it
+type explanation struct {
+	summary string
+	fix     string
+}
+
+// explainError returns the message to show the user for err. For common failures,
+// this is a short explanation with the command or config change that fixes it,
+// followed by the original error if --verbose is set.
+func explainError(err error) string {
+	exp := explain(err)
+	if exp == nil {
+		return err.Error()
+	}
+	msg := exp.summary + "\n\n" + exp.fix
+	if global.Verbose {
+		msg += "\n\nThe full error was:\n" + err.Error()
+	} else {
+		msg += "\n\nRun with --verbose to see the full error."
+	}
+	return msg
+}
+
+func explain(err error) *explanation {
+	msg := err.Error()
+
+	switch {
+	case isOutOfDiskSpace(err):
+		return &explanation{
+			summary: "Your disk is full.",
+			fix:     "Free up some space, or if you are checking out files, check them out to a different disk with 'keepsake checkout --output-directory <dir>'.",
+		}
+	case errors.IsPermissionDenied(err) || isMissingCredentials(msg):
+		return &explanation{
+			summary: "Keepsake doesn't have permission to access the repository.",
+			fix:     credentialsFix(msg),
+		}
+	case errors.IsThrottled(err):
+		return &explanation{
+			summary: "The repository is getting too many requests and is limiting how many Keepsake can make.",
+			fix:     "Wait a minute and try again. If it keeps happening, reduce how often you save checkpoints.",
+		}
+	case errors.IsNetworkTimeout(err):
+		return &explanation{
+			summary: "Timed out connecting to the repository.",
+			fix:     "Check your internet connection and try again. If you are far from the repository, you can check out files from a nearby copy with 'artifact_replicas' in keepsake.yaml. See " + global.WebURL + "/docs/reference/yaml",
+		}
+	case errors.IsCorrupt(err):
+		return &explanation{
+			summary: "Some files in the repository are corrupted or were not uploaded completely.",
+			fix:     "Try again, in case they were damaged while downloading. If it keeps happening, the checkpoint will need to be saved again.",
+		}
+	case strings.Contains(msg, "gcloud config config-helper"):
+		return &explanation{
+			summary: "Keepsake couldn't find which Google Cloud project to use.",
+			fix:     "Install the Google Cloud SDK and run 'gcloud init', or set the GOOGLE_CLOUD_PROJECT environment variable to your project ID.",
+		}
+	}
+	return nil
+}
+
+func isOutOfDiskSpace(err error) bool {
+	// archiver doesn't wrap errors, so check the message too
+	return goerrors.Is(err, syscall.ENOSPC) || strings.Contains(err.Error(), "no space left on device")
+}
+
+func isMissingCredentials(msg string) bool {
+	return strings.Contains(msg, "NoCredentialProviders") || strings.Contains(msg, "could not find default credentials")
+}
+
+// credentialsFix returns how to give Keepsake access to the repository in msg
+func credentialsFix(msg string) string {
+	s3Fix := "To log in to AWS, run 'aws configure', or set the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables. Make sure the user can read and write the bucket."
+	gcsFix := "To log in to Google Cloud, run 'gcloud auth application-default login', or set GOOGLE_APPLICATION_CREDENTIALS to the path of a service account key. Make sure the account has the 'Storage Object Admin' role on the bucket."
+	switch {
+	case strings.Contains(msg, "s3://") || strings.Contains(msg, "NoCredentialProviders"):
+		return s3Fix
+	case strings.Contains(msg, "gs://") || strings.Contains(msg, "could not find default credentials"):
+		return gcsFix
+	case strings.Contains(msg, "file://") || strings.Contains(msg, "permission denied"):
+		return "Check that you can write to the repository's directory, e.g. with 'ls -ld <directory>'."
+	}
+	return s3Fix + "\n\n" + gcsFix
+}
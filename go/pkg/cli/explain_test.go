@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/global"
+)
+
+func TestExplainError(t *testing.T) {
+	msg := explainError(errors.PermissionDenied("Failed to read gs://my-bucket/metadata/experiments/abc.json: googleapi: Error 403: Forbidden"))
+	require.Contains(t, msg, "Keepsake doesn't have permission to access the repository.")
+	require.Contains(t, msg, "gcloud auth application-default login")
+	require.NotContains(t, msg, "aws configure")
+	require.NotContains(t, msg, "googleapi")
+
+	msg = explainError(errors.ReadError("Failed to read s3://my-bucket/foo: NoCredentialProviders: no valid providers in chain"))
+	require.Contains(t, msg, "aws configure")
+
+	msg = explainError(fmt.Errorf("Failed to check out: %w", syscall.ENOSPC))
+	require.Contains(t, msg, "Your disk is full.")
+	require.Contains(t, msg, "--output-directory")
+
+	global.Verbose = true
+	defer func() { global.Verbose = false }()
+	msg = explainError(errors.Throttled("Failed to write s3://my-bucket/foo: SlowDown"))
+	require.Contains(t, msg, "Wait a minute and try again.")
+	require.Contains(t, msg, "The full error was:\nFailed to write s3://my-bucket/foo: SlowDown")
+
+	// Other errors are shown as they are
+	require.Equal(t, "Experiment not found", explainError(errors.DoesNotExist("Experiment not found")))
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/cli/exportdb"
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+type exportDBOpts struct {
+	repositoryURL string
+	sql           bool
+}
+
+func newExportDBCommand() *cobra.Command {
+	var opts exportDBOpts
+
+	cmd := &cobra.Command{
+		Use:   "export-db <path>",
+		Short: "Export the metadata of all experiments to a SQLite database",
+		Long: `Export the metadata of all experiments to a SQLite database.
+
+The database has these tables:
+- experiments: one row per experiment, with when it was created, its status,
+  user, host, and command
+- params: one row per parameter of each experiment
+- checkpoints: one row per checkpoint, with its experiment and step
+- metrics: one row per metric of each checkpoint, so you can get the history
+  of a metric by its step
+
+This needs the sqlite3 command. If you don't have it, use --sql to write the
+SQL that creates the database instead.`,
+		Example: `Export to a database and find the best experiments by validation accuracy:
+$ keepsake export-db repo.sqlite
+$ sqlite3 repo.sqlite "SELECT experiment_id, MAX(value) FROM metrics WHERE name = 'val_acc' GROUP BY experiment_id ORDER BY 2 DESC LIMIT 10"
+
+Write the database as SQL to stdout:
+$ keepsake export-db --sql -`,
+		Run:  handleErrors(func(cmd *cobra.Command, args []string) error { return exportDB(opts, args) }),
+		Args: cobra.ExactArgs(1),
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.sql, "sql", false, "Write SQL statements that create the database to <path> (or stdout, if <path> is '-'), instead of creating it with sqlite3")
+
+	return cmd
+}
+
+func exportDB(opts exportDBOpts, args []string) error {
+	path := args[0]
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+
+	if !opts.sql {
+		if err := exportdb.Export(proj, path); err != nil {
+			return err
+		}
+		console.Info("Exported %s to %s", repo.RootURL(), path)
+		return nil
+	}
+
+	if path == "-" {
+		return exportdb.WriteSQL(os.Stdout, proj)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := exportdb.WriteSQL(f, proj); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	console.Info("Wrote SQL for %s to %s", repo.RootURL(), path)
+	return nil
+}
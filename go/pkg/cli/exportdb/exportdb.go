@@ -0,0 +1,178 @@
+// Package exportdb exports a repository's metadata as a SQLite database, so it
+// can be analyzed with SQL
+package exportdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+// Schema is the SQL that creates the tables. Values of params and metrics are
+// stored with their native SQLite type (e.g. INTEGER or TEXT) in the value column,
+// with the Keepsake type in the type column. Lists and dicts are stored as JSON.
+const Schema = `CREATE TABLE experiments (
+  id TEXT PRIMARY KEY,
+  created TEXT NOT NULL,
+  status TEXT NOT NULL,
+  user TEXT,
+  host TEXT,
+  command TEXT,
+  path TEXT,
+  python_version TEXT,
+  keepsake_version TEXT
+);
+CREATE TABLE params (
+  experiment_id TEXT NOT NULL REFERENCES experiments(id),
+  name TEXT NOT NULL,
+  type TEXT NOT NULL,
+  value,
+  PRIMARY KEY (experiment_id, name)
+);
+CREATE TABLE checkpoints (
+  id TEXT PRIMARY KEY,
+  experiment_id TEXT NOT NULL REFERENCES experiments(id),
+  created TEXT NOT NULL,
+  step INTEGER NOT NULL,
+  path TEXT,
+  primary_metric TEXT,
+  primary_metric_goal TEXT
+);
+CREATE TABLE metrics (
+  checkpoint_id TEXT NOT NULL REFERENCES checkpoints(id),
+  experiment_id TEXT NOT NULL REFERENCES experiments(id),
+  step INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL,
+  value,
+  PRIMARY KEY (checkpoint_id, name)
+);
+CREATE INDEX checkpoints_experiment_id ON checkpoints (experiment_id);
+CREATE INDEX metrics_experiment_id_name ON metrics (experiment_id, name, step);
+`
+
+// WriteSQL writes the SQL to create and fill a database with the metadata of
+// every experiment and checkpoint in proj
+func WriteSQL(w io.Writer, proj *project.Project) error {
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "BEGIN TRANSACTION;")
+	fmt.Fprint(bw, Schema)
+	for _, exp := range experiments {
+		status, err := experimentStatus(proj, exp)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "INSERT INTO experiments VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s);\n",
+			quote(exp.ID), quoteTime(exp.Created), quote(status), quote(exp.User), quote(exp.Host),
+			quote(exp.Command), quote(exp.Path), quote(exp.PythonVersion), quote(exp.KeepsakeVersion))
+		for _, p := range exp.SortedParams() {
+			fmt.Fprintf(bw, "INSERT INTO params VALUES (%s, %s, %s, %s);\n",
+				quote(exp.ID), quote(p.Name), quote(string(p.Value.Type())), literal(p.Value))
+		}
+		for _, chk := range exp.Checkpoints {
+			primaryMetric, goal := "NULL", "NULL"
+			if chk.PrimaryMetric != nil {
+				primaryMetric, goal = quote(chk.PrimaryMetric.Name), quote(string(chk.PrimaryMetric.Goal))
+			}
+			fmt.Fprintf(bw, "INSERT INTO checkpoints VALUES (%s, %s, %s, %d, %s, %s, %s);\n",
+				quote(chk.ID), quote(exp.ID), quoteTime(chk.Created), chk.Step, quote(chk.Path), primaryMetric, goal)
+			for _, m := range chk.SortedMetrics() {
+				fmt.Fprintf(bw, "INSERT INTO metrics VALUES (%s, %s, %d, %s, %s, %s);\n",
+					quote(chk.ID), quote(exp.ID), chk.Step, quote(m.Name), quote(string(m.Value.Type())), literal(m.Value))
+			}
+		}
+	}
+	fmt.Fprintln(bw, "COMMIT;")
+	return bw.Flush()
+}
+
+// Export writes the metadata of every experiment and checkpoint in proj to a
+// new SQLite database at dbPath, using the sqlite3 command
+func Export(proj *project.Project, dbPath string) error {
+	sqlitePath, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return fmt.Errorf("The sqlite3 command was not found. Install SQLite (e.g. 'apt install sqlite3' or 'brew install sqlite'), or use --sql to write the database as SQL and load it with another client.")
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		return fmt.Errorf("%s already exists. Delete it first, or choose a different path.", dbPath)
+	}
+
+	var sql bytes.Buffer
+	if err := WriteSQL(&sql, proj); err != nil {
+		return err
+	}
+	cmd := exec.Command(sqlitePath, "-bail", dbPath)
+	cmd.Stdin = &sql
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(dbPath)
+		return fmt.Errorf("Failed to create %s: %s\n%s", dbPath, err, output)
+	}
+	return nil
+}
+
+func experimentStatus(proj *project.Project, exp *project.Experiment) (string, error) {
+	state, err := proj.ExperimentState(exp.ID)
+	if err != nil {
+		return "", err
+	}
+	return string(state), nil
+}
+
+// literal returns v as a SQL literal
+func literal(v param.Value) string {
+	switch v.Type() {
+	case param.TypeInt:
+		return strconv.FormatInt(v.IntVal(), 10)
+	case param.TypeFloat:
+		f := v.FloatVal()
+		// SQLite doesn't have NaN, and infinities can't be written as literals
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "NULL"
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			// so SQLite stores it as a REAL
+			s += ".0"
+		}
+		return s
+	case param.TypeBool:
+		if v.BoolVal() {
+			return "1"
+		}
+		return "0"
+	case param.TypeString:
+		return quote(v.StringVal())
+	case param.TypeObject:
+		data, err := json.Marshal(v.ObjectVal())
+		if err != nil {
+			return "NULL"
+		}
+		return quote(string(data))
+	}
+	return "NULL"
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func quoteTime(t time.Time) string {
+	return quote(t.UTC().Format(time.RFC3339Nano))
+}
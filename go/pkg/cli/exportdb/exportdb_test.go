@@ -0,0 +1,86 @@
+package exportdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func createTestProject(t *testing.T, workingDir string) *project.Project {
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".keepsake"))
+	require.NoError(t, err)
+	created, err := time.Parse(time.RFC3339, "2020-11-12T01:02:03Z")
+	require.NoError(t, err)
+	exp := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: created,
+		Params: param.ValueMap{
+			"lr":        param.Float(0.01),
+			"optimizer": param.String("adam's"),
+			"layers":    param.Int(3),
+			"augment":   param.Bool(true),
+			"sizes":     param.Object([]interface{}{1.0, 2.0}),
+		},
+		User:    "andreas",
+		Command: "train.py",
+		Checkpoints: []*project.Checkpoint{{
+			ID:            "1ccccccccc",
+			Created:       created.Add(time.Minute),
+			Step:          10,
+			Metrics:       param.ValueMap{"loss": param.Float(2.5), "acc": param.Float(math.NaN())},
+			PrimaryMetric: &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize},
+		}},
+	}
+	require.NoError(t, exp.Save(repo))
+	return project.NewProject(repo, workingDir)
+}
+
+func TestWriteSQL(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	proj := createTestProject(t, workingDir)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSQL(&buf, proj))
+	sql := buf.String()
+	require.Contains(t, sql, "INSERT INTO experiments VALUES ('1eeeeeeeee', '2020-11-12T01:02:03Z', 'stopped', 'andreas', '', 'train.py', '', '', '');\n")
+	require.Contains(t, sql, "INSERT INTO params VALUES ('1eeeeeeeee', 'augment', 'bool', 1);\n")
+	require.Contains(t, sql, "INSERT INTO params VALUES ('1eeeeeeeee', 'layers', 'int', 3);\n")
+	require.Contains(t, sql, "INSERT INTO params VALUES ('1eeeeeeeee', 'lr', 'float', 0.01);\n")
+	require.Contains(t, sql, "INSERT INTO params VALUES ('1eeeeeeeee', 'optimizer', 'string', 'adam''s');\n")
+	require.Contains(t, sql, "INSERT INTO params VALUES ('1eeeeeeeee', 'sizes', 'object', '[1,2]');\n")
+	require.Contains(t, sql, "INSERT INTO checkpoints VALUES ('1ccccccccc', '1eeeeeeeee', '2020-11-12T01:03:03Z', 10, '', 'loss', 'minimize');\n")
+	require.Contains(t, sql, "INSERT INTO metrics VALUES ('1ccccccccc', '1eeeeeeeee', 10, 'acc', 'float', NULL);\n")
+	require.Contains(t, sql, "INSERT INTO metrics VALUES ('1ccccccccc', '1eeeeeeeee', 10, 'loss', 'float', 2.5);\n")
+}
+
+func TestExport(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	proj := createTestProject(t, workingDir)
+
+	dbPath := path.Join(workingDir, "repo.sqlite")
+	require.NoError(t, Export(proj, dbPath))
+	out, err := exec.Command("sqlite3", dbPath, "SELECT name, value FROM metrics WHERE name = 'loss'").Output()
+	require.NoError(t, err)
+	require.Equal(t, "loss|2.5\n", string(out))
+
+	// doesn't overwrite existing databases
+	require.Error(t, Export(proj, dbPath))
+}
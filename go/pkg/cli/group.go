@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func newGroupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "group",
+		Short: "Manage groups of experiments",
+		Long: `Manage groups of experiments.
+
+A group is a named set of experiments, like the experiments in a paper or a
+sprint. Pass --group to "keepsake ls" to list and compare the experiments in a
+group. Removing experiments from a group, or removing the group, doesn't remove
+the experiments themselves.`,
+		Example: `Put two experiments in a group:
+$ keepsake group create paper a1b2c3d4 e5f6a7b8
+
+Add all the experiments with a validation accuracy over 0.9:
+$ keepsake group add paper $(keepsake ls -q --filter "val_accuracy > 0.9")
+
+Compare the experiments in the group:
+$ keepsake ls --group paper
+
+Remove the group and its experiments:
+$ keepsake rm $(keepsake ls -q --group paper)
+$ keepsake group rm paper`,
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create <name> [experiment ID...]",
+		Short: "Create a group, with the given experiments",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return createGroup(cmd, args[0], args[1:])
+		}),
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add <name> <experiment ID> [experiment ID...]",
+		Short: "Add experiments to a group",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return addToGroup(cmd, args[0], args[1:])
+		}),
+		Args: cobra.MinimumNArgs(2),
+	}
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <name> <experiment ID> [experiment ID...]",
+		Short: "Remove experiments from a group, without removing the experiments",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return removeFromGroup(cmd, args[0], args[1:])
+		}),
+		Args: cobra.MinimumNArgs(2),
+	}
+
+	listCmd := &cobra.Command{
+		Use:     "ls",
+		Short:   "List the groups in this project",
+		Aliases: []string{"list"},
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return listGroups(cmd, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	rmCmd := &cobra.Command{
+		Use:     "rm <name>",
+		Short:   "Remove a group, without removing its experiments",
+		Aliases: []string{"delete"},
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return removeGroup(cmd, args[0])
+		}),
+		Args: cobra.ExactArgs(1),
+	}
+
+	for _, subcmd := range []*cobra.Command{createCmd, addCmd, removeCmd, listCmd, rmCmd} {
+		addRepositoryURLFlag(subcmd)
+		cmd.AddCommand(subcmd)
+	}
+	return cmd
+}
+
+func getGroupProject(cmd *cobra.Command) (*project.Project, error) {
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return newProject(repo, projectDir)
+}
+
+// experimentIDsFromPrefixes returns the full IDs of the experiments with these
+// ID prefixes
+func experimentIDsFromPrefixes(proj *project.Project, prefixes []string) ([]string, error) {
+	ids := []string{}
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, exp.ID)
+	}
+	return ids, nil
+}
+
+func createGroup(cmd *cobra.Command, name string, prefixes []string) error {
+	proj, err := getGroupProject(cmd)
+	if err != nil {
+		return err
+	}
+	ids, err := experimentIDsFromPrefixes(proj, prefixes)
+	if err != nil {
+		return err
+	}
+	group, err := proj.CreateGroup(name, ids)
+	if err != nil {
+		return err
+	}
+	console.Info("Created group %s with %d experiments", group.Name, len(group.ExperimentIDs))
+	return nil
+}
+
+func addToGroup(cmd *cobra.Command, name string, prefixes []string) error {
+	proj, err := getGroupProject(cmd)
+	if err != nil {
+		return err
+	}
+	group, err := proj.Group(name)
+	if err != nil {
+		return err
+	}
+	ids, err := experimentIDsFromPrefixes(proj, prefixes)
+	if err != nil {
+		return err
+	}
+	if err := proj.AddToGroup(group, ids); err != nil {
+		return err
+	}
+	console.Info("Group %s has %d experiments", group.Name, len(group.ExperimentIDs))
+	return nil
+}
+
+func removeFromGroup(cmd *cobra.Command, name string, prefixes []string) error {
+	proj, err := getGroupProject(cmd)
+	if err != nil {
+		return err
+	}
+	group, err := proj.Group(name)
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, prefix := range prefixes {
+		// experiments that have been removed can still be removed from groups
+		id, err := groupExperimentIDFromPrefix(group, prefix)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := proj.RemoveFromGroup(group, ids); err != nil {
+		return err
+	}
+	console.Info("Group %s has %d experiments", group.Name, len(group.ExperimentIDs))
+	return nil
+}
+
+func groupExperimentIDFromPrefix(group *project.Group, prefix string) (string, error) {
+	matches := []string{}
+	for _, id := range group.ExperimentIDs {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("Experiment %s isn't in group %s", prefix, group.Name)
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("Prefix is ambiguous: %s (%d matching experiments)", prefix, len(matches))
+	}
+	return matches[0], nil
+}
+
+func listGroups(cmd *cobra.Command, out io.Writer) error {
+	proj, err := getGroupProject(cmd)
+	if err != nil {
+		return err
+	}
+	groups, err := proj.Groups()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		console.Info("No groups found")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tEXPERIMENTS\tCREATED\n")
+	for _, group := range groups {
+		// experiments that have been removed are left in groups
+		numExperiments := 0
+		for _, id := range group.ExperimentIDs {
+			if _, err := proj.ExperimentByID(id); err == nil {
+				numExperiments++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", group.Name, numExperiments, group.Created.In(timezone).Format(time.RFC1123))
+	}
+	return w.Flush()
+}
+
+func removeGroup(cmd *cobra.Command, name string) error {
+	proj, err := getGroupProject(cmd)
+	if err != nil {
+		return err
+	}
+	group, err := proj.Group(name)
+	if err != nil {
+		return err
+	}
+	if err := proj.DeleteGroup(group); err != nil {
+		return err
+	}
+	console.Info("Removed group %s", group.Name)
+	return nil
+}
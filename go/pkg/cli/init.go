@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+type initOpts struct {
+	region       string
+	storageClass string
+	force        bool
+	writeOnce    bool
+}
+
+func newInitCommand() *cobra.Command {
+	var opts initOpts
+
+	cmd := &cobra.Command{
+		Use:   "init <repository URL>",
+		Short: "Set up a repository and keepsake.yaml for a project",
+		Long: `Set up a repository and keepsake.yaml for a project.
+
+This creates the bucket for the repository if it doesn't exist, marks it as a
+Keepsake repository, checks that it can be written to and read from, then
+writes a keepsake.yaml in the project directory that points at it.
+
+With --write-once, nothing in the repository is ever overwritten or deleted, so it
+can be used with a bucket that has a retention lock. New versions of metadata and
+files are written instead, and deleting something writes a version that marks it as
+deleted. This can't be turned off. It must be turned on before the retention lock is,
+because it changes repository.json.`,
+		Example: `Create a new Google Cloud Storage bucket in Europe, with the Nearline storage class:
+$ keepsake init gs://my-keepsake-bucket --region europe-west4 --storage-class NEARLINE
+
+Use a prefix in an existing S3 bucket:
+$ keepsake init s3://my-bucket/keepsake
+
+Use a bucket that will have a retention lock:
+$ keepsake init s3://my-compliance-bucket --write-once`,
+		Run:  handleErrors(func(cmd *cobra.Command, args []string) error { return initRepository(opts, args) }),
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVar(&opts.region, "region", "", "Region (S3) or location (Google Cloud Storage) to create the bucket in, if it doesn't exist. Default: us-east-1 on S3, or the Google Cloud Storage default")
+	cmd.Flags().StringVar(&opts.storageClass, "storage-class", "", "Default storage class of the bucket, if it is created (Google Cloud Storage only), e.g. STANDARD, NEARLINE, or COLDLINE")
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Overwrite keepsake.yaml if it already exists")
+	cmd.Flags().BoolVar(&opts.writeOnce, "write-once", false, "Never overwrite or delete anything in the repository, and write new versions instead. This can't be turned off.")
+
+	return cmd
+}
+
+func initRepository(opts initOpts, args []string) error {
+	repositoryURL := args[0]
+	if global.ReadOnly {
+		return errors.ReadOnly(fmt.Sprintf("Failed to initialize %s: --read-only is set, and initializing a repository writes to it", repositoryURL))
+	}
+	projectDir, err := filepath.Abs(global.ProjectDirectory)
+	if err != nil {
+		return fmt.Errorf("Failed to determine absolute directory of '%s': %w", global.ProjectDirectory, err)
+	}
+
+	scheme, _, _, err := repository.SplitURL(repositoryURL)
+	if err != nil {
+		return err
+	}
+	region := opts.region
+	if region == "" && scheme == repository.SchemeS3 {
+		region = global.S3Region
+	}
+
+	if global.DryRun {
+		console.Info("Would create %s if it doesn't exist, mark it as a Keepsake repository, and check Keepsake can write to and read from it", repositoryURL)
+		if opts.writeOnce {
+			console.Info("Would make %s write-once", repositoryURL)
+		}
+		return writeStarterConfig(projectDir, repositoryURL, opts.force)
+	}
+
+	created, err := repository.CreateBucketIfNotExists(repositoryURL, projectDir, repository.BucketOptions{
+		Region:       region,
+		StorageClass: opts.storageClass,
+	})
+	if err != nil {
+		return err
+	}
+	if created {
+		console.Info("Created %s", repositoryURL)
+	} else {
+		if opts.region != "" || opts.storageClass != "" {
+			console.Warn("%s already exists, so --region and --storage-class were not applied to it", repositoryURL)
+		}
+	}
+
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	spec, err := repository.LoadSpec(repo)
+	if err != nil {
+		return err
+	}
+	if spec == nil {
+		spec = &repository.Spec{Version: repository.Version, WriteOnce: opts.writeOnce}
+		if err := repository.SaveSpec(repo, spec); err != nil {
+			return err
+		}
+	} else if err := spec.CheckCompatible(repo.RootURL(), global.Version); err != nil {
+		return err
+	} else if opts.writeOnce && !spec.WriteOnce {
+		// This overwrites repository.json, so it can't be done once the
+		// bucket has a retention lock
+		spec.WriteOnce = true
+		if err := repository.SaveSpec(repo, spec); err != nil {
+			return err
+		}
+	}
+	if spec.WriteOnce {
+		if opts.writeOnce {
+			console.Info("%s is write-once. Nothing in it will be overwritten or deleted.", repo.RootURL())
+		}
+		repo = repository.NewWriteOnceRepository(repo)
+	}
+
+	console.Info("Checking Keepsake can write to and read from %s...", repo.RootURL())
+	if err := repository.VerifyAccess(repo); err != nil {
+		return err
+	}
+
+	return writeStarterConfig(projectDir, repositoryURL, opts.force)
+}
+
+// writeStarterConfig writes a keepsake.yaml that points at repositoryURL to projectDir
+func writeStarterConfig(projectDir string, repositoryURL string, force bool) error {
+	configPath := filepath.Join(projectDir, global.ConfigFilenames[0])
+	exists, err := files.FileExists(configPath)
+	if err != nil {
+		return err
+	}
+	if exists && !force {
+		conf, err := config.LoadConfig(configPath)
+		if err == nil && conf.Repository == repositoryURL {
+			console.Info("%s already uses %s", configPath, repositoryURL)
+			return nil
+		}
+		return fmt.Errorf("%s already exists. To use %s, set 'repository' in it, or pass --force to overwrite it.", configPath, repositoryURL)
+	}
+
+	contents := fmt.Sprintf(`# The location to store your experiments and checkpoints in.
+# For other options, see %s/docs/reference/yaml
+repository: %q
+`, global.WebURL, repositoryURL)
+	if global.DryRun {
+		console.Info("Would write %s:\n%s", configPath, contents)
+		return nil
+	}
+	if err := ioutil.WriteFile(configPath, []byte(contents), 0644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", configPath, err)
+	}
+	console.Info("Wrote %s. You're ready to go!", configPath)
+	return nil
+}
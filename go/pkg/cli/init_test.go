@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestInitRepository(t *testing.T) {
+	projectDir, err := files.TempDir("test-init")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	oldProjectDirectory := global.ProjectDirectory
+	global.ProjectDirectory = projectDir
+	defer func() { global.ProjectDirectory = oldProjectDirectory }()
+
+	require.NoError(t, initRepository(initOpts{}, []string{"file://.keepsake"}))
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	spec, err := repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.Equal(t, repository.Version, spec.Version)
+
+	conf, err := config.LoadConfig(path.Join(projectDir, "keepsake.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "file://.keepsake", conf.Repository)
+
+	// the access check cleans up after itself
+	paths, err := repo.List("access-check")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	// running it again is fine
+	require.NoError(t, initRepository(initOpts{}, []string{"file://.keepsake"}))
+
+	// but it doesn't overwrite keepsake.yaml pointing at another repository
+	err = initRepository(initOpts{}, []string{"file://other-repo"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pass --force to overwrite it")
+
+	require.NoError(t, initRepository(initOpts{force: true}, []string{"file://other-repo"}))
+	contents, err := ioutil.ReadFile(path.Join(projectDir, "keepsake.yaml"))
+	require.NoError(t, err)
+	require.Contains(t, string(contents), `repository: "file://other-repo"`)
+}
+
+func TestInitWriteOnceRepository(t *testing.T) {
+	projectDir, err := files.TempDir("test-init")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	oldProjectDirectory := global.ProjectDirectory
+	global.ProjectDirectory = projectDir
+	defer func() { global.ProjectDirectory = oldProjectDirectory }()
+
+	require.NoError(t, initRepository(initOpts{writeOnce: true}, []string{"file://.keepsake"}))
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	spec, err := repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.True(t, spec.WriteOnce)
+
+	// the access check's file is marked as deleted instead of being deleted
+	writeOnceRepo := repository.NewWriteOnceRepository(repo)
+	paths, err := writeOnceRepo.List("access-check")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+	paths, err = repo.List("access-check")
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+
+	// getRepository wraps it
+	wrapped, err := getRepository("file://.keepsake", projectDir)
+	require.NoError(t, err)
+	_, ok := wrapped.(*repository.WriteOnceRepository)
+	require.True(t, ok)
+}
@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type internalOpts struct {
+	path string
+
+	// create-experiment
+	command     string
+	paramsJSON  string
+	noHeartbeat bool
+
+	// create-checkpoint
+	step          int64
+	metricsJSON   string
+	primaryMetric string
+	goal          string
+}
+
+func newInternalCommand() *cobra.Command {
+	var opts internalOpts
+
+	cmd := &cobra.Command{
+		Use:   "internal",
+		Short: "Plumbing commands for recording experiments from languages other than Python",
+		Long: `Plumbing commands for recording experiments from languages other than Python.
+
+They are for thin wrappers in R, Julia, shell scripts, and so on. Each command
+prints what it created as a single line of JSON on stdout, in the same format
+as the metadata in the repository, and everything else on stderr.
+
+An experiment is running while its heartbeat is recent. create-experiment and
+create-checkpoint refresh it, and a wrapper that goes longer than 30 seconds
+between checkpoints should run "keepsake internal heartbeat" in the meantime.`,
+		Hidden: true,
+		Example: `id=$(keepsake internal create-experiment --path . --params-json '{"learning_rate": 0.01}' | jq -r .id)
+keepsake internal create-checkpoint $id --path model.pt --step 1 --metrics-json '{"loss": 0.5}' --primary-metric loss --goal minimize
+keepsake internal stop-experiment $id`,
+	}
+
+	createExperimentCmd := &cobra.Command{
+		Use:   "create-experiment",
+		Short: "Create an experiment, and print it as JSON",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return internalCreateExperiment(cmd, opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+	createExperimentCmd.Flags().StringVar(&opts.path, "path", "", "Path to the experiment's code, relative to the project directory. Default: don't save any code")
+	createExperimentCmd.Flags().StringVar(&opts.command, "command", "", "The command that is running the experiment")
+	createExperimentCmd.Flags().StringVar(&opts.paramsJSON, "params-json", "", "The experiment's params, as a JSON object")
+	createExperimentCmd.Flags().BoolVar(&opts.noHeartbeat, "no-heartbeat", false, "Don't mark the experiment as running")
+
+	createCheckpointCmd := &cobra.Command{
+		Use:   "create-checkpoint <experiment ID>",
+		Short: "Create a checkpoint in an experiment, and print it as JSON",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return internalCreateCheckpoint(cmd, opts, args[0], os.Stdout)
+		}),
+		Args: cobra.ExactArgs(1),
+	}
+	createCheckpointCmd.Flags().StringVar(&opts.path, "path", "", "Path to the checkpoint's files, relative to the project directory. Default: don't save any files")
+	createCheckpointCmd.Flags().Int64Var(&opts.step, "step", 0, "The checkpoint's step. Default: no step")
+	createCheckpointCmd.Flags().StringVar(&opts.metricsJSON, "metrics-json", "", "The checkpoint's metrics, as a JSON object")
+	createCheckpointCmd.Flags().StringVar(&opts.primaryMetric, "primary-metric", "", "The metric that decides which checkpoint is best")
+	createCheckpointCmd.Flags().StringVar(&opts.goal, "goal", string(project.GoalMaximize), "Whether the primary metric should be maximized or minimized")
+
+	heartbeatCmd := &cobra.Command{
+		Use:   "heartbeat <experiment ID>",
+		Short: "Mark an experiment as still running",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return internalHeartbeat(cmd, args[0])
+		}),
+		Args: cobra.ExactArgs(1),
+	}
+
+	stopExperimentCmd := &cobra.Command{
+		Use:   "stop-experiment <experiment ID>",
+		Short: "Mark an experiment as stopped",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return internalStopExperiment(cmd, args[0])
+		}),
+		Args: cobra.ExactArgs(1),
+	}
+
+	for _, subcmd := range []*cobra.Command{createExperimentCmd, createCheckpointCmd, heartbeatCmd, stopExperimentCmd} {
+		addRepositoryURLFlag(subcmd)
+		cmd.AddCommand(subcmd)
+	}
+	return cmd
+}
+
+// getInternalProject returns the project for the plumbing commands, with
+// keepsake.yaml applied as it is when experiments are created from Python
+func getInternalProject(cmd *cobra.Command) (*project.Project, error) {
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := getProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return project.NewProjectWithConfig(repo, projectDir, conf), nil
+}
+
+// parseValueMapJSON parses a JSON object of params or metrics, or returns an
+// empty map if s is empty
+func parseValueMapJSON(s string, flag string) (param.ValueMap, error) {
+	values := param.ValueMap{}
+	if s == "" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(s), &values); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON object: %w", flag, err)
+	}
+	return values, nil
+}
+
+func writeJSONLine(out io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+func internalCreateExperiment(cmd *cobra.Command, opts internalOpts, out io.Writer) error {
+	params, err := parseValueMapJSON(opts.paramsJSON, "--params-json")
+	if err != nil {
+		return err
+	}
+	proj, err := getInternalProject(cmd)
+	if err != nil {
+		return err
+	}
+	exp, err := proj.CreateExperiment(project.CreateExperimentArgs{
+		Path:    opts.path,
+		Command: opts.command,
+		Params:  params,
+	}, false, nil, true)
+	if err != nil {
+		return err
+	}
+	if !opts.noHeartbeat {
+		if err := proj.RefreshHeartbeat(exp.ID); err != nil {
+			return err
+		}
+	}
+	return writeJSONLine(out, exp)
+}
+
+func internalCreateCheckpoint(cmd *cobra.Command, opts internalOpts, experimentID string, out io.Writer) error {
+	metrics, err := parseValueMapJSON(opts.metricsJSON, "--metrics-json")
+	if err != nil {
+		return err
+	}
+	primaryMetric, err := parsePrimaryMetric(opts.primaryMetric, opts.goal)
+	if err != nil {
+		return err
+	}
+	proj, err := getInternalProject(cmd)
+	if err != nil {
+		return err
+	}
+	exp, err := proj.ExperimentFromPrefix(experimentID)
+	if err != nil {
+		return err
+	}
+	chk, err := addCheckpoint(proj, exp, project.CreateCheckpointArgs{
+		Path:          opts.path,
+		Step:          opts.step,
+		Metrics:       metrics,
+		PrimaryMetric: primaryMetric,
+		NoStep:        !cmd.Flags().Changed("step"),
+	})
+	if err != nil {
+		return err
+	}
+	if err := proj.RefreshHeartbeat(exp.ID); err != nil {
+		return err
+	}
+	return writeJSONLine(out, chk)
+}
+
+func parsePrimaryMetric(name string, goal string) (*project.PrimaryMetric, error) {
+	if name == "" {
+		return nil, nil
+	}
+	switch project.MetricGoal(goal) {
+	case project.GoalMaximize, project.GoalMinimize:
+		return &project.PrimaryMetric{Name: name, Goal: project.MetricGoal(goal)}, nil
+	}
+	return nil, fmt.Errorf("--goal must be '%s' or '%s', not '%s'", project.GoalMaximize, project.GoalMinimize, goal)
+}
+
+// addCheckpoint creates a checkpoint, waiting for its files to be saved, and
+// adds it to exp, like the Python library does
+func addCheckpoint(proj *project.Project, exp *project.Experiment, args project.CreateCheckpointArgs) (*project.Checkpoint, error) {
+	args.ExperimentID = exp.ID
+	chk, err := proj.CreateCheckpoint(args, false, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	if _, err := proj.SaveExperiment(exp, true); err != nil {
+		return nil, err
+	}
+	return chk, nil
+}
+
+func internalHeartbeat(cmd *cobra.Command, experimentID string) error {
+	proj, err := getInternalProject(cmd)
+	if err != nil {
+		return err
+	}
+	exp, err := proj.ExperimentFromPrefix(experimentID)
+	if err != nil {
+		return err
+	}
+	return proj.RefreshHeartbeat(exp.ID)
+}
+
+func internalStopExperiment(cmd *cobra.Command, experimentID string) error {
+	proj, err := getInternalProject(cmd)
+	if err != nil {
+		return err
+	}
+	exp, err := proj.ExperimentFromPrefix(experimentID)
+	if err != nil {
+		return err
+	}
+	return proj.StopExperiment(exp.ID)
+}
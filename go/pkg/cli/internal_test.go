@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestParseValueMapJSON(t *testing.T) {
+	values, err := parseValueMapJSON(`{"learning_rate": 0.01, "layers": 3, "name": "resnet", "dropout": null}`, "--params-json")
+	require.NoError(t, err)
+	require.Equal(t, param.ValueMap{
+		"learning_rate": param.Float(0.01),
+		"layers":        param.Int(3),
+		"name":          param.String("resnet"),
+		"dropout":       param.None(),
+	}, values)
+
+	values, err = parseValueMapJSON("", "--params-json")
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	_, err = parseValueMapJSON("[1, 2]", "--params-json")
+	require.Error(t, err)
+}
+
+func TestParsePrimaryMetric(t *testing.T) {
+	primaryMetric, err := parsePrimaryMetric("loss", "minimize")
+	require.NoError(t, err)
+	require.Equal(t, &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}, primaryMetric)
+
+	primaryMetric, err = parsePrimaryMetric("", "minimize")
+	require.NoError(t, err)
+	require.Nil(t, primaryMetric)
+
+	_, err = parsePrimaryMetric("loss", "lower")
+	require.Error(t, err)
+}
+
+func TestAddCheckpoint(t *testing.T) {
+	projectDir, err := files.TempDir("test-internal")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model.pt"), []byte("weights"), 0644))
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := project.NewProjectWithConfig(repo, projectDir, &config.Config{})
+
+	exp, err := proj.CreateExperiment(project.CreateExperimentArgs{
+		Params: param.ValueMap{"learning_rate": param.Float(0.01)},
+	}, false, nil, true)
+	require.NoError(t, err)
+
+	chk, err := addCheckpoint(proj, exp, project.CreateCheckpointArgs{
+		Path:    "model.pt",
+		Step:    1,
+		Metrics: param.ValueMap{"loss": param.Float(0.5)},
+	})
+	require.NoError(t, err)
+
+	// saved to the experiment, with its files
+	loaded, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 1)
+	require.Equal(t, chk.ID, loaded.Checkpoints[0].ID)
+	require.Equal(t, int64(1), loaded.Checkpoints[0].Step)
+	tarFiles, err := repo.ListTarFile(chk.StorageTarPath())
+	require.NoError(t, err)
+	require.Equal(t, []string{"model.pt"}, tarFiles)
+
+	// printed as the metadata is stored
+	out := new(bytes.Buffer)
+	require.NoError(t, writeJSONLine(out, chk))
+	decoded := new(project.Checkpoint)
+	require.NoError(t, json.Unmarshal(out.Bytes(), decoded))
+	require.Equal(t, chk.ID, decoded.ID)
+	require.Equal(t, param.Float(0.5), decoded.Metrics["loss"])
+}
+
+func TestReadMetricsFile(t *testing.T) {
+	dir, err := files.TempDir("test-save")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	metricsPath := path.Join(dir, "metrics.json")
+	require.NoError(t, ioutil.WriteFile(metricsPath, []byte(`{"loss": 0.5}`), 0644))
+
+	metrics, err := readMetricsFile(metricsPath, nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"loss": 0.5}`, metrics)
+
+	metrics, err = readMetricsFile("-", bytes.NewBufferString(`{"loss": 0.4}`))
+	require.NoError(t, err)
+	require.Equal(t, `{"loss": 0.4}`, metrics)
+
+	metrics, err = readMetricsFile("", nil)
+	require.NoError(t, err)
+	require.Equal(t, "", metrics)
+
+	_, err = readMetricsFile(path.Join(dir, "does-not-exist.json"), nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type lineageOpts struct {
+	dot           bool
+	repositoryURL string
+}
+
+func newLineageCommand() *cobra.Command {
+	var opts lineageOpts
+
+	cmd := &cobra.Command{
+		Use:   "lineage [experiment ID]",
+		Short: "Show which experiments were started from checkpoints of other experiments",
+		Long: `Show which experiments were started from checkpoints of other experiments, like
+models that were fine-tuned from another model, as a tree.
+
+An experiment was started from a checkpoint if one of its params is the checkpoint's
+ID, or its short ID. For example, in Python:
+
+    experiment = keepsake.init(params={"base_checkpoint": checkpoint.id})
+
+If an experiment ID is passed, only the experiments related to it are shown.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return lineage(opts, args, os.Stdout)
+		}),
+		Args: cobra.MaximumNArgs(1),
+		Example: `Show the lineage of every experiment:
+$ keepsake lineage
+
+Draw the family tree of an experiment with Graphviz:
+$ keepsake lineage --dot a1b2c3d | dot -Tpng -o lineage.png`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.dot, "dot", false, "Print the lineage as a Graphviz DOT graph")
+
+	return cmd
+}
+
+func lineage(opts lineageOpts, args []string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	links, err := proj.Lineage()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		exp, err := proj.ExperimentFromPrefix(args[0])
+		if err != nil {
+			return err
+		}
+		links = lineageFamily(links, exp.ID)
+	}
+
+	if opts.dot {
+		return writeLineageDot(out, links)
+	}
+	if len(links) == 0 {
+		fmt.Fprintln(out, "No experiments were started from checkpoints of other experiments.")
+		return nil
+	}
+	return writeLineageTree(out, links)
+}
+
+// lineageFamily returns the links that connect experimentID to its ancestors,
+// descendants, and their other relatives
+func lineageFamily(links []*project.LineageLink, experimentID string) []*project.LineageLink {
+	family := map[string]bool{experimentID: true}
+	for added := true; added; {
+		added = false
+		for _, link := range links {
+			parent, child := link.ParentExperiment.ID, link.Experiment.ID
+			if family[parent] != family[child] {
+				family[parent], family[child] = true, true
+				added = true
+			}
+		}
+	}
+	result := []*project.LineageLink{}
+	for _, link := range links {
+		if family[link.Experiment.ID] {
+			result = append(result, link)
+		}
+	}
+	return result
+}
+
+func writeLineageTree(out io.Writer, links []*project.LineageLink) error {
+	childLinks := map[string][]*project.LineageLink{}
+	isChild := map[string]bool{}
+	roots := []*project.Experiment{}
+	seenRoots := map[string]bool{}
+	for _, link := range links {
+		childLinks[link.ParentExperiment.ID] = append(childLinks[link.ParentExperiment.ID], link)
+		isChild[link.Experiment.ID] = true
+	}
+	for _, link := range links {
+		parent := link.ParentExperiment
+		if !isChild[parent.ID] && !seenRoots[parent.ID] {
+			roots = append(roots, parent)
+			seenRoots[parent.ID] = true
+		}
+	}
+
+	visited := map[string]bool{}
+	var writeExperiment func(exp *project.Experiment, indent string)
+	writeExperiment = func(exp *project.Experiment, indent string) {
+		if visited[exp.ID] {
+			return
+		}
+		visited[exp.ID] = true
+		links := childLinks[exp.ID]
+		for i, link := range links {
+			branch, nextIndent := "├─ ", indent+"│  "
+			if i == len(links)-1 {
+				branch, nextIndent = "└─ ", indent+"   "
+			}
+			fmt.Fprintf(out, "%s%scheckpoint %s → %s (%s=%s)\n", indent, branch, describeLineageCheckpoint(link.Checkpoint), describeLineageExperiment(link.Experiment), link.Param, link.Experiment.Params[link.Param].String())
+			writeExperiment(link.Experiment, nextIndent)
+		}
+	}
+	for i, root := range roots {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, describeLineageExperiment(root))
+		writeExperiment(root, "")
+	}
+	return nil
+}
+
+func writeLineageDot(out io.Writer, links []*project.LineageLink) error {
+	fmt.Fprintln(out, "digraph lineage {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	nodes := map[string]bool{}
+	edges := map[string]bool{}
+	writeNode := func(id string, shape string, label string) {
+		if nodes[id] {
+			return
+		}
+		nodes[id] = true
+		fmt.Fprintf(out, "  %s [shape=%s, label=%s];\n", dotQuote(id), shape, dotQuote(label))
+	}
+	for _, link := range links {
+		parentID, chkID, childID := "experiment:"+link.ParentExperiment.ID, "checkpoint:"+link.Checkpoint.ID, "experiment:"+link.Experiment.ID
+		writeNode(parentID, "box", describeLineageExperiment(link.ParentExperiment))
+		writeNode(chkID, "ellipse", describeLineageCheckpoint(link.Checkpoint))
+		writeNode(childID, "box", describeLineageExperiment(link.Experiment))
+		if !edges[parentID+" -> "+chkID] {
+			edges[parentID+" -> "+chkID] = true
+			fmt.Fprintf(out, "  %s -> %s;\n", dotQuote(parentID), dotQuote(chkID))
+		}
+		fmt.Fprintf(out, "  %s -> %s [style=dashed, label=%s];\n", dotQuote(chkID), dotQuote(childID), dotQuote(link.Param))
+	}
+	fmt.Fprintln(out, "}")
+	return nil
+}
+
+func describeLineageExperiment(exp *project.Experiment) string {
+	parts := []string{"experiment " + exp.ShortID()}
+	if exp.User != "" {
+		parts = append(parts, exp.User)
+	}
+	parts = append(parts, exp.Created.In(timezone).Format("2006-01-02"))
+	return strings.Join(parts, ", ")
+}
+
+func describeLineageCheckpoint(chk *project.Checkpoint) string {
+	s := fmt.Sprintf("%s (step %d", chk.ShortID(), chk.Step)
+	if chk.PrimaryMetric != nil {
+		if value, ok := chk.Metrics[chk.PrimaryMetric.Name]; ok {
+			s += ", " + chk.PrimaryMetric.Name + "=" + value.ShortString(10, 5)
+		}
+	}
+	return s + ")"
+}
+
+// dotQuote returns s as a quoted Graphviz ID
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func createLineageTestLinks() []*project.LineageLink {
+	created, _ := time.Parse(time.RFC3339, "2020-10-07T12:00:00+08:00")
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	base := &project.Experiment{ID: "1eeeeeeeee", Created: created, User: "alice"}
+	baseChk := &project.Checkpoint{ID: "1ccccccccc", Step: 10, Metrics: param.ValueMap{"loss": param.Float(0.3)}, PrimaryMetric: primaryMetric}
+	tuned := &project.Experiment{ID: "2eeeeeeeee", Created: created, User: "bob", Params: param.ValueMap{"base": param.String("1cccccc")}}
+	tunedChk := &project.Checkpoint{ID: "2ccccccccc", Step: 5}
+	tunedAgain := &project.Experiment{ID: "3eeeeeeeee", Created: created, User: "bob", Params: param.ValueMap{"base": param.String("2ccccccccc")}}
+	other := &project.Experiment{ID: "4eeeeeeeee", Created: created, User: "carol"}
+	otherChk := &project.Checkpoint{ID: "4ccccccccc", Step: 1}
+	otherTuned := &project.Experiment{ID: "5eeeeeeeee", Created: created, User: "carol", Params: param.ValueMap{"init": param.String("4cccccc")}}
+	return []*project.LineageLink{
+		{ParentExperiment: base, Checkpoint: baseChk, Experiment: tuned, Param: "base"},
+		{ParentExperiment: tuned, Checkpoint: tunedChk, Experiment: tunedAgain, Param: "base"},
+		{ParentExperiment: other, Checkpoint: otherChk, Experiment: otherTuned, Param: "init"},
+	}
+}
+
+func TestLineageTree(t *testing.T) {
+	timezone, _ = time.LoadLocation("Asia/Ulaanbaatar")
+	out := new(bytes.Buffer)
+	require.NoError(t, writeLineageTree(out, createLineageTestLinks()))
+	require.Equal(t, `experiment 1eeeeee, alice, 2020-10-07
+└─ checkpoint 1cccccc (step 10, loss=0.3) → experiment 2eeeeee, bob, 2020-10-07 (base=1cccccc)
+   └─ checkpoint 2cccccc (step 5) → experiment 3eeeeee, bob, 2020-10-07 (base=2ccccccccc)
+
+experiment 4eeeeee, carol, 2020-10-07
+└─ checkpoint 4cccccc (step 1) → experiment 5eeeeee, carol, 2020-10-07 (init=4cccccc)
+`, out.String())
+}
+
+func TestLineageDot(t *testing.T) {
+	timezone, _ = time.LoadLocation("Asia/Ulaanbaatar")
+	out := new(bytes.Buffer)
+	// only the family of the second experiment
+	links := lineageFamily(createLineageTestLinks(), "2eeeeeeeee")
+	require.NoError(t, writeLineageDot(out, links))
+	require.Equal(t, `digraph lineage {
+  rankdir=LR;
+  "experiment:1eeeeeeeee" [shape=box, label="experiment 1eeeeee, alice, 2020-10-07"];
+  "checkpoint:1ccccccccc" [shape=ellipse, label="1cccccc (step 10, loss=0.3)"];
+  "experiment:2eeeeeeeee" [shape=box, label="experiment 2eeeeee, bob, 2020-10-07"];
+  "experiment:1eeeeeeeee" -> "checkpoint:1ccccccccc";
+  "checkpoint:1ccccccccc" -> "experiment:2eeeeeeeee" [style=dashed, label="base"];
+  "checkpoint:2ccccccccc" [shape=ellipse, label="2cccccc (step 5)"];
+  "experiment:3eeeeeeeee" [shape=box, label="experiment 3eeeeee, bob, 2020-10-07"];
+  "experiment:2eeeeeeeee" -> "checkpoint:2ccccccccc";
+  "checkpoint:2ccccccccc" -> "experiment:3eeeeeeeee" [style=dashed, label="base"];
+}
+`, out.String())
+}
@@ -2,10 +2,15 @@ package cli
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/araddon/dateparse"
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/keepsake/go/pkg/cli/list"
+	"github.com/replicate/keepsake/go/pkg/config"
 	"github.com/replicate/keepsake/go/pkg/param"
 )
 
@@ -22,12 +27,36 @@ $ keepsake ls
 List experiments that have run for 50 steps or less:
 $ keepsake ls --filter "step <= 50"
 
+Export all experiments with their params and metrics to a spreadsheet:
+$ keepsake ls --all --format csv > experiments.csv
+
 List experiments where the parameter "optimizer" is "adam" and
 the best "accuracy" metric is greater than 0.8:
 $ keepsake ls --filter "optimizer = adam" --filter "accuracy > 0.8"
 
 Sort all stopped experiments by the metric "val_loss":
 $ keepsake ls --sort "val_loss" --filter "status = stopped"
+
+Show the estimated cost of experiments, most expensive first:
+$ keepsake ls --show-cost --sort cost-desc
+
+List the 20 most recent experiments:
+$ keepsake ls --sort created-desc --limit 20
+
+List the next 20:
+$ keepsake ls --sort created-desc --limit 20 --offset 20
+
+List experiments created in the last two days:
+$ keepsake ls --since 2d
+
+List experiments created in September 2020:
+$ keepsake ls --since 2020-09-01 --until 2020-10-01
+
+Compare the experiments in the group "paper":
+$ keepsake ls --group paper
+
+Only show the columns you care about:
+$ keepsake ls --columns id,created,user,params.lr,metrics.best.val_acc
 `,
 	}
 
@@ -35,6 +64,11 @@ $ keepsake ls --sort "val_loss" --filter "status = stopped"
 	addListFormatFlags(cmd)
 	addListFilterFlag(cmd)
 	addListSortFlag(cmd)
+	addListTimeFlags(cmd)
+	addListPageFlags(cmd)
+	cmd.Flags().Bool("show-cost", false, "Show the estimated cost of each experiment, using the prices in keepsake.yaml")
+	cmd.Flags().String("group", "", "Only list the experiments in this group")
+	cmd.Flags().StringSlice("columns", []string{}, "Comma-separated columns to show instead of the default ones: "+strings.Join(list.ColumnFields, ", ")+", or params and metrics like params.lr, metrics.val_acc, metrics.best.val_acc, or metrics.latest.val_acc")
 
 	return cmd
 }
@@ -52,25 +86,97 @@ func listExperiments(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := parseListTimeFlags(cmd, filters, time.Now()); err != nil {
+		return err
+	}
 	sortKey, err := parseListSortFlag(cmd)
 	if err != nil {
 		return err
 	}
+	page, err := parseListPageFlags(cmd)
+	if err != nil {
+		return err
+	}
+	columns, err := cmd.Flags().GetStringSlice("columns")
+	if err != nil {
+		return err
+	}
+	if len(columns) > 0 {
+		if err := list.ValidateColumns(columns); err != nil {
+			return err
+		}
+	}
+	showCost, err := cmd.Flags().GetBool("show-cost")
+	if err != nil {
+		return err
+	}
+	// the cost column needs prices, like --show-cost
+	for _, column := range columns {
+		if column == "cost" {
+			showCost = true
+		}
+	}
+	var prices *config.CostConfig
+	if showCost {
+		prices, err = getCostConfig(projectDir)
+		if err != nil {
+			return err
+		}
+	}
 	repo, err := getRepository(repositoryURL, projectDir)
 	if err != nil {
 		return err
 	}
-	return list.Experiments(repo, format, all, filters, sortKey)
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	var matcher param.Matcher = filters
+	groupName, err := cmd.Flags().GetString("group")
+	if err != nil {
+		return err
+	}
+	if groupName != "" {
+		group, err := proj.Group(groupName)
+		if err != nil {
+			return err
+		}
+		matcher = &list.InGroup{Group: group, Matcher: filters}
+	}
+	if len(columns) > 0 {
+		return list.ProjectExperimentColumns(proj, format, columns, matcher, sortKey, prices, page)
+	}
+	return list.ProjectExperiments(proj, format, all, matcher, sortKey, prices, page)
 }
 
 func addListFormatFlags(cmd *cobra.Command) {
 	cmd.Flags().Bool("json", false, "Print output in JSON format")
 	cmd.Flags().Bool("all", false, "Output all params and metrics. Default: only params/metrics that differ")
 	cmd.Flags().BoolP("quiet", "q", false, "Only print experiment IDs")
+	cmd.Flags().String("format", "", "Output format: 'table', 'json', 'quiet', 'csv', 'md' (Markdown), or 'html'. Overrides --json and --quiet")
 }
 
 // FIXME(bfirsh): use an opts struct and the "Var" version of flag functions to get rid of this
 func parseListFormatFlags(cmd *cobra.Command) (format list.Format, all bool, err error) {
+	formatString, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return 0, false, err
+	}
+	all, err = cmd.Flags().GetBool("all")
+	if err != nil {
+		return 0, false, err
+	}
+	if formatString != "" {
+		format, err = list.ParseFormat(formatString)
+		if err != nil {
+			return 0, false, err
+		}
+		if format == list.FormatQuiet && all {
+			return 0, false, fmt.Errorf("Cannot use --format quiet in combination with --all")
+		}
+		return format, all, nil
+	}
+
 	json, err := cmd.Flags().GetBool("json")
 	if err != nil {
 		return 0, false, err
@@ -89,10 +195,6 @@ func parseListFormatFlags(cmd *cobra.Command) (format list.Format, all bool, err
 		return 0, false, fmt.Errorf("Cannot use the --quiet flag in combination with --json")
 	}
 
-	all, err = cmd.Flags().GetBool("all")
-	if err != nil {
-		return 0, false, err
-	}
 	if quiet && all {
 		return 0, false, fmt.Errorf("Cannot use the --quiet flag in combination with --all")
 	}
@@ -134,3 +236,76 @@ func parseListSortFlag(cmd *cobra.Command) (*param.Sorter, error) {
 	}
 	return param.NewSorter(sortString), nil
 }
+
+func addListPageFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("limit", 0, "Only list this many experiments, after sorting. Default: all of them")
+	cmd.Flags().Int("offset", 0, "Skip this many experiments, after sorting")
+}
+
+func parseListPageFlags(cmd *cobra.Command) (list.Page, error) {
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return list.Page{}, err
+	}
+	offset, err := cmd.Flags().GetInt("offset")
+	if err != nil {
+		return list.Page{}, err
+	}
+	if limit < 0 || offset < 0 {
+		return list.Page{}, fmt.Errorf("--limit and --offset must not be negative")
+	}
+	return list.Page{Offset: offset, Limit: limit}, nil
+}
+
+func addListTimeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("since", "", "Only list experiments created since this time, as a date or how long ago, e.g. 2020-10-07, 3h, or 2d")
+	cmd.Flags().String("until", "", "Only list experiments created until this time, as a date or how long ago, e.g. 2020-10-07, 3h, or 2d")
+}
+
+// parseListTimeFlags adds filters on the creation time for --since and --until
+func parseListTimeFlags(cmd *cobra.Command, filters *param.Filters, now time.Time) error {
+	for _, flag := range []struct {
+		name     string
+		operator param.Operator
+	}{
+		{"since", param.OperatorGreaterOrEqual},
+		{"until", param.OperatorLessOrEqual},
+	} {
+		s, err := cmd.Flags().GetString(flag.name)
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			continue
+		}
+		t, err := parseTimeOrAgo(s, now)
+		if err != nil {
+			return fmt.Errorf("Invalid value for --%s: %s", flag.name, err)
+		}
+		filters.Append("created", flag.operator, param.Float(float64(t.Unix())))
+	}
+	return nil
+}
+
+// parseTimeOrAgo parses either a duration before now, like "3h", "2d", or
+// "1w", or a date and time, which is in the local time zone unless it says
+// otherwise
+func parseTimeOrAgo(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64); err == nil && strings.HasSuffix(s, suffix) {
+			return now.Add(-time.Duration(n * float64(unit))), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := dateparse.ParseIn(s, timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor a duration like 3h or 2d", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,198 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/table"
+)
+
+// ColumnFields are the columns that aren't params or metrics
+var ColumnFields = []string{"id", "created", "status", "user", "host", "command", "step", "num_checkpoints", "best_checkpoint", "latest_checkpoint", "cost"}
+
+// ValidateColumns returns an error if any of columns aren't one of
+// ColumnFields, or a param or metric named like they are in queries, e.g.
+// "params.lr", "metrics.best.val_acc", or "metrics.val_acc"
+func ValidateColumns(columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("There must be at least one column")
+	}
+	for _, column := range columns {
+		if isColumnField(column) {
+			continue
+		}
+		valid := false
+		for _, prefix := range []string{"params.", "metrics.latest.", "metrics.best.", "metrics."} {
+			if strings.HasPrefix(column, prefix) && len(column) > len(prefix) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("Unknown column: %q. Columns must be one of %s, or a param or metric like params.<name>, metrics.<name>, metrics.best.<name>, or metrics.latest.<name>", column, strings.Join(ColumnFields, ", "))
+		}
+	}
+	return nil
+}
+
+func isColumnField(name string) bool {
+	for _, field := range ColumnFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectExperimentColumns lists the page of experiments in proj like
+// ProjectExperiments, but only with columns, in that order. Costs are only
+// shown if prices isn't nil.
+func ProjectExperimentColumns(proj *project.Project, format Format, columns []string, filters param.Matcher, sorter *param.Sorter, prices *config.CostConfig, page Page) error {
+	if err := ValidateColumns(columns); err != nil {
+		return err
+	}
+	if format == FormatQuiet {
+		return fmt.Errorf("Cannot choose columns when only printing experiment IDs")
+	}
+	listExperiments, err := sortedListExperiments(proj, filters, sorter, prices, page)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatJSON:
+		return outputColumnsJSON(listExperiments, columns)
+	case FormatTable:
+		return outputColumnsTable(listExperiments, columns, proj.Config())
+	case FormatCSV:
+		return outputRenderedColumns(listExperiments, columns, table.FormatCSV)
+	case FormatMarkdown:
+		return outputRenderedColumns(listExperiments, columns, table.FormatMarkdown)
+	case FormatHTML:
+		return outputRenderedColumns(listExperiments, columns, table.FormatHTML)
+	}
+	panic(fmt.Sprintf("Unknown format: %d", format))
+}
+
+// ColumnValue returns the value of a column for exp, or None if it doesn't
+// have one
+func (exp *ListExperiment) ColumnValue(column string) param.Value {
+	switch column {
+	case "id":
+		return param.String(exp.ID)
+	case "created":
+		return param.String(exp.Created.UTC().Format(time.RFC3339))
+	case "num_checkpoints":
+		return param.Int(int64(exp.NumCheckpoints))
+	case "best_checkpoint":
+		if exp.BestCheckpoint != nil {
+			return param.String(exp.BestCheckpoint.ID)
+		}
+		return param.None()
+	case "latest_checkpoint":
+		if exp.LatestCheckpoint != nil {
+			return param.String(exp.LatestCheckpoint.ID)
+		}
+		return param.None()
+	case "step":
+		if exp.LatestCheckpoint == nil {
+			return param.None()
+		}
+	case "cost":
+		if exp.Cost == nil {
+			return param.None()
+		}
+	}
+	return exp.GetValue(column)
+}
+
+// shortColumnValue returns the value of a column for exp, shortened to fit in
+// a table in the terminal, with the units of metrics in conf
+func (exp *ListExperiment) shortColumnValue(column string, conf *config.Config) string {
+	v := exp.ColumnValue(column)
+	if v.IsNone() {
+		return ""
+	}
+	switch column {
+	case "id", "best_checkpoint", "latest_checkpoint":
+		return v.StringVal()[:7]
+	case "created":
+		return console.FormatTime(exp.Created)
+	case "command":
+		return v.StringVal()
+	case "cost":
+		return fmt.Sprintf("%.2f", v.FloatVal())
+	}
+	short := v.ShortString(valueMaxLength, valueTruncate)
+	if name, ok := metricColumnName(column); ok {
+		return conf.MetricConfig(name).FormatValue(v, short)
+	}
+	return short
+}
+
+// metricColumnName returns the name of the metric in a column like
+// "metrics.best.<name>", and false if it isn't a metric column
+func metricColumnName(column string) (string, bool) {
+	for _, prefix := range []string{"metrics.latest.", "metrics.best.", "metrics."} {
+		if strings.HasPrefix(column, prefix) {
+			return strings.TrimPrefix(column, prefix), true
+		}
+	}
+	return "", false
+}
+
+func outputColumnsJSON(experiments []*ListExperiment, columns []string) error {
+	rows := []map[string]param.Value{}
+	for _, exp := range experiments {
+		row := map[string]param.Value{}
+		for _, column := range columns {
+			row[column] = exp.ColumnValue(column)
+		}
+		rows = append(rows, row)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+func outputColumnsTable(experiments []*ListExperiment, columns []string, conf *config.Config) error {
+	if len(experiments) == 0 {
+		console.Info("No experiments found")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, exp := range experiments {
+		cells := []string{}
+		for _, column := range columns {
+			cells = append(cells, exp.shortColumnValue(column, conf))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func outputRenderedColumns(experiments []*ListExperiment, columns []string, format table.Format) error {
+	t := table.New(columns...)
+	for _, exp := range experiments {
+		row := []string{}
+		for _, column := range columns {
+			v := exp.ColumnValue(column)
+			if v.IsNone() {
+				row = append(row, "")
+			} else {
+				row = append(row, v.Summary(valueTruncate))
+			}
+		}
+		t.AddRow(row...)
+	}
+	return t.Write(os.Stdout, format)
+}
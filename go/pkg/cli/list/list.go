@@ -17,6 +17,7 @@ import (
 	"github.com/replicate/keepsake/go/pkg/project"
 	"github.com/replicate/keepsake/go/pkg/repository"
 	"github.com/replicate/keepsake/go/pkg/slices"
+	"github.com/replicate/keepsake/go/pkg/table"
 )
 
 type Format int
@@ -25,8 +26,110 @@ const (
 	FormatJSON = iota
 	FormatTable
 	FormatQuiet
+	FormatCSV
+	FormatMarkdown
+	FormatHTML
 )
 
+// ParseFormat returns the format named s, e.g. "json" or "csv"
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "table":
+		return FormatTable, nil
+	case "json":
+		return FormatJSON, nil
+	case "quiet":
+		return FormatQuiet, nil
+	case string(table.FormatCSV):
+		return FormatCSV, nil
+	case string(table.FormatMarkdown):
+		return FormatMarkdown, nil
+	case string(table.FormatHTML):
+		return FormatHTML, nil
+	}
+	return 0, fmt.Errorf("Unknown format: %q. It must be 'table', 'json', 'quiet', 'csv', 'md', or 'html'.", s)
+}
+
+// Page selects which of the sorted experiments are listed
+type Page struct {
+	// Offset is the number of experiments to skip
+	Offset int
+	// Limit is the maximum number of experiments to list, or 0 for all of them
+	Limit int
+}
+
+func (p Page) apply(experiments []*ListExperiment) []*ListExperiment {
+	if p.Offset >= len(experiments) {
+		return []*ListExperiment{}
+	}
+	experiments = experiments[p.Offset:]
+	if p.Limit > 0 && p.Limit < len(experiments) {
+		experiments = experiments[:p.Limit]
+	}
+	return experiments
+}
+
+// InGroup selects the experiments in a group that Matcher also selects
+type InGroup struct {
+	Group   *project.Group
+	Matcher param.Matcher
+}
+
+func (m *InGroup) Matches(obj param.ValueGetter) (bool, error) {
+	exp, ok := obj.(*ListExperiment)
+	if !ok || !m.Group.Contains(exp.ID) {
+		return false, nil
+	}
+	return m.Matcher.Matches(obj)
+}
+
+// TextSearch selects the experiments that contain every word of a free text
+// search, and that Matcher also selects. Words are matched case-insensitively
+// against the experiment's ID, command, user, host, params, template, tags,
+// and the names of the groups it is in.
+type TextSearch struct {
+	Words   []string
+	Groups  []*project.Group
+	Matcher param.Matcher
+}
+
+// NewTextSearch returns a TextSearch for the words in text
+func NewTextSearch(text string, groups []*project.Group, matcher param.Matcher) *TextSearch {
+	return &TextSearch{
+		Words:   strings.Fields(strings.ToLower(text)),
+		Groups:  groups,
+		Matcher: matcher,
+	}
+}
+
+func (m *TextSearch) Matches(obj param.ValueGetter) (bool, error) {
+	exp, ok := obj.(*ListExperiment)
+	if !ok {
+		return false, nil
+	}
+	text := strings.ToLower(strings.Join(m.searchableText(exp), "\n"))
+	for _, word := range m.Words {
+		if !strings.Contains(text, word) {
+			return false, nil
+		}
+	}
+	return m.Matcher.Matches(obj)
+}
+
+func (m *TextSearch) searchableText(exp *ListExperiment) []string {
+	text := []string{exp.ID, exp.Command, exp.User, exp.Host, exp.Template}
+	for key, val := range exp.Params {
+		text = append(text, key+"="+val.String())
+	}
+	text = append(text, exp.Tags...)
+	for _, group := range m.Groups {
+		if group.Contains(exp.ID) {
+			text = append(text, group.Name)
+		}
+	}
+	return text
+}
+
 const valueMaxLength = 20
 const valueTruncate = 5
 
@@ -41,13 +144,65 @@ type ListExperiment struct {
 	User             string              `json:"user"`
 	Host             string              `json:"host"`
 	Running          bool                `json:"running"`
+	Preempted        bool                `json:"preempted"`
+	State            string              `json:"state"`
+	Cost             *project.Cost       `json:"cost,omitempty"`
+	Template         string              `json:"template,omitempty"`
+	Tags             []string            `json:"tags,omitempty"`
+
+	// IDs of checkpoints whose uploads were interrupted
+	IncompleteCheckpoints []string `json:"incomplete_checkpoints,omitempty"`
 
 	// exclude config from json output
 	Config *config.Config `json:"-"`
 }
 
+// Status returns the experiment's state, e.g. "running", "crashed", or
+// "completed"
+func (exp *ListExperiment) Status() string {
+	if exp.State != "" {
+		return exp.State
+	}
+	if exp.Running {
+		return "running"
+	}
+	if exp.Preempted {
+		return "preempted"
+	}
+	return "stopped"
+}
+
+func (exp *ListExperiment) isIncomplete(chk *project.Checkpoint) bool {
+	for _, id := range exp.IncompleteCheckpoints {
+		if id == chk.ID {
+			return true
+		}
+	}
+	return false
+}
+
 // We should add some validation and better error messages, see https://github.com/replicate/keepsake/issues/340
 func (exp *ListExperiment) GetValue(name string) param.Value {
+	// Qualified names, as used in queries
+	switch {
+	case strings.HasPrefix(name, "params."):
+		if val, ok := exp.Params[strings.TrimPrefix(name, "params.")]; ok {
+			return val
+		}
+		return param.None()
+	case strings.HasPrefix(name, "metrics.latest."):
+		return checkpointMetric(exp.LatestCheckpoint, strings.TrimPrefix(name, "metrics.latest."))
+	case strings.HasPrefix(name, "metrics.best."):
+		return checkpointMetric(exp.BestCheckpoint, strings.TrimPrefix(name, "metrics.best."))
+	case strings.HasPrefix(name, "metrics."):
+		// the best checkpoint if there is a primary metric, otherwise the latest
+		chk := exp.BestCheckpoint
+		if chk == nil {
+			chk = exp.LatestCheckpoint
+		}
+		return checkpointMetric(chk, strings.TrimPrefix(name, "metrics."))
+	}
+
 	if name == "started" || name == "created" {
 		// floating point timestamp used in sorting
 		return param.Float(float64(exp.Created.Unix()))
@@ -67,11 +222,14 @@ func (exp *ListExperiment) GetValue(name string) param.Value {
 	if name == "command" {
 		return param.String(exp.Command)
 	}
+	if name == "cost" && exp.Cost != nil {
+		return param.Float(exp.Cost.Total())
+	}
 	if name == "status" {
-		if exp.Running {
-			return param.String("running")
-		}
-		return param.String("stopped")
+		return param.String(exp.Status())
+	}
+	if name == "running" {
+		return param.Bool(exp.Running)
 	}
 	if exp.BestCheckpoint != nil {
 		if val, ok := exp.BestCheckpoint.Metrics[name]; ok {
@@ -84,27 +242,71 @@ func (exp *ListExperiment) GetValue(name string) param.Value {
 	return param.None()
 }
 
-func Experiments(repo repository.Repository, format Format, all bool, filters *param.Filters, sorter *param.Sorter) error {
-	proj := project.NewProject(repo, "")
-	listExperiments, err := createListExperiments(proj, filters)
+func checkpointMetric(chk *project.Checkpoint, name string) param.Value {
+	if chk != nil {
+		if val, ok := chk.Metrics[name]; ok {
+			return val
+		}
+	}
+	return param.None()
+}
+
+func Experiments(repo repository.Repository, format Format, all bool, filters param.Matcher, sorter *param.Sorter) error {
+	return ExperimentsWithCost(repo, format, all, filters, sorter, nil)
+}
+
+// ExperimentsWithCost lists experiments like Experiments, and also estimates
+// what each experiment cost with prices. Costs aren't displayed if prices is nil.
+func ExperimentsWithCost(repo repository.Repository, format Format, all bool, filters param.Matcher, sorter *param.Sorter, prices *config.CostConfig) error {
+	return ProjectExperiments(project.NewProject(repo, ""), format, all, filters, sorter, prices, Page{})
+}
+
+// ProjectExperiments lists the page of experiments in proj like
+// ExperimentsWithCost, applying the project's settings, like sensitive_params
+func ProjectExperiments(proj *project.Project, format Format, all bool, filters param.Matcher, sorter *param.Sorter, prices *config.CostConfig, page Page) error {
+	listExperiments, err := sortedListExperiments(proj, filters, sorter, prices, page)
 	if err != nil {
 		return err
 	}
-	sort.Slice(listExperiments, func(i, j int) bool {
-		return sorter.LessThan(listExperiments[i], listExperiments[j])
-	})
 
 	switch format {
 	case FormatJSON:
 		return outputJSON(listExperiments)
 	case FormatTable:
-		return outputTable(listExperiments, all)
+		return outputTable(listExperiments, all, proj.Config())
 	case FormatQuiet:
 		return outputQuiet(listExperiments)
+	case FormatCSV:
+		return outputRenderedTable(listExperiments, all, table.FormatCSV)
+	case FormatMarkdown:
+		return outputRenderedTable(listExperiments, all, table.FormatMarkdown)
+	case FormatHTML:
+		return outputRenderedTable(listExperiments, all, table.FormatHTML)
 	}
 	panic(fmt.Sprintf("Unknown format: %d", format))
 }
 
+// sortedListExperiments returns the page of experiments in proj that match
+// filters, sorted by sorter, with their costs if prices isn't nil
+func sortedListExperiments(proj *project.Project, filters param.Matcher, sorter *param.Sorter, prices *config.CostConfig, page Page) ([]*ListExperiment, error) {
+	var costs map[string]*project.Cost
+	if prices != nil {
+		var err error
+		costs, err = proj.ExperimentCosts(prices)
+		if err != nil {
+			return nil, err
+		}
+	}
+	listExperiments, err := createListExperiments(proj, filters, costs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(listExperiments, func(i, j int) bool {
+		return sorter.LessThan(listExperiments[i], listExperiments[j])
+	})
+	return page.apply(listExperiments), nil
+}
+
 func outputQuiet(experiments []*ListExperiment) error {
 	for _, exp := range experiments {
 		fmt.Println(exp.ID)
@@ -118,7 +320,7 @@ func outputJSON(experiments []*ListExperiment) error {
 	return enc.Encode(experiments)
 }
 
-func outputTable(experiments []*ListExperiment, all bool) error {
+func outputTable(experiments []*ListExperiment, all bool, conf *config.Config) error {
 	if len(experiments) == 0 {
 		console.Info("No experiments found")
 		return nil
@@ -136,6 +338,8 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 		}
 	}
 
+	displayCost := experiments[0].Cost != nil
+
 	// Hide various fields if they are all the same
 	displayHost := false
 	displayUser := false
@@ -158,6 +362,9 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 	if displayUser {
 		headings = append(headings, "USER")
 	}
+	if displayCost {
+		headings = append(headings, "COST")
+	}
 	headings = append(headings, "PARAMS")
 	if hasBestCheckpoint {
 		headings = append(headings, "BEST CHECKPOINT")
@@ -174,11 +381,7 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 
 	for _, exp := range experiments {
 		columns := []string{exp.ID[:7], console.FormatTime(exp.Created)}
-		if exp.Running {
-			columns = append(columns, "running")
-		} else {
-			columns = append(columns, "stopped")
-		}
+		columns = append(columns, exp.Status())
 
 		if displayHost {
 			columns = append(columns, exp.Host)
@@ -188,6 +391,10 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 			columns = append(columns, exp.User)
 		}
 
+		if displayCost {
+			columns = append(columns, fmt.Sprintf("%.2f", exp.Cost.Total()))
+		}
+
 		params := []string{}
 		for _, key := range paramsToDisplay {
 			if val, ok := exp.Params[key]; ok {
@@ -199,14 +406,14 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 		if hasBestCheckpoint {
 			bestCheckpoint := ""
 			if exp.BestCheckpoint != nil {
-				bestCheckpoint = displayCheckpoint(exp.BestCheckpoint, metricsToDisplay)
+				bestCheckpoint = displayCheckpoint(exp, exp.BestCheckpoint, metricsToDisplay, conf)
 			}
 			columns = append(columns, bestCheckpoint)
 		}
 
 		latestCheckpoint := ""
 		if exp.LatestCheckpoint != nil {
-			latestCheckpoint = displayCheckpoint(exp.LatestCheckpoint, metricsToDisplay)
+			latestCheckpoint = displayCheckpoint(exp, exp.LatestCheckpoint, metricsToDisplay, conf)
 		}
 		columns = append(columns, latestCheckpoint)
 
@@ -221,12 +428,74 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 	return nil
 }
 
-func displayCheckpoint(checkpoint *project.Checkpoint, metricsToDisplay []string) string {
-	out := []string{fmt.Sprintf("%s (step %s)", checkpoint.ShortID(), strconv.FormatInt(checkpoint.Step, 10))}
+// outputRenderedTable outputs experiments as a table in format, with a column
+// for each param and metric, named like they are in queries (e.g. "params.lr")
+func outputRenderedTable(experiments []*ListExperiment, all bool, format table.Format) error {
+	paramsToDisplay := getParamsToDisplay(experiments, all)
+	metricsToDisplay := getMetricsToDisplay(experiments, all)
+	displayCost := len(experiments) > 0 && experiments[0].Cost != nil
+
+	headings := []string{"experiment", "created", "status", "host", "user"}
+	if displayCost {
+		headings = append(headings, "cost")
+	}
+	for _, key := range paramsToDisplay {
+		headings = append(headings, "params."+key)
+	}
+	for _, which := range []string{"best", "latest"} {
+		headings = append(headings, which+"_checkpoint", which+"_step")
+		for _, key := range metricsToDisplay {
+			headings = append(headings, "metrics."+which+"."+key)
+		}
+	}
+	t := table.New(headings...)
+
+	for _, exp := range experiments {
+		row := []string{exp.ID, exp.Created.UTC().Format(time.RFC3339), exp.Status(), exp.Host, exp.User}
+		if displayCost {
+			row = append(row, fmt.Sprintf("%.2f", exp.Cost.Total()))
+		}
+		for _, key := range paramsToDisplay {
+			row = append(row, valueCell(exp.Params, key))
+		}
+		for _, chk := range []*project.Checkpoint{exp.BestCheckpoint, exp.LatestCheckpoint} {
+			if chk == nil {
+				row = append(row, "", "")
+				for range metricsToDisplay {
+					row = append(row, "")
+				}
+				continue
+			}
+			row = append(row, chk.ID, strconv.FormatInt(chk.Step, 10))
+			for _, key := range metricsToDisplay {
+				row = append(row, valueCell(chk.Metrics, key))
+			}
+		}
+		t.AddRow(row...)
+	}
+	return t.Write(os.Stdout, format)
+}
+
+// valueCell returns the full value of key for a table cell, or an empty string if it isn't set.
+// Structured metrics, like histograms, are summarized, because their JSON doesn't fit in a cell.
+func valueCell(values param.ValueMap, key string) string {
+	v, ok := values[key]
+	if !ok || v.IsNone() {
+		return ""
+	}
+	return v.Summary(valueTruncate)
+}
+
+func displayCheckpoint(exp *ListExperiment, checkpoint *project.Checkpoint, metricsToDisplay []string, conf *config.Config) string {
+	step := "step " + strconv.FormatInt(checkpoint.Step, 10)
+	if exp.isIncomplete(checkpoint) {
+		step += ", incomplete"
+	}
+	out := []string{fmt.Sprintf("%s (%s)", checkpoint.ShortID(), step)}
 
 	for _, key := range metricsToDisplay {
 		if v, ok := checkpoint.Metrics[key]; ok {
-			out = append(out, key+"="+v.ShortString(valueMaxLength, valueTruncate))
+			out = append(out, key+"="+conf.MetricConfig(key).FormatValue(v, v.ShortString(valueMaxLength, valueTruncate)))
 		}
 	}
 	return strings.Join(out, "\n")
@@ -339,7 +608,30 @@ func getMetricsToDisplay(experiments []*ListExperiment, all bool) []string {
 	return slices.StringKeys(metricsToDisplay)
 }
 
-func createListExperiments(proj *project.Project, filters *param.Filters) ([]*ListExperiment, error) {
+// MatchingExperiments returns the experiments in proj that match filters,
+// oldest first
+func MatchingExperiments(proj *project.Project, filters param.Matcher) ([]*ListExperiment, error) {
+	return createListExperiments(proj, filters, nil)
+}
+
+// Select returns the experiments in proj that filters selects, oldest first
+func Select(proj *project.Project, filters param.Matcher) ([]*project.Experiment, error) {
+	listExperiments, err := createListExperiments(proj, filters, nil)
+	if err != nil {
+		return nil, err
+	}
+	experiments := []*project.Experiment{}
+	for _, listExperiment := range listExperiments {
+		exp, err := proj.ExperimentByID(listExperiment.ID)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, exp)
+	}
+	return experiments, nil
+}
+
+func createListExperiments(proj *project.Project, filters param.Matcher, costs map[string]*project.Cost) ([]*ListExperiment, error) {
 	experiments, err := proj.Experiments()
 	if err != nil {
 		return nil, err
@@ -350,7 +642,7 @@ func createListExperiments(proj *project.Project, filters *param.Filters) ([]*Li
 			ID:      exp.ID,
 			Params:  exp.Params,
 			Command: exp.Command,
-			Created: exp.Created,
+			Created: exp.Created.UTC(),
 			Host:    exp.Host,
 			User:    exp.User,
 			Config:  exp.Config,
@@ -363,6 +655,32 @@ func createListExperiments(proj *project.Project, filters *param.Filters) ([]*Li
 		listExperiment.BestCheckpoint = exp.BestCheckpoint()
 		listExperiment.NumCheckpoints = len(exp.Checkpoints)
 		listExperiment.Running = running
+		preemption, err := proj.ExperimentPreemption(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		listExperiment.Preempted = preemption != nil
+		state, err := proj.ExperimentState(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		listExperiment.State = string(state)
+		incomplete, err := proj.IncompleteCheckpoints(exp)
+		if err != nil {
+			return nil, err
+		}
+		for _, chk := range incomplete {
+			listExperiment.IncompleteCheckpoints = append(listExperiment.IncompleteCheckpoints, chk.ID)
+		}
+		listExperiment.Cost = costs[exp.ID]
+		experimentTags, err := proj.ExperimentTags(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		if experimentTags != nil {
+			listExperiment.Template = experimentTags.Template
+			listExperiment.Tags = experimentTags.Tags
+		}
 
 		match, err := filters.Matches(listExperiment)
 		if err != nil {
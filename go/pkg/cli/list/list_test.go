@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -336,3 +337,168 @@ func TestListJSON(t *testing.T) {
 	require.Equal(t, param.Float(0.987), experiments[1].LatestCheckpoint.Metrics["accuracy"])
 	require.Equal(t, true, experiments[1].Running)
 }
+
+func TestListQuery(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	conf := &config.Config{}
+	repo := createTestData(t, workingDir, conf)
+	query, err := param.ParseQuery(`user = "andreas" and (params.param-1 = 100 or metrics.latest.metric-3 > 0.1)`)
+	require.NoError(t, err)
+	sorter := param.NewSorter("started")
+
+	actual := capturer.CaptureStdout(func() {
+		err = Experiments(repo, FormatQuiet, false, query, sorter)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2eeeeeeeee\n1eeeeeeeee\n", actual)
+}
+
+func TestListCSV(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	conf := &config.Config{}
+	repo := createTestData(t, workingDir, conf)
+	filters, err := param.MakeFilters([]string{"user = andreas"})
+	require.NoError(t, err)
+	sorter := param.NewSorter("started")
+
+	actual := capturer.CaptureStdout(func() {
+		err = Experiments(repo, FormatCSV, false, filters, sorter)
+	})
+	require.NoError(t, err)
+	lines := strings.Split(actual, "\n")
+	require.Equal(t, "experiment,created,status,host,user,params.param-1,best_checkpoint,best_step,metrics.best.metric-1,latest_checkpoint,latest_step,metrics.latest.metric-1", lines[0])
+	require.Regexp(t, "^2eeeeeeeee,[^,]+,stopped,10.1.1.2,andreas,200,,,,4ccccccccc,5,$", lines[1])
+	require.Regexp(t, "^1eeeeeeeee,[^,]+,running,10.1.1.1,andreas,100,2ccccccccc,20,0.01,3ccccccccc,20,0.02$", lines[2])
+}
+
+func TestPage(t *testing.T) {
+	experiments := []*ListExperiment{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	ids := func(page Page) []string {
+		ret := []string{}
+		for _, exp := range page.apply(experiments) {
+			ret = append(ret, exp.ID)
+		}
+		return ret
+	}
+	require.Equal(t, []string{"1", "2", "3"}, ids(Page{}))
+	require.Equal(t, []string{"1", "2"}, ids(Page{Limit: 2}))
+	require.Equal(t, []string{"2", "3"}, ids(Page{Offset: 1}))
+	require.Equal(t, []string{"2"}, ids(Page{Offset: 1, Limit: 1}))
+	require.Equal(t, []string{"3"}, ids(Page{Offset: 2, Limit: 5}))
+	require.Equal(t, []string{}, ids(Page{Offset: 3}))
+}
+
+func TestListColumns(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo := createTestData(t, workingDir, &config.Config{})
+	proj := project.NewProject(repo, workingDir)
+	filters, err := param.MakeFilters([]string{"user = andreas"})
+	require.NoError(t, err)
+	sorter := param.NewSorter("started")
+	columns := []string{"id", "status", "params.param-1", "metrics.best.metric-1", "latest_checkpoint"}
+
+	actual := capturer.CaptureStdout(func() {
+		err = ProjectExperimentColumns(proj, FormatTable, columns, filters, sorter, nil, Page{})
+	})
+	require.NoError(t, err)
+	expected := `
+ID       STATUS   PARAMS.PARAM-1  METRICS.BEST.METRIC-1  LATEST_CHECKPOINT
+2eeeeee  stopped  200                                    4cccccc
+1eeeeee  running  100             0.01                   3cccccc
+`
+	require.Equal(t, expected[1:], actual)
+
+	actual = capturer.CaptureStdout(func() {
+		err = ProjectExperimentColumns(proj, FormatCSV, columns, filters, sorter, nil, Page{})
+	})
+	require.NoError(t, err)
+	require.Equal(t, "id,status,params.param-1,metrics.best.metric-1,latest_checkpoint\n2eeeeeeeee,stopped,200,,4ccccccccc\n1eeeeeeeee,running,100,0.01,3ccccccccc\n", actual)
+
+	actual = capturer.CaptureStdout(func() {
+		err = ProjectExperimentColumns(proj, FormatJSON, []string{"id", "params.param-1", "metrics.best.metric-1"}, filters, sorter, nil, Page{})
+	})
+	require.NoError(t, err)
+	rows := []map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(actual), &rows))
+	require.Equal(t, []map[string]interface{}{
+		{"id": "2eeeeeeeee", "params.param-1": 200.0, "metrics.best.metric-1": nil},
+		{"id": "1eeeeeeeee", "params.param-1": 100.0, "metrics.best.metric-1": 0.01},
+	}, rows)
+
+	require.Error(t, ValidateColumns([]string{"id", "param-1"}))
+	require.Error(t, ValidateColumns([]string{"params."}))
+	require.NoError(t, ValidateColumns([]string{"created", "metrics.metric-1"}))
+}
+
+func TestListTextSearch(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo := createTestData(t, workingDir, &config.Config{})
+	require.NoError(t, project.CreateExperimentTags(repo, "3eeeeeeeee", "transformer", []string{"Warmup"}))
+	proj := project.NewProject(repo, workingDir)
+	_, err = proj.CreateGroup("baselines", []string{"2eeeeeeeee"})
+	require.NoError(t, err)
+	groups, err := proj.Groups()
+	require.NoError(t, err)
+	sorter := param.NewSorter("started")
+
+	search := func(text string, filters *param.Filters) string {
+		actual := capturer.CaptureStdout(func() {
+			err = ProjectExperiments(proj, FormatQuiet, false, NewTextSearch(text, groups, filters), sorter, nil, Page{})
+		})
+		require.NoError(t, err)
+		return actual
+	}
+	require.Equal(t, "1eeeeeeeee\n", search("--FOO bar", new(param.Filters)))
+	require.Equal(t, "3eeeeeeeee\n2eeeeeeeee\n", search("param-3=hi", new(param.Filters)))
+	require.Equal(t, "3eeeeeeeee\n", search("transformer warmup", new(param.Filters)))
+	require.Equal(t, "2eeeeeeeee\n", search("baselines", new(param.Filters)))
+	require.Equal(t, "", search("transformer baselines", new(param.Filters)))
+
+	filters, err := param.MakeFilters([]string{"user = andreas"})
+	require.NoError(t, err)
+	require.Equal(t, "2eeeeeeeee\n", search("hi", filters))
+}
+
+func TestListStructuredMetrics(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".keepsake"))
+	require.NoError(t, err)
+	exp := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: time.Now().UTC(),
+		Config:  &config.Config{},
+		Checkpoints: []*project.Checkpoint{{
+			ID:      "1ccccccccc",
+			Created: time.Now().UTC(),
+			Metrics: param.ValueMap{
+				"weights": param.Object(map[string]interface{}{"type": "histogram", "bins": []interface{}{0.0, 0.5, 1.0}, "counts": []interface{}{10.0, 20.0}}),
+			},
+			Step: 1,
+		}},
+	}
+	require.NoError(t, exp.Save(repo))
+
+	for _, format := range []Format{FormatTable, FormatCSV} {
+		actual := capturer.CaptureStdout(func() {
+			err = Experiments(repo, format, true, new(param.Filters), &param.Sorter{Key: "started"})
+		})
+		require.NoError(t, err)
+		require.Contains(t, actual, "histogram (2 bins", format)
+		require.NotContains(t, actual, `"type"`, format)
+	}
+}
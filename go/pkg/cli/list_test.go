@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeOrAgo(t *testing.T) {
+	oldTimezone := timezone
+	timezone, _ = time.LoadLocation("Asia/Ulaanbaatar")
+	defer func() { timezone = oldTimezone }()
+	now, err := time.Parse(time.RFC3339, "2020-10-07T12:00:00Z")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		input    string
+		expected string
+	}{
+		{"3h", "2020-10-07T09:00:00Z"},
+		{"90m", "2020-10-07T10:30:00Z"},
+		{"2d", "2020-10-05T12:00:00Z"},
+		{"1.5d", "2020-10-06T00:00:00Z"},
+		{"1w", "2020-09-30T12:00:00Z"},
+		{"2020-09-01", "2020-08-31T16:00:00Z"},
+		{"2020-09-01T10:00:00Z", "2020-09-01T10:00:00Z"},
+	} {
+		actual, err := parseTimeOrAgo(tt.input, now)
+		require.NoError(t, err, tt.input)
+		require.Equal(t, tt.expected, actual.UTC().Format(time.RFC3339), tt.input)
+	}
+
+	_, err = parseTimeOrAgo("last tuesday", now)
+	require.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+type logsOpts struct {
+	follow        bool
+	interval      time.Duration
+	since         time.Duration
+	repositoryURL string
+}
+
+func newLogsCommand() *cobra.Command {
+	var opts logsOpts
+
+	cmd := &cobra.Command{
+		Use:   "logs <experiment ID>",
+		Short: "Print the checkpoints recorded by an experiment",
+		Long: `Print the checkpoints recorded by an experiment, one line per checkpoint.
+
+With --follow, the repository is polled for new checkpoints until the experiment stops.
+This lets you follow an experiment that is running on another machine.
+
+To see the output of a command run by the queue, use 'keepsake queue logs'.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return logs(opts, args, os.Stdout)
+		}),
+		Args: cobra.ExactArgs(1),
+		Example: `Follow an experiment running on another machine:
+$ keepsake logs -f a1b2c3d4`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "f", false, "Keep polling the repository for new checkpoints until the experiment stops")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Second, "How often to poll the repository when following")
+	cmd.Flags().DurationVar(&opts.since, "since", 0, "Only print checkpoints created in this long ago, e.g. 10m")
+
+	return cmd
+}
+
+func logs(opts logsOpts, args []string, out io.Writer) error {
+	prefix := args[0]
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	exp, err := proj.ExperimentFromPrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	if opts.since > 0 {
+		cutoff := time.Now().Add(-opts.since)
+		for _, chk := range exp.Checkpoints {
+			if chk.Created.Before(cutoff) {
+				seen[chk.ID] = true
+			}
+		}
+	}
+	for {
+		writeNewCheckpointLogs(out, exp, seen)
+
+		if !opts.follow {
+			return nil
+		}
+		running, err := proj.ExperimentIsRunning(exp.ID)
+		if err != nil {
+			return err
+		}
+		if !running {
+			console.Info("Experiment %s has stopped", exp.ShortID())
+			return nil
+		}
+
+		time.Sleep(opts.interval)
+
+		proj, err = reloadProject(repo, projectDir)
+		if err != nil {
+			return err
+		}
+		exp, err = proj.ExperimentByID(exp.ID)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeNewCheckpointLogs writes a line for each checkpoint of exp that isn't in seen,
+// in the order they were created
+func writeNewCheckpointLogs(out io.Writer, exp *project.Experiment, seen map[string]bool) {
+	checkpoints := []*project.Checkpoint{}
+	for _, chk := range exp.Checkpoints {
+		if !seen[chk.ID] {
+			checkpoints = append(checkpoints, chk)
+		}
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Created.Before(checkpoints[j].Created)
+	})
+	for _, chk := range checkpoints {
+		seen[chk.ID] = true
+		fmt.Fprintln(out, formatCheckpointLogLine(chk))
+	}
+}
+
+func formatCheckpointLogLine(chk *project.Checkpoint) string {
+	parts := []string{
+		chk.Created.In(timezone).Format(time.RFC3339),
+		"checkpoint " + chk.ShortID(),
+		fmt.Sprintf("step=%d", chk.Step),
+	}
+	for _, m := range chk.SortedMetrics() {
+		parts = append(parts, m.Name+"="+m.Value.ShortString(20, 5))
+	}
+	return strings.Join(parts, " ")
+}
+
+// reloadProject fetches new data from the repository and returns a fresh project,
+// so polling commands see data written by other machines
+func reloadProject(repo repository.Repository, projectDir string) (*project.Project, error) {
+	if cachedRepo := repository.FindCachedRepository(repo); cachedRepo != nil {
+		if err := cachedRepo.SyncCache(); err != nil {
+			return nil, err
+		}
+	}
+	return newProject(repo, projectDir)
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+)
+
+func TestLogs(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	createShowTestData(t, workingDir, &config.Config{})
+
+	out := new(bytes.Buffer)
+	err = logs(logsOpts{repositoryURL: "file://" + path.Join(workingDir, ".keepsake")}, []string{"1eee"}, out)
+	require.NoError(t, err)
+
+	expected := `
+2006-01-02T22:59:05+08:00 checkpoint 1cccccc step=10 metric-1=0.1 metric-2=2
+2006-01-02T23:00:05+08:00 checkpoint 2cccccc step=20 metric-1=0.01 metric-2=2
+2006-01-02T23:01:05+08:00 checkpoint 3cccccc step=20 metric-1=0.02 metric-2=2
+`
+	require.Equal(t, expected[1:], out.String())
+
+	// Following a stopped experiment prints what's there and returns
+	out = new(bytes.Buffer)
+	err = logs(logsOpts{repositoryURL: "file://" + path.Join(workingDir, ".keepsake"), follow: true}, []string{"2eee"}, out)
+	require.NoError(t, err)
+	require.Equal(t, "2006-01-02T23:02:05+08:00 checkpoint 4cccccc step=5 metric-3=0.5\n", out.String())
+
+	// None of the checkpoints are recent
+	out = new(bytes.Buffer)
+	err = logs(logsOpts{repositoryURL: "file://" + path.Join(workingDir, ".keepsake"), since: time.Hour}, []string{"1eee"}, out)
+	require.NoError(t, err)
+	require.Equal(t, "", out.String())
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/shared"
+)
+
+// metricsSaveInterval is how often the checkpoints read from stdin are saved
+// to the experiment, so a program that prints metrics quickly doesn't
+// rewrite the experiment's metadata for every line
+var metricsSaveInterval = 5 * time.Second
+
+// maxMetricsLineSize is the longest line that is read from stdin
+const maxMetricsLineSize = 1024 * 1024
+
+type metricsOpts struct {
+	experiment    string
+	primaryMetric string
+	goal          string
+	quiet         bool
+}
+
+func newMetricsCommand() *cobra.Command {
+	var opts metricsOpts
+
+	cmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Record metrics printed by a running program",
+		Long: `Record metrics printed by a running program.
+
+Every line on stdin that is a JSON object is saved as a checkpoint in the
+experiment, with the object's keys as metrics. If the object has an integer
+"step", that is the checkpoint's step, otherwise the step counts up from the
+experiment's latest checkpoint.
+
+Each line is passed through to stdout, so the program's output can still be
+seen. The experiment is marked as running until stdin is closed.`,
+		Run:  handleErrors(func(cmd *cobra.Command, args []string) error { return ingestMetrics(cmd, opts, os.Stdin, os.Stdout) }),
+		Args: cobra.NoArgs,
+		Example: `Record the metrics a training script prints:
+python train.py | keepsake metrics --experiment a1b2c3d4
+
+where train.py prints lines like:
+{"step": 1, "loss": 0.52, "accuracy": 0.81}`,
+	}
+
+	addRepositoryURLFlag(cmd)
+	cmd.Flags().StringVarP(&opts.experiment, "experiment", "e", "", "ID of the experiment to record the metrics in")
+	cmd.Flags().StringVar(&opts.primaryMetric, "primary-metric", "", "The metric that decides which checkpoint is best")
+	cmd.Flags().StringVar(&opts.goal, "goal", string(project.GoalMaximize), "Whether the primary metric should be maximized or minimized")
+	cmd.Flags().BoolVarP(&opts.quiet, "quiet", "q", false, "Don't pass stdin through to stdout")
+	_ = cmd.MarkFlagRequired("experiment")
+
+	return cmd
+}
+
+func ingestMetrics(cmd *cobra.Command, opts metricsOpts, in io.Reader, out io.Writer) error {
+	primaryMetric, err := parsePrimaryMetric(opts.primaryMetric, opts.goal)
+	if err != nil {
+		return err
+	}
+	proj, err := getInternalProject(cmd)
+	if err != nil {
+		return err
+	}
+	exp, err := proj.ExperimentFromPrefix(opts.experiment)
+	if err != nil {
+		return err
+	}
+
+	if err := proj.RefreshHeartbeat(exp.ID); err != nil {
+		return err
+	}
+	heartbeat := shared.StartHeartbeat(proj, exp.ID)
+	defer heartbeat.Kill()
+
+	if opts.quiet {
+		out = nil
+	}
+	return recordMetrics(proj, exp, primaryMetric, in, out)
+}
+
+// recordMetrics saves every JSON object read from in as a checkpoint in exp,
+// copying everything it reads to out if it isn't nil
+func recordMetrics(proj *project.Project, exp *project.Experiment, primaryMetric *project.PrimaryMetric, in io.Reader, out io.Writer) error {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), maxMetricsLineSize)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		readErr <- scanner.Err()
+	}()
+
+	nextStep := int64(0)
+	if latest := exp.LatestCheckpoint(); latest != nil {
+		nextStep = latest.Step + 1
+	}
+	unsaved := 0
+	save := func() error {
+		if unsaved == 0 {
+			return nil
+		}
+		if _, err := proj.SaveExperiment(exp, true); err != nil {
+			return err
+		}
+		console.Debug("Saved %d checkpoints to experiment %s", unsaved, exp.ShortID())
+		unsaved = 0
+		return nil
+	}
+
+	ticker := time.NewTicker(metricsSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-readErr; err != nil {
+					return fmt.Errorf("Failed to read metrics from stdin: %w", err)
+				}
+				return save()
+			}
+			if out != nil {
+				fmt.Fprintln(out, line)
+			}
+			metrics, step, ok := parseMetricsLine(line, nextStep)
+			if !ok {
+				continue
+			}
+			chk, err := proj.CreateCheckpoint(project.CreateCheckpointArgs{
+				Step:          step,
+				Metrics:       metrics,
+				PrimaryMetric: primaryMetric,
+				ExperimentID:  exp.ID,
+			}, false, nil, true)
+			if err != nil {
+				return err
+			}
+			exp.Checkpoints = append(exp.Checkpoints, chk)
+			nextStep = step + 1
+			unsaved++
+		case <-ticker.C:
+			if err := save(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseMetricsLine returns the metrics in line, if it is a JSON object with
+// any, and its step, which is nextStep unless the object has an integer "step"
+func parseMetricsLine(line string, nextStep int64) (metrics param.ValueMap, step int64, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil, 0, false
+	}
+	metrics = param.ValueMap{}
+	if err := json.Unmarshal([]byte(line), &metrics); err != nil {
+		return nil, 0, false
+	}
+	step = nextStep
+	if value, ok := metrics["step"]; ok && value.Type() == param.TypeInt {
+		step = value.IntVal()
+		delete(metrics, "step")
+	}
+	if len(metrics) == 0 {
+		return nil, 0, false
+	}
+	return metrics, step, true
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestParseMetricsLine(t *testing.T) {
+	metrics, step, ok := parseMetricsLine(`{"step": 10, "loss": 0.5}`, 3)
+	require.True(t, ok)
+	require.Equal(t, int64(10), step)
+	require.Equal(t, param.ValueMap{"loss": param.Float(0.5)}, metrics)
+
+	metrics, step, ok = parseMetricsLine(`  {"loss": 0.4, "step": "last"}`, 3)
+	require.True(t, ok)
+	require.Equal(t, int64(3), step)
+	require.Equal(t, param.ValueMap{"loss": param.Float(0.4), "step": param.String("last")}, metrics)
+
+	for _, line := range []string{"Epoch 1/10", "", "[1, 2]", "{not json", "{}", `{"step": 4}`} {
+		_, _, ok = parseMetricsLine(line, 0)
+		require.False(t, ok, line)
+	}
+}
+
+func TestRecordMetrics(t *testing.T) {
+	projectDir, err := files.TempDir("test-metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := project.NewProjectWithConfig(repo, projectDir, &config.Config{})
+	exp, err := proj.CreateExperiment(project.CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+
+	in := strings.Join([]string{
+		"Loading data...",
+		`{"loss": 0.5}`,
+		`{"loss": 0.4}`,
+		`{"step": 10, "loss": 0.3}`,
+		`{"loss": 0.2}`,
+		"Done",
+	}, "\n")
+	out := new(bytes.Buffer)
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	require.NoError(t, recordMetrics(proj, exp, primaryMetric, strings.NewReader(in), out))
+	require.Equal(t, in+"\n", out.String())
+
+	loaded, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 4)
+	steps := []int64{}
+	for _, chk := range loaded.Checkpoints {
+		steps = append(steps, chk.Step)
+		require.Equal(t, primaryMetric, chk.PrimaryMetric)
+	}
+	require.Equal(t, []int64{0, 1, 10, 11}, steps)
+	require.Equal(t, param.Float(0.2), loaded.Checkpoints[3].Metrics["loss"])
+
+	// the steps carry on from the latest checkpoint
+	require.NoError(t, recordMetrics(proj, loaded, nil, strings.NewReader(`{"loss": 0.1}`), nil))
+	loaded, err = proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 5)
+	require.Equal(t, int64(12), loaded.Checkpoints[4].Step)
+}
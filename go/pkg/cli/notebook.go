@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/queue"
+	"github.com/replicate/keepsake/go/pkg/shared"
+)
+
+type notebookOpts struct {
+	path       string
+	paramsJSON string
+	jupyter    string
+	gpus       string
+}
+
+func newNotebookCommand() *cobra.Command {
+	var opts notebookOpts
+
+	cmd := &cobra.Command{
+		Use:   "notebook [-- <jupyter args>...]",
+		Short: "Start Jupyter, recording the session as an experiment",
+		Long: `Start Jupyter in the project directory, recording the session as an experiment.
+
+An experiment is created before Jupyter starts, with the files at --path as its
+code, and it is marked as running until Jupyter exits. When Jupyter exits, the
+files at --path, including any notebooks that were changed, are saved as a
+checkpoint, so exploratory work is recorded alongside the rest of the project's
+experiments.
+
+Jupyter runs on this machine, with the GPUs passed with --gpus, or all of them.
+Arguments after "--" are passed to Jupyter.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return notebook(cmd, opts, args)
+		}),
+		Example: `Start Jupyter Lab, saving the whole project when it exits:
+$ keepsake notebook
+
+Start Jupyter Notebook on the first GPU, saving only the notebooks directory:
+$ keepsake notebook --jupyter "jupyter notebook" --gpus 0 --path notebooks
+
+Pass arguments to Jupyter:
+$ keepsake notebook -- --port 8889 --no-browser`,
+	}
+
+	addRepositoryURLFlag(cmd)
+	cmd.Flags().StringVar(&opts.path, "path", ".", "Path to the files to save with the experiment and checkpoint, relative to the project directory")
+	cmd.Flags().StringVar(&opts.paramsJSON, "params-json", "", "The experiment's params, as a JSON object")
+	cmd.Flags().StringVar(&opts.jupyter, "jupyter", "jupyter lab", "The command that starts Jupyter")
+	cmd.Flags().StringVar(&opts.gpus, "gpus", "", "Comma-separated IDs of the GPUs Jupyter can use, e.g. 0,1. Default: all of them")
+
+	return cmd
+}
+
+func notebook(cmd *cobra.Command, opts notebookOpts, jupyterArgs []string) error {
+	params, err := parseValueMapJSON(opts.paramsJSON, "--params-json")
+	if err != nil {
+		return err
+	}
+	gpus, err := queue.ParseGPUs(opts.gpus)
+	if err != nil {
+		return err
+	}
+	command := strings.Fields(opts.jupyter)
+	if len(command) == 0 {
+		return fmt.Errorf("--jupyter must be a command")
+	}
+	command = append(command, jupyterArgs...)
+	jupyterPath, err := exec.LookPath(command[0])
+	if err != nil {
+		return fmt.Errorf("Failed to find %s. Is Jupyter installed? %w", command[0], err)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	conf, err := getProjectConfig(projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProjectWithConfig(repo, projectDir, conf)
+
+	exp, err := proj.CreateExperiment(project.CreateExperimentArgs{
+		Path:    opts.path,
+		Command: strings.Join(command, " "),
+		Params:  params,
+	}, false, nil, true)
+	if err != nil {
+		return err
+	}
+	if err := proj.RefreshHeartbeat(exp.ID); err != nil {
+		return err
+	}
+	heartbeat := shared.StartHeartbeat(proj, exp.ID)
+	console.Info("Recording the notebook session as experiment %s", exp.ShortID())
+
+	jupyter := exec.Command(jupyterPath, command[1:]...)
+	jupyter.Dir = projectDir
+	jupyter.Stdin = os.Stdin
+	jupyter.Stdout = os.Stdout
+	jupyter.Stderr = os.Stderr
+	jupyter.Env = os.Environ()
+	if len(gpus) > 0 {
+		jupyter.Env = append(jupyter.Env, "CUDA_VISIBLE_DEVICES="+queue.FormatGPUs(gpus))
+	}
+
+	// Ctrl-C goes to Jupyter, which shuts down cleanly, and then the
+	// checkpoint is saved
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	runErr := jupyter.Run()
+	signal.Stop(interrupts)
+	heartbeat.Kill()
+	if runErr != nil {
+		console.Warn("Jupyter exited with an error: %s", runErr)
+	}
+
+	chk, err := addCheckpoint(proj, exp, project.CreateCheckpointArgs{Path: opts.path})
+	if err != nil {
+		return err
+	}
+	if err := proj.StopExperiment(exp.ID); err != nil {
+		return err
+	}
+	console.Info("Saved checkpoint %s in experiment %s", chk.ShortID(), exp.ShortID())
+	return nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+// withPager calls write with a pipe to $PAGER, or less, if stdout is a
+// terminal, so long output can be scrolled through. Otherwise, or if the pager
+// can't be started, write writes to stdout.
+func withPager(write func(out io.Writer) error) error {
+	if !console.IsTTY(os.Stdout) {
+		return write(os.Stdout)
+	}
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	args := strings.Fields(pager)
+	if len(args) == 0 || args[0] == "cat" {
+		return write(os.Stdout)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// quit if the output fits on the screen, and pass colors through
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		console.Debug("Failed to start pager %q: %s", pager, err)
+		return write(os.Stdout)
+	}
+
+	// Ctrl-C goes to the pager, which decides whether to quit
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	writeErr := write(stdin)
+	stdin.Close()
+	// the pager's exit status doesn't matter, as long as the output got to it
+	_ = cmd.Wait()
+	if writeErr != nil && !isBrokenPipe(writeErr) {
+		return writeErr
+	}
+	return nil
+}
+
+// isBrokenPipe returns true if err is from writing to a pager that has quit
+func isBrokenPipe(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.EPIPE || err == os.ErrClosed
+}
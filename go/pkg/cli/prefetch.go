@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/cli/list"
+	"github.com/replicate/keepsake/go/pkg/concurrency"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+// checkpointCacheDir is where checkpoints are prefetched to, in the project
+// directory
+const checkpointCacheDir = ".keepsake/checkpoint-cache"
+
+// checkpointCacheVersion is the format of the checkpoint cache. Increment it
+// if the way checkpoints are stored in it changes, so it is emptied instead
+// of being misread.
+const checkpointCacheVersion = 1
+
+type prefetchOpts struct {
+	checkpoints     string
+	outputDirectory string
+	concurrency     int
+	repositoryURL   string
+}
+
+type prefetchJob struct {
+	experiment *project.Experiment
+	checkpoint *project.Checkpoint
+	dir        string
+}
+
+func newPrefetchCommand() *cobra.Command {
+	var opts prefetchOpts
+
+	cmd := &cobra.Command{
+		Use:   "prefetch [query]",
+		Short: "Download the files of checkpoints ahead of time, e.g. for a batch evaluation job",
+		Long: `Download the files of the checkpoints of the experiments that match a query, several
+at a time, so they are ready before a batch evaluation job starts.
+
+The query is the same as for "keepsake query". Without a query, every experiment is
+used. By default, the best checkpoint of each experiment is downloaded, or its latest
+checkpoint if it doesn't have a primary metric.
+
+Each checkpoint's files are downloaded to a directory named after its ID, in
+.keepsake/checkpoint-cache in the project directory by default. Checkpoints that were
+already downloaded are skipped. The ID and directory of each checkpoint are printed,
+separated by a tab.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return prefetch(opts, args, os.Stdout)
+		}),
+		Args: cobra.MaximumNArgs(1),
+		Example: `Download the best checkpoint of each experiment with an accuracy over 0.9:
+$ keepsake prefetch "metrics.best.accuracy > 0.9"
+
+Download every checkpoint of the experiments with a learning rate of 0.01, 16 at a time:
+$ keepsake prefetch "lr = 0.01" --checkpoints all --concurrency 16`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.checkpoints, "checkpoints", "best", "Which checkpoints of each experiment to download: 'best', 'latest', or 'all'")
+	cmd.Flags().StringVarP(&opts.outputDirectory, "output-directory", "o", "", "Directory to download the checkpoints to. Default: "+checkpointCacheDir+" in the project directory")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 4, "How many checkpoints to download at the same time")
+
+	return cmd
+}
+
+func prefetch(opts prefetchOpts, args []string, out io.Writer) error {
+	if opts.checkpoints != "best" && opts.checkpoints != "latest" && opts.checkpoints != "all" {
+		return fmt.Errorf("Invalid value for --checkpoints: %q. It must be 'best', 'latest', or 'all'.", opts.checkpoints)
+	}
+	if opts.concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	var matcher param.Matcher = new(param.Filters)
+	if len(args) == 1 {
+		query, err := param.ParseQuery(args[0])
+		if err != nil {
+			return err
+		}
+		matcher = query
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	outputDir := opts.outputDirectory
+	cacheVersion := 0
+	if outputDir == "" {
+		outputDir = filepath.Join(projectDir, checkpointCacheDir)
+		cacheVersion = checkpointCacheVersion
+	}
+
+	matches, err := list.MatchingExperiments(proj, matcher)
+	if err != nil {
+		return err
+	}
+	jobs := []*prefetchJob{}
+	for _, match := range matches {
+		exp, err := proj.ExperimentFromPrefix(match.ID)
+		if err != nil {
+			return err
+		}
+		for _, chk := range prefetchCheckpoints(exp, opts.checkpoints) {
+			jobs = append(jobs, &prefetchJob{experiment: exp, checkpoint: chk, dir: filepath.Join(outputDir, chk.ID)})
+		}
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("No checkpoints with files match the query")
+	}
+
+	if global.DryRun {
+		return runPrefetchJobs(proj, nil, jobs, opts.concurrency)
+	}
+	cache, err := files.OpenCache(outputDir, cacheVersion)
+	if err != nil {
+		return err
+	}
+	if err := runPrefetchJobs(proj, cache, jobs, opts.concurrency); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%s\t%s\n", job.checkpoint.ID, job.dir)
+	}
+	return w.Flush()
+}
+
+// prefetchCheckpoints returns the checkpoints of exp that have files, out of
+// "best", "latest", or "all" of them
+func prefetchCheckpoints(exp *project.Experiment, which string) []*project.Checkpoint {
+	candidates := exp.Checkpoints
+	if which != "all" {
+		var chk *project.Checkpoint
+		if which == "best" {
+			chk = exp.BestCheckpoint()
+		}
+		if chk == nil {
+			chk = exp.LatestCheckpoint()
+		}
+		candidates = []*project.Checkpoint{}
+		if chk != nil {
+			candidates = append(candidates, chk)
+		}
+	}
+	checkpoints := []*project.Checkpoint{}
+	for _, chk := range candidates {
+		if chk.Path != "" {
+			checkpoints = append(checkpoints, chk)
+		}
+	}
+	return checkpoints
+}
+
+// runPrefetchJobs downloads the checkpoints that haven't already been
+// downloaded to cache, maxWorkers at a time. It carries on if some of them
+// fail, and returns an error at the end. cache is nil if --dry-run is set.
+func runPrefetchJobs(proj *project.Project, cache *files.Cache, jobs []*prefetchJob, maxWorkers int) error {
+	var mu sync.Mutex
+	failed := 0
+	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	for _, job := range jobs {
+		job := job
+		exists, err := files.FileExists(job.dir)
+		if err != nil {
+			return err
+		}
+		if exists {
+			console.Info("Checkpoint %s was already downloaded to %s", job.checkpoint.ShortID(), job.dir)
+			continue
+		}
+		if global.DryRun {
+			console.Info("Would download checkpoint %s of experiment %s to %s", job.checkpoint.ShortID(), job.experiment.ShortID(), job.dir)
+			continue
+		}
+		err = queue.Go(func() error {
+			console.Info("Downloading checkpoint %s of experiment %s...", job.checkpoint.ShortID(), job.experiment.ShortID())
+			if err := fetchCheckpoint(proj, cache, job); err != nil {
+				console.Warn("Failed to download checkpoint %s: %s", job.checkpoint.ShortID(), err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to download %d of %d checkpoints", failed, len(jobs))
+	}
+	return nil
+}
+
+// fetchCheckpoint downloads a checkpoint to a temporary directory next to
+// job.dir, then moves it into place, so a download that is interrupted isn't
+// mistaken for a complete one. job.dir is locked in cache while it is
+// downloaded, so another process that is downloading the same checkpoint
+// waits for it instead of downloading it too.
+func fetchCheckpoint(proj *project.Project, cache *files.Cache, job *prefetchJob) error {
+	lock, err := cache.LockEntry(filepath.Base(job.dir))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	exists, err := files.FileExists(job.dir)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	tmpDir := job.dir + ".partial"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := proj.FetchCheckpointFiles(job.checkpoint, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	return os.Rename(tmpDir, job.dir)
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestPrefetch(t *testing.T) {
+	projectDir, err := files.TempDir("test-prefetch")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(filepath.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := project.NewProject(repo, projectDir)
+
+	writeWeights := func(contents string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(projectDir, "model"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "model", "weights.pth"), []byte(contents), 0644))
+	}
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	checkpoints := map[string]*project.Checkpoint{}
+	for _, lr := range []float64{0.01, 0.1} {
+		exp, err := proj.CreateExperiment(project.CreateExperimentArgs{Params: param.ValueMap{"lr": param.Float(lr)}}, false, nil, true)
+		require.NoError(t, err)
+		for step, loss := range []float64{0.2, 0.3} {
+			name := param.Float(lr).String() + "/" + param.Float(loss).String()
+			writeWeights(name)
+			chk, err := proj.CreateCheckpoint(project.CreateCheckpointArgs{
+				Path:          "model",
+				Step:          int64(step),
+				Metrics:       param.ValueMap{"loss": param.Float(loss)},
+				PrimaryMetric: primaryMetric,
+			}, false, nil, true)
+			require.NoError(t, err)
+			checkpoints[name] = chk
+			exp.Checkpoints = append(exp.Checkpoints, chk)
+		}
+		_, err = proj.SaveExperiment(exp, true)
+		require.NoError(t, err)
+	}
+
+	outputDir := filepath.Join(projectDir, "cache")
+	opts := prefetchOpts{
+		checkpoints:     "best",
+		outputDirectory: outputDir,
+		concurrency:     2,
+		repositoryURL:   "file://" + filepath.Join(projectDir, ".keepsake"),
+	}
+	out := new(bytes.Buffer)
+	require.NoError(t, prefetch(opts, []string{"lr = 0.01"}, out))
+	best := checkpoints["0.01/0.2"]
+	bestDir := filepath.Join(outputDir, best.ID)
+	require.Equal(t, best.ID+"  "+bestDir+"\n", out.String())
+	contents, err := ioutil.ReadFile(filepath.Join(bestDir, "model", "weights.pth"))
+	require.NoError(t, err)
+	require.Equal(t, "0.01/0.2", string(contents))
+	// the checkpoint, and the locks that other processes wait on while it is
+	// downloaded
+	entries, err := ioutil.ReadDir(outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, ".locks", entries[0].Name())
+
+	// checkpoints that were already downloaded are skipped, and the rest are downloaded
+	opts.checkpoints = "all"
+	out.Reset()
+	require.NoError(t, prefetch(opts, nil, out))
+	entries, err = ioutil.ReadDir(outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	for name, chk := range checkpoints {
+		contents, err := ioutil.ReadFile(filepath.Join(outputDir, chk.ID, "model", "weights.pth"))
+		require.NoError(t, err)
+		require.Equal(t, name, string(contents))
+	}
+
+	require.Error(t, prefetch(opts, []string{"lr = 1"}, out))
+}
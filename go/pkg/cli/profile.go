@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+	"sync"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+)
+
+// stopProfilingFuncs are called by stopProfiling to stop the profiles started
+// by startProfiling and write them out
+var (
+	stopProfilingFuncs []func()
+	stopProfilingOnce  sync.Once
+)
+
+// startProfiling starts the profiles set with --cpuprofile, --memprofile,
+// and --trace. stopProfiling must be called before the process exits to
+// write them out.
+func startProfiling() error {
+	if global.CPUProfile != "" {
+		f, err := os.Create(global.CPUProfile)
+		if err != nil {
+			return fmt.Errorf("Failed to create CPU profile %s: %w", global.CPUProfile, err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("Failed to start CPU profile: %w", err)
+		}
+		stopProfilingFuncs = append(stopProfilingFuncs, func() {
+			runtimepprof.StopCPUProfile()
+			f.Close()
+			console.Debug("Wrote CPU profile to %s", global.CPUProfile)
+		})
+	}
+	if global.Trace != "" {
+		f, err := os.Create(global.Trace)
+		if err != nil {
+			return fmt.Errorf("Failed to create trace %s: %w", global.Trace, err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return fmt.Errorf("Failed to start trace: %w", err)
+		}
+		stopProfilingFuncs = append(stopProfilingFuncs, func() {
+			trace.Stop()
+			f.Close()
+			console.Debug("Wrote trace to %s", global.Trace)
+		})
+	}
+	if global.MemProfile != "" {
+		stopProfilingFuncs = append(stopProfilingFuncs, func() {
+			if err := writeHeapProfile(global.MemProfile); err != nil {
+				console.Warn("%s", err)
+				return
+			}
+			console.Debug("Wrote heap profile to %s", global.MemProfile)
+		})
+	}
+	return nil
+}
+
+// stopProfiling stops the profiles started by startProfiling and writes them
+// out. It is safe to call more than once, so it can be called both when a
+// command finishes and before it exits with an error.
+func stopProfiling() {
+	stopProfilingOnce.Do(func() {
+		for _, stop := range stopProfilingFuncs {
+			stop()
+		}
+	})
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to create heap profile %s: %w", path, err)
+	}
+	defer f.Close()
+	// get up-to-date statistics
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("Failed to write heap profile: %w", err)
+	}
+	return nil
+}
+
+// servePprof serves the net/http/pprof endpoints on addr in the background,
+// for profiling long-running processes like the daemon
+func servePprof(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %s for pprof: %w", addr, err)
+	}
+	// a mux of its own, so nothing else registered on http.DefaultServeMux is exposed
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	console.Debug("Serving pprof on http://%s/debug/pprof/", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			console.Debug("pprof server stopped: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/global"
+)
+
+func TestProfiling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	global.CPUProfile = path.Join(dir, "cpu.prof")
+	global.MemProfile = path.Join(dir, "mem.prof")
+	global.Trace = path.Join(dir, "trace.out")
+	defer func() {
+		global.CPUProfile = ""
+		global.MemProfile = ""
+		global.Trace = ""
+	}()
+
+	require.NoError(t, startProfiling())
+	stopProfiling()
+	// it is safe to stop twice
+	stopProfiling()
+
+	for _, p := range []string{global.CPUProfile, global.MemProfile, global.Trace} {
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		require.NotZero(t, info.Size(), p)
+	}
+}
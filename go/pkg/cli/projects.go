@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+type projectsOpts struct {
+	repositoryURL string
+}
+
+func newProjectsCommand() *cobra.Command {
+	var opts projectsOpts
+
+	cmd := &cobra.Command{
+		Use:   "projects",
+		Short: "Manage the projects that share a repository",
+		Long: `Manage the projects that share a repository.
+
+Several projects can use the same bucket by setting "project" in their keepsake.yaml.
+Each project's experiments are stored under projects/<name>/ in the repository, so
+they don't see or overwrite each other's.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the projects in a repository",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return listProjects(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `List the projects in the repository in keepsake.yaml:
+$ keepsake projects list
+
+List the projects in a bucket:
+$ keepsake projects list -R s3://my-keepsake-bucket`,
+	}
+	addRepositoryURLFlagVar(listCmd, &opts.repositoryURL)
+
+	cmd.AddCommand(listCmd)
+	return cmd
+}
+
+func listProjects(opts projectsOpts, out io.Writer) error {
+	rootURL, projectDir, currentProject, err := getRootRepositoryURL(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	root, err := repository.ForURL(rootURL, projectDir)
+	if err != nil {
+		return err
+	}
+	projects, err := project.ListProjects(root)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		fmt.Fprintf(out, "No projects in %s\n", root.RootURL())
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tEXPERIMENTS\n")
+	for _, p := range projects {
+		name := p.Name
+		if name == currentProject {
+			name += " (current)"
+		}
+		fmt.Fprintf(w, "%s\t%d\n", name, p.NumExperiments)
+	}
+	return w.Flush()
+}
+
+// getRootRepositoryURL returns the repository that contains every project,
+// from --repository or keepsake.yaml, and the name of the project in
+// keepsake.yaml, if it is used
+func getRootRepositoryURL(repositoryURL string) (rootURL string, projectDir string, currentProject string, err error) {
+	if repositoryURL != "" {
+		repositoryURL, projectDir, err = getRepositoryURLFromStringOrConfig(repositoryURL)
+		return repositoryURL, projectDir, "", err
+	}
+	conf, projectDir, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		return "", "", "", err
+	}
+	return conf.RootRepository(), projectDir, conf.Project, nil
+}
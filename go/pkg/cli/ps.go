@@ -41,10 +41,15 @@ func listRunningExperiments(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	filters.SetExclusive("status", param.OperatorEqual, param.String("running"))
+	// experiments that are stopping are still running
+	filters.SetExclusive("running", param.OperatorEqual, param.Bool(true))
 	repo, err := getRepository(repositoryURL, projectDir)
 	if err != nil {
 		return err
 	}
-	return list.Experiments(repo, format, allParams, filters, sortKey)
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	return list.ProjectExperiments(proj, format, allParams, filters, sortKey, nil, list.Page{})
 }
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/cli/list"
+	"github.com/replicate/keepsake/go/pkg/param"
+)
+
+func newQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query <expression>",
+		Short: "List experiments that match a query",
+		Long: `List experiments that match a query.
+
+A query is made of comparisons like "params.lr < 0.01", which can be combined
+with "and", "or", "not", and parentheses. The comparison operators are "=",
+"!=", "<", "<=", ">", and ">=". Strings must be quoted.
+
+Values can be referred to as:
+- params.<name>: a parameter of the experiment
+- metrics.best.<name>: a metric of the best checkpoint, by the primary metric
+- metrics.latest.<name>: a metric of the latest checkpoint
+- metrics.<name>: a metric of the best checkpoint, or the latest checkpoint if
+  there isn't a primary metric
+- created, step, user, host, command, or status
+
+Experiments without a value never match comparisons with it, except "= null".`,
+		Example: `List experiments with a low learning rate and high validation accuracy, as JSON:
+$ keepsake query 'params.lr < 0.01 and metrics.best.val_acc > 0.9' --format json
+
+List stopped experiments that used either optimizer:
+$ keepsake query 'status = "stopped" and (params.optimizer = "adam" or params.optimizer = "sgd")'
+
+List experiments created since the start of the year that didn't save a checkpoint with a loss:
+$ keepsake query 'created >= "2021-01-01" and metrics.latest.loss = null'`,
+		Run:  handleErrors(queryExperiments),
+		Args: cobra.ExactArgs(1),
+	}
+
+	addRepositoryURLFlag(cmd)
+	addListSortFlag(cmd)
+	addListPageFlags(cmd)
+	cmd.Flags().String("format", "table", "Output format: 'table', 'json', 'quiet' (only experiment IDs), 'csv', 'md' (Markdown), or 'html'")
+	cmd.Flags().Bool("all", false, "Output all params and metrics. Default: only params/metrics that differ")
+
+	return cmd
+}
+
+func queryExperiments(cmd *cobra.Command, args []string) error {
+	query, err := param.ParseQuery(args[0])
+	if err != nil {
+		return err
+	}
+	formatString, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	format, err := list.ParseFormat(formatString)
+	if err != nil {
+		return err
+	}
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+	sortKey, err := parseListSortFlag(cmd)
+	if err != nil {
+		return err
+	}
+	page, err := parseListPageFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	return list.ProjectExperiments(proj, format, all, query, sortKey, nil, page)
+}
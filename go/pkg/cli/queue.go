@@ -0,0 +1,349 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/queue"
+)
+
+type queueOpts struct {
+	dir string
+
+	// submit
+	numGPUs     int
+	gpuIDs      string
+	timeout     time.Duration
+	retries     int
+	splitOutput bool
+	secrets     []string
+
+	// list
+	all bool
+
+	// logs
+	since      time.Duration
+	stdoutOnly bool
+	stderrOnly bool
+	timestamps bool
+
+	// scheduler
+	gpus        string
+	interval    time.Duration
+	showOutput  bool
+	groupOutput bool
+}
+
+func newQueueCommand() *cobra.Command {
+	var opts queueOpts
+
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Queue commands to run on a shared machine",
+		Long: `Queue commands to run on a machine that is shared by several people.
+
+Commands are submitted to a queue on the machine, and "keepsake queue scheduler" runs them
+in the order they were submitted: one at a time, or, with --gpus, as many at once as there
+are free GPUs.
+
+Each user has their own queue, because the scheduler runs commands as the user who started
+it. To share GPUs, everyone runs their own scheduler, and GPUs are locked across schedulers.`,
+		Example: `Start the scheduler on a machine with four GPUs:
+$ keepsake queue scheduler --gpus 0,1,2,3
+
+Queue a training run that needs two GPUs:
+$ keepsake queue submit --gpus 2 -- python train.py --learning-rate 0.01
+
+Queue a training run on GPUs 0 and 1 in particular:
+$ keepsake queue submit --gpu-ids 0,1 -- python train.py
+
+Queue a training run that is killed after 6 hours, and run again up to twice if it fails:
+$ keepsake queue submit --timeout 6h --retries 2 -- python train.py
+
+Queue a training run that needs an API key from the scheduler's environment:
+$ keepsake queue submit --secret WANDB_API_KEY=env:WANDB_API_KEY -- python train.py`,
+	}
+	cmd.PersistentFlags().StringVar(&opts.dir, "queue-dir", queue.DefaultDir(), "Directory the queue is stored in. Only you can write to it, because its commands run as you. Can also be set with KEEPSAKE_QUEUE_DIR")
+
+	submitCmd := &cobra.Command{
+		Use:   "submit -- <command>",
+		Short: "Add a command to the queue",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return queueSubmit(opts, args, os.Stdout)
+		}),
+		Args: cobra.MinimumNArgs(1),
+	}
+	submitCmd.Flags().IntVar(&opts.numGPUs, "gpus", 1, "Number of GPUs the command needs, if the scheduler is running with GPUs")
+	submitCmd.Flags().DurationVar(&opts.timeout, "timeout", 0, "Kill the command if it runs for longer than this, e.g. 6h. Default: no timeout")
+	submitCmd.Flags().IntVar(&opts.retries, "retries", 0, "How many times to run the command again if it fails. The command can read KEEPSAKE_QUEUE_ATTEMPT to resume from its latest checkpoint")
+	submitCmd.Flags().StringVar(&opts.gpuIDs, "gpu-ids", "", "Comma-separated IDs of particular GPUs the command must run on, e.g. 0,1. Overrides --gpus")
+	submitCmd.Flags().StringArrayVar(&opts.secrets, "secret", []string{}, "Secret to pass to the command as an environment variable, as <name>=<source>. The source is env:<variable>, file:<path>, gcp:<secret> (Google Cloud Secret Manager), or aws:<secret ID> (AWS Secrets Manager). It is read when the command starts, and its value is redacted from the command's output. Can be repeated.")
+	submitCmd.Flags().BoolVar(&opts.splitOutput, "split-output", false, "Log stdout and stderr separately, with the time each line was written, so 'keepsake queue logs' can filter them")
+
+	listCmd := &cobra.Command{
+		Use:     "ls",
+		Short:   "List queued and running commands",
+		Aliases: []string{"list"},
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return queueList(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+	listCmd.Flags().BoolVar(&opts.all, "all", false, "Also list finished and cancelled commands")
+
+	cancelCmd := &cobra.Command{
+		Use:   "cancel <job ID>",
+		Short: "Remove a command from the queue, or stop it if it is running",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return queueCancel(opts, args)
+		}),
+		Args: cobra.ExactArgs(1),
+	}
+
+	logsCmd := &cobra.Command{
+		Use:   "logs <job ID>",
+		Short: "Print the output of a command",
+		Long: `Print the output of a command that is running or has run.
+
+Commands submitted with --split-output have stdout and stderr logged separately,
+with the time each line was written, so their output can be filtered with --since,
+--stdout-only, and --stderr-only.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return queueLogs(opts, args, os.Stdout)
+		}),
+		Args: cobra.ExactArgs(1),
+		Example: `Print what a command has written to stderr in the last 10 minutes:
+$ keepsake queue logs --since 10m --stderr-only a1b2c3d`,
+	}
+	logsCmd.Flags().DurationVar(&opts.since, "since", 0, "Only print lines written in this long ago, e.g. 10m")
+	logsCmd.Flags().BoolVar(&opts.stdoutOnly, "stdout-only", false, "Only print stdout")
+	logsCmd.Flags().BoolVar(&opts.stderrOnly, "stderr-only", false, "Only print stderr")
+	logsCmd.Flags().BoolVarP(&opts.timestamps, "timestamps", "t", false, "Print the time each line was written, and which stream it was written to")
+
+	schedulerCmd := &cobra.Command{
+		Use:   "scheduler",
+		Short: "Run queued commands",
+		Long: `Run queued commands, in the order they were submitted, until interrupted.
+
+Only one scheduler should run for each queue. Without --gpus, commands run one at a
+time. With --gpus, each command is given as many GPUs as it asked for with
+CUDA_VISIBLE_DEVICES, and commands run at the same time while there are enough free GPUs.
+
+GPUs are locked while commands run on them, in a registry shared by every scheduler
+on the machine, so schedulers for different queues never use the same GPU at once.
+
+Output of each command is written to a log file in the queue directory. With
+--show-output, it is also printed, with each line prefixed by the job's ID. With
+--group-output, the output of each job is printed together, in the order the jobs
+started, instead of as it is written.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return queueScheduler(opts)
+		}),
+		Args: cobra.NoArgs,
+	}
+	schedulerCmd.Flags().StringVar(&opts.gpus, "gpus", "", "Comma-separated IDs of the GPUs to schedule commands on, e.g. 0,1,2,3")
+	schedulerCmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Second, "How often to check the queue")
+	schedulerCmd.Flags().BoolVar(&opts.showOutput, "show-output", false, "Print the output of each command, as well as writing it to its log file")
+	schedulerCmd.Flags().BoolVar(&opts.groupOutput, "group-output", false, "With --show-output, print the output of each command together once the commands that started before it have finished")
+
+	cmd.AddCommand(submitCmd, listCmd, cancelCmd, logsCmd, schedulerCmd)
+	return cmd
+}
+
+func queueSubmit(opts queueOpts, args []string, out io.Writer) error {
+	if opts.numGPUs < 0 {
+		return fmt.Errorf("--gpus cannot be negative")
+	}
+	if opts.timeout < 0 {
+		return fmt.Errorf("--timeout cannot be negative")
+	}
+	if opts.retries < 0 {
+		return fmt.Errorf("--retries cannot be negative")
+	}
+	gpuIDs, err := queue.ParseGPUs(opts.gpuIDs)
+	if err != nil {
+		return err
+	}
+	secrets := []*queue.Secret{}
+	for _, str := range opts.secrets {
+		secret, err := queue.ParseSecret(str)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, secret)
+	}
+	q, err := queue.NewQueue(opts.dir)
+	if err != nil {
+		return err
+	}
+	directory, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	username := ""
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	if global.DryRun {
+		console.Info("Would submit job to %s: %s", opts.dir, strings.Join(args, " "))
+		return nil
+	}
+	job, err := q.Submit(queue.SubmitArgs{
+		Command:     strings.Join(args, " "),
+		Directory:   directory,
+		User:        username,
+		NumGPUs:     opts.numGPUs,
+		GPUIDs:      gpuIDs,
+		Timeout:     opts.timeout,
+		Retries:     opts.retries,
+		SplitOutput: opts.splitOutput,
+		Secrets:     secrets,
+	})
+	if err != nil {
+		return err
+	}
+	console.Info("Submitted job %s. Its output will be written to %s", job.ShortID(), q.LogPath(job))
+	fmt.Fprintln(out, job.ID)
+	return nil
+}
+
+func queueList(opts queueOpts, out io.Writer) error {
+	q, err := queue.NewQueue(opts.dir)
+	if err != nil {
+		return err
+	}
+	jobs, err := q.Jobs()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSUBMITTED\tUSER\tSTATUS\tGPUS\tCOMMAND")
+	position := 0
+	for _, job := range jobs {
+		if job.IsDone() && !opts.all {
+			continue
+		}
+		status := string(job.Status)
+		switch {
+		case job.Status == queue.StatusQueued:
+			position++
+			status = fmt.Sprintf("queued (#%d)", position)
+		case job.Status == queue.StatusRunning && job.CancelRequested:
+			status = "cancelling"
+		case job.Status == queue.StatusFailed && job.Error != "":
+			status = "failed: " + job.Error
+		}
+		if len(job.Attempts) > 1 || (job.Status == queue.StatusQueued && len(job.Attempts) > 0) {
+			status += fmt.Sprintf(", attempt %d", len(job.Attempts))
+		}
+		gpus := fmt.Sprintf("%d", job.NumGPUs)
+		if len(job.GPUIDs) > 0 {
+			gpus = queue.FormatGPUs(job.GPUIDs)
+		}
+		if len(job.GPUs) > 0 {
+			gpus = queue.FormatGPUs(job.GPUs)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ShortID(), console.FormatTime(job.Created), job.User, status, gpus, job.Command)
+	}
+	return w.Flush()
+}
+
+func queueCancel(opts queueOpts, args []string) error {
+	q, err := queue.NewQueue(opts.dir)
+	if err != nil {
+		return err
+	}
+	job, err := q.JobFromPrefix(args[0])
+	if err != nil {
+		return err
+	}
+	if global.DryRun {
+		console.Info("Would cancel job %s", job.ShortID())
+		return nil
+	}
+	if err := q.Cancel(job); err != nil {
+		return err
+	}
+	if job.Status == queue.StatusRunning {
+		console.Info("Asked the scheduler to stop job %s", job.ShortID())
+	} else {
+		console.Info("Cancelled job %s", job.ShortID())
+	}
+	return nil
+}
+
+func queueLogs(opts queueOpts, args []string, out io.Writer) error {
+	if opts.stdoutOnly && opts.stderrOnly {
+		return fmt.Errorf("--stdout-only and --stderr-only can't be used together")
+	}
+	q, err := queue.NewQueue(opts.dir)
+	if err != nil {
+		return err
+	}
+	job, err := q.JobFromPrefix(args[0])
+	if err != nil {
+		return err
+	}
+	since := time.Time{}
+	if opts.since > 0 {
+		since = time.Now().Add(-opts.since)
+	}
+	streams := []string{}
+	if opts.stdoutOnly {
+		streams = append(streams, queue.StreamStdout)
+	}
+	if opts.stderrOnly {
+		streams = append(streams, queue.StreamStderr)
+	}
+	lines, err := q.ReadLogs(job, since, streams)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if opts.timestamps && line.Stream != "" {
+			fmt.Fprintf(out, "%s %s %s\n", line.Time.In(timezone).Format(time.RFC3339), line.Stream, line.Text)
+		} else {
+			fmt.Fprintln(out, line.Text)
+		}
+	}
+	return nil
+}
+
+func queueScheduler(opts queueOpts) error {
+	gpus, err := queue.ParseGPUs(opts.gpus)
+	if err != nil {
+		return err
+	}
+	q, err := queue.NewQueue(opts.dir)
+	if err != nil {
+		return err
+	}
+	locks, err := queue.NewGPULocks(queue.DefaultGPULockDir())
+	if err != nil {
+		return err
+	}
+	if len(gpus) > 0 {
+		console.Info("Scheduling jobs from %s on GPUs %s", opts.dir, queue.FormatGPUs(gpus))
+	} else {
+		console.Info("Scheduling jobs from %s one at a time", opts.dir)
+	}
+	scheduler := queue.NewScheduler(q, gpus, locks, opts.interval)
+	if opts.showOutput || opts.groupOutput {
+		scheduler.Output = console.NewMultiplexer(console.ConsoleInstance, opts.groupOutput)
+	}
+	if global.DryRun {
+		// print what would be started now, rather than scheduling forever
+		scheduler.DryRun = true
+		return scheduler.Tick()
+	}
+	return scheduler.Run()
+}
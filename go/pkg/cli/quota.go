@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+type quotaOpts struct {
+	total         string
+	perUser       string
+	users         []string
+	repositoryURL string
+}
+
+func newQuotaCommand() *cobra.Command {
+	var opts quotaOpts
+
+	cmd := &cobra.Command{
+		Use:   "quota",
+		Short: "Show or set the storage quotas for the repository",
+		Long: `Show or set the storage quotas for the repository.
+
+Quotas limit how many bytes of files experiments and checkpoints can save, for the
+whole repository and for each user. They are stored in the repository, so they apply
+to everyone who uses it. When an experiment or checkpoint would go over a quota, its
+files aren't uploaded and it fails with a "quota exceeded" error.
+
+Sizes are numbers of bytes, optionally with a unit, like 500MB or 10GB. Units are
+powers of 1024. Use "none" to remove a limit.
+
+Without any flags, this prints the quotas and how much of them is used.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return quota(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Limit the repository to 1TB, and each user to 100GB:
+$ keepsake quota --total 1TB --per-user 100GB
+
+Let alice use 200GB:
+$ keepsake quota --user alice=200GB
+
+Show the quotas and how much of them is used:
+$ keepsake quota`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.total, "total", "", "Quota for the whole repository")
+	cmd.Flags().StringVar(&opts.perUser, "per-user", "", "Quota for each user who doesn't have their own quota")
+	cmd.Flags().StringArrayVar(&opts.users, "user", []string{}, "Quota for a particular user, as <username>=<size>. Use <username>=none to give them the per-user quota again. Can be repeated.")
+
+	return cmd
+}
+
+func quota(opts quotaOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	spec, err := repository.LoadSpec(repo)
+	if err != nil {
+		return err
+	}
+	if spec == nil {
+		spec = &repository.Spec{Version: repository.Version}
+	}
+	if spec.Quota == nil {
+		spec.Quota = &repository.Quota{}
+	}
+
+	if opts.total == "" && opts.perUser == "" && len(opts.users) == 0 {
+		proj := project.NewProject(repo, projectDir)
+		usage, err := proj.StorageUsage()
+		if err != nil {
+			return err
+		}
+		return quotaReport(out, repo.RootURL(), spec.Quota, usage)
+	}
+
+	if err := setQuota(spec.Quota, opts); err != nil {
+		return err
+	}
+	if spec.Quota.IsEmpty() {
+		spec.Quota = nil
+	}
+	if err := repository.SaveSpec(repo, spec); err != nil {
+		return err
+	}
+	console.Info("Updated the storage quotas for %s", repo.RootURL())
+	return nil
+}
+
+func setQuota(q *repository.Quota, opts quotaOpts) error {
+	var err error
+	if opts.total != "" {
+		if q.TotalBytes, err = parseQuotaSize(opts.total); err != nil {
+			return fmt.Errorf("Invalid value for --total: %w", err)
+		}
+	}
+	if opts.perUser != "" {
+		if q.PerUserBytes, err = parseQuotaSize(opts.perUser); err != nil {
+			return fmt.Errorf("Invalid value for --per-user: %w", err)
+		}
+	}
+	for _, s := range opts.users {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("Invalid value for --user: %q. It must be in the form <username>=<size>.", s)
+		}
+		size, err := parseQuotaSize(parts[1])
+		if err != nil {
+			return fmt.Errorf("Invalid value for --user: %w", err)
+		}
+		if size == 0 {
+			delete(q.UserBytes, parts[0])
+			continue
+		}
+		if q.UserBytes == nil {
+			q.UserBytes = map[string]int64{}
+		}
+		q.UserBytes[parts[0]] = size
+	}
+	return nil
+}
+
+// parseQuotaSize parses a size like "10GB", "1.5TiB", or "1024". "none" is 0,
+// which means no limit.
+func parseQuotaSize(s string) (int64, error) {
+	if strings.ToLower(strings.TrimSpace(s)) == "none" {
+		return 0, nil
+	}
+	return console.ParseBytes(s)
+}
+
+func quotaReport(out io.Writer, rootURL string, q *repository.Quota, usage *project.StorageUsage) error {
+	fmt.Fprintf(out, "Storage quotas for %s\n\n", rootURL)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\tUSED\tQUOTA\n")
+	fmt.Fprintf(w, "Total\t%s\t%s\n", console.FormatBytes(uint64(usage.TotalBytes)), formatQuota(q.TotalBytes))
+	fmt.Fprintf(w, "Per user\t\t%s\n", formatQuota(q.PerUserBytes))
+
+	usernames := []string{}
+	for username := range usage.BytesByUser {
+		usernames = append(usernames, username)
+	}
+	for username := range q.UserBytes {
+		if _, ok := usage.BytesByUser[username]; !ok {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		name := username
+		if name == "" {
+			name = "(unknown user)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, console.FormatBytes(uint64(usage.BytesByUser[username])), formatQuota(q.UserLimit(username)))
+	}
+	return w.Flush()
+}
+
+func formatQuota(limit int64) string {
+	if limit == 0 {
+		return "none"
+	}
+	return console.FormatBytes(uint64(limit))
+}
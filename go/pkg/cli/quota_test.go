@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestParseQuotaSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"1024":   1024,
+		"500B":   500,
+		"2K":     2048,
+		"10GB":   10 << 30,
+		"1.5TiB": 3 << 39,
+		"none":   0,
+	} {
+		size, err := parseQuotaSize(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, size, s)
+	}
+	for _, s := range []string{"", "GB", "10XB", "-1GB", "lots"} {
+		_, err := parseQuotaSize(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestSetQuota(t *testing.T) {
+	q := &repository.Quota{UserBytes: map[string]int64{"bob": 1 << 30}}
+	require.NoError(t, setQuota(q, quotaOpts{total: "1TB", users: []string{"alice=200GB", "bob=none"}}))
+	require.Equal(t, &repository.Quota{
+		TotalBytes: 1 << 40,
+		UserBytes:  map[string]int64{"alice": 200 << 30},
+	}, q)
+	require.Equal(t, int64(200<<30), q.UserLimit("alice"))
+	require.Equal(t, int64(0), q.UserLimit("bob"))
+
+	require.Error(t, setQuota(q, quotaOpts{users: []string{"200GB"}}))
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/cli/list"
+	"github.com/replicate/keepsake/go/pkg/cli/report"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/param"
+)
+
+type reportOpts struct {
+	output        string
+	format        string
+	title         string
+	repositoryURL string
+}
+
+func newReportCommand() *cobra.Command {
+	var opts reportOpts
+
+	cmd := &cobra.Command{
+		Use:   "report <query>",
+		Short: "Write a report of the experiments that match a query",
+		Long: `Write a static report of the experiments that match a query, to put in a wiki
+or the supplementary material of a paper.
+
+The report has charts of each metric by step, tables of the params and of the
+metrics of each experiment's best checkpoint (or latest, if there isn't a
+primary metric), and the environment each experiment ran in.
+
+The query is in the same format as "keepsake query". The report is HTML, or
+Markdown if --output ends in .md. Markdown reports don't have charts.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return writeReport(opts, args[0], os.Stdout)
+		}),
+		Args: cobra.ExactArgs(1),
+		Example: `Write a report of the experiments with a validation accuracy over 0.9:
+$ keepsake report 'metrics.best.val_acc > 0.9' -o report.html
+
+Write a Markdown report of the experiments that used Adam, to put in a wiki:
+$ keepsake report 'params.optimizer = "adam"' -o report.md --title "Adam"`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "-", "File to write the report to, or - for stdout")
+	cmd.Flags().StringVar(&opts.format, "format", "", "Format of the report: 'html' or 'md' (Markdown). Default: by the extension of --output, or 'html'")
+	cmd.Flags().StringVar(&opts.title, "title", "Keepsake experiments", "Title of the report")
+
+	return cmd
+}
+
+func writeReport(opts reportOpts, queryString string, stdout io.Writer) error {
+	query, err := param.ParseQuery(queryString)
+	if err != nil {
+		return err
+	}
+	format := report.FormatForPath(opts.output)
+	if opts.format != "" {
+		format, err = report.ParseFormat(opts.format)
+		if err != nil {
+			return err
+		}
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	experiments, err := list.Select(proj, query)
+	if err != nil {
+		return err
+	}
+	if len(experiments) == 0 {
+		return fmt.Errorf("No experiments match the query: %s", queryString)
+	}
+
+	if opts.output == "-" {
+		return report.Write(stdout, format, opts.title, experiments, time.Now())
+	}
+	f, err := os.Create(opts.output)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f, format, opts.title, experiments, time.Now()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	console.Info("Wrote a report of %d experiments to %s", len(experiments), opts.output)
+	return nil
+}
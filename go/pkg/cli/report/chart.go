@@ -0,0 +1,115 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	chartWidth        = 640
+	chartHeight       = 320
+	chartMarginLeft   = 70
+	chartMarginRight  = 20
+	chartMarginTop    = 20
+	chartMarginBottom = 40
+	chartTicks        = 5
+)
+
+// palette is the colors of the lines in charts, one per experiment. They are
+// reused if there are more experiments than colors.
+var palette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+func colorFor(i int) string {
+	return palette[i%len(palette)]
+}
+
+type point struct {
+	x float64
+	y float64
+}
+
+// series is one experiment's values of a metric, by step
+type series struct {
+	color  string
+	points []point
+}
+
+// svgChart draws series as an SVG line chart, with the step on the x axis and
+// the value of the metric on the y axis
+func svgChart(metric string, allSeries []*series) template.HTML {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range allSeries {
+		for _, p := range s.points {
+			minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+			minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+		}
+	}
+	// a single value is drawn in the middle of the chart
+	if minX == maxX {
+		minX, maxX = minX-1, maxX+1
+	}
+	if minY == maxY {
+		minY, maxY = minY-1, maxY+1
+	}
+
+	plotWidth := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartHeight - chartMarginTop - chartMarginBottom)
+	scaleX := func(x float64) float64 {
+		return chartMarginLeft + (x-minX)/(maxX-minX)*plotWidth
+	}
+	scaleY := func(y float64) float64 {
+		return chartMarginTop + (maxY-y)/(maxY-minY)*plotHeight
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s">`, chartWidth, chartHeight, chartWidth, chartHeight, html.EscapeString(metric))
+	b.WriteString("\n")
+
+	// grid lines and labels on the y axis
+	for i := 0; i <= chartTicks; i++ {
+		value := minY + (maxY-minY)*float64(i)/chartTicks
+		y := scaleY(value)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e5e5e5"/>`, chartMarginLeft, y, chartWidth-chartMarginRight, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle" font-size="11" fill="#555">%s</text>`, chartMarginLeft-6, y, formatNumber(value))
+		b.WriteString("\n")
+	}
+	// labels on the x axis
+	for i := 0; i <= chartTicks; i++ {
+		value := minX + (maxX-minX)*float64(i)/chartTicks
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" font-size="11" fill="#555">%s</text>`, scaleX(value), chartHeight-chartMarginBottom+16, formatNumber(value))
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" font-size="12" fill="#333">step</text>`, chartMarginLeft+plotWidth/2, chartHeight-6)
+	b.WriteString("\n")
+
+	for _, s := range allSeries {
+		coords := []string{}
+		for _, p := range s.points {
+			coords = append(coords, fmt.Sprintf("%.1f,%.1f", scaleX(p.x), scaleY(p.y)))
+		}
+		if len(coords) > 1 {
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(coords, " "), s.color)
+			b.WriteString("\n")
+		}
+		for _, p := range s.points {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"/>`, scaleX(p.x), scaleY(p.y), s.color)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("</svg>")
+
+	// everything in it is either a number or escaped
+	return template.HTML(b.String())
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', 4, 64)
+}
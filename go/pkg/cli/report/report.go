@@ -0,0 +1,286 @@
+// Package report writes static reports of a set of experiments, with charts of
+// their metrics, tables of their params, and the environment they ran in, as
+// HTML or Markdown
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/table"
+)
+
+type Format int
+
+const (
+	FormatHTML Format = iota
+	FormatMarkdown
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "html":
+		return FormatHTML, nil
+	case "md", "markdown":
+		return FormatMarkdown, nil
+	}
+	return 0, fmt.Errorf("Unknown format: %q. It must be 'html' or 'md'.", s)
+}
+
+// FormatForPath returns the format of a report written to path, by its
+// extension, which is HTML unless it is a Markdown file
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return FormatMarkdown
+	}
+	return FormatHTML
+}
+
+type report struct {
+	Title       string
+	Generated   string
+	Version     string
+	ParamNames  []string
+	MetricNames []string
+	Experiments []*experimentRow
+	Charts      []*chart
+}
+
+type experimentRow struct {
+	ID              string
+	ShortID         string
+	Color           string
+	Created         string
+	User            string
+	Host            string
+	Command         string
+	PythonVersion   string
+	KeepsakeVersion string
+	// Values of ParamNames and MetricNames, or "" if the experiment doesn't have them
+	Params  []string
+	Metrics []string
+	// The checkpoint the metrics are from: the best, or the latest if there
+	// isn't a primary metric
+	Checkpoint string
+	Packages   []string
+}
+
+type chart struct {
+	Metric string
+	SVG    template.HTML
+}
+
+// Write writes a report of experiments to w. Markdown reports don't have
+// charts, because Markdown can't embed them.
+func Write(w io.Writer, format Format, title string, experiments []*project.Experiment, generated time.Time) error {
+	r := newReport(title, experiments, generated)
+	if format == FormatMarkdown {
+		return writeMarkdown(w, r)
+	}
+	return htmlTemplate.Execute(w, r)
+}
+
+func newReport(title string, experiments []*project.Experiment, generated time.Time) *report {
+	r := &report{
+		Title:     title,
+		Generated: generated.UTC().Format(time.RFC1123),
+		Version:   global.Version,
+	}
+
+	paramNames := map[string]bool{}
+	metricNames := map[string]bool{}
+	for _, exp := range experiments {
+		for name := range exp.Params {
+			paramNames[name] = true
+		}
+		for _, chk := range exp.Checkpoints {
+			for name := range chk.Metrics {
+				metricNames[name] = true
+			}
+		}
+	}
+	r.ParamNames = sortedKeys(paramNames)
+	r.MetricNames = sortedKeys(metricNames)
+
+	for i, exp := range experiments {
+		row := &experimentRow{
+			ID:              exp.ID,
+			ShortID:         exp.ShortID(),
+			Color:           colorFor(i),
+			Created:         exp.Created.UTC().Format(time.RFC1123),
+			User:            exp.User,
+			Host:            exp.Host,
+			Command:         exp.Command,
+			PythonVersion:   exp.PythonVersion,
+			KeepsakeVersion: exp.KeepsakeVersion,
+		}
+		for _, name := range r.ParamNames {
+			value := ""
+			if v, ok := exp.Params[name]; ok {
+				value = v.String()
+			}
+			row.Params = append(row.Params, value)
+		}
+		chk := exp.BestCheckpoint()
+		if chk == nil {
+			chk = exp.LatestCheckpoint()
+		}
+		if chk != nil {
+			row.Checkpoint = fmt.Sprintf("%s (step %d)", chk.ShortID(), chk.Step)
+		}
+		for _, name := range r.MetricNames {
+			value := ""
+			if chk != nil {
+				if v, ok := chk.Metrics[name]; ok {
+					value = v.String()
+				}
+			}
+			row.Metrics = append(row.Metrics, value)
+		}
+		for name, version := range exp.PythonPackages {
+			row.Packages = append(row.Packages, name+"=="+version)
+		}
+		sort.Strings(row.Packages)
+		r.Experiments = append(r.Experiments, row)
+	}
+
+	for _, name := range r.MetricNames {
+		allSeries := []*series{}
+		for i, exp := range experiments {
+			s := &series{color: colorFor(i)}
+			for _, chk := range exp.Checkpoints {
+				if value, ok := chk.MetricValue(name); ok {
+					s.points = append(s.points, point{x: float64(chk.Step), y: value})
+				}
+			}
+			if len(s.points) == 0 {
+				continue
+			}
+			sort.SliceStable(s.points, func(i, j int) bool {
+				return s.points[i].x < s.points[j].x
+			})
+			allSeries = append(allSeries, s)
+		}
+		// metrics that aren't numbers can't be charted
+		if len(allSeries) > 0 {
+			r.Charts = append(r.Charts, &chart{Metric: name, SVG: svgChart(name, allSeries)})
+		}
+	}
+	return r
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeMarkdown(w io.Writer, r *report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", r.Title)
+	fmt.Fprintf(&b, "%d experiments. Generated by Keepsake %s on %s.\n\n", len(r.Experiments), r.Version, r.Generated)
+
+	b.WriteString("## Metrics\n\n")
+	writeMarkdownTable(&b, append([]string{"Experiment", "Checkpoint"}, r.MetricNames...), func(row *experimentRow) []string {
+		return append([]string{"`" + row.ShortID + "`", row.Checkpoint}, row.Metrics...)
+	}, r.Experiments)
+
+	b.WriteString("## Params\n\n")
+	writeMarkdownTable(&b, append([]string{"Experiment"}, r.ParamNames...), func(row *experimentRow) []string {
+		return append([]string{"`" + row.ShortID + "`"}, row.Params...)
+	}, r.Experiments)
+
+	b.WriteString("## Environment\n\n")
+	writeMarkdownTable(&b, []string{"Experiment", "Created", "User", "Host", "Command", "Python", "Keepsake"}, func(row *experimentRow) []string {
+		return []string{"`" + row.ShortID + "`", row.Created, row.User, row.Host, row.Command, row.PythonVersion, row.KeepsakeVersion}
+	}, r.Experiments)
+	for _, row := range r.Experiments {
+		if len(row.Packages) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "<details>\n<summary>Python packages of %s</summary>\n\n```\n%s\n```\n\n</details>\n\n", row.ShortID, strings.Join(row.Packages, "\n"))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTable(b *strings.Builder, headings []string, cells func(*experimentRow) []string, rows []*experimentRow) {
+	for i, heading := range headings {
+		headings[i] = table.MarkdownCell(heading)
+	}
+	fmt.Fprintf(b, "| %s |\n", strings.Join(headings, " | "))
+	fmt.Fprintf(b, "|%s\n", strings.Repeat(" --- |", len(headings)))
+	for _, row := range rows {
+		values := cells(row)
+		for i, value := range values {
+			values[i] = table.MarkdownCell(value)
+		}
+		fmt.Fprintf(b, "| %s |\n", strings.Join(values, " | "))
+	}
+	b.WriteString("\n")
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; max-width: 1100px; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; font-size: 14px; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f6f6; }
+code { font-family: SFMono-Regular, Consolas, Menlo, monospace; }
+figure { display: inline-block; margin: 0 1em 1.5em 0; }
+figcaption { font-weight: bold; margin-bottom: 4px; }
+.swatch { display: inline-block; width: 10px; height: 10px; margin-right: 6px; border-radius: 2px; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">{{len .Experiments}} experiments. Generated by Keepsake {{.Version}} on {{.Generated}}.</p>
+
+<h2>Metrics</h2>
+{{range .Charts}}<figure>
+<figcaption>{{.Metric}}</figcaption>
+{{.SVG}}
+</figure>
+{{end}}
+<table>
+<tr><th>Experiment</th><th>Checkpoint</th>{{range .MetricNames}}<th>{{.}}</th>{{end}}</tr>
+{{range .Experiments}}<tr><td><span class="swatch" style="background: {{.Color}}"></span><code title="{{.ID}}">{{.ShortID}}</code></td><td>{{.Checkpoint}}</td>{{range .Metrics}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Params</h2>
+<table>
+<tr><th>Experiment</th>{{range .ParamNames}}<th>{{.}}</th>{{end}}</tr>
+{{range .Experiments}}<tr><td><code title="{{.ID}}">{{.ShortID}}</code></td>{{range .Params}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Environment</h2>
+<table>
+<tr><th>Experiment</th><th>Created</th><th>User</th><th>Host</th><th>Command</th><th>Python</th><th>Keepsake</th></tr>
+{{range .Experiments}}<tr><td><code title="{{.ID}}">{{.ShortID}}</code></td><td>{{.Created}}</td><td>{{.User}}</td><td>{{.Host}}</td><td><code>{{.Command}}</code></td><td>{{.PythonVersion}}</td><td>{{.KeepsakeVersion}}</td></tr>
+{{end}}</table>
+{{range .Experiments}}{{if .Packages}}<details>
+<summary>Python packages of {{.ShortID}}</summary>
+<pre>{{range .Packages}}{{.}}
+{{end}}</pre>
+</details>
+{{end}}{{end}}
+</body>
+</html>
+`))
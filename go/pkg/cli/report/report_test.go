@@ -0,0 +1,89 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func testExperiments(t *testing.T) []*project.Experiment {
+	created, err := time.Parse(time.RFC3339, "2020-11-12T01:02:03Z")
+	require.NoError(t, err)
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	return []*project.Experiment{{
+		ID:             "1eeeeeeeee",
+		Created:        created,
+		Params:         param.ValueMap{"lr": param.Float(0.01), "optimizer": param.String("<adam>")},
+		User:           "andreas",
+		Command:        "train.py",
+		PythonVersion:  "3.8.5",
+		PythonPackages: map[string]string{"torch": "1.7.0"},
+		Checkpoints: []*project.Checkpoint{{
+			ID:            "1ccccccccc",
+			Step:          1,
+			Metrics:       param.ValueMap{"loss": param.Float(0.5), "label": param.String("first")},
+			PrimaryMetric: primaryMetric,
+		}, {
+			ID:            "2ccccccccc",
+			Step:          2,
+			Metrics:       param.ValueMap{"loss": param.Float(0.25)},
+			PrimaryMetric: primaryMetric,
+		}},
+	}, {
+		ID:      "2eeeeeeeee",
+		Created: created.Add(time.Hour),
+		Params:  param.ValueMap{"lr": param.Float(0.1), "layers": param.Int(3)},
+		User:    "ben",
+		Command: "train.py --fast",
+	}}
+}
+
+func TestFormat(t *testing.T) {
+	require.Equal(t, FormatHTML, FormatForPath("report.html"))
+	require.Equal(t, FormatHTML, FormatForPath("-"))
+	require.Equal(t, FormatMarkdown, FormatForPath("docs/report.MD"))
+
+	format, err := ParseFormat("md")
+	require.NoError(t, err)
+	require.Equal(t, FormatMarkdown, format)
+	_, err = ParseFormat("pdf")
+	require.Error(t, err)
+}
+
+func TestWriteHTML(t *testing.T) {
+	out := new(bytes.Buffer)
+	require.NoError(t, Write(out, FormatHTML, "Learning rates", testExperiments(t), time.Now()))
+	s := out.String()
+	require.Contains(t, s, "<title>Learning rates</title>")
+	require.Contains(t, s, "2 experiments.")
+	// charts of numeric metrics only
+	require.Equal(t, 1, strings.Count(s, "<svg"))
+	require.Contains(t, s, `<figcaption>loss</figcaption>`)
+	require.Contains(t, s, "<polyline")
+	// the best checkpoint's metrics
+	require.Contains(t, s, "2cccccc (step 2)")
+	require.Contains(t, s, "<td>0.25</td>")
+	// values are escaped
+	require.Contains(t, s, "&lt;adam&gt;")
+	require.NotContains(t, s, "<adam>")
+	require.Contains(t, s, "torch==1.7.0")
+	require.Contains(t, s, "background: #4e79a7")
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	out := new(bytes.Buffer)
+	require.NoError(t, Write(out, FormatMarkdown, "Learning rates", testExperiments(t), time.Now()))
+	s := out.String()
+	require.True(t, strings.HasPrefix(s, "# Learning rates\n"))
+	require.NotContains(t, s, "<svg")
+	require.Contains(t, s, "| Experiment | Checkpoint | label | loss |\n| --- | --- | --- | --- |\n| `1eeeeee` | 2cccccc (step 2) |  | 0.25 |\n| `2eeeeee` |  |  |  |\n")
+	require.Contains(t, s, "| Experiment | layers | lr | optimizer |\n| --- | --- | --- | --- |\n| `1eeeeee` |  | 0.01 | <adam> |\n| `2eeeeee` | 3 | 0.1 |  |\n")
+	require.Contains(t, s, "| `2eeeeee` | Thu, 12 Nov 2020 02:02:03 UTC | ben |  | train.py --fast |  |  |\n")
+	require.Contains(t, s, "<summary>Python packages of 1eeeeee</summary>")
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/repository"
+	"github.com/replicate/keepsake/go/pkg/version"
+)
+
+func newRequireVersionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "require-version [version]",
+		Short: "Set the oldest version of Keepsake that can use the repository",
+		Long: `Set the oldest version of Keepsake that can use the repository.
+
+Every Keepsake command checks this before it reads or writes the repository, and
+tells anyone using an older version how to upgrade. Use this when you start using
+a feature of a new version of Keepsake in a shared repository, so teammates on
+older versions can't write metadata to it that the new version doesn't understand.
+
+Without a version, this prints the version the repository currently requires.`,
+		Example: `$ keepsake require-version 0.5.0`,
+		Run:     handleErrors(requireVersion),
+		Args:    cobra.MaximumNArgs(1),
+	}
+
+	addRepositoryURLFlag(cmd)
+
+	return cmd
+}
+
+func requireVersion(cmd *cobra.Command, args []string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return err
+	}
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	conf, err := getRepositoryConfig(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	repo = wrapForReadOnly(wrapForDryRun(repo), conf)
+	spec, err := repository.LoadSpec(repo)
+	if err != nil {
+		return err
+	}
+	if spec == nil {
+		spec = &repository.Spec{Version: repository.Version}
+	} else if err := spec.CheckCompatible(repo.RootURL(), global.Version); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if spec.MinimumKeepsakeVersion == "" {
+			fmt.Printf("%s can be used with any version of Keepsake\n", repo.RootURL())
+		} else {
+			fmt.Printf("%s requires Keepsake %s or later\n", repo.RootURL(), spec.MinimumKeepsakeVersion)
+		}
+		return nil
+	}
+
+	minimum, err := version.Parse(args[0])
+	if err != nil {
+		return err
+	}
+	// Don't let people lock themselves out of the repository
+	if current, err := version.Parse(global.Version); err == nil && current.Compare(minimum) < 0 {
+		return fmt.Errorf("You are using Keepsake %s, so you can't require %s or later. Upgrade Keepsake first.", global.Version, minimum)
+	}
+
+	spec.MinimumKeepsakeVersion = minimum.String()
+	if err := repository.SaveSpec(repo, spec); err != nil {
+		return err
+	}
+	console.Info("%s now requires Keepsake %s or later", repo.RootURL(), spec.MinimumKeepsakeVersion)
+	return nil
+}
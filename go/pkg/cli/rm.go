@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
 	"github.com/replicate/keepsake/go/pkg/project"
 )
 
@@ -16,9 +17,18 @@ func newRmCommand() *cobra.Command {
 		Long: `Remove experiments or checkpoints.
 
 To remove experiments or checkpoints, pass any number of IDs (or prefixes).
+
+To remove checkpoints whose uploads were interrupted, pass --incomplete, with
+the IDs of the experiments to remove them from, or no IDs to remove them from
+every experiment.
 `,
-		Run:        handleErrors(removeExperimentOrCheckpoint),
-		Args:       cobra.MinimumNArgs(1),
+		Run: handleErrors(removeExperimentOrCheckpoint),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if incomplete, _ := cmd.Flags().GetBool("incomplete"); incomplete {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Aliases:    []string{"delete"},
 		SuggestFor: []string{"remove"},
 		Example: `Delete an experiment and its checkpoints
@@ -28,11 +38,15 @@ keepsake rm a1b2c3d4
 Delete all experiments where the metric "val_accuracy" is less
 than 0.2 at the best checkpoints:
 keepsake rm $(keepsake ls -q --filter "val_accuracy < 0.2")
+
+Delete the checkpoints in every experiment that weren't fully uploaded:
+keepsake rm --incomplete
 `,
 	}
 
 	addRepositoryURLFlag(cmd)
 	cmd.Flags().BoolP("force", "f", false, "Force delete without interactive prompt")
+	cmd.Flags().Bool("incomplete", false, "Remove the checkpoints whose uploads were interrupted, from the given experiments or every experiment")
 
 	return cmd
 }
@@ -54,6 +68,13 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 	if err != nil {
 		return err
 	}
+	incomplete, err := cmd.Flags().GetBool("incomplete")
+	if err != nil {
+		return err
+	}
+	if incomplete {
+		return removeIncompleteCheckpoints(proj, prefixes, force)
+	}
 
 	comOrExps := []*project.CheckpointOrExperiment{}
 	for _, prefix := range prefixes {
@@ -68,7 +89,8 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 		return nil
 	}
 
-	if !force {
+	// nothing is deleted in a dry run, so there's nothing to confirm
+	if !force && !global.DryRun {
 		fmt.Println("You are about to delete the following:")
 		for _, comOrExp := range comOrExps {
 			if comOrExp.Experiment != nil {
@@ -96,20 +118,20 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 			return err
 		}
 		if comOrExp.Checkpoint != nil {
+			dependents, err := proj.DeltaDependents(comOrExp.Experiment, comOrExp.Checkpoint)
+			if err != nil {
+				return err
+			}
+			if len(dependents) > 0 {
+				return fmt.Errorf("Checkpoint %s can't be removed on its own, because checkpoint %s is stored as deltas against it. Remove its experiment %s instead.", comOrExp.Checkpoint.ShortID(), dependents[0].ShortID(), comOrExp.Experiment.ShortID())
+			}
 			console.Info("Removing checkpoint %s...", comOrExp.Checkpoint.ShortID())
 			if err := proj.DeleteCheckpoint(comOrExp.Checkpoint); err != nil {
 				return err
 			}
 		} else {
 			console.Info("Removing experiment %s and its checkpoints...", comOrExp.Experiment.ShortID())
-			experiment := comOrExp.Experiment
-			// This is slow, see https://github.com/replicate/keepsake/issues/333
-			for _, checkpoint := range experiment.Checkpoints {
-				if err := proj.DeleteCheckpoint(checkpoint); err != nil {
-					return err
-				}
-			}
-			if err := proj.DeleteExperiment(experiment); err != nil {
+			if err := removeExperiment(proj, comOrExp.Experiment); err != nil {
 				return err
 			}
 		}
@@ -117,3 +139,74 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 
 	return nil
 }
+
+// removeExperiment removes an experiment and its checkpoints
+func removeExperiment(proj *project.Project, experiment *project.Experiment) error {
+	// This is slow, see https://github.com/replicate/keepsake/issues/333
+	for _, checkpoint := range experiment.Checkpoints {
+		if err := proj.DeleteCheckpoint(checkpoint); err != nil {
+			return err
+		}
+	}
+	return proj.DeleteExperiment(experiment)
+}
+
+// removeIncompleteCheckpoints removes the checkpoints whose uploads were
+// interrupted from the experiments that match prefixes, or from every
+// experiment if there are no prefixes
+func removeIncompleteCheckpoints(proj *project.Project, prefixes []string, force bool) error {
+	experiments := []*project.Experiment{}
+	if len(prefixes) == 0 {
+		var err error
+		experiments, err = proj.Experiments()
+		if err != nil {
+			return err
+		}
+	}
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		experiments = append(experiments, exp)
+	}
+
+	checkpoints := []*project.Checkpoint{}
+	for _, exp := range experiments {
+		incomplete, err := proj.IncompleteCheckpoints(exp)
+		if err != nil {
+			return err
+		}
+		checkpoints = append(checkpoints, incomplete...)
+	}
+	if len(checkpoints) == 0 {
+		console.Info("There are no incomplete checkpoints.")
+		return nil
+	}
+
+	if !force && !global.DryRun {
+		fmt.Println("You are about to delete the following incomplete checkpoints:")
+		for _, chk := range checkpoints {
+			fmt.Printf("* Checkpoint %s\n", chk.ShortID())
+		}
+		continueDelete, err := console.InteractiveBool{
+			Prompt:         "\nDo you want to continue?",
+			Default:        false,
+			NonDefaultFlag: "-f",
+		}.Read()
+		if err != nil {
+			return err
+		}
+		if !continueDelete {
+			return fmt.Errorf("Aborting.")
+		}
+	}
+
+	for _, chk := range checkpoints {
+		console.Info("Removing incomplete checkpoint %s...", chk.ShortID())
+		if err := proj.DeleteCheckpoint(chk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -27,12 +27,16 @@ To learn how to get started, go to ` + global.WebURL + `/docs/tutorial`,
 				console.SetLevel(console.DebugLevel)
 			}
 			console.SetColor(global.Color)
+			if err := startProfiling(); err != nil {
+				console.Fatal("%s", err)
+			}
 
 			if err := analytics.TrackCommand(cmd.Name()); err != nil {
 				console.Debug("analytics error: %s", err)
 			}
 		},
 		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			stopProfiling()
 		},
 	}
 	setPersistentFlags(&rootCmd)
@@ -40,14 +44,40 @@ To learn how to get started, go to ` + global.WebURL + `/docs/tutorial`,
 
 	rootCmd.AddCommand(
 		newAnalyticsCommand(),
+		newCheckCommand(),
 		newCheckoutCommand(),
+		newCIReportCommand(),
 		newRmCommand(),
+		newSaveCommand(),
+		newSearchCommand(),
 		newDiffCommand(),
+		newExportDBCommand(),
 		newFeedbackCommand(),
 		newGenerateDocsCommand(&rootCmd),
+		newGroupCommand(),
+		newInitCommand(),
+		newInternalCommand(),
+		newLineageCommand(),
 		newListCommand(),
+		newLogsCommand(),
+		newMetricsCommand(),
+		newNotebookCommand(),
+		newCostCommand(),
+		newPrefetchCommand(),
+		newProjectsCommand(),
 		newPsCommand(),
+		newQueryCommand(),
+		newQuotaCommand(),
+		newQueueCommand(),
+		newReportCommand(),
+		newRequireVersionCommand(),
 		newShowCommand(),
+		newStatsCommand(),
+		newStatusCommand(),
+		newStopCommand(),
+		newTUICommand(),
+		newUpdateCommand(),
+		newVerifyCommand(),
 	)
 
 	return &rootCmd, nil
@@ -58,6 +88,14 @@ func setPersistentFlags(cmd *cobra.Command) {
 	// FIXME (bfirsh): this noun needs standardizing. we use the term "working directory" in some places.
 	cmd.PersistentFlags().StringVarP(&global.ProjectDirectory, "project-directory", "D", "", "Project directory. Default: nearest parent directory with keepsake.yaml")
 	cmd.PersistentFlags().BoolVarP(&global.Verbose, "verbose", "v", false, "Verbose output")
+	cmd.PersistentFlags().BoolVar(&global.DryRun, "dry-run", false, "Print what would be written, deleted, or started, without doing it")
+	cmd.PersistentFlags().BoolVar(&global.ReadOnly, "read-only", false, "Open the repository read-only, so anything that would write to or delete from it fails")
+	cmd.PersistentFlags().BoolVar(&global.VerboseTransfers, "verbose-transfers", false, "Log every object uploaded or downloaded, with its size, duration, and retries, and write them to a transfer manifest")
+	cmd.PersistentFlags().StringVar(&global.TransferManifest, "transfer-manifest", "", "Path to write the transfer manifest to, as lines of JSON. Default: a new file in the temporary directory")
+	cmd.PersistentFlags().StringVar(&global.CPUProfile, "cpuprofile", "", "Write a CPU profile to this file, for debugging performance")
+	cmd.PersistentFlags().StringVar(&global.MemProfile, "memprofile", "", "Write a heap profile to this file when the command finishes, for debugging memory use")
+	cmd.PersistentFlags().StringVar(&global.Trace, "trace", "", "Write an execution trace to this file, for debugging performance")
+	cmd.PersistentFlags().BoolVar(&global.FsyncDownloads, "fsync", false, "Sync downloaded files to disk before moving them into place, so they survive a crash straight after a checkout. This is slower.")
 
 }
 
@@ -65,4 +103,7 @@ func handleEnvironmentVariables() {
 	if s3Region := os.Getenv("AWS_DEFAULT_REGION"); s3Region != "" {
 		global.S3Region = s3Region
 	}
+	if pprofAddr := os.Getenv("KEEPSAKE_PPROF_ADDR"); pprofAddr != "" {
+		global.PprofAddr = pprofAddr
+	}
 }
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type saveOpts struct {
+	experiment    string
+	path          string
+	metricsFile   string
+	step          int64
+	primaryMetric string
+	goal          string
+	params        []string
+	paramsFile    string
+}
+
+func newSaveCommand() *cobra.Command {
+	var opts saveOpts
+
+	cmd := &cobra.Command{
+		Use:   "save",
+		Short: "Save a checkpoint from the command line",
+		Long: `Save a checkpoint from the command line.
+
+This is for recording checkpoints from shell scripts, Makefiles, and cron jobs
+that don't use the Python library. The files at --path and the metrics in the
+--metrics-json file are saved as a checkpoint in the experiment passed with
+--experiment, or in a new experiment if it isn't passed.
+
+A new experiment's params are read from --params-file, or from params.yaml in
+the project directory if it exists, with any --param flags overriding them.
+
+The ID of the checkpoint's experiment is printed on stdout, so it can be passed
+to --experiment to save more checkpoints in it.`,
+		Run:  handleErrors(func(cmd *cobra.Command, args []string) error { return save(cmd, opts, os.Stdin, os.Stdout) }),
+		Args: cobra.NoArgs,
+		Example: `Save the outputs directory, with the metrics a training script wrote:
+keepsake save --path outputs/ --metrics-json metrics.json --step 42
+
+Save more checkpoints in the same experiment:
+exp=$(keepsake save --path outputs/ --step 1)
+keepsake save --experiment $exp --path outputs/ --step 2
+
+Record the experiment's hyperparameters, overriding one of them:
+keepsake save --params-file hparams.yaml --param learning_rate=0.01 --path outputs/
+
+Read metrics from stdin:
+./evaluate.sh | keepsake save --metrics-json - --primary-metric accuracy --goal maximize`,
+	}
+
+	addRepositoryURLFlag(cmd)
+	cmd.Flags().StringVarP(&opts.experiment, "experiment", "e", "", "ID of the experiment to save the checkpoint in. Default: a new experiment")
+	cmd.Flags().StringVar(&opts.path, "path", "", "Path to the files to save, relative to the project directory. Default: don't save any files")
+	cmd.Flags().StringVar(&opts.metricsFile, "metrics-json", "", "File with the checkpoint's metrics as a JSON object, or - to read it from stdin")
+	cmd.Flags().Int64Var(&opts.step, "step", 0, "The checkpoint's step. Default: no step")
+	cmd.Flags().StringVar(&opts.primaryMetric, "primary-metric", "", "The metric that decides which checkpoint is best")
+	cmd.Flags().StringVar(&opts.goal, "goal", string(project.GoalMaximize), "Whether the primary metric should be maximized or minimized")
+	cmd.Flags().StringArrayVar(&opts.params, "param", []string{}, "A param of the new experiment, as name=value. Can be passed more than once, and overrides the params file")
+	cmd.Flags().StringVar(&opts.paramsFile, "params-file", "", "YAML or JSON file with the new experiment's params. Default: params.yaml in the project directory, if it exists")
+
+	return cmd
+}
+
+func save(cmd *cobra.Command, opts saveOpts, stdin io.Reader, out io.Writer) error {
+	metricsJSON, err := readMetricsFile(opts.metricsFile, stdin)
+	if err != nil {
+		return err
+	}
+	metrics, err := parseValueMapJSON(metricsJSON, "--metrics-json")
+	if err != nil {
+		return err
+	}
+	primaryMetric, err := parsePrimaryMetric(opts.primaryMetric, opts.goal)
+	if err != nil {
+		return err
+	}
+	params, err := parseParamFlags(opts.params)
+	if err != nil {
+		return err
+	}
+	if opts.experiment != "" && (len(params) > 0 || opts.paramsFile != "") {
+		return fmt.Errorf("--param and --params-file can only be used when creating a new experiment, not with --experiment")
+	}
+	proj, err := getInternalProject(cmd)
+	if err != nil {
+		return err
+	}
+
+	var exp *project.Experiment
+	if opts.experiment == "" {
+		paramsFile := opts.paramsFile
+		if paramsFile == "" {
+			if paramsFile, err = proj.DefaultParamsFile(); err != nil {
+				return err
+			}
+		}
+		// stopped as soon as it's created, because nothing sends it heartbeats
+		exp, err = proj.CreateExperiment(project.CreateExperimentArgs{
+			Params:     params,
+			ParamsFile: paramsFile,
+		}, false, nil, true)
+	} else {
+		exp, err = proj.ExperimentFromPrefix(opts.experiment)
+	}
+	if err != nil {
+		return err
+	}
+	chk, err := addCheckpoint(proj, exp, project.CreateCheckpointArgs{
+		Path:          opts.path,
+		Step:          opts.step,
+		Metrics:       metrics,
+		PrimaryMetric: primaryMetric,
+		NoStep:        !cmd.Flags().Changed("step"),
+	})
+	if err != nil {
+		return err
+	}
+	console.Info("Saved checkpoint %s in experiment %s", chk.ShortID(), exp.ShortID())
+	_, err = fmt.Fprintln(out, exp.ID)
+	return err
+}
+
+// parseParamFlags parses --param flags like "learning_rate=0.01"
+func parseParamFlags(flags []string) (param.ValueMap, error) {
+	params := param.ValueMap{}
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid --param %q: it must be name=value, like learning_rate=0.01", flag)
+		}
+		params[parts[0]] = param.ParseFromString(parts[1])
+	}
+	return params, nil
+}
+
+// readMetricsFile returns the contents of the --metrics-json file, or stdin if
+// it is "-"
+func readMetricsFile(path string, stdin io.Reader) (string, error) {
+	var data []byte
+	var err error
+	switch path {
+	case "":
+		return "", nil
+	case "-":
+		data, err = ioutil.ReadAll(stdin)
+	default:
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read metrics: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/cli/list"
+)
+
+func newSearchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "search <text>",
+		Short: "Find experiments by free text",
+		Long: `Find the experiments that contain every word of some text.
+
+Words are matched case-insensitively anywhere in an experiment's ID, command,
+user, host, params (as name=value), template, tags, and the names of the groups
+it is in. Experiments are listed like "keepsake ls", and the same flags can be
+used to filter, sort and format them.`,
+		Run:  handleErrors(searchExperiments),
+		Args: cobra.MinimumNArgs(1),
+		Example: `Find the transformer experiments that used warmup:
+$ keepsake search transformer warmup
+
+Find the running experiments that andreas started with Adam:
+$ keepsake search andreas optimizer=adam --filter "status = running"`,
+	}
+
+	addRepositoryURLFlag(cmd)
+	addListFormatFlags(cmd)
+	addListFilterFlag(cmd)
+	addListSortFlag(cmd)
+	addListPageFlags(cmd)
+
+	return cmd
+}
+
+func searchExperiments(cmd *cobra.Command, args []string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return err
+	}
+	format, all, err := parseListFormatFlags(cmd)
+	if err != nil {
+		return err
+	}
+	filters, err := parseListFilterFlag(cmd)
+	if err != nil {
+		return err
+	}
+	sortKey, err := parseListSortFlag(cmd)
+	if err != nil {
+		return err
+	}
+	page, err := parseListPageFlags(cmd)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	groups, err := proj.Groups()
+	if err != nil {
+		return err
+	}
+	search := list.NewTextSearch(strings.Join(args, " "), groups, filters)
+	return list.ProjectExperiments(proj, format, all, search, sortKey, nil, page)
+}
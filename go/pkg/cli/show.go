@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"github.com/replicate/keepsake/go/pkg/console"
 	"github.com/replicate/keepsake/go/pkg/project"
 	"github.com/replicate/keepsake/go/pkg/slices"
+	"github.com/replicate/keepsake/go/pkg/sysmetrics"
 )
 
 var timezone = time.Local
@@ -24,6 +26,9 @@ var timezone = time.Local
 type showOpts struct {
 	all           bool
 	json          bool
+	media         bool
+	watch         bool
+	interval      time.Duration
 	repositoryURL string
 }
 
@@ -41,6 +46,9 @@ func newShowCommand() *cobra.Command {
 
 	cmd.Flags().BoolVar(&opts.all, "all", false, "Show all information")
 	cmd.Flags().BoolVar(&opts.json, "json", false, "Print output in JSON format")
+	cmd.Flags().BoolVar(&opts.media, "media", false, "Download a checkpoint's files to read the dimensions of its images and the duration of its audio")
+	cmd.Flags().BoolVarP(&opts.watch, "watch", "w", false, "Keep polling the repository and redisplay when the experiment changes, until it stops")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Second, "How often to poll the repository when watching")
 	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
 
 	return cmd
@@ -56,7 +64,55 @@ func show(opts showOpts, args []string, out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	proj := project.NewProject(repo, projectDir)
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	if !opts.watch {
+		return showResult(opts, proj, prefix, out)
+	}
+
+	previous := ""
+	for {
+		buf := new(bytes.Buffer)
+		if err := showResult(opts, proj, prefix, buf); err != nil {
+			return err
+		}
+		// WriteTo empties buf, so keep a copy to compare the next poll with
+		current := buf.String()
+		if current != previous {
+			if out == os.Stdout && console.IsTTY(os.Stdout) {
+				// clear screen and move cursor to top left
+				fmt.Fprint(out, "\033[H\033[2J")
+			}
+			if _, err := buf.WriteTo(out); err != nil {
+				return err
+			}
+			previous = current
+		}
+
+		result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		state, err := proj.ExperimentState(result.Experiment.ID)
+		if err != nil {
+			return err
+		}
+		if state.IsFinished() {
+			return nil
+		}
+
+		time.Sleep(opts.interval)
+
+		proj, err = reloadProject(repo, projectDir)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func showResult(opts showOpts, proj *project.Project, prefix string, out io.Writer) error {
 	result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
 	if err != nil {
 		return err
@@ -74,13 +130,17 @@ func show(opts showOpts, args []string, out io.Writer) error {
 	}
 
 	if result.Checkpoint != nil {
-		return showCheckpoint(au, out, proj, result.Experiment, result.Checkpoint, opts.all)
+		return showCheckpoint(au, out, proj, result.Experiment, result.Checkpoint, opts.all, opts.media)
 	}
 	return showExperiment(au, out, proj, result.Experiment, opts.all)
 }
 
-func showCheckpoint(au aurora.Aurora, out io.Writer, proj *project.Project, exp *project.Experiment, com *project.Checkpoint, all bool) error {
-	experimentRunning, err := proj.ExperimentIsRunning(exp.ID)
+func showCheckpoint(au aurora.Aurora, out io.Writer, proj *project.Project, exp *project.Experiment, com *project.Checkpoint, all bool, readMedia bool) error {
+	status, err := getExperimentStatus(proj, exp)
+	if err != nil {
+		return err
+	}
+	tags, err := proj.ExperimentTags(exp.ID)
 	if err != nil {
 		return err
 	}
@@ -91,24 +151,45 @@ func showCheckpoint(au aurora.Aurora, out io.Writer, proj *project.Project, exp
 	fmt.Fprintf(w, "Created:\t%s\n", com.Created.In(timezone).Format(time.RFC1123))
 	fmt.Fprintf(w, "Path:\t%s\n", com.Path)
 	fmt.Fprintf(w, "Step:\t%d\n", com.Step)
+	upload, err := proj.CheckpointUpload(com.ID)
+	if err != nil {
+		return err
+	}
+	if upload != nil {
+		filesStatus := "incomplete (the upload was interrupted, so it can't be checked out)"
+		if status.isRunning() {
+			filesStatus = "uploading"
+		}
+		fmt.Fprintf(w, "Files:\t%s, %d of %d uploaded\n", filesStatus, len(upload.Uploaded), len(upload.Files))
+	}
 
 	fmt.Fprintf(w, "\t\n")
 	fmt.Fprintf(w, "%s\t\n", au.Bold("Experiment"))
 
 	fmt.Fprintf(w, "ID:\t%s\n", exp.ID)
 
-	writeExperimentCommon(au, w, exp, experimentRunning, all)
+	writeExperimentCommon(au, w, exp, status, tags, all)
 
 	if err := writeCheckpointMetrics(au, w, proj, com); err != nil {
 		return err
 	}
+	if err := writeCheckpointMedia(au, w, proj, com, readMedia); err != nil {
+		return err
+	}
 
 	fmt.Fprintln(w)
-	return w.Flush()
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return writeConfusionMatrices(au, out, com)
 }
 
 func showExperiment(au aurora.Aurora, out io.Writer, proj *project.Project, exp *project.Experiment, all bool) error {
-	experimentRunning, err := proj.ExperimentIsRunning(exp.ID)
+	status, err := getExperimentStatus(proj, exp)
+	if err != nil {
+		return err
+	}
+	tags, err := proj.ExperimentTags(exp.ID)
 	if err != nil {
 		return err
 	}
@@ -116,7 +197,14 @@ func showExperiment(au aurora.Aurora, out io.Writer, proj *project.Project, exp
 	fmt.Fprintf(out, "%s\n\n", au.Underline(au.Bold(fmt.Sprintf("Experiment: %s", exp.ID))))
 
 	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
-	writeExperimentCommon(au, w, exp, experimentRunning, all)
+	writeExperimentCommon(au, w, exp, status, tags, all)
+	samples, err := proj.SystemMetrics(exp)
+	if err != nil {
+		return err
+	}
+	if summary := sysmetrics.Summarize(samples); summary != nil {
+		writeSystemMetricsSummary(au, w, summary)
+	}
 	if err := w.Flush(); err != nil {
 		return err
 	}
@@ -141,11 +229,27 @@ func showExperiment(au aurora.Aurora, out io.Writer, proj *project.Project, exp
 	}
 	fmt.Fprintf(cw, "%s\n", strings.Join(headings, "\t"))
 
+	incomplete, err := proj.IncompleteCheckpoints(exp)
+	if err != nil {
+		return err
+	}
+	incompleteIDs := map[string]bool{}
+	for _, chk := range incomplete {
+		incompleteIDs[chk.ID] = true
+	}
+
 	for _, checkpoint := range exp.Checkpoints {
-		columns := []string{checkpoint.ShortID(), strconv.FormatInt(checkpoint.Step, 10), console.FormatTime(checkpoint.Created)}
+		id := checkpoint.ShortID()
+		if incompleteIDs[checkpoint.ID] {
+			id += " (incomplete)"
+		}
+		columns := []string{id, strconv.FormatInt(checkpoint.Step, 10), console.FormatTime(checkpoint.Created)}
 		for _, label := range labelNames {
-			val := checkpoint.Metrics[label]
+			val, ok := checkpoint.Metrics[label]
 			s := val.ShortString(10, 5)
+			if ok {
+				s = proj.Config().MetricConfig(label).FormatValue(val, s)
+			}
 			if bestCheckpoint != nil && bestCheckpoint.ID == checkpoint.ID && checkpoint.PrimaryMetric.Name == label {
 				// TODO (bfirsh): this could be done more elegantly with some formatting
 				s += " (best)"
@@ -161,6 +265,11 @@ func showExperiment(au aurora.Aurora, out io.Writer, proj *project.Project, exp
 	fmt.Fprintf(out, "\n")
 	fmt.Fprintf(out, "To see more details about a checkpoint, run:\n")
 	fmt.Fprintf(out, "  keepsake show <checkpoint ID>\n")
+	if len(incomplete) > 0 {
+		fmt.Fprintf(out, "\n")
+		fmt.Fprintf(out, "Some checkpoints are incomplete because their uploads were interrupted. To remove them, run:\n")
+		fmt.Fprintf(out, "  keepsake rm --incomplete %s\n", exp.ShortID())
+	}
 	return nil
 }
 
@@ -182,16 +291,64 @@ func isInterestingPythonPackage(pkg string) bool {
 	return false
 }
 
-func writeExperimentCommon(au aurora.Aurora, w *tabwriter.Writer, exp *project.Experiment, experimentRunning bool, all bool) {
-	fmt.Fprintf(w, "Created:\t%s\n", exp.Created.In(timezone).Format(time.RFC1123))
-	if experimentRunning {
-		fmt.Fprint(w, "Status:\trunning\n")
-	} else {
-		fmt.Fprint(w, "Status:\tstopped\n")
+// experimentStatus is an experiment's state, and the records that explain it
+type experimentStatus struct {
+	state       project.ExperimentState
+	preemption  *project.Preemption
+	earlyStop   *project.EarlyStop
+	stopRequest *project.StopRequest
+}
+
+func getExperimentStatus(proj *project.Project, exp *project.Experiment) (*experimentStatus, error) {
+	state, err := proj.ExperimentState(exp.ID)
+	if err != nil {
+		return nil, err
+	}
+	preemption, err := proj.ExperimentPreemption(exp.ID)
+	if err != nil {
+		return nil, err
+	}
+	earlyStop, err := proj.ExperimentEarlyStop(exp.ID)
+	if err != nil {
+		return nil, err
+	}
+	stopRequest, err := proj.ExperimentStopRequest(exp.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &experimentStatus{state: state, preemption: preemption, earlyStop: earlyStop, stopRequest: stopRequest}, nil
+}
+
+// isRunning returns true if the experiment's process is still sending
+// heartbeats
+func (s *experimentStatus) isRunning() bool {
+	return s.state == project.StateRunning || s.state == project.StateStopping
+}
+
+func (s *experimentStatus) String() string {
+	switch {
+	case s.preemption != nil:
+		return fmt.Sprintf("preempted (%s, %s)", s.preemption.Provider, s.preemption.Time.In(timezone).Format(time.RFC1123))
+	case s.earlyStop != nil:
+		return fmt.Sprintf("stopped early (%s, %s)", s.earlyStop.Reason, s.earlyStop.Time.In(timezone).Format(time.RFC1123))
+	case s.state == project.StateStopping && s.stopRequest != nil:
+		return fmt.Sprintf("stopping (asked by %s, %s)", s.stopRequest.User, s.stopRequest.Time.In(timezone).Format(time.RFC1123))
 	}
+	return string(s.state)
+}
+
+func writeExperimentCommon(au aurora.Aurora, w *tabwriter.Writer, exp *project.Experiment, status *experimentStatus, tags *project.ExperimentTags, all bool) {
+	fmt.Fprintf(w, "Created:\t%s\n", exp.Created.In(timezone).Format(time.RFC1123))
+	fmt.Fprintf(w, "Status:\t%s\n", status)
 	fmt.Fprintf(w, "Host:\t%s\n", exp.Host)
 	fmt.Fprintf(w, "User:\t%s\n", exp.User)
 	fmt.Fprintf(w, "Command:\t%s\n", exp.Command)
+	if tags != nil {
+		fmt.Fprintf(w, "Template:\t%s\n", tags.Template)
+		if len(tags.Tags) > 0 {
+			fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(tags.Tags, ", "))
+		}
+	}
 
 	fmt.Fprintf(w, "\t\n")
 	fmt.Fprintf(w, "%s\t\n", au.Bold("Params"))
@@ -246,15 +403,37 @@ func writeExperimentCommon(au aurora.Aurora, w *tabwriter.Writer, exp *project.E
 	fmt.Fprintf(w, "\t\n")
 }
 
+func writeSystemMetricsSummary(au aurora.Aurora, w *tabwriter.Writer, summary *sysmetrics.Summary) {
+	fmt.Fprintf(w, "%s\t\n", au.Bold("System metrics"))
+	fmt.Fprintf(w, "Samples:\t%d over %s\n", summary.NumSamples, summary.End.Sub(summary.Start).Round(time.Second))
+	fmt.Fprintf(w, "CPU:\t%.0f%% mean, %.0f%% max\n", summary.CPUMean, summary.CPUMax)
+	fmt.Fprintf(w, "Memory:\t%s max of %s\n", console.FormatBytes(summary.MemoryMax), console.FormatBytes(summary.MemoryTotal))
+	for _, gpu := range summary.GPUs {
+		fmt.Fprintf(w, "GPU %d:\t%.0f%% mean, %.0f%% max, %s max memory of %s\n", gpu.Index, gpu.UtilizationMean, gpu.UtilizationMax, console.FormatBytes(gpu.MemoryMax), console.FormatBytes(gpu.MemoryTotal))
+	}
+	fmt.Fprintf(w, "\t\n")
+}
+
 func writeCheckpointMetrics(au aurora.Aurora, w *tabwriter.Writer, proj *project.Project, com *project.Checkpoint) error {
 	fmt.Fprintf(w, "%s\t\n", au.Bold("Metrics"))
 	metrics := com.SortedMetrics()
 	if len(metrics) > 0 {
 		for _, lab := range metrics {
+			// Structured metrics (histograms, images, etc) are summarized rather than dumped as JSON
+			value := proj.Config().MetricConfig(lab.Name).FormatValue(lab.Value, lab.Value.Summary(5))
+			notes := []string{}
 			if com.PrimaryMetric != nil && com.PrimaryMetric.Name == lab.Name {
-				fmt.Fprintf(w, "%s:\t%s (primary, %s)\n", lab.Name, lab.Value.String(), com.PrimaryMetric.Goal)
+				notes = append(notes, "primary", string(com.PrimaryMetric.Goal))
+			} else if goal, ok := proj.MetricGoal(com, lab.Name); ok {
+				notes = append(notes, string(goal))
+			}
+			if com.IsDerivedMetric(lab.Name) {
+				notes = append(notes, "derived")
+			}
+			if len(notes) > 0 {
+				fmt.Fprintf(w, "%s:\t%s (%s)\n", lab.Name, value, strings.Join(notes, ", "))
 			} else {
-				fmt.Fprintf(w, "%s:\t%s\n", lab.Name, lab.Value.String())
+				fmt.Fprintf(w, "%s:\t%s\n", lab.Name, value)
 			}
 		}
 	} else {
@@ -262,3 +441,54 @@ func writeCheckpointMetrics(au aurora.Aurora, w *tabwriter.Writer, proj *project
 	}
 	return nil
 }
+
+// writeCheckpointMedia lists the images and audio saved with a checkpoint. If
+// readMedia is true, their dimensions and durations are read from the files.
+func writeCheckpointMedia(au aurora.Aurora, w *tabwriter.Writer, proj *project.Project, com *project.Checkpoint, readMedia bool) error {
+	media, err := proj.CheckpointMedia(com)
+	if err != nil {
+		return err
+	}
+	if len(media) == 0 {
+		return nil
+	}
+	if readMedia {
+		if err := proj.ReadMediaInfo(com, media); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "\t\n")
+	fmt.Fprintf(w, "%s\t\n", au.Bold("Media"))
+	for _, m := range media {
+		details := []string{m.Kind}
+		if m.Size > 0 {
+			details = append(details, console.FormatBytes(uint64(m.Size)))
+		}
+		if summary := m.Summary(); summary != "" {
+			details = append(details, summary)
+		}
+		fmt.Fprintf(w, "%s:\t%s\n", m.Path, strings.Join(details, ", "))
+	}
+	return nil
+}
+
+// writeConfusionMatrices writes any confusion matrix metrics in full, because
+// they're only summarized in the metrics list
+func writeConfusionMatrices(au aurora.Aurora, out io.Writer, com *project.Checkpoint) error {
+	for _, lab := range com.SortedMetrics() {
+		rows := lab.Value.ConfusionMatrixRows()
+		if rows == nil {
+			continue
+		}
+		fmt.Fprintf(out, "%s\n", au.Bold(fmt.Sprintf("Confusion matrix: %s", lab.Name)))
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\t\n", strings.Join(row, "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
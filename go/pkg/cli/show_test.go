@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/global"
 	"github.com/replicate/keepsake/go/pkg/param"
 	"github.com/replicate/keepsake/go/pkg/project"
 	"github.com/replicate/keepsake/go/pkg/repository"
@@ -133,7 +135,7 @@ func TestShowCheckpoint(t *testing.T) {
 
 	out := new(bytes.Buffer)
 	au := aurora.NewAurora(false)
-	err = showCheckpoint(au, out, proj, result.Experiment, result.Checkpoint, false)
+	err = showCheckpoint(au, out, proj, result.Experiment, result.Checkpoint, false, false)
 	require.NoError(t, err)
 	actual := out.String()
 
@@ -182,6 +184,49 @@ metric-2:  2
 	require.Equal(t, "3ccccccccc", chkpt.ID)
 }
 
+func TestShowWithProjectConfig(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	createShowTestData(t, workingDir, &config.Config{})
+	keepsakeYAML := `repository: file://` + path.Join(workingDir, ".keepsake") + `
+derived_metrics:
+  metric-total: '"metric-1" + "metric-2"'
+metrics:
+  metric-2:
+    unit: nats
+    goal: minimize
+`
+	require.NoError(t, ioutil.WriteFile(path.Join(workingDir, "keepsake.yaml"), []byte(keepsakeYAML), 0644))
+	oldProjectDirectory := global.ProjectDirectory
+	global.ProjectDirectory = workingDir
+	defer func() { global.ProjectDirectory = oldProjectDirectory }()
+
+	out := new(bytes.Buffer)
+	require.NoError(t, show(showOpts{}, []string{"3ccc"}, out))
+	require.Regexp(t, `metric-total:\s+2\.02 \(derived\)`, out.String())
+	require.Regexp(t, `metric-2:\s+2 nats \(minimize\)`, out.String())
+}
+
+func TestShowWatchOnlyRedisplaysChanges(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	repo := createShowTestData(t, workingDir, &config.Config{})
+
+	out := new(bytes.Buffer)
+	done := make(chan error)
+	go func() {
+		done <- show(showOpts{repositoryURL: "file://" + path.Join(workingDir, ".keepsake"), watch: true, interval: 10 * time.Millisecond}, []string{"1eee"}, out)
+	}()
+	// several polls where nothing changes, then one where it stops
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, project.NewProject(repo, workingDir).StopExperiment("1eeeeeeeee"))
+	require.NoError(t, <-done)
+
+	require.Equal(t, 2, strings.Count(out.String(), "Experiment: 1eeeeeeeee"))
+}
+
 func TestShowExperiment(t *testing.T) {
 	workingDir, err := ioutil.TempDir("", "keepsake-test")
 	require.NoError(t, err)
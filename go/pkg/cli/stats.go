@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type statsOpts struct {
+	json          bool
+	repositoryURL string
+}
+
+func newStatsCommand() *cobra.Command {
+	var opts statsOpts
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize the experiments in this project",
+		Long: `Summarize the experiments in this project: how many experiments and checkpoints
+there are, how much storage they use, how many experiments each person started each
+week, and how the best value of each primary metric changed week by week.
+
+Weeks start on Monday, in UTC.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return stats(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Print a summary of the project:
+$ keepsake stats
+
+Save it as JSON, e.g. to make charts for a report:
+$ keepsake stats --json > stats.json`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the summary as JSON")
+
+	return cmd
+}
+
+func stats(opts statsOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	s, err := proj.Stats()
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	return statsReport(out, s)
+}
+
+func statsReport(out io.Writer, s *project.Stats) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Experiments:\t%d\n", s.NumExperiments)
+	fmt.Fprintf(w, "Checkpoints:\t%d\n", s.NumCheckpoints)
+	fmt.Fprintf(w, "Storage:\t%s\n", console.FormatBytes(uint64(s.TotalBytes)))
+	fmt.Fprintf(w, "Storage per experiment:\t%s\n", console.FormatBytes(uint64(s.AverageExperimentBytes)))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(s.RunsByWeek) > 0 {
+		fmt.Fprintf(out, "\nExperiments per week\n")
+		w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "WEEK\tUSER\tEXPERIMENTS\n")
+		for _, runs := range s.RunsByWeek {
+			user := runs.User
+			if user == "" {
+				user = "(unknown)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\n", runs.Week.Format("2006-01-02"), user, runs.Runs)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	for _, trend := range s.MetricTrends {
+		fmt.Fprintf(out, "\nBest %s (%s) per week\n", trend.Metric, trend.Goal)
+		w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "WEEK\tBEST\tEXPERIMENT\tBEST SO FAR\n")
+		for _, week := range trend.Weeks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", week.Week.Format("2006-01-02"), formatMetric(week.Best), week.ExperimentID[:7], formatMetric(week.BestSoFar))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', 5, 64)
+}
@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// statusVersion is the version of the JSON that "keepsake status --json"
+// writes. Fields may be added without changing it, but it is incremented if a
+// field is renamed, removed or changes meaning.
+const statusVersion = 1
+
+type projectStatus struct {
+	Version    int          `json:"version"`
+	Time       time.Time    `json:"time"`
+	Repository string       `json:"repository"`
+	Running    []*runStatus `json:"running"`
+	Sync       *syncStatus  `json:"sync"`
+}
+
+type runStatus struct {
+	ExperimentID     string                  `json:"experiment_id"`
+	State            project.ExperimentState `json:"state"`
+	Created          time.Time               `json:"created"`
+	User             string                  `json:"user"`
+	Host             string                  `json:"host"`
+	Command          string                  `json:"command"`
+	LastHeartbeat    time.Time               `json:"last_heartbeat"`
+	NumCheckpoints   int                     `json:"num_checkpoints"`
+	LatestCheckpoint *project.Checkpoint     `json:"latest_checkpoint"`
+	BestCheckpoint   *project.Checkpoint     `json:"best_checkpoint"`
+}
+
+type syncStatus struct {
+	// MetadataCached is true if metadata is read from a cache in the
+	// project directory, which is synced with the repository each time the
+	// status is read
+	MetadataCached bool            `json:"metadata_cached"`
+	Uploads        []*uploadStatus `json:"uploads"`
+}
+
+// uploadStatus is a checkpoint whose files haven't all been uploaded
+type uploadStatus struct {
+	ExperimentID string    `json:"experiment_id"`
+	CheckpointID string    `json:"checkpoint_id"`
+	Started      time.Time `json:"started"`
+	Files        int       `json:"files"`
+	Uploaded     int       `json:"uploaded"`
+	// Interrupted is true if the experiment stopped before the upload
+	// finished
+	Interrupted bool `json:"interrupted"`
+}
+
+type statusOpts struct {
+	json          bool
+	watch         bool
+	interval      time.Duration
+	repositoryURL string
+}
+
+func newStatusCommand() *cobra.Command {
+	var opts statusOpts
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the running experiments and checkpoint uploads in this project",
+		Long: `Show the running experiments in this project, their latest and best
+checkpoints, and the checkpoints whose files are still being uploaded.
+
+--json writes the status as a JSON object, for editor extensions and dashboards.
+Its "version" field is incremented if a field is renamed, removed or changes
+meaning, so it is safe to rely on. With --watch, the repository is polled and a
+status is written every --interval, one JSON object per line.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return status(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Show what is running:
+$ keepsake status
+
+Stream the status as JSON lines every 10 seconds, e.g. for an editor extension:
+$ keepsake status --json --watch --interval 10s`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the status as JSON")
+	cmd.Flags().BoolVarP(&opts.watch, "watch", "w", false, "Keep polling the repository and printing the status")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Second, "How often to poll the repository when watching")
+
+	return cmd
+}
+
+func status(opts statusOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+
+	for {
+		s, err := getProjectStatus(proj, repo, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			// one object per line when watching, so it can be read as a stream
+			enc := json.NewEncoder(out)
+			if !opts.watch {
+				enc.SetIndent("", "  ")
+			}
+			if err := enc.Encode(s); err != nil {
+				return err
+			}
+		} else {
+			if err := writeStatus(out, s); err != nil {
+				return err
+			}
+		}
+
+		if !opts.watch {
+			return nil
+		}
+		time.Sleep(opts.interval)
+		proj, err = reloadProject(repo, projectDir)
+		if err != nil {
+			return err
+		}
+		if !opts.json {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+func getProjectStatus(proj *project.Project, repo repository.Repository, now time.Time) (*projectStatus, error) {
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(experiments, func(i, j int) bool {
+		return experiments[i].Created.Before(experiments[j].Created)
+	})
+
+	s := &projectStatus{
+		Version:    statusVersion,
+		Time:       now,
+		Repository: repo.RootURL(),
+		Running:    []*runStatus{},
+		Sync: &syncStatus{
+			MetadataCached: repository.FindCachedRepository(repo) != nil,
+			Uploads:        []*uploadStatus{},
+		},
+	}
+	for _, exp := range experiments {
+		state, err := proj.ExperimentState(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		running := state == project.StateRunning || state == project.StateStopping
+		if running {
+			heartbeat, err := proj.ExperimentHeartbeat(exp.ID)
+			if err != nil {
+				return nil, err
+			}
+			s.Running = append(s.Running, &runStatus{
+				ExperimentID:     exp.ID,
+				State:            state,
+				Created:          exp.Created,
+				User:             exp.User,
+				Host:             exp.Host,
+				Command:          exp.Command,
+				LastHeartbeat:    heartbeat.LastHeartbeat,
+				NumCheckpoints:   len(exp.Checkpoints),
+				LatestCheckpoint: exp.LatestCheckpoint(),
+				BestCheckpoint:   exp.BestCheckpoint(),
+			})
+		}
+		for _, chk := range exp.Checkpoints {
+			upload, err := proj.CheckpointUpload(chk.ID)
+			if err != nil {
+				return nil, err
+			}
+			if upload == nil {
+				continue
+			}
+			s.Sync.Uploads = append(s.Sync.Uploads, &uploadStatus{
+				ExperimentID: exp.ID,
+				CheckpointID: chk.ID,
+				Started:      upload.Started,
+				Files:        len(upload.Files),
+				Uploaded:     len(upload.Uploaded),
+				Interrupted:  !running,
+			})
+		}
+	}
+	return s, nil
+}
+
+func writeStatus(out io.Writer, s *projectStatus) error {
+	fmt.Fprintf(out, "Repository: %s\n\n", s.Repository)
+
+	if len(s.Running) == 0 {
+		fmt.Fprintln(out, "No experiments are running.")
+	} else {
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "RUNNING\tSTATE\tSTARTED\tUSER\tHOST\tLATEST CHECKPOINT\tBEST CHECKPOINT")
+		for _, run := range s.Running {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", run.ExperimentID[:7], run.State, console.FormatTime(run.Created), run.User, run.Host, formatStatusCheckpoint(run.LatestCheckpoint), formatStatusCheckpoint(run.BestCheckpoint))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Sync.Uploads) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "UPLOADING\tEXPERIMENT\tSTARTED\tFILES")
+		for _, upload := range s.Sync.Uploads {
+			files := fmt.Sprintf("%d/%d", upload.Uploaded, upload.Files)
+			if upload.Interrupted {
+				files += " (interrupted)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", upload.CheckpointID[:7], upload.ExperimentID[:7], console.FormatTime(upload.Started), files)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatStatusCheckpoint(chk *project.Checkpoint) string {
+	if chk == nil {
+		return ""
+	}
+	parts := []string{fmt.Sprintf("%s (step %d)", chk.ShortID(), chk.Step)}
+	if chk.PrimaryMetric != nil {
+		if value, ok := chk.Metrics[chk.PrimaryMetric.Name]; ok {
+			parts = append(parts, chk.PrimaryMetric.Name+"="+value.ShortString(10, 5))
+		}
+	}
+	return strings.Join(parts, " ")
+}
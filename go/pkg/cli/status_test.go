@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func TestStatus(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo := createShowTestData(t, workingDir, &config.Config{})
+	upload := &project.Upload{CheckpointID: "4ccccccccc", Files: []string{"a", "b"}, Uploaded: []string{"a"}}
+	data, err := json.Marshal(upload)
+	require.NoError(t, err)
+	require.NoError(t, repo.Put("metadata/uploads/checkpoints/4ccccccccc.json", data))
+	repositoryURL := "file://" + path.Join(workingDir, ".keepsake")
+
+	out := new(bytes.Buffer)
+	require.NoError(t, status(statusOpts{repositoryURL: repositoryURL, json: true}, out))
+	s := new(projectStatus)
+	require.NoError(t, json.Unmarshal(out.Bytes(), s))
+	require.Equal(t, statusVersion, s.Version)
+	require.Len(t, s.Running, 1)
+	require.Equal(t, "1eeeeeeeee", s.Running[0].ExperimentID)
+	require.Equal(t, 3, s.Running[0].NumCheckpoints)
+	require.Equal(t, "3ccccccccc", s.Running[0].LatestCheckpoint.ID)
+	require.Equal(t, "2ccccccccc", s.Running[0].BestCheckpoint.ID)
+	require.False(t, s.Sync.MetadataCached)
+	require.Equal(t, []*uploadStatus{{
+		ExperimentID: "2eeeeeeeee",
+		CheckpointID: "4ccccccccc",
+		Started:      s.Sync.Uploads[0].Started,
+		Files:        2,
+		Uploaded:     1,
+		Interrupted:  true,
+	}}, s.Sync.Uploads)
+
+	out = new(bytes.Buffer)
+	require.NoError(t, status(statusOpts{repositoryURL: repositoryURL}, out))
+	actual := out.String()
+	require.Contains(t, actual, "1eeeeee")
+	require.Contains(t, actual, "3cccccc (step 20) metric-1=0.02")
+	require.Contains(t, actual, "2cccccc (step 20) metric-1=0.01")
+	require.Contains(t, actual, "4cccccc    2eeeeee")
+	require.Contains(t, actual, "1/2 (interrupted)")
+}
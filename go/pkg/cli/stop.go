@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type stopOpts struct {
+	repositoryURL string
+}
+
+func newStopCommand() *cobra.Command {
+	var opts stopOpts
+
+	cmd := &cobra.Command{
+		Use:   "stop <experiment ID> [experiment ID...]",
+		Short: "Stop running experiments",
+		Long: `Stop running experiments, from any machine that can read the repository.
+
+The process running the experiment checks whether it has been asked to stop each
+time it sends a heartbeat, which is every 5 seconds. It then finishes uploading
+the checkpoints it has saved, and exits. The experiment is "stopping" until it
+has exited, and "stopped" after.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return stop(opts, args, os.Stdout)
+		}),
+		Args: cobra.MinimumNArgs(1),
+		Example: `Stop an experiment (where a1b2c3d4 is an experiment ID):
+$ keepsake stop a1b2c3d4
+
+Stop every running experiment:
+$ keepsake stop $(keepsake ps -q)`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func stop(opts stopOpts, prefixes []string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+
+	// resolve every experiment first, so a typo doesn't stop some of them
+	experiments := []*project.Experiment{}
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		state, err := proj.ExperimentState(exp.ID)
+		if err != nil {
+			return err
+		}
+		if state != project.StateRunning && state != project.StateCreated {
+			return fmt.Errorf("Experiment %s isn't running, it is %s", exp.ShortID(), state)
+		}
+		experiments = append(experiments, exp)
+	}
+
+	username := ""
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	for _, exp := range experiments {
+		if global.DryRun {
+			console.Info("Would ask experiment %s to stop", exp.ShortID())
+			continue
+		}
+		if err := proj.RequestStop(exp.ID, username); err != nil {
+			return fmt.Errorf("Failed to ask experiment %s to stop: %w", exp.ShortID(), err)
+		}
+		fmt.Fprintf(out, "Asked experiment %s to stop. It will stop the next time it sends a heartbeat, within about 5 seconds.\n", exp.ShortID())
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func TestStop(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo := createShowTestData(t, workingDir, &config.Config{})
+	opts := stopOpts{repositoryURL: "file://" + path.Join(workingDir, ".keepsake")}
+
+	out := new(bytes.Buffer)
+	err = stop(opts, []string{"1ee", "2ee"}, out)
+	require.EqualError(t, err, "Experiment 2eeeeee isn't running, it is stopped")
+	require.Empty(t, out.String())
+
+	require.NoError(t, stop(opts, []string{"1ee"}, out))
+	require.Contains(t, out.String(), "Asked experiment 1eeeeee to stop")
+
+	proj := project.NewProject(repo, workingDir)
+	state, err := proj.ExperimentState("1eeeeeeeee")
+	require.NoError(t, err)
+	require.Equal(t, project.StateStopping, state)
+
+	err = stop(opts, []string{"1ee"}, out)
+	require.EqualError(t, err, "Experiment 1eeeeee isn't running, it is stopping")
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/cli/tui"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type tuiOpts struct {
+	repositoryURL string
+}
+
+func newTUICommand() *cobra.Command {
+	var opts tuiOpts
+
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Browse experiments in an interactive terminal UI",
+		Long: `Browse experiments in an interactive terminal UI, with a list of experiments, the
+details of the selected one, and a sparkline of its primary metric.
+
+Keys:
+  ↑/↓ or k/j      Move up and down
+  PgUp/PgDn       Move a page up and down
+  /               Filter by ID, user, host, command, status, or param (e.g. lr=0.01)
+  Esc             Clear the filter
+  Enter or c      Quit and check out the selected experiment's files
+  d               Delete the selected experiment and its checkpoints
+  r               Reload the experiments
+  q               Quit`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return runTUI(opts)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func runTUI(opts tuiOpts) error {
+	if !console.IsTerminal() {
+		return fmt.Errorf("keepsake tui must be run in a terminal")
+	}
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+	items, err := tuiItems(proj)
+	if err != nil {
+		return err
+	}
+	model := tui.New(items)
+	reload := func() error {
+		if proj, err = reloadProject(repo, projectDir); err != nil {
+			return err
+		}
+		items, err := tuiItems(proj)
+		if err != nil {
+			return err
+		}
+		model.SetItems(items)
+		return nil
+	}
+
+	screen, err := tui.OpenScreen(os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			_ = screen.Close()
+		}
+	}()
+
+	for {
+		action, err := screen.NextAction(model)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case tui.ActionQuit:
+			return nil
+		case tui.ActionCheckout:
+			closed = true
+			if err := screen.Close(); err != nil {
+				return err
+			}
+			return checkoutCheckpoint(checkoutOpts{repositoryURL: opts.repositoryURL}, []string{model.Selected().Experiment.ID})
+		case tui.ActionDelete:
+			exp := model.Selected().Experiment
+			if err := removeExperiment(proj, exp); err != nil {
+				model.Message = fmt.Sprintf("Failed to delete experiment %s: %s", exp.ShortID(), err)
+				continue
+			}
+			if global.DryRun {
+				model.Message = fmt.Sprintf("Would delete experiment %s", exp.ShortID())
+				continue
+			}
+			if err := reload(); err != nil {
+				return err
+			}
+			model.Message = fmt.Sprintf("Deleted experiment %s", exp.ShortID())
+		case tui.ActionReload:
+			if err := reload(); err != nil {
+				return err
+			}
+			model.Message = "Reloaded."
+		}
+	}
+}
+
+// tuiItems returns the experiments in proj, with their statuses
+func tuiItems(proj *project.Project) ([]*tui.Item, error) {
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	items := []*tui.Item{}
+	for _, exp := range experiments {
+		state, err := proj.ExperimentState(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &tui.Item{Experiment: exp, Status: string(state)})
+	}
+	return items, nil
+}
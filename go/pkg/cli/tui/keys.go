@@ -0,0 +1,92 @@
+package tui
+
+import (
+	"bufio"
+)
+
+// Key is a key that was pressed. Printable characters are the character
+// itself, e.g. "q", and other keys are one of the constants below.
+type Key string
+
+const (
+	KeyUp        Key = "up"
+	KeyDown      Key = "down"
+	KeyPageUp    Key = "pgup"
+	KeyPageDown  Key = "pgdn"
+	KeyHome      Key = "home"
+	KeyEnd       Key = "end"
+	KeyEnter     Key = "enter"
+	KeyEscape    Key = "esc"
+	KeyBackspace Key = "backspace"
+	KeyCtrlC     Key = "ctrl-c"
+	// KeyUnknown is an escape sequence that isn't understood
+	KeyUnknown Key = ""
+)
+
+// ReadKey reads a key from a terminal in raw mode
+func ReadKey(r *bufio.Reader) (Key, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return KeyUnknown, err
+	}
+	switch c {
+	case '\x1b':
+		// a lone escape, rather than the start of an escape sequence
+		if r.Buffered() == 0 {
+			return KeyEscape, nil
+		}
+		return readEscapeSequence(r)
+	case '\r', '\n':
+		return KeyEnter, nil
+	case '\x7f', '\b':
+		return KeyBackspace, nil
+	case '\x03':
+		return KeyCtrlC, nil
+	}
+	return Key(string(c)), nil
+}
+
+// readEscapeSequence reads the rest of an escape sequence like "\x1b[A" (up)
+// or "\x1b[5~" (page up)
+func readEscapeSequence(r *bufio.Reader) (Key, error) {
+	introducer, err := r.ReadByte()
+	if err != nil {
+		return KeyUnknown, err
+	}
+	if introducer != '[' && introducer != 'O' {
+		return KeyUnknown, nil
+	}
+	params := []byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return KeyUnknown, err
+		}
+		if b >= '0' && b <= '9' || b == ';' {
+			params = append(params, b)
+			continue
+		}
+		switch b {
+		case 'A':
+			return KeyUp, nil
+		case 'B':
+			return KeyDown, nil
+		case 'H':
+			return KeyHome, nil
+		case 'F':
+			return KeyEnd, nil
+		case '~':
+			switch string(params) {
+			case "1", "7":
+				return KeyHome, nil
+			case "4", "8":
+				return KeyEnd, nil
+			case "5":
+				return KeyPageUp, nil
+			case "6":
+				return KeyPageDown, nil
+			}
+		}
+		return KeyUnknown, nil
+	}
+}
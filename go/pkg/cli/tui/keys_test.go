@@ -0,0 +1,22 @@
+package tui
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKey(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("j\x1b[A\x1b[B\x1bOA\x1b[5~\x1b[6~\x1b[H\x1b[4~\r\x7f\x03/é"))
+	for _, expected := range []Key{"j", KeyUp, KeyDown, KeyUp, KeyPageUp, KeyPageDown, KeyHome, KeyEnd, KeyEnter, KeyBackspace, KeyCtrlC, "/", "é"} {
+		key, err := ReadKey(r)
+		require.NoError(t, err)
+		require.Equal(t, expected, key)
+	}
+
+	key, err := ReadKey(bufio.NewReader(strings.NewReader("\x1b")))
+	require.NoError(t, err)
+	require.Equal(t, KeyEscape, key)
+}
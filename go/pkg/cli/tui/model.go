@@ -0,0 +1,201 @@
+// Package tui is an interactive terminal UI for browsing experiments, with a
+// list of experiments, the details of the selected one, and a sparkline of
+// its primary metric
+package tui
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+// Item is an experiment in the list
+type Item struct {
+	Experiment *project.Experiment
+	// Status is e.g. "running" or "stopped"
+	Status string
+}
+
+// Action is what the caller of HandleKey should do in response to a key
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionQuit
+	// ActionCheckout checks out the selected experiment
+	ActionCheckout
+	// ActionDelete deletes the selected experiment. The user has already
+	// confirmed it.
+	ActionDelete
+	// ActionReload loads the experiments again
+	ActionReload
+)
+
+// Model is the state of the UI
+type Model struct {
+	// items are all the experiments, newest first
+	items []*Item
+	// visible are the items that match the filter
+	visible  []*Item
+	selected int
+	// scroll is the index of the first visible item in the list pane
+	scroll int
+	// pageSize is the height of the list pane, set when it is rendered
+	pageSize int
+
+	filter           string
+	editingFilter    bool
+	confirmingDelete bool
+
+	// Message is shown at the bottom of the screen until the next key is
+	// pressed, e.g. the result of an action
+	Message string
+}
+
+// New returns a model that lists items
+func New(items []*Item) *Model {
+	m := &Model{pageSize: 10}
+	m.SetItems(items)
+	return m
+}
+
+// SetItems replaces the experiments, keeping the same experiment selected if
+// it is still there
+func (m *Model) SetItems(items []*Item) {
+	var selectedID string
+	if item := m.Selected(); item != nil {
+		selectedID = item.Experiment.ID
+	}
+	m.items = make([]*Item, len(items))
+	copy(m.items, items)
+	sort.SliceStable(m.items, func(i, j int) bool {
+		return m.items[i].Experiment.Created.After(m.items[j].Experiment.Created)
+	})
+	m.applyFilter()
+	for i, item := range m.visible {
+		if item.Experiment.ID == selectedID {
+			m.selected = i
+		}
+	}
+}
+
+// Selected returns the selected experiment, or nil if there isn't one
+func (m *Model) Selected() *Item {
+	if m.selected < 0 || m.selected >= len(m.visible) {
+		return nil
+	}
+	return m.visible[m.selected]
+}
+
+// HandleKey updates the model for a key press, and returns what the caller
+// should do about it
+func (m *Model) HandleKey(key Key) Action {
+	m.Message = ""
+	if m.editingFilter {
+		m.handleFilterKey(key)
+		return ActionNone
+	}
+	if m.confirmingDelete {
+		m.confirmingDelete = false
+		if key == "y" || key == "Y" {
+			return ActionDelete
+		}
+		m.Message = "Not deleted."
+		return ActionNone
+	}
+
+	switch key {
+	case "q", KeyCtrlC:
+		return ActionQuit
+	case KeyUp, "k":
+		m.move(-1)
+	case KeyDown, "j":
+		m.move(1)
+	case KeyPageUp:
+		m.move(-m.pageSize)
+	case KeyPageDown, " ":
+		m.move(m.pageSize)
+	case KeyHome, "g":
+		m.move(-len(m.visible))
+	case KeyEnd, "G":
+		m.move(len(m.visible))
+	case "/":
+		m.editingFilter = true
+	case KeyEscape:
+		m.filter = ""
+		m.applyFilter()
+	case "c", KeyEnter:
+		if m.Selected() != nil {
+			return ActionCheckout
+		}
+	case "d":
+		if item := m.Selected(); item != nil {
+			m.confirmingDelete = true
+		}
+	case "r":
+		return ActionReload
+	}
+	return ActionNone
+}
+
+func (m *Model) handleFilterKey(key Key) {
+	switch key {
+	case KeyEnter:
+		m.editingFilter = false
+		return
+	case KeyEscape, KeyCtrlC:
+		m.editingFilter = false
+		m.filter = ""
+	case KeyBackspace:
+		if runes := []rune(m.filter); len(runes) > 0 {
+			m.filter = string(runes[:len(runes)-1])
+		}
+	default:
+		// ignore keys that aren't characters, like arrows
+		if len([]rune(string(key))) == 1 {
+			m.filter += string(key)
+		}
+	}
+	m.applyFilter()
+}
+
+func (m *Model) move(delta int) {
+	m.selected += delta
+	if m.selected >= len(m.visible) {
+		m.selected = len(m.visible) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+}
+
+func (m *Model) applyFilter() {
+	m.visible = []*Item{}
+	for _, item := range m.items {
+		if matchesFilter(item, m.filter) {
+			m.visible = append(m.visible, item)
+		}
+	}
+	m.move(0)
+}
+
+// matchesFilter returns true if filter is part of the experiment's ID, user,
+// host, command, status, or one of its params as "name=value", ignoring case
+func matchesFilter(item *Item, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	filter = strings.ToLower(filter)
+	exp := item.Experiment
+	fields := []string{exp.ID, exp.User, exp.Host, exp.Command, item.Status}
+	for _, p := range exp.SortedParams() {
+		fields = append(fields, p.Name+"="+p.Value.String())
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), filter) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+func testItems() []*Item {
+	created := time.Now().UTC()
+	primaryMetric := &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}
+	return []*Item{{
+		Experiment: &project.Experiment{
+			ID:      "1eeeeeeeee",
+			Created: created.Add(-2 * time.Hour),
+			User:    "andreas",
+			Params:  param.ValueMap{"lr": param.Float(0.01)},
+			Checkpoints: []*project.Checkpoint{
+				{ID: "1ccccccccc", Step: 1, Metrics: param.ValueMap{"loss": param.Float(0.5)}, PrimaryMetric: primaryMetric},
+				{ID: "2ccccccccc", Step: 2, Metrics: param.ValueMap{"loss": param.Float(0.3)}, PrimaryMetric: primaryMetric},
+				{ID: "3ccccccccc", Step: 3, Metrics: param.ValueMap{"loss": param.Float(0.1)}, PrimaryMetric: primaryMetric},
+			},
+		},
+		Status: "stopped",
+	}, {
+		Experiment: &project.Experiment{
+			ID:      "2eeeeeeeee",
+			Created: created.Add(-1 * time.Hour),
+			User:    "ben",
+			Params:  param.ValueMap{"lr": param.Float(0.1)},
+		},
+		Status: "running",
+	}}
+}
+
+func TestModelNavigation(t *testing.T) {
+	m := New(testItems())
+	// newest first
+	require.Equal(t, "2eeeeeeeee", m.Selected().Experiment.ID)
+	require.Equal(t, ActionNone, m.HandleKey(KeyDown))
+	require.Equal(t, "1eeeeeeeee", m.Selected().Experiment.ID)
+	m.HandleKey(KeyDown)
+	require.Equal(t, "1eeeeeeeee", m.Selected().Experiment.ID)
+	m.HandleKey("k")
+	require.Equal(t, "2eeeeeeeee", m.Selected().Experiment.ID)
+	m.HandleKey(KeyEnd)
+	require.Equal(t, "1eeeeeeeee", m.Selected().Experiment.ID)
+
+	require.Equal(t, ActionCheckout, m.HandleKey(KeyEnter))
+	require.Equal(t, ActionReload, m.HandleKey("r"))
+	require.Equal(t, ActionQuit, m.HandleKey("q"))
+}
+
+func TestModelFilter(t *testing.T) {
+	m := New(testItems())
+	for _, key := range []Key{"/", "l", "r", "=", "0", ".", "1", KeyBackspace, "1", KeyEnter} {
+		require.Equal(t, ActionNone, m.HandleKey(key))
+	}
+	require.Equal(t, "lr=0.1", m.filter)
+	require.Len(t, m.visible, 1)
+	require.Equal(t, "2eeeeeeeee", m.Selected().Experiment.ID)
+
+	// keys do things again once the filter is entered
+	require.Equal(t, ActionQuit, m.HandleKey("q"))
+
+	m.HandleKey(KeyEscape)
+	require.Len(t, m.visible, 2)
+
+	m.HandleKey("/")
+	m.HandleKey("x")
+	m.HandleKey("y")
+	require.Len(t, m.visible, 0)
+	require.Nil(t, m.Selected())
+	m.HandleKey(KeyEnter)
+	require.Equal(t, ActionNone, m.HandleKey("d"))
+	require.Equal(t, ActionNone, m.HandleKey(KeyEnter))
+}
+
+func TestModelDelete(t *testing.T) {
+	m := New(testItems())
+	require.Equal(t, ActionNone, m.HandleKey("d"))
+	require.Contains(t, strings.Join(m.Render(100, 20), "\n"), "Delete experiment 2eeeeee and its 0 checkpoints? (y/n)")
+	require.Equal(t, ActionNone, m.HandleKey("n"))
+	require.Equal(t, "Not deleted.", m.Message)
+
+	m.HandleKey("d")
+	require.Equal(t, ActionDelete, m.HandleKey("y"))
+
+	// the selection stays on the same experiment when they are reloaded
+	m.HandleKey(KeyDown)
+	m.SetItems(testItems())
+	require.Equal(t, "1eeeeeeeee", m.Selected().Experiment.ID)
+	m.SetItems(testItems()[1:])
+	require.Equal(t, "2eeeeeeeee", m.Selected().Experiment.ID)
+}
+
+func TestRender(t *testing.T) {
+	m := New(testItems())
+	m.HandleKey(KeyDown)
+	lines := m.Render(100, 24)
+	require.Len(t, lines, 24)
+	require.Equal(t, "Keepsake experiments (2)", strings.TrimSpace(lines[0]))
+	require.True(t, strings.HasPrefix(lines[1], "2eeeeee  about an hour ago"))
+	require.True(t, strings.HasPrefix(lines[2], reverseVideo+"1eeeeee  2 hours ago"))
+	require.Equal(t, helpText, strings.TrimSpace(lines[23]))
+
+	screen := strings.Join(lines, "\n")
+	require.Contains(t, screen, "Experiment 1eeeeeeeee")
+	require.Contains(t, screen, "  lr: 0.01")
+	require.Contains(t, screen, "Checkpoints: 3")
+	require.Contains(t, screen, "Best:     3cccccc (step 3) loss=0.1")
+	require.Contains(t, screen, "loss █▄▁")
+	require.Contains(t, screen, "0.1 to 0.5")
+
+	// lines are never wider than the screen
+	for _, line := range m.Render(50, 10) {
+		require.LessOrEqual(t, len([]rune(strings.NewReplacer(reverseVideo, "", resetStyle, "").Replace(line))), 50)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	require.Equal(t, "▁▂▃▄▅▆▇█", Sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}, 10))
+	// only the latest values fit
+	require.Equal(t, "▁▄█", Sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}, 3))
+	require.Equal(t, "██", Sparkline([]float64{1, 1}, 10))
+	require.Equal(t, "", Sparkline(nil, 10))
+}
@@ -0,0 +1,235 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+const (
+	reverseVideo = "\x1b[7m"
+	resetStyle   = "\x1b[0m"
+	separator    = " │ "
+	helpText     = "↑/↓ move  / filter  enter/c checkout  d delete  r reload  q quit"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Render returns the screen as lines of text that are width columns wide
+func (m *Model) Render(width int, height int) []string {
+	if height < 3 {
+		height = 3
+	}
+	bodyHeight := height - 2
+	m.pageSize = bodyHeight
+	if m.selected < m.scroll {
+		m.scroll = m.selected
+	}
+	if m.selected >= m.scroll+bodyHeight {
+		m.scroll = m.selected - bodyHeight + 1
+	}
+
+	listWidth := width * 2 / 5
+	if listWidth < 36 {
+		listWidth = 36
+	}
+	if listWidth > width {
+		listWidth = width
+	}
+	detailWidth := width - listWidth - len([]rune(separator))
+
+	var detailLines []string
+	if item := m.Selected(); item != nil && detailWidth > 0 {
+		detailLines = details(item, detailWidth)
+	}
+
+	header := fmt.Sprintf("Keepsake experiments (%d", len(m.visible))
+	if len(m.visible) != len(m.items) {
+		header += fmt.Sprintf(" of %d", len(m.items))
+	}
+	header += ")"
+	if m.filter != "" && !m.editingFilter {
+		header += fmt.Sprintf(", filtered by %q", m.filter)
+	}
+	lines := []string{fit(header, width)}
+
+	for i := 0; i < bodyHeight; i++ {
+		row := fit("", listWidth)
+		index := m.scroll + i
+		if index < len(m.visible) {
+			row = fit(listRow(m.visible[index]), listWidth)
+			if index == m.selected {
+				row = reverseVideo + row + resetStyle
+			}
+		} else if i == 0 && len(m.visible) == 0 {
+			row = fit("No experiments.", listWidth)
+		}
+		if detailWidth > 0 {
+			detail := ""
+			if i < len(detailLines) {
+				detail = detailLines[i]
+			}
+			row += separator + fit(detail, detailWidth)
+		}
+		lines = append(lines, row)
+	}
+
+	footer := helpText
+	switch {
+	case m.editingFilter:
+		footer = "/" + m.filter + "█"
+	case m.confirmingDelete:
+		item := m.Selected()
+		footer = fmt.Sprintf("Delete experiment %s and its %d checkpoints? (y/n)", item.Experiment.ShortID(), len(item.Experiment.Checkpoints))
+	case m.Message != "":
+		footer = m.Message
+	}
+	lines = append(lines, fit(footer, width))
+	return lines
+}
+
+func listRow(item *Item) string {
+	exp := item.Experiment
+	return fmt.Sprintf("%s  %-18s  %-8s  %s", exp.ShortID(), console.FormatTime(exp.Created), item.Status, exp.User)
+}
+
+// details returns the lines describing the selected experiment
+func details(item *Item, width int) []string {
+	exp := item.Experiment
+	lines := []string{
+		"Experiment " + exp.ID,
+		"",
+		"Created:  " + exp.Created.Local().Format(time.RFC1123),
+		"Status:   " + item.Status,
+		"User:     " + exp.User,
+		"Host:     " + exp.Host,
+		"Command:  " + exp.Command,
+	}
+
+	if params := exp.SortedParams(); len(params) > 0 {
+		lines = append(lines, "", "Params")
+		for _, p := range params {
+			lines = append(lines, "  "+p.Name+": "+p.Value.ShortString(width, 5))
+		}
+	}
+
+	lines = append(lines, "", fmt.Sprintf("Checkpoints: %d", len(exp.Checkpoints)))
+	chk := exp.BestCheckpoint()
+	label := "Best:    "
+	if chk == nil {
+		chk = exp.LatestCheckpoint()
+		label = "Latest:  "
+	}
+	if chk != nil {
+		metrics := []string{}
+		for _, m := range chk.SortedMetrics() {
+			metrics = append(metrics, m.Name+"="+m.Value.ShortString(10, 5))
+		}
+		lines = append(lines, fmt.Sprintf("%s %s (step %d) %s", label, chk.ShortID(), chk.Step, strings.Join(metrics, " ")))
+	}
+
+	metric := sparklineMetric(exp)
+	if values := metricValues(exp, metric); len(values) > 0 {
+		min, max := minMax(values)
+		prefix := metric + " "
+		sparkWidth := width - len([]rune(prefix))
+		lines = append(lines, "", prefix+Sparkline(values, sparkWidth), fmt.Sprintf("%s %s to %s", strings.Repeat(" ", len([]rune(metric))), formatFloat(min), formatFloat(max)))
+	}
+	return lines
+}
+
+// sparklineMetric returns the metric to draw a sparkline of: the primary
+// metric, or the first metric with numbers if there isn't one
+func sparklineMetric(exp *project.Experiment) string {
+	names := map[string]bool{}
+	for _, chk := range exp.Checkpoints {
+		if chk.PrimaryMetric != nil {
+			return chk.PrimaryMetric.Name
+		}
+		for name := range chk.Metrics {
+			if _, ok := chk.MetricValue(name); ok {
+				names[name] = true
+			}
+		}
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	if len(sorted) == 0 {
+		return ""
+	}
+	return sorted[0]
+}
+
+// metricValues returns the values of metric in exp's checkpoints, in order
+// of step
+func metricValues(exp *project.Experiment, metric string) []float64 {
+	checkpoints := make([]*project.Checkpoint, len(exp.Checkpoints))
+	copy(checkpoints, exp.Checkpoints)
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Step < checkpoints[j].Step
+	})
+	values := []float64{}
+	for _, chk := range checkpoints {
+		if value, ok := chk.MetricValue(metric); ok && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Sparkline draws values as a line of block characters, using the latest
+// width values if there are more than that
+func Sparkline(values []float64, width int) string {
+	if width <= 0 || len(values) == 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	min, max := minMax(values)
+	var b strings.Builder
+	for _, v := range values {
+		level := len(sparkBlocks) - 1
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
+
+func minMax(values []float64) (min float64, max float64) {
+	for i, v := range values {
+		if i == 0 || v < min {
+			min = v
+		}
+		if i == 0 || v > max {
+			max = v
+		}
+	}
+	return min, max
+}
+
+func formatFloat(f float64) string {
+	return fmt.Sprintf("%.5g", f)
+}
+
+// fit truncates or pads s to exactly width characters, on one line
+func fit(s string, width int) string {
+	runes := []rune(strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(s))
+	if len(runes) > width {
+		if width > 1 {
+			return string(runes[:width-1]) + "…"
+		}
+		return string(runes[:width])
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
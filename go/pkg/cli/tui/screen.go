@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/moby/term"
+)
+
+const (
+	enterAlternateScreen = "\x1b[?1049h"
+	exitAlternateScreen  = "\x1b[?1049l"
+	hideCursor           = "\x1b[?25l"
+	showCursor           = "\x1b[?25h"
+	clearScreen          = "\x1b[H\x1b[2J"
+)
+
+// Screen is a terminal in raw mode, showing the UI on the alternate screen so
+// the terminal is left as it was when it is closed
+type Screen struct {
+	in      *os.File
+	out     *os.File
+	reader  *bufio.Reader
+	state   *term.State
+	resizes chan os.Signal
+
+	// mu protects model, which is drawn again when the terminal is resized
+	mu    sync.Mutex
+	model *Model
+}
+
+// OpenScreen puts the terminal into raw mode and switches to the alternate
+// screen. Close must be called to restore it.
+func OpenScreen(in *os.File, out *os.File) (*Screen, error) {
+	state, err := term.SetRawTerminal(in.Fd())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set up the terminal: %w", err)
+	}
+	s := &Screen{
+		in:      in,
+		out:     out,
+		reader:  bufio.NewReader(in),
+		state:   state,
+		resizes: make(chan os.Signal, 1),
+	}
+	signal.Notify(s.resizes, syscall.SIGWINCH)
+	go func() {
+		for range s.resizes {
+			s.mu.Lock()
+			s.draw()
+			s.mu.Unlock()
+		}
+	}()
+	fmt.Fprint(out, enterAlternateScreen+hideCursor)
+	return s, nil
+}
+
+// NextAction shows m, and handles keys until one needs the caller to do
+// something
+func (s *Screen) NextAction(m *Model) (Action, error) {
+	s.mu.Lock()
+	s.model = m
+	s.draw()
+	s.mu.Unlock()
+	for {
+		key, err := ReadKey(s.reader)
+		if err == io.EOF {
+			return ActionQuit, nil
+		}
+		if err != nil {
+			return ActionNone, err
+		}
+		s.mu.Lock()
+		action := m.HandleKey(key)
+		if action == ActionNone {
+			s.draw()
+		}
+		s.mu.Unlock()
+		if action != ActionNone {
+			return action, nil
+		}
+	}
+}
+
+// draw must be called with mu held
+func (s *Screen) draw() {
+	if s.model == nil {
+		return
+	}
+	width, height := s.size()
+	// raw mode doesn't turn "\n" into "\r\n"
+	fmt.Fprint(s.out, clearScreen+strings.Join(s.model.Render(width, height), "\r\n"))
+}
+
+func (s *Screen) size() (width int, height int) {
+	ws, err := term.GetWinsize(s.out.Fd())
+	if err != nil || ws.Width == 0 || ws.Height == 0 {
+		return 80, 24
+	}
+	return int(ws.Width), int(ws.Height)
+}
+
+// Close restores the terminal
+func (s *Screen) Close() error {
+	signal.Stop(s.resizes)
+	close(s.resizes)
+	fmt.Fprint(s.out, showCursor+exitAlternateScreen)
+	return term.RestoreTerminal(s.in.Fd(), s.state)
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	goerrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/update"
+	"github.com/replicate/keepsake/go/pkg/version"
+)
+
+type updateOpts struct {
+	check bool
+	force bool
+}
+
+func newUpdateCommand() *cobra.Command {
+	var opts updateOpts
+
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update Keepsake to the latest version",
+		Long: `Update Keepsake to the latest version.
+
+This downloads the latest release for your platform, checks it hasn't been corrupted
+or tampered with, then replaces the keepsake binary with it. It won't install a release
+that is older than the version you have, unless you pass --force.
+
+If you installed Keepsake with pip, run "pip install -U keepsake" instead.`,
+		Run:  handleErrors(func(cmd *cobra.Command, args []string) error { return updateKeepsake(opts) }),
+		Args: cobra.NoArgs,
+	}
+
+	cmd.Flags().BoolVar(&opts.check, "check", false, "Only check whether a new version is available")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Install the latest release, even if it is the same as or older than this version")
+
+	return cmd
+}
+
+func updateKeepsake(opts updateOpts) error {
+	releaseURL := global.ReleaseURL
+	if url := os.Getenv("KEEPSAKE_RELEASE_URL"); url != "" {
+		// releases from here are still checked against the public key built
+		// into this binary, so this can't be used to install anything unsigned
+		console.Info("Looking for releases at %s, because KEEPSAKE_RELEASE_URL is set", url)
+		releaseURL = url
+	}
+
+	if global.ReleasePublicKey == "" {
+		return fmt.Errorf("This build of Keepsake can't check that releases are genuine, so it can't update itself. Download the latest release from %s instead.", global.WebURL)
+	}
+	release, err := update.FetchRelease(releaseURL, global.ReleasePublicKey)
+	if err != nil {
+		return err
+	}
+
+	latest, err := version.Parse(release.Version)
+	if err != nil {
+		return fmt.Errorf("The latest release has an invalid version: %w", err)
+	}
+	current, err := version.Parse(global.Version)
+	if err != nil {
+		// e.g. a development build without a version number
+		console.Debug("Failed to parse the current version: %s", err)
+		if !opts.force {
+			return fmt.Errorf("Keepsake %s is available, but this build of Keepsake (%s) doesn't have a version number to compare it with. Run 'keepsake update --force' to install it anyway.", release.Version, global.Version)
+		}
+	} else if comparison := latest.Compare(current); comparison == 0 && !opts.force {
+		console.Info("Keepsake %s is the latest version.", global.Version)
+		return nil
+	} else if comparison < 0 && !opts.force {
+		// also stops an old, signed release being served to downgrade to a
+		// version with known bugs
+		console.Info("The latest release, Keepsake %s, is older than the version you have (%s), so it won't be installed. Run 'keepsake update --force' to downgrade to it.", release.Version, global.Version)
+		return nil
+	}
+	if opts.check {
+		console.Info("Keepsake %s is available (you have %s). Run 'keepsake update' to install it.", release.Version, global.Version)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Failed to find the keepsake binary: %w", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return fmt.Errorf("Failed to find the keepsake binary: %w", err)
+	}
+	if strings.Contains(executable, "site-packages") {
+		return fmt.Errorf("Keepsake was installed with pip, so it can't update itself. To update it, run:\n\n  pip install -U keepsake")
+	}
+
+	binary, err := release.Binary(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	if global.DryRun {
+		console.Info("Would replace %s with Keepsake %s", executable, release.Version)
+		return nil
+	}
+	console.Info("Downloading Keepsake %s...", release.Version)
+	data, err := binary.Download()
+	if err != nil {
+		return err
+	}
+	if err := update.ReplaceExecutable(executable, data); err != nil {
+		if goerrors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("You don't have permission to replace %s. Try running 'sudo keepsake update'.", executable)
+		}
+		return err
+	}
+	console.Info("Updated Keepsake to %s.", release.Version)
+	return nil
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/keepsake/go/pkg/project"
+)
+
+type verifyOpts struct {
+	repositoryURL string
+}
+
+func newVerifyCommand() *cobra.Command {
+	var opts verifyOpts
+
+	cmd := &cobra.Command{
+		Use:   "verify <experiment or checkpoint ID> [directory]",
+		Short: "Check that a directory has the files that were saved with a checkpoint",
+		Long: `Check that the files in a directory are the ones that were saved with a checkpoint
+or experiment, by comparing their sizes and SHA-256 hashes with the ones recorded
+when they were saved, without downloading them.
+
+The directory is where the files would be checked out to, so the path the
+checkpoint was saved from is inside it. It defaults to the project directory.
+
+Files that are missing or different are listed, as are files in the saved path
+that weren't saved. If there are any, it exits with an error.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return verify(opts, args, os.Stdout)
+		}),
+		Args: cobra.RangeArgs(1, 2),
+		Example: `Check that the model in the project directory is the one saved with a checkpoint,
+before resuming training from it (where a1b2c3d4 is a checkpoint ID):
+$ keepsake verify a1b2c3d4
+
+Check a checkpoint that was checked out somewhere else:
+$ keepsake verify a1b2c3d4 /mnt/checkpoints/a1b2c3d4`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func verify(opts verifyOpts, args []string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj, err := newProject(repo, projectDir)
+	if err != nil {
+		return err
+	}
+
+	result, err := proj.CheckpointOrExperimentFromPrefix(args[0])
+	if err != nil {
+		return err
+	}
+	dir := projectDir
+	if len(args) == 2 {
+		dir = args[1]
+	}
+
+	var drift *project.FileDrift
+	var description string
+	if result.Checkpoint != nil {
+		drift, err = proj.VerifyCheckpoint(result.Checkpoint, dir)
+		description = "checkpoint " + result.Checkpoint.ShortID()
+	} else {
+		drift, err = proj.VerifyExperiment(result.Experiment, dir)
+		description = "experiment " + result.Experiment.ShortID()
+	}
+	if err != nil {
+		return err
+	}
+
+	if drift.IsEmpty() {
+		fmt.Fprintf(out, "The files in %s match %s\n", dir, description)
+		return nil
+	}
+	for _, p := range drift.Missing {
+		fmt.Fprintf(out, "missing: %s\n", p)
+	}
+	for _, changed := range drift.Changed {
+		fmt.Fprintf(out, "changed: %s\n", changed)
+	}
+	for _, p := range drift.Extra {
+		fmt.Fprintf(out, "extra:   %s\n", p)
+	}
+	return fmt.Errorf("The files in %s don't match %s: %d missing, %d changed, and %d that weren't saved", dir, description, len(drift.Missing), len(drift.Changed), len(drift.Extra))
+}
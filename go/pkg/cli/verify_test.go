@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestVerify(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(workingDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(workingDir, "model", "weights.pth"), []byte("epoch 40"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(workingDir, "model", "optimizer.pth"), []byte("adam"), 0644))
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := project.NewProject(repo, workingDir)
+	exp, err := proj.CreateExperiment(project.CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := proj.CreateCheckpoint(project.CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	opts := verifyOpts{repositoryURL: "file://" + path.Join(workingDir, ".keepsake")}
+	out := new(bytes.Buffer)
+	require.NoError(t, verify(opts, []string{chk.ID[:7], workingDir}, out))
+	require.Equal(t, "The files in "+workingDir+" match checkpoint "+chk.ShortID()+"\n", out.String())
+
+	require.NoError(t, ioutil.WriteFile(path.Join(workingDir, "model", "weights.pth"), []byte("epoch 41"), 0644))
+	require.NoError(t, os.Remove(path.Join(workingDir, "model", "optimizer.pth")))
+	require.NoError(t, ioutil.WriteFile(path.Join(workingDir, "model", "notes.txt"), []byte("hmm"), 0644))
+	out = new(bytes.Buffer)
+	err = verify(opts, []string{chk.ID[:7], workingDir}, out)
+	require.EqualError(t, err, "The files in "+workingDir+" don't match checkpoint "+chk.ShortID()+": 1 missing, 1 changed, and 1 that weren't saved")
+	require.Contains(t, out.String(), "missing: model/optimizer.pth\n")
+	require.Contains(t, out.String(), "changed: model/weights.pth has SHA-256 ")
+	require.Contains(t, out.String(), "extra:   model/notes.txt\n")
+}
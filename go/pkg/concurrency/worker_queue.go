@@ -40,6 +40,12 @@ func (wq *WorkerQueue) Go(f func() error) error {
 	return nil
 }
 
+// Context returns the queue's context, which is cancelled when a worker fails,
+// so work that feeds the queue can stop early
+func (wq *WorkerQueue) Context() context.Context {
+	return wq.ctx
+}
+
 // Wait until all workers have finished their work. Any errors returned by workers will
 // be returned by this function.
 func (wq *WorkerQueue) Wait() error {
@@ -1,12 +1,551 @@
 package config
 
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// ProjectsDir is the directory in a repository that projects are stored in
+const ProjectsDir = "projects"
+
+// Checkpoint step policies decide what happens when a checkpoint is saved
+// with the same step as an existing checkpoint in the same experiment
+const (
+	StepPolicyKeepAll    = "keep-all"
+	StepPolicyKeepLatest = "keep-latest"
+	StepPolicyError      = "error"
+)
+
+// Ways of storing the files saved with experiments
+const (
+	SnapshotTarball          = "tarball"
+	SnapshotContentAddressed = "content-addressed"
+)
+
 // Config is keepsake.yaml
 type Config struct {
 	Repository string `json:"repository"`
 
+	// Name of this project within the repository, so several projects can
+	// share one bucket. If it is set, Repository, ArtifactRepository, and
+	// ArtifactReplicas point at projects/<name>/ in the URLs in keepsake.yaml.
+	Project string `json:"project,omitempty"`
+
+	// Open the repository read-only, so anything that would write to or
+	// delete from it fails
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// Where to store the files saved with experiments and checkpoints, if it
+	// should be somewhere other than the repository (e.g. a bucket with a
+	// cheaper storage class). Metadata is always stored in the repository.
+	ArtifactRepository string `json:"artifact_repository,omitempty"`
+
+	// Copies of the artifact repository in other regions, which checkouts read
+	// from if they are in a region in RegionPreference
+	ArtifactReplicas []*ArtifactReplica `json:"artifact_replicas,omitempty"`
+
+	// Regions to read artifacts from, most preferred first. Can be overridden
+	// with the KEEPSAKE_REGION_PREFERENCE environment variable.
+	RegionPreference []string `json:"region_preference,omitempty"`
+
+	CheckpointStepPolicy string `json:"checkpoint_step_policy,omitempty"`
+
+	// How to store the files saved with experiments. "content-addressed" stores
+	// each file once, by its hash, so experiments only upload files that changed.
+	CodeSnapshots string `json:"code_snapshots,omitempty"`
+
+	// How big the files saved with an experiment can be before Keepsake asks
+	// whether to save them, e.g. "5GB", or "0" for no limit. Default: 1GB
+	SnapshotSizeLimit ByteSize `json:"snapshot_size_limit,omitempty"`
+
+	// Save files that are left out of experiments and checkpoints by default,
+	// like __pycache__/, node_modules/, and wandb/. Only .keepsakeignore
+	// decides what is left out.
+	DisableDefaultIgnore bool `json:"disable_default_ignore,omitempty"`
+
+	// Store each checkpoint's files as binary deltas against the previous
+	// checkpoint saved with the same path, when the files are the same size
+	CheckpointDeltas bool `json:"checkpoint_deltas,omitempty"`
+
+	// Rename files saved with experiments and checkpoints whose names would
+	// break on other repositories or operating systems (e.g. names with
+	// control characters, or that end in a dot or space). Otherwise they are
+	// saved as they are, with a warning.
+	SanitizeFileNames bool `json:"sanitize_file_names,omitempty"`
+
+	// How often to sample CPU, RAM, and GPU utilization while an experiment
+	// is running, as a duration (e.g. "30s"). Empty disables sampling.
+	SystemMetricsInterval string `json:"system_metrics_interval,omitempty"`
+
+	Cost *CostConfig `json:"cost,omitempty"`
+
+	// Poll the cloud provider's metadata server while an experiment is running,
+	// to save its data and stop it cleanly if a spot/preemptible instance is reclaimed
+	WatchForPreemption bool `json:"watch_for_preemption,omitempty"`
+
+	// Names of params whose values are replaced by a hash when they are saved
+	// and displayed, like "api_key" or "*_password"
+	SensitiveParams []string `json:"sensitive_params,omitempty"`
+
+	// The template in Templates whose defaults are applied to new
+	// experiments. Can be overridden with the KEEPSAKE_TEMPLATE environment
+	// variable.
+	Template string `json:"template,omitempty"`
+
+	// Defaults for new experiments, by name, so they don't have to be passed
+	// to every run
+	Templates map[string]*TemplateConfig `json:"templates,omitempty"`
+
+	// How to display metrics, by name: their units, and whether higher or
+	// lower values are better
+	Metrics map[string]*MetricConfig `json:"metrics,omitempty"`
+
+	// Metrics computed from the metrics checkpoints were saved with, by name,
+	// as expressions like "2 * precision * recall / (precision + recall)".
+	// They are computed when experiments are read, so they can be shown,
+	// filtered, and sorted on like any other metric.
+	DerivedMetrics map[string]string `json:"derived_metrics,omitempty"`
+
+	// Stop experiments when their metric stops improving
+	EarlyStopping *EarlyStoppingConfig `json:"early_stopping,omitempty"`
+
+	// Commands to run when something happens to an experiment, by event (e.g.
+	// "checkpoint-saved"). They are run with the event's payload as JSON on stdin.
+	Hooks map[string][]string `json:"hooks,omitempty"`
+
+	// URLs to POST events to as JSON, e.g. to deploy new models or update dashboards
+	Webhooks []*WebhookConfig `json:"webhooks,omitempty"`
+
+	// Where temporary files are written while uploading, downloading, and
+	// extracting, and how much space they can take up
+	Scratch *ScratchConfig `json:"scratch,omitempty"`
+
+	// Tuning for the HTTP connections made to S3 and Google Cloud Storage
+	StorageHTTP *StorageHTTPConfig `json:"storage_http,omitempty"`
+
+	// How long requests to S3 and Google Cloud Storage can take before they
+	// are abandoned, by kind of request
+	StorageTimeouts *StorageTimeoutsConfig `json:"storage_timeouts,omitempty"`
+
 	Storage string `json:"storage"` // deprecated
 }
 
+// RootRepository returns the repository URL in keepsake.yaml, which contains
+// every project in it
+func (c *Config) RootRepository() string {
+	if c.Project == "" {
+		return c.Repository
+	}
+	return strings.TrimSuffix(c.Repository, "/"+ProjectsDir+"/"+c.Project)
+}
+
+// ProjectURL returns where the project called name is stored in the
+// repository at repositoryURL
+func ProjectURL(repositoryURL string, name string) string {
+	return strings.TrimRight(repositoryURL, "/") + "/" + ProjectsDir + "/" + name
+}
+
+// SystemMetricsSampleInterval returns system_metrics_interval as a duration,
+// or 0 if system metrics sampling is disabled
+func (c *Config) SystemMetricsSampleInterval() time.Duration {
+	if c.SystemMetricsInterval == "" {
+		return 0
+	}
+	interval, err := time.ParseDuration(c.SystemMetricsInterval)
+	if err != nil {
+		return 0
+	}
+	return interval
+}
+
+// ByteSize is a size in keepsake.yaml, like "10GB". It can also be a plain
+// number of bytes, which YAML reads as a number rather than a string.
+type ByteSize string
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = ByteSize(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("%s is not a size, like 500MB or 10GB", data)
+	}
+	*b = ByteSize(n.String())
+	return nil
+}
+
+// DefaultSnapshotSizeLimit is how big the files saved with an experiment can
+// be if snapshot_size_limit isn't set
+const DefaultSnapshotSizeLimit = 1 << 30
+
+// SnapshotSizeLimitBytes returns snapshot_size_limit in bytes, or 0 if there
+// is no limit. Invalid values were rejected when keepsake.yaml was loaded.
+func (c *Config) SnapshotSizeLimitBytes() int64 {
+	switch strings.TrimSpace(string(c.SnapshotSizeLimit)) {
+	case "":
+		return DefaultSnapshotSizeLimit
+	case "0":
+		return 0
+	}
+	limit, _ := console.ParseBytes(string(c.SnapshotSizeLimit))
+	return limit
+}
+
+// CostConfig is the prices used to estimate what experiments cost to run and store
+type CostConfig struct {
+	// Price per hour of the machine an experiment runs on
+	HourlyPrice float64 `json:"hourly_price,omitempty"`
+
+	// Prices per hour for particular hosts, overriding HourlyPrice
+	HostHourlyPrices map[string]float64 `json:"host_hourly_prices,omitempty"`
+
+	// Price per gigabyte per month of the repository's storage
+	StoragePricePerGBMonth float64 `json:"storage_price_per_gb_month,omitempty"`
+}
+
+// HourlyPriceForHost returns the price per hour of running on host
+func (c *CostConfig) HourlyPriceForHost(host string) float64 {
+	if price, ok := c.HostHourlyPrices[host]; ok {
+		return price
+	}
+	return c.HourlyPrice
+}
+
+// ScratchConfig is where temporary files are written. Entries left behind by
+// processes that have stopped are cleaned up automatically.
+type ScratchConfig struct {
+	// Directory to write temporary files to, relative to the project
+	// directory. Default: KEEPSAKE_SCRATCH_DIR, or /tmp/keepsake
+	Directory string `json:"directory,omitempty"`
+
+	// How much the directory can hold before new temporary files can't be
+	// written, e.g. "50GB". Empty means no limit.
+	MaxSize string `json:"max_size,omitempty"`
+
+	// How old an entry can get before it is cleaned up, even if the process
+	// that made it is still running, e.g. "72h". Default: a week
+	MaxAge string `json:"max_age,omitempty"`
+}
+
+// ScratchOptions returns the scratch directory options for a project in
+// projectDir. Invalid values were rejected when keepsake.yaml was loaded.
+func (c *Config) ScratchOptions(projectDir string) files.ScratchOptions {
+	opts := files.ScratchOptions{}
+	if c.Scratch == nil {
+		return opts
+	}
+	opts.Dir = c.Scratch.Directory
+	if opts.Dir != "" && !filepath.IsAbs(opts.Dir) && projectDir != "" {
+		opts.Dir = filepath.Join(projectDir, opts.Dir)
+	}
+	if c.Scratch.MaxSize != "" {
+		opts.MaxBytes, _ = console.ParseBytes(c.Scratch.MaxSize)
+	}
+	if c.Scratch.MaxAge != "" {
+		opts.MaxAge, _ = time.ParseDuration(c.Scratch.MaxAge)
+	}
+	return opts
+}
+
+// StorageHTTPConfig tunes the HTTP connections made to S3 and Google Cloud
+// Storage, e.g. for workloads with lots of small objects in parallel
+type StorageHTTPConfig struct {
+	// How many connections to each host are kept open between requests.
+	// Default: the number of parallel transfers
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host,omitempty"`
+
+	// Use HTTP/1.1, with a connection for each request in flight, instead of
+	// multiplexing requests over HTTP/2
+	DisableHTTP2 bool `json:"disable_http2,omitempty"`
+
+	// How long connecting can take, e.g. "10s". Default: 30s
+	DialTimeout string `json:"dial_timeout,omitempty"`
+
+	// How long to wait for a response after sending a request, e.g. "1m".
+	// Default: no limit
+	ResponseHeaderTimeout string `json:"response_header_timeout,omitempty"`
+
+	// How long an idle connection is kept open, e.g. "5m". Default: 90s
+	IdleConnTimeout string `json:"idle_conn_timeout,omitempty"`
+}
+
+// HTTPOptions returns the options for connections to storage. Invalid values
+// were rejected when keepsake.yaml was loaded.
+func (c *Config) HTTPOptions() repository.HTTPOptions {
+	opts := repository.HTTPOptions{}
+	if c.StorageHTTP == nil {
+		return opts
+	}
+	opts.MaxIdleConnsPerHost = c.StorageHTTP.MaxIdleConnsPerHost
+	opts.DisableHTTP2 = c.StorageHTTP.DisableHTTP2
+	opts.DialTimeout, _ = time.ParseDuration(c.StorageHTTP.DialTimeout)
+	opts.ResponseHeaderTimeout, _ = time.ParseDuration(c.StorageHTTP.ResponseHeaderTimeout)
+	opts.IdleConnTimeout, _ = time.ParseDuration(c.StorageHTTP.IdleConnTimeout)
+	return opts
+}
+
+// StorageTimeoutsConfig is how long each kind of request to S3 and Google
+// Cloud Storage can take, so a hung request fails instead of stalling
+// forever. Requests that take longer are abandoned.
+type StorageTimeoutsConfig struct {
+	// Reading or writing a small object, like an experiment's metadata, e.g.
+	// "30s". Default: 1m
+	Metadata string `json:"metadata,omitempty"`
+
+	// Uploading or downloading one file, or on S3 one part of a large file,
+	// e.g. "3h". Default: 1h
+	Transfer string `json:"transfer,omitempty"`
+
+	// Fetching one page of a listing, e.g. "5m". Default: 2m
+	List string `json:"list,omitempty"`
+}
+
+// Timeouts returns how long requests to storage can take. Invalid values were
+// rejected when keepsake.yaml was loaded.
+func (c *Config) Timeouts() repository.Timeouts {
+	t := repository.Timeouts{}
+	if c.StorageTimeouts == nil {
+		return t
+	}
+	t.Metadata, _ = time.ParseDuration(c.StorageTimeouts.Metadata)
+	t.Transfer, _ = time.ParseDuration(c.StorageTimeouts.Transfer)
+	t.List, _ = time.ParseDuration(c.StorageTimeouts.List)
+	return t
+}
+
+// EarlyStoppingConfig decides when a running experiment is stopped because its
+// metric has stopped improving
+type EarlyStoppingConfig struct {
+	// The metric to watch. Defaults to the primary metric of each checkpoint.
+	Metric string `json:"metric,omitempty"`
+
+	// "minimize" or "maximize". Required if Metric is set, otherwise defaults
+	// to the goal of the primary metric.
+	Goal string `json:"goal,omitempty"`
+
+	// How many checkpoints in a row can fail to improve on the best one before
+	// the experiment is stopped
+	Patience int `json:"patience"`
+
+	// How much the metric has to improve by to count as an improvement
+	MinDelta float64 `json:"min_delta,omitempty"`
+}
+
+// TemplateConfig is the defaults applied to experiments created with a template
+type TemplateConfig struct {
+	// Params that experiments get unless they set them themselves
+	Params param.ValueMap `json:"params,omitempty"`
+
+	// Tags that experiments are given
+	Tags []string `json:"tags,omitempty"`
+
+	// The primary metric of checkpoints that don't set one
+	PrimaryMetric *TemplatePrimaryMetric `json:"primary_metric,omitempty"`
+}
+
+type TemplatePrimaryMetric struct {
+	Name string `json:"name"`
+	// "minimize" or "maximize"
+	Goal string `json:"goal"`
+}
+
+// ActiveTemplate returns the template applied to new experiments, or nil if
+// there isn't one
+func (c *Config) ActiveTemplate() (*TemplateConfig, error) {
+	if c.Template == "" {
+		return nil, nil
+	}
+	template, ok := c.Templates[c.Template]
+	if !ok {
+		names := []string{}
+		for name := range c.Templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("Template %q isn't defined, because there are no templates in keepsake.yaml", c.Template)
+		}
+		return nil, fmt.Errorf("Template %q isn't defined in keepsake.yaml. It can be '%s'.", c.Template, strings.Join(names, "', '"))
+	}
+	if template == nil {
+		// a template with nothing in it
+		return &TemplateConfig{}, nil
+	}
+	return template, nil
+}
+
+// MetricConfig describes a metric in metrics in keepsake.yaml
+type MetricConfig struct {
+	// Shown after values, e.g. "%" or "MB". Values of metrics in "seconds"
+	// are shown as durations (e.g. "1m30s"), and in "bytes" as sizes (e.g.
+	// "1.5 GiB"). Values are shown as they were saved, so a metric in "%"
+	// should be saved as 93.1, not 0.931.
+	Unit string `json:"unit,omitempty"`
+
+	// "minimize" or "maximize", so improvements can be told apart from
+	// regressions. Defaults to the goal of the primary metric, if it is one.
+	Goal string `json:"goal,omitempty"`
+}
+
+// Metric units that are formatted specially
+const (
+	MetricUnitSeconds = "seconds"
+	MetricUnitBytes   = "bytes"
+)
+
+// MetricConfig returns how to display the metric called name, or nil if it
+// isn't in keepsake.yaml
+func (c *Config) MetricConfig(name string) *MetricConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Metrics[name]
+}
+
+// FormatValue returns formatted, which is v formatted as a string, with the
+// metric's unit. Values that aren't numbers are returned as they are.
+func (m *MetricConfig) FormatValue(v param.Value, formatted string) string {
+	if m == nil || m.Unit == "" {
+		return formatted
+	}
+	var f float64
+	switch v.Type() {
+	case param.TypeInt:
+		f = float64(v.IntVal())
+	case param.TypeFloat:
+		f = v.FloatVal()
+	default:
+		return formatted
+	}
+	switch m.Unit {
+	case MetricUnitSeconds:
+		d := time.Duration(f * float64(time.Second))
+		if d < time.Minute && d > -time.Minute {
+			return d.Round(time.Millisecond).String()
+		}
+		return d.Round(time.Second).String()
+	case MetricUnitBytes:
+		if f >= 0 {
+			return console.FormatBytes(uint64(f))
+		}
+	case "%":
+		return formatted + "%"
+	}
+	return formatted + " " + m.Unit
+}
+
+// DerivedMetric is a metric in derived_metrics in keepsake.yaml
+type DerivedMetric struct {
+	Name       string
+	Expression *param.Expression
+}
+
+// DerivedMetricsInOrder parses DerivedMetrics, and returns them in an order
+// they can be computed in, with the metrics that others refer to first
+func (c *Config) DerivedMetricsInOrder() ([]*DerivedMetric, error) {
+	names := []string{}
+	for name := range c.DerivedMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parsed := map[string]*DerivedMetric{}
+	for _, name := range names {
+		expr, err := param.ParseExpression(c.DerivedMetrics[name])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", name, err)
+		}
+		parsed[name] = &DerivedMetric{Name: name, Expression: expr}
+	}
+
+	ordered := []*DerivedMetric{}
+	// 1 while a metric's dependencies are being visited, 2 once it is ordered
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		metric, ok := parsed[name]
+		if !ok || state[name] == 2 {
+			return nil
+		}
+		path = append(path, name)
+		if state[name] == 1 {
+			return fmt.Errorf("%q refers to itself (%s)", name, strings.Join(path, " -> "))
+		}
+		state[name] = 1
+		for _, dep := range metric.Expression.Names() {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, metric)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// ArtifactReplica is a copy of the artifact repository in a particular region.
+// Keepsake only reads from replicas; copying files to them is up to you (e.g.
+// with bucket replication).
+type ArtifactReplica struct {
+	Repository string `json:"repository"`
+	Region     string `json:"region"`
+}
+
+// PreferredArtifactReplicas returns the artifact replicas in the given regions,
+// ordered by preference. Replicas in other regions are not included.
+func (c *Config) PreferredArtifactReplicas(regionPreference []string) []*ArtifactReplica {
+	replicas := []*ArtifactReplica{}
+	for _, region := range regionPreference {
+		for _, replica := range c.ArtifactReplicas {
+			if replica.Region == region {
+				replicas = append(replicas, replica)
+			}
+		}
+	}
+	return replicas
+}
+
+// WebhookConfig is a URL that events are sent to
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Events to send. If empty, every event is sent.
+	Events []string `json:"events,omitempty"`
+	// Name of the environment variable with the secret that payloads are
+	// signed with, together with the X-Keepsake-Timestamp header. Receivers
+	// should check the signature and that the timestamp is recent. The
+	// secret itself shouldn't be in keepsake.yaml.
+	SecretEnv string `json:"secret_env,omitempty"`
+}
+
+// WantsEvent returns true if event should be sent to the webhook
+func (w *WebhookConfig) WantsEvent(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
 func getDefaultConfig(workingDir string) *Config {
 	// should match defaults in config.py
 	return &Config{}
@@ -8,6 +8,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 
@@ -15,12 +18,15 @@ import (
 	"github.com/replicate/keepsake/go/pkg/errors"
 	"github.com/replicate/keepsake/go/pkg/files"
 	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/hooks"
 	"github.com/replicate/keepsake/go/pkg/slices"
 )
 
 const maxSearchDepth = 100
 const deprecatedRepositoryDir = ".replicate/storage"
 
+var projectNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 // FindConfigInWorkingDir searches working directory and any parent directories
 // for keepsake.yaml (or keepsake.yml) and loads it.
 //
@@ -127,6 +133,182 @@ func Parse(text []byte, dir string) (conf *Config, err error) {
 		return nil, fmt.Errorf("Missing required field in keepsake.yaml: repository")
 	}
 
+	if conf.Project != "" {
+		if !projectNameRegexp.MatchString(conf.Project) {
+			return nil, fmt.Errorf("Invalid project in keepsake.yaml: %q. It can only contain letters, numbers, '.', '_', and '-'.", conf.Project)
+		}
+		conf.Repository = ProjectURL(conf.Repository, conf.Project)
+		if conf.ArtifactRepository != "" {
+			conf.ArtifactRepository = ProjectURL(conf.ArtifactRepository, conf.Project)
+		}
+		for _, replica := range conf.ArtifactReplicas {
+			if replica != nil && replica.Repository != "" {
+				replica.Repository = ProjectURL(replica.Repository, conf.Project)
+			}
+		}
+	}
+
+	switch conf.CheckpointStepPolicy {
+	case "", StepPolicyKeepAll, StepPolicyKeepLatest, StepPolicyError:
+	default:
+		return nil, fmt.Errorf("Invalid checkpoint_step_policy in keepsake.yaml: %q. It must be one of '%s', '%s', or '%s'.", conf.CheckpointStepPolicy, StepPolicyKeepAll, StepPolicyKeepLatest, StepPolicyError)
+	}
+
+	switch conf.CodeSnapshots {
+	case "", SnapshotTarball, SnapshotContentAddressed:
+	default:
+		return nil, fmt.Errorf("Invalid code_snapshots in keepsake.yaml: %q. It must be '%s' or '%s'.", conf.CodeSnapshots, SnapshotTarball, SnapshotContentAddressed)
+	}
+
+	if conf.Cost != nil {
+		if conf.Cost.HourlyPrice < 0 || conf.Cost.StoragePricePerGBMonth < 0 {
+			return nil, fmt.Errorf("Invalid cost in keepsake.yaml: prices cannot be negative")
+		}
+		for host, price := range conf.Cost.HostHourlyPrices {
+			if price < 0 {
+				return nil, fmt.Errorf("Invalid cost in keepsake.yaml: the price for host %q cannot be negative", host)
+			}
+		}
+	}
+
+	for _, pattern := range conf.SensitiveParams {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid sensitive_params in keepsake.yaml: %q is not a valid pattern", pattern)
+		}
+	}
+
+	if es := conf.EarlyStopping; es != nil {
+		if es.Patience < 1 {
+			return nil, fmt.Errorf("Invalid early_stopping in keepsake.yaml: 'patience' must be at least 1")
+		}
+		if es.MinDelta < 0 {
+			return nil, fmt.Errorf("Invalid early_stopping in keepsake.yaml: 'min_delta' cannot be negative")
+		}
+		switch es.Goal {
+		case "minimize", "maximize":
+		case "":
+			if es.Metric != "" {
+				return nil, fmt.Errorf("Invalid early_stopping in keepsake.yaml: 'goal' must be set to 'minimize' or 'maximize' when 'metric' is set")
+			}
+		default:
+			return nil, fmt.Errorf("Invalid early_stopping in keepsake.yaml: 'goal' must be 'minimize' or 'maximize', not %q", es.Goal)
+		}
+	}
+
+	for name, metric := range conf.Metrics {
+		if metric == nil {
+			continue
+		}
+		switch metric.Goal {
+		case "", "minimize", "maximize":
+		default:
+			return nil, fmt.Errorf("Invalid metrics in keepsake.yaml: the goal of %q must be 'minimize' or 'maximize', not %q", name, metric.Goal)
+		}
+	}
+
+	if _, err := conf.DerivedMetricsInOrder(); err != nil {
+		return nil, fmt.Errorf("Invalid derived_metrics in keepsake.yaml: %w", err)
+	}
+
+	for name, template := range conf.Templates {
+		if template == nil || template.PrimaryMetric == nil {
+			continue
+		}
+		if template.PrimaryMetric.Name == "" {
+			return nil, fmt.Errorf("Invalid templates in keepsake.yaml: the primary_metric of template %q must have a 'name'", name)
+		}
+		switch template.PrimaryMetric.Goal {
+		case "minimize", "maximize":
+		default:
+			return nil, fmt.Errorf("Invalid templates in keepsake.yaml: the primary_metric of template %q must have a 'goal' of 'minimize' or 'maximize', not %q", name, template.PrimaryMetric.Goal)
+		}
+	}
+	if _, err := conf.ActiveTemplate(); err != nil {
+		return nil, fmt.Errorf("Invalid template in keepsake.yaml: %w", err)
+	}
+
+	for i, replica := range conf.ArtifactReplicas {
+		if replica == nil || replica.Repository == "" || replica.Region == "" {
+			return nil, fmt.Errorf("Invalid artifact_replicas in keepsake.yaml: replica %d must have both a 'repository' and a 'region'", i+1)
+		}
+	}
+
+	for event := range conf.Hooks {
+		if !hooks.IsEvent(event) {
+			return nil, fmt.Errorf("Invalid event in hooks in keepsake.yaml: %q. It must be one of '%s'.", event, strings.Join(hooks.Events, "', '"))
+		}
+	}
+
+	for i, webhook := range conf.Webhooks {
+		if webhook == nil || !(strings.HasPrefix(webhook.URL, "http://") || strings.HasPrefix(webhook.URL, "https://")) {
+			return nil, fmt.Errorf("Invalid webhooks in keepsake.yaml: webhook %d must have a 'url' that starts with http:// or https://", i+1)
+		}
+		for _, event := range webhook.Events {
+			if !hooks.IsEvent(event) {
+				return nil, fmt.Errorf("Invalid event in webhooks in keepsake.yaml: %q. It must be one of '%s'.", event, strings.Join(hooks.Events, "', '"))
+			}
+		}
+	}
+
+	if conf.SystemMetricsInterval != "" {
+		interval, err := time.ParseDuration(conf.SystemMetricsInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("Invalid system_metrics_interval in keepsake.yaml: %q. It must be a positive duration, like '30s' or '1m'.", conf.SystemMetricsInterval)
+		}
+	}
+
+	if limit := strings.TrimSpace(string(conf.SnapshotSizeLimit)); limit != "" && limit != "0" {
+		if _, err := console.ParseBytes(limit); err != nil {
+			return nil, fmt.Errorf("Invalid snapshot_size_limit in keepsake.yaml: %v, or 0 for no limit", err)
+		}
+	}
+
+	if sc := conf.Scratch; sc != nil {
+		if sc.MaxSize != "" {
+			if _, err := console.ParseBytes(sc.MaxSize); err != nil {
+				return nil, fmt.Errorf("Invalid scratch in keepsake.yaml: 'max_size' %v", err)
+			}
+		}
+		if sc.MaxAge != "" {
+			if maxAge, err := time.ParseDuration(sc.MaxAge); err != nil || maxAge <= 0 {
+				return nil, fmt.Errorf("Invalid scratch in keepsake.yaml: 'max_age' must be a positive duration, like '72h', not %q", sc.MaxAge)
+			}
+		}
+	}
+	if sh := conf.StorageHTTP; sh != nil {
+		if sh.MaxIdleConnsPerHost < 0 {
+			return nil, fmt.Errorf("Invalid storage_http in keepsake.yaml: 'max_idle_conns_per_host' can't be negative")
+		}
+		timeouts := []struct{ name, value string }{
+			{"dial_timeout", sh.DialTimeout},
+			{"response_header_timeout", sh.ResponseHeaderTimeout},
+			{"idle_conn_timeout", sh.IdleConnTimeout},
+		}
+		for _, timeout := range timeouts {
+			if timeout.value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(timeout.value); err != nil || d <= 0 {
+				return nil, fmt.Errorf("Invalid storage_http in keepsake.yaml: '%s' must be a positive duration, like '30s', not %q", timeout.name, timeout.value)
+			}
+		}
+	}
+	if st := conf.StorageTimeouts; st != nil {
+		timeouts := []struct{ name, value string }{
+			{"metadata", st.Metadata},
+			{"transfer", st.Transfer},
+			{"list", st.List},
+		}
+		for _, timeout := range timeouts {
+			if timeout.value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(timeout.value); err != nil || d <= 0 {
+				return nil, fmt.Errorf("Invalid storage_timeouts in keepsake.yaml: '%s' must be a positive duration, like '5m', not %q", timeout.name, timeout.value)
+			}
+		}
+	}
+
 	return conf, nil
 }
 
@@ -6,9 +6,12 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/kami-zh/go-capturer"
 	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/param"
 )
 
 func TestFindConfigYaml(t *testing.T) {
@@ -146,3 +149,341 @@ func TestDeprecatedRepositoryBackwardsCompatible(t *testing.T) {
 	}, conf)
 	require.Equal(t, tmpDir, projectDir)
 }
+
+func TestParseCheckpointStepPolicy(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\ncheckpoint_step_policy: keep-latest"), "")
+	require.NoError(t, err)
+	require.Equal(t, StepPolicyKeepLatest, conf.CheckpointStepPolicy)
+
+	_, err = Parse([]byte("repository: s3://foobar\ncheckpoint_step_policy: keep-some"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid checkpoint_step_policy")
+}
+
+func TestParseSystemMetricsInterval(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\nsystem_metrics_interval: 30s"), "")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, conf.SystemMetricsSampleInterval())
+
+	conf, err = Parse([]byte("repository: s3://foobar"), "")
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), conf.SystemMetricsSampleInterval())
+
+	_, err = Parse([]byte("repository: s3://foobar\nsystem_metrics_interval: often"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid system_metrics_interval")
+}
+
+func TestParseSensitiveParams(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\nsensitive_params: [password, \"*_key\"]"), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"password", "*_key"}, conf.SensitiveParams)
+
+	_, err = Parse([]byte("repository: s3://foobar\nsensitive_params: [\"[key\"]"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid sensitive_params")
+}
+
+func TestParseMetrics(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar
+metrics:
+  accuracy: {unit: "%", goal: maximize}
+  epoch_time: {unit: seconds, goal: minimize}
+  memory: {unit: bytes}
+  throughput: {unit: img/s}
+`), "")
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		name     string
+		value    param.Value
+		expected string
+	}{
+		{"accuracy", param.Float(93.1), "93.1%"},
+		{"epoch_time", param.Float(1.5), "1.5s"},
+		{"epoch_time", param.Int(90), "1m30s"},
+		{"memory", param.Int(1572864), "1.5 MiB"},
+		{"throughput", param.Int(300), "300 img/s"},
+		{"throughput", param.String("n/a"), "n/a"},
+		{"loss", param.Float(0.5), "0.5"},
+	} {
+		require.Equal(t, tt.expected, conf.MetricConfig(tt.name).FormatValue(tt.value, tt.value.String()), tt.name)
+	}
+	require.Equal(t, "maximize", conf.MetricConfig("accuracy").Goal)
+
+	_, err = Parse([]byte("repository: s3://foobar\nmetrics:\n  accuracy: {goal: higher}"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid metrics")
+}
+
+func TestParseDerivedMetrics(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar
+derived_metrics:
+  score: f1 * 100
+  f1: 2 * precision * recall / (precision + recall)
+  smooth_loss: ema(loss, 0.9)
+`), "")
+	require.NoError(t, err)
+	metrics, err := conf.DerivedMetricsInOrder()
+	require.NoError(t, err)
+	names := []string{}
+	for _, metric := range metrics {
+		names = append(names, metric.Name)
+	}
+	// f1 before score, which refers to it
+	require.Equal(t, []string{"f1", "score", "smooth_loss"}, names)
+
+	_, err = Parse([]byte("repository: s3://foobar\nderived_metrics:\n  f1: precision *"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid derived_metrics")
+
+	_, err = Parse([]byte("repository: s3://foobar\nderived_metrics:\n  a: b + 1\n  b: a * 2"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"a" refers to itself (a -> b -> a)`)
+}
+
+func TestParseProject(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar/
+artifact_repository: gs://foobar-artifacts
+artifact_replicas:
+  - repository: gs://foobar-artifacts-eu
+    region: europe-west4
+project: vision
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, "vision", conf.Project)
+	require.Equal(t, "s3://foobar/projects/vision", conf.Repository)
+	require.Equal(t, "gs://foobar-artifacts/projects/vision", conf.ArtifactRepository)
+	require.Equal(t, "gs://foobar-artifacts-eu/projects/vision", conf.ArtifactReplicas[0].Repository)
+	require.Equal(t, "s3://foobar", conf.RootRepository())
+
+	conf, err = Parse([]byte("repository: s3://foobar"), "")
+	require.NoError(t, err)
+	require.Equal(t, "s3://foobar", conf.Repository)
+	require.Equal(t, "s3://foobar", conf.RootRepository())
+
+	_, err = Parse([]byte("repository: s3://foobar\nproject: ../other"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid project")
+}
+
+func TestParseWebhooks(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar
+webhooks:
+  - url: https://example.com/keepsake
+    events: [checkpoint-saved]
+    secret_env: WEBHOOK_SECRET
+  - url: http://localhost:8000
+`), "")
+	require.NoError(t, err)
+	require.Len(t, conf.Webhooks, 2)
+	require.Equal(t, "WEBHOOK_SECRET", conf.Webhooks[0].SecretEnv)
+	require.True(t, conf.Webhooks[0].WantsEvent("checkpoint-saved"))
+	require.False(t, conf.Webhooks[0].WantsEvent("run-finished"))
+	require.True(t, conf.Webhooks[1].WantsEvent("run-finished"))
+
+	_, err = Parse([]byte("repository: s3://foobar\nwebhooks:\n  - url: example.com"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid webhooks")
+
+	_, err = Parse([]byte("repository: s3://foobar\nwebhooks:\n  - url: https://example.com\n    events: [model-promoted]"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid event in webhooks")
+}
+
+func TestParseCodeSnapshots(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\ncode_snapshots: content-addressed"), "")
+	require.NoError(t, err)
+	require.Equal(t, SnapshotContentAddressed, conf.CodeSnapshots)
+
+	_, err = Parse([]byte("repository: s3://foobar\ncode_snapshots: zip"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid code_snapshots")
+}
+
+func TestParseCost(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar
+cost:
+  hourly_price: 0.9
+  host_hourly_prices:
+    gpu-box: 3.06
+  storage_price_per_gb_month: 0.023
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, 0.9, conf.Cost.HourlyPriceForHost("laptop"))
+	require.Equal(t, 3.06, conf.Cost.HourlyPriceForHost("gpu-box"))
+	require.Equal(t, 0.023, conf.Cost.StoragePricePerGBMonth)
+
+	_, err = Parse([]byte("repository: s3://foobar\ncost:\n  hourly_price: -1"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid cost")
+}
+
+func TestParseEarlyStopping(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar
+early_stopping:
+  metric: val_loss
+  goal: minimize
+  patience: 3
+  min_delta: 0.001
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, &EarlyStoppingConfig{Metric: "val_loss", Goal: "minimize", Patience: 3, MinDelta: 0.001}, conf.EarlyStopping)
+
+	// uses the primary metric
+	_, err = Parse([]byte("repository: s3://foobar\nearly_stopping:\n  patience: 3"), "")
+	require.NoError(t, err)
+
+	for _, s := range []string{
+		"early_stopping:\n  metric: val_loss\n  patience: 3",
+		"early_stopping:\n  goal: smallest\n  patience: 3",
+		"early_stopping:\n  patience: 0",
+	} {
+		_, err = Parse([]byte("repository: s3://foobar\n"+s), "")
+		require.Error(t, err, s)
+		require.Contains(t, err.Error(), "Invalid early_stopping")
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	conf, err := Parse([]byte(`repository: s3://foobar
+template: resnet
+templates:
+  resnet:
+    params:
+      layers: 50
+    tags:
+      - vision
+    primary_metric:
+      name: val_accuracy
+      goal: maximize
+  bert:
+`), "")
+	require.NoError(t, err)
+	template, err := conf.ActiveTemplate()
+	require.NoError(t, err)
+	require.Equal(t, &TemplateConfig{
+		Params:        param.ValueMap{"layers": param.Int(50)},
+		Tags:          []string{"vision"},
+		PrimaryMetric: &TemplatePrimaryMetric{Name: "val_accuracy", Goal: "maximize"},
+	}, template)
+
+	conf.Template = "bert"
+	template, err = conf.ActiveTemplate()
+	require.NoError(t, err)
+	require.Equal(t, &TemplateConfig{}, template)
+
+	conf.Template = "vgg"
+	_, err = conf.ActiveTemplate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'bert', 'resnet'")
+
+	for _, s := range []string{
+		"template: resnet",
+		"templates:\n  resnet:\n    primary_metric:\n      goal: maximize",
+		"templates:\n  resnet:\n    primary_metric:\n      name: loss\n      goal: smallest",
+	} {
+		_, err = Parse([]byte("repository: s3://foobar\n"+s), "")
+		require.Error(t, err, s)
+		require.Contains(t, err.Error(), "Invalid template")
+	}
+}
+
+func TestParseArtifactReplicas(t *testing.T) {
+	conf, err := Parse([]byte(`repository: gs://foobar
+artifact_replicas:
+  - repository: gs://foobar-eu
+    region: europe-west4
+  - repository: s3://foobar-us
+    region: us-east-1
+  - repository: gs://foobar-asia
+    region: asia-east1
+`), "")
+	require.NoError(t, err)
+	replicas := conf.PreferredArtifactReplicas([]string{"us-east-1", "europe-west4"})
+	require.Len(t, replicas, 2)
+	require.Equal(t, "s3://foobar-us", replicas[0].Repository)
+	require.Equal(t, "gs://foobar-eu", replicas[1].Repository)
+	require.Empty(t, conf.PreferredArtifactReplicas(nil))
+
+	_, err = Parse([]byte("repository: gs://foobar\nartifact_replicas:\n  - repository: gs://foobar-eu"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid artifact_replicas")
+}
+
+func TestParseHooks(t *testing.T) {
+	conf, err := Parse([]byte(`repository: gs://foobar
+hooks:
+  checkpoint-saved:
+    - ./notify.sh
+    - echo saved
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"./notify.sh", "echo saved"}, conf.Hooks["checkpoint-saved"])
+
+	_, err = Parse([]byte("repository: gs://foobar\nhooks:\n  checkpoint-created:\n    - echo hello"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid event in hooks")
+}
+
+func TestParseScratch(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\nscratch:\n  directory: .keepsake/scratch\n  max_size: 2GB\n  max_age: 72h"), "")
+	require.NoError(t, err)
+	opts := conf.ScratchOptions("/project")
+	require.Equal(t, "/project/.keepsake/scratch", opts.Dir)
+	require.Equal(t, int64(2<<30), opts.MaxBytes)
+	require.Equal(t, 72*time.Hour, opts.MaxAge)
+
+	conf, err = Parse([]byte("repository: s3://foobar\nscratch:\n  directory: /scratch"), "")
+	require.NoError(t, err)
+	require.Equal(t, "/scratch", conf.ScratchOptions("/project").Dir)
+
+	_, err = Parse([]byte("repository: s3://foobar\nscratch:\n  max_size: lots"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid scratch")
+	_, err = Parse([]byte("repository: s3://foobar\nscratch:\n  max_age: -1h"), "")
+	require.Error(t, err)
+}
+
+func TestParseStorageHTTP(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\nstorage_http:\n  max_idle_conns_per_host: 256\n  disable_http2: true\n  response_header_timeout: 1m"), "")
+	require.NoError(t, err)
+	opts := conf.HTTPOptions()
+	require.Equal(t, 256, opts.MaxIdleConnsPerHost)
+	require.True(t, opts.DisableHTTP2)
+	require.Equal(t, time.Minute, opts.ResponseHeaderTimeout)
+	require.Equal(t, time.Duration(0), opts.DialTimeout)
+
+	_, err = Parse([]byte("repository: s3://foobar\nstorage_http:\n  dial_timeout: soon"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'dial_timeout' must be a positive duration")
+}
+
+func TestParseStorageTimeouts(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar\nstorage_timeouts:\n  metadata: 30s\n  transfer: 3h"), "")
+	require.NoError(t, err)
+	timeouts := conf.Timeouts()
+	require.Equal(t, 30*time.Second, timeouts.Metadata)
+	require.Equal(t, 3*time.Hour, timeouts.Transfer)
+	require.Equal(t, time.Duration(0), timeouts.List)
+
+	_, err = Parse([]byte("repository: s3://foobar\nstorage_timeouts:\n  list: 0s"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'list' must be a positive duration")
+}
+
+func TestParseSnapshotSizeLimit(t *testing.T) {
+	conf, err := Parse([]byte("repository: s3://foobar"), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<30), conf.SnapshotSizeLimitBytes())
+
+	conf, err = Parse([]byte("repository: s3://foobar\nsnapshot_size_limit: 5GB"), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(5<<30), conf.SnapshotSizeLimitBytes())
+
+	conf, err = Parse([]byte("repository: s3://foobar\nsnapshot_size_limit: 0"), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), conf.SnapshotSizeLimitBytes())
+
+	_, err = Parse([]byte("repository: s3://foobar\nsnapshot_size_limit: huge"), "")
+	require.EqualError(t, err, `Invalid snapshot_size_limit in keepsake.yaml: "huge" is not a size, like 500MB or 10GB, or 0 for no limit`)
+}
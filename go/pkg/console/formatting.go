@@ -1,11 +1,60 @@
 package console
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/xeonx/timeago"
 )
 
+// FormatTime formats t relative to now, e.g. "2 hours ago", or as a date in
+// the local time zone if it was more than a few days ago
 func FormatTime(t time.Time) string {
-	return timeago.English.Format(t)
+	return timeago.English.Format(t.Local())
+}
+
+// FormatBytes formats a number of bytes in binary units, e.g. "1.5 GiB"
+func FormatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+var byteUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+// ParseBytes parses a positive size like "10GB", "1.5TiB", or "1024". Units
+// are powers of 1024.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	// "G", "GB", and "GiB" are all gibibytes
+	unit := strings.ToUpper(strings.TrimSpace(s[i:]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+	multiplier, ok := byteUnits[unit]
+	number, err := strconv.ParseFloat(s[:i], 64)
+	if !ok || err != nil || number <= 0 {
+		return 0, fmt.Errorf("%q is not a size, like 500MB or 10GB", s)
+	}
+	return int64(number * float64(multiplier)), nil
 }
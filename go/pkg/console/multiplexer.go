@@ -0,0 +1,185 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/logrusorgru/aurora"
+)
+
+var streamColors = []func(arg interface{}) aurora.Value{
+	aurora.Cyan,
+	aurora.Magenta,
+	aurora.Green,
+	aurora.Yellow,
+	aurora.Blue,
+}
+
+// Multiplexer lets several goroutines, like concurrent jobs or uploads, write
+// to the console at the same time without their lines getting mixed up. Each
+// one writes to its own Stream, and lines from each stream are prefixed with
+// its name.
+//
+// If grouped is true, the output of each stream is kept together: only the
+// oldest open stream prints as it goes, and the output of the others is held
+// until every stream created before them has been closed. Streams are then
+// flushed in the order they were created.
+type Multiplexer struct {
+	console *Console
+	grouped bool
+
+	mu      sync.Mutex
+	streams []*Stream
+	// index of the oldest stream that hasn't been closed
+	head int
+}
+
+// Stream is a named source of output in a Multiplexer. It is an io.Writer for
+// stdout, so it can be used as the output of a command.
+type Stream struct {
+	multiplexer *Multiplexer
+	prefix      string
+	closed      bool
+	// lines waiting for earlier streams to be closed, if grouped
+	pending []func()
+	// incomplete lines written with Write and Stderr().Write
+	partial    bytes.Buffer
+	partialErr bytes.Buffer
+}
+
+func NewMultiplexer(c *Console, grouped bool) *Multiplexer {
+	return &Multiplexer{console: c, grouped: grouped}
+}
+
+// Stream returns a new stream, with lines prefixed by name
+func (m *Multiplexer) Stream(name string) *Stream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := "[" + name + "] "
+	if m.console.Color {
+		prefix = streamColors[len(m.streams)%len(streamColors)](prefix).String()
+	}
+	s := &Stream{multiplexer: m, prefix: prefix}
+	m.streams = append(m.streams, s)
+	return s
+}
+
+// Debug level message
+func (s *Stream) Debug(msg string, v ...interface{}) {
+	s.log(DebugLevel, msg, v...)
+}
+
+// Info level message
+func (s *Stream) Info(msg string, v ...interface{}) {
+	s.log(InfoLevel, msg, v...)
+}
+
+// Warn level message
+func (s *Stream) Warn(msg string, v ...interface{}) {
+	s.log(WarnLevel, msg, v...)
+}
+
+// Error level message
+func (s *Stream) Error(msg string, v ...interface{}) {
+	s.log(ErrorLevel, msg, v...)
+}
+
+// Write writes complete lines in p to stdout. Anything after the last newline
+// is held until the rest of the line is written, or the stream is closed.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.writeLines(&s.partial, p, s.multiplexer.console.Output)
+	return len(p), nil
+}
+
+// Stderr returns an io.Writer that writes lines to stderr, prefixed like the
+// rest of the stream
+func (s *Stream) Stderr() io.Writer {
+	return stderrWriter{s}
+}
+
+// Close prints anything left in the stream. If the multiplexer is grouped,
+// this lets the streams after it print.
+func (s *Stream) Close() error {
+	m := s.multiplexer
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.flushPartial(&s.partial, m.console.Output)
+	s.flushPartial(&s.partialErr, m.console.OutputErr)
+	s.closed = true
+
+	for m.head < len(m.streams) && m.streams[m.head].closed {
+		m.head++
+		if m.head < len(m.streams) {
+			m.streams[m.head].printPending()
+		}
+	}
+	return nil
+}
+
+type stderrWriter struct {
+	s *Stream
+}
+
+func (w stderrWriter) Write(p []byte) (int, error) {
+	w.s.writeLines(&w.s.partialErr, p, w.s.multiplexer.console.OutputErr)
+	return len(p), nil
+}
+
+func (s *Stream) log(level Level, msg string, v ...interface{}) {
+	formatted := fmt.Sprintf(msg, v...)
+	m := s.multiplexer
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.emit(func() { m.console.log(level, "%s%s", s.prefix, formatted) })
+}
+
+func (s *Stream) writeLines(partial *bytes.Buffer, p []byte, output func(string)) {
+	m := s.multiplexer
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	partial.Write(p)
+	for {
+		i := bytes.IndexByte(partial.Bytes(), '\n')
+		if i == -1 {
+			return
+		}
+		line := s.prefix + string(bytes.TrimRight(partial.Next(i+1), "\r\n"))
+		s.emit(func() { output(line) })
+	}
+}
+
+func (s *Stream) flushPartial(partial *bytes.Buffer, output func(string)) {
+	if partial.Len() == 0 {
+		return
+	}
+	line := s.prefix + partial.String()
+	partial.Reset()
+	s.emit(func() { output(line) })
+}
+
+// emit prints now, or holds the print until it is this stream's turn. Must be
+// called with the multiplexer locked.
+func (s *Stream) emit(printLine func()) {
+	m := s.multiplexer
+	if !m.grouped || m.isHead(s) {
+		printLine()
+		return
+	}
+	s.pending = append(s.pending, printLine)
+}
+
+func (s *Stream) printPending() {
+	for _, printLine := range s.pending {
+		printLine()
+	}
+	s.pending = nil
+}
+
+func (m *Multiplexer) isHead(s *Stream) bool {
+	return m.head < len(m.streams) && m.streams[m.head] == s
+}
@@ -0,0 +1,61 @@
+package console
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout returns what f writes to stdout
+func captureStdout(t *testing.T, f func()) []string {
+	file, err := ioutil.TempFile("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	stdout := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = stdout }()
+
+	f()
+
+	require.NoError(t, file.Close())
+	data, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestMultiplexer(t *testing.T) {
+	lines := captureStdout(t, func() {
+		m := NewMultiplexer(&Console{Level: InfoLevel}, false)
+		a := m.Stream("a")
+		b := m.Stream("b")
+		_, _ = a.Write([]byte("one\ntw"))
+		_, _ = b.Write([]byte("three\n"))
+		_, _ = a.Write([]byte("o\nfour"))
+		require.NoError(t, a.Close())
+		require.NoError(t, b.Close())
+	})
+	require.Equal(t, []string{"[a] one", "[b] three", "[a] two", "[a] four"}, lines)
+}
+
+func TestMultiplexerGrouped(t *testing.T) {
+	lines := captureStdout(t, func() {
+		m := NewMultiplexer(&Console{Level: InfoLevel}, true)
+		a := m.Stream("a")
+		b := m.Stream("b")
+		c := m.Stream("c")
+		_, _ = c.Write([]byte("c1\n"))
+		_, _ = b.Write([]byte("b1\n"))
+		_, _ = a.Write([]byte("a1\n"))
+		_, _ = b.Write([]byte("b2\n"))
+		require.NoError(t, b.Close())
+		_, _ = a.Write([]byte("a2\n"))
+		require.NoError(t, a.Close())
+		// c is now the oldest open stream, so it prints as it goes
+		_, _ = c.Write([]byte("c2\n"))
+		require.NoError(t, c.Close())
+	})
+	require.Equal(t, []string{"[a] a1", "[a] a2", "[b] b1", "[b] b2", "[c] c1", "[c] c2"}, lines)
+}
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	goerrors "errors"
 	"fmt"
 )
 
@@ -12,9 +13,15 @@ const (
 	CodeIncompatibleRepositoryVersion = "INCOMPATIBLE_REPOSITORY_VERSION"
 	CodeCorruptedRepositorySpec       = "CORRUPTED_REPOSITORY_SPEC"
 	CodeConfigNotFound                = "CONFIG_NOT_FOUND"
+	CodePermissionDenied              = "PERMISSION_DENIED"
+	CodeThrottled                     = "THROTTLED"
+	CodeCorrupt                       = "CORRUPT"
+	CodeNetworkTimeout                = "NETWORK_TIMEOUT"
+	CodeQuotaExceeded                 = "QUOTA_EXCEEDED"
+	CodeReadOnly                      = "READ_ONLY"
+	CodeInsufficientDiskSpace         = "INSUFFICIENT_DISK_SPACE"
 )
 
-// TODO: support wrapping https://blog.golang.org/go1.13-errors
 type CodedError interface {
 	Code() string
 }
@@ -40,9 +47,52 @@ func IsConfigNotFound(err error) bool {
 	return Code(err) == CodeConfigNotFound
 }
 
-func DoesNotExist(msg string) error { return &codedError{code: CodeDoesNotExist, msg: msg} }
-func ReadError(msg string) error    { return &codedError{code: CodeReadError, msg: msg} }
-func WriteError(msg string) error   { return &codedError{code: CodeWriteError, msg: msg} }
+func IsPermissionDenied(err error) bool {
+	return Code(err) == CodePermissionDenied
+}
+
+func IsThrottled(err error) bool {
+	return Code(err) == CodeThrottled
+}
+
+func IsCorrupt(err error) bool {
+	return Code(err) == CodeCorrupt
+}
+
+func IsNetworkTimeout(err error) bool {
+	return Code(err) == CodeNetworkTimeout
+}
+
+func IsQuotaExceeded(err error) bool {
+	return Code(err) == CodeQuotaExceeded
+}
+
+func IsReadOnly(err error) bool {
+	return Code(err) == CodeReadOnly
+}
+
+func IsInsufficientDiskSpace(err error) bool {
+	return Code(err) == CodeInsufficientDiskSpace
+}
+
+// IsRetryable returns true if the operation that caused err may succeed if it
+// is tried again
+func IsRetryable(err error) bool {
+	return IsThrottled(err) || IsNetworkTimeout(err)
+}
+
+func DoesNotExist(msg string) error     { return &codedError{code: CodeDoesNotExist, msg: msg} }
+func ReadError(msg string) error        { return &codedError{code: CodeReadError, msg: msg} }
+func WriteError(msg string) error       { return &codedError{code: CodeWriteError, msg: msg} }
+func PermissionDenied(msg string) error { return &codedError{code: CodePermissionDenied, msg: msg} }
+func Throttled(msg string) error        { return &codedError{code: CodeThrottled, msg: msg} }
+func Corrupt(msg string) error          { return &codedError{code: CodeCorrupt, msg: msg} }
+func NetworkTimeout(msg string) error   { return &codedError{code: CodeNetworkTimeout, msg: msg} }
+func QuotaExceeded(msg string) error    { return &codedError{code: CodeQuotaExceeded, msg: msg} }
+func ReadOnly(msg string) error         { return &codedError{code: CodeReadOnly, msg: msg} }
+func InsufficientDiskSpace(msg string) error {
+	return &codedError{code: CodeInsufficientDiskSpace, msg: msg}
+}
 func RepositoryConfigurationError(msg string) error {
 	return &codedError{code: CodeRepositoryConfigurationError, msg: msg}
 }
@@ -69,6 +119,22 @@ pip install --upgrade keepsake`,
 	}
 }
 
+// KeepsakeVersionTooOld is returned when the repository has been marked as
+// needing a newer version of Keepsake than the one that is running. It has the
+// same code as IncompatibleRepositoryVersion, because it is fixed the same way.
+func KeepsakeVersionTooOld(rootURL string, minimumVersion string, currentVersion string) error {
+	return &codedError{
+		code: CodeIncompatibleRepositoryVersion,
+		msg: fmt.Sprintf(`The repository at %s requires Keepsake %s or later, but you are using Keepsake %s.
+
+To upgrade, run:
+pip install --upgrade keepsake
+
+Or, if you installed the keepsake command on its own, run:
+keepsake update`, rootURL, minimumVersion, currentVersion),
+	}
+}
+
 func CorruptedRepositorySpec(rootURL string, specPath string, err error) error {
 	return &codedError{
 		code: CodeCorruptedRepositorySpec,
@@ -79,8 +145,13 @@ where VERSION is an integer.`, rootURL, specPath, err),
 	}
 }
 
+// Code returns the code of err, or of the first coded error it wraps.
+//
+// Only errors created by this package are considered, because errors from
+// other libraries (e.g. awserr.Error) also have Code() methods.
 func Code(err error) string {
-	if cerr, ok := err.(CodedError); ok {
+	var cerr *codedError
+	if goerrors.As(err, &cerr) {
 		return cerr.Code()
 	}
 	return ""
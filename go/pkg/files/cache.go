@@ -0,0 +1,182 @@
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+const (
+	cacheLockFile    = ".lock"
+	cacheVersionFile = ".version"
+	cacheEntryLocks  = ".locks"
+)
+
+// Lock is an advisory lock on a file, which other processes wait for with
+// flock(2)
+type Lock struct {
+	file *os.File
+}
+
+// LockFile waits for a lock on path, creating it if it doesn't exist. Any
+// number of shared locks can be held at once, but an exclusive lock excludes
+// every other lock. path is opened again for each lock, so locks taken by
+// different goroutines in one process exclude each other too.
+func LockFile(path string, exclusive bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open lock file %s: %w", path, err)
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to lock %s: %w", path, err)
+	}
+	return &Lock{file: f}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	// closing the file releases the lock
+	return l.file.Close()
+}
+
+// Cache is a local directory that several Keepsake processes can read and
+// write at once, e.g. a CLI command and the daemon of a running experiment.
+//
+// Processes hold a shared lock on the whole cache while they read it, and an
+// exclusive lock while they change it. Entries that take a long time to
+// write, like downloaded checkpoints, can be locked on their own instead, so
+// they can be written in parallel.
+type Cache struct {
+	Dir     string
+	version int
+}
+
+// OpenCache returns the cache in dir, creating it if it doesn't exist.
+// version is the format of the cache that this version of Keepsake reads and
+// writes. If the cache was written in another format, it is emptied, so it is
+// filled again in this one. Caches made before they had versions are version
+// 1.
+//
+// If version is 0, the cache isn't versioned and is never emptied, for
+// directories that the user chose and might have other things in.
+func OpenCache(dir string, version int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create cache %s: %w", dir, err)
+	}
+	c := &Cache{Dir: dir, version: version}
+	if version == 0 {
+		return c, nil
+	}
+	lock, err := c.Lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	current, recorded, err := c.readVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current == version && recorded {
+		return c, nil
+	}
+	if current != 0 && current != version {
+		console.Debug("Emptying cache %s, because it is version %d and this version of Keepsake uses version %d", dir, current, version)
+		if err := c.empty(); err != nil {
+			return nil, err
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, cacheVersionFile), []byte(strconv.Itoa(version)+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("Failed to write version of cache %s: %w", dir, err)
+	}
+	return c, nil
+}
+
+// Lock waits for a lock on the whole cache, which is exclusive if the cache
+// is going to be changed
+func (c *Cache) Lock(exclusive bool) (*Lock, error) {
+	return LockFile(filepath.Join(c.Dir, cacheLockFile), exclusive)
+}
+
+// LockEntry waits for an exclusive lock on the entry called name, without
+// locking the rest of the cache
+func (c *Cache) LockEntry(name string) (*Lock, error) {
+	return LockFile(filepath.Join(c.Dir, cacheEntryLocks, name), true)
+}
+
+// readVersion returns the version of the cache, or 0 if it is new, and
+// whether the version is recorded in the cache
+func (c *Cache) readVersion() (version int, recorded bool, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.Dir, cacheVersionFile))
+	if os.IsNotExist(err) {
+		empty, err := c.isEmpty()
+		if err != nil {
+			return 0, false, err
+		}
+		if empty {
+			return 0, false, nil
+		}
+		return 1, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("Failed to read version of cache %s: %w", c.Dir, err)
+	}
+	version, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		// unreadable, so treat it like a cache in another format
+		return -1, true, nil
+	}
+	return version, true, nil
+}
+
+// isEmpty returns true if the cache has nothing in it but its locks
+func (c *Cache) isEmpty() (bool, error) {
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Name() != cacheLockFile && entry.Name() != cacheEntryLocks {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// empty removes everything in the cache but its locks, which other processes
+// might be waiting on
+func (c *Cache) empty() error {
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == cacheLockFile || entry.Name() == cacheEntryLocks {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.Dir, entry.Name())); err != nil {
+			return fmt.Errorf("Failed to empty cache %s: %w", c.Dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	// made before caches had versions, so it is version 1
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "metadata"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cacheDir, "metadata", "a.json"), []byte("{}"), 0644))
+	_, err = OpenCache(cacheDir, 1)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(cacheDir, "metadata", "a.json"))
+	data, err := ioutil.ReadFile(filepath.Join(cacheDir, cacheVersionFile))
+	require.NoError(t, err)
+	require.Equal(t, "1\n", string(data))
+
+	// a new format empties it
+	_, err = OpenCache(cacheDir, 2)
+	require.NoError(t, err)
+	entries, err := ioutil.ReadDir(cacheDir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{cacheLockFile, cacheVersionFile}, names)
+
+	// directories that the user chose are never emptied
+	userDir := filepath.Join(dir, "user")
+	require.NoError(t, os.MkdirAll(userDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(userDir, cacheVersionFile), []byte("not keepsake's"), 0644))
+	_, err = OpenCache(userDir, 0)
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(filepath.Join(userDir, cacheVersionFile))
+	require.NoError(t, err)
+	require.Equal(t, "not keepsake's", string(data))
+}
+
+func TestCacheLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := OpenCache(dir, 1)
+	require.NoError(t, err)
+
+	// shared locks don't wait for each other
+	reader1, err := cache.Lock(false)
+	require.NoError(t, err)
+	reader2, err := cache.Lock(false)
+	require.NoError(t, err)
+
+	// but an exclusive lock waits for them
+	locked := make(chan *Lock)
+	go func() {
+		writer, err := cache.Lock(true)
+		require.NoError(t, err)
+		locked <- writer
+	}()
+	require.NoError(t, reader1.Unlock())
+	select {
+	case <-locked:
+		t.Fatal("exclusive lock was taken while a shared lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, reader2.Unlock())
+	writer := <-locked
+
+	// entries are locked separately from the cache
+	entry, err := cache.LockEntry("1ccccccccc")
+	require.NoError(t, err)
+	require.NoError(t, entry.Unlock())
+	require.NoError(t, writer.Unlock())
+}
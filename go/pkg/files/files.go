@@ -3,8 +3,12 @@ package files
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
 )
 
 const tempFolder = "/tmp/keepsake"
@@ -27,18 +31,46 @@ func IsDir(dirPath string) (bool, error) {
 	return file.Mode().IsDir(), nil
 }
 
-func TempDir(prefix string) (string, error) {
-	// FIXME(bfirsh): make this more unique (e.g. ai.keepsake, like some OS X applications do)
-
-	err := os.MkdirAll(tempFolder, 0755)
+// AvailableBytes returns how many bytes can be written to the filesystem that
+// p is on. p doesn't have to exist yet, in which case its nearest parent that
+// exists is used.
+func AvailableBytes(p string) (uint64, error) {
+	p, err := filepath.Abs(p)
 	if err != nil {
-		return "", fmt.Errorf("Failed to create temporary directory %s: %w", tempFolder, err)
+		return 0, err
 	}
-	name, err := ioutil.TempDir(tempFolder, prefix+"-")
-	if err != nil {
-		return "", fmt.Errorf("Failed to create temporary directory at %s: %w", tempFolder, err)
+	for {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(p, &stat)
+		if err == nil {
+			return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+		}
+		parent := filepath.Dir(p)
+		if !os.IsNotExist(err) || parent == p {
+			return 0, fmt.Errorf("Failed to determine the free space at %s: %w", p, err)
+		}
+		p = parent
 	}
-	return name, nil
+}
+
+// DirSize returns the total size of the regular files in p, which can be a
+// file or a directory
+func DirSize(p string) (int64, error) {
+	var size int64
+	err := filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files can be removed by other processes while this walks
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
 }
 
 func DirIsEmpty(dirPath string) (bool, error) {
@@ -64,8 +96,13 @@ func CopyFile(src string, dest string) error {
 		return fmt.Errorf("Failed to open %s while copying to %s: %w", src, dest, err)
 	}
 	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("Failed to open %s while copying to %s: %w", src, dest, err)
+	}
 
-	out, err := os.Create(dest)
+	// keep the permissions, so executable files stay executable
+	out, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return fmt.Errorf("Failed to create %s while copying %s: %w", dest, src, err)
 	}
@@ -77,3 +114,110 @@ func CopyFile(src string, dest string) error {
 	}
 	return out.Close()
 }
+
+// LinkDir hard-links every file in src into the same place in dest, creating
+// directories as needed and replacing files that are already there. Files
+// are copied instead if they can't be linked, e.g. because dest is on another
+// filesystem. Symlinks are recreated in dest with the same target.
+//
+// Linked files are made read-only in src too, because they are the same
+// file, so editing one in dest fails instead of silently changing src.
+func LinkDir(src string, dest string) error {
+	return filepath.Walk(src, func(srcPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return err
+		}
+		destPath, err := JoinWithin(dest, relPath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				return fmt.Errorf("Failed to create directory %s: %w", destPath, err)
+			}
+			return nil
+		}
+		isSymlink := info.Mode()&os.ModeSymlink != 0
+		if !info.Mode().IsRegular() && !isSymlink {
+			return nil
+		}
+		if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to replace %s: %w", destPath, err)
+		}
+		if isSymlink {
+			target, err := os.Readlink(srcPath)
+			if err != nil {
+				return fmt.Errorf("Failed to read symlink %s: %w", srcPath, err)
+			}
+			if err := os.Symlink(target, destPath); err != nil {
+				return fmt.Errorf("Failed to create symlink %s: %w", destPath, err)
+			}
+			return nil
+		}
+		perm := info.Mode().Perm()
+		if err := os.Chmod(srcPath, perm&^0222); err != nil {
+			return fmt.Errorf("Failed to make %s read-only: %w", srcPath, err)
+		}
+		if err := os.Link(srcPath, destPath); err != nil {
+			// copies aren't shared with src, so they can stay writable
+			if err := CopyFile(srcPath, destPath); err != nil {
+				return err
+			}
+			return os.Chmod(destPath, perm)
+		}
+		return nil
+	})
+}
+
+// JoinWithin joins relPath, a slash-separated path that came from a
+// repository, onto dir. It returns an error if the result would be outside
+// dir, because relPath is absolute or has "..", or because a directory in the
+// way is a symlink to somewhere outside dir. Paths in a corrupted or
+// malicious repository could otherwise overwrite any file the user can write.
+func JoinWithin(dir string, relPath string) (string, error) {
+	joined := filepath.Join(dir, filepath.FromSlash(relPath))
+	if filepath.IsAbs(filepath.FromSlash(relPath)) || !isWithin(dir, joined) {
+		return "", errors.Corrupt(fmt.Sprintf("Refusing to write %q, because it is outside %s", relPath, dir))
+	}
+	if joined == filepath.Clean(dir) {
+		return joined, nil
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if os.IsNotExist(err) {
+		// nothing exists yet, so there are no symlinks to follow
+		return joined, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// the nearest directory that exists is where symlinks would be followed from
+	// dir exists, so this stops at dir at the latest
+	parent := filepath.Dir(joined)
+	for {
+		if _, err := os.Lstat(parent); !os.IsNotExist(err) {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+	realParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(realDir, realParent) {
+		return "", errors.Corrupt(fmt.Sprintf("Refusing to write %q, because %s is a link to %s, which is outside %s", relPath, parent, realParent, dir))
+	}
+	return joined, nil
+}
+
+// isWithin returns true if p is dir or inside it
+func isWithin(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,106 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestJoinWithin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	outDir := filepath.Join(dir, "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(outDir, "model"), 0755))
+
+	for relPath, expected := range map[string]string{
+		".":                       outDir,
+		"weights.pth":             filepath.Join(outDir, "weights.pth"),
+		"model/weights.pth":       filepath.Join(outDir, "model", "weights.pth"),
+		"new/dir/weights.pth":     filepath.Join(outDir, "new", "dir", "weights.pth"),
+		"model/../weights.pth":    filepath.Join(outDir, "weights.pth"),
+		"does-not-exist/../a.txt": filepath.Join(outDir, "a.txt"),
+	} {
+		actual, err := JoinWithin(outDir, relPath)
+		require.NoError(t, err, relPath)
+		require.Equal(t, expected, actual, relPath)
+	}
+
+	for _, relPath := range []string{"..", "../outside", "model/../../outside", "/etc/passwd"} {
+		_, err := JoinWithin(outDir, relPath)
+		require.True(t, errors.IsCorrupt(err), relPath)
+	}
+
+	// a directory in the way that links outside
+	require.NoError(t, os.Symlink(dir, filepath.Join(outDir, "link")))
+	_, err = JoinWithin(outDir, "link/evil")
+	require.True(t, errors.IsCorrupt(err))
+	_, err = JoinWithin(outDir, "link/new/evil")
+	require.True(t, errors.IsCorrupt(err))
+	// but links inside are fine
+	require.NoError(t, os.Symlink(filepath.Join(outDir, "model"), filepath.Join(outDir, "model-link")))
+	_, err = JoinWithin(outDir, "model-link/weights.pth")
+	require.NoError(t, err)
+
+	// nothing exists yet
+	_, err = JoinWithin(filepath.Join(dir, "new"), "weights.pth")
+	require.NoError(t, err)
+}
+
+func TestLinkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "model", "weights.pth"), []byte("weights"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "train.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.Symlink("model/weights.pth", filepath.Join(src, "latest.pth")))
+
+	require.NoError(t, LinkDir(src, dest))
+	contents, err := ioutil.ReadFile(filepath.Join(dest, "model", "weights.pth"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(contents))
+
+	// linked files are read-only, so they can't be edited through dest
+	info, err := os.Stat(filepath.Join(dest, "model", "weights.pth"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0444), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(src, "train.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0555), info.Mode().Perm())
+
+	target, err := os.Readlink(filepath.Join(dest, "latest.pth"))
+	require.NoError(t, err)
+	require.Equal(t, "model/weights.pth", target)
+
+	// linking again replaces what is there
+	require.NoError(t, LinkDir(src, dest))
+}
+
+func TestDirSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "train.py"), make([]byte, 10), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "model", "weights.pth"), make([]byte, 100), 0644))
+	// links aren't followed
+	require.NoError(t, os.Symlink(filepath.Join(dir, "model", "weights.pth"), filepath.Join(dir, "link.pth")))
+
+	size, err := DirSize(dir)
+	require.NoError(t, err)
+	require.Equal(t, int64(110), size)
+	size, err = DirSize(filepath.Join(dir, "model", "weights.pth"))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), size)
+	size, err = DirSize(filepath.Join(dir, "does-not-exist"))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), size)
+}
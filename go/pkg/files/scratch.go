@@ -0,0 +1,159 @@
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// ScratchOptions configures the scratch directory, where temporary files are
+// written while uploading, downloading, and extracting
+type ScratchOptions struct {
+	// Dir is the scratch directory. It is created if it doesn't exist.
+	Dir string
+	// MaxBytes is how much the scratch directory can hold before TempDir
+	// fails, or 0 for no limit
+	MaxBytes int64
+	// MaxAge is how old an entry can get before it is cleaned up, even if the
+	// process that made it is still running
+	MaxAge time.Duration
+}
+
+// DefaultMaxScratchAge is how old entries in the scratch directory get
+// before they are cleaned up, if it isn't configured
+const DefaultMaxScratchAge = 7 * 24 * time.Hour
+
+var (
+	scratchMu sync.Mutex
+	scratch   = ScratchOptions{Dir: tempFolder, MaxAge: DefaultMaxScratchAge}
+	// cleanedScratchDirs are the scratch directories that have been cleaned
+	// up by this process
+	cleanedScratchDirs = map[string]bool{}
+)
+
+// scratchEntryPattern matches the names of entries made by TempDir, which
+// have the PID of the process that made them
+var scratchEntryPattern = regexp.MustCompile(`-(\d+)-\d+$`)
+
+// ConfigureScratch sets the scratch directory and its limits. Dir defaults to
+// KEEPSAKE_SCRATCH_DIR, or /tmp/keepsake, and MaxAge to DefaultMaxScratchAge.
+func ConfigureScratch(opts ScratchOptions) {
+	if opts.Dir == "" {
+		opts.Dir = defaultScratchDir()
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxScratchAge
+	}
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+	scratch = opts
+}
+
+// ScratchDir returns the scratch directory
+func ScratchDir() string {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+	return scratch.Dir
+}
+
+func defaultScratchDir() string {
+	if dir := os.Getenv("KEEPSAKE_SCRATCH_DIR"); dir != "" {
+		return dir
+	}
+	return tempFolder
+}
+
+// TempDir creates a new directory in the scratch directory. The first time
+// it is called, stale entries left behind by other processes are cleaned up.
+// It fails if the scratch directory is using more than its limit.
+func TempDir(prefix string) (string, error) {
+	scratchMu.Lock()
+	opts := scratch
+	cleaned := cleanedScratchDirs[opts.Dir]
+	cleanedScratchDirs[opts.Dir] = true
+	scratchMu.Unlock()
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to create temporary directory %s: %w", opts.Dir, err)
+	}
+	if !cleaned {
+		if removed, freed, err := CleanScratch(opts, time.Now()); err != nil {
+			console.Debug("Failed to clean up scratch directory %s: %v", opts.Dir, err)
+		} else if removed > 0 {
+			console.Debug("Removed %d stale entries (%s) from scratch directory %s", removed, console.FormatBytes(uint64(freed)), opts.Dir)
+		}
+	}
+	if opts.MaxBytes > 0 {
+		used, err := DirSize(opts.Dir)
+		if err != nil {
+			return "", fmt.Errorf("Failed to determine the size of %s: %w", opts.Dir, err)
+		}
+		if used >= opts.MaxBytes {
+			return "", errors.InsufficientDiskSpace(fmt.Sprintf("The scratch directory %s is using %s, which is over its limit of %s. Other Keepsake commands may be using it. If they aren't, delete what's in it, or raise scratch.max_size in keepsake.yaml.", opts.Dir, console.FormatBytes(uint64(used)), console.FormatBytes(uint64(opts.MaxBytes))))
+		}
+	}
+
+	name, err := ioutil.TempDir(opts.Dir, fmt.Sprintf("%s-%d-", prefix, os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("Failed to create temporary directory at %s: %w", opts.Dir, err)
+	}
+	return name, nil
+}
+
+// CleanScratch removes the entries in the scratch directory that were made
+// by processes that aren't running any more, or that are older than
+// opts.MaxAge. It returns how many entries were removed, and how many bytes
+// that freed.
+func CleanScratch(opts ScratchOptions, now time.Time) (removed int, freed int64, err error) {
+	entries, err := ioutil.ReadDir(opts.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if !isStaleScratchEntry(entry, opts.MaxAge, now) {
+			continue
+		}
+		p := filepath.Join(opts.Dir, entry.Name())
+		size, err := DirSize(p)
+		if err != nil {
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			console.Debug("Failed to remove stale scratch entry %s: %v", p, err)
+			continue
+		}
+		removed++
+		freed += size
+	}
+	return removed, freed, nil
+}
+
+func isStaleScratchEntry(entry os.FileInfo, maxAge time.Duration, now time.Time) bool {
+	if now.Sub(entry.ModTime()) > maxAge {
+		return true
+	}
+	match := scratchEntryPattern.FindStringSubmatch(entry.Name())
+	if match == nil {
+		// made by an older version of Keepsake, so only the age is known
+		return false
+	}
+	pid, err := strconv.Atoi(match[1])
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	// signal 0 checks the process exists. EPERM means it exists, but belongs to another user.
+	err = syscall.Kill(pid, 0)
+	return !(err == nil || err == syscall.EPERM)
+}
@@ -0,0 +1,89 @@
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestScratch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer ConfigureScratch(ScratchOptions{})
+
+	scratchDir := filepath.Join(dir, "scratch")
+	require.NoError(t, os.MkdirAll(scratchDir, 0755))
+
+	// made by a process that isn't running any more
+	dead := filepath.Join(scratchDir, "keepsake-copy-999999999-123")
+	require.NoError(t, os.MkdirAll(dead, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dead, "weights"), []byte("weights"), 0644))
+	// made by this process, but old
+	old := filepath.Join(scratchDir, fmt.Sprintf("keepsake-copy-%d-456", os.Getpid()))
+	require.NoError(t, os.MkdirAll(old, 0755))
+	oldTime := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(old, oldTime, oldTime))
+	// made by this process
+	current := filepath.Join(scratchDir, fmt.Sprintf("keepsake-copy-%d-789", os.Getpid()))
+	require.NoError(t, os.MkdirAll(current, 0755))
+	// made by an older version of Keepsake
+	unknown := filepath.Join(scratchDir, "keepsake-copy-789")
+	require.NoError(t, os.MkdirAll(unknown, 0755))
+
+	ConfigureScratch(ScratchOptions{Dir: scratchDir, MaxAge: time.Hour})
+	require.Equal(t, scratchDir, ScratchDir())
+	tempDir, err := TempDir("keepsake-copy")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(filepath.Base(tempDir), fmt.Sprintf("keepsake-copy-%d-", os.Getpid())))
+
+	for _, p := range []string{dead, old} {
+		_, err = os.Stat(p)
+		require.True(t, os.IsNotExist(err), p)
+	}
+	for _, p := range []string{current, unknown, tempDir} {
+		_, err = os.Stat(p)
+		require.NoError(t, err, p)
+	}
+
+	// nothing is removed after the first time
+	removed, freed, err := CleanScratch(ScratchOptions{Dir: scratchDir, MaxAge: time.Hour}, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 0, removed)
+	require.Equal(t, int64(0), freed)
+}
+
+func TestScratchMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer ConfigureScratch(ScratchOptions{})
+
+	ConfigureScratch(ScratchOptions{Dir: dir, MaxBytes: 10})
+	tempDir, err := TempDir("keepsake-test")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "weights"), make([]byte, 10), 0644))
+	_, err = TempDir("keepsake-test")
+	require.True(t, errors.IsInsufficientDiskSpace(err))
+}
+
+func TestDefaultScratchDir(t *testing.T) {
+	defer ConfigureScratch(ScratchOptions{})
+	defer os.Unsetenv("KEEPSAKE_SCRATCH_DIR")
+
+	os.Unsetenv("KEEPSAKE_SCRATCH_DIR")
+	ConfigureScratch(ScratchOptions{})
+	require.Equal(t, "/tmp/keepsake", ScratchDir())
+
+	os.Setenv("KEEPSAKE_SCRATCH_DIR", "/scratch")
+	ConfigureScratch(ScratchOptions{})
+	require.Equal(t, "/scratch", ScratchDir())
+}
@@ -0,0 +1,106 @@
+// Package github posts comments on GitHub pull requests, for reporting the
+// results of experiments run in CI
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the GitHub API that is used if GITHUB_API_URL isn't set
+const DefaultAPIURL = "https://api.github.com"
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Client calls the GitHub API for a repository
+type Client struct {
+	// APIURL is the GitHub API, e.g. https://api.github.com, or the API of a
+	// GitHub Enterprise server
+	APIURL string
+	// Repository is the repository, as <owner>/<name>
+	Repository string
+	Token      string
+}
+
+// Comment is a comment on an issue or pull request
+type Comment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// UpsertComment updates the comment on pull request number that contains
+// marker, or adds a new comment if there isn't one, so a report can be kept
+// up to date without adding a comment each time it changes. body must
+// contain marker.
+func (c *Client) UpsertComment(number int, marker string, body string) (comment *Comment, created bool, err error) {
+	comments, err := c.listComments(number)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, existing := range comments {
+		if strings.Contains(existing.Body, marker) {
+			comment = new(Comment)
+			err := c.request(http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", c.Repository, existing.ID), map[string]string{"body": body}, comment)
+			return comment, false, err
+		}
+	}
+	comment = new(Comment)
+	err = c.request(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", c.Repository, number), map[string]string{"body": body}, comment)
+	return comment, true, err
+}
+
+func (c *Client) listComments(number int) ([]*Comment, error) {
+	comments := []*Comment{}
+	for page := 1; ; page++ {
+		pageComments := []*Comment{}
+		if err := c.request(http.MethodGet, fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100&page=%d", c.Repository, number, page), nil, &pageComments); err != nil {
+			return nil, err
+		}
+		comments = append(comments, pageComments...)
+		if len(pageComments) < 100 {
+			return comments, nil
+		}
+	}
+}
+
+func (c *Client) request(method string, path string, body interface{}, result interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	url := strings.TrimRight(c.APIURL, "/") + path
+	req, err := http.NewRequest(method, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "token "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to call the GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed to read the response from %s %s: %w", method, url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s failed with %s: %s", method, url, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("Failed to parse the response from %s %s: %w", method, url, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub is enough of the GitHub API to list, add, and edit comments on
+// one pull request
+type fakeGitHub struct {
+	comments []*Comment
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "token secret-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var body map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/models/issues/12/comments":
+		_ = json.NewEncoder(w).Encode(f.comments)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/acme/models/issues/12/comments":
+		comment := &Comment{ID: int64(len(f.comments) + 1), Body: body["body"]}
+		comment.HTMLURL = fmt.Sprintf("https://github.com/acme/models/pull/12#issuecomment-%d", comment.ID)
+		f.comments = append(f.comments, comment)
+		_ = json.NewEncoder(w).Encode(comment)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/repos/acme/models/issues/comments/"):
+		for _, comment := range f.comments {
+			if r.URL.Path == fmt.Sprintf("/repos/acme/models/issues/comments/%d", comment.ID) {
+				comment.Body = body["body"]
+				_ = json.NewEncoder(w).Encode(comment)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUpsertComment(t *testing.T) {
+	fake := &fakeGitHub{comments: []*Comment{{ID: 1, Body: "LGTM"}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := &Client{APIURL: server.URL, Repository: "acme/models", Token: "secret-token"}
+
+	comment, created, err := client.UpsertComment(12, "<!-- report -->", "<!-- report -->\nfirst")
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, int64(2), comment.ID)
+
+	comment, created, err = client.UpsertComment(12, "<!-- report -->", "<!-- report -->\nsecond")
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, int64(2), comment.ID)
+	require.Len(t, fake.comments, 2)
+	require.Equal(t, "LGTM", fake.comments[0].Body)
+	require.Equal(t, "<!-- report -->\nsecond", fake.comments[1].Body)
+
+	client.Token = "wrong-token"
+	_, _, err = client.UpsertComment(12, "<!-- report -->", "<!-- report -->\nthird")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401 Unauthorized")
+}
@@ -6,6 +6,37 @@ var Environment = "development" // set in Makefile
 var ConfigFilenames []string = []string{"keepsake.yaml", "keepsake.yml", "replicate.yaml", "replicate.yml"}
 var DeprecatedConfigFilenames []string = []string{"replicate.yaml", "replicate.yml"}
 var Verbose = false
+
+// If DryRun is true, commands print what they would write, delete, or start,
+// instead of doing it
+var DryRun = false
+
+// If ReadOnly is true, repositories are opened read-only, so anything that
+// would write to or delete from them fails
+var ReadOnly = false
+
+// If VerboseTransfers is true, every object uploaded to or downloaded from a
+// repository is logged, and written to the transfer manifest at
+// TransferManifest. If TransferManifest is empty, a file in the temporary
+// directory is used.
+var VerboseTransfers = false
+var TransferManifest = ""
+
+// If FsyncDownloads is true, files downloaded from repositories are synced to
+// disk before they are moved into place, so they survive a crash or power
+// loss straight after a checkout. It is slower.
+var FsyncDownloads = false
+
+// Files to write a CPU profile, heap profile, and execution trace to, set with
+// --cpuprofile, --memprofile, and --trace. Empty if they aren't wanted.
+var CPUProfile = ""
+var MemProfile = ""
+var Trace = ""
+
+// If PprofAddr is set, with KEEPSAKE_PPROF_ADDR, the daemon serves
+// net/http/pprof on it, e.g. localhost:6060
+var PprofAddr = ""
+
 var WebURL = "https://keepsake.ai"
 var Color = true
 var ProjectDirectory = ""
@@ -13,6 +44,19 @@ var BugsEmail = "bugs@replicate.ai"
 var SegmentKey = "MKaYmSZ2hW6P8OegI9g0sufjZeUh28g7"
 var S3Region = "us-east-1"
 
+// Where to send opt-in telemetry (see analytics.TrackTelemetry). Set in the
+// Makefile, or with KEEPSAKE_TELEMETRY_ENDPOINT. If empty, no telemetry is sent.
+var TelemetryEndpoint = ""
+
+// Where `keepsake update` looks for new releases, which `make publish-release`
+// uploads. Can be overridden with KEEPSAKE_RELEASE_URL.
+var ReleaseURL = "https://storage.googleapis.com/replicate-public/cli/latest.json"
+
+// Base64-encoded ed25519 public key that releases are signed with. Set in the
+// Makefile, which requires it for production builds. If empty, `keepsake
+// update` refuses to install anything.
+var ReleasePublicKey = ""
+
 func init() {
 	if Environment == "development" {
 		Version += "-dev"
@@ -0,0 +1,135 @@
+// Package hooks runs user-defined commands when things happen to experiments,
+// so teams can add their own side effects (e.g. posting to chat, registering
+// models) without changing Keepsake
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+// Events that hooks can be run on
+const (
+	ExperimentCreated = "experiment-created"
+	CheckpointSaved   = "checkpoint-saved"
+	RunFinished       = "run-finished"
+)
+
+// Events is every event that hooks can be run on
+var Events = []string{ExperimentCreated, CheckpointSaved, RunFinished}
+
+// Dir is where executable hooks are looked for, relative to the project directory
+const Dir = ".keepsake/hooks"
+
+// Timeout is how long a hook can run before it is killed
+var Timeout = time.Minute
+
+// IsEvent returns true if event is a known event
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Configured returns true if there are any hooks to run for event
+func Configured(projectDir string, commands []string, event string) bool {
+	if len(commands) > 0 {
+		return true
+	}
+	if projectDir == "" {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(projectDir, Dir, event))
+	return err == nil && !info.IsDir()
+}
+
+// Run runs the hooks for event with payload encoded as JSON on stdin. These are
+// the executable .keepsake/hooks/<event> in projectDir, if it exists, followed by
+// each of commands, which are run with "sh -c". Hooks are run in projectDir with
+// KEEPSAKE_HOOK_EVENT set to the event, and their output goes to stderr.
+//
+// All the hooks are run even if some fail. The returned error describes every
+// hook that failed.
+func Run(projectDir string, commands []string, event string, payload interface{}) error {
+	toRun := hooksToRun(projectDir, commands, event)
+	if len(toRun) == 0 {
+		return nil
+	}
+
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to serialize payload for %s hooks: %w", event, err)
+	}
+
+	failures := []string{}
+	for _, args := range toRun {
+		start := time.Now()
+		if err := runHook(projectDir, event, args, stdin); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", args[len(args)-1], err))
+			continue
+		}
+		console.Debug("Ran %s hook %q (took %.3f seconds)", event, args[len(args)-1], time.Since(start).Seconds())
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s hooks failed:\n%s", event, strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// List returns the hooks Run would run for event: the path of the hook in
+// projectDir, if there is one, followed by commands
+func List(projectDir string, commands []string, event string) []string {
+	hooks := []string{}
+	for _, args := range hooksToRun(projectDir, commands, event) {
+		hooks = append(hooks, args[len(args)-1])
+	}
+	return hooks
+}
+
+func hooksToRun(projectDir string, commands []string, event string) [][]string {
+	toRun := [][]string{}
+	if projectDir != "" {
+		hookPath := filepath.Join(projectDir, Dir, event)
+		info, err := os.Stat(hookPath)
+		if err == nil && !info.IsDir() {
+			if info.Mode()&0111 == 0 {
+				console.Warn("%s is not executable, so it will not be run. To run it, run 'chmod +x %s'", hookPath, hookPath)
+			} else {
+				toRun = append(toRun, []string{hookPath})
+			}
+		}
+	}
+	for _, command := range commands {
+		toRun = append(toRun, []string{"sh", "-c", command})
+	}
+	return toRun
+}
+
+func runHook(projectDir string, event string, args []string, stdin []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = projectDir
+	cmd.Env = append(os.Environ(), "KEEPSAKE_HOOK_EVENT="+event)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", Timeout)
+	}
+	return err
+}
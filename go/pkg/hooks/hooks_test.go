@@ -0,0 +1,87 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	require.False(t, Configured(projectDir, nil, CheckpointSaved))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, Dir), 0755))
+	script := "#!/bin/sh\ncat > executable-hook.json\necho $KEEPSAKE_HOOK_EVENT > executable-hook-event\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, Dir, CheckpointSaved), []byte(script), 0755))
+	require.True(t, Configured(projectDir, nil, CheckpointSaved))
+	require.False(t, Configured(projectDir, nil, RunFinished))
+
+	payload := map[string]string{"foo": "bar"}
+	err = Run(projectDir, []string{"cat > config-hook.json"}, CheckpointSaved, payload)
+	require.NoError(t, err)
+
+	for _, filename := range []string{"executable-hook.json", "config-hook.json"} {
+		data, err := ioutil.ReadFile(filepath.Join(projectDir, filename))
+		require.NoError(t, err)
+		require.JSONEq(t, `{"foo": "bar"}`, string(data))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(projectDir, "executable-hook-event"))
+	require.NoError(t, err)
+	require.Equal(t, "checkpoint-saved\n", string(data))
+}
+
+func TestRunFailures(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	// later hooks still run if one fails
+	err = Run(projectDir, []string{"exit 1", "touch ran"}, RunFinished, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exit 1: exit status 1")
+	_, err = os.Stat(filepath.Join(projectDir, "ran"))
+	require.NoError(t, err)
+}
+
+func TestPostWebhook(t *testing.T) {
+	var body []byte
+	var header http.Header
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	err := PostWebhook(server.URL, "s3cret", CheckpointSaved, map[string]string{"foo": "bar"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"foo": "bar"}`, string(body))
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.Equal(t, CheckpointSaved, header.Get(EventHeader))
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	require.InDelta(t, time.Now().Unix(), timestamp, 5)
+	require.Equal(t, Sign("s3cret", header.Get(TimestampHeader), body), header.Get(SignatureHeader))
+	// echo -n '1600000000.{"foo":"bar"}' | openssl dgst -sha256 -hmac s3cret
+	require.Equal(t, "sha256=dc3650202e39ab6c4eec726ba7dc76a154207f9ca753ef16484ba20132240e50", Sign("s3cret", "1600000000", []byte(`{"foo":"bar"}`)))
+
+	err = PostWebhook(server.URL, "", CheckpointSaved, nil)
+	require.NoError(t, err)
+	require.Empty(t, header.Get(SignatureHeader))
+
+	status = http.StatusInternalServerError
+	err = PostWebhook(server.URL, "", RunFinished, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "500 Internal Server Error")
+}
@@ -0,0 +1,76 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+// SignatureHeader is the header webhooks are signed in, as
+// "sha256=<hex HMAC-SHA256 of the timestamp, a ".", and the body>"
+const SignatureHeader = "X-Keepsake-Signature"
+
+// TimestampHeader is the header with the time a webhook was sent, in seconds
+// since the Unix epoch. It is included in the signature, so receivers should
+// reject webhooks with a timestamp more than a few minutes old, otherwise a
+// captured webhook could be sent to them again.
+const TimestampHeader = "X-Keepsake-Timestamp"
+
+// EventHeader is the header with the event a webhook was sent for
+const EventHeader = "X-Keepsake-Event"
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// PostWebhook sends payload as JSON to url for event. If secret isn't empty,
+// the timestamp and body are signed with it, so the receiver can check the
+// webhook came from Keepsake, wasn't changed on the way, and isn't a replay.
+func PostWebhook(url string, secret string, event string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to serialize payload for %s webhook: %w", event, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Failed to create %s webhook to %s: %w", event, url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "keepsake-webhook")
+	req.Header.Set(EventHeader, event)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	start := time.Now()
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s webhook to %s failed: %w", event, url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s webhook to %s failed: it responded with %s", event, url, resp.Status)
+	}
+	console.Debug("Sent %s webhook to %s (took %.3f seconds)", event, url, time.Since(start).Seconds())
+	return nil
+}
+
+// Sign returns the signature of a webhook body sent at timestamp, as it is
+// sent in SignatureHeader
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,443 @@
+package param
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is arithmetic over metrics, like
+// "2 * precision * recall / (precision + recall)" or "ema(loss, 0.9)"
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// MetricSource is where an expression gets the values of the metrics it
+// refers to
+type MetricSource interface {
+	// Metric returns the value of a metric, and false if it isn't set or
+	// isn't a number
+	Metric(name string) (float64, bool)
+	// MetricHistory returns the values of a metric up to and including the
+	// current one, oldest first, skipping those where it isn't a number
+	MetricHistory(name string) []float64
+}
+
+type exprNode interface {
+	eval(src MetricSource) (float64, bool)
+	names() []string
+}
+
+type numberNode struct{ value float64 }
+type metricNode struct{ name string }
+type negateNode struct{ node exprNode }
+
+type binaryNode struct {
+	op          rune
+	left, right exprNode
+}
+
+type callNode struct {
+	function string
+	args     []exprNode
+}
+
+// historyNode is a function of a metric's values in the current and earlier
+// checkpoints
+type historyNode struct {
+	function string
+	metric   string
+	arg      float64
+}
+
+func (n *numberNode) eval(src MetricSource) (float64, bool) { return n.value, true }
+func (n *numberNode) names() []string                       { return nil }
+
+func (n *metricNode) eval(src MetricSource) (float64, bool) { return src.Metric(n.name) }
+func (n *metricNode) names() []string                       { return []string{n.name} }
+
+func (n *negateNode) eval(src MetricSource) (float64, bool) {
+	v, ok := n.node.eval(src)
+	return -v, ok
+}
+func (n *negateNode) names() []string { return n.node.names() }
+
+func (n *binaryNode) eval(src MetricSource) (float64, bool) {
+	left, ok := n.left.eval(src)
+	if !ok {
+		return 0, false
+	}
+	right, ok := n.right.eval(src)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		return left / right, true
+	}
+	panic(fmt.Sprintf("Unknown operator: %c", n.op))
+}
+func (n *binaryNode) names() []string { return append(n.left.names(), n.right.names()...) }
+
+func (n *callNode) eval(src MetricSource) (float64, bool) {
+	args := []float64{}
+	for _, arg := range n.args {
+		v, ok := arg.eval(src)
+		if !ok {
+			return 0, false
+		}
+		args = append(args, v)
+	}
+	switch n.function {
+	case "abs":
+		return math.Abs(args[0]), true
+	case "sqrt":
+		return math.Sqrt(args[0]), true
+	case "log":
+		return math.Log(args[0]), true
+	case "exp":
+		return math.Exp(args[0]), true
+	case "min":
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Min(result, v)
+		}
+		return result, true
+	case "max":
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Max(result, v)
+		}
+		return result, true
+	}
+	panic(fmt.Sprintf("Unknown function: %s", n.function))
+}
+func (n *callNode) names() []string {
+	names := []string{}
+	for _, arg := range n.args {
+		names = append(names, arg.names()...)
+	}
+	return names
+}
+
+func (n *historyNode) eval(src MetricSource) (float64, bool) {
+	// only defined where the metric is, so smoothing doesn't carry a value
+	// into checkpoints that don't have it
+	if _, ok := src.Metric(n.metric); !ok {
+		return 0, false
+	}
+	history := src.MetricHistory(n.metric)
+	if len(history) == 0 {
+		return 0, false
+	}
+	switch n.function {
+	case "mean":
+		window := int(n.arg)
+		if len(history) > window {
+			history = history[len(history)-window:]
+		}
+		sum := 0.0
+		for _, v := range history {
+			sum += v
+		}
+		return sum / float64(len(history)), true
+	case "ema":
+		smoothed := history[0]
+		for _, v := range history[1:] {
+			smoothed = n.arg*smoothed + (1-n.arg)*v
+		}
+		return smoothed, true
+	}
+	panic(fmt.Sprintf("Unknown function: %s", n.function))
+}
+func (n *historyNode) names() []string { return []string{n.metric} }
+
+// functions that take numbers, and how many arguments they take (-1 for one
+// or more)
+var expressionFunctions = map[string]int{
+	"abs":  1,
+	"sqrt": 1,
+	"log":  1,
+	"exp":  1,
+	"min":  -1,
+	"max":  -1,
+}
+
+// ParseExpression parses an arithmetic expression over metrics. Expressions
+// can use numbers, metric names, "+", "-", "*", "/", parentheses, and the
+// functions abs, sqrt, log, exp, min, and max. Names that aren't made of
+// letters, numbers, "_" and "." must be quoted, e.g. "val-loss".
+//
+// mean(<metric>, <n>) is the mean of a metric over the current and previous
+// n-1 checkpoints, and ema(<metric>, <smoothing>) is its exponential moving
+// average, where smoothing is between 0 (none) and 1, like in TensorBoard.
+func ParseExpression(s string) (*Expression, error) {
+	tokens, err := tokenizeExpression(s)
+	if err != nil {
+		return nil, expressionError(s, err)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, expressionError(s, err)
+	}
+	if tok := p.peek(); tok.kind != exprTokenEOF {
+		return nil, expressionError(s, fmt.Errorf("unexpected %s", tok))
+	}
+	return &Expression{source: s, root: root}, nil
+}
+
+func expressionError(s string, err error) error {
+	return fmt.Errorf("Failed to parse expression %q: %s", s, err)
+}
+
+// Eval returns the value of the expression, and false if a metric it refers
+// to isn't set, or the result isn't a finite number
+func (e *Expression) Eval(src MetricSource) (float64, bool) {
+	v, ok := e.root.eval(src)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// Names returns the names of the metrics the expression refers to, sorted
+func (e *Expression) Names() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, name := range e.root.names() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+type exprTokenKind int
+
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenNumber
+	exprTokenName
+	exprTokenOperator
+	exprTokenComma
+	exprTokenOpenParen
+	exprTokenCloseParen
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value float64
+}
+
+func (t exprToken) String() string {
+	if t.kind == exprTokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func tokenizeExpression(s string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	runes := []rune(s)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, exprToken{kind: exprTokenOpenParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, exprToken{kind: exprTokenCloseParen, text: ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, exprToken{kind: exprTokenComma, text: ","})
+			i++
+		case strings.ContainsRune("+-*/", r):
+			tokens = append(tokens, exprToken{kind: exprTokenOperator, text: string(r)})
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated name")
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenName, text: string(runes[i+1 : j])})
+			i = j + 1
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'e' || runes[j] == 'E' || ((runes[j] == '-' || runes[j] == '+') && (runes[j-1] == 'e' || runes[j-1] == 'E'))) {
+				j++
+			}
+			text := string(runes[i:j])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", text)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenNumber, text: text, value: value})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenName, text: string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return append(tokens, exprToken{kind: exprTokenEOF}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != exprTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.kind == exprTokenOperator && (tok.text == "+" || tok.text == "-"); tok = p.peek() {
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: rune(tok.text[0]), left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.kind == exprTokenOperator && (tok.text == "*" || tok.text == "/"); tok = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: rune(tok.text[0]), left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if tok := p.peek(); tok.kind == exprTokenOperator && tok.text == "-" {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negateNode{node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case exprTokenNumber:
+		return &numberNode{tok.value}, nil
+	case exprTokenOpenParen:
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != exprTokenCloseParen {
+			return nil, fmt.Errorf("expected \")\", got %s", tok)
+		}
+		return node, nil
+	case exprTokenName:
+		if p.peek().kind == exprTokenOpenParen {
+			return p.parseCall(tok.text)
+		}
+		return &metricNode{tok.text}, nil
+	}
+	return nil, fmt.Errorf("expected a number, metric or \"(\", got %s", tok)
+}
+
+func (p *exprParser) parseCall(function string) (exprNode, error) {
+	p.next() // (
+	args := []exprNode{}
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		tok := p.next()
+		if tok.kind == exprTokenCloseParen {
+			break
+		}
+		if tok.kind != exprTokenComma {
+			return nil, fmt.Errorf("expected \",\" or \")\", got %s", tok)
+		}
+	}
+
+	switch function {
+	case "mean", "ema":
+		metric, ok := args[0].(*metricNode)
+		if len(args) != 2 || !ok {
+			return nil, fmt.Errorf("%s() takes a metric and a number, like %s(loss, %s)", function, function, map[string]string{"mean": "10", "ema": "0.9"}[function])
+		}
+		number, ok := args[1].(*numberNode)
+		if !ok {
+			return nil, fmt.Errorf("the second argument of %s() must be a number", function)
+		}
+		if function == "mean" && (number.value < 1 || number.value != math.Trunc(number.value)) {
+			return nil, fmt.Errorf("the number of checkpoints to average in mean() must be a whole number of at least 1")
+		}
+		if function == "ema" && (number.value < 0 || number.value >= 1) {
+			return nil, fmt.Errorf("the smoothing in ema() must be at least 0 and less than 1")
+		}
+		return &historyNode{function: function, metric: metric.name, arg: number.value}, nil
+	}
+
+	numArgs, ok := expressionFunctions[function]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", function)
+	}
+	if numArgs != -1 && len(args) != numArgs {
+		return nil, fmt.Errorf("%s() takes %d argument(s), not %d", function, numArgs, len(args))
+	}
+	return &callNode{function: function, args: args}, nil
+}
@@ -0,0 +1,82 @@
+package param
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testMetrics is a MetricSource with the history of each metric, the last of
+// which is the current value
+type testMetrics map[string][]float64
+
+func (m testMetrics) Metric(name string) (float64, bool) {
+	history := m[name]
+	if len(history) == 0 {
+		return 0, false
+	}
+	return history[len(history)-1], true
+}
+
+func (m testMetrics) MetricHistory(name string) []float64 {
+	return m[name]
+}
+
+func TestExpression(t *testing.T) {
+	metrics := testMetrics{
+		"precision": {0.5},
+		"recall":    {1},
+		"val-loss":  {4, 2, 1},
+		"zero":      {0},
+	}
+	for _, tt := range []struct {
+		expression string
+		expected   float64
+		ok         bool
+	}{
+		{"precision", 0.5, true},
+		{"2 * precision * recall / (precision + recall)", 2.0 / 3, true},
+		{"1 - -precision * 2", 2, true},
+		{"1e-1 + .5", 0.6, true},
+		{`"val-loss" * 10`, 10, true},
+		{"max(precision, recall, 0.7) + abs(-1)", 2, true},
+		{"sqrt(4) + log(exp(1))", 3, true},
+		{`mean("val-loss", 2)`, 1.5, true},
+		{`mean("val-loss", 10)`, 7.0 / 3, true},
+		{`ema("val-loss", 0.5)`, 2, true},
+		{"missing + 1", 0, false},
+		{"recall / zero", 0, false},
+		{"mean(missing, 2)", 0, false},
+	} {
+		expr, err := ParseExpression(tt.expression)
+		require.NoError(t, err, tt.expression)
+		actual, ok := expr.Eval(metrics)
+		require.Equal(t, tt.ok, ok, tt.expression)
+		require.InDelta(t, tt.expected, actual, 1e-9, tt.expression)
+	}
+
+	expr, err := ParseExpression(`precision * recall / (mean(precision, 3) + "val-loss")`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"precision", "recall", "val-loss"}, expr.Names())
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"precision +",
+		"(precision",
+		"precision recall",
+		"foo(precision)",
+		"abs(precision, recall)",
+		"mean(precision)",
+		"mean(precision, 0)",
+		"mean(precision, recall)",
+		"ema(precision + 1, 0.5)",
+		"ema(precision, 1)",
+		"precision % 2",
+		`"precision`,
+	} {
+		_, err := ParseExpression(s)
+		require.Error(t, err, s)
+	}
+}
@@ -13,6 +13,12 @@ type ValueGetter interface {
 	GetValue(name string) Value
 }
 
+// Matcher decides whether an experiment (or anything else with values) should be selected,
+// e.g. Filters or Query
+type Matcher interface {
+	Matches(obj ValueGetter) (bool, error)
+}
+
 type Filters struct {
 	filters []*filter
 }
@@ -62,6 +68,15 @@ func (fs *Filters) SetExclusive(name string, operator Operator, value Value) {
 	fs.filters = filters
 }
 
+// Append adds a filter, in addition to any existing filters
+func (fs *Filters) Append(name string, operator Operator, value Value) {
+	fs.filters = append(fs.filters, &filter{
+		name:     name,
+		operator: operator,
+		value:    value,
+	})
+}
+
 func (fs *Filters) appendParsed(s string) error {
 	f, err := parse(s)
 	if err != nil {
@@ -93,23 +108,44 @@ func (f *filter) matches(obj ValueGetter) (bool, error) {
 		return !value.IsNone(), nil
 	}
 
+	filterValue := f.value
+	// Params passed on the command line are often strings, even if they look
+	// like numbers or bools. For = and !=, compare them with the filter value
+	// as written. For the other operators, compare them as numbers, because
+	// as strings "10" < "9".
+	if value.Type() == TypeString && filterValue.Type() != TypeString {
+		if f.operator == OperatorEqual || f.operator == OperatorNotEqual {
+			filterValue = String(filterValue.String())
+		} else {
+			number := ParseFromString(value.StringVal())
+			if !isNumber(number) || !isNumber(filterValue) {
+				return false, nil
+			}
+			value = number
+		}
+	}
+
 	switch f.operator {
 	case OperatorEqual:
-		return value.Equal(f.value)
+		return value.Equal(filterValue)
 	case OperatorNotEqual:
-		return value.NotEqual(f.value)
+		return value.NotEqual(filterValue)
 	case OperatorLessThan:
-		return value.LessThan(f.value)
+		return value.LessThan(filterValue)
 	case OperatorLessOrEqual:
-		return value.LessOrEqual(f.value)
+		return value.LessOrEqual(filterValue)
 	case OperatorGreaterThan:
-		return value.GreaterThan(f.value)
+		return value.GreaterThan(filterValue)
 	case OperatorGreaterOrEqual:
-		return value.GreaterOrEqual(f.value)
+		return value.GreaterOrEqual(filterValue)
 	}
 	panic("Unknown operator")
 }
 
+func isNumber(v Value) bool {
+	return v.Type() == TypeInt || v.Type() == TypeFloat
+}
+
 func parse(s string) (*filter, error) {
 	parseErr := fmt.Errorf(`Failed to parse filter: "%s".
 
@@ -64,3 +64,43 @@ func TestParseBad(t *testing.T) {
 		require.Error(t, err)
 	}
 }
+
+type valueMap map[string]Value
+
+func (m valueMap) GetValue(name string) Value {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	return None()
+}
+
+func TestFiltersMatchAcrossTypes(t *testing.T) {
+	for _, tt := range []struct {
+		filter string
+		value  Value
+		match  bool
+	}{
+		{"foo=100", Int(100), true},
+		{"foo=100", Float(100), true},
+		{"foo=100", String("100"), true},
+		{"foo=100", Int(10), false},
+		{"foo!=100", Float(100), false},
+		{"foo>=100", String("100"), true},
+		{"foo>9", String("10"), true},
+		{"foo<9", String("10"), false},
+		{"foo<0.01", String("1e-3"), true},
+		{"foo>9", String("abc"), false},
+		{"foo>true", String("true"), false},
+		{"foo=0.01", String("0.01"), true},
+		{"foo=0.01", Float(0.01), true},
+		{"foo=true", Bool(true), true},
+		{"foo=true", String("true"), true},
+		{"foo=[1, 2]", Object([]interface{}{1.0, 2.0}), true},
+	} {
+		filters, err := MakeFilters([]string{tt.filter})
+		require.NoError(t, err)
+		match, err := filters.Matches(valueMap{"foo": tt.value})
+		require.NoError(t, err, tt.filter)
+		require.Equal(t, tt.match, match, tt.filter)
+	}
+}
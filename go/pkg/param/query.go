@@ -0,0 +1,400 @@
+package param
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/araddon/dateparse"
+)
+
+// Query is a boolean expression over values, like
+// "params.lr < 0.01 and metrics.best.val_acc > 0.9"
+type Query struct {
+	source string
+	root   queryNode
+}
+
+type queryNode interface {
+	eval(obj ValueGetter) (bool, error)
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ node queryNode }
+
+type comparisonNode struct {
+	left     operand
+	operator Operator
+	right    operand
+}
+
+// operand is either the name of a value, or a literal value
+type operand struct {
+	name  string
+	value Value
+}
+
+func (n *andNode) eval(obj ValueGetter) (bool, error) {
+	left, err := n.left.eval(obj)
+	if err != nil || !left {
+		return false, err
+	}
+	return n.right.eval(obj)
+}
+
+func (n *orNode) eval(obj ValueGetter) (bool, error) {
+	left, err := n.left.eval(obj)
+	if err != nil || left {
+		return left, err
+	}
+	return n.right.eval(obj)
+}
+
+func (n *notNode) eval(obj ValueGetter) (bool, error) {
+	match, err := n.node.eval(obj)
+	return !match, err
+}
+
+func (n *comparisonNode) eval(obj ValueGetter) (bool, error) {
+	left := n.left.resolve(obj)
+	right := n.right.resolve(obj)
+	if left.IsNone() || right.IsNone() {
+		switch n.operator {
+		case OperatorEqual:
+			return left.IsNone() && right.IsNone(), nil
+		case OperatorNotEqual:
+			return left.IsNone() != right.IsNone(), nil
+		}
+		// missing values never match comparisons
+		return false, nil
+	}
+	// 1 and 1.0 are equal, but Value.Equal() considers them different types
+	if left.Type() == TypeInt && right.Type() == TypeFloat {
+		left = Float(float64(left.IntVal()))
+	} else if left.Type() == TypeFloat && right.Type() == TypeInt {
+		right = Float(float64(right.IntVal()))
+	}
+
+	var match bool
+	var err error
+	switch n.operator {
+	case OperatorEqual:
+		match, err = left.Equal(right)
+	case OperatorNotEqual:
+		match, err = left.NotEqual(right)
+	case OperatorLessThan:
+		match, err = left.LessThan(right)
+	case OperatorLessOrEqual:
+		match, err = left.LessOrEqual(right)
+	case OperatorGreaterThan:
+		match, err = left.GreaterThan(right)
+	case OperatorGreaterOrEqual:
+		match, err = left.GreaterOrEqual(right)
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error comparing %s with %s: %s", n.left, n.right, err)
+	}
+	return match, nil
+}
+
+func (o operand) resolve(obj ValueGetter) Value {
+	if o.name != "" {
+		return obj.GetValue(o.name)
+	}
+	return o.value
+}
+
+func (o operand) String() string {
+	if o.name != "" {
+		return o.name
+	}
+	return o.value.String()
+}
+
+// ParseQuery parses a query. Queries are comparisons between names and values,
+// combined with "and", "or", "not", and parentheses. Names are like those used
+// in filters, and can also be "params.<name>", "metrics.<name>",
+// "metrics.best.<name>", or "metrics.latest.<name>". Strings must be quoted.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, queryError(s, err)
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, queryError(s, err)
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, queryError(s, fmt.Errorf("unexpected %s", tok))
+	}
+	return &Query{source: s, root: root}, nil
+}
+
+// Matches returns true if the query is true for obj
+func (q *Query) Matches(obj ValueGetter) (bool, error) {
+	match, err := q.root.eval(obj)
+	if err != nil {
+		return false, fmt.Errorf("Error applying query %q: %s", q.source, err)
+	}
+	return match, nil
+}
+
+func queryError(s string, err error) error {
+	return fmt.Errorf(`Failed to parse query %q: %s.
+
+Queries are comparisons like "params.lr < 0.01", which can be combined with
+"and", "or", "not", and parentheses. The comparison operators are "=", "!=",
+"<", "<=", ">", and ">=". Strings must be quoted, e.g. 'status = "running"'.`, s, err)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenValue
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpenParen
+	tokenCloseParen
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	value    Value
+	operator Operator
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+var queryOperators = map[string]Operator{
+	"=":  OperatorEqual,
+	"==": OperatorEqual,
+	"!=": OperatorNotEqual,
+	"<":  OperatorLessThan,
+	"<=": OperatorLessOrEqual,
+	">":  OperatorGreaterThan,
+	">=": OperatorGreaterOrEqual,
+}
+
+func tokenizeQuery(s string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(s)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen, text: ")"})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			j := i
+			for j < len(runes) && strings.ContainsRune("=!<>", runes[j]) {
+				j++
+			}
+			text := string(runes[i:j])
+			operator, ok := queryOperators[text]
+			if !ok {
+				return nil, fmt.Errorf("unknown operator %q", text)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: text, operator: operator})
+			i = j
+		case r == '"' || r == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokenValue, text: string(runes[i : j+1]), value: String(sb.String())})
+			i = j + 1
+		case isQueryWordRune(r):
+			j := i
+			for j < len(runes) && isQueryWordRune(runes[j]) {
+				j++
+			}
+			text := string(runes[i:j])
+			tokens = append(tokens, wordToken(text))
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func isQueryWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.+", r)
+}
+
+// wordToken returns the token for a keyword, number, or name
+func wordToken(text string) token {
+	switch strings.ToLower(text) {
+	case "and":
+		return token{kind: tokenAnd, text: text}
+	case "or":
+		return token{kind: tokenOr, text: text}
+	case "not":
+		return token{kind: tokenNot, text: text}
+	case "true":
+		return token{kind: tokenValue, text: text, value: Bool(true)}
+	case "false":
+		return token{kind: tokenValue, text: text, value: Bool(false)}
+	case "null", "none":
+		return token{kind: tokenValue, text: text, value: None()}
+	}
+	first := []rune(text)[0]
+	if unicode.IsDigit(first) || first == '-' || first == '+' || first == '.' {
+		if value := ParseFromString(text); value.Type() == TypeInt || value.Type() == TypeFloat {
+			return token{kind: tokenValue, text: text, value: value}
+		}
+	}
+	return token{kind: tokenName, text: text}
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node}, nil
+	}
+	if p.peek().kind == tokenOpenParen {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenCloseParen {
+			return nil, fmt.Errorf("expected \")\", got %s", tok)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.next()
+	if tok.kind != tokenOperator {
+		return nil, fmt.Errorf("expected a comparison operator after %s, got %s", left, tok)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if left.name == "" && right.name == "" {
+		return nil, fmt.Errorf("%s %s %s doesn't compare anything with a name", left, tok.text, right)
+	}
+	left, right, err = parseTimes(left, right)
+	if err != nil {
+		return nil, err
+	}
+	return &comparisonNode{left: left, operator: tok.operator, right: right}, nil
+}
+
+func (p *queryParser) parseOperand() (operand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenName:
+		return operand{name: tok.text}, nil
+	case tokenValue:
+		return operand{value: tok.value}, nil
+	}
+	return operand{}, fmt.Errorf("expected a name or value, got %s", tok)
+}
+
+// parseTimes converts strings compared with the created time to timestamps,
+// like filters do, so you can write 'created > "2020-01-01"'
+func parseTimes(left, right operand) (operand, operand, error) {
+	convert := func(name string, other operand) (operand, error) {
+		if (name != "created" && name != "started") || other.name != "" || other.value.Type() != TypeString {
+			return other, nil
+		}
+		t, err := dateparse.ParseLocal(other.value.StringVal())
+		if err != nil {
+			return other, fmt.Errorf("failed to parse time %q", other.value.StringVal())
+		}
+		return operand{value: Float(float64(t.Unix()))}, nil
+	}
+	var err error
+	if right, err = convert(left.name, right); err != nil {
+		return left, right, err
+	}
+	left, err = convert(right.name, left)
+	return left, right, err
+}
@@ -0,0 +1,92 @@
+package param
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testValues map[string]Value
+
+func (v testValues) GetValue(name string) Value {
+	if val, ok := v[name]; ok {
+		return val
+	}
+	return None()
+}
+
+func TestQueryMatches(t *testing.T) {
+	values := testValues{
+		"params.lr":            Float(0.001),
+		"params.optimizer":     String("adam"),
+		"params.layers":        Int(3),
+		"metrics.best.val_acc": Float(0.93),
+		"status":               String("stopped"),
+	}
+	for _, tt := range []struct {
+		query    string
+		expected bool
+	}{
+		{"params.lr < 0.01", true},
+		{"params.lr<0.01", true},
+		{"params.lr < 0.01 and metrics.best.val_acc > 0.9", true},
+		{"params.lr < 0.01 and metrics.best.val_acc > 0.95", false},
+		{"params.lr > 0.01 or metrics.best.val_acc > 0.9", true},
+		{"not params.lr > 0.01", true},
+		{`params.optimizer = "adam"`, true},
+		{`params.optimizer == 'sgd'`, false},
+		{`params.optimizer != "sgd"`, true},
+		{"params.layers = 3.0", true},
+		{"params.layers >= -1", true},
+		{"0.01 > params.lr", true},
+		{"params.missing = null", true},
+		{"params.missing != none", false},
+		{"params.missing > 1", false},
+		{"params.missing < 1", false},
+		// and binds tighter than or
+		{`status = "running" and params.lr < 0.01 or params.layers = 3`, true},
+		{`status = "running" and (params.lr < 0.01 or params.layers = 3)`, false},
+		{`params.optimizer = "sgd" or params.layers = 3 AND params.lr > 1`, false},
+	} {
+		q, err := ParseQuery(tt.query)
+		require.NoError(t, err, tt.query)
+		match, err := q.Matches(values)
+		require.NoError(t, err, tt.query)
+		require.Equal(t, tt.expected, match, tt.query)
+	}
+}
+
+func TestQueryMatchesTypeError(t *testing.T) {
+	q, err := ParseQuery(`params.lr < "big"`)
+	require.NoError(t, err)
+	_, err = q.Matches(testValues{"params.lr": Float(0.1)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Comparing values of different types")
+}
+
+func TestQueryCreated(t *testing.T) {
+	q, err := ParseQuery(`created > "2020-01-01"`)
+	require.NoError(t, err)
+	match, err := q.Matches(testValues{"created": Float(1600000000)}) // 2020-09-13
+	require.NoError(t, err)
+	require.True(t, match)
+}
+
+func TestParseQueryBad(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"params.lr",
+		"params.lr <",
+		"params.lr << 1",
+		"params.lr < 1 and",
+		"(params.lr < 1",
+		"params.lr < 1)",
+		`params.optimizer = "adam`,
+		"1 < 2",
+		"params.lr < 1 params.layers > 2",
+		"params.lr ~ 1",
+	} {
+		_, err := ParseQuery(input)
+		require.Error(t, err, input)
+	}
+}
@@ -28,7 +28,9 @@ func (s *Sorter) LessThan(x ValueGetter, y ValueGetter) bool {
 	var err error
 	isLess, err = xVal.LessThan(yVal)
 	if err != nil {
-		panic(err)
+		// A param can have different types in different experiments, e.g. a
+		// string in some and an int in others. Group them by type instead.
+		isLess = xVal.Type() < yVal.Type()
 	}
 	if s.Descending {
 		return !isLess
@@ -0,0 +1,163 @@
+package param
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StructuredType is the kind of a structured value. Structured values are JSON
+// objects with a "type" key, used for metrics that aren't plain scalars.
+type StructuredType string
+
+const (
+	// {"type": "histogram", "bins": [0, 0.5, 1], "counts": [10, 20]}
+	// bins are the edges of the buckets, so there is one more bin than there are counts.
+	StructuredHistogram StructuredType = "histogram"
+
+	// {"type": "image", "path": "samples/1.png", "width": 256, "height": 256}
+	// path is relative to the checkpoint's files. width and height are optional.
+	StructuredImage StructuredType = "image"
+
+	// {"type": "audio", "path": "samples/1.wav", "duration": 2.5, "sample_rate": 16000}
+	// path is relative to the checkpoint's files. duration (in seconds) and
+	// sample_rate are optional.
+	StructuredAudio StructuredType = "audio"
+
+	// {"type": "confusion_matrix", "labels": ["cat", "dog"], "matrix": [[5, 1], [2, 8]]}
+	// rows are the actual classes, columns are the predicted classes.
+	StructuredConfusionMatrix StructuredType = "confusion_matrix"
+)
+
+// StructuredType returns the type of a structured value, or "" if v is not a
+// structured value
+func (v Value) StructuredType() StructuredType {
+	obj, ok := v.objectVal.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	t, ok := obj["type"].(string)
+	if !ok {
+		return ""
+	}
+	switch StructuredType(t) {
+	case StructuredHistogram, StructuredImage, StructuredAudio, StructuredConfusionMatrix:
+		return StructuredType(t)
+	}
+	return ""
+}
+
+// Summary returns a human-readable description of the value. Structured values
+// are described instead of being dumped as JSON, e.g. "histogram (10 bins, 0 to 1, n=200)".
+// Other values are the same as String().
+func (v Value) Summary(precision int) string {
+	obj, _ := v.objectVal.(map[string]interface{})
+	switch v.StructuredType() {
+	case StructuredHistogram:
+		bins := floatList(obj["bins"])
+		counts := floatList(obj["counts"])
+		total := 0.0
+		for _, c := range counts {
+			total += c
+		}
+		s := fmt.Sprintf("histogram (%d bins", len(counts))
+		if len(bins) > 0 {
+			s += fmt.Sprintf(", %s to %s", formatFloat(bins[0], precision), formatFloat(bins[len(bins)-1], precision))
+		}
+		return s + fmt.Sprintf(", n=%s)", formatFloat(total, precision))
+	case StructuredImage:
+		path, _ := obj["path"].(string)
+		width, hasWidth := obj["width"].(float64)
+		height, hasHeight := obj["height"].(float64)
+		if hasWidth && hasHeight {
+			return fmt.Sprintf("image %s (%dx%d)", path, int(width), int(height))
+		}
+		return "image " + path
+	case StructuredAudio:
+		path, _ := obj["path"].(string)
+		details := []string{}
+		if duration, ok := obj["duration"].(float64); ok {
+			details = append(details, formatFloat(duration, precision)+"s")
+		}
+		if sampleRate, ok := obj["sample_rate"].(float64); ok {
+			details = append(details, fmt.Sprintf("%d Hz", int(sampleRate)))
+		}
+		if len(details) > 0 {
+			return fmt.Sprintf("audio %s (%s)", path, strings.Join(details, ", "))
+		}
+		return "audio " + path
+	case StructuredConfusionMatrix:
+		rows, _ := obj["matrix"].([]interface{})
+		correct := 0.0
+		total := 0.0
+		for i, row := range rows {
+			for j, cell := range floatList(row) {
+				if i == j {
+					correct += cell
+				}
+				total += cell
+			}
+		}
+		s := fmt.Sprintf("confusion matrix (%dx%d", len(rows), len(rows))
+		if total > 0 {
+			s += ", accuracy " + formatFloat(correct/total, precision)
+		}
+		return s + ")"
+	}
+	return v.String()
+}
+
+// MediaPath returns the path of the file an image or audio value refers to, or
+// "" if v isn't one
+func (v Value) MediaPath() string {
+	switch v.StructuredType() {
+	case StructuredImage, StructuredAudio:
+		path, _ := v.objectVal.(map[string]interface{})["path"].(string)
+		return path
+	}
+	return ""
+}
+
+// ConfusionMatrixRows returns a confusion matrix as rows of strings, with a
+// header row and a header column of labels, suitable for a tabwriter
+func (v Value) ConfusionMatrixRows() [][]string {
+	if v.StructuredType() != StructuredConfusionMatrix {
+		return nil
+	}
+	obj := v.objectVal.(map[string]interface{})
+	matrix, _ := obj["matrix"].([]interface{})
+	labels := []string{}
+	if ls, ok := obj["labels"].([]interface{}); ok {
+		for _, l := range ls {
+			labels = append(labels, fmt.Sprintf("%v", l))
+		}
+	}
+	for len(labels) < len(matrix) {
+		labels = append(labels, strconv.Itoa(len(labels)))
+	}
+
+	ret := [][]string{append([]string{""}, labels...)}
+	for i, row := range matrix {
+		line := []string{labels[i]}
+		for _, cell := range floatList(row) {
+			line = append(line, formatFloat(cell, 5))
+		}
+		ret = append(ret, line)
+	}
+	return ret
+}
+
+func floatList(v interface{}) []float64 {
+	list, _ := v.([]interface{})
+	ret := []float64{}
+	for _, item := range list {
+		if f, ok := item.(float64); ok {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func formatFloat(f float64, precision int) string {
+	return strconv.FormatFloat(f, 'g', precision, 64)
+}
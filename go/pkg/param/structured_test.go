@@ -0,0 +1,54 @@
+package param
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func parseValue(t *testing.T, s string) Value {
+	v := Value{}
+	require.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestStructuredSummary(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		typ      StructuredType
+		expected string
+	}{
+		{`{"type": "histogram", "bins": [0, 0.5, 1], "counts": [10, 20]}`, StructuredHistogram, "histogram (2 bins, 0 to 1, n=30)"},
+		{`{"type": "image", "path": "samples/1.png", "width": 32, "height": 16}`, StructuredImage, "image samples/1.png (32x16)"},
+		{`{"type": "image", "path": "samples/1.png"}`, StructuredImage, "image samples/1.png"},
+		{`{"type": "audio", "path": "samples/1.wav", "duration": 2.5, "sample_rate": 16000}`, StructuredAudio, "audio samples/1.wav (2.5s, 16000 Hz)"},
+		{`{"type": "audio", "path": "samples/1.wav"}`, StructuredAudio, "audio samples/1.wav"},
+		{`{"type": "confusion_matrix", "labels": ["cat", "dog"], "matrix": [[5, 1], [2, 8]]}`, StructuredConfusionMatrix, "confusion matrix (2x2, accuracy 0.8125)"},
+		{`{"type": "something", "foo": 1}`, "", `{"foo":1,"type":"something"}`},
+		{`{"nested": {"a": [1, 2]}}`, "", `{"nested":{"a":[1,2]}}`},
+		{`1.5`, "", "1.5"},
+	} {
+		v := parseValue(t, tt.input)
+		require.Equal(t, tt.typ, v.StructuredType())
+		require.Equal(t, tt.expected, v.Summary(5))
+	}
+}
+
+func TestMediaPath(t *testing.T) {
+	require.Equal(t, "samples/1.png", parseValue(t, `{"type": "image", "path": "samples/1.png"}`).MediaPath())
+	require.Equal(t, "samples/1.wav", parseValue(t, `{"type": "audio", "path": "samples/1.wav"}`).MediaPath())
+	require.Equal(t, "", parseValue(t, `{"type": "histogram", "bins": [0, 1], "counts": [1]}`).MediaPath())
+	require.Equal(t, "", parseValue(t, `"samples/1.png"`).MediaPath())
+}
+
+func TestConfusionMatrixRows(t *testing.T) {
+	v := parseValue(t, `{"type": "confusion_matrix", "labels": ["cat", "dog"], "matrix": [[5, 1], [2, 8]]}`)
+	require.Equal(t, [][]string{
+		{"", "cat", "dog"},
+		{"cat", "5", "1"},
+		{"dog", "2", "8"},
+	}, v.ConfusionMatrixRows())
+
+	require.Nil(t, Float(1.5).ConfusionMatrixRows())
+}
@@ -54,7 +54,16 @@ func (v Value) MarshalJSON() ([]byte, error) {
 		if math.IsInf(*v.floatVal, -1) {
 			return []byte(JsonNegativeInfinity), nil
 		}
-		return json.Marshal(v.floatVal)
+		data, err := json.Marshal(v.floatVal)
+		if err != nil {
+			return nil, err
+		}
+		// keep a decimal point in whole numbers, so they are unmarshalled as
+		// floats instead of ints
+		if !strings.ContainsAny(string(data), ".eE") {
+			data = append(data, ".0"...)
+		}
+		return data, nil
 	case v.stringVal != nil:
 		return json.Marshal(v.stringVal)
 	case v.objectVal != nil:
@@ -167,6 +176,7 @@ func Truncate(s string, maxLength int) string {
 // Small floats will be truncated to precision decimal points.
 // Big floats will be truncated to maxLength
 // Strings will be truncated to maxLength.
+// Objects will be summarized (see Summary()) and truncated to maxLength.
 // Everything else is just default.
 //
 // TODO: some interesting stuff could be done with color here (e.g. "..." and "none" could be dimmed)
@@ -186,7 +196,7 @@ func (v Value) ShortString(maxLength int, precision int) string {
 	case TypeString:
 		return Truncate(v.StringVal(), maxLength)
 	case TypeObject:
-		return Truncate(v.String(), maxLength)
+		return Truncate(v.Summary(precision), maxLength)
 	}
 	// Everything else doesn't get truncated (int, bool, none)
 	return v.String()
@@ -282,6 +292,13 @@ func (v Value) Equal(other Value) (bool, error) {
 	if !v.IsNone() && other.IsNone() || v.IsNone() && !other.IsNone() {
 		return false, nil
 	}
+	// Special cases
+	if v.Type() == TypeFloat && other.Type() == TypeInt {
+		return v.FloatVal() == float64(other.IntVal()), nil
+	}
+	if v.Type() == TypeInt && other.Type() == TypeFloat {
+		return float64(v.IntVal()) == other.FloatVal(), nil
+	}
 	if v.Type() != other.Type() {
 		return false, fmt.Errorf("Comparing values of different types: %s and %s", v.Type(), other.Type())
 	}
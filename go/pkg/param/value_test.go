@@ -57,6 +57,8 @@ func TestMarshalValue(t *testing.T) {
 		expected string
 	}{
 		{Value{floatVal: FP(0.1)}, false, "0.1"},
+		{Value{floatVal: FP(100)}, false, "100.0"},
+		{Value{floatVal: FP(1e21)}, false, "1e+21"},
 		{Value{intVal: IP(10)}, false, "10"},
 		{Value{boolVal: BP(false)}, false, "false"},
 		{Value{stringVal: SP("bar")}, false, "\"bar\""},
@@ -77,6 +79,23 @@ func TestMarshalValue(t *testing.T) {
 	)
 }
 
+func TestRoundTripTypes(t *testing.T) {
+	params := ValueMap{
+		"int":    Int(100),
+		"float":  Float(100),
+		"bool":   Bool(true),
+		"string": String("100"),
+		"list":   Object([]interface{}{1.0, "two", false}),
+		"dict":   Object(map[string]interface{}{"lr": 0.01, "nested": map[string]interface{}{"layers": []interface{}{64.0, 32.0}}}),
+		"none":   None(),
+	}
+	j, err := ToJSON(params)
+	require.NoError(t, err)
+	actual, err := FromJSON(j)
+	require.NoError(t, err)
+	require.Equal(t, params, actual)
+}
+
 func TestShortString(t *testing.T) {
 	require.Equal(t, "hell", String("hell").ShortString(5, 5))
 	require.Equal(t, "he...", String("helloo").ShortString(5, 5))
@@ -112,6 +131,8 @@ func TestEqual(t *testing.T) {
 	require.Equal(t, shim(true, nil), shim(None().Equal(None())))
 	require.Equal(t, shim(false, nil), shim(Int(1).Equal(None())))
 	require.Equal(t, shim(false, nil), shim(None().Equal(Int(1))))
+	require.Equal(t, shim(true, nil), shim(Int(1).Equal(Float(1))))
+	require.Equal(t, shim(false, nil), shim(Float(1.5).Equal(Int(1))))
 }
 
 func TestGreaterThan(t *testing.T) {
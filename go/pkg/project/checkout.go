@@ -3,9 +3,12 @@ package project
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/replicate/keepsake/go/pkg/console"
 	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
 )
 
 func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experiment, outputDir string, quiet bool) error {
@@ -21,16 +24,16 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 		}
 	}
 
+	if err := p.checkDiskSpace(checkpoint, experiment, outputDir, ""); err != nil {
+		return err
+	}
+
 	if experiment.Path != "" {
 		if !quiet {
 			console.Info("Copying files from experiment %s to %q...", experiment.ShortID(), filepath.Join(outputDir, experiment.Path))
 		}
-		if err := p.repository.GetPathTar(experiment.StorageTarPath(), outputDir); err != nil {
-			if errors.IsDoesNotExist(err) {
-				return errors.DoesNotExist(fmt.Sprintf("Experiment %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", experiment.ShortID(), experiment.StorageTarPath()))
-			} else {
-				return err
-			}
+		if err := p.getExperimentFiles(experiment, outputDir); err != nil {
+			return err
 		}
 	}
 
@@ -40,7 +43,7 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 			console.Info("Copying files from checkpoint %s to %q...", checkpoint.ShortID(), filepath.Join(outputDir, checkpoint.Path))
 		}
 
-		if err := p.repository.GetPathTar(checkpoint.StorageTarPath(), outputDir); err != nil {
+		if err := p.getCheckpointFiles(checkpoint, outputDir, ""); err != nil {
 			if errors.IsDoesNotExist(err) {
 				return errors.DoesNotExist(fmt.Sprintf("Checkpoint %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", checkpoint.ShortID(), checkpoint.StorageTarPath()))
 			} else {
@@ -48,6 +51,9 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 
 			}
 		}
+		if err := p.verifyManifest(checkpoint.ManifestPath(), outputDir, "", "checkpoint "+checkpoint.ShortID()); err != nil {
+			return err
+		}
 	}
 
 	if !quiet {
@@ -60,13 +66,100 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 	return nil
 }
 
+// getExperimentFiles downloads all of experiment's files to outputDir, and
+// checks them against its manifest
+func (p *Project) getExperimentFiles(experiment *Experiment, outputDir string) error {
+	contentAddressed, _, err := p.getExperimentObjects(experiment, outputDir, "")
+	if err != nil {
+		return err
+	}
+	if !contentAddressed {
+		if err := p.repository.GetPathTar(experiment.StorageTarPath(), outputDir); err != nil {
+			if errors.IsDoesNotExist(err) {
+				return errors.DoesNotExist(fmt.Sprintf("Experiment %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", experiment.ShortID(), experiment.StorageTarPath()))
+			}
+			return err
+		}
+	}
+	return p.verifyManifest(experiment.ManifestPath(), outputDir, "", "experiment "+experiment.ShortID())
+}
+
+// CheckoutCheckpointFromCache checks out all the files of checkpoint and its
+// experiment to outputDir, like CheckoutCheckpoint, except that the
+// checkpoint's files are hard-linked from cacheDir, where FetchCheckpointFiles
+// downloaded them, instead of being downloaded again. Linked files are
+// read-only, so they can't be edited in place and change the cache. They are
+// checked against the checkpoint's manifest after they are linked.
+func (p *Project) CheckoutCheckpointFromCache(checkpoint *Checkpoint, experiment *Experiment, outputDir string, cacheDir string) error {
+	if experiment.Path != "" {
+		if err := p.checkDiskSpace(nil, experiment, outputDir, ""); err != nil {
+			return err
+		}
+		if err := p.getExperimentFiles(experiment, outputDir); err != nil {
+			return err
+		}
+	}
+	if err := files.LinkDir(cacheDir, outputDir); err != nil {
+		return err
+	}
+	return p.verifyManifest(checkpoint.ManifestPath(), outputDir, "", "checkpoint "+checkpoint.ShortID())
+}
+
+// FetchExperimentFiles downloads only an experiment's files, without any of
+// its checkpoints', to outputDir, and checks them against its manifest
+func (p *Project) FetchExperimentFiles(experiment *Experiment, outputDir string) error {
+	if experiment.Path == "" {
+		return errors.DoesNotExist(fmt.Sprintf("The experiment %s does not have any files associated with it. You need to pass the 'path' argument to 'init()' to save files.", experiment.ShortID()))
+	}
+	if err := p.checkDiskSpace(nil, experiment, outputDir, ""); err != nil {
+		return err
+	}
+	return p.getExperimentFiles(experiment, outputDir)
+}
+
+// FetchCheckpointFiles downloads only a checkpoint's files, without its
+// experiment's, to outputDir, and checks them against its manifest
+func (p *Project) FetchCheckpointFiles(checkpoint *Checkpoint, outputDir string) error {
+	if checkpoint.Path == "" {
+		return errors.DoesNotExist(fmt.Sprintf("Checkpoint %s does not have any files associated with it. You need to pass the 'path' argument to 'checkpoint()' to save files.", checkpoint.ShortID()))
+	}
+	if err := p.checkDiskSpace(checkpoint, nil, outputDir, ""); err != nil {
+		return err
+	}
+	if err := p.getCheckpointFiles(checkpoint, outputDir, ""); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return errors.DoesNotExist(fmt.Sprintf("Checkpoint %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", checkpoint.ShortID(), checkpoint.StorageTarPath()))
+		}
+		return err
+	}
+	return p.verifyManifest(checkpoint.ManifestPath(), outputDir, "", "checkpoint "+checkpoint.ShortID())
+}
+
 // checkout all the files from an experiment or checkpoint
 func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Experiment, outputDir string, checkoutPath string) error {
+	if cleaned := filepath.Clean(checkoutPath); filepath.IsAbs(checkoutPath) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("The path %q is outside the experiment's files. It must be relative to the directory they were saved from.", checkoutPath)
+	}
+	if err := p.checkDiskSpace(checkpoint, experiment, outputDir, checkoutPath); err != nil {
+		return err
+	}
+
 	// Extract the tarfile
 	experimentFilesExist := true
 	checkpointFilesExist := true
 
-	if err := p.repository.GetPathItemTar(filepath.Join("experiments", experiment.ID+".tar.gz"), checkoutPath, outputDir); err != nil {
+	contentAddressed, written, err := p.getExperimentObjects(experiment, outputDir, checkoutPath)
+	if err != nil {
+		return err
+	}
+	if contentAddressed {
+		if written == 0 {
+			err = errors.DoesNotExist("No experiment files in " + checkoutPath)
+		}
+	} else {
+		err = p.repository.GetPathItemTar(filepath.Join("experiments", experiment.ID+".tar.gz"), checkoutPath, outputDir)
+	}
+	if err != nil {
 		// Ignore does not exist errors
 		if errors.IsDoesNotExist(err) {
 			console.Debug("No experiment data found")
@@ -75,13 +168,16 @@ func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Ex
 			return err
 		}
 	} else {
+		if err := p.verifyManifest(experiment.ManifestPath(), outputDir, checkoutPath, "experiment "+experiment.ShortID()); err != nil {
+			return err
+		}
 		console.Info("Copied the path %s from experiment %s to %q", checkoutPath, experiment.ShortID(), filepath.Join(outputDir, experiment.Path))
 	}
 
 	// Overlay checkpoint on top of experiment
 	if checkpoint != nil {
 
-		if err := p.repository.GetPathItemTar(filepath.Join("checkpoints", checkpoint.ID+".tar.gz"), checkoutPath, outputDir); err != nil {
+		if err := p.getCheckpointFiles(checkpoint, outputDir, checkoutPath); err != nil {
 			if errors.IsDoesNotExist(err) {
 				console.Debug("No checkpoint data found")
 				checkpointFilesExist = false
@@ -90,6 +186,9 @@ func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Ex
 
 			}
 		} else {
+			if err := p.verifyManifest(checkpoint.ManifestPath(), outputDir, checkoutPath, "checkpoint "+checkpoint.ShortID()); err != nil {
+				return err
+			}
 			console.Info("Copied the path %s from checkpoint %s to %q", checkoutPath, checkpoint.ShortID(), filepath.Join(outputDir, checkpoint.Path))
 		}
 
@@ -110,3 +209,32 @@ func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Ex
 
 	return nil
 }
+
+// checkDiskSpace returns an error if the files in checkoutPath of experiment
+// and checkpoint, either of which can be nil, won't fit in outputDir. The
+// sizes come from their manifests, so experiments and checkpoints saved
+// without manifests aren't checked here, but each download is still checked
+// before it starts.
+func (p *Project) checkDiskSpace(checkpoint *Checkpoint, experiment *Experiment, outputDir string, checkoutPath string) error {
+	var needed int64
+	manifestPaths := []string{}
+	descriptions := []string{}
+	if experiment != nil && experiment.Path != "" {
+		manifestPaths = append(manifestPaths, experiment.ManifestPath())
+		descriptions = append(descriptions, "experiment "+experiment.ShortID())
+	}
+	if checkpoint != nil && checkpoint.Path != "" {
+		manifestPaths = append(manifestPaths, checkpoint.ManifestPath())
+		descriptions = append(descriptions, "checkpoint "+checkpoint.ShortID())
+	}
+	for _, manifestPath := range manifestPaths {
+		manifest, err := loadManifest(p.repository, manifestPath)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			needed += manifest.size(checkoutPath)
+		}
+	}
+	return repository.CheckDiskSpace(outputDir, needed, "the files of "+strings.Join(descriptions, " and "))
+}
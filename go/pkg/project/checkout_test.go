@@ -1,8 +1,12 @@
 package project
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -48,3 +52,178 @@ func TestCheckoutWithNoPaths(t *testing.T) {
 	require.NotNil(t, err)
 	require.Contains(t, err.Error(), "The experiment 1eeeeee does not have any files associated with it.")
 }
+
+func TestCheckoutVerifiesManifest(t *testing.T) {
+	projectDir, err := files.TempDir("test-checkout")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), []byte("some weights"), 0644))
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	project := NewProject(repo, projectDir)
+
+	exp, err := project.CreateExperiment(CreateExperimentArgs{Path: "train.py"}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+
+	manifest, err := loadManifest(repo, chk.ManifestPath())
+	require.NoError(t, err)
+	require.Equal(t, map[string]*ManifestFile{
+		"model/weights.pth": {Size: 12, SHA256: "a0c76a31f14d6cbed530bfac73778a5bb84861b795e8bd5d4c8eee29784fb766"},
+	}, manifest.Files)
+
+	outputDir, err := files.TempDir("test-checkout-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, project.CheckoutCheckpoint(chk, exp, outputDir, true))
+	require.NoError(t, project.CheckoutFileOrDirectory(chk, exp, outputDir, "model/weights.pth"))
+
+	// Simulate a truncated upload
+	manifest.Files["model/weights.pth"].Size = 100
+	require.NoError(t, saveManifest(repo, chk.ManifestPath(), manifest))
+
+	err = project.CheckoutCheckpoint(chk, exp, outputDir, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "model/weights.pth is 12 bytes, expected 100 bytes")
+
+	err = project.CheckoutFileOrDirectory(chk, exp, outputDir, "model")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "model/weights.pth is 12 bytes, expected 100 bytes")
+
+	// Checking out a different path doesn't verify files outside it
+	require.NoError(t, project.CheckoutFileOrDirectory(nil, exp, outputDir, "train.py"))
+
+	// Paths outside the experiment's files are refused
+	err = project.CheckoutFileOrDirectory(nil, exp, outputDir, "../train.py")
+	require.EqualError(t, err, `The path "../train.py" is outside the experiment's files. It must be relative to the directory they were saved from.`)
+
+	// Older checkpoints without a manifest are not verified
+	require.NoError(t, repo.Delete(chk.ManifestPath()))
+	require.NoError(t, project.CheckoutCheckpoint(chk, exp, outputDir, true))
+}
+
+func TestContentAddressedCodeSnapshots(t *testing.T) {
+	projectDir, err := files.TempDir("test-checkout")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "src"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "src", "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "src", "run.sh"), []byte("#!/bin/sh"), 0755))
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	project := NewProjectWithConfig(repo, projectDir, &config.Config{CodeSnapshots: config.SnapshotContentAddressed})
+
+	exp1, err := project.CreateExperiment(CreateExperimentArgs{Path: "src"}, false, nil, true)
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(projectDir, ".keepsake", "objects", hashString("print(1)")[:2], hashString("print(1)")))
+	require.NoError(t, err)
+	require.Equal(t, 2, countObjects(t, projectDir))
+
+	// Only the changed file is uploaded for the next experiment
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "src", "train.py"), []byte("print(2)"), 0644))
+	exp2, err := project.CreateExperiment(CreateExperimentArgs{Path: "src"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, 3, countObjects(t, projectDir))
+	_, err = os.Stat(path.Join(projectDir, ".keepsake", exp2.StorageTarPath()))
+	require.True(t, os.IsNotExist(err))
+
+	for exp, expected := range map[*Experiment]string{exp1: "print(1)", exp2: "print(2)"} {
+		outputDir, err := files.TempDir("test-checkout-output")
+		require.NoError(t, err)
+		defer os.RemoveAll(outputDir)
+		require.NoError(t, project.CheckoutCheckpoint(nil, exp, outputDir, true))
+		contents, err := ioutil.ReadFile(path.Join(outputDir, "src", "train.py"))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(contents))
+		info, err := os.Stat(path.Join(outputDir, "src", "run.sh"))
+		require.NoError(t, err)
+		require.NotZero(t, info.Mode()&0100)
+	}
+
+	outputDir, err := files.TempDir("test-checkout-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, project.CheckoutFileOrDirectory(nil, exp1, outputDir, "src/train.py"))
+	_, err = os.Stat(path.Join(outputDir, "src", "run.sh"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func countObjects(t *testing.T, projectDir string) int {
+	count := 0
+	err := filepath.Walk(path.Join(projectDir, ".keepsake", "objects"), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			count++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return count
+}
+
+func TestManifestSize(t *testing.T) {
+	manifest := &Manifest{Files: map[string]*ManifestFile{
+		"data/weights":  {Size: 100},
+		"data/bias":     {Size: 10},
+		"database/rows": {Size: 1000},
+		"train.py":      {Size: 1},
+	}}
+	require.Equal(t, int64(1111), manifest.size(""))
+	require.Equal(t, int64(110), manifest.size("data"))
+	require.Equal(t, int64(100), manifest.size("data/weights"))
+	require.Equal(t, int64(0), manifest.size("missing"))
+}
+
+func TestSanitizeFileNames(t *testing.T) {
+	projectDir, err := files.TempDir("test-sanitize")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model", "run. "), 0755))
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model", "run__"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "run. ", "weights\t.pth"), []byte("some weights"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "run__", "weights_.pth"), []byte("other weights"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "log."), []byte("a log"), 0644))
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	// without sanitize_file_names, files are saved as they are
+	proj := NewProject(repo, projectDir)
+	_, err = proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	manifest, err := loadManifest(repo, chk.ManifestPath())
+	require.NoError(t, err)
+	require.Contains(t, manifest.Files, "model/run. /weights\t.pth")
+	require.Contains(t, manifest.Files, "model/log.")
+
+	proj = NewProjectWithConfig(repo, projectDir, &config.Config{SanitizeFileNames: true})
+	chk, err = proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	manifest, err = loadManifest(repo, chk.ManifestPath())
+	require.NoError(t, err)
+	names := []string{}
+	for name := range manifest.Files {
+		names = append(names, name)
+	}
+	require.ElementsMatch(t, []string{"model/log_", "model/run__/weights_.pth", "model/run__/weights_-2.pth"}, names)
+	require.Equal(t, int64(13), manifest.Files["model/run__/weights_.pth"].Size)
+	require.Equal(t, int64(12), manifest.Files["model/run__/weights_-2.pth"].Size)
+
+	// the project's own files aren't renamed
+	_, err = os.Stat(path.Join(projectDir, "model", "run. ", "weights\t.pth"))
+	require.NoError(t, err)
+}
@@ -28,6 +28,14 @@ type Checkpoint struct {
 	Step          int64          `json:"step"`
 	Path          string         `json:"path"`
 	PrimaryMetric *PrimaryMetric `json:"primary_metric"`
+
+	// NoStep is true if the checkpoint was saved without a step, e.g. with
+	// step=None in Python. Step is 0 for these.
+	NoStep bool `json:"no_step,omitempty"`
+
+	// names of the metrics in Metrics that were computed from
+	// derived_metrics in keepsake.yaml, which aren't saved
+	derivedMetrics map[string]bool
 }
 
 // NewCheckpoint creates a checkpoint with default values
@@ -50,6 +58,12 @@ func (c *Checkpoint) SortedMetrics() []*NamedParam {
 	return ret
 }
 
+// IsDerivedMetric returns true if the metric called name was computed from
+// derived_metrics in keepsake.yaml, rather than saved with the checkpoint
+func (c *Checkpoint) IsDerivedMetric(name string) bool {
+	return c.derivedMetrics[name]
+}
+
 func (c *Checkpoint) ShortID() string {
 	return c.ID[:7]
 }
@@ -57,3 +71,32 @@ func (c *Checkpoint) ShortID() string {
 func (c *Checkpoint) StorageTarPath() string {
 	return "checkpoints/" + c.ID + ".tar.gz"
 }
+
+func (c *Checkpoint) ManifestPath() string {
+	return "manifests/checkpoints/" + c.ID + ".json"
+}
+
+// PrimaryMetricValue returns the value of the checkpoint's primary metric, if
+// it has one and it is a number
+func (c *Checkpoint) PrimaryMetricValue() (float64, bool) {
+	if c.PrimaryMetric == nil {
+		return 0, false
+	}
+	return c.MetricValue(c.PrimaryMetric.Name)
+}
+
+// MetricValue returns the value of the metric called name, if the checkpoint
+// has it and it is a number
+func (c *Checkpoint) MetricValue(name string) (float64, bool) {
+	value, ok := c.Metrics[name]
+	if !ok {
+		return 0, false
+	}
+	return numericMetric(value)
+}
+
+// IsBetter returns true if a is a better value than b for a metric with this
+// goal
+func (g MetricGoal) IsBetter(a float64, b float64) bool {
+	return improves(a, b, g, 0)
+}
@@ -0,0 +1,131 @@
+package project
+
+import (
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+const hoursPerMonth = 730
+const bytesPerGB = 1024 * 1024 * 1024
+
+// Cost is an approximate cost of running an experiment and storing its files
+type Cost struct {
+	RuntimeHours float64 `json:"runtime_hours"`
+	StorageBytes int64   `json:"storage_bytes"`
+	Compute      float64 `json:"compute"`
+	Storage      float64 `json:"storage"`
+}
+
+func (c *Cost) Total() float64 {
+	return c.Compute + c.Storage
+}
+
+// Add adds other to this cost, for aggregating costs of multiple experiments
+func (c *Cost) Add(other *Cost) {
+	c.RuntimeHours += other.RuntimeHours
+	c.StorageBytes += other.StorageBytes
+	c.Compute += other.Compute
+	c.Storage += other.Storage
+}
+
+// ExperimentCosts estimates the cost of every experiment in the project, keyed by experiment ID.
+//
+// Runtime is measured from when the experiment was created until its latest
+// checkpoint, or until now if it is still running, using how long its machine
+// says it has been running if its heartbeat records that. Storage is the size of the
+// experiment's and its checkpoints' files, for as long as they have existed.
+func (p *Project) ExperimentCosts(prices *config.CostConfig) (map[string]*Cost, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	storageBytes, err := p.storageBytesByExperimentID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	costs := map[string]*Cost{}
+	for _, exp := range experiments {
+		running, err := p.ExperimentIsRunning(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		heartbeat, err := p.ExperimentHeartbeat(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		costs[exp.ID] = experimentCost(exp, running, heartbeat, storageBytes[exp.ID], prices, now)
+	}
+	return costs, nil
+}
+
+func experimentCost(exp *Experiment, running bool, heartbeat *Heartbeat, storageBytes int64, prices *config.CostConfig, now time.Time) *Cost {
+	end := exp.Created
+	if running {
+		end = now
+	} else if chk := exp.LatestCheckpoint(); chk != nil {
+		end = chk.Created
+	}
+	runtime := end.Sub(exp.Created)
+	if running && heartbeat != nil && heartbeat.Elapsed > 0 {
+		// measured on the experiment's machine, so it doesn't depend on
+		// this machine's clock agreeing with it
+		runtime = time.Duration(heartbeat.Elapsed * float64(time.Second))
+	}
+	if runtime < 0 {
+		// the experiment was created on a machine whose clock is ahead
+		runtime = 0
+	}
+	cost := &Cost{
+		RuntimeHours: runtime.Hours(),
+		StorageBytes: storageBytes,
+	}
+	cost.Compute = cost.RuntimeHours * prices.HourlyPriceForHost(exp.Host)
+	storedMonths := now.Sub(exp.Created).Hours() / hoursPerMonth
+	cost.Storage = float64(storageBytes) / bytesPerGB * storedMonths * prices.StoragePricePerGBMonth
+	return cost
+}
+
+// storageBytesByExperimentID returns the size of the files saved by each experiment
+// and its checkpoints
+func (p *Project) storageBytesByExperimentID() (map[string]int64, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	experimentIDByCheckpointID := map[string]string{}
+	for _, exp := range experiments {
+		for _, chk := range exp.Checkpoints {
+			experimentIDByCheckpointID[chk.ID] = exp.ID
+		}
+	}
+
+	storageBytes := map[string]int64{}
+	var listErr error
+	for _, dir := range []string{"experiments", "checkpoints"} {
+		results := make(chan repository.ListResult)
+		go p.repository.ListRecursive(results, dir)
+		for result := range results {
+			if result.Error != nil {
+				listErr = result.Error
+				continue
+			}
+			// either <dir>/<id>.tar.gz, or <dir>/<id>/... for repositories from older versions
+			name := strings.SplitN(strings.TrimPrefix(result.Path, dir+"/"), "/", 2)[0]
+			id := strings.TrimSuffix(name, ".tar.gz")
+			if dir == "checkpoints" {
+				id = experimentIDByCheckpointID[id]
+			}
+			if id != "" {
+				storageBytes[id] += result.Size
+			}
+		}
+	}
+	if listErr != nil {
+		return nil, listErr
+	}
+	return storageBytes, nil
+}
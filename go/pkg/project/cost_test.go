@@ -0,0 +1,73 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestExperimentCost(t *testing.T) {
+	prices := &config.CostConfig{
+		HourlyPrice:            1,
+		HostHourlyPrices:       map[string]float64{"gpu-box": 3},
+		StoragePricePerGBMonth: 0.5,
+	}
+	created, _ := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+	exp := &Experiment{
+		ID:      "1eeeeeeeee",
+		Created: created,
+		Host:    "gpu-box",
+		Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Created: created.Add(1 * time.Hour)},
+			{ID: "2ccccccccc", Created: created.Add(2 * time.Hour)},
+		},
+	}
+	now := created.Add(hoursPerMonth * time.Hour)
+
+	cost := experimentCost(exp, false, nil, 2*bytesPerGB, prices, now)
+	require.Equal(t, 2.0, cost.RuntimeHours)
+	require.Equal(t, 6.0, cost.Compute)
+	require.Equal(t, 1.0, cost.Storage)
+	require.Equal(t, 7.0, cost.Total())
+
+	// running experiments are charged until now
+	cost = experimentCost(exp, true, nil, 0, prices, created.Add(5*time.Hour))
+	require.Equal(t, 5.0, cost.RuntimeHours)
+	require.Equal(t, 15.0, cost.Compute)
+
+	// unless its machine measured how long it has been running, which
+	// doesn't depend on the clocks agreeing
+	heartbeat := &Heartbeat{ExperimentID: exp.ID, Elapsed: 3 * 60 * 60}
+	cost = experimentCost(exp, true, heartbeat, 0, prices, created.Add(5*time.Hour))
+	require.Equal(t, 3.0, cost.RuntimeHours)
+
+	// created by a machine whose clock is ahead
+	cost = experimentCost(exp, true, nil, 0, prices, created.Add(-time.Minute))
+	require.Equal(t, 0.0, cost.RuntimeHours)
+}
+
+func TestStorageBytesByExperimentID(t *testing.T) {
+	projectDir, err := files.TempDir("test-cost")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProject(repo, projectDir)
+	_, err = proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	require.NoError(t, repo.Put("experiments/1eeeeeeeee.tar.gz", []byte("12345")))
+	require.NoError(t, repo.Put("checkpoints/1ccccccccc.tar.gz", []byte("123")))
+	require.NoError(t, repo.Put("checkpoints/2ccccccccc.tar.gz", []byte("12")))
+
+	storageBytes, err := proj.storageBytesByExperimentID()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"1eeeeeeeee": 10}, storageBytes)
+}
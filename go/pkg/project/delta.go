@@ -0,0 +1,335 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+)
+
+// ManifestStorageDelta means some of the files in a checkpoint's tarball are
+// deltas against the same files in the checkpoint Manifest.Base
+const ManifestStorageDelta = "delta"
+
+// maxDeltaChain is how many deltas can be applied one after another to
+// reconstruct a checkpoint. After that, the files are saved in full again, so
+// checking out the later checkpoints of a long run doesn't get slower and slower.
+const maxDeltaChain = 10
+
+// maxDeltaDepth guards against cycles in corrupted manifests when checking out
+const maxDeltaDepth = 1000
+
+const deltaChunkSize = 1024 * 1024
+
+// deltaBaseKey is the experiment and path of a deltaBase. Checkpoints are only
+// stored as deltas against checkpoints in the same experiment, so deleting one
+// experiment never leaves another's checkpoints without their base.
+type deltaBaseKey struct {
+	experimentID string
+	path         string
+}
+
+// deltaBase is a checkpoint that the next checkpoint in the same experiment
+// with the same path can be stored as deltas against. Its files are kept in a local directory until then,
+// so they don't need to be downloaded again.
+type deltaBase struct {
+	checkpointID string
+	dir          string
+	manifest     *Manifest
+
+	// How many deltas have to be applied to reconstruct this checkpoint
+	depth int
+}
+
+// saveCheckpointFiles saves the files in chk.Path in tempDir to the repository,
+// as deltas against the previous checkpoint in experimentID with the same path
+// if checkpoint_deltas is enabled. tempDir is removed, or kept as the base for
+// the next checkpoint. If experimentID is empty, the files are saved in full.
+func (p *Project) saveCheckpointFiles(tempDir string, experimentID string, chk *Checkpoint) error {
+	manifest, err := createManifest(tempDir, chk.Path)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+	if !p.config.CheckpointDeltas || experimentID == "" {
+		defer os.RemoveAll(tempDir)
+		if err := startUpload(p.repository, chk, manifest); err != nil {
+			return err
+		}
+		if err := saveManifest(p.repository, chk.ManifestPath(), manifest); err != nil {
+			return err
+		}
+		if err := p.repository.PutPathTar(tempDir, chk.StorageTarPath(), chk.Path); err != nil {
+			return err
+		}
+		return finishUpload(p.repository, chk)
+	}
+
+	uploadDir := tempDir
+	depth := 0
+	key := deltaBaseKey{experimentID: experimentID, path: chk.Path}
+	base := p.deltaBases[key]
+	if base != nil && base.depth < maxDeltaChain {
+		deltaDir, deltas, err := writeDeltas(tempDir, manifest, base)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			return err
+		}
+		defer os.RemoveAll(deltaDir)
+		if deltas > 0 {
+			console.Debug("Saving %d files in checkpoint %s as deltas against checkpoint %s", deltas, chk.ShortID(), base.checkpointID[:7])
+			manifest.Storage = ManifestStorageDelta
+			manifest.Base = base.checkpointID
+			uploadDir = deltaDir
+			depth = base.depth + 1
+		}
+	}
+	if err := startUpload(p.repository, chk, manifest); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+	if err := saveManifest(p.repository, chk.ManifestPath(), manifest); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+	if err := p.repository.PutPathTar(uploadDir, chk.StorageTarPath(), chk.Path); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+	if err := finishUpload(p.repository, chk); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	if base != nil {
+		os.RemoveAll(base.dir)
+	}
+	if p.deltaBases == nil {
+		p.deltaBases = map[deltaBaseKey]*deltaBase{}
+	}
+	p.deltaBases[key] = &deltaBase{
+		checkpointID: chk.ID,
+		dir:          tempDir,
+		manifest:     manifest,
+		depth:        depth,
+	}
+	return nil
+}
+
+// RemoveDeltaBases removes the local copies of checkpoints that were being kept
+// to save the next checkpoints as deltas. It must be called after the last
+// checkpoint has been saved.
+func (p *Project) RemoveDeltaBases() {
+	for _, base := range p.deltaBases {
+		os.RemoveAll(base.dir)
+	}
+	p.deltaBases = nil
+}
+
+// writeDeltas writes the files in the manifest to a new temporary directory,
+// as deltas against the files in base where they are the same size, and in full
+// otherwise. It marks the files that are deltas in the manifest.
+func writeDeltas(localPath string, manifest *Manifest, base *deltaBase) (deltaDir string, deltas int, err error) {
+	deltaDir, err = files.TempDir("delta")
+	if err != nil {
+		return "", 0, err
+	}
+	for _, relPath := range manifest.sortedPaths() {
+		file := manifest.Files[relPath]
+		src := filepath.Join(localPath, filepath.FromSlash(relPath))
+		dest := filepath.Join(deltaDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			os.RemoveAll(deltaDir)
+			return "", 0, err
+		}
+		baseFile, ok := base.manifest.Files[relPath]
+		if ok && baseFile.Size == file.Size && file.Size > 0 {
+			err = xorFiles(src, filepath.Join(base.dir, filepath.FromSlash(relPath)), dest)
+			file.Delta = true
+			deltas++
+		} else {
+			err = files.CopyFile(src, dest)
+		}
+		if err != nil {
+			os.RemoveAll(deltaDir)
+			return "", 0, fmt.Errorf("Failed to write delta of %s: %w", relPath, err)
+		}
+	}
+	return deltaDir, deltas, nil
+}
+
+// getCheckpointFiles writes the checkpoint's files in checkoutPath to
+// outputDir, applying any deltas against the checkpoints it is based on and
+// checking the files they produce against the manifests' hashes. If
+// checkoutPath is empty, all the files are written.
+func (p *Project) getCheckpointFiles(chk *Checkpoint, outputDir string, checkoutPath string) error {
+	return p.getCheckpointFilesByID(chk.ID, outputDir, checkoutPath, 0)
+}
+
+func (p *Project) getCheckpointFilesByID(id string, outputDir string, checkoutPath string, depth int) error {
+	chk := &Checkpoint{ID: id}
+	var err error
+	if checkoutPath == "" {
+		err = p.repository.GetPathTar(chk.StorageTarPath(), outputDir)
+	} else {
+		err = p.repository.GetPathItemTar(chk.StorageTarPath(), checkoutPath, outputDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest, err := loadManifest(p.repository, chk.ManifestPath())
+	if err != nil {
+		return err
+	}
+	if manifest == nil || manifest.Storage != ManifestStorageDelta {
+		return nil
+	}
+	prefix := filepath.ToSlash(filepath.Clean(checkoutPath))
+	deltaPaths := []string{}
+	for _, relPath := range manifest.sortedPaths() {
+		if !manifest.Files[relPath].Delta {
+			continue
+		}
+		if checkoutPath == "" || relPath == prefix || strings.HasPrefix(relPath, prefix+"/") {
+			deltaPaths = append(deltaPaths, relPath)
+		}
+	}
+	if len(deltaPaths) == 0 {
+		return nil
+	}
+	if depth >= maxDeltaDepth {
+		return errors.Corrupt(fmt.Sprintf("Checkpoint %s is stored as deltas against more than %d other checkpoints", chk.ShortID(), maxDeltaDepth))
+	}
+
+	baseDir, err := files.TempDir("delta-base")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(baseDir)
+	if err := p.getCheckpointFilesByID(manifest.Base, baseDir, checkoutPath, depth+1); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return errors.Corrupt(fmt.Sprintf("Checkpoint %s is stored as deltas against checkpoint %s, but the files for checkpoint %s are missing", chk.ShortID(), manifest.Base[:7], manifest.Base[:7]))
+		}
+		return err
+	}
+	for _, relPath := range deltaPaths {
+		localPath, err := files.JoinWithin(outputDir, relPath)
+		if err != nil {
+			return err
+		}
+		if err := applyDelta(localPath, filepath.Join(baseDir, filepath.FromSlash(relPath))); err != nil {
+			return errors.Corrupt(fmt.Sprintf("Failed to apply delta to %s in checkpoint %s: %s", relPath, chk.ShortID(), err))
+		}
+		// checked here as well as by the caller, so a bad base is reported
+		// against the checkpoint it is in, not the one being checked out
+		hash, err := hashFile(localPath)
+		if err != nil {
+			return err
+		}
+		if hash != manifest.Files[relPath].SHA256 {
+			return errors.Corrupt(fmt.Sprintf("%s in checkpoint %s is different after applying its delta against checkpoint %s", relPath, chk.ShortID(), manifest.Base[:7]))
+		}
+	}
+	return nil
+}
+
+// applyDelta replaces the delta at path with the file it is the delta of
+func applyDelta(path string, basePath string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".keepsake-delta"
+	if err := xorFiles(path, basePath, tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Chmod(tempPath, info.Mode().Perm()); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// xorFiles writes the bytewise XOR of the files at a and b, which must be the
+// same size, to dest. Weights that change slightly between checkpoints have
+// mostly the same sign, exponent, and high bits, so the XOR is mostly zeros
+// and compresses far better than the file itself. XOR is its own inverse, so
+// the same function turns the delta back into the file.
+func xorFiles(a string, b string, dest string) error {
+	fa, err := os.Open(a)
+	if err != nil {
+		return err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return err
+	}
+	defer fb.Close()
+	infoA, err := fa.Stat()
+	if err != nil {
+		return err
+	}
+	infoB, err := fb.Stat()
+	if err != nil {
+		return err
+	}
+	if infoA.Size() != infoB.Size() {
+		return fmt.Errorf("%s is %d bytes, but %s is %d bytes", a, infoA.Size(), b, infoB.Size())
+	}
+
+	out, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, infoA.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	bufA := make([]byte, deltaChunkSize)
+	bufB := make([]byte, deltaChunkSize)
+	for {
+		n, err := io.ReadFull(fa, bufA)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if _, err := io.ReadFull(fb, bufB[:n]); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			bufA[i] ^= bufB[i]
+		}
+		if _, err := out.Write(bufA[:n]); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// DeltaDependents returns the checkpoints in exp that are stored as deltas
+// against chk, and so can't be checked out without chk's files. Checkpoints are
+// only stored as deltas against checkpoints in the same experiment, so no other
+// experiment depends on chk.
+func (p *Project) DeltaDependents(exp *Experiment, chk *Checkpoint) ([]*Checkpoint, error) {
+	dependents := []*Checkpoint{}
+	for _, other := range exp.Checkpoints {
+		if other.ID == chk.ID || other.Path == "" {
+			continue
+		}
+		manifest, err := loadManifest(p.repository, other.ManifestPath())
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil && manifest.Storage == ManifestStorageDelta && manifest.Base == chk.ID {
+			dependents = append(dependents, other)
+		}
+	}
+	return dependents, nil
+}
@@ -0,0 +1,180 @@
+package project
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestCheckpointDeltas(t *testing.T) {
+	projectDir, err := files.TempDir("test-deltas")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	project := NewProjectWithConfig(repo, projectDir, &config.Config{CheckpointDeltas: true})
+	defer project.RemoveDeltaBases()
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	weights := make([]byte, 3*deltaChunkSize+100)
+	rand.New(rand.NewSource(1)).Read(weights)
+
+	exp := &Experiment{ID: generateRandomID()}
+	contents := [][]byte{}
+	for i := 0; i < maxDeltaChain+2; i++ {
+		weights[i*1000] ^= 0xff
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), weights, 0644))
+		// files that change size are saved in full
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "log.txt"), make([]byte, i), 0644))
+		contents = append(contents, append([]byte{}, weights...))
+
+		chk, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: int64(i), ExperimentID: exp.ID}, false, nil, true)
+		require.NoError(t, err)
+		exp.Checkpoints = append(exp.Checkpoints, chk)
+	}
+
+	for i, chk := range exp.Checkpoints {
+		manifest, err := loadManifest(repo, chk.ManifestPath())
+		require.NoError(t, err)
+		if i == 0 || i == maxDeltaChain+1 {
+			require.Equal(t, "", manifest.Storage, "checkpoint %d", i)
+		} else {
+			require.Equal(t, ManifestStorageDelta, manifest.Storage, "checkpoint %d", i)
+			require.Equal(t, exp.Checkpoints[i-1].ID, manifest.Base)
+			require.True(t, manifest.Files["model/weights.pth"].Delta)
+			require.False(t, manifest.Files["model/log.txt"].Delta)
+		}
+	}
+
+	for _, i := range []int{0, 1, maxDeltaChain, maxDeltaChain + 1} {
+		outputDir, err := files.TempDir("test-deltas-output")
+		require.NoError(t, err)
+		defer os.RemoveAll(outputDir)
+		require.NoError(t, project.CheckoutCheckpoint(exp.Checkpoints[i], exp, outputDir, true))
+		actual, err := ioutil.ReadFile(path.Join(outputDir, "model", "weights.pth"))
+		require.NoError(t, err)
+		require.Equal(t, contents[i], actual, "checkpoint %d", i)
+	}
+
+	outputDir, err := files.TempDir("test-deltas-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, project.CheckoutFileOrDirectory(exp.Checkpoints[2], exp, outputDir, "model/weights.pth"))
+	actual, err := ioutil.ReadFile(path.Join(outputDir, "model", "weights.pth"))
+	require.NoError(t, err)
+	require.Equal(t, contents[2], actual)
+
+	dependents, err := project.DeltaDependents(exp, exp.Checkpoints[0])
+	require.NoError(t, err)
+	require.Equal(t, []*Checkpoint{exp.Checkpoints[1]}, dependents)
+	dependents, err = project.DeltaDependents(exp, exp.Checkpoints[maxDeltaChain])
+	require.NoError(t, err)
+	require.Empty(t, dependents)
+}
+
+func TestCheckpointDeltasPerExperiment(t *testing.T) {
+	projectDir, err := files.TempDir("test-deltas")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	project := NewProjectWithConfig(repo, projectDir, &config.Config{CheckpointDeltas: true})
+	defer project.RemoveDeltaBases()
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	weights := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), weights, 0644))
+
+	exp1 := &Experiment{ID: generateRandomID()}
+	exp2 := &Experiment{ID: generateRandomID()}
+	chk1, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model", ExperimentID: exp1.ID}, false, nil, true)
+	require.NoError(t, err)
+	chk2, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model", ExperimentID: exp2.ID}, false, nil, true)
+	require.NoError(t, err)
+	chk3, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model", ExperimentID: exp1.ID}, false, nil, true)
+	require.NoError(t, err)
+	chk4, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+
+	for _, chk := range []*Checkpoint{chk1, chk2, chk4} {
+		manifest, err := loadManifest(repo, chk.ManifestPath())
+		require.NoError(t, err)
+		require.Equal(t, "", manifest.Storage)
+	}
+	manifest, err := loadManifest(repo, chk3.ManifestPath())
+	require.NoError(t, err)
+	require.Equal(t, ManifestStorageDelta, manifest.Storage)
+	require.Equal(t, chk1.ID, manifest.Base)
+
+	// a base that doesn't match its manifest is reported against itself
+	require.NoError(t, repo.Delete(chk1.StorageTarPath()))
+	weights[0] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), weights, 0644))
+	require.NoError(t, repo.PutPathTar(projectDir, chk1.StorageTarPath(), "model"))
+	outputDir, err := files.TempDir("test-deltas-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	err = project.getCheckpointFiles(chk3, outputDir, "")
+	require.True(t, errors.IsCorrupt(err))
+	require.Contains(t, err.Error(), "in checkpoint "+chk3.ShortID())
+}
+
+func TestReplacedCheckpointKeptForQueuedDelta(t *testing.T) {
+	projectDir, err := files.TempDir("test-deltas")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	project := NewProjectWithConfig(repo, projectDir, &config.Config{CheckpointDeltas: true, CheckpointStepPolicy: config.StepPolicyKeepLatest})
+	defer project.RemoveDeltaBases()
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	weights := make([]byte, 3*deltaChunkSize)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), weights, 0644))
+
+	exp := &Experiment{ID: generateRandomID(), Created: time.Now().UTC(), Config: &config.Config{}}
+	first, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 1, ExperimentID: exp.ID}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, first)
+	_, err = project.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	// the training loop is resumed and saves step 1 again, which is queued
+	// to be saved as deltas against the first checkpoint
+	weights[0] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), weights, 0644))
+	workChan := make(chan func() error, 1)
+	second, err := project.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 1, ExperimentID: exp.ID}, true, workChan, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, second)
+	_, err = project.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	require.Equal(t, []*Checkpoint{second}, exp.Checkpoints)
+	require.NoError(t, (<-workChan)())
+
+	manifest, err := loadManifest(repo, second.ManifestPath())
+	require.NoError(t, err)
+	require.Equal(t, first.ID, manifest.Base)
+	outputDir, err := files.TempDir("test-deltas-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, project.CheckoutCheckpoint(second, exp, outputDir, true))
+	actual, err := ioutil.ReadFile(path.Join(outputDir, "model", "weights.pth"))
+	require.NoError(t, err)
+	require.Equal(t, weights, actual)
+}
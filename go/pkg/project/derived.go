@@ -0,0 +1,64 @@
+package project
+
+import (
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/param"
+)
+
+// checkpointMetrics is the metrics of a checkpoint and the checkpoints before
+// it in the same experiment, for computing derived metrics
+type checkpointMetrics struct {
+	checkpoints []*Checkpoint
+}
+
+func (m *checkpointMetrics) Metric(name string) (float64, bool) {
+	return m.checkpoints[len(m.checkpoints)-1].MetricValue(name)
+}
+
+func (m *checkpointMetrics) MetricHistory(name string) []float64 {
+	history := []float64{}
+	for _, chk := range m.checkpoints {
+		if value, ok := chk.MetricValue(name); ok {
+			history = append(history, value)
+		}
+	}
+	return history
+}
+
+// addDerivedMetrics computes metrics for each of exp's checkpoints, in order.
+// Metrics that a checkpoint was saved with take precedence over derived
+// metrics with the same name, and metrics that can't be computed (e.g.
+// because a metric they refer to isn't set) are left out.
+func addDerivedMetrics(exp *Experiment, metrics []*config.DerivedMetric) {
+	for i, chk := range exp.Checkpoints {
+		src := &checkpointMetrics{checkpoints: exp.Checkpoints[:i+1]}
+		for _, metric := range metrics {
+			if _, ok := chk.Metrics[metric.Name]; ok {
+				continue
+			}
+			value, ok := metric.Expression.Eval(src)
+			if !ok {
+				continue
+			}
+			if chk.Metrics == nil {
+				chk.Metrics = param.ValueMap{}
+			}
+			if chk.derivedMetrics == nil {
+				chk.derivedMetrics = map[string]bool{}
+			}
+			chk.Metrics[metric.Name] = param.Float(value)
+			chk.derivedMetrics[metric.Name] = true
+		}
+	}
+}
+
+// removeDerivedMetrics removes the metrics that addDerivedMetrics added, so
+// they aren't saved
+func removeDerivedMetrics(exp *Experiment) {
+	for _, chk := range exp.Checkpoints {
+		for name := range chk.derivedMetrics {
+			delete(chk.Metrics, name)
+		}
+		chk.derivedMetrics = nil
+	}
+}
@@ -0,0 +1,111 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// EarlyStop records that an experiment was stopped by the daemon because its
+// metric stopped improving, so it can be shown as stopped early rather than
+// as having crashed
+type EarlyStop struct {
+	ExperimentID string    `json:"experiment_id"`
+	Reason       string    `json:"reason"`
+	Time         time.Time `json:"time"`
+}
+
+func CreateEarlyStop(repo repository.Repository, experimentID string, reason string, t time.Time) error {
+	earlyStop := &EarlyStop{
+		ExperimentID: experimentID,
+		Reason:       reason,
+		Time:         t,
+	}
+	data, err := json.MarshalIndent(earlyStop, "", " ")
+	if err != nil {
+		return err
+	}
+	return repo.Put(path.Join("metadata", "early-stops", experimentID+".json"), data)
+}
+
+func listEarlyStops(repo repository.Repository) ([]*EarlyStop, error) {
+	paths, err := repo.List("metadata/early-stops/")
+	if err != nil {
+		return nil, err
+	}
+	earlyStops := []*EarlyStop{}
+	for _, p := range paths {
+		contents, err := repo.Get(p)
+		if err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, err)
+			continue
+		}
+		earlyStop := new(EarlyStop)
+		if err := json.Unmarshal(contents, earlyStop); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, fmt.Errorf("Parse error: %s", err))
+			continue
+		}
+		earlyStops = append(earlyStops, earlyStop)
+	}
+	return earlyStops, nil
+}
+
+// EarlyStoppingReason returns why exp should be stopped under conf, or "" if
+// it should keep running. It should be stopped when conf.Patience checkpoints
+// in a row have failed to improve on the best checkpoint by more than
+// conf.MinDelta.
+func EarlyStoppingReason(exp *Experiment, conf *config.EarlyStoppingConfig) string {
+	var best *float64
+	var bestChk *Checkpoint
+	var metricName string
+	sinceBest := 0
+	for _, chk := range exp.Checkpoints {
+		name, goal := conf.Metric, MetricGoal(conf.Goal)
+		if name == "" {
+			if chk.PrimaryMetric == nil {
+				continue
+			}
+			name, goal = chk.PrimaryMetric.Name, chk.PrimaryMetric.Goal
+		}
+		metric, ok := chk.Metrics[name]
+		if !ok {
+			continue
+		}
+		value, ok := numericMetric(metric)
+		if !ok {
+			continue
+		}
+		if best == nil || improves(value, *best, goal, conf.MinDelta) {
+			best, bestChk, metricName, sinceBest = &value, chk, name, 0
+			continue
+		}
+		sinceBest++
+	}
+	if bestChk == nil || sinceBest < conf.Patience {
+		return ""
+	}
+	return fmt.Sprintf("%s hasn't improved on %s (checkpoint %s) for %d checkpoints", metricName, bestChk.Metrics[metricName].ShortString(20, 5), bestChk.ShortID(), sinceBest)
+}
+
+func improves(value float64, best float64, goal MetricGoal, minDelta float64) bool {
+	if goal == GoalMaximize {
+		return value > best+minDelta
+	}
+	return value < best-minDelta
+}
+
+func numericMetric(v param.Value) (float64, bool) {
+	switch v.Type() {
+	case param.TypeInt:
+		return float64(v.IntVal()), true
+	case param.TypeFloat:
+		return v.FloatVal(), true
+	}
+	return 0, false
+}
@@ -1,11 +1,13 @@
 package project
 
 import (
+	"context"
 	"encoding/json"
 	"path"
 	"sort"
 	"time"
 
+	"github.com/replicate/keepsake/go/pkg/concurrency"
 	"github.com/replicate/keepsake/go/pkg/config"
 	"github.com/replicate/keepsake/go/pkg/console"
 	"github.com/replicate/keepsake/go/pkg/hash"
@@ -76,10 +78,36 @@ func (e *Experiment) HeartbeatPath() string {
 	return "metadata/heartbeats/" + e.ID + ".json"
 }
 
+func (e *Experiment) PreemptionPath() string {
+	return "metadata/preemptions/" + e.ID + ".json"
+}
+
+func (e *Experiment) EarlyStopPath() string {
+	return "metadata/early-stops/" + e.ID + ".json"
+}
+
+func (e *Experiment) TagsPath() string {
+	return "metadata/tags/" + e.ID + ".json"
+}
+
+// SystemMetricsPath is where system metrics were saved before they were
+// saved in chunks in SystemMetricsDir
+func (e *Experiment) SystemMetricsPath() string {
+	return "system-metrics/" + e.ID + ".json"
+}
+
+func (e *Experiment) SystemMetricsDir() string {
+	return "system-metrics/" + e.ID
+}
+
 func (e *Experiment) StorageTarPath() string {
 	return "experiments/" + e.ID + ".tar.gz"
 }
 
+func (e *Experiment) ManifestPath() string {
+	return "manifests/experiments/" + e.ID + ".json"
+}
+
 // LatestCheckpoint returns the latest checkpoint for an experiment
 func (e *Experiment) LatestCheckpoint() *Checkpoint {
 	if len(e.Checkpoints) == 0 {
@@ -141,22 +169,60 @@ func (e *Experiment) BestCheckpoint() *Checkpoint {
 	return best
 }
 
+// BestCheckpointFor returns the checkpoint with the best value of metric for
+// goal, or nil if none of the checkpoints have a numeric value for it
+func (e *Experiment) BestCheckpointFor(metric string, goal MetricGoal) *Checkpoint {
+	var best *Checkpoint
+	var bestValue float64
+	for _, chk := range e.Checkpoints {
+		value, ok := chk.MetricValue(metric)
+		if !ok {
+			continue
+		}
+		if best == nil || goal.IsBetter(value, bestValue) {
+			best, bestValue = chk, value
+		}
+	}
+	return best
+}
+
+// maxLoadWorkers is how many experiments' metadata is loaded at the same time,
+// which makes listing big repositories on remote storage much faster
+const maxLoadWorkers = 32
+
 func listExperiments(repo repository.Repository) ([]*Experiment, error) {
 	paths, err := repo.List("metadata/experiments/")
 	if err != nil {
 		return nil, err
 	}
-	experiments := []*Experiment{}
-	for _, p := range paths {
-		exp := new(Experiment)
-		if err := loadFromPath(repo, p, exp); err == nil {
+	loaded := make([]*Experiment, len(paths))
+	queue := concurrency.NewWorkerQueue(context.Background(), maxLoadWorkers)
+	for i, p := range paths {
+		i, p := i, p
+		err := queue.Go(func() error {
+			exp := new(Experiment)
+			if err := loadFromPath(repo, p, exp); err != nil {
+				// Should we complain more loudly? https://github.com/replicate/keepsake/issues/347
+				console.Warn("Failed to load metadata from %q: %s", p, err)
+				return nil
+			}
 			if exp.KeepsakeVersion == "" && exp.ReplicateVersion != "" {
 				exp.KeepsakeVersion = exp.ReplicateVersion
 			}
+			loaded[i] = exp
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return nil, err
+	}
+	experiments := []*Experiment{}
+	for _, exp := range loaded {
+		if exp != nil {
 			experiments = append(experiments, exp)
-		} else {
-			// Should we complain more loudly? https://github.com/replicate/keepsake/issues/347
-			console.Warn("Failed to load metadata from %q: %s", p, err)
 		}
 	}
 	return experiments, nil
@@ -0,0 +1,118 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// checkFileNames warns about files in includePath inside localPath whose
+// names would break on other repositories or operating systems. If
+// sanitize_file_names is set in keepsake.yaml, they are renamed instead, so
+// localPath must be a copy of the project that can be changed.
+func (p *Project) checkFileNames(localPath string, includePath string) error {
+	includePath = filepath.Clean(includePath)
+	if problems := repository.KeyProblems(filepath.ToSlash(includePath)); len(problems) > 0 {
+		// includePath is what the user passed, so it is saved as it is
+		console.Warn("The path '%s' might not work with other repositories or operating systems, because %s", includePath, strings.Join(problems, ", and "))
+	}
+
+	renames := map[string]string{}
+	root := filepath.Join(localPath, includePath)
+	err := filepath.Walk(root, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(localPath, currentPath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		problems := repository.KeyProblems(key)
+		if len(problems) == 0 {
+			return nil
+		}
+		if !p.config.SanitizeFileNames {
+			console.Warn("The file %q might not work with other repositories or operating systems, because %s. To rename files like this when they are saved, set sanitize_file_names in keepsake.yaml to true.", key, strings.Join(problems, ", and "))
+			return nil
+		}
+		renames[relPath] = filepath.FromSlash(sanitizeRelPath(includePath, key))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to check file names: %w", err)
+	}
+
+	oldPaths := []string{}
+	for oldPath := range renames {
+		oldPaths = append(oldPaths, oldPath)
+	}
+	// so files that end up with the same name are numbered the same way each time
+	sort.Strings(oldPaths)
+	for _, oldPath := range oldPaths {
+		if err := renameWithin(localPath, root, oldPath, renames[oldPath]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sanitizeRelPath sanitizes the part of key inside includePath, which is
+// left as it is
+func sanitizeRelPath(includePath string, key string) string {
+	if includePath == "." {
+		return repository.SanitizeKey(key)
+	}
+	prefix := filepath.ToSlash(includePath) + "/"
+	if !strings.HasPrefix(key, prefix) {
+		// includePath is a file
+		return key
+	}
+	return prefix + repository.SanitizeKey(strings.TrimPrefix(key, prefix))
+}
+
+// renameWithin moves oldPath to newPath inside localPath, adding a number to
+// newPath if something is there already, and removes the directories oldPath
+// was in up to root if they are left empty
+func renameWithin(localPath string, root string, oldPath string, newPath string) error {
+	if oldPath == newPath {
+		return nil
+	}
+	ext := filepath.Ext(newPath)
+	candidate := newPath
+	for i := 2; ; i++ {
+		exists, err := files.FileExists(filepath.Join(localPath, candidate))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			break
+		}
+		candidate = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(newPath, ext), i, ext)
+	}
+	dest := filepath.Join(localPath, candidate)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("Failed to rename %q: %w", oldPath, err)
+	}
+	if err := os.Rename(filepath.Join(localPath, oldPath), dest); err != nil {
+		return fmt.Errorf("Failed to rename %q: %w", oldPath, err)
+	}
+	console.Info("Saving %q as %q, so it works with other repositories and operating systems", filepath.ToSlash(oldPath), filepath.ToSlash(candidate))
+
+	for dir := filepath.Dir(filepath.Join(localPath, oldPath)); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		// fails if the directory isn't empty, which is fine
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+var groupNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Group is a named set of experiments, like the experiments in a paper or a
+// sprint, so they can be listed and removed together
+type Group struct {
+	Name          string    `json:"name"`
+	Created       time.Time `json:"created"`
+	ExperimentIDs []string  `json:"experiment_ids"`
+}
+
+func (g *Group) MetadataPath() string {
+	return "metadata/groups/" + g.Name + ".json"
+}
+
+// Contains returns true if the experiment with this ID is in the group
+func (g *Group) Contains(experimentID string) bool {
+	for _, id := range g.ExperimentIDs {
+		if id == experimentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Groups returns the groups in the project, sorted by name
+func (p *Project) Groups() ([]*Group, error) {
+	paths, err := p.repository.List("metadata/groups/")
+	if err != nil {
+		return nil, err
+	}
+	groups := []*Group{}
+	for _, path := range paths {
+		group := new(Group)
+		if err := loadFromPath(p.repository, path, group); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", path, err)
+			continue
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups, nil
+}
+
+// Group returns the group with this name
+func (p *Project) Group(name string) (*Group, error) {
+	if err := validateGroupName(name); err != nil {
+		return nil, err
+	}
+	group := &Group{Name: name}
+	if err := loadFromPath(p.repository, group.MetadataPath(), group); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil, errors.DoesNotExist("Group not found: " + name)
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// CreateGroup creates a group with the experiments with these IDs
+func (p *Project) CreateGroup(name string, experimentIDs []string) (*Group, error) {
+	if err := validateGroupName(name); err != nil {
+		return nil, err
+	}
+	if _, err := p.Group(name); err == nil {
+		return nil, fmt.Errorf("Group %s already exists", name)
+	} else if !errors.IsDoesNotExist(err) {
+		return nil, err
+	}
+	group := &Group{
+		Name:          name,
+		Created:       time.Now().UTC(),
+		ExperimentIDs: []string{},
+	}
+	if err := p.AddToGroup(group, experimentIDs); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// AddToGroup adds the experiments with these IDs to group, if they aren't in
+// it already
+func (p *Project) AddToGroup(group *Group, experimentIDs []string) error {
+	for _, id := range experimentIDs {
+		if !group.Contains(id) {
+			group.ExperimentIDs = append(group.ExperimentIDs, id)
+		}
+	}
+	return p.saveGroup(group)
+}
+
+// RemoveFromGroup removes the experiments with these IDs from group. The
+// experiments themselves aren't deleted.
+func (p *Project) RemoveFromGroup(group *Group, experimentIDs []string) error {
+	remove := map[string]bool{}
+	for _, id := range experimentIDs {
+		remove[id] = true
+	}
+	ids := []string{}
+	for _, id := range group.ExperimentIDs {
+		if !remove[id] {
+			ids = append(ids, id)
+		}
+	}
+	group.ExperimentIDs = ids
+	return p.saveGroup(group)
+}
+
+// DeleteGroup deletes group. The experiments in it aren't deleted.
+func (p *Project) DeleteGroup(group *Group) error {
+	console.Debug("Deleting group: %s", group.Name)
+	return p.repository.Delete(group.MetadataPath())
+}
+
+func (p *Project) saveGroup(group *Group) error {
+	data, err := json.MarshalIndent(group, "", " ")
+	if err != nil {
+		return err
+	}
+	return p.repository.Put(group.MetadataPath(), data)
+}
+
+func validateGroupName(name string) error {
+	if !groupNameRegexp.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("Invalid group name '%s'. It can only contain letters, numbers, '.', '_', and '-', and must start with a letter or number", name)
+	}
+	return nil
+}
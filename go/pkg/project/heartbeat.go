@@ -20,22 +20,38 @@ var heartbeatMissTolerance = 3
 type Heartbeat struct {
 	ExperimentID  string    `json:"experiment_id"`
 	LastHeartbeat time.Time `json:"last_heartbeat"`
+	// ClockOffset is how far the clock of the machine running the
+	// experiment is behind the clock of the repository's storage, in
+	// seconds, so heartbeats from machines with skewed clocks can be compared
+	// with the time on other machines
+	ClockOffset float64 `json:"clock_offset,omitempty"`
+	// Elapsed is how long the experiment has been running, in seconds, as
+	// measured by a monotonic clock on its machine since its first heartbeat.
+	// It isn't affected by the clock being skewed or set while it runs.
+	Elapsed float64 `json:"elapsed,omitempty"`
 }
 
 func CreateHeartbeat(repo repository.Repository, experimentID string, t time.Time) error {
-	heartbeat := &Heartbeat{
+	return saveHeartbeat(repo, &Heartbeat{
 		ExperimentID:  experimentID,
 		LastHeartbeat: t,
-	}
+	})
+}
+
+func heartbeatPath(experimentID string) string {
+	return path.Join("metadata", "heartbeats", experimentID+".json")
+}
+
+func saveHeartbeat(repo repository.Repository, heartbeat *Heartbeat) error {
 	data, err := json.MarshalIndent(heartbeat, "", " ")
 	if err != nil {
 		return err
 	}
-	return repo.Put(path.Join("metadata", "heartbeats", experimentID+".json"), data)
+	return repo.Put(heartbeatPath(heartbeat.ExperimentID), data)
 }
 
 func DeleteHeartbeat(repo repository.Repository, experimentID string) error {
-	return repo.Delete(path.Join("metadata", "heartbeats", experimentID+".json"))
+	return repo.Delete(heartbeatPath(experimentID))
 }
 
 func listHeartbeats(repo repository.Repository) ([]*Heartbeat, error) {
@@ -58,7 +74,39 @@ func listHeartbeats(repo repository.Repository) ([]*Heartbeat, error) {
 func (h *Heartbeat) IsRunning() bool {
 	now := time.Now().UTC()
 	lastTolerableHeartbeat := now.Add(-heartbeatRefreshInterval * time.Duration(heartbeatMissTolerance))
-	return h.LastHeartbeat.After(lastTolerableHeartbeat)
+	return h.StorageTime().After(lastTolerableHeartbeat)
+}
+
+// StorageTime returns when the last heartbeat was, by the clock of the
+// repository's storage rather than the clock of the experiment's machine
+func (h *Heartbeat) StorageTime() time.Time {
+	return h.LastHeartbeat.Add(time.Duration(h.ClockOffset * float64(time.Second)))
+}
+
+// heartbeatClock is the clock of an experiment this process is sending
+// heartbeats for
+type heartbeatClock struct {
+	// started is when the first heartbeat was sent. It has a monotonic
+	// clock reading, so durations measured from it aren't affected by the
+	// clock being set.
+	started time.Time
+	offset  time.Duration
+}
+
+// measureClockOffset returns how far this machine's clock is behind the
+// repository's storage, from when the storage says the heartbeat written at
+// written was saved. It is zero if the storage doesn't say.
+func measureClockOffset(repo repository.Repository, experimentID string, written time.Time) time.Duration {
+	modified, err := repository.ModTime(repo, heartbeatPath(experimentID))
+	if err != nil {
+		console.Debug("Failed to get the time heartbeat for %s was saved: %s", experimentID, err)
+		return 0
+	}
+	if modified.IsZero() {
+		return 0
+	}
+	// some storage only has times to the second
+	return modified.Sub(written).Round(time.Second)
 }
 
 func loadHeartbeatFromPath(repo repository.Repository, path string) (*Heartbeat, error) {
@@ -0,0 +1,91 @@
+package project
+
+import (
+	"os"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/hooks"
+)
+
+// hookPayload is passed as JSON on stdin to hooks, and is the body of webhooks
+type hookPayload struct {
+	Event      string      `json:"event"`
+	Repository string      `json:"repository"`
+	Experiment *Experiment `json:"experiment,omitempty"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// hooksConfigured returns true if there are any hooks or webhooks for event
+func (p *Project) hooksConfigured(event string) bool {
+	return hooks.Configured(p.directory, p.config.Hooks[event], event) || len(p.webhooksFor(event)) > 0
+}
+
+// runHooks runs the hooks for event in .keepsake/hooks and keepsake.yaml, and
+// sends it to the webhooks in keepsake.yaml. Hooks are for side effects, so if
+// they fail, it is only a warning. With --dry-run, it only prints what it would
+// run and send.
+func (p *Project) runHooks(event string, exp *Experiment, chk *Checkpoint) {
+	if !p.hooksConfigured(event) {
+		return
+	}
+	if global.DryRun {
+		for _, hook := range hooks.List(p.directory, p.config.Hooks[event], event) {
+			console.Info("Would run %s hook %s", event, hook)
+		}
+		for _, webhook := range p.webhooksFor(event) {
+			console.Info("Would send %s webhook to %s", event, webhook.URL)
+		}
+		return
+	}
+	payload := &hookPayload{
+		Event:      event,
+		Repository: p.repository.RootURL(),
+		Experiment: exp,
+		Checkpoint: chk,
+	}
+	if err := hooks.Run(p.directory, p.config.Hooks[event], event, payload); err != nil {
+		console.Warn("%s", err)
+	}
+	for _, webhook := range p.webhooksFor(event) {
+		secret := ""
+		if webhook.SecretEnv != "" {
+			secret = os.Getenv(webhook.SecretEnv)
+			if secret == "" {
+				console.Warn("Not sending %s webhook to %s: the environment variable %s, which has the secret to sign it with, isn't set", event, webhook.URL, webhook.SecretEnv)
+				continue
+			}
+		}
+		if err := hooks.PostWebhook(webhook.URL, secret, event, payload); err != nil {
+			console.Warn("%s", err)
+		}
+	}
+}
+
+// queueHooks runs the hooks for event with the work queued on workChan if
+// async is true, so slow hooks and webhooks don't hold up the training
+// process's request that triggered them. Otherwise, they are run straight away.
+func (p *Project) queueHooks(event string, exp *Experiment, chk *Checkpoint, async bool, workChan chan func() error) {
+	if !p.hooksConfigured(event) {
+		return
+	}
+	if !async {
+		p.runHooks(event, exp, chk)
+		return
+	}
+	workChan <- func() error {
+		p.runHooks(event, exp, chk)
+		return nil
+	}
+}
+
+func (p *Project) webhooksFor(event string) []*config.WebhookConfig {
+	webhooks := []*config.WebhookConfig{}
+	for _, webhook := range p.config.Webhooks {
+		if webhook.WantsEvent(event) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
@@ -0,0 +1,92 @@
+package project
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+)
+
+// minCheckpointIDPrefix is the shortest prefix of a checkpoint ID in a param
+// that counts as referring to it, which is the length of a short ID
+const minCheckpointIDPrefix = 7
+
+// LineageLink records that an experiment was started from a checkpoint of
+// another experiment, e.g. to fine-tune it
+type LineageLink struct {
+	ParentExperiment *Experiment
+	Checkpoint       *Checkpoint
+	Experiment       *Experiment
+	// The param of Experiment that refers to Checkpoint
+	Param string
+}
+
+// Lineage returns which experiments were started from checkpoints of other
+// experiments, in the order the experiments were created. An experiment was
+// started from a checkpoint if one of its params is the checkpoint's ID, or a
+// prefix of it at least as long as its short ID, like
+// params={"base_checkpoint": checkpoint.id}.
+func (p *Project) Lineage() ([]*LineageLink, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+
+	type checkpointAndExperiment struct {
+		checkpoint *Checkpoint
+		experiment *Experiment
+	}
+	checkpointsByShortID := map[string][]checkpointAndExperiment{}
+	for _, exp := range experiments {
+		for _, chk := range exp.Checkpoints {
+			if len(chk.ID) < minCheckpointIDPrefix {
+				continue
+			}
+			shortID := chk.ID[:minCheckpointIDPrefix]
+			checkpointsByShortID[shortID] = append(checkpointsByShortID[shortID], checkpointAndExperiment{chk, exp})
+		}
+	}
+
+	links := []*LineageLink{}
+	for _, exp := range experiments {
+		for _, name := range sortedParamNames(exp.Params) {
+			value := exp.Params[name]
+			if value.Type() != param.TypeString || len(value.StringVal()) < minCheckpointIDPrefix {
+				continue
+			}
+			prefix := value.StringVal()
+			var match *checkpointAndExperiment
+			numMatches := 0
+			for _, candidate := range checkpointsByShortID[prefix[:minCheckpointIDPrefix]] {
+				if strings.HasPrefix(candidate.checkpoint.ID, prefix) {
+					candidate := candidate
+					match = &candidate
+					numMatches++
+				}
+			}
+			// an experiment resuming from its own checkpoint isn't a new branch
+			if numMatches != 1 || match.experiment.ID == exp.ID {
+				continue
+			}
+			links = append(links, &LineageLink{
+				ParentExperiment: match.experiment,
+				Checkpoint:       match.checkpoint,
+				Experiment:       exp,
+				Param:            name,
+			})
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Experiment.Created.Before(links[j].Experiment.Created)
+	})
+	return links, nil
+}
+
+func sortedParamNames(params param.ValueMap) []string {
+	names := []string{}
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,207 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// ManifestFile is the size and SHA-256 hash of a file saved with an experiment
+// or checkpoint
+type ManifestFile struct {
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Executable bool   `json:"executable,omitempty"`
+
+	// Delta is true if the file in the tarball is a delta against the same
+	// file in the base checkpoint, instead of the file itself
+	Delta bool `json:"delta,omitempty"`
+}
+
+// Manifest maps the path of each file saved with an experiment or checkpoint,
+// relative to the project directory, to its size and hash. It is written
+// alongside the tarball so truncated or corrupted uploads are detected on checkout.
+type Manifest struct {
+	Files map[string]*ManifestFile `json:"files"`
+
+	// Where the files are stored: empty for a tarball, ManifestStorageObjects
+	// for content-addressed objects, or ManifestStorageDelta for a tarball
+	// with deltas against the checkpoint with the ID Base
+	Storage string `json:"storage,omitempty"`
+	Base    string `json:"base,omitempty"`
+}
+
+// createManifest computes the manifest of the files in includePath inside localPath
+func createManifest(localPath string, includePath string) (*Manifest, error) {
+	manifest := &Manifest{Files: map[string]*ManifestFile{}}
+	err := filepath.Walk(filepath.Join(localPath, includePath), func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(localPath, currentPath)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(currentPath)
+		if err != nil {
+			return err
+		}
+		manifest.Files[filepath.ToSlash(relPath)] = &ManifestFile{
+			Size:       info.Size(),
+			SHA256:     hash,
+			Executable: info.Mode()&0111 != 0,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Verify checks that the files in the manifest have been written to localPath
+// with the right sizes and hashes. If checkoutPath is not empty, only files in
+// checkoutPath are checked.
+func (m *Manifest) Verify(localPath string, checkoutPath string) error {
+	drift, err := m.compare(localPath, checkoutPath)
+	if err != nil {
+		return err
+	}
+	problems := []string{}
+	for _, relPath := range drift.Missing {
+		problems = append(problems, fmt.Sprintf("%s is missing", relPath))
+	}
+	for _, changed := range drift.Changed {
+		problems = append(problems, changed.String())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// compare returns the files in the manifest that are missing from localPath,
+// or have different sizes or hashes. If checkoutPath is not empty, only files
+// in checkoutPath are compared.
+func (m *Manifest) compare(localPath string, checkoutPath string) (*FileDrift, error) {
+	checkoutPath = filepath.ToSlash(filepath.Clean(checkoutPath))
+
+	drift := &FileDrift{Missing: []string{}, Changed: []*ChangedFile{}, Extra: []string{}}
+	for _, relPath := range m.sortedPaths() {
+		if !(checkoutPath == "." || relPath == checkoutPath || strings.HasPrefix(relPath, checkoutPath+"/")) {
+			continue
+		}
+		expected := m.Files[relPath]
+		fullPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				drift.Missing = append(drift.Missing, relPath)
+				continue
+			}
+			return nil, err
+		}
+		if info.Size() != expected.Size {
+			drift.Changed = append(drift.Changed, &ChangedFile{Path: relPath, Size: info.Size(), ExpectedSize: expected.Size})
+			continue
+		}
+		hash, err := hashFile(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if hash != expected.SHA256 {
+			drift.Changed = append(drift.Changed, &ChangedFile{Path: relPath, Size: info.Size(), ExpectedSize: expected.Size, SHA256: hash, ExpectedSHA256: expected.SHA256})
+		}
+	}
+	return drift, nil
+}
+
+func (m *Manifest) sortedPaths() []string {
+	paths := make([]string, 0, len(m.Files))
+	for p := range m.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// size returns the total size of the files in checkoutPath, or all the files
+// if checkoutPath is empty
+func (m *Manifest) size(checkoutPath string) int64 {
+	prefix := filepath.ToSlash(filepath.Clean(checkoutPath))
+	var size int64
+	for relPath, file := range m.Files {
+		if checkoutPath == "" || relPath == prefix || strings.HasPrefix(relPath, prefix+"/") {
+			size += file.Size
+		}
+	}
+	return size
+}
+
+func saveManifest(repo repository.Repository, manifestPath string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", " ")
+	if err != nil {
+		return fmt.Errorf("Failed to serialize manifest: %w", err)
+	}
+	return repo.Put(manifestPath, data)
+}
+
+// loadManifest returns the manifest at manifestPath, or nil if it doesn't exist
+// (e.g. it was saved with an older version of Keepsake)
+func loadManifest(repo repository.Repository, manifestPath string) (*Manifest, error) {
+	data, err := repo.Get(manifestPath)
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Failed to parse manifest %s: %w", manifestPath, err)
+	}
+	return manifest, nil
+}
+
+// verifyManifest checks the files checked out to outputDir against the manifest
+// at manifestPath. description is used in the error message, e.g. "checkpoint abc123".
+func (p *Project) verifyManifest(manifestPath string, outputDir string, checkoutPath string, description string) error {
+	manifest, err := loadManifest(p.repository, manifestPath)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		console.Debug("No manifest found at %s, skipping verification of %s", manifestPath, description)
+		return nil
+	}
+	if err := manifest.Verify(outputDir, checkoutPath); err != nil {
+		return errors.Corrupt(fmt.Sprintf("The files checked out from %s do not match the ones that were saved. The upload may have been truncated or the repository may be corrupted:\n%v", description, err))
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
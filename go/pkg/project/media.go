@@ -0,0 +1,250 @@
+package project
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	// decoders for image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/files"
+)
+
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+)
+
+// MediaDir is the name of the directory images and audio are saved in, by
+// convention, so they are shown with their checkpoint
+const MediaDir = "samples"
+
+var mediaExtensions = map[string]string{
+	".png":  MediaImage,
+	".jpg":  MediaImage,
+	".jpeg": MediaImage,
+	".gif":  MediaImage,
+	".bmp":  MediaImage,
+	".webp": MediaImage,
+	".wav":  MediaAudio,
+	".mp3":  MediaAudio,
+	".flac": MediaAudio,
+	".ogg":  MediaAudio,
+}
+
+// Media is an image or audio file saved with a checkpoint. The dimensions and
+// duration are zero if they aren't known.
+type Media struct {
+	Path       string
+	Kind       string
+	Size       int64
+	Width      int
+	Height     int
+	Duration   time.Duration
+	SampleRate int
+}
+
+// Summary describes the media file's format, e.g. "256x256" or "2.5s, 16000 Hz"
+func (m *Media) Summary() string {
+	details := []string{}
+	if m.Width > 0 && m.Height > 0 {
+		details = append(details, fmt.Sprintf("%dx%d", m.Width, m.Height))
+	}
+	if m.Duration > 0 {
+		details = append(details, fmt.Sprintf("%.3gs", m.Duration.Seconds()))
+	}
+	if m.SampleRate > 0 {
+		details = append(details, fmt.Sprintf("%d Hz", m.SampleRate))
+	}
+	return strings.Join(details, ", ")
+}
+
+func mediaKind(p string) string {
+	return mediaExtensions[strings.ToLower(path.Ext(p))]
+}
+
+func inMediaDir(p string) bool {
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		if dir == MediaDir {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckpointMedia returns the images and audio saved with a checkpoint, sorted
+// by path. They are the files in a directory called "samples", and the files
+// that image and audio metrics refer to. This doesn't download any files, so
+// only what is in the checkpoint's metadata is filled in.
+func (p *Project) CheckpointMedia(chk *Checkpoint) ([]*Media, error) {
+	byPath := map[string]*Media{}
+	manifest, err := loadManifest(p.repository, chk.ManifestPath())
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil {
+		for relPath, file := range manifest.Files {
+			if kind := mediaKind(relPath); kind != "" && inMediaDir(relPath) {
+				byPath[relPath] = &Media{Path: relPath, Kind: kind, Size: file.Size}
+			}
+		}
+	}
+
+	for _, metric := range chk.SortedMetrics() {
+		metricPath := metric.Value.MediaPath()
+		if metricPath == "" {
+			continue
+		}
+		// metrics' paths are relative to the checkpoint's files, which are
+		// stored relative to the project directory
+		relPath := path.Clean(metricPath)
+		if manifest != nil && manifest.Files[relPath] == nil && chk.Path != "" {
+			if joined := path.Join(chk.Path, metricPath); manifest.Files[joined] != nil {
+				relPath = joined
+			}
+		}
+		media, ok := byPath[relPath]
+		if !ok {
+			media = &Media{Path: relPath, Kind: string(metric.Value.StructuredType())}
+			if manifest != nil && manifest.Files[relPath] != nil {
+				media.Size = manifest.Files[relPath].Size
+			}
+			byPath[relPath] = media
+		}
+		obj, _ := metric.Value.ObjectVal().(map[string]interface{})
+		if width, ok := obj["width"].(float64); ok {
+			media.Width = int(width)
+		}
+		if height, ok := obj["height"].(float64); ok {
+			media.Height = int(height)
+		}
+		if duration, ok := obj["duration"].(float64); ok {
+			media.Duration = time.Duration(duration * float64(time.Second))
+		}
+		if sampleRate, ok := obj["sample_rate"].(float64); ok {
+			media.SampleRate = int(sampleRate)
+		}
+	}
+
+	ret := []*Media{}
+	for _, media := range byPath {
+		ret = append(ret, media)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret, nil
+}
+
+// ReadMediaInfo downloads a checkpoint's files and fills in the dimensions of
+// images and the duration of audio in media, from the files themselves. Files
+// in formats that can't be read are left as they are.
+func (p *Project) ReadMediaInfo(chk *Checkpoint, media []*Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+	dir, err := files.TempDir("media")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := p.getCheckpointFiles(chk, dir, ""); err != nil {
+		return err
+	}
+	for _, m := range media {
+		if err := readMediaFile(m, filepath.Join(dir, filepath.FromSlash(m.Path))); err != nil {
+			console.Debug("Failed to read %s: %s", m.Path, err)
+		}
+	}
+	return nil
+}
+
+func readMediaFile(m *Media, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		m.Size = info.Size()
+	}
+	switch {
+	case m.Kind == MediaImage:
+		conf, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return err
+		}
+		m.Width, m.Height = conf.Width, conf.Height
+	case strings.ToLower(path.Ext(m.Path)) == ".wav":
+		duration, sampleRate, err := readWAVHeader(f)
+		if err != nil {
+			return err
+		}
+		m.Duration, m.SampleRate = duration, sampleRate
+	}
+	return nil
+}
+
+// readWAVHeader returns the duration and sample rate of a WAV file
+func readWAVHeader(r io.Reader) (duration time.Duration, sampleRate int, err error) {
+	var header struct {
+		RIFF [4]byte
+		Size uint32
+		WAVE [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return 0, 0, err
+	}
+	if string(header.RIFF[:]) != "RIFF" || string(header.WAVE[:]) != "WAVE" {
+		return 0, 0, fmt.Errorf("Not a WAV file")
+	}
+	var byteRate uint32
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return 0, 0, err
+		}
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var format struct {
+				AudioFormat uint16
+				Channels    uint16
+				SampleRate  uint32
+				ByteRate    uint32
+			}
+			if err := binary.Read(r, binary.LittleEndian, &format); err != nil {
+				return 0, 0, err
+			}
+			sampleRate, byteRate = int(format.SampleRate), format.ByteRate
+			if _, err := io.CopyN(ioutil.Discard, r, int64(chunk.Size+chunk.Size%2)-12); err != nil {
+				return 0, 0, err
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0, 0, fmt.Errorf("WAV file has no format before its data")
+			}
+			seconds := float64(chunk.Size) / float64(byteRate)
+			return time.Duration(seconds * float64(time.Second)), sampleRate, nil
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(ioutil.Discard, r, int64(chunk.Size+chunk.Size%2)); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package project
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// wavFile returns a WAV file with one second of silence, as 16-bit mono
+func wavFile(t *testing.T, sampleRate uint32) []byte {
+	buf := new(bytes.Buffer)
+	dataSize := sampleRate * 2
+	for _, v := range []interface{}{
+		[]byte("RIFF"), uint32(36 + dataSize), []byte("WAVE"),
+		[]byte("fmt "), uint32(16), uint16(1), uint16(1), sampleRate, sampleRate * 2, uint16(2), uint16(16),
+		[]byte("data"), dataSize, make([]byte, dataSize),
+	} {
+		require.NoError(t, binary.Write(buf, binary.LittleEndian, v))
+	}
+	return buf.Bytes()
+}
+
+func TestCheckpointMedia(t *testing.T) {
+	projectDir, err := files.TempDir("test-media")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "outputs", "samples"), 0755))
+	pngData := new(bytes.Buffer)
+	require.NoError(t, png.Encode(pngData, image.NewRGBA(image.Rect(0, 0, 32, 16))))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "outputs", "samples", "1.png"), pngData.Bytes(), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "outputs", "samples", "1.wav"), wavFile(t, 8000), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "outputs", "confusion.png"), pngData.Bytes(), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "outputs", "model.pth"), []byte("weights"), 0644))
+
+	confusion := param.Value{}
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "image", "path": "confusion.png", "width": 32, "height": 16}`), &confusion))
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{
+		Path:    "outputs",
+		Metrics: param.ValueMap{"confusion": confusion, "loss": param.Float(0.1)},
+	}, false, nil, true)
+	require.NoError(t, err)
+
+	// the files in samples/, and the files metrics refer to
+	media, err := proj.CheckpointMedia(chk)
+	require.NoError(t, err)
+	require.Equal(t, []*Media{
+		{Path: "outputs/confusion.png", Kind: MediaImage, Size: int64(pngData.Len()), Width: 32, Height: 16},
+		{Path: "outputs/samples/1.png", Kind: MediaImage, Size: int64(pngData.Len())},
+		{Path: "outputs/samples/1.wav", Kind: MediaAudio, Size: 16044},
+	}, media)
+
+	require.NoError(t, proj.ReadMediaInfo(chk, media))
+	require.Equal(t, 32, media[1].Width)
+	require.Equal(t, 16, media[1].Height)
+	require.Equal(t, "32x16", media[1].Summary())
+	require.Equal(t, time.Second, media[2].Duration)
+	require.Equal(t, 8000, media[2].SampleRate)
+	require.Equal(t, "1s, 8000 Hz", media[2].Summary())
+}
@@ -0,0 +1,46 @@
+package project
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// ProjectSummary describes a project stored in a shared repository
+type ProjectSummary struct {
+	Name           string
+	NumExperiments int
+}
+
+// ListProjects returns the projects in the repository at the root of a bucket
+// that several projects share, sorted by name. A project is listed once an
+// experiment has been saved to it.
+func ListProjects(root repository.Repository) ([]*ProjectSummary, error) {
+	results := make(chan repository.ListResult)
+	go root.MatchFilenamesRecursive(results, config.ProjectsDir, repository.SpecPath)
+	names := []string{}
+	for result := range results {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		// projects/<name>/repository.json
+		parts := strings.Split(strings.TrimPrefix(result.Path, "/"), "/")
+		if len(parts) == 3 && parts[0] == config.ProjectsDir {
+			names = append(names, parts[1])
+		}
+	}
+	sort.Strings(names)
+
+	summaries := []*ProjectSummary{}
+	for _, name := range names {
+		experiments, err := root.List(path.Join(config.ProjectsDir, name, "metadata", "experiments"))
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &ProjectSummary{Name: name, NumExperiments: len(experiments)})
+	}
+	return summaries, nil
+}
@@ -0,0 +1,114 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/param"
+)
+
+// DefaultParamsFiles are the files in the project directory that `keepsake
+// save` reads params from if a params file isn't passed, in the order they are
+// looked for
+var DefaultParamsFiles = []string{"params.yaml", "params.yml"}
+
+// DefaultParamsFile returns the first of DefaultParamsFiles that exists in the
+// project directory, or an empty string if there isn't one
+func (p *Project) DefaultParamsFile() (string, error) {
+	for _, name := range DefaultParamsFiles {
+		exists, err := files.FileExists(filepath.Join(p.directory, name))
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// loadParamsFile reads experiment params from a YAML (or JSON) file with an
+// object at the top level. Relative paths are relative to the project
+// directory. If paramsFile is empty, no params are returned.
+func (p *Project) loadParamsFile(paramsFile string) (param.ValueMap, error) {
+	if paramsFile == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(paramsFile) {
+		paramsFile = filepath.Join(p.directory, paramsFile)
+	}
+
+	text, err := ioutil.ReadFile(paramsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read params file: %w", err)
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(text, &values); err != nil {
+		return nil, fmt.Errorf("Failed to parse params file %s: it must contain an object with a param on each line, like 'learning_rate: 0.01'", paramsFile)
+	}
+	params := param.ValueMap{}
+	for name, value := range values {
+		params[name], err = paramFromYAML(value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse param %s in params file %s: %w", name, paramsFile, err)
+		}
+	}
+	return params, nil
+}
+
+// paramFromYAML converts a value decoded by yaml.v2 to a param. Numbers are
+// converted directly, rather than through JSON, so a float like 1.0 doesn't
+// become an int.
+func paramFromYAML(value interface{}) (param.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return param.None(), nil
+	case bool:
+		return param.Bool(v), nil
+	case int:
+		return param.Int(int64(v)), nil
+	case int64:
+		return param.Int(v), nil
+	case uint64:
+		return param.Float(float64(v)), nil
+	case float64:
+		return param.Float(v), nil
+	case string:
+		return param.String(v), nil
+	}
+	// lists and objects are stored as they would be if they came from JSON
+	data, err := json.Marshal(jsonCompatible(value))
+	if err != nil {
+		return param.Value{}, err
+	}
+	var v param.Value
+	if err := v.UnmarshalJSON(data); err != nil {
+		return param.Value{}, err
+	}
+	return v, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} objects that yaml.v2
+// decodes to map[string]interface{}, so they can be marshalled to JSON
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, val := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = jsonCompatible(val)
+		}
+		return l
+	}
+	return value
+}
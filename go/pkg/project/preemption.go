@@ -0,0 +1,55 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// Preemption records that an experiment's machine was reclaimed by the
+// cloud provider (e.g. a spot or preemptible instance), so the experiment
+// can be shown as preempted rather than as having crashed
+type Preemption struct {
+	ExperimentID string    `json:"experiment_id"`
+	Provider     string    `json:"provider"`
+	Time         time.Time `json:"time"`
+}
+
+func CreatePreemption(repo repository.Repository, experimentID string, provider string, t time.Time) error {
+	preemption := &Preemption{
+		ExperimentID: experimentID,
+		Provider:     provider,
+		Time:         t,
+	}
+	data, err := json.MarshalIndent(preemption, "", " ")
+	if err != nil {
+		return err
+	}
+	return repo.Put(path.Join("metadata", "preemptions", experimentID+".json"), data)
+}
+
+func listPreemptions(repo repository.Repository) ([]*Preemption, error) {
+	paths, err := repo.List("metadata/preemptions/")
+	if err != nil {
+		return nil, err
+	}
+	preemptions := []*Preemption{}
+	for _, p := range paths {
+		contents, err := repo.Get(p)
+		if err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, err)
+			continue
+		}
+		preemption := new(Preemption)
+		if err := json.Unmarshal(contents, preemption); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, fmt.Errorf("Parse error: %s", err))
+			continue
+		}
+		preemptions = append(preemptions, preemption)
+	}
+	return preemptions, nil
+}
@@ -7,12 +7,14 @@ import (
 	"os"
 	"os/user"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/replicate/keepsake/go/pkg/config"
 	"github.com/replicate/keepsake/go/pkg/console"
 	"github.com/replicate/keepsake/go/pkg/errors"
 	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/hooks"
 	"github.com/replicate/keepsake/go/pkg/param"
 	"github.com/replicate/keepsake/go/pkg/repository"
 )
@@ -22,17 +24,56 @@ const IDLength = 64
 // Project is essentially a data access object for retrieving
 // metadata objects
 type Project struct {
-	repository        repository.Repository
-	directory         string
-	experimentsByID   map[string]*Experiment
-	heartbeatsByExpID map[string]*Heartbeat
-	hasLoaded         bool
+	repository          repository.Repository
+	directory           string
+	config              *config.Config
+	experimentsByID     map[string]*Experiment
+	heartbeatsByExpID   map[string]*Heartbeat
+	preemptionsByExpID  map[string]*Preemption
+	earlyStopsByExpID   map[string]*EarlyStop
+	stateRecordsByExpID map[string]*StateRecord
+	stopRequestsByExpID map[string]*StopRequest
+	tagsByExpID         map[string]*ExperimentTags
+	uploadsByChkID      map[string]*Upload
+	hasLoaded           bool
+
+	// The clocks of the experiments this process is sending heartbeats for
+	heartbeatMu     sync.Mutex
+	heartbeatClocks map[string]*heartbeatClock
+
+	// The last checkpoint saved with each path in each experiment, for
+	// checkpoint_deltas. It is only used by the goroutine that saves checkpoints.
+	deltaBases map[deltaBaseKey]*deltaBase
+
+	// Checkpoints whose files are queued to be saved, and checkpoints replaced
+	// by checkpoint_step_policy whose files are deleted when none are queued,
+	// because the queued checkpoints may be saved as deltas against them
+	uploadsMu       sync.Mutex
+	pendingUploads  map[string]bool
+	replacedPending []replacedCheckpoint
+
+	// The repository's storage quota, how much of it was used when it was
+	// last listed, and how much this process has used since
+	quotaMu                sync.Mutex
+	quotaLoaded            bool
+	quota                  *repository.Quota
+	quotaUsage             *StorageUsage
+	quotaReserved          *StorageUsage
+	quotaRefreshing        bool
+	quotaReservedInRefresh *StorageUsage
 }
 
 func NewProject(repo repository.Repository, directory string) *Project {
+	return NewProjectWithConfig(repo, directory, &config.Config{})
+}
+
+// NewProjectWithConfig creates a project that applies the per-project
+// settings in conf (i.e. keepsake.yaml)
+func NewProjectWithConfig(repo repository.Repository, directory string, conf *config.Config) *Project {
 	return &Project{
 		repository: repo,
 		directory:  directory,
+		config:     conf,
 		hasLoaded:  false,
 	}
 }
@@ -175,6 +216,14 @@ func (p *Project) DeleteCheckpoint(chk *Checkpoint) error {
 	if err := p.repository.Delete(chk.StorageTarPath()); err != nil {
 		console.Warn("Failed to delete checkpoint storage directory %s: %s", chk.StorageTarPath(), err)
 	}
+	if err := p.repository.Delete(chk.ManifestPath()); err != nil {
+		console.Warn("Failed to delete checkpoint manifest %s: %s", chk.ManifestPath(), err)
+	}
+	if _, ok := p.uploadsByChkID[chk.ID]; ok {
+		if err := p.repository.Delete(chk.UploadPath()); err != nil {
+			console.Warn("Failed to delete checkpoint upload marker %s: %s", chk.UploadPath(), err)
+		}
+	}
 	p.invalidateCache()
 	return nil
 }
@@ -184,9 +233,30 @@ func (p *Project) DeleteExperiment(exp *Experiment) error {
 	if err := p.repository.Delete(exp.HeartbeatPath()); err != nil {
 		console.Warn("Failed to delete heartbeat file %s: %s", exp.HeartbeatPath(), err)
 	}
+	if err := p.repository.Delete(exp.PreemptionPath()); err != nil {
+		console.Warn("Failed to delete preemption file %s: %s", exp.PreemptionPath(), err)
+	}
+	if err := p.repository.Delete(exp.EarlyStopPath()); err != nil {
+		console.Warn("Failed to delete early stop file %s: %s", exp.EarlyStopPath(), err)
+	}
+	if err := p.repository.Delete(stateRecordPath(exp.ID)); err != nil {
+		console.Warn("Failed to delete state file %s: %s", stateRecordPath(exp.ID), err)
+	}
+	if err := p.repository.Delete(stopRequestPath(exp.ID)); err != nil {
+		console.Warn("Failed to delete stop request file %s: %s", stopRequestPath(exp.ID), err)
+	}
+	if err := p.repository.Delete(exp.TagsPath()); err != nil {
+		console.Warn("Failed to delete tags file %s: %s", exp.TagsPath(), err)
+	}
+	if err := p.deleteSystemMetrics(exp); err != nil {
+		console.Warn("Failed to delete system metrics %s: %s", exp.SystemMetricsDir(), err)
+	}
 	if err := p.repository.Delete(exp.StorageTarPath()); err != nil {
 		console.Warn("Failed to delete experiment storage directory %s: %s", exp.StorageTarPath(), err)
 	}
+	if err := p.repository.Delete(exp.ManifestPath()); err != nil {
+		console.Warn("Failed to delete experiment manifest %s: %s", exp.ManifestPath(), err)
+	}
 	if err := p.repository.Delete(exp.MetadataPath()); err != nil {
 		console.Warn("Failed to delete experiment metadata file %s: %s", exp.MetadataPath(), err)
 	}
@@ -198,6 +268,7 @@ type CreateExperimentArgs struct {
 	Path           string
 	Command        string
 	Params         map[string]param.Value
+	ParamsFile     string
 	PythonPackages map[string]string
 	PythonVersion  string
 }
@@ -211,8 +282,8 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 		if err := repository.WriteSpec(p.repository); err != nil {
 			return nil, err
 		}
-	} else if spec.Version > repository.Version {
-		return nil, errors.IncompatibleRepositoryVersion(p.repository.RootURL())
+	} else if err := spec.CheckCompatible(p.repository.RootURL(), global.Version); err != nil {
+		return nil, err
 	}
 
 	host := "" // currently disabled and unused
@@ -225,10 +296,36 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 	}
 	conf := &config.Config{Repository: p.repository.RootURL()}
 
+	template, err := p.config.ActiveTemplate()
+	if err != nil {
+		return nil, err
+	}
+	fileParams, err := p.loadParamsFile(args.ParamsFile)
+	if err != nil {
+		return nil, err
+	}
+	params := args.Params
+	if (template != nil && len(template.Params) > 0) || len(fileParams) > 0 {
+		// params passed to the experiment override the params file's, which
+		// override the template's
+		params = param.ValueMap{}
+		if template != nil {
+			for k, v := range template.Params {
+				params[k] = v
+			}
+		}
+		for k, v := range fileParams {
+			params[k] = v
+		}
+		for k, v := range args.Params {
+			params[k] = v
+		}
+	}
+
 	exp := &Experiment{
 		ID:              generateRandomID(),
 		Created:         time.Now().UTC(),
-		Params:          args.Params,
+		Params:          RedactParams(params, p.config.SensitiveParams),
 		Host:            host,
 		User:            username,
 		Config:          conf,
@@ -239,8 +336,32 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 		KeepsakeVersion: global.Version,
 	}
 
+	// before anything is saved, so nothing is left behind if it's too big,
+	// has bad file names or would go over the quota
+	tempDir := ""
+	if exp.Path != "" {
+		if err := p.checkSnapshotSize(exp.Path); err != nil {
+			return nil, err
+		}
+		tempDir, err = repository.CopyToTempDir(p.directory, exp.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to copy files to temporary directory: %v", err)
+		}
+		if err := p.checkFileNames(tempDir, exp.Path); err != nil {
+			os.RemoveAll(tempDir)
+			return nil, err
+		}
+		if err := p.reserveQuota(tempDir, exp.Path); err != nil {
+			os.RemoveAll(tempDir)
+			return nil, err
+		}
+	}
+
 	// save json synchronously to uncover repository write issues
-	if _, err := p.SaveExperiment(exp, false); err != nil {
+	if err := p.saveCreatedExperiment(exp, template); err != nil {
+		if tempDir != "" {
+			os.RemoveAll(tempDir)
+		}
 		return nil, err
 	}
 
@@ -248,25 +369,20 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 		if !quiet {
 			console.Info("Creating experiment %s...", exp.ShortID())
 		}
+		p.queueHooks(hooks.ExperimentCreated, exp, nil, async, workChan)
 		return exp, nil
 	}
 
-	tempDir, err := repository.CopyToTempDir(p.directory, exp.Path)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to copy files to temporary directory: %v", err)
-	}
-
 	if !quiet {
 		console.Info("Creating experiment %s, copying '%s' to '%s' in the background...", exp.ShortID(), exp.Path, p.repository.RootURL())
 	}
 
 	work := func() error {
 		defer os.RemoveAll(tempDir)
-		start := time.Now()
-		if err := p.repository.PutPathTar(tempDir, exp.StorageTarPath(), exp.Path); err != nil {
+		if err := p.saveExperimentFiles(tempDir, exp); err != nil {
 			return err
 		}
-		console.Debug("Copied files for experiment %s from '%s' to '%s/%s' (took %.3f seconds)", exp.ShortID(), exp.Path, p.repository.RootURL(), exp.StorageTarPath(), time.Since(start).Seconds())
+		p.runHooks(hooks.ExperimentCreated, exp, nil)
 		return nil
 	}
 
@@ -280,14 +396,78 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 	return exp, nil
 }
 
+// saveCreatedExperiment saves a new experiment, its created state and its template's tags
+func (p *Project) saveCreatedExperiment(exp *Experiment, template *config.TemplateConfig) error {
+	if _, err := p.SaveExperiment(exp, false); err != nil {
+		return err
+	}
+	if err := saveStateRecord(p.repository, exp.ID, StateCreated, exp.Created); err != nil {
+		return err
+	}
+	if template != nil {
+		if err := CreateExperimentTags(p.repository, exp.ID, p.config.Template, template.Tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveExperimentFiles saves the files in exp.Path in tempDir to the repository,
+// as a tarball or content-addressed objects depending on code_snapshots in keepsake.yaml
+func (p *Project) saveExperimentFiles(tempDir string, exp *Experiment) error {
+	start := time.Now()
+	manifest, err := createManifest(tempDir, exp.Path)
+	if err != nil {
+		return err
+	}
+	if p.config.CodeSnapshots == config.SnapshotContentAddressed {
+		manifest.Storage = ManifestStorageObjects
+		uploaded, err := p.putObjects(tempDir, manifest)
+		if err != nil {
+			return err
+		}
+		// saved after the objects, so it never refers to objects that don't exist
+		if err := saveManifest(p.repository, exp.ManifestPath(), manifest); err != nil {
+			return err
+		}
+		console.Debug("Copied %d changed files of %d for experiment %s from '%s' to '%s/objects' (took %.3f seconds)", uploaded, len(manifest.Files), exp.ShortID(), exp.Path, p.repository.RootURL(), time.Since(start).Seconds())
+		return nil
+	}
+	if err := saveManifest(p.repository, exp.ManifestPath(), manifest); err != nil {
+		return err
+	}
+	if err := p.repository.PutPathTar(tempDir, exp.StorageTarPath(), exp.Path); err != nil {
+		return err
+	}
+	console.Debug("Copied files for experiment %s from '%s' to '%s/%s' (took %.3f seconds)", exp.ShortID(), exp.Path, p.repository.RootURL(), exp.StorageTarPath(), time.Since(start).Seconds())
+	return nil
+}
+
 type CreateCheckpointArgs struct {
 	Path          string
 	Step          int64
 	Metrics       map[string]param.Value
 	PrimaryMetric *PrimaryMetric
+	// NoStep is true if the checkpoint doesn't have a step, so Step is ignored
+	NoStep bool
+	// ExperimentID is the experiment the checkpoint belongs to. Checkpoints
+	// without one are never stored as deltas.
+	ExperimentID string
 }
 
 func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workChan chan func() error, quiet bool) (*Checkpoint, error) {
+	if args.PrimaryMetric == nil {
+		template, err := p.config.ActiveTemplate()
+		if err != nil {
+			return nil, err
+		}
+		if template != nil && template.PrimaryMetric != nil {
+			args.PrimaryMetric = &PrimaryMetric{
+				Name: template.PrimaryMetric.Name,
+				Goal: MetricGoal(template.PrimaryMetric.Goal),
+			}
+		}
+	}
 	chk := &Checkpoint{
 		ID:            generateRandomID(),
 		Created:       time.Now().UTC(),
@@ -295,6 +475,13 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 		Step:          args.Step,
 		Path:          args.Path,
 		PrimaryMetric: args.PrimaryMetric,
+		NoStep:        args.NoStep,
+	}
+	if chk.NoStep {
+		chk.Step = 0
+	}
+	if err := p.checkDuplicateStep(args); err != nil {
+		return nil, err
 	}
 
 	// if path is empty (i.e. it was None in python), just return
@@ -303,6 +490,7 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 		if !quiet {
 			console.Info("Creating checkpoint %s...", chk.ShortID())
 		}
+		p.queueHooks(hooks.CheckpointSaved, nil, chk, async, workChan)
 		return chk, nil
 	}
 
@@ -314,14 +502,24 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 	if err != nil {
 		return nil, fmt.Errorf("Failed to copy files to temporary directory: %v", err)
 	}
+	if err := p.checkFileNames(tempDir, chk.Path); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	if err := p.reserveQuota(tempDir, chk.Path); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
 
+	p.startPendingUpload(chk.ID)
 	work := func() error {
-		defer os.RemoveAll(tempDir)
+		defer p.finishPendingUpload(chk.ID)
 		start := time.Now()
-		if err := p.repository.PutPathTar(tempDir, chk.StorageTarPath(), chk.Path); err != nil {
+		if err := p.saveCheckpointFiles(tempDir, args.ExperimentID, chk); err != nil {
 			return err
 		}
 		console.Debug("Copied files for checkpoint %s from '%s' to '%s/%s' (took %.3f seconds)", chk.ShortID(), chk.Path, p.repository.RootURL(), chk.StorageTarPath(), time.Since(start).Seconds())
+		p.runHooks(hooks.CheckpointSaved, nil, chk)
 		return nil
 	}
 	if async {
@@ -337,6 +535,11 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 
 func (p *Project) SaveExperiment(exp *Experiment, quiet bool) (*Experiment, error) {
 	// TODO(andreas): use quiet flag
+	exp.Params = RedactParams(exp.Params, p.config.SensitiveParams)
+	removeDerivedMetrics(exp)
+	if err := p.applyCheckpointStepPolicy(exp); err != nil {
+		return nil, err
+	}
 	if err := exp.Save(p.repository); err != nil {
 		return nil, err
 	}
@@ -344,15 +547,303 @@ func (p *Project) SaveExperiment(exp *Experiment, quiet bool) (*Experiment, erro
 	return exp, nil
 }
 
+// checkDuplicateStep returns an error if checkpoint_step_policy is "error" and
+// the experiment the checkpoint is being created in already has a checkpoint
+// with its step
+func (p *Project) checkDuplicateStep(args CreateCheckpointArgs) error {
+	if p.config.CheckpointStepPolicy != config.StepPolicyError || args.NoStep || args.ExperimentID == "" {
+		return nil
+	}
+	exp := &Experiment{ID: args.ExperimentID}
+	if err := loadFromPath(p.repository, exp.MetadataPath(), exp); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, chk := range exp.Checkpoints {
+		if !chk.NoStep && chk.Step == args.Step {
+			return fmt.Errorf("Experiment %s already has a checkpoint with step %d (%s).\n\nTo allow this, set checkpoint_step_policy in keepsake.yaml to '%s' or '%s'.", exp.ShortID(), args.Step, chk.ShortID(), config.StepPolicyKeepLatest, config.StepPolicyKeepAll)
+		}
+	}
+	return nil
+}
+
+// applyCheckpointStepPolicy handles checkpoints that have the same step as
+// another checkpoint in the experiment (e.g. when a training loop is resumed),
+// according to checkpoint_step_policy in keepsake.yaml. Checkpoints without a
+// step are always kept.
+func (p *Project) applyCheckpointStepPolicy(exp *Experiment) error {
+	// the error policy is checked by CreateCheckpoint, before anything is saved
+	if p.config.CheckpointStepPolicy != config.StepPolicyKeepLatest {
+		return nil
+	}
+
+	latestByStep := map[int64]*Checkpoint{}
+	for _, chk := range exp.Checkpoints {
+		if chk.NoStep {
+			continue
+		}
+		if latest, ok := latestByStep[chk.Step]; !ok || chk.Created.After(latest.Created) {
+			latestByStep[chk.Step] = chk
+		}
+	}
+
+	checkpoints := []*Checkpoint{}
+	replaced := []*Checkpoint{}
+	for _, chk := range exp.Checkpoints {
+		if chk.NoStep || latestByStep[chk.Step] == chk {
+			checkpoints = append(checkpoints, chk)
+			continue
+		}
+		console.Debug("Replacing checkpoint %s with checkpoint %s, which has the same step (%d)", chk.ShortID(), latestByStep[chk.Step].ShortID(), chk.Step)
+		if chk.Path != "" {
+			replaced = append(replaced, chk)
+		}
+	}
+	exp.Checkpoints = checkpoints
+
+	remaining := &Experiment{ID: exp.ID, Checkpoints: copyCheckpoints(checkpoints)}
+	for _, chk := range replaced {
+		if p.deferReplacedCheckpoint(remaining, chk) {
+			continue
+		}
+		if err := p.deleteReplacedCheckpoint(remaining, chk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacedCheckpoint is a checkpoint replaced by checkpoint_step_policy, and
+// the experiment it was removed from
+type replacedCheckpoint struct {
+	exp *Experiment
+	chk *Checkpoint
+}
+
+// deleteReplacedCheckpoint deletes the files of a checkpoint that has been
+// removed from exp, unless other checkpoints in exp are stored as deltas
+// against them
+func (p *Project) deleteReplacedCheckpoint(exp *Experiment, chk *Checkpoint) error {
+	dependents, err := p.DeltaDependents(exp, chk)
+	if err != nil {
+		return err
+	}
+	if len(dependents) > 0 {
+		console.Debug("Keeping the files of checkpoint %s, because checkpoint %s is stored as deltas against them", chk.ShortID(), dependents[0].ShortID())
+		return nil
+	}
+	if err := p.repository.Delete(chk.StorageTarPath()); err != nil {
+		console.Warn("Failed to delete checkpoint storage directory %s: %s", chk.StorageTarPath(), err)
+	}
+	if err := p.repository.Delete(chk.ManifestPath()); err != nil {
+		console.Warn("Failed to delete checkpoint manifest %s: %s", chk.ManifestPath(), err)
+	}
+	return nil
+}
+
+// deferReplacedCheckpoint returns true if checkpoints are queued to be saved,
+// in which case chk's files are deleted once they have all been saved. Until
+// then, their manifests can't be read to find out whether they are stored as
+// deltas against chk.
+func (p *Project) deferReplacedCheckpoint(exp *Experiment, chk *Checkpoint) bool {
+	p.uploadsMu.Lock()
+	defer p.uploadsMu.Unlock()
+	if len(p.pendingUploads) == 0 {
+		return false
+	}
+	p.replacedPending = append(p.replacedPending, replacedCheckpoint{exp: exp, chk: chk})
+	return true
+}
+
+func (p *Project) startPendingUpload(checkpointID string) {
+	p.uploadsMu.Lock()
+	defer p.uploadsMu.Unlock()
+	if p.pendingUploads == nil {
+		p.pendingUploads = map[string]bool{}
+	}
+	p.pendingUploads[checkpointID] = true
+}
+
+// finishPendingUpload marks a checkpoint's files as saved, and deletes the
+// files of replaced checkpoints if nothing else is queued
+func (p *Project) finishPendingUpload(checkpointID string) {
+	p.uploadsMu.Lock()
+	delete(p.pendingUploads, checkpointID)
+	replaced := []replacedCheckpoint{}
+	if len(p.pendingUploads) == 0 {
+		replaced = p.replacedPending
+		p.replacedPending = nil
+	}
+	p.uploadsMu.Unlock()
+
+	for _, r := range replaced {
+		if err := p.deleteReplacedCheckpoint(r.exp, r.chk); err != nil {
+			console.Warn("Failed to delete the files of replaced checkpoint %s: %v", r.chk.ShortID(), err)
+		}
+	}
+}
+
+// RefreshHeartbeat saves a heartbeat for an experiment, marking it as running.
+// The first heartbeat an experiment gets from this process is used to measure
+// how far this machine's clock is from the repository's storage, which later
+// heartbeats record along with how long the experiment has been running.
 func (p *Project) RefreshHeartbeat(experimentID string) error {
-	return CreateHeartbeat(p.repository, experimentID, time.Now().UTC())
+	p.heartbeatMu.Lock()
+	defer p.heartbeatMu.Unlock()
+	now := time.Now()
+	heartbeat := &Heartbeat{
+		ExperimentID:  experimentID,
+		LastHeartbeat: now.UTC(),
+	}
+	clock, ok := p.heartbeatClocks[experimentID]
+	if ok {
+		heartbeat.ClockOffset = clock.offset.Seconds()
+		heartbeat.Elapsed = now.Sub(clock.started).Seconds()
+	}
+	if err := saveHeartbeat(p.repository, heartbeat); err != nil {
+		return err
+	}
+	if !ok {
+		if p.heartbeatClocks == nil {
+			p.heartbeatClocks = map[string]*heartbeatClock{}
+		}
+		p.heartbeatClocks[experimentID] = &heartbeatClock{
+			started: now,
+			offset:  measureClockOffset(p.repository, experimentID, now),
+		}
+	}
+	return nil
+}
+
+// Config returns the per-project settings (i.e. keepsake.yaml)
+func (p *Project) Config() *config.Config {
+	return p.config
+}
+
+// MetricGoal returns whether higher or lower values of the metric called name
+// in chk are better, from metrics in keepsake.yaml or chk's primary metric,
+// and false if that isn't known
+func (p *Project) MetricGoal(chk *Checkpoint, name string) (MetricGoal, bool) {
+	if metric := p.config.MetricConfig(name); metric != nil && metric.Goal != "" {
+		return MetricGoal(metric.Goal), true
+	}
+	if chk != nil && chk.PrimaryMetric != nil && chk.PrimaryMetric.Name == name {
+		return chk.PrimaryMetric.Goal, true
+	}
+	return "", false
+}
+
+// SystemMetricsInterval returns how often system metrics should be sampled
+// for running experiments, or 0 if they shouldn't be sampled
+func (p *Project) SystemMetricsInterval() time.Duration {
+	return p.config.SystemMetricsSampleInterval()
+}
+
+// ExperimentHeartbeat returns an experiment's last heartbeat, or nil if it
+// was stopped cleanly
+func (p *Project) ExperimentHeartbeat(experimentID string) (*Heartbeat, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return p.heartbeatsByExpID[experimentID], nil
+}
+
+// ExperimentPreemption returns the preemption of an experiment's machine,
+// or nil if it wasn't preempted
+func (p *Project) ExperimentPreemption(experimentID string) (*Preemption, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return p.preemptionsByExpID[experimentID], nil
 }
 
+// MarkExperimentPreempted records that an experiment's machine is being reclaimed by provider
+func (p *Project) MarkExperimentPreempted(experimentID string, provider string) error {
+	if err := CreatePreemption(p.repository, experimentID, provider, time.Now().UTC()); err != nil {
+		return err
+	}
+	p.invalidateCache()
+	return nil
+}
+
+// ExperimentEarlyStop returns why an experiment was stopped early, or nil if
+// it wasn't
+func (p *Project) ExperimentEarlyStop(experimentID string) (*EarlyStop, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return p.earlyStopsByExpID[experimentID], nil
+}
+
+// ExperimentTags returns the tags an experiment was given by its template, or
+// nil if it wasn't created with one
+func (p *Project) ExperimentTags(experimentID string) (*ExperimentTags, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return p.tagsByExpID[experimentID], nil
+}
+
+// MarkExperimentStoppedEarly records that an experiment is being stopped because
+// its metric stopped improving
+func (p *Project) MarkExperimentStoppedEarly(experimentID string, reason string) error {
+	if err := CreateEarlyStop(p.repository, experimentID, reason, time.Now().UTC()); err != nil {
+		return err
+	}
+	p.invalidateCache()
+	return nil
+}
+
+// CheckpointUpload returns the upload of a checkpoint's files if it hasn't
+// finished, or nil if they are all uploaded. If the experiment isn't running,
+// an unfinished upload was interrupted.
+func (p *Project) CheckpointUpload(checkpointID string) (*Upload, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return p.uploadsByChkID[checkpointID], nil
+}
+
+// IncompleteCheckpoints returns the checkpoints of exp whose uploads were
+// interrupted. If exp is running, their uploads might still be in progress, so
+// none are returned.
+func (p *Project) IncompleteCheckpoints(exp *Experiment) ([]*Checkpoint, error) {
+	running, err := p.ExperimentIsRunning(exp.ID)
+	if err != nil {
+		return nil, err
+	}
+	incomplete := []*Checkpoint{}
+	if running {
+		return incomplete, nil
+	}
+	for _, chk := range exp.Checkpoints {
+		if _, ok := p.uploadsByChkID[chk.ID]; ok {
+			incomplete = append(incomplete, chk)
+		}
+	}
+	return incomplete, nil
+}
+
+// StopExperiment records that an experiment has finished, because the
+// process running it stopped it, and deletes its heartbeat
 func (p *Project) StopExperiment(experimentID string) error {
+	if err := p.FinishExperiment(experimentID, false); err != nil {
+		return err
+	}
 	if err := DeleteHeartbeat(p.repository, experimentID); err != nil {
 		return err
 	}
 	p.invalidateCache()
+	if p.hooksConfigured(hooks.RunFinished) {
+		exp, err := p.ExperimentByID(experimentID)
+		if err != nil {
+			console.Warn("Failed to load experiment %s for %s hooks: %s", experimentID, hooks.RunFinished, err)
+			return nil
+		}
+		p.runHooks(hooks.RunFinished, exp, nil)
+	}
 	return nil
 }
 
@@ -376,14 +867,76 @@ func (p *Project) ensureLoaded() error {
 		heartbeats = []*Heartbeat{}
 		console.Warn("Failed to load heartbeats: %s", err)
 	}
+	preemptions, err := listPreemptions(p.repository)
+	if err != nil {
+		preemptions = []*Preemption{}
+		console.Warn("Failed to load preemptions: %s", err)
+	}
+	earlyStops, err := listEarlyStops(p.repository)
+	if err != nil {
+		earlyStops = []*EarlyStop{}
+		console.Warn("Failed to load early stops: %s", err)
+	}
+	stateRecords, err := listStateRecords(p.repository)
+	if err != nil {
+		stateRecords = []*StateRecord{}
+		console.Warn("Failed to load experiment states: %s", err)
+	}
+	stopRequests, err := listStopRequests(p.repository)
+	if err != nil {
+		stopRequests = []*StopRequest{}
+		console.Warn("Failed to load stop requests: %s", err)
+	}
+	allTags, err := listExperimentTags(p.repository)
+	if err != nil {
+		allTags = []*ExperimentTags{}
+		console.Warn("Failed to load experiment tags: %s", err)
+	}
+	uploads, err := listUploads(p.repository)
+	if err != nil {
+		uploads = []*Upload{}
+		console.Warn("Failed to load checkpoint uploads: %s", err)
+	}
 	p.setObjects(experiments, heartbeats)
+	p.preemptionsByExpID = map[string]*Preemption{}
+	for _, preemption := range preemptions {
+		p.preemptionsByExpID[preemption.ExperimentID] = preemption
+	}
+	p.earlyStopsByExpID = map[string]*EarlyStop{}
+	for _, earlyStop := range earlyStops {
+		p.earlyStopsByExpID[earlyStop.ExperimentID] = earlyStop
+	}
+	p.stateRecordsByExpID = map[string]*StateRecord{}
+	for _, record := range stateRecords {
+		p.stateRecordsByExpID[record.ExperimentID] = record
+	}
+	p.stopRequestsByExpID = map[string]*StopRequest{}
+	for _, request := range stopRequests {
+		p.stopRequestsByExpID[request.ExperimentID] = request
+	}
+	p.tagsByExpID = map[string]*ExperimentTags{}
+	for _, experimentTags := range allTags {
+		p.tagsByExpID[experimentTags.ExperimentID] = experimentTags
+	}
+	p.uploadsByChkID = map[string]*Upload{}
+	for _, upload := range uploads {
+		p.uploadsByChkID[upload.CheckpointID] = upload
+	}
 	p.hasLoaded = true
 	return nil
 }
 
 func (p *Project) setObjects(experiments []*Experiment, heartbeats []*Heartbeat) {
+	derivedMetrics, err := p.config.DerivedMetricsInOrder()
+	if err != nil {
+		console.Warn("Failed to compute derived metrics: %s", err)
+		derivedMetrics = nil
+	}
 	p.experimentsByID = map[string]*Experiment{}
 	for _, exp := range experiments {
+		// experiments saved before a param was marked as sensitive
+		exp.Params = RedactParams(exp.Params, p.config.SensitiveParams)
+		addDerivedMetrics(exp, derivedMetrics)
 		p.experimentsByID[exp.ID] = exp
 	}
 	p.heartbeatsByExpID = map[string]*Heartbeat{}
@@ -0,0 +1,826 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/config"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/param"
+	"github.com/replicate/keepsake/go/pkg/repository"
+	"github.com/replicate/keepsake/go/pkg/sysmetrics"
+)
+
+func createDuplicateStepExperiment() *Experiment {
+	fixedTime, _ := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+	return &Experiment{
+		ID:      "1eeeeeeeee",
+		Created: fixedTime.Add(-10 * time.Minute),
+		Config:  &config.Config{},
+		Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Created: fixedTime.Add(-5 * time.Minute), Step: 1},
+			{ID: "2ccccccccc", Created: fixedTime.Add(-4 * time.Minute), Step: 2},
+			{ID: "3ccccccccc", Created: fixedTime.Add(-3 * time.Minute), Step: 2},
+		},
+	}
+}
+
+func TestCheckpointStepPolicy(t *testing.T) {
+	projectDir, err := files.TempDir("test-step-policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	// keep-all is the default
+	proj := NewProject(repo, projectDir)
+	exp, err := proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	require.Len(t, exp.Checkpoints, 3)
+
+	proj = NewProjectWithConfig(repo, projectDir, &config.Config{CheckpointStepPolicy: config.StepPolicyKeepLatest})
+	exp, err = proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	require.Len(t, exp.Checkpoints, 2)
+	require.Equal(t, "1ccccccccc", exp.Checkpoints[0].ID)
+	require.Equal(t, "3ccccccccc", exp.Checkpoints[1].ID)
+	saved, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, saved.Checkpoints, 2)
+
+	// explicit steps can repeat, e.g. when Python's checkpoint() is passed
+	// the same step twice. The error policy refuses the second checkpoint
+	// before any of its files are saved.
+	proj = NewProjectWithConfig(repo, projectDir, &config.Config{CheckpointStepPolicy: config.StepPolicyError})
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "weights.pth"), []byte("weights"), 0644))
+	repeated := &Experiment{ID: "2eeeeeeeee", Created: time.Now().UTC(), Config: &config.Config{}}
+	_, err = proj.SaveExperiment(repeated, true)
+	require.NoError(t, err)
+	for _, step := range []int64{1, 2} {
+		chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth", Step: step, ExperimentID: repeated.ID}, false, nil, true)
+		require.NoError(t, err)
+		repeated.Checkpoints = append(repeated.Checkpoints, chk)
+		_, err = proj.SaveExperiment(repeated, true)
+		require.NoError(t, err)
+	}
+	checkpointsBefore, err := repo.List("checkpoints")
+	require.NoError(t, err)
+	_, err = proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth", Step: 2, ExperimentID: repeated.ID}, false, nil, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Experiment 2eeeeee already has a checkpoint with step 2")
+	checkpointsAfter, err := repo.List("checkpoints")
+	require.NoError(t, err)
+	require.Equal(t, checkpointsBefore, checkpointsAfter)
+	// the experiment can still be saved
+	_, err = proj.SaveExperiment(repeated, true)
+	require.NoError(t, err)
+	_, err = proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth", Step: 3, ExperimentID: repeated.ID}, false, nil, true)
+	require.NoError(t, err)
+
+	// checkpoints saved without a step are all kept, even though their steps are all 0
+	withoutSteps := createDuplicateStepExperiment()
+	withoutSteps.Checkpoints = append(withoutSteps.Checkpoints,
+		&Checkpoint{ID: "4ccccccccc", Created: withoutSteps.Created.Add(8 * time.Minute), NoStep: true},
+		&Checkpoint{ID: "5ccccccccc", Created: withoutSteps.Created.Add(9 * time.Minute), NoStep: true},
+	)
+	withoutSteps.Checkpoints[2].Step = 3
+	_, err = proj.SaveExperiment(withoutSteps, true)
+	require.NoError(t, err)
+	proj = NewProjectWithConfig(repo, projectDir, &config.Config{CheckpointStepPolicy: config.StepPolicyKeepLatest})
+	exp, err = proj.SaveExperiment(withoutSteps, true)
+	require.NoError(t, err)
+	require.Len(t, exp.Checkpoints, 5)
+}
+
+func TestSensitiveParams(t *testing.T) {
+	projectDir, err := files.TempDir("test-sensitive-params")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProjectWithConfig(repo, projectDir, &config.Config{SensitiveParams: []string{"password", "*_key"}})
+	exp := createDuplicateStepExperiment()
+	exp.Params = param.ValueMap{
+		"api_key":  param.String("hunter2"),
+		"password": param.String("hunter2"),
+		"lr":       param.Float(0.01),
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	data, err := repo.Get(path.Join("metadata", "experiments", exp.ID+".json"))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "hunter2")
+
+	saved, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, param.Float(0.01), saved.Params["lr"])
+	// the same value has the same hash, so it can be compared
+	require.Equal(t, saved.Params["api_key"], saved.Params["password"])
+	require.Contains(t, saved.Params["api_key"].StringVal(), redactedPrefix)
+
+	// redacted values aren't redacted again
+	_, err = proj.SaveExperiment(saved, true)
+	require.NoError(t, err)
+	resaved, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, saved.Params["api_key"], resaved.Params["api_key"])
+}
+
+func TestDerivedMetrics(t *testing.T) {
+	projectDir, err := files.TempDir("test-derived-metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProjectWithConfig(repo, projectDir, &config.Config{DerivedMetrics: map[string]string{
+		"f1":          "2 * precision * recall / (precision + recall)",
+		"smooth_loss": "mean(loss, 2)",
+		"acc":         "accuracy",
+	}})
+	exp := createDuplicateStepExperiment()
+	exp.Checkpoints[0].Metrics = param.ValueMap{"precision": param.Float(0.5), "recall": param.Float(1), "loss": param.Float(4)}
+	exp.Checkpoints[1].Metrics = param.ValueMap{"loss": param.Float(2), "accuracy": param.Float(0.9)}
+	// saved metrics take precedence
+	exp.Checkpoints[2].Metrics = param.ValueMap{"loss": param.Float(1), "f1": param.Float(0.1)}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	saved, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	f1, ok := saved.Checkpoints[0].MetricValue("f1")
+	require.True(t, ok)
+	require.InDelta(t, 2.0/3, f1, 1e-9)
+	require.True(t, saved.Checkpoints[0].IsDerivedMetric("f1"))
+	require.Equal(t, param.Float(4), saved.Checkpoints[0].Metrics["smooth_loss"])
+	require.Equal(t, param.Float(3), saved.Checkpoints[1].Metrics["smooth_loss"])
+	require.Equal(t, param.Float(1.5), saved.Checkpoints[2].Metrics["smooth_loss"])
+	require.Equal(t, param.Float(0.9), saved.Checkpoints[1].Metrics["acc"])
+	_, ok = saved.Checkpoints[1].Metrics["f1"]
+	require.False(t, ok)
+	require.Equal(t, param.Float(0.1), saved.Checkpoints[2].Metrics["f1"])
+	require.False(t, saved.Checkpoints[2].IsDerivedMetric("f1"))
+
+	// derived metrics aren't saved
+	_, err = proj.SaveExperiment(saved, true)
+	require.NoError(t, err)
+	data, err := repo.Get(path.Join("metadata", "experiments", exp.ID+".json"))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "smooth_loss")
+	require.Contains(t, string(data), `"f1": 0.1`)
+}
+
+func TestListProjects(t *testing.T) {
+	dir, err := files.TempDir("test-list-projects")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	root, err := repository.NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	projects, err := ListProjects(root)
+	require.NoError(t, err)
+	require.Empty(t, projects)
+
+	for _, name := range []string{"vision", "nlp"} {
+		repo, err := repository.NewDiskRepository(path.Join(dir, config.ProjectsDir, name))
+		require.NoError(t, err)
+		require.NoError(t, repository.WriteSpec(repo))
+		_, err = NewProject(repo, dir).SaveExperiment(createDuplicateStepExperiment(), true)
+		require.NoError(t, err)
+	}
+	vision, err := repository.NewDiskRepository(path.Join(dir, config.ProjectsDir, "vision"))
+	require.NoError(t, err)
+	exp := createDuplicateStepExperiment()
+	exp.ID = "2eeeeeeeee"
+	_, err = NewProject(vision, dir).SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	projects, err = ListProjects(root)
+	require.NoError(t, err)
+	require.Equal(t, []*ProjectSummary{
+		{Name: "nlp", NumExperiments: 1},
+		{Name: "vision", NumExperiments: 2},
+	}, projects)
+}
+
+func TestStats(t *testing.T) {
+	dir, err := files.TempDir("test-stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := repository.NewDiskRepository(dir)
+	require.NoError(t, err)
+	proj := NewProject(repo, dir)
+
+	// Monday 5 and Wednesday 7 October are in the same week
+	week1, _ := time.Parse(time.RFC3339, "2020-10-07T12:00:00Z")
+	week2 := week1.Add(7 * 24 * time.Hour)
+	primaryMetric := &PrimaryMetric{Name: "loss", Goal: GoalMinimize}
+	for _, exp := range []*Experiment{
+		{ID: "1eeeeeeeee", Created: week1, User: "alice", Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Metrics: param.ValueMap{"loss": param.Float(0.5)}, PrimaryMetric: primaryMetric},
+			{ID: "2ccccccccc", Metrics: param.ValueMap{"loss": param.Float(0.4)}, PrimaryMetric: primaryMetric},
+		}},
+		{ID: "2eeeeeeeee", Created: week1, User: "bob", Checkpoints: []*Checkpoint{
+			{ID: "3ccccccccc", Metrics: param.ValueMap{"loss": param.Float(0.3)}, PrimaryMetric: primaryMetric},
+		}},
+		{ID: "3eeeeeeeee", Created: week2, User: "alice", Checkpoints: []*Checkpoint{
+			{ID: "4ccccccccc", Metrics: param.ValueMap{"loss": param.Float(0.35)}, PrimaryMetric: primaryMetric},
+		}},
+		{ID: "4eeeeeeeee", Created: week2, User: "alice"},
+	} {
+		exp.Config = &config.Config{}
+		_, err := proj.SaveExperiment(exp, true)
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.Put("experiments/1eeeeeeeee.tar.gz", make([]byte, 100)))
+	require.NoError(t, repo.Put("checkpoints/3ccccccccc.tar.gz", make([]byte, 300)))
+
+	stats, err := proj.Stats()
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.NumExperiments)
+	require.Equal(t, 4, stats.NumCheckpoints)
+	require.Equal(t, int64(400), stats.TotalBytes)
+	require.Equal(t, int64(100), stats.AverageExperimentBytes)
+
+	monday1, _ := time.Parse(time.RFC3339, "2020-10-05T00:00:00Z")
+	monday2 := monday1.Add(7 * 24 * time.Hour)
+	require.Equal(t, []*WeeklyRuns{
+		{Week: monday1, User: "alice", Runs: 1},
+		{Week: monday1, User: "bob", Runs: 1},
+		{Week: monday2, User: "alice", Runs: 2},
+	}, stats.RunsByWeek)
+	require.Equal(t, []*MetricTrend{{
+		Metric: "loss",
+		Goal:   GoalMinimize,
+		Weeks: []*WeeklyMetric{
+			{Week: monday1, Best: 0.3, ExperimentID: "2eeeeeeeee", BestSoFar: 0.3},
+			{Week: monday2, Best: 0.35, ExperimentID: "3eeeeeeeee", BestSoFar: 0.3},
+		},
+	}}, stats.MetricTrends)
+}
+
+func TestLineage(t *testing.T) {
+	dir, err := files.TempDir("test-lineage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := repository.NewDiskRepository(dir)
+	require.NoError(t, err)
+	proj := NewProject(repo, dir)
+
+	created, _ := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+	for i, exp := range []*Experiment{
+		{ID: "1eeeeeeeee", Checkpoints: []*Checkpoint{{ID: "1ccccccccc"}, {ID: "1ccccccddd"}}},
+		// resumes from its own checkpoint, so it's ignored
+		{ID: "2eeeeeeeee", Params: param.ValueMap{"resume": param.String("2ccccccccc"), "lr": param.Float(0.1)}, Checkpoints: []*Checkpoint{{ID: "2ccccccccc"}}},
+		{ID: "3eeeeeeeee", Params: param.ValueMap{"base_checkpoint": param.String("1ccccccc")}},
+		// too short, and ambiguous
+		{ID: "4eeeeeeeee", Params: param.ValueMap{"a": param.String("2cc"), "b": param.String("1cccccc")}},
+		{ID: "5eeeeeeeee", Params: param.ValueMap{"init": param.String("2ccccccccc")}},
+	} {
+		exp.Created = created.Add(time.Duration(i) * time.Minute)
+		exp.Config = &config.Config{}
+		_, err := proj.SaveExperiment(exp, true)
+		require.NoError(t, err)
+	}
+
+	links, err := proj.Lineage()
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	require.Equal(t, "1eeeeeeeee", links[0].ParentExperiment.ID)
+	require.Equal(t, "1ccccccccc", links[0].Checkpoint.ID)
+	require.Equal(t, "3eeeeeeeee", links[0].Experiment.ID)
+	require.Equal(t, "base_checkpoint", links[0].Param)
+	require.Equal(t, "2eeeeeeeee", links[1].ParentExperiment.ID)
+	require.Equal(t, "5eeeeeeeee", links[1].Experiment.ID)
+}
+
+func TestMarkExperimentPreempted(t *testing.T) {
+	projectDir, err := files.TempDir("test-preempted")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProject(repo, projectDir)
+	exp, err := proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	preemption, err := proj.ExperimentPreemption(exp.ID)
+	require.NoError(t, err)
+	require.Nil(t, preemption)
+
+	require.NoError(t, proj.MarkExperimentPreempted(exp.ID, "gcp"))
+	preemption, err = proj.ExperimentPreemption(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, "gcp", preemption.Provider)
+
+	require.NoError(t, proj.DeleteExperiment(exp))
+	_, err = repo.Get(exp.PreemptionPath())
+	require.Error(t, err)
+}
+
+func TestMarkExperimentStoppedEarly(t *testing.T) {
+	projectDir, err := files.TempDir("test-stopped-early")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProject(repo, projectDir)
+	exp, err := proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	earlyStop, err := proj.ExperimentEarlyStop(exp.ID)
+	require.NoError(t, err)
+	require.Nil(t, earlyStop)
+
+	require.NoError(t, proj.MarkExperimentStoppedEarly(exp.ID, "loss hasn't improved"))
+	earlyStop, err = proj.ExperimentEarlyStop(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, "loss hasn't improved", earlyStop.Reason)
+
+	require.NoError(t, proj.DeleteExperiment(exp))
+	_, err = repo.Get(exp.EarlyStopPath())
+	require.Error(t, err)
+}
+
+func TestExperimentState(t *testing.T) {
+	projectDir, err := files.TempDir("test-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	requireState := func(experimentID string, expected ExperimentState) {
+		proj.invalidateCache()
+		state, err := proj.ExperimentState(experimentID)
+		require.NoError(t, err)
+		require.Equal(t, expected, state)
+	}
+
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	requireState(exp.ID, StateCreated)
+	require.NoError(t, proj.RefreshHeartbeat(exp.ID))
+	requireState(exp.ID, StateRunning)
+
+	requested, err := proj.IsStopRequested(exp.ID)
+	require.NoError(t, err)
+	require.False(t, requested)
+	require.NoError(t, proj.RequestStop(exp.ID, "alice"))
+	requested, err = proj.IsStopRequested(exp.ID)
+	require.NoError(t, err)
+	require.True(t, requested)
+	requireState(exp.ID, StateStopping)
+	stopRequest, err := proj.ExperimentStopRequest(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, "alice", stopRequest.User)
+
+	// the process exits because it was asked to, so it was stopped
+	require.NoError(t, proj.FinishExperiment(exp.ID, false))
+	requireState(exp.ID, StateStopped)
+	requested, err = proj.IsStopRequested(exp.ID)
+	require.NoError(t, err)
+	require.False(t, requested)
+
+	completed, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, proj.RefreshHeartbeat(completed.ID))
+	require.NoError(t, proj.StopExperiment(completed.ID))
+	requireState(completed.ID, StateCompleted)
+
+	interrupted, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, proj.FinishExperiment(interrupted.ID, true))
+	requireState(interrupted.ID, StateStopped)
+
+	// heartbeats stopped without the process recording that it finished
+	crashed, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, CreateHeartbeat(repo, crashed.ID, time.Now().UTC().Add(-time.Hour)))
+	requireState(crashed.ID, StateCrashed)
+
+	// experiments saved before states were recorded can't have crashed
+	legacy, err := proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	require.NoError(t, CreateHeartbeat(repo, legacy.ID, time.Now().UTC().Add(-time.Hour)))
+	requireState(legacy.ID, StateStopped)
+
+	require.NoError(t, proj.DeleteExperiment(exp))
+	_, err = repo.Get(stateRecordPath(exp.ID))
+	require.Error(t, err)
+}
+
+func TestTemplate(t *testing.T) {
+	projectDir, err := files.TempDir("test-template")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProjectWithConfig(repo, projectDir, &config.Config{
+		Template: "resnet",
+		Templates: map[string]*config.TemplateConfig{
+			"resnet": {
+				Params:        param.ValueMap{"layers": param.Int(50), "learning_rate": param.Float(0.01)},
+				Tags:          []string{"vision"},
+				PrimaryMetric: &config.TemplatePrimaryMetric{Name: "val_accuracy", Goal: "maximize"},
+			},
+		},
+	})
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{
+		Params: param.ValueMap{"learning_rate": param.Float(0.1)},
+	}, false, nil, true)
+	require.NoError(t, err)
+	// params passed to the experiment override the template's
+	require.Equal(t, param.ValueMap{"layers": param.Int(50), "learning_rate": param.Float(0.1)}, exp.Params)
+
+	tags, err := proj.ExperimentTags(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, &ExperimentTags{ExperimentID: exp.ID, Template: "resnet", Tags: []string{"vision"}}, tags)
+
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, &PrimaryMetric{Name: "val_accuracy", Goal: GoalMaximize}, chk.PrimaryMetric)
+	chk, err = proj.CreateCheckpoint(CreateCheckpointArgs{PrimaryMetric: &PrimaryMetric{Name: "loss", Goal: GoalMinimize}}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, "loss", chk.PrimaryMetric.Name)
+
+	require.NoError(t, proj.DeleteExperiment(exp))
+	_, err = repo.Get(exp.TagsPath())
+	require.Error(t, err)
+
+	// experiments aren't created with templates that don't exist
+	proj = NewProjectWithConfig(repo, projectDir, &config.Config{Template: "vgg"})
+	_, err = proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.Error(t, err)
+}
+
+func TestParamsFile(t *testing.T) {
+	projectDir, err := files.TempDir("test-params-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProjectWithConfig(repo, projectDir, &config.Config{
+		Template: "resnet",
+		Templates: map[string]*config.TemplateConfig{
+			"resnet": {Params: param.ValueMap{"layers": param.Int(50), "optimizer": param.String("sgd")}},
+		},
+	})
+
+	// no params file
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, param.ValueMap{"layers": param.Int(50), "optimizer": param.String("sgd")}, exp.Params)
+
+	// params.yaml is only read if it is passed, e.g. by keepsake save, and
+	// params passed to the experiment override it, which overrides the template
+	err = ioutil.WriteFile(path.Join(projectDir, "params.yaml"), []byte("layers: 101\nlearning_rate: 1.0\nbatch_size: 64\ndecay: [0.1, 2]\n"), 0644)
+	require.NoError(t, err)
+	exp, err = proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, param.ValueMap{"layers": param.Int(50), "optimizer": param.String("sgd")}, exp.Params)
+	paramsFile, err := proj.DefaultParamsFile()
+	require.NoError(t, err)
+	require.Equal(t, "params.yaml", paramsFile)
+	exp, err = proj.CreateExperiment(CreateExperimentArgs{
+		Params:     param.ValueMap{"batch_size": param.Int(128)},
+		ParamsFile: paramsFile,
+	}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, param.ValueMap{
+		"layers":        param.Int(101),
+		"learning_rate": param.Float(1),
+		"batch_size":    param.Int(128),
+		"decay":         param.Object([]interface{}{0.1, 2.0}),
+		"optimizer":     param.String("sgd"),
+	}, exp.Params)
+
+	// a params file that is passed is read instead
+	err = ioutil.WriteFile(path.Join(projectDir, "other.json"), []byte(`{"dropout": 0.5}`), 0644)
+	require.NoError(t, err)
+	exp, err = proj.CreateExperiment(CreateExperimentArgs{ParamsFile: "other.json"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, param.ValueMap{"layers": param.Int(50), "optimizer": param.String("sgd"), "dropout": param.Float(0.5)}, exp.Params)
+
+	_, err = proj.CreateExperiment(CreateExperimentArgs{ParamsFile: "missing.yaml"}, false, nil, true)
+	require.Error(t, err)
+
+	err = ioutil.WriteFile(path.Join(projectDir, "list.yaml"), []byte("- 1\n- 2\n"), 0644)
+	require.NoError(t, err)
+	_, err = proj.CreateExperiment(CreateExperimentArgs{ParamsFile: "list.yaml"}, false, nil, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must contain an object")
+}
+
+func TestGroups(t *testing.T) {
+	projectDir, err := files.TempDir("test-groups")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProject(repo, projectDir)
+	groups, err := proj.Groups()
+	require.NoError(t, err)
+	require.Empty(t, groups)
+
+	group, err := proj.CreateGroup("paper", []string{"1eeeeeeeee", "2eeeeeeeee"})
+	require.NoError(t, err)
+	_, err = proj.CreateGroup("paper", nil)
+	require.Error(t, err)
+	_, err = proj.CreateGroup("../paper", nil)
+	require.Error(t, err)
+
+	require.NoError(t, proj.AddToGroup(group, []string{"2eeeeeeeee", "3eeeeeeeee"}))
+	require.NoError(t, proj.RemoveFromGroup(group, []string{"1eeeeeeeee"}))
+	loaded, err := proj.Group("paper")
+	require.NoError(t, err)
+	require.Equal(t, []string{"2eeeeeeeee", "3eeeeeeeee"}, loaded.ExperimentIDs)
+	require.True(t, loaded.Contains("3eeeeeeeee"))
+	require.False(t, loaded.Contains("1eeeeeeeee"))
+
+	_, err = proj.CreateGroup("sprint", nil)
+	require.NoError(t, err)
+	groups, err = proj.Groups()
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, "paper", groups[0].Name)
+	require.Equal(t, "sprint", groups[1].Name)
+
+	require.NoError(t, proj.DeleteGroup(loaded))
+	_, err = proj.Group("paper")
+	require.True(t, errors.IsDoesNotExist(err))
+}
+
+func TestEarlyStoppingReason(t *testing.T) {
+	exp := &Experiment{}
+	for i, loss := range []float64{0.5, 0.3, 0.31, 0.2999, 0.35} {
+		exp.Checkpoints = append(exp.Checkpoints, &Checkpoint{
+			ID:            fmt.Sprintf("%dccccccccc", i),
+			Metrics:       param.ValueMap{"loss": param.Float(loss), "name": param.String("x")},
+			PrimaryMetric: &PrimaryMetric{Name: "loss", Goal: GoalMinimize},
+		})
+	}
+
+	// 0.2999 doesn't improve on 0.3 by more than min_delta
+	reason := EarlyStoppingReason(exp, &config.EarlyStoppingConfig{Patience: 3, MinDelta: 0.001})
+	require.Equal(t, "loss hasn't improved on 0.3 (checkpoint 1cccccc) for 3 checkpoints", reason)
+	require.Equal(t, "", EarlyStoppingReason(exp, &config.EarlyStoppingConfig{Patience: 3}))
+	require.Equal(t, "", EarlyStoppingReason(exp, &config.EarlyStoppingConfig{Patience: 4, MinDelta: 0.001}))
+
+	// an explicit metric and goal override the primary metric
+	reason = EarlyStoppingReason(exp, &config.EarlyStoppingConfig{Metric: "loss", Goal: "maximize", Patience: 4})
+	require.Equal(t, "loss hasn't improved on 0.5 (checkpoint 0cccccc) for 4 checkpoints", reason)
+
+	// non-numeric and missing metrics are ignored
+	require.Equal(t, "", EarlyStoppingReason(exp, &config.EarlyStoppingConfig{Metric: "name", Goal: "minimize", Patience: 1}))
+	require.Equal(t, "", EarlyStoppingReason(exp, &config.EarlyStoppingConfig{Metric: "accuracy", Goal: "maximize", Patience: 1}))
+}
+
+func TestHooks(t *testing.T) {
+	projectDir, err := files.TempDir("test-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProjectWithConfig(repo, projectDir, &config.Config{Hooks: map[string][]string{
+		"experiment-created": {"cat > experiment-created.json"},
+		"checkpoint-saved":   {"cat > checkpoint-saved.json"},
+		"run-finished":       {"cat > run-finished.json"},
+	}})
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: 3}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, proj.StopExperiment(exp.ID))
+
+	payload := new(hookPayload)
+	require.NoError(t, loadJSONFile(path.Join(projectDir, "experiment-created.json"), payload))
+	require.Equal(t, "experiment-created", payload.Event)
+	require.Equal(t, exp.ID, payload.Experiment.ID)
+	require.Nil(t, payload.Checkpoint)
+
+	payload = new(hookPayload)
+	require.NoError(t, loadJSONFile(path.Join(projectDir, "checkpoint-saved.json"), payload))
+	require.Equal(t, chk.ID, payload.Checkpoint.ID)
+	require.Equal(t, int64(3), payload.Checkpoint.Step)
+
+	payload = new(hookPayload)
+	require.NoError(t, loadJSONFile(path.Join(projectDir, "run-finished.json"), payload))
+	require.Equal(t, exp.ID, payload.Experiment.ID)
+	require.Equal(t, repo.RootURL(), payload.Repository)
+
+	// hooks for requests from the training process are queued with its uploads
+	require.NoError(t, os.Remove(path.Join(projectDir, "checkpoint-saved.json")))
+	workChan := make(chan func() error, 1)
+	_, err = proj.CreateCheckpoint(CreateCheckpointArgs{Step: 4}, true, workChan, true)
+	require.NoError(t, err)
+	require.NoFileExists(t, path.Join(projectDir, "checkpoint-saved.json"))
+	require.NoError(t, (<-workChan)())
+	require.FileExists(t, path.Join(projectDir, "checkpoint-saved.json"))
+
+	// nothing is run with --dry-run
+	global.DryRun = true
+	defer func() { global.DryRun = false }()
+	require.NoError(t, os.Remove(path.Join(projectDir, "checkpoint-saved.json")))
+	_, err = proj.CreateCheckpoint(CreateCheckpointArgs{Step: 4}, false, nil, true)
+	require.NoError(t, err)
+	require.NoFileExists(t, path.Join(projectDir, "checkpoint-saved.json"))
+}
+
+func loadJSONFile(filename string, obj interface{}) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// interruptedRepository fails to upload tarballs, like a process that is
+// killed partway through saving a checkpoint
+type interruptedRepository struct {
+	repository.Repository
+}
+
+func (r *interruptedRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	return fmt.Errorf("interrupted")
+}
+
+func TestIncompleteCheckpoints(t *testing.T) {
+	projectDir, err := files.TempDir("test-incomplete")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pth"), []byte("weights"), 0644))
+
+	proj := NewProject(repo, projectDir)
+	complete, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 1}, false, nil, true)
+	require.NoError(t, err)
+	interruptedProj := NewProject(&interruptedRepository{repo}, projectDir)
+	_, err = interruptedProj.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 2}, false, nil, true)
+	require.EqualError(t, err, "interrupted")
+
+	// the interrupted checkpoint never made it into the experiment, so save it like a crashed run would have
+	paths, err := repo.List("metadata/uploads/checkpoints/")
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+	upload := new(Upload)
+	require.NoError(t, loadFromPath(repo, paths[0], upload))
+	require.Equal(t, []string{"model/weights.pth"}, upload.Files)
+	require.Empty(t, upload.Uploaded)
+	incomplete := &Checkpoint{ID: upload.CheckpointID, Path: "model", Step: 2}
+
+	exp := &Experiment{ID: generateRandomID(), Checkpoints: []*Checkpoint{complete, incomplete}}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	u, err := proj.CheckpointUpload(complete.ID)
+	require.NoError(t, err)
+	require.Nil(t, u)
+	u, err = proj.CheckpointUpload(incomplete.ID)
+	require.NoError(t, err)
+	require.NotNil(t, u)
+
+	// it might still be uploading while the experiment is running
+	require.NoError(t, proj.RefreshHeartbeat(exp.ID))
+	proj.invalidateCache()
+	checkpoints, err := proj.IncompleteCheckpoints(exp)
+	require.NoError(t, err)
+	require.Empty(t, checkpoints)
+
+	require.NoError(t, proj.StopExperiment(exp.ID))
+	checkpoints, err = proj.IncompleteCheckpoints(exp)
+	require.NoError(t, err)
+	require.Equal(t, []*Checkpoint{incomplete}, checkpoints)
+
+	require.NoError(t, proj.DeleteCheckpoint(incomplete))
+	_, err = repo.Get(incomplete.UploadPath())
+	require.Error(t, err)
+}
+
+func TestHeartbeatClockSkew(t *testing.T) {
+	projectDir, err := files.TempDir("test-heartbeat")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	// the second heartbeat records how long the experiment has been running
+	require.NoError(t, proj.RefreshHeartbeat("1eeeeeeeee"))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, proj.RefreshHeartbeat("1eeeeeeeee"))
+	heartbeat, err := proj.ExperimentHeartbeat("1eeeeeeeee")
+	require.NoError(t, err)
+	require.Greater(t, heartbeat.Elapsed, 0.0)
+	require.Equal(t, 0.0, heartbeat.ClockOffset)
+	require.True(t, heartbeat.IsRunning())
+
+	// the storage says the heartbeat was saved two minutes after this
+	// machine's clock does, so this machine's clock is behind
+	written := time.Now()
+	require.NoError(t, CreateHeartbeat(repo, "2eeeeeeeee", written.UTC()))
+	heartbeatFile := path.Join(projectDir, ".keepsake", "metadata", "heartbeats", "2eeeeeeeee.json")
+	require.NoError(t, os.Chtimes(heartbeatFile, written.Add(2*time.Minute), written.Add(2*time.Minute)))
+	require.Equal(t, 2*time.Minute, measureClockOffset(repo, "2eeeeeeeee", written))
+
+	// a heartbeat that looks a minute old by a clock that is behind
+	heartbeat = &Heartbeat{LastHeartbeat: time.Now().UTC().Add(-time.Minute)}
+	require.False(t, heartbeat.IsRunning())
+	heartbeat.ClockOffset = 2 * 60
+	require.True(t, heartbeat.IsRunning())
+}
+
+func TestSnapshotSizeLimit(t *testing.T) {
+	dir, err := files.TempDir("test-snapshot-size")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "data", "raw"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data", "raw", "a.csv"), make([]byte, 1500), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data", "b.csv"), make([]byte, 1000), 0644))
+
+	defer func(confirm func(string) (bool, error)) { confirmLargeSnapshot = confirm }(confirmLargeSnapshot)
+	messages := []string{}
+	confirmed := false
+	confirmLargeSnapshot = func(message string) (bool, error) {
+		messages = append(messages, message)
+		return confirmed, nil
+	}
+
+	repo, err := repository.NewDiskRepository(filepath.Join(dir, ".keepsake"))
+	require.NoError(t, err)
+	proj := NewProjectWithConfig(repo, dir, &config.Config{SnapshotSizeLimit: "2KB"})
+
+	_, err = proj.CreateExperiment(CreateExperimentArgs{Path: "."}, false, nil, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The files in '.' that would be saved with this experiment are 2.4 KiB, which is more than snapshot_size_limit in keepsake.yaml (2.0 KiB). The largest are:\n     2.4 KiB  data/\n         8 B  train.py")
+	require.Contains(t, err.Error(), "set it to 0 for no limit")
+	experiments, err := proj.Experiments()
+	require.NoError(t, err)
+	require.Empty(t, experiments)
+
+	// files that fit aren't asked about
+	_, err = proj.CreateExperiment(CreateExperimentArgs{Path: "data/raw"}, false, nil, true)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	confirmed = true
+	_, err = proj.CreateExperiment(CreateExperimentArgs{Path: "data"}, false, nil, true)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Contains(t, messages[1], "     1.5 KiB  data/raw/\n      1000 B  data/b.csv")
+
+	proj = NewProjectWithConfig(repo, dir, &config.Config{SnapshotSizeLimit: "0"})
+	_, err = proj.CreateExperiment(CreateExperimentArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+}
+
+func TestSystemMetricsChunks(t *testing.T) {
+	projectDir, err := files.TempDir("test-system-metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+
+	proj := NewProject(repo, projectDir)
+	exp, err := proj.SaveExperiment(createDuplicateStepExperiment(), true)
+	require.NoError(t, err)
+	samples, err := proj.SystemMetrics(exp)
+	require.NoError(t, err)
+	require.Empty(t, samples)
+
+	// saved by an older version in one file
+	require.NoError(t, repo.Put(exp.SystemMetricsPath(), []byte(`[{"cpu_percent": 1}]`)))
+	require.NoError(t, proj.SaveSystemMetrics(exp, 0, []*sysmetrics.Sample{{CPUPercent: 2}, {CPUPercent: 3}}))
+	require.NoError(t, proj.SaveSystemMetrics(exp, 1, []*sysmetrics.Sample{{CPUPercent: 4}}))
+	samples, err = proj.SystemMetrics(exp)
+	require.NoError(t, err)
+	cpu := []float64{}
+	for _, s := range samples {
+		cpu = append(cpu, s.CPUPercent)
+	}
+	require.Equal(t, []float64{1, 2, 3, 4}, cpu)
+
+	require.NoError(t, proj.DeleteExperiment(exp))
+	samples, err = proj.SystemMetrics(exp)
+	require.NoError(t, err)
+	require.Empty(t, samples)
+}
@@ -0,0 +1,160 @@
+package project
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// quotaUsageMaxAge is how long the storage used in the repository is cached
+// before it is listed again. Files saved by this process are counted as they
+// are saved, so the cache only misses files saved by other people.
+const quotaUsageMaxAge = 5 * time.Minute
+
+// StorageUsage is how many bytes of files experiments and checkpoints have
+// saved to the repository
+type StorageUsage struct {
+	TotalBytes  int64
+	BytesByUser map[string]int64
+	loaded      time.Time
+}
+
+// StorageUsage lists the files in the repository to find how much storage
+// each user is using. Files in the content-addressed object store are shared
+// between users, so they only count towards the total.
+func (p *Project) StorageUsage() (*StorageUsage, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	storageBytes, err := p.storageBytesByExperimentID()
+	if err != nil {
+		return nil, err
+	}
+	usage := newStorageUsage()
+	for _, exp := range experiments {
+		usage.add(exp.User, storageBytes[exp.ID])
+	}
+
+	results := make(chan repository.ListResult)
+	go p.repository.ListRecursive(results, "objects")
+	var listErr error
+	for result := range results {
+		if result.Error != nil {
+			listErr = result.Error
+			continue
+		}
+		usage.TotalBytes += result.Size
+	}
+	if listErr != nil {
+		return nil, listErr
+	}
+	return usage, nil
+}
+
+// reserveQuota returns a QuotaExceeded error if saving the files in includePath
+// in localPath would take the repository or the current user over their quota
+// in the repository's spec. Otherwise, the files are counted as saved, so
+// uploads that are still queued count towards the quota.
+//
+// The storage already used is listed in the background, because listing a
+// large repository can take minutes. Until the first listing finishes, only
+// the files saved by this process are counted. The size of the files before
+// they are compressed is used, so this errs on the side of refusing uploads
+// that would have just fit.
+func (p *Project) reserveQuota(localPath string, includePath string) error {
+	p.quotaMu.Lock()
+	defer p.quotaMu.Unlock()
+
+	if !p.quotaLoaded {
+		spec, err := repository.LoadSpec(p.repository)
+		if err != nil {
+			return err
+		}
+		if spec != nil && spec.Quota != nil && !spec.Quota.IsEmpty() {
+			p.quota = spec.Quota
+		}
+		p.quotaReserved = newStorageUsage()
+		p.quotaLoaded = true
+	}
+	if p.quota == nil {
+		return nil
+	}
+	if !p.quotaRefreshing && (p.quotaUsage == nil || time.Since(p.quotaUsage.loaded) > quotaUsageMaxAge) {
+		p.quotaRefreshing = true
+		p.quotaReservedInRefresh = newStorageUsage()
+		go p.refreshQuotaUsage()
+	}
+
+	size, err := files.DirSize(filepath.Join(localPath, includePath))
+	if err != nil {
+		return err
+	}
+	username := ""
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+
+	total := p.quotaReserved.TotalBytes
+	byUser := p.quotaReserved.BytesByUser[username]
+	if p.quotaUsage != nil {
+		total += p.quotaUsage.TotalBytes
+		byUser += p.quotaUsage.BytesByUser[username]
+	}
+	if limit := p.quota.TotalBytes; limit > 0 && total+size > limit {
+		return quotaExceeded(p.repository.RootURL(), "", size, total, limit)
+	}
+	if limit := p.quota.UserLimit(username); limit > 0 && byUser+size > limit {
+		return quotaExceeded(p.repository.RootURL(), username, size, byUser, limit)
+	}
+	p.quotaReserved.add(username, size)
+	if p.quotaRefreshing {
+		p.quotaReservedInRefresh.add(username, size)
+	}
+	console.Debug("Reserved %d bytes of storage quota (%d bytes used in total, %d bytes by %s)", size, total+size, byUser+size, username)
+	return nil
+}
+
+// refreshQuotaUsage lists the storage used in the repository. Files reserved
+// while it lists may or may not be listed, so they are still counted on top.
+func (p *Project) refreshQuotaUsage() {
+	// a separate project, because this one isn't safe to use from two goroutines
+	usage, err := NewProjectWithConfig(p.repository, p.directory, p.config).StorageUsage()
+
+	p.quotaMu.Lock()
+	defer p.quotaMu.Unlock()
+	if err != nil {
+		console.Warn("Failed to check the storage quota: %s", err)
+	} else {
+		p.quotaUsage = usage
+		p.quotaReserved = p.quotaReservedInRefresh
+	}
+	p.quotaRefreshing = false
+	p.quotaReservedInRefresh = nil
+}
+
+func newStorageUsage() *StorageUsage {
+	return &StorageUsage{BytesByUser: map[string]int64{}, loaded: time.Now()}
+}
+
+func (u *StorageUsage) add(username string, size int64) {
+	u.TotalBytes += size
+	u.BytesByUser[username] += size
+}
+
+func quotaExceeded(rootURL string, username string, size int64, used int64, limit int64) error {
+	whose := "the repository " + rootURL
+	if username != "" {
+		whose = fmt.Sprintf("the user %s in %s", username, rootURL)
+	}
+	return errors.QuotaExceeded(fmt.Sprintf(`Quota exceeded: saving %s of files would take %s over its storage quota of %s (%s is already used).
+
+Remove experiments you don't need with 'keepsake rm', or ask the administrator of the repository to raise the quota with 'keepsake quota'.`,
+		console.FormatBytes(uint64(size)), whose, console.FormatBytes(uint64(limit)), console.FormatBytes(uint64(used))))
+}
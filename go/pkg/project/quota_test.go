@@ -0,0 +1,94 @@
+package project
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestQuota(t *testing.T) {
+	projectDir, err := files.TempDir("test-quota")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	require.NoError(t, repository.SaveSpec(repo, &repository.Spec{
+		Version: repository.Version,
+		Quota:   &repository.Quota{TotalBytes: 2500},
+	}))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "weights.pth"), make([]byte, 1000), 0644))
+
+	project := NewProject(repo, projectDir)
+	_, err = project.CreateExperiment(CreateExperimentArgs{Path: "weights.pth"}, false, nil, true)
+	require.NoError(t, err)
+	_, err = project.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth"}, false, nil, true)
+	require.NoError(t, err)
+
+	// Uploads that would go over the quota fail before anything is saved
+	_, err = project.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth"}, false, nil, true)
+	require.Error(t, err)
+	require.True(t, errors.IsQuotaExceeded(err))
+	require.Contains(t, err.Error(), "Quota exceeded")
+	_, err = project.CreateExperiment(CreateExperimentArgs{Path: "weights.pth"}, false, nil, true)
+	require.True(t, errors.IsQuotaExceeded(err))
+	experiments, err := NewProject(repo, projectDir).Experiments()
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+
+	// Checkpoints without files are fine
+	_, err = project.CreateCheckpoint(CreateCheckpointArgs{}, false, nil, true)
+	require.NoError(t, err)
+
+	// Usage is listed from the repository, so compressed files count for less
+	usage, err := NewProject(repo, projectDir).StorageUsage()
+	require.NoError(t, err)
+	require.True(t, usage.TotalBytes > 0 && usage.TotalBytes < 2000)
+}
+
+func TestQuotaUsageListedInBackground(t *testing.T) {
+	projectDir, err := files.TempDir("test-quota")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".keepsake"))
+	require.NoError(t, err)
+	require.NoError(t, repository.SaveSpec(repo, &repository.Spec{
+		Version: repository.Version,
+		Quota:   &repository.Quota{TotalBytes: 3500},
+	}))
+	// random, so it doesn't compress
+	weights := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "weights.pth"), weights, 0644))
+
+	// saved by someone else
+	other := NewProject(repo, projectDir)
+	_, err = other.CreateExperiment(CreateExperimentArgs{Path: "weights.pth"}, false, nil, true)
+	require.NoError(t, err)
+	_, err = other.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth"}, false, nil, true)
+	require.NoError(t, err)
+
+	// saving doesn't wait for the usage to be listed
+	project := NewProject(repo, projectDir)
+	_, err = project.CreateExperiment(CreateExperimentArgs{Path: "weights.pth"}, false, nil, true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		project.quotaMu.Lock()
+		defer project.quotaMu.Unlock()
+		return project.quotaUsage != nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// then files saved by everyone count
+	_, err = project.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pth"}, false, nil, true)
+	require.True(t, errors.IsQuotaExceeded(err))
+}
@@ -0,0 +1,50 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/param"
+)
+
+// redactedPrefix starts the values of params that have been redacted
+const redactedPrefix = "redacted:"
+
+// IsSensitiveParam returns true if name matches one of patterns, which are
+// names or glob patterns like "*_key"
+func IsSensitiveParam(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactParams returns a copy of params with the values of sensitive params
+// replaced by a hash of them. The same value always has the same hash, so
+// redacted params can still be compared.
+func RedactParams(params param.ValueMap, patterns []string) param.ValueMap {
+	if len(patterns) == 0 || params == nil {
+		return params
+	}
+	redacted := param.ValueMap{}
+	for name, value := range params {
+		if IsSensitiveParam(name, patterns) && !isRedacted(value) {
+			value = param.String(redactValue(value))
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+func redactValue(value param.Value) string {
+	hash := sha256.Sum256([]byte(value.String()))
+	return redactedPrefix + hex.EncodeToString(hash[:])[:12]
+}
+
+func isRedacted(value param.Value) bool {
+	return value.Type() == param.TypeString && strings.HasPrefix(value.StringVal(), redactedPrefix)
+}
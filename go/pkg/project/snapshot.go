@@ -0,0 +1,114 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+)
+
+// ManifestStorageObjects means the files in a manifest are stored as
+// content-addressed objects, instead of in a tarball
+const ManifestStorageObjects = "objects"
+
+// objectPath returns the path of the object with SHA-256 hash sha. Objects are
+// split into directories by the first two characters of the hash, so each
+// directory can be listed quickly.
+func objectPath(sha string) string {
+	return path.Join("objects", sha[:2], sha)
+}
+
+// putObjects uploads the files in the manifest from localPath as
+// content-addressed objects, skipping any that are already in the repository
+func (p *Project) putObjects(localPath string, manifest *Manifest) (uploaded int, err error) {
+	existingByDir := map[string]map[string]bool{}
+	for _, relPath := range manifest.sortedPaths() {
+		objPath := objectPath(manifest.Files[relPath].SHA256)
+		dir := path.Dir(objPath)
+		existing, ok := existingByDir[dir]
+		if !ok {
+			paths, err := p.repository.List(dir)
+			if err != nil {
+				return uploaded, err
+			}
+			existing = map[string]bool{}
+			for _, p := range paths {
+				existing[path.Base(p)] = true
+			}
+			existingByDir[dir] = existing
+		}
+		if existing[path.Base(objPath)] {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(localPath, filepath.FromSlash(relPath)))
+		if err != nil {
+			return uploaded, fmt.Errorf("Failed to read %s: %w", relPath, err)
+		}
+		if err := p.repository.Put(objPath, data); err != nil {
+			return uploaded, err
+		}
+		existing[path.Base(objPath)] = true
+		uploaded++
+	}
+	return uploaded, nil
+}
+
+// getObjects writes the files in the manifest that are in checkoutPath to
+// outputDir, from content-addressed objects. If checkoutPath is empty, all the
+// files are written. It returns the number of files written.
+func (p *Project) getObjects(manifest *Manifest, outputDir string, checkoutPath string) (int, error) {
+	checkoutPath = filepath.ToSlash(filepath.Clean(checkoutPath))
+	written := 0
+	for _, relPath := range manifest.sortedPaths() {
+		if !(checkoutPath == "." || relPath == checkoutPath || strings.HasPrefix(relPath, checkoutPath+"/")) {
+			continue
+		}
+		file := manifest.Files[relPath]
+		objPath := objectPath(file.SHA256)
+		data, err := p.repository.Get(objPath)
+		if err != nil {
+			if errors.IsDoesNotExist(err) {
+				return written, errors.Corrupt(fmt.Sprintf("The file %s is missing from the repository (it should be at %s)", relPath, objPath))
+			}
+			return written, err
+		}
+		localPath, err := files.JoinWithin(outputDir, relPath)
+		if err != nil {
+			return written, err
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return written, err
+		}
+		mode := os.FileMode(0644)
+		if file.Executable {
+			mode = 0755
+		}
+		if err := ioutil.WriteFile(localPath, data, mode); err != nil {
+			return written, fmt.Errorf("Failed to write %s: %w", localPath, err)
+		}
+		written++
+	}
+	console.Debug("Wrote %d files from content-addressed objects to %s", written, outputDir)
+	return written, nil
+}
+
+// getExperimentObjects writes the experiment's files in checkoutPath to outputDir,
+// if they were saved as content-addressed objects. contentAddressed is false if
+// they weren't, and should be read from the experiment's tarball instead.
+func (p *Project) getExperimentObjects(exp *Experiment, outputDir string, checkoutPath string) (contentAddressed bool, written int, err error) {
+	manifest, err := loadManifest(p.repository, exp.ManifestPath())
+	if err != nil {
+		return false, 0, err
+	}
+	if manifest == nil || manifest.Storage != ManifestStorageObjects {
+		return false, 0, nil
+	}
+	written, err = p.getObjects(manifest, outputDir, checkoutPath)
+	return true, written, err
+}
@@ -0,0 +1,120 @@
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// maxSnapshotOffenders is how many of the largest files and directories are
+// listed when a snapshot is too big
+const maxSnapshotOffenders = 10
+
+// confirmLargeSnapshot shows message and asks whether to save the files
+// anyway. It returns false without asking if nobody is there to answer, e.g.
+// in CI.
+var confirmLargeSnapshot = func(message string) (bool, error) {
+	if !console.IsTerminal() || os.Getenv("CI") != "" {
+		return false, nil
+	}
+	console.Warn("%s", message)
+	// a whole line, because the daemon's output is passed on a line at a time
+	fmt.Println("Do you want to save them anyway? (y/N)")
+	text, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+	text = strings.ToLower(strings.TrimSpace(text))
+	return text == "y" || text == "yes", nil
+}
+
+// snapshotEntry is a file or directory in the path being saved, and the
+// total size of the files in it
+type snapshotEntry struct {
+	path string
+	size int64
+}
+
+// checkSnapshotSize stops an experiment from saving includePath if it is
+// bigger than snapshot_size_limit in keepsake.yaml, unless the user says to
+// save it anyway. It is checked before the files are copied, so mistakes are
+// caught before a long upload starts.
+func (p *Project) checkSnapshotSize(includePath string) error {
+	limit := p.config.SnapshotSizeLimitBytes()
+	if limit == 0 {
+		return nil
+	}
+	relPaths, err := repository.ListFilesToSave(p.directory, includePath)
+	if err != nil {
+		return err
+	}
+
+	// sizes of the top-level files and directories in includePath, so a
+	// directory of lots of small files shows up as well as one big file
+	includePath = filepath.Clean(includePath)
+	var total int64
+	sizes := map[string]int64{}
+	for _, relPath := range relPaths {
+		info, err := os.Lstat(filepath.Join(p.directory, relPath))
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		sizes[topLevelEntry(includePath, relPath)] += info.Size()
+	}
+	if total <= limit {
+		return nil
+	}
+
+	entries := []snapshotEntry{}
+	for entryPath, size := range sizes {
+		entries = append(entries, snapshotEntry{path: entryPath, size: size})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return entries[i].path < entries[j].path
+	})
+	if len(entries) > maxSnapshotOffenders {
+		entries = entries[:maxSnapshotOffenders]
+	}
+	lines := []string{fmt.Sprintf("The files in '%s' that would be saved with this experiment are %s, which is more than snapshot_size_limit in keepsake.yaml (%s). The largest are:", includePath, console.FormatBytes(uint64(total)), console.FormatBytes(uint64(limit)))}
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf("  %10s  %s", console.FormatBytes(uint64(entry.size)), entry.path))
+	}
+	message := strings.Join(lines, "\n")
+
+	confirmed, err := confirmLargeSnapshot(message)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return fmt.Errorf("%s\n\nTo leave files out, add them to .keepsakeignore. To save them anyway, raise snapshot_size_limit in keepsake.yaml, or set it to 0 for no limit.", message)
+	}
+	return nil
+}
+
+// topLevelEntry returns the file or directory directly inside includePath
+// that relPath is in, with a trailing slash if it is a directory
+func topLevelEntry(includePath string, relPath string) string {
+	rest := relPath
+	prefix := ""
+	if includePath != "." {
+		if relPath == includePath {
+			return filepath.ToSlash(relPath)
+		}
+		prefix = includePath + string(filepath.Separator)
+		rest = strings.TrimPrefix(relPath, prefix)
+	}
+	if i := strings.Index(rest, string(filepath.Separator)); i != -1 {
+		return filepath.ToSlash(prefix+rest[:i]) + "/"
+	}
+	return filepath.ToSlash(relPath)
+}
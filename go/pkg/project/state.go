@@ -0,0 +1,208 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// ExperimentState is where an experiment is in its life
+type ExperimentState string
+
+const (
+	// StateCreated is an experiment that has been saved, but hasn't sent a
+	// heartbeat yet
+	StateCreated ExperimentState = "created"
+	// StateRunning is an experiment that is sending heartbeats
+	StateRunning ExperimentState = "running"
+	// StateStopping is a running experiment that has been asked to stop
+	// with "keepsake stop"
+	StateStopping ExperimentState = "stopping"
+	// StateStopped is an experiment that was stopped before it finished, by
+	// "keepsake stop", Ctrl-C, or early_stopping
+	StateStopped ExperimentState = "stopped"
+	// StatePreempted is an experiment whose machine was reclaimed by the
+	// cloud provider
+	StatePreempted ExperimentState = "preempted"
+	// StateCrashed is an experiment whose heartbeats stopped without its
+	// process shutting Keepsake down, e.g. because it was killed
+	StateCrashed ExperimentState = "crashed"
+	// StateCompleted is an experiment whose process exited by itself
+	StateCompleted ExperimentState = "completed"
+)
+
+// IsFinished returns true if the experiment won't change state again
+func (s ExperimentState) IsFinished() bool {
+	switch s {
+	case StateStopped, StatePreempted, StateCrashed, StateCompleted:
+		return true
+	}
+	return false
+}
+
+// StateRecord is the last state an experiment was put in by the process
+// running it. Running, stopping, and crashed aren't recorded, because they
+// are worked out from heartbeats and stop requests.
+type StateRecord struct {
+	ExperimentID string          `json:"experiment_id"`
+	State        ExperimentState `json:"state"`
+	Time         time.Time       `json:"time"`
+}
+
+// StopRequest asks the process running an experiment to stop it. It is
+// saved by "keepsake stop", and the process checks for it with each
+// heartbeat.
+type StopRequest struct {
+	ExperimentID string    `json:"experiment_id"`
+	User         string    `json:"user"`
+	Time         time.Time `json:"time"`
+}
+
+func stateRecordPath(experimentID string) string {
+	return path.Join("metadata", "states", experimentID+".json")
+}
+
+func stopRequestPath(experimentID string) string {
+	return path.Join("metadata", "stop-requests", experimentID+".json")
+}
+
+func saveStateRecord(repo repository.Repository, experimentID string, state ExperimentState, t time.Time) error {
+	data, err := json.MarshalIndent(&StateRecord{ExperimentID: experimentID, State: state, Time: t}, "", " ")
+	if err != nil {
+		return err
+	}
+	return repo.Put(stateRecordPath(experimentID), data)
+}
+
+func listStateRecords(repo repository.Repository) ([]*StateRecord, error) {
+	paths, err := repo.List("metadata/states/")
+	if err != nil {
+		return nil, err
+	}
+	records := []*StateRecord{}
+	for _, p := range paths {
+		record := new(StateRecord)
+		if err := loadFromPath(repo, p, record); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func listStopRequests(repo repository.Repository) ([]*StopRequest, error) {
+	paths, err := repo.List("metadata/stop-requests/")
+	if err != nil {
+		return nil, err
+	}
+	requests := []*StopRequest{}
+	for _, p := range paths {
+		request := new(StopRequest)
+		if err := loadFromPath(repo, p, request); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, err)
+			continue
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// ExperimentState returns the state of an experiment, from the state its
+// process recorded, its heartbeat, and whether it has been asked to stop.
+// Experiments saved before states were recorded are either running or
+// stopped, because whether they crashed can't be told apart from them
+// finishing without being stopped explicitly.
+func (p *Project) ExperimentState(experimentID string) (ExperimentState, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return "", err
+	}
+	if _, ok := p.preemptionsByExpID[experimentID]; ok {
+		return StatePreempted, nil
+	}
+	if _, ok := p.earlyStopsByExpID[experimentID]; ok {
+		return StateStopped, nil
+	}
+	record := p.stateRecordsByExpID[experimentID]
+	if record != nil && record.State.IsFinished() {
+		return record.State, nil
+	}
+	heartbeat, ok := p.heartbeatsByExpID[experimentID]
+	switch {
+	case ok && heartbeat.IsRunning():
+		if _, ok := p.stopRequestsByExpID[experimentID]; ok {
+			return StateStopping, nil
+		}
+		return StateRunning, nil
+	case record == nil:
+		return StateStopped, nil
+	case ok:
+		return StateCrashed, nil
+	}
+	return StateCreated, nil
+}
+
+// ExperimentStopRequest returns the request to stop an experiment, or nil if
+// it hasn't been asked to stop
+func (p *Project) ExperimentStopRequest(experimentID string) (*StopRequest, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return p.stopRequestsByExpID[experimentID], nil
+}
+
+// RequestStop asks the process running an experiment to stop it, the next
+// time it sends a heartbeat
+func (p *Project) RequestStop(experimentID string, user string) error {
+	data, err := json.MarshalIndent(&StopRequest{ExperimentID: experimentID, User: user, Time: time.Now().UTC()}, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := p.repository.Put(stopRequestPath(experimentID), data); err != nil {
+		return err
+	}
+	p.invalidateCache()
+	return nil
+}
+
+// IsStopRequested returns true if an experiment has been asked to stop. It
+// reads the repository directly, rather than the metadata that was loaded, so
+// the process running the experiment sees requests as soon as they are made.
+func (p *Project) IsStopRequested(experimentID string) (bool, error) {
+	if _, err := repository.GetFresh(p.repository, stopRequestPath(experimentID)); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Failed to check whether experiment %s has been asked to stop: %w", experimentID[:7], err)
+	}
+	return true, nil
+}
+
+// FinishExperiment records that the process running an experiment has
+// finished with it. It was stopped if interrupted is true or it was asked to
+// stop, and otherwise it completed.
+func (p *Project) FinishExperiment(experimentID string, interrupted bool) error {
+	requested, err := p.IsStopRequested(experimentID)
+	if err != nil {
+		return err
+	}
+	state := StateCompleted
+	if interrupted || requested {
+		state = StateStopped
+	}
+	if err := saveStateRecord(p.repository, experimentID, state, time.Now().UTC()); err != nil {
+		return err
+	}
+	if requested {
+		if err := p.repository.Delete(stopRequestPath(experimentID)); err != nil && !errors.IsDoesNotExist(err) {
+			console.Warn("Failed to delete stop request for experiment %s: %s", experimentID[:7], err)
+		}
+	}
+	p.invalidateCache()
+	return nil
+}
@@ -0,0 +1,144 @@
+package project
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats summarizes the experiments in a project, e.g. for reports
+type Stats struct {
+	NumExperiments int   `json:"num_experiments"`
+	NumCheckpoints int   `json:"num_checkpoints"`
+	TotalBytes     int64 `json:"total_bytes"`
+	// TotalBytes divided by the number of experiments
+	AverageExperimentBytes int64 `json:"average_experiment_bytes"`
+
+	// How many experiments each user started each week, oldest week first
+	RunsByWeek []*WeeklyRuns `json:"runs_by_week"`
+
+	// The best value of each primary metric each week, by metric name
+	MetricTrends []*MetricTrend `json:"metric_trends"`
+}
+
+// WeeklyRuns is how many experiments a user started in a week
+type WeeklyRuns struct {
+	// Week is when the week started, at midnight UTC on Monday
+	Week time.Time `json:"week"`
+	User string    `json:"user"`
+	Runs int       `json:"runs"`
+}
+
+// MetricTrend is how the best value of a primary metric changed over time
+type MetricTrend struct {
+	Metric string          `json:"metric"`
+	Goal   MetricGoal      `json:"goal"`
+	Weeks  []*WeeklyMetric `json:"weeks"`
+}
+
+// WeeklyMetric is the best value of a metric in the experiments started in a
+// week, and the best value in all of the experiments started up to then
+type WeeklyMetric struct {
+	Week         time.Time `json:"week"`
+	Best         float64   `json:"best"`
+	ExperimentID string    `json:"experiment_id"`
+	BestSoFar    float64   `json:"best_so_far"`
+}
+
+// Stats counts the experiments, checkpoints, and storage in the project, and
+// how they changed week by week
+func (p *Project) Stats() (*Stats, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := p.StorageUsage()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{
+		NumExperiments: len(experiments),
+		TotalBytes:     usage.TotalBytes,
+		RunsByWeek:     []*WeeklyRuns{},
+		MetricTrends:   []*MetricTrend{},
+	}
+	if len(experiments) > 0 {
+		stats.AverageExperimentBytes = usage.TotalBytes / int64(len(experiments))
+	}
+
+	runs := map[time.Time]map[string]*WeeklyRuns{}
+	trends := map[string]*MetricTrend{}
+	for _, exp := range experiments {
+		stats.NumCheckpoints += len(exp.Checkpoints)
+
+		week := weekStart(exp.Created)
+		if runs[week] == nil {
+			runs[week] = map[string]*WeeklyRuns{}
+		}
+		if runs[week][exp.User] == nil {
+			runs[week][exp.User] = &WeeklyRuns{Week: week, User: exp.User}
+			stats.RunsByWeek = append(stats.RunsByWeek, runs[week][exp.User])
+		}
+		runs[week][exp.User].Runs++
+
+		addToMetricTrend(trends, exp, week)
+	}
+	sort.Slice(stats.RunsByWeek, func(i, j int) bool {
+		a, b := stats.RunsByWeek[i], stats.RunsByWeek[j]
+		if !a.Week.Equal(b.Week) {
+			return a.Week.Before(b.Week)
+		}
+		return a.User < b.User
+	})
+
+	for _, trend := range trends {
+		sort.Slice(trend.Weeks, func(i, j int) bool {
+			return trend.Weeks[i].Week.Before(trend.Weeks[j].Week)
+		})
+		for i, week := range trend.Weeks {
+			week.BestSoFar = week.Best
+			if i > 0 && !improves(week.Best, trend.Weeks[i-1].BestSoFar, trend.Goal, 0) {
+				week.BestSoFar = trend.Weeks[i-1].BestSoFar
+			}
+		}
+		stats.MetricTrends = append(stats.MetricTrends, trend)
+	}
+	sort.Slice(stats.MetricTrends, func(i, j int) bool {
+		return stats.MetricTrends[i].Metric < stats.MetricTrends[j].Metric
+	})
+	return stats, nil
+}
+
+// addToMetricTrend records the value of exp's best checkpoint in the trend for
+// its primary metric, if it is the best value that week
+func addToMetricTrend(trends map[string]*MetricTrend, exp *Experiment, week time.Time) {
+	best := exp.BestCheckpoint()
+	if best == nil || best.PrimaryMetric == nil {
+		return
+	}
+	name, goal := best.PrimaryMetric.Name, best.PrimaryMetric.Goal
+	value, ok := numericMetric(best.Metrics[name])
+	if !ok {
+		return
+	}
+	trend, ok := trends[name]
+	if !ok {
+		trend = &MetricTrend{Metric: name, Goal: goal}
+		trends[name] = trend
+	}
+	for _, w := range trend.Weeks {
+		if w.Week.Equal(week) {
+			if improves(value, w.Best, goal, 0) {
+				w.Best, w.ExperimentID = value, exp.ID
+			}
+			return
+		}
+	}
+	trend.Weeks = append(trend.Weeks, &WeeklyMetric{Week: week, Best: value, ExperimentID: exp.ID})
+}
+
+// weekStart returns midnight UTC on the Monday of the week t is in
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
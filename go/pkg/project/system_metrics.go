@@ -0,0 +1,85 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/sysmetrics"
+)
+
+// SystemMetricsChunkSize is the number of samples in each chunk of an
+// experiment's system metrics. Samples are saved in chunks, so saving a new
+// sample only uploads the chunk it is in, rather than the whole time series.
+const SystemMetricsChunkSize = 60
+
+// SaveSystemMetrics writes chunk number chunk of the system metrics sampled
+// while an experiment was running, which is up to SystemMetricsChunkSize
+// samples. They are stored outside of metadata/ so they aren't synced to the
+// local cache along with everything else.
+func (p *Project) SaveSystemMetrics(exp *Experiment, chunk int, samples []*sysmetrics.Sample) error {
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return fmt.Errorf("Failed to serialize system metrics: %w", err)
+	}
+	return p.repository.Put(systemMetricsChunkPath(exp, chunk), data)
+}
+
+// SystemMetrics returns the system metrics sampled while an experiment was
+// running, or an empty list if none were recorded
+func (p *Project) SystemMetrics(exp *Experiment) ([]*sysmetrics.Sample, error) {
+	// experiments from before system metrics were chunked have them in one file
+	samples, err := p.loadSystemMetrics(exp.SystemMetricsPath())
+	if err != nil {
+		return nil, err
+	}
+	paths, err := p.repository.List(exp.SystemMetricsDir())
+	if err != nil {
+		return nil, err
+	}
+	// chunk numbers are zero-padded, so they sort in order
+	sort.Strings(paths)
+	for _, chunkPath := range paths {
+		chunk, err := p.loadSystemMetrics(chunkPath)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, chunk...)
+	}
+	return samples, nil
+}
+
+// deleteSystemMetrics deletes all of an experiment's system metrics
+func (p *Project) deleteSystemMetrics(exp *Experiment) error {
+	paths, err := p.repository.List(exp.SystemMetricsDir())
+	if err != nil {
+		return err
+	}
+	for _, metricsPath := range append(paths, exp.SystemMetricsPath()) {
+		if err := p.repository.Delete(metricsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Project) loadSystemMetrics(metricsPath string) ([]*sysmetrics.Sample, error) {
+	data, err := p.repository.Get(metricsPath)
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return []*sysmetrics.Sample{}, nil
+		}
+		return nil, err
+	}
+	samples := []*sysmetrics.Sample{}
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("Failed to parse system metrics %s: %w", metricsPath, err)
+	}
+	return samples, nil
+}
+
+func systemMetricsChunkPath(exp *Experiment, chunk int) string {
+	return path.Join(exp.SystemMetricsDir(), fmt.Sprintf("%06d.json", chunk))
+}
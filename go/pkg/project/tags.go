@@ -0,0 +1,57 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// ExperimentTags are the tags an experiment was given by the template it was
+// created with. They are kept out of the experiment's metadata so they aren't
+// lost when the Python library saves the experiment.
+type ExperimentTags struct {
+	ExperimentID string   `json:"experiment_id"`
+	Template     string   `json:"template,omitempty"`
+	Tags         []string `json:"tags"`
+}
+
+func CreateExperimentTags(repo repository.Repository, experimentID string, template string, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	experimentTags := &ExperimentTags{
+		ExperimentID: experimentID,
+		Template:     template,
+		Tags:         tags,
+	}
+	data, err := json.MarshalIndent(experimentTags, "", " ")
+	if err != nil {
+		return err
+	}
+	return repo.Put(path.Join("metadata", "tags", experimentID+".json"), data)
+}
+
+func listExperimentTags(repo repository.Repository) ([]*ExperimentTags, error) {
+	paths, err := repo.List("metadata/tags/")
+	if err != nil {
+		return nil, err
+	}
+	allTags := []*ExperimentTags{}
+	for _, p := range paths {
+		contents, err := repo.Get(p)
+		if err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, err)
+			continue
+		}
+		experimentTags := new(ExperimentTags)
+		if err := json.Unmarshal(contents, experimentTags); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, fmt.Errorf("Parse error: %s", err))
+			continue
+		}
+		allTags = append(allTags, experimentTags)
+	}
+	return allTags, nil
+}
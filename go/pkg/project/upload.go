@@ -0,0 +1,75 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// Upload records that a checkpoint's files are being uploaded, and which of
+// them are fully uploaded. It is saved before the first file is uploaded and
+// removed when the last one is, so if it is still there after the experiment
+// has stopped, the upload was interrupted and the checkpoint is incomplete.
+type Upload struct {
+	CheckpointID string    `json:"checkpoint_id"`
+	Started      time.Time `json:"started"`
+	// Files is every file in the checkpoint, relative to its path
+	Files []string `json:"files"`
+	// Uploaded is the files that are fully uploaded
+	Uploaded []string `json:"uploaded"`
+}
+
+func (c *Checkpoint) UploadPath() string {
+	return "metadata/uploads/checkpoints/" + c.ID + ".json"
+}
+
+func saveUpload(repo repository.Repository, chk *Checkpoint, upload *Upload) error {
+	data, err := json.MarshalIndent(upload, "", " ")
+	if err != nil {
+		return err
+	}
+	return repo.Put(chk.UploadPath(), data)
+}
+
+// startUpload saves an Upload for chk, with none of the files in manifest
+// uploaded yet
+func startUpload(repo repository.Repository, chk *Checkpoint, manifest *Manifest) error {
+	upload := &Upload{
+		CheckpointID: chk.ID,
+		Started:      time.Now().UTC(),
+		Files:        manifest.sortedPaths(),
+		Uploaded:     []string{},
+	}
+	if err := saveUpload(repo, chk, upload); err != nil {
+		return fmt.Errorf("Failed to save upload marker for checkpoint %s: %w", chk.ShortID(), err)
+	}
+	return nil
+}
+
+// finishUpload removes chk's Upload, marking it as complete
+func finishUpload(repo repository.Repository, chk *Checkpoint) error {
+	if err := repo.Delete(chk.UploadPath()); err != nil {
+		return fmt.Errorf("Failed to remove upload marker for checkpoint %s: %w", chk.ShortID(), err)
+	}
+	return nil
+}
+
+func listUploads(repo repository.Repository) ([]*Upload, error) {
+	paths, err := repo.List("metadata/uploads/checkpoints/")
+	if err != nil {
+		return nil, err
+	}
+	uploads := []*Upload{}
+	for _, p := range paths {
+		upload := new(Upload)
+		if err := loadFromPath(repo, p, upload); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", p, err)
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
@@ -0,0 +1,100 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// FileDrift is how the files in a local directory differ from the files that
+// were saved with a checkpoint or experiment. Paths are relative to the
+// directory, with forward slashes.
+type FileDrift struct {
+	// Files that were saved but aren't in the directory
+	Missing []string
+	// Files that are in the directory, but with different contents
+	Changed []*ChangedFile
+	// Files in the path that was saved that weren't saved
+	Extra []string
+}
+
+// IsEmpty returns true if the directory matches what was saved
+func (d *FileDrift) IsEmpty() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Extra) == 0
+}
+
+// ChangedFile is a file whose size or hash isn't the one that was saved.
+// The hashes are only set if the sizes are the same.
+type ChangedFile struct {
+	Path           string
+	Size           int64
+	ExpectedSize   int64
+	SHA256         string
+	ExpectedSHA256 string
+}
+
+func (c *ChangedFile) String() string {
+	if c.Size != c.ExpectedSize {
+		return fmt.Sprintf("%s is %d bytes, expected %d bytes", c.Path, c.Size, c.ExpectedSize)
+	}
+	return fmt.Sprintf("%s has SHA-256 %s, expected %s", c.Path, c.SHA256, c.ExpectedSHA256)
+}
+
+// VerifyCheckpoint compares the files in localDir with the files that were
+// saved with a checkpoint. localDir is where they would be checked out to,
+// so the files are in the path the checkpoint was saved from inside it.
+func (p *Project) VerifyCheckpoint(chk *Checkpoint, localDir string) (*FileDrift, error) {
+	if chk.Path == "" {
+		return nil, fmt.Errorf("The checkpoint %s does not have any files associated with it.", chk.ShortID())
+	}
+	return p.verifyLocalFiles(chk.ManifestPath(), chk.Path, localDir, "checkpoint "+chk.ShortID())
+}
+
+// VerifyExperiment compares the files in localDir with the files that were
+// saved with an experiment, like VerifyCheckpoint
+func (p *Project) VerifyExperiment(exp *Experiment, localDir string) (*FileDrift, error) {
+	if exp.Path == "" {
+		return nil, fmt.Errorf("The experiment %s does not have any files associated with it.", exp.ShortID())
+	}
+	return p.verifyLocalFiles(exp.ManifestPath(), exp.Path, localDir, "experiment "+exp.ShortID())
+}
+
+func (p *Project) verifyLocalFiles(manifestPath string, savedPath string, localDir string, description string) (*FileDrift, error) {
+	if isDir, err := files.IsDir(localDir); err != nil || !isDir {
+		return nil, fmt.Errorf("%s is not a directory", localDir)
+	}
+	manifest, err := loadManifest(p.repository, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("The files in %s can't be verified, because it was saved with a version of Keepsake that didn't record their hashes", description)
+	}
+	drift, err := manifest.compare(localDir, savedPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compare %s with %s: %w", localDir, description, err)
+	}
+
+	exists, err := files.FileExists(filepath.Join(localDir, savedPath))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return drift, nil
+	}
+	localFiles, err := repository.ListFilesToSave(localDir, savedPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list files in %s: %w", localDir, err)
+	}
+	for _, relPath := range localFiles {
+		relPath = filepath.ToSlash(relPath)
+		if _, ok := manifest.Files[relPath]; !ok {
+			drift.Extra = append(drift.Extra, relPath)
+		}
+	}
+	sort.Strings(drift.Extra)
+	return drift, nil
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// GPULocks is a registry of which GPUs are in use on this machine, so two
+// Keepsake processes (e.g. schedulers for different queues) don't put jobs
+// on the same GPU.
+//
+// Each lock is an flock(2) on a file in the registry. The kernel releases it
+// when every process with the file open has exited, so a lock is never left
+// behind by a process that crashed, and there is no stale lock to take over.
+// The scheduler passes the lock files to jobs, so a GPU stays locked while its
+// job runs, even if the scheduler exits.
+type GPULocks struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[int]*os.File
+}
+
+// DefaultGPULockDir returns the lock registry shared by everyone on the machine
+func DefaultGPULockDir() string {
+	return filepath.Join(os.TempDir(), "keepsake-gpu-locks")
+}
+
+// NewGPULocks opens the lock registry in dir, creating it if it doesn't exist.
+// Like /tmp, it can be written by everyone, but has the sticky bit set so
+// users can't delete each other's lock files and lock new ones in their place.
+func NewGPULocks(dir string) (*GPULocks, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, errors.WriteError(fmt.Sprintf("Failed to create GPU lock directory %s: %s", dir, err))
+	}
+	if err := os.Chmod(dir, 0777|os.ModeSticky); err != nil && !os.IsPermission(err) {
+		return nil, errors.WriteError(fmt.Sprintf("Failed to set permissions of GPU lock directory %s: %s", dir, err))
+	}
+	return &GPULocks{dir: dir, files: map[int]*os.File{}}, nil
+}
+
+// Lock locks gpu for this process. It returns false if another process holds the lock.
+func (l *GPULocks) Lock(gpu int) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.files[gpu]; ok {
+		return true, nil
+	}
+	f, locked, err := l.tryLock(gpu)
+	if err != nil || !locked {
+		return false, err
+	}
+	l.files[gpu] = f
+	return true, nil
+}
+
+// Unlock releases this process's lock on gpu. Jobs that were passed the lock
+// file with Files keep holding it until they exit.
+func (l *GPULocks) Unlock(gpu int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.files[gpu]
+	if !ok {
+		return nil
+	}
+	delete(l.files, gpu)
+	if err := f.Close(); err != nil {
+		return errors.WriteError(fmt.Sprintf("Failed to unlock GPU %d: %s", gpu, err))
+	}
+	return nil
+}
+
+// Files returns the open lock files of gpus, which must be locked by this
+// process, to pass to the process that runs on them
+func (l *GPULocks) Files(gpus []int) []*os.File {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files := []*os.File{}
+	for _, gpu := range gpus {
+		if f, ok := l.files[gpu]; ok {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// LockedByOther returns true if another process holds the lock on gpu
+func (l *GPULocks) LockedByOther(gpu int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.files[gpu]; ok {
+		return false
+	}
+	f, locked, err := l.tryLock(gpu)
+	if err != nil {
+		return false
+	}
+	if locked {
+		f.Close()
+	}
+	return !locked
+}
+
+// tryLock takes an exclusive lock on gpu's lock file without waiting,
+// returning the open file that holds it
+func (l *GPULocks) tryLock(gpu int) (f *os.File, locked bool, err error) {
+	for {
+		f, locked, err = l.tryLockFile(gpu)
+		if err != nil || !locked {
+			return nil, false, err
+		}
+		// the file may have been deleted and created again after it was
+		// opened, in which case the lock is on a file nobody else will open
+		same, err := l.isLockFile(gpu, f)
+		if err != nil {
+			f.Close()
+			return nil, false, err
+		}
+		if same {
+			return f, true, nil
+		}
+		f.Close()
+	}
+}
+
+func (l *GPULocks) tryLockFile(gpu int) (f *os.File, locked bool, err error) {
+	// read-only, so lock files created by other users can be locked too
+	f, err = os.OpenFile(l.path(gpu), os.O_RDONLY|os.O_CREATE|syscall.O_NOFOLLOW, 0666)
+	if err != nil {
+		return nil, false, errors.WriteError(fmt.Sprintf("Failed to lock GPU %d: %s", gpu, err))
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		return nil, false, nil
+	}
+	if err != nil {
+		f.Close()
+		return nil, false, errors.WriteError(fmt.Sprintf("Failed to lock GPU %d: %s", gpu, err))
+	}
+	return f, true, nil
+}
+
+// isLockFile returns true if f is the file at gpu's lock path
+func (l *GPULocks) isLockFile(gpu int, f *os.File) (bool, error) {
+	opened, err := f.Stat()
+	if err != nil {
+		return false, errors.WriteError(fmt.Sprintf("Failed to lock GPU %d: %s", gpu, err))
+	}
+	current, err := os.Lstat(l.path(gpu))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WriteError(fmt.Sprintf("Failed to lock GPU %d: %s", gpu, err))
+	}
+	return os.SameFile(opened, current), nil
+}
+
+func (l *GPULocks) path(gpu int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("gpu-%d.lock", gpu))
+}
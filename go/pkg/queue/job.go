@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Job is a command waiting to be run, or that has been run, by the scheduler
+type Job struct {
+	ID        string `json:"id"`
+	Command   string `json:"command"`
+	Directory string `json:"directory"`
+	User      string `json:"user"`
+	NumGPUs   int    `json:"num_gpus"`
+
+	// GPUIDs are the particular GPUs this job must run on, if it was submitted with --gpu-ids
+	GPUIDs []int `json:"gpu_ids,omitempty"`
+
+	Status  Status    `json:"status"`
+	Created time.Time `json:"created"`
+
+	// Timeout is how long each attempt can run before it is killed. Zero means no limit.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Retries is how many times the job is run again if it fails
+	Retries int `json:"retries,omitempty"`
+
+	// If SplitOutput is true, stdout and stderr are written to separate logs,
+	// with the time each line was written
+	SplitOutput bool `json:"split_output,omitempty"`
+
+	// Secrets are passed to the command as environment variables. Their
+	// values are read when the job starts, and are redacted from its output.
+	Secrets []*Secret `json:"secrets,omitempty"`
+
+	// CancelRequested is set by `keepsake queue cancel` on running jobs,
+	// and the scheduler kills them
+	CancelRequested bool `json:"cancel_requested,omitempty"`
+
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	GPUs     []int      `json:"gpus,omitempty"`
+	// PID is the process ID of the running command, which is also the ID of
+	// its process group
+	PID      int    `json:"pid,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	Attempts []*Attempt `json:"attempts,omitempty"`
+}
+
+// Attempt is one run of a job's command. A job has several attempts if it is retried.
+type Attempt struct {
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	ExitCode *int       `json:"exit_code,omitempty"`
+	TimedOut bool       `json:"timed_out,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+func (j *Job) ShortID() string {
+	return j.ID[:7]
+}
+
+// CurrentAttempt returns the attempt that is running, or nil if the job isn't running
+func (j *Job) CurrentAttempt() *Attempt {
+	if j.Status != StatusRunning || len(j.Attempts) == 0 {
+		return nil
+	}
+	return j.Attempts[len(j.Attempts)-1]
+}
+
+// IsDone returns true if the job will never run again
+func (j *Job) IsDone() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogLine is a line of output written by a job
+type LogLine struct {
+	// Time is when the line was written. It is zero if the job wasn't
+	// submitted with SplitOutput.
+	Time time.Time
+	// Stream is StreamStdout or StreamStderr, or "" if the job wasn't
+	// submitted with SplitOutput
+	Stream string
+	Text   string
+}
+
+// StreamLogPath returns the file that stream of job is written to, if the job
+// was submitted with SplitOutput
+func (q *Queue) StreamLogPath(job *Job, stream string) string {
+	return filepath.Join(q.dir, "logs", job.ID+"."+stream+".log")
+}
+
+// ReadLogs returns the output of job, in the order it was written. If since
+// isn't zero, only lines written after it are returned. If streams isn't
+// empty, only lines from those streams are returned.
+//
+// Output can only be filtered by time or stream if the job was submitted with
+// SplitOutput.
+func (q *Queue) ReadLogs(job *Job, since time.Time, streams []string) ([]*LogLine, error) {
+	if !job.SplitOutput {
+		if !since.IsZero() || len(streams) > 0 {
+			return nil, fmt.Errorf("Job %s wasn't submitted with --split-output, so its output can't be filtered by time or by stdout and stderr", job.ShortID())
+		}
+		return readLogLines(q.LogPath(job), func(text string) (*LogLine, error) {
+			return &LogLine{Text: text}, nil
+		})
+	}
+
+	if len(streams) == 0 {
+		streams = []string{StreamStdout, StreamStderr}
+	}
+	lines := []*LogLine{}
+	for _, stream := range streams {
+		stream := stream
+		streamLines, err := readLogLines(q.StreamLogPath(job, stream), func(text string) (*LogLine, error) {
+			return parseTimestampedLine(stream, text)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range streamLines {
+			if line.Time.After(since) {
+				lines = append(lines, line)
+			}
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+	return lines, nil
+}
+
+// readLogLines parses each line of the log at path. A log that doesn't exist
+// has no lines, because the job hasn't written anything yet.
+func readLogLines(path string, parse func(text string) (*LogLine, error)) ([]*LogLine, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []*LogLine{}, nil
+	}
+	if err != nil {
+		return nil, errors.ReadError(fmt.Sprintf("Failed to open log %s: %s", path, err))
+	}
+	defer f.Close()
+
+	lines := []*LogLine{}
+	reader := bufio.NewReader(f)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			line, parseErr := parse(strings.TrimSuffix(text, "\n"))
+			if parseErr != nil {
+				return nil, errors.Corrupt(fmt.Sprintf("Failed to parse log %s: %s", path, parseErr))
+			}
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, errors.ReadError(fmt.Sprintf("Failed to read log %s: %s", path, err))
+		}
+	}
+}
+
+func parseTimestampedLine(stream string, text string) (*LogLine, error) {
+	parts := strings.SplitN(text, " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("line has no timestamp: %q", text)
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	return &LogLine{Time: t, Stream: stream, Text: parts[1]}, nil
+}
+
+// timestampWriter writes each line written to it to w, prefixed with the time
+// it was written. Anything after the last newline is held until the rest of
+// the line is written, or it is closed.
+type timestampWriter struct {
+	w       io.WriteCloser
+	mu      sync.Mutex
+	partial bytes.Buffer
+	now     func() time.Time
+}
+
+func newTimestampWriter(w io.WriteCloser) *timestampWriter {
+	return &timestampWriter{w: w, now: time.Now}
+}
+
+func (w *timestampWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial.Write(p)
+	for {
+		i := bytes.IndexByte(w.partial.Bytes(), '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		if err := w.writeLine(w.partial.Next(i + 1)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (w *timestampWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.partial.Len() > 0 {
+		line := append(w.partial.Bytes(), '\n')
+		w.partial.Reset()
+		if err := w.writeLine(line); err != nil {
+			w.w.Close()
+			return err
+		}
+	}
+	return w.w.Close()
+}
+
+func (w *timestampWriter) writeLine(line []byte) error {
+	_, err := fmt.Fprintf(w.w, "%s %s", w.now().UTC().Format(time.RFC3339Nano), line)
+	return err
+}
@@ -0,0 +1,236 @@
+// Package queue is a queue of commands to run one at a time, or one per GPU,
+// on a machine that is shared by several people
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/hash"
+)
+
+// Queue is a directory of job files. The scheduler runs whatever commands
+// are in it as the user it is running as, so it is private to that user.
+// People who share a machine each have their own queue and scheduler, and the
+// schedulers share GPUs through GPULocks.
+type Queue struct {
+	dir string
+}
+
+// DefaultDir returns the queue directory used if none is given. Each user has
+// their own.
+func DefaultDir() string {
+	if dir := os.Getenv("KEEPSAKE_QUEUE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("keepsake-queue-%d", os.Getuid()))
+}
+
+// NewQueue opens the queue in dir, creating it if it doesn't exist. It refuses
+// directories that other users could add jobs to, because the jobs would be
+// run as the current user.
+func NewQueue(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WriteError(fmt.Sprintf("Failed to create queue directory %s: %s", dir, err))
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return nil, err
+	}
+	for _, d := range []string{filepath.Join(dir, "jobs"), filepath.Join(dir, "logs")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, errors.WriteError(fmt.Sprintf("Failed to create queue directory %s: %s", d, err))
+		}
+		if err := checkPrivateDir(d); err != nil {
+			return nil, err
+		}
+	}
+	return &Queue{dir: dir}, nil
+}
+
+// currentUID returns the ID of the user this process is running as. It is a
+// variable so tests can replace it.
+var currentUID = os.Getuid
+
+// checkPrivateDir returns an error if dir isn't owned by the current user, or
+// if other users can write to it
+func checkPrivateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.ReadError(fmt.Sprintf("Failed to read queue directory %s: %s", dir, err))
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != currentUID() {
+		return fmt.Errorf("The queue directory %s is owned by another user. Each user needs their own queue, because the scheduler runs queued commands as the user it is running as. Pass a different --queue-dir.", dir)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("Other users can write to the queue directory %s, so they could run commands as you. Run 'chmod 700 %s' to fix this.", dir, dir)
+	}
+	return nil
+}
+
+type SubmitArgs struct {
+	Command   string
+	Directory string
+	User      string
+	NumGPUs   int
+	// If GPUIDs is set, the command will only run on those GPUs and NumGPUs is ignored
+	GPUIDs  []int
+	Timeout time.Duration
+	Retries int
+	// If SplitOutput is true, stdout and stderr are logged separately, with timestamps
+	SplitOutput bool
+	Secrets     []*Secret
+}
+
+// Submit adds a command to the end of the queue
+func (q *Queue) Submit(args SubmitArgs) (*Job, error) {
+	numGPUs := args.NumGPUs
+	if len(args.GPUIDs) > 0 {
+		numGPUs = len(args.GPUIDs)
+	}
+	job := &Job{
+		ID:          hash.Random(),
+		Command:     args.Command,
+		Directory:   args.Directory,
+		User:        args.User,
+		NumGPUs:     numGPUs,
+		GPUIDs:      args.GPUIDs,
+		Timeout:     args.Timeout,
+		Retries:     args.Retries,
+		SplitOutput: args.SplitOutput,
+		Secrets:     args.Secrets,
+		Status:      StatusQueued,
+		Created:     time.Now().UTC(),
+	}
+	if err := q.Save(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Jobs returns all jobs, oldest first
+func (q *Queue) Jobs() ([]*Job, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(q.dir, "jobs"))
+	if err != nil {
+		return nil, errors.ReadError(fmt.Sprintf("Failed to list jobs in %s: %s", q.dir, err))
+	}
+	jobs := []*Job{}
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		job, err := q.Job(strings.TrimSuffix(info.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	return jobs, nil
+}
+
+// Job returns the job with the given ID
+func (q *Queue) Job(id string) (*Job, error) {
+	data, err := ioutil.ReadFile(q.jobPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.DoesNotExist("Job not found: " + id)
+		}
+		return nil, errors.ReadError(fmt.Sprintf("Failed to read job %s: %s", id, err))
+	}
+	job := new(Job)
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, errors.ReadError(fmt.Sprintf("Failed to parse job %s: %s", id, err))
+	}
+	return job, nil
+}
+
+// JobFromPrefix returns the job whose ID starts with prefix
+func (q *Queue) JobFromPrefix(prefix string) (*Job, error) {
+	jobs, err := q.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	matches := []*Job{}
+	for _, job := range jobs {
+		if strings.HasPrefix(job.ID, prefix) {
+			matches = append(matches, job)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.DoesNotExist("Job not found: " + prefix)
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("Prefix is ambiguous: %s (%d matching jobs)", prefix, len(matches))
+	}
+	return matches[0], nil
+}
+
+// Cancel removes a queued job from the queue, or asks the scheduler to kill a running job
+func (q *Queue) Cancel(job *Job) error {
+	switch job.Status {
+	case StatusQueued:
+		job.Status = StatusCancelled
+		now := time.Now().UTC()
+		job.Finished = &now
+	case StatusRunning:
+		job.CancelRequested = true
+	default:
+		return fmt.Errorf("Job %s has already %s", job.ShortID(), job.Status)
+	}
+	return q.Save(job)
+}
+
+// Save writes job to the queue. The file is replaced atomically so the
+// scheduler never reads a partially written job.
+func (q *Queue) Save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", " ")
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Join(q.dir, "jobs"), ".tmp-")
+	if err != nil {
+		return errors.WriteError(fmt.Sprintf("Failed to save job %s: %s", job.ShortID(), err))
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return errors.WriteError(fmt.Sprintf("Failed to save job %s: %s", job.ShortID(), err))
+	}
+	if err := tmpFile.Close(); err != nil {
+		return errors.WriteError(fmt.Sprintf("Failed to save job %s: %s", job.ShortID(), err))
+	}
+	if err := os.Rename(tmpFile.Name(), q.jobPath(job.ID)); err != nil {
+		return errors.WriteError(fmt.Sprintf("Failed to save job %s: %s", job.ShortID(), err))
+	}
+	return nil
+}
+
+// jobOwnedByCurrentUser returns true if the file of the job with the given ID
+// belongs to the user this process is running as
+func (q *Queue) jobOwnedByCurrentUser(id string) (bool, error) {
+	info, err := os.Stat(q.jobPath(id))
+	if err != nil {
+		return false, errors.ReadError(fmt.Sprintf("Failed to read job %s: %s", id, err))
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == currentUID(), nil
+}
+
+// LogPath returns the file the output of job is written to
+func (q *Queue) LogPath(job *Job) string {
+	return filepath.Join(q.dir, "logs", job.ID+".log")
+}
+
+func (q *Queue) jobPath(id string) string {
+	return filepath.Join(q.dir, "jobs", id+".json")
+}
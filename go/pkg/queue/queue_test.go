@@ -0,0 +1,468 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitListCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	q, err := NewQueue(dir)
+	require.NoError(t, err)
+	job1, err := q.Submit(SubmitArgs{Command: "python train.py", Directory: "/code", User: "ben", NumGPUs: 1})
+	require.NoError(t, err)
+	job2, err := q.Submit(SubmitArgs{Command: "python train.py --lr 0.1", Directory: "/code", User: "andreas", NumGPUs: 2})
+	require.NoError(t, err)
+
+	jobs, err := q.Jobs()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, job1.ID, jobs[0].ID)
+	require.Equal(t, StatusQueued, jobs[0].Status)
+
+	job, err := q.JobFromPrefix(job2.ID[:7])
+	require.NoError(t, err)
+	require.NoError(t, q.Cancel(job))
+	job, err = q.Job(job2.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCancelled, job.Status)
+	require.Error(t, q.Cancel(job))
+
+	// running jobs are cancelled by the scheduler
+	job, err = q.Job(job1.ID)
+	require.NoError(t, err)
+	job.Status = StatusRunning
+	require.NoError(t, q.Save(job))
+	require.NoError(t, q.Cancel(job))
+	job, err = q.Job(job1.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusRunning, job.Status)
+	require.True(t, job.CancelRequested)
+}
+
+func TestQueueIsPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = NewQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, "queue", "jobs"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// other users could add jobs that would be run as us
+	require.NoError(t, os.Chmod(filepath.Join(dir, "queue"), 0777))
+	_, err = NewQueue(filepath.Join(dir, "queue"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Other users can write to the queue directory")
+}
+
+func TestNextJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(dir)
+	require.NoError(t, err)
+
+	jobs := []*Job{
+		{ID: "1jjjjjjjjj", Status: StatusRunning, NumGPUs: 1, GPUs: []int{0}},
+		{ID: "2jjjjjjjjj", Status: StatusQueued, NumGPUs: 2},
+		{ID: "3jjjjjjjjj", Status: StatusQueued, NumGPUs: 8},
+		{ID: "4jjjjjjjjj", Status: StatusQueued, NumGPUs: 1},
+		{ID: "5jjjjjjjjj", Status: StatusQueued, NumGPUs: 1},
+	}
+
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+
+	// one at a time
+	s := NewScheduler(q, []int{}, locks, time.Second)
+	require.Empty(t, s.nextJobs(jobs))
+
+	// per GPU, in order, skipping jobs that can never run
+	s = NewScheduler(q, []int{0, 1, 2, 3}, locks, time.Second)
+	require.NoError(t, q.Save(jobs[2]))
+	next := s.nextJobs(jobs)
+	require.Len(t, next, 2)
+	require.Equal(t, "2jjjjjjjjj", next[0].job.ID)
+	require.Equal(t, []int{1, 2}, next[0].gpus)
+	require.Equal(t, "4jjjjjjjjj", next[1].job.ID)
+	require.Equal(t, []int{3}, next[1].gpus)
+	require.Equal(t, StatusFailed, jobs[2].Status)
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+
+	job1, err := q.Submit(SubmitArgs{Command: "echo $CUDA_VISIBLE_DEVICES > out1", Directory: dir, NumGPUs: 1})
+	require.NoError(t, err)
+	job2, err := q.Submit(SubmitArgs{Command: "exit 3", Directory: dir, NumGPUs: 1})
+	require.NoError(t, err)
+
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+	s := NewScheduler(q, []int{0, 1}, locks, time.Second)
+	require.NoError(t, s.Tick())
+	require.Eventually(t, func() bool {
+		job1, err = q.Job(job1.ID)
+		require.NoError(t, err)
+		job2, err = q.Job(job2.ID)
+		require.NoError(t, err)
+		return job1.IsDone() && job2.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, StatusSucceeded, job1.Status)
+	require.Equal(t, []int{0}, job1.GPUs)
+	out, err := ioutil.ReadFile(filepath.Join(dir, "out1"))
+	require.NoError(t, err)
+	require.Equal(t, "0\n", string(out))
+
+	require.Equal(t, StatusFailed, job2.Status)
+	require.Equal(t, 3, *job2.ExitCode)
+}
+
+func TestSchedulerRetriesAndTimeouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+	s := NewScheduler(q, []int{}, locks, time.Second)
+
+	// fails on the first two attempts
+	retried, err := q.Submit(SubmitArgs{Command: "test $KEEPSAKE_QUEUE_ATTEMPT -ge 3", Directory: dir, Retries: 2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		require.NoError(t, s.Tick())
+		retried, err = q.Job(retried.ID)
+		require.NoError(t, err)
+		return retried.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, StatusSucceeded, retried.Status)
+	require.Len(t, retried.Attempts, 3)
+	require.Equal(t, 1, *retried.Attempts[0].ExitCode)
+	require.Equal(t, 0, *retried.Attempts[2].ExitCode)
+
+	timedOut, err := q.Submit(SubmitArgs{Command: "sleep 10", Directory: dir, Timeout: 50 * time.Millisecond, Retries: 2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		require.NoError(t, s.Tick())
+		timedOut, err = q.Job(timedOut.ID)
+		require.NoError(t, err)
+		return timedOut.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, StatusFailed, timedOut.Status)
+	require.Len(t, timedOut.Attempts, 1)
+	require.True(t, timedOut.Attempts[0].TimedOut)
+	require.Equal(t, "Timed out after 50ms", timedOut.Error)
+
+	// jobs that ignore SIGTERM are sent SIGKILL after the grace period
+	s.killGracePeriod = 100 * time.Millisecond
+	stubborn, err := q.Submit(SubmitArgs{Command: "trap '' TERM; sleep 10", Directory: dir, Timeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		require.NoError(t, s.Tick())
+		stubborn, err = q.Job(stubborn.ID)
+		require.NoError(t, err)
+		return stubborn.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, StatusFailed, stubborn.Status)
+	require.True(t, stubborn.Attempts[0].TimedOut)
+}
+
+func TestSchedulerSplitOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+	s := NewScheduler(q, []int{}, locks, time.Second)
+
+	job, err := q.Submit(SubmitArgs{Command: "echo out; echo err >&2; printf partial", Directory: dir, SplitOutput: true})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		require.NoError(t, s.Tick())
+		job, err = q.Job(job.ID)
+		require.NoError(t, err)
+		return job.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	lines, err := q.ReadLogs(job, time.Time{}, nil)
+	require.NoError(t, err)
+	require.Len(t, lines, 3)
+	// stdout and stderr are copied separately, so lines from different
+	// streams can be in either order
+	texts := map[string][]string{}
+	for _, line := range lines {
+		require.False(t, line.Time.IsZero())
+		texts[line.Stream] = append(texts[line.Stream], line.Text)
+	}
+	require.Equal(t, map[string][]string{StreamStdout: {"out", "partial"}, StreamStderr: {"err"}}, texts)
+
+	lines, err = q.ReadLogs(job, time.Time{}, []string{StreamStderr})
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	require.Equal(t, "err", lines[0].Text)
+	require.Equal(t, StreamStderr, lines[0].Stream)
+
+	lines, err = q.ReadLogs(job, time.Time{}, []string{StreamStdout})
+	require.NoError(t, err)
+	require.Equal(t, []string{"out", "partial"}, []string{lines[0].Text, lines[1].Text})
+
+	lines, err = q.ReadLogs(job, time.Now(), nil)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	// output of jobs that weren't split can't be filtered
+	job.SplitOutput = false
+	_, err = q.ReadLogs(job, time.Time{}, []string{StreamStderr})
+	require.Error(t, err)
+	lines, err = q.ReadLogs(job, time.Time{}, nil)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+}
+
+func TestSchedulerSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+	s := NewScheduler(q, []int{}, locks, time.Second)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("hunter2\n"), 0600))
+	secret, err := ParseSecret("TOKEN=file:" + filepath.Join(dir, "token"))
+	require.NoError(t, err)
+	job, err := q.Submit(SubmitArgs{Command: "echo $TOKEN > out; echo the token is $TOKEN; printf $TOKEN >&2", Directory: dir, Secrets: []*Secret{secret}})
+	require.NoError(t, err)
+	missing, err := ParseSecret("TOKEN=env:KEEPSAKE_TEST_SECRET_THAT_ISNT_SET")
+	require.NoError(t, err)
+	failed, err := q.Submit(SubmitArgs{Command: "true", Directory: dir, Secrets: []*Secret{missing}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		require.NoError(t, s.Tick())
+		job, err = q.Job(job.ID)
+		require.NoError(t, err)
+		failed, err = q.Job(failed.ID)
+		require.NoError(t, err)
+		return job.IsDone() && failed.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, StatusSucceeded, job.Status)
+	out, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+	require.NoError(t, err)
+	require.Equal(t, "hunter2\n", string(out))
+	log, err := ioutil.ReadFile(q.LogPath(job))
+	require.NoError(t, err)
+	require.NotContains(t, string(log), "hunter2")
+	require.Contains(t, string(log), "the token is [REDACTED]")
+	jobJSON, err := ioutil.ReadFile(q.jobPath(job.ID))
+	require.NoError(t, err)
+	require.NotContains(t, string(jobJSON), "hunter2")
+
+	require.Equal(t, StatusFailed, failed.Status)
+	require.Contains(t, failed.Error, "KEEPSAKE_TEST_SECRET_THAT_ISNT_SET isn't set")
+
+	// jobs submitted by other users can't read the scheduler's secrets
+	job, err = q.Submit(SubmitArgs{Command: "echo $TOKEN > stolen", Directory: dir, Secrets: []*Secret{secret}})
+	require.NoError(t, err)
+	uid := os.Getuid()
+	currentUID = func() int { return uid + 1 }
+	defer func() { currentUID = os.Getuid }()
+	require.Eventually(t, func() bool {
+		require.NoError(t, s.Tick())
+		job, err = q.Job(job.ID)
+		require.NoError(t, err)
+		return job.IsDone()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, StatusFailed, job.Status)
+	require.Contains(t, job.Error, "was submitted by another user")
+	_, err = os.Stat(filepath.Join(dir, "stolen"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestParseSecret(t *testing.T) {
+	secret, err := ParseSecret("API_KEY=gcp:my-api-key")
+	require.NoError(t, err)
+	require.Equal(t, &Secret{Name: "API_KEY", Source: "gcp:my-api-key"}, secret)
+
+	defer func(f func(string, ...string) ([]byte, error)) { runSecretCommand = f }(runSecretCommand)
+	runSecretCommand = func(name string, args ...string) ([]byte, error) {
+		require.Equal(t, "gcloud", name)
+		require.Equal(t, "my-api-key", args[len(args)-1])
+		return []byte("s3cret\n"), nil
+	}
+	value, err := secret.Value()
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", value)
+
+	for _, s := range []string{"API_KEY", "API-KEY=env:FOO", "API_KEY=FOO", "API_KEY=vault:foo", "API_KEY=file:"} {
+		_, err := ParseSecret(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestParseGPUs(t *testing.T) {
+	gpus, err := ParseGPUs("3, 1,1")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3}, gpus)
+	require.Equal(t, "1,3", FormatGPUs(gpus))
+
+	_, err = ParseGPUs("a")
+	require.Error(t, err)
+}
+
+func TestNextJobsWithGPUIDsAndLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(dir)
+	require.NoError(t, err)
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+
+	// GPU 1 is held by another process
+	otherLocks, err := NewGPULocks(locks.dir)
+	require.NoError(t, err)
+	ok, err := otherLocks.Lock(1)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	jobs := []*Job{
+		{ID: "1jjjjjjjjj", Status: StatusQueued, NumGPUs: 1, GPUIDs: []int{5}},
+		{ID: "2jjjjjjjjj", Status: StatusQueued, NumGPUs: 2},
+		{ID: "3jjjjjjjjj", Status: StatusQueued, NumGPUs: 1, GPUIDs: []int{1}},
+	}
+	require.NoError(t, q.Save(jobs[0]))
+	s := NewScheduler(q, []int{0, 1, 2}, locks, time.Second)
+	next := s.nextJobs(jobs)
+	require.Len(t, next, 1)
+	require.Equal(t, "2jjjjjjjjj", next[0].job.ID)
+	require.Equal(t, []int{0, 2}, next[0].gpus)
+	require.Equal(t, StatusFailed, jobs[0].Status)
+	require.Contains(t, jobs[0].Error, "Job needs GPUs 5")
+
+	// once job 2 is running and GPU 1 is free, job 3 can run on it
+	require.NoError(t, otherLocks.Unlock(1))
+	jobs[1].Status = StatusRunning
+	jobs[1].GPUs = next[0].gpus
+	next = s.nextJobs(jobs)
+	require.Len(t, next, 1)
+	require.Equal(t, "3jjjjjjjjj", next[0].job.ID)
+	require.Equal(t, []int{1}, next[0].gpus)
+}
+
+func TestOrphanedJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+	locks, err := NewGPULocks(filepath.Join(dir, "locks"))
+	require.NoError(t, err)
+
+	// a job started by a scheduler that has exited, which is still running
+	cmd := exec.Command("sleep", "10")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+	started := time.Now().UTC()
+	running := &Job{ID: "1jjjjjjjjj", Status: StatusRunning, Command: "sleep 10", PID: cmd.Process.Pid, Started: &started, Attempts: []*Attempt{{Started: started}}}
+	require.NoError(t, q.Save(running))
+	// and one whose process has gone
+	exited := &Job{ID: "2jjjjjjjjj", Status: StatusRunning, Command: "true", Started: &started, Attempts: []*Attempt{{Started: started}}}
+	require.NoError(t, q.Save(exited))
+
+	s := NewScheduler(q, []int{}, locks, time.Second)
+	s.DryRun = true
+	require.NoError(t, s.failOrphanedJobs())
+	running, err = q.Job(running.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusRunning, running.Status)
+	exited, err = q.Job(exited.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, exited.Status)
+
+	// it is marked as failed once it exits
+	require.NoError(t, s.Tick())
+	running, err = q.Job(running.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusRunning, running.Status)
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+	require.NoError(t, s.Tick())
+	running, err = q.Job(running.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, running.Status)
+	require.Contains(t, running.Error, "exit code is unknown")
+}
+
+func TestGPULocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	locks, err := NewGPULocks(dir)
+	require.NoError(t, err)
+	otherLocks, err := NewGPULocks(dir)
+	require.NoError(t, err)
+	// so other users can't delete lock files
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.ModeSticky, info.Mode()&os.ModeSticky)
+
+	ok, err := locks.Lock(0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = otherLocks.Lock(0)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.True(t, otherLocks.LockedByOther(0))
+	require.False(t, locks.LockedByOther(0))
+
+	// only the holder can unlock
+	require.NoError(t, otherLocks.Unlock(0))
+	require.True(t, otherLocks.LockedByOther(0))
+	require.NoError(t, locks.Unlock(0))
+	ok, err = otherLocks.Lock(0)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// lock files left behind by processes that have exited aren't locked
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "gpu-3.lock"), []byte("999999999"), 0666))
+	require.False(t, locks.LockedByOther(3))
+	ok, err = locks.Lock(3)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// a process that is passed the lock file holds the lock until it exits
+	cmd := exec.Command("sleep", "10")
+	cmd.ExtraFiles = locks.Files([]int{3})
+	require.Len(t, cmd.ExtraFiles, 1)
+	require.NoError(t, cmd.Start())
+	require.NoError(t, locks.Unlock(3))
+	require.True(t, otherLocks.LockedByOther(3))
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+	require.False(t, otherLocks.LockedByOther(3))
+}
@@ -0,0 +1,581 @@
+package queue
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+// Scheduler runs queued jobs in the order they were submitted.
+//
+// If it has no GPUs, it runs one job at a time. Otherwise, each job gets the
+// number of GPUs it asked for, so several jobs can run at once. GPUs are
+// locked in locks while jobs run on them, and GPUs locked by other
+// processes are left alone.
+type Scheduler struct {
+	queue    *Queue
+	gpus     []int
+	locks    *GPULocks
+	interval time.Duration
+
+	// If DryRun is true, Tick prints what it would do instead of starting
+	// or failing jobs
+	DryRun bool
+
+	// If Output is set, the output of each job is also printed to a stream
+	// in it, prefixed with the job's ID
+	Output *console.Multiplexer
+
+	// processes of running jobs, keyed by job ID
+	processes map[string]*exec.Cmd
+	// IDs of running jobs that have been killed for taking too long
+	timedOut map[string]bool
+	// IDs of running jobs that have been sent SIGTERM
+	killed map[string]bool
+	// process groups of running jobs that were started by another
+	// scheduler, keyed by job ID
+	orphans map[string]int
+	// how long jobs have to exit after SIGTERM before they are sent SIGKILL
+	killGracePeriod time.Duration
+	mu              sync.Mutex
+}
+
+// DefaultKillGracePeriod is how long a cancelled or timed out job has to exit
+// after it is sent SIGTERM, before it is sent SIGKILL
+const DefaultKillGracePeriod = 10 * time.Second
+
+func NewScheduler(queue *Queue, gpus []int, locks *GPULocks, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		queue:           queue,
+		gpus:            gpus,
+		locks:           locks,
+		interval:        interval,
+		processes:       map[string]*exec.Cmd{},
+		timedOut:        map[string]bool{},
+		killed:          map[string]bool{},
+		orphans:         map[string]int{},
+		killGracePeriod: DefaultKillGracePeriod,
+	}
+}
+
+// Run schedules jobs forever
+func (s *Scheduler) Run() error {
+	if err := s.failOrphanedJobs(); err != nil {
+		return err
+	}
+	for {
+		if err := s.Tick(); err != nil {
+			console.Error("%v", err)
+		}
+		time.Sleep(s.interval)
+	}
+}
+
+// Tick kills cancelled jobs and starts any queued jobs that can now run
+func (s *Scheduler) Tick() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs, err := s.queue.Jobs()
+	if err != nil {
+		return err
+	}
+	if err := s.checkOrphans(jobs); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if _, ok := s.processes[job.ID]; !ok {
+			continue
+		}
+		if s.killed[job.ID] {
+			continue
+		}
+		if job.CancelRequested {
+			console.Info("Cancelling job %s", job.ShortID())
+			s.kill(job)
+		} else if attempt := job.CurrentAttempt(); attempt != nil && job.Timeout > 0 && time.Since(attempt.Started) > job.Timeout && !s.timedOut[job.ID] {
+			console.Info("Job %s has run for longer than its timeout of %s, killing it", job.ShortID(), job.Timeout)
+			s.timedOut[job.ID] = true
+			s.kill(job)
+		}
+	}
+
+	for _, next := range s.nextJobs(jobs) {
+		if s.DryRun {
+			if len(next.gpus) > 0 {
+				console.Info("Would start job %s on GPUs %s: %s", next.job.ShortID(), FormatGPUs(next.gpus), next.job.Command)
+			} else {
+				console.Info("Would start job %s: %s", next.job.ShortID(), next.job.Command)
+			}
+			continue
+		}
+		if err := s.start(next.job, next.gpus); err != nil {
+			console.Error("Failed to start job %s: %s", next.job.ShortID(), err)
+		}
+	}
+	return nil
+}
+
+// kill sends SIGTERM to a running job, then SIGKILL if it is still running
+// after the grace period
+func (s *Scheduler) kill(job *Job) {
+	cmd := s.processes[job.ID]
+	s.killed[job.ID] = true
+	// the job was started in its own process group, so this kills its children too
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		console.Warn("Failed to kill job %s: %s", job.ShortID(), err)
+	}
+	time.AfterFunc(s.killGracePeriod, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// wait() hasn't returned while any of the job's processes still have its output open
+		if s.processes[job.ID] != cmd {
+			return
+		}
+		console.Info("Job %s didn't exit within %s, sending SIGKILL", job.ShortID(), s.killGracePeriod)
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			console.Warn("Failed to kill job %s: %s", job.ShortID(), err)
+		}
+	})
+}
+
+type scheduledJob struct {
+	job  *Job
+	gpus []int
+}
+
+// nextJobs returns the queued jobs that can start now, with the GPUs they should use.
+// Jobs are started strictly in order, so a job that needs lots of GPUs isn't
+// starved by smaller jobs submitted after it.
+func (s *Scheduler) nextJobs(jobs []*Job) []scheduledJob {
+	numRunning := 0
+	usedGPUs := map[int]bool{}
+	for _, job := range jobs {
+		if job.Status == StatusRunning {
+			numRunning++
+			for _, gpu := range job.GPUs {
+				usedGPUs[gpu] = true
+			}
+		}
+	}
+	freeGPUs := []int{}
+	for _, gpu := range s.gpus {
+		if !usedGPUs[gpu] && !s.locks.LockedByOther(gpu) {
+			freeGPUs = append(freeGPUs, gpu)
+		}
+	}
+
+	next := []scheduledJob{}
+	for _, job := range jobs {
+		if job.Status != StatusQueued {
+			continue
+		}
+		if len(s.gpus) == 0 {
+			if numRunning > 0 {
+				break
+			}
+			next = append(next, scheduledJob{job: job})
+			numRunning++
+			continue
+		}
+		if msg := s.unschedulableReason(job); msg != "" {
+			// this can never run, so don't hold up the rest of the queue
+			if s.DryRun {
+				console.Info("Would fail job %s: %s", job.ShortID(), msg)
+				continue
+			}
+			job.Status = StatusFailed
+			job.Error = msg
+			if err := s.queue.Save(job); err != nil {
+				console.Error("%v", err)
+			}
+			continue
+		}
+		var gpus []int
+		if len(job.GPUIDs) > 0 {
+			if !containsAllGPUs(freeGPUs, job.GPUIDs) {
+				break
+			}
+			gpus = job.GPUIDs
+		} else {
+			if job.NumGPUs > len(freeGPUs) {
+				break
+			}
+			gpus = freeGPUs[:job.NumGPUs]
+		}
+		next = append(next, scheduledJob{job: job, gpus: gpus})
+		freeGPUs = removeGPUs(freeGPUs, gpus)
+	}
+	return next
+}
+
+// unschedulableReason returns why job can never run on this scheduler's GPUs, or "" if it can
+func (s *Scheduler) unschedulableReason(job *Job) string {
+	if len(job.GPUIDs) > 0 {
+		if !containsAllGPUs(s.gpus, job.GPUIDs) {
+			return fmt.Sprintf("Job needs GPUs %s, but the scheduler only has GPUs %s", FormatGPUs(job.GPUIDs), FormatGPUs(s.gpus))
+		}
+		return ""
+	}
+	if job.NumGPUs > len(s.gpus) {
+		return fmt.Sprintf("Job needs %d GPUs, but the scheduler only has %d", job.NumGPUs, len(s.gpus))
+	}
+	return ""
+}
+
+func containsAllGPUs(gpus []int, subset []int) bool {
+	for _, gpu := range subset {
+		if !containsGPU(gpus, gpu) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsGPU(gpus []int, gpu int) bool {
+	for _, g := range gpus {
+		if g == gpu {
+			return true
+		}
+	}
+	return false
+}
+
+func removeGPUs(gpus []int, remove []int) []int {
+	ret := []int{}
+	for _, gpu := range gpus {
+		if !containsGPU(remove, gpu) {
+			ret = append(ret, gpu)
+		}
+	}
+	return ret
+}
+
+func (s *Scheduler) start(job *Job, gpus []int) error {
+	// it might have been cancelled since the queue was listed
+	job, err := s.queue.Job(job.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != StatusQueued {
+		return nil
+	}
+	if ok, err := s.lockGPUs(gpus); err != nil || !ok {
+		// another process got there first, so try again next tick
+		return err
+	}
+
+	// if the secrets can't be read, the job fails in the same way as if its
+	// command couldn't be started
+	secretEnv, secretValues, secretErr := s.resolveJobSecrets(job)
+
+	stdout, stderr, logs, err := s.openLogs(job)
+	if err != nil {
+		s.unlockGPUs(gpus)
+		return err
+	}
+	cmd := exec.Command("/bin/sh", "-c", job.Command)
+	cmd.Dir = job.Directory
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if s.Output != nil {
+		stream := s.Output.Stream(job.ShortID())
+		logs = append(logs, stream)
+		cmd.Stdout = io.MultiWriter(stdout, stream)
+		cmd.Stderr = io.MultiWriter(stderr, stream.Stderr())
+	}
+	if len(secretValues) > 0 {
+		stdoutRedactor := newRedactingWriter(cmd.Stdout, secretValues)
+		stderrRedactor := newRedactingWriter(cmd.Stderr, secretValues)
+		cmd.Stdout = stdoutRedactor
+		cmd.Stderr = stderrRedactor
+		// closed first, so the end of the output is written before the logs are closed
+		logs = append([]io.Closer{stdoutRedactor, stderrRedactor}, logs...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// the job holds its GPU locks until it exits, even if the scheduler doesn't
+	cmd.ExtraFiles = s.locks.Files(gpus)
+	// lets the command know it has been retried, so it can resume from its latest checkpoint
+	cmd.Env = append(os.Environ(), fmt.Sprintf("KEEPSAKE_QUEUE_ATTEMPT=%d", len(job.Attempts)+1))
+	if len(s.gpus) > 0 {
+		cmd.Env = append(cmd.Env, "CUDA_VISIBLE_DEVICES="+FormatGPUs(gpus))
+	}
+	cmd.Env = append(cmd.Env, secretEnv...)
+
+	now := time.Now().UTC()
+	if job.Started == nil {
+		job.Started = &now
+	}
+	attempt := &Attempt{Started: now}
+	job.Attempts = append(job.Attempts, attempt)
+	err = secretErr
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		closeLogs(logs)
+		s.unlockGPUs(gpus)
+		job.Status = StatusFailed
+		job.Finished = &now
+		job.Error = err.Error()
+		attempt.Finished = &now
+		attempt.Error = err.Error()
+		return s.queue.Save(job)
+	}
+	if len(job.Attempts) > 1 {
+		console.Info("Started job %s (attempt %d): %s", job.ShortID(), len(job.Attempts), job.Command)
+	} else {
+		console.Info("Started job %s: %s", job.ShortID(), job.Command)
+	}
+	job.Status = StatusRunning
+	job.GPUs = gpus
+	job.PID = cmd.Process.Pid
+	if err := s.queue.Save(job); err != nil {
+		return err
+	}
+	s.processes[job.ID] = cmd
+
+	go s.wait(job, cmd, logs)
+	return nil
+}
+
+func (s *Scheduler) wait(job *Job, cmd *exec.Cmd, logs []io.Closer) {
+	waitErr := cmd.Wait()
+	closeLogs(logs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.processes, job.ID)
+	timedOut := s.timedOut[job.ID]
+	delete(s.timedOut, job.ID)
+	delete(s.killed, job.ID)
+	s.unlockGPUs(job.GPUs)
+
+	// pick up any cancellation requested while it was running
+	if saved, err := s.queue.Job(job.ID); err == nil {
+		job = saved
+	}
+	now := time.Now().UTC()
+	exitCode := cmd.ProcessState.ExitCode()
+	attempt := job.Attempts[len(job.Attempts)-1]
+	attempt.Finished = &now
+	attempt.ExitCode = &exitCode
+	attempt.TimedOut = timedOut
+	if waitErr != nil {
+		attempt.Error = waitErr.Error()
+	}
+	if timedOut {
+		attempt.Error = fmt.Sprintf("Timed out after %s", job.Timeout)
+	}
+
+	job.Finished = &now
+	job.ExitCode = &exitCode
+	job.Error = attempt.Error
+	switch {
+	case job.CancelRequested:
+		job.Status = StatusCancelled
+	case timedOut || waitErr != nil:
+		job.Status = StatusFailed
+		// jobs that time out aren't retried, because they would most likely time out again
+		if !timedOut && len(job.Attempts) <= job.Retries {
+			// Created is unchanged, so it goes back to the front of the queue
+			job.Status = StatusQueued
+			job.Finished = nil
+			job.GPUs = nil
+			job.PID = 0
+			console.Info("Job %s failed, retrying (%d of %d)", job.ShortID(), len(job.Attempts), job.Retries)
+		}
+	default:
+		job.Status = StatusSucceeded
+	}
+	if job.Status != StatusQueued {
+		console.Info("Job %s %s", job.ShortID(), job.Status)
+	}
+	if err := s.queue.Save(job); err != nil {
+		console.Error("%v", err)
+	}
+}
+
+// openLogs opens the files the stdout and stderr of job are written to, and
+// returns them with what needs closing once the job has finished. They are the
+// same file unless the job was submitted with SplitOutput.
+func (s *Scheduler) openLogs(job *Job) (stdout io.Writer, stderr io.Writer, logs []io.Closer, err error) {
+	if !job.SplitOutput {
+		logFile, err := openLog(s.queue.LogPath(job))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return logFile, logFile, []io.Closer{logFile}, nil
+	}
+	stdoutFile, err := openLog(s.queue.StreamLogPath(job, StreamStdout))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stderrFile, err := openLog(s.queue.StreamLogPath(job, StreamStderr))
+	if err != nil {
+		stdoutFile.Close()
+		return nil, nil, nil, err
+	}
+	stdoutWriter := newTimestampWriter(stdoutFile)
+	stderrWriter := newTimestampWriter(stderrFile)
+	return stdoutWriter, stderrWriter, []io.Closer{stdoutWriter, stderrWriter}, nil
+}
+
+func openLog(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create log file: %w", err)
+	}
+	return f, nil
+}
+
+func closeLogs(logs []io.Closer) {
+	for _, l := range logs {
+		if err := l.Close(); err != nil {
+			console.Warn("Failed to close log: %v", err)
+		}
+	}
+}
+
+// lockGPUs locks all of gpus, or none of them if any are locked by another process
+func (s *Scheduler) lockGPUs(gpus []int) (bool, error) {
+	for i, gpu := range gpus {
+		ok, err := s.locks.Lock(gpu)
+		if err != nil || !ok {
+			s.unlockGPUs(gpus[:i])
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *Scheduler) unlockGPUs(gpus []int) {
+	for _, gpu := range gpus {
+		if err := s.locks.Unlock(gpu); err != nil {
+			console.Warn("%v", err)
+		}
+	}
+}
+
+// failOrphanedJobs marks jobs as failed that were left running by a
+// scheduler that has since exited, if their processes have exited too. Jobs
+// that are still running are watched by checkOrphans until they exit.
+func (s *Scheduler) failOrphanedJobs() error {
+	jobs, err := s.queue.Jobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Status != StatusRunning {
+			continue
+		}
+		if s.jobIsAlive(job) {
+			console.Info("Job %s was started by another scheduler and is still running", job.ShortID())
+			s.orphans[job.ID] = job.PID
+			continue
+		}
+		if err := s.failOrphan(job, "The scheduler exited while this job was running"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOrphans marks jobs started by another scheduler as failed once their
+// processes have exited. Their exit codes can't be known, because they
+// aren't this process's children.
+func (s *Scheduler) checkOrphans(jobs []*Job) error {
+	for _, job := range jobs {
+		pid, ok := s.orphans[job.ID]
+		if !ok {
+			continue
+		}
+		// the scheduler that started it may still be running and have finished it
+		if job.Status != StatusRunning || job.PID != pid {
+			delete(s.orphans, job.ID)
+			continue
+		}
+		if s.jobIsAlive(job) {
+			continue
+		}
+		delete(s.orphans, job.ID)
+		if err := s.failOrphan(job, "The job exited after the scheduler that started it, so its exit code is unknown"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) failOrphan(job *Job, msg string) error {
+	now := time.Now().UTC()
+	job.Finished = &now
+	job.Error = msg
+	if attempt := job.CurrentAttempt(); attempt != nil {
+		attempt.Finished = &now
+		attempt.Error = job.Error
+	}
+	job.Status = StatusFailed
+	return s.queue.Save(job)
+}
+
+// jobIsAlive returns true if the process group of a job started by another
+// scheduler still exists and, if the job has GPUs, they are still locked.
+// The job's processes hold its GPU locks until they exit, so that catches
+// process groups whose ID has been reused.
+func (s *Scheduler) jobIsAlive(job *Job) bool {
+	if job.PID == 0 {
+		return false
+	}
+	// signal 0 only checks that the process group exists
+	if err := syscall.Kill(-job.PID, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	if len(job.GPUs) == 0 {
+		return true
+	}
+	for _, gpu := range job.GPUs {
+		if s.locks.LockedByOther(gpu) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGPUs parses a comma-separated list of GPU IDs, e.g. "0,1,3"
+func ParseGPUs(s string) ([]int, error) {
+	gpus := []int{}
+	if s == "" {
+		return gpus, nil
+	}
+	seen := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		gpu, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || gpu < 0 {
+			return nil, fmt.Errorf("Invalid GPU ID: %q", part)
+		}
+		if !seen[gpu] {
+			seen[gpu] = true
+			gpus = append(gpus, gpu)
+		}
+	}
+	sort.Ints(gpus)
+	return gpus, nil
+}
+
+// FormatGPUs formats GPU IDs as a comma-separated list, the inverse of ParseGPUs
+func FormatGPUs(gpus []int) string {
+	strs := []string{}
+	for _, gpu := range gpus {
+		strs = append(strs, strconv.Itoa(gpu))
+	}
+	return strings.Join(strs, ",")
+}
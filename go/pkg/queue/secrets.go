@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RedactedSecret replaces the values of secrets in the output of jobs
+const RedactedSecret = "[REDACTED]"
+
+var secretNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Secret is a value a job needs, like an API key, that is passed to its
+// command as an environment variable. Only where to get the value from is
+// saved with the job. The value is read when the job starts.
+//
+// Source is one of:
+// - env:<variable>: an environment variable of the scheduler
+// - file:<path>: the contents of a file, read by the scheduler, without trailing newlines
+// - gcp:<secret>: the latest version of a secret in Google Cloud Secret Manager, read with gcloud
+// - aws:<secret ID>: a secret in AWS Secrets Manager, read with the aws CLI
+type Secret struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// ParseSecret parses a secret in the form <name>=<source>
+func ParseSecret(s string) (*Secret, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || !secretNameRegexp.MatchString(parts[0]) {
+		return nil, fmt.Errorf("Invalid secret: %q. It must be in the form <environment variable>=<source>, e.g. API_KEY=env:API_KEY", s)
+	}
+	secret := &Secret{Name: parts[0], Source: parts[1]}
+	kind, location := secret.split()
+	switch kind {
+	case "env", "file", "gcp", "aws":
+	default:
+		return nil, fmt.Errorf("Invalid secret source: %q. It must start with env:, file:, gcp:, or aws:", secret.Source)
+	}
+	if location == "" {
+		return nil, fmt.Errorf("Invalid secret source: %q. It must say where to read the secret from after %s:", secret.Source, kind)
+	}
+	return secret, nil
+}
+
+// runSecretCommand runs a cloud provider's CLI to read a secret. It is a
+// variable so tests can replace it.
+var runSecretCommand = func(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Value reads the value of the secret from its source
+func (s *Secret) Value() (string, error) {
+	kind, location := s.split()
+	var value []byte
+	var err error
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(location)
+		if !ok {
+			return "", fmt.Errorf("Failed to read secret %s: the environment variable %s isn't set", s.Name, location)
+		}
+		return v, nil
+	case "file":
+		value, err = ioutil.ReadFile(location)
+	case "gcp":
+		value, err = runSecretCommand("gcloud", "secrets", "versions", "access", "latest", "--secret", location)
+	case "aws":
+		value, err = runSecretCommand("aws", "secretsmanager", "get-secret-value", "--secret-id", location, "--query", "SecretString", "--output", "text")
+	default:
+		return "", fmt.Errorf("Unknown secret source: %q", s.Source)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read secret %s from %s: %w", s.Name, s.Source, err)
+	}
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
+
+func (s *Secret) split() (kind string, location string) {
+	parts := strings.SplitN(s.Source, ":", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// resolveJobSecrets reads the values of job's secrets with resolveSecrets.
+// They are read with the scheduler's environment and permissions, so only
+// jobs submitted by the user the scheduler is running as can have secrets.
+// Redacting them only stops them being printed by accident; the job's command
+// can do anything it likes with them.
+func (s *Scheduler) resolveJobSecrets(job *Job) (env []string, values []string, err error) {
+	if len(job.Secrets) == 0 {
+		return nil, nil, nil
+	}
+	owned, err := s.queue.jobOwnedByCurrentUser(job.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !owned {
+		return nil, nil, fmt.Errorf("Job %s was submitted by another user, so it can't read secrets with the scheduler's environment and files", job.ShortID())
+	}
+	return resolveSecrets(job.Secrets)
+}
+
+// resolveSecrets reads the values of secrets, returning them as environment
+// variables, and as a list of values to redact from output
+func resolveSecrets(secrets []*Secret) (env []string, values []string, err error) {
+	for _, secret := range secrets {
+		value, err := secret.Value()
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(env, secret.Name+"="+value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return env, values, nil
+}
+
+// redactingWriter replaces secret values in each line written to it before
+// passing it on to w. Lines are passed on whole, so values aren't missed if
+// they are split across writes. Anything after the last newline is held
+// until the rest of the line is written, or it is closed.
+type redactingWriter struct {
+	w        io.Writer
+	replacer *strings.Replacer
+	mu       sync.Mutex
+	partial  bytes.Buffer
+}
+
+func newRedactingWriter(w io.Writer, values []string) *redactingWriter {
+	oldnew := []string{}
+	for _, v := range values {
+		oldnew = append(oldnew, v, RedactedSecret)
+	}
+	return &redactingWriter{w: w, replacer: strings.NewReplacer(oldnew...)}
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial.Write(p)
+	i := bytes.LastIndexByte(w.partial.Bytes(), '\n')
+	if i == -1 {
+		return len(p), nil
+	}
+	lines := string(w.partial.Next(i + 1))
+	if _, err := io.WriteString(w.w, w.replacer.Replace(lines)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.partial.Len() == 0 {
+		return nil
+	}
+	rest := w.partial.String()
+	w.partial.Reset()
+	_, err := io.WriteString(w.w, w.replacer.Replace(rest))
+	return err
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/hash"
+)
+
+// BucketOptions are the settings used when creating a bucket for a repository
+type BucketOptions struct {
+	// Region (S3) or location (Google Cloud Storage) to create the bucket in
+	Region string
+
+	// Default storage class of objects in the bucket. Only supported on Google
+	// Cloud Storage, because S3 sets storage classes per object.
+	StorageClass string
+}
+
+// CreateBucketIfNotExists creates the bucket (or directory, for disk repositories)
+// that repositoryURL is stored in, if it doesn't already exist
+func CreateBucketIfNotExists(repositoryURL string, projectDir string, opts BucketOptions) (created bool, err error) {
+	scheme, bucket, root, err := SplitURL(repositoryURL)
+	if err != nil {
+		return false, err
+	}
+	switch scheme {
+	case SchemeDisk:
+		if !filepath.IsAbs(root) {
+			root = path.Join(projectDir, root)
+		}
+		if _, err := os.Stat(root); err == nil {
+			return false, nil
+		}
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return false, errors.WriteError(fmt.Sprintf("Failed to create directory %s: %v", root, err))
+		}
+		return true, nil
+	case SchemeS3:
+		if opts.StorageClass != "" {
+			return false, fmt.Errorf("Storage classes can't be set on S3 buckets, because S3 sets them per object. Use a lifecycle rule to transition objects to a different storage class instead.")
+		}
+		return CreateS3BucketIfNotExists(opts.Region, bucket)
+	case SchemeGCS:
+		repo, err := NewGCSRepository(bucket, root)
+		if err != nil {
+			return false, err
+		}
+		return repo.CreateBucketIfNotExists(opts.Region, opts.StorageClass)
+	}
+	return false, unknownRepositoryScheme(string(scheme))
+}
+
+// VerifyAccess checks that repo can be written to, read from, and deleted from,
+// by doing all three to a temporary file
+func VerifyAccess(repo Repository) error {
+	checkPath := "access-check/" + hash.Random() + ".txt"
+	data := []byte("This file was written by Keepsake to check it can access the repository. It is safe to delete.")
+
+	if err := repo.Put(checkPath, data); err != nil {
+		return fmt.Errorf("Failed to write to %s: %w", repo.RootURL(), err)
+	}
+	readData, err := repo.Get(checkPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read from %s: %w", repo.RootURL(), err)
+	}
+	if !bytes.Equal(readData, data) {
+		return fmt.Errorf("Data read from %s/%s does not match what was written to it", repo.RootURL(), checkPath)
+	}
+	if err := repo.Delete(checkPath); err != nil {
+		return fmt.Errorf("Failed to delete from %s: %w", repo.RootURL(), err)
+	}
+	return nil
+}
@@ -1,11 +1,20 @@
 package repository
 
 import (
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/files"
 )
 
+// metadataCacheVersion is the format of the metadata cache. Increment it if
+// the cache is changed so older versions of Keepsake can't read it, and it is
+// emptied and synced again.
+const metadataCacheVersion = 1
+
 // CachedRepository wraps another repository, caching a prefix in a local directory.
 //
 // SyncCache() syncs cachePrefix locally, which you must call before doing any
@@ -13,16 +22,24 @@ import (
 // syncing.
 //
 // If a read hits a path starting with cachePrefix, it will use the local cached version.
+//
+// Other processes might be using the cache at the same time, e.g. the daemon
+// of an experiment that is running while "keepsake ls" syncs the cache, so
+// it is locked while it is read or changed.
 type CachedRepository struct {
 	repository      Repository
 	cachePrefix     string
 	cacheDir        string
+	cache           *files.Cache
 	cacheRepository *DiskRepository
 	isSynced        bool
 }
 
 func NewCachedRepository(repo Repository, cachePrefix string, projectDir string, cacheDir string) (*CachedRepository, error) {
-	// This doesn't actually return an error, but catch in case of future errors
+	cache, err := files.OpenCache(cacheDir, metadataCacheVersion)
+	if err != nil {
+		return nil, err
+	}
 	cacheRepository, err := NewDiskRepository(cacheDir)
 	if err != nil {
 		return nil, err
@@ -31,6 +48,7 @@ func NewCachedRepository(repo Repository, cachePrefix string, projectDir string,
 		repository:      repo,
 		cachePrefix:     cachePrefix,
 		cacheDir:        cacheDir,
+		cache:           cache,
 		cacheRepository: cacheRepository,
 		isSynced:        false,
 	}, nil
@@ -39,20 +57,38 @@ func NewCachedRepository(repo Repository, cachePrefix string, projectDir string,
 // NewCachedMetadataRepository returns a CachedRepository that caches the metadata/ path in
 // .keepsake/metadata-cache in a source dir
 func NewCachedMetadataRepository(projectDir string, repo Repository) (*CachedRepository, error) {
-	return NewCachedRepository(repo, "metadata", projectDir, ".keepsake/metadata-cache")
+	return NewCachedRepository(repo, "metadata", projectDir, path.Join(projectDir, ".keepsake/metadata-cache"))
 }
 
 func (s *CachedRepository) Get(p string) ([]byte, error) {
 	if strings.HasPrefix(p, s.cachePrefix) {
-		return s.cacheRepository.Get(p)
+		var data []byte
+		err := s.withCacheLock(false, func() (err error) {
+			data, err = s.cacheRepository.Get(p)
+			return err
+		})
+		return data, err
 	}
 	return s.repository.Get(p)
 }
 
+// Exists returns true if there is a file at p
+func (s *CachedRepository) Exists(p string) (bool, error) {
+	if strings.HasPrefix(p, s.cachePrefix) {
+		var found bool
+		err := s.withCacheLock(false, func() (err error) {
+			found, err = s.cacheRepository.Exists(p)
+			return err
+		})
+		return found, err
+	}
+	return exists(s.repository, p)
+}
+
 func (s *CachedRepository) Put(p string, data []byte) error {
 	// FIXME: potential for cache and remote to get out of sync on error
 	if strings.HasPrefix(p, s.cachePrefix) {
-		if err := s.cacheRepository.Put(p, data); err != nil {
+		if err := s.withCacheLock(true, func() error { return s.cacheRepository.Put(p, data) }); err != nil {
 			return err
 		}
 	}
@@ -61,21 +97,21 @@ func (s *CachedRepository) Put(p string, data []byte) error {
 
 func (s *CachedRepository) GetPath(repoPath string, localPath string) error {
 	if strings.HasPrefix(repoPath, s.cachePrefix) {
-		return s.cacheRepository.GetPath(repoPath, localPath)
+		return s.withCacheLock(false, func() error { return s.cacheRepository.GetPath(repoPath, localPath) })
 	}
 	return s.repository.GetPath(repoPath, localPath)
 }
 
 func (s *CachedRepository) GetPathTar(tarPath, localPath string) error {
 	if strings.HasPrefix(tarPath, s.cachePrefix) {
-		return s.cacheRepository.GetPathTar(tarPath, localPath)
+		return s.withCacheLock(false, func() error { return s.cacheRepository.GetPathTar(tarPath, localPath) })
 	}
 	return s.repository.GetPathTar(tarPath, localPath)
 }
 
 func (s *CachedRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
 	if strings.HasPrefix(tarPath, s.cachePrefix) {
-		return s.cacheRepository.GetPathTar(tarPath, localPath)
+		return s.withCacheLock(false, func() error { return s.cacheRepository.GetPathTar(tarPath, localPath) })
 	}
 	return s.repository.GetPathItemTar(tarPath, itemPath, localPath)
 }
@@ -83,7 +119,7 @@ func (s *CachedRepository) GetPathItemTar(tarPath, itemPath, localPath string) e
 func (s *CachedRepository) PutPath(localPath string, repoPath string) error {
 	// FIXME: potential for cache and remote to get out of sync on error
 	if strings.HasPrefix(repoPath, s.cachePrefix) {
-		if err := s.cacheRepository.PutPath(localPath, repoPath); err != nil {
+		if err := s.withCacheLock(true, func() error { return s.cacheRepository.PutPath(localPath, repoPath) }); err != nil {
 			return err
 		}
 	}
@@ -94,7 +130,7 @@ func (s *CachedRepository) PutPath(localPath string, repoPath string) error {
 func (s *CachedRepository) PutPathTar(localPath, tarPath, includePath string) error {
 	// FIXME: potential for cache and remote to get out of sync on error
 	if strings.HasPrefix(tarPath, s.cachePrefix) {
-		if err := s.cacheRepository.PutPathTar(localPath, tarPath, includePath); err != nil {
+		if err := s.withCacheLock(true, func() error { return s.cacheRepository.PutPathTar(localPath, tarPath, includePath) }); err != nil {
 			return err
 		}
 	}
@@ -103,21 +139,31 @@ func (s *CachedRepository) PutPathTar(localPath, tarPath, includePath string) er
 
 func (s *CachedRepository) List(p string) ([]string, error) {
 	if strings.HasPrefix(p, s.cachePrefix) {
-		return s.cacheRepository.List(p)
+		var paths []string
+		err := s.withCacheLock(false, func() (err error) {
+			paths, err = s.cacheRepository.List(p)
+			return err
+		})
+		return paths, err
 	}
 	return s.repository.List(p)
 }
 
 func (s *CachedRepository) ListTarFile(p string) ([]string, error) {
 	if strings.HasPrefix(p, s.cachePrefix) {
-		return s.cacheRepository.List(p)
+		var paths []string
+		err := s.withCacheLock(false, func() (err error) {
+			paths, err = s.cacheRepository.List(p)
+			return err
+		})
+		return paths, err
 	}
 	return s.repository.ListTarFile(p)
 }
 
 func (s *CachedRepository) ListRecursive(results chan<- ListResult, path string) {
 	if strings.HasPrefix(path, s.cachePrefix) {
-		s.cacheRepository.ListRecursive(results, path)
+		s.listCached(results, func(cached chan<- ListResult) { s.cacheRepository.ListRecursive(cached, path) })
 		return
 	}
 	s.repository.ListRecursive(results, path)
@@ -125,7 +171,7 @@ func (s *CachedRepository) ListRecursive(results chan<- ListResult, path string)
 
 func (s *CachedRepository) MatchFilenamesRecursive(results chan<- ListResult, path string, filename string) {
 	if strings.HasPrefix(path, s.cachePrefix) {
-		s.cacheRepository.MatchFilenamesRecursive(results, path, filename)
+		s.listCached(results, func(cached chan<- ListResult) { s.cacheRepository.MatchFilenamesRecursive(cached, path, filename) })
 		return
 	}
 	s.repository.MatchFilenamesRecursive(results, path, filename)
@@ -133,18 +179,109 @@ func (s *CachedRepository) MatchFilenamesRecursive(results chan<- ListResult, pa
 
 func (s *CachedRepository) Delete(p string) error {
 	if strings.HasPrefix(p, s.cachePrefix) {
-		if err := s.cacheRepository.Delete(p); err != nil {
+		if err := s.withCacheLock(true, func() error { return s.cacheRepository.Delete(p) }); err != nil {
 			return err
 		}
 	}
 	return s.repository.Delete(p)
 }
 
+// withCacheLock calls fn while holding a lock on the cache, which is
+// exclusive if fn changes it
+func (s *CachedRepository) withCacheLock(exclusive bool, fn func() error) error {
+	lock, err := s.cache.Lock(exclusive)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+// listCached sends the results of list to results. They are all read while
+// holding a lock on the cache, before any are sent, so the cache isn't
+// locked while the caller handles them, which might involve writing to it.
+func (s *CachedRepository) listCached(results chan<- ListResult, list func(chan<- ListResult)) {
+	cached := []ListResult{}
+	err := s.withCacheLock(false, func() error {
+		ch := make(chan ListResult)
+		go list(ch)
+		for result := range ch {
+			cached = append(cached, result)
+		}
+		return nil
+	})
+	if err != nil {
+		cached = append(cached, ListResult{Error: err})
+	}
+	for _, result := range cached {
+		results <- result
+	}
+	close(results)
+}
+
+// FindCachedRepository returns the CachedRepository that repo is, or wraps
+// with a DryRunRepository, ReadOnlyRepository or WriteOnceRepository, or nil
+// if it isn't cached
+func FindCachedRepository(repo Repository) *CachedRepository {
+	for {
+		switch r := repo.(type) {
+		case *CachedRepository:
+			return r
+		case *DryRunRepository:
+			repo = r.Repository
+		case *ReadOnlyRepository:
+			repo = r.Repository
+		case *WriteOnceRepository:
+			repo = r.Repository
+		default:
+			return nil
+		}
+	}
+}
+
 func (s *CachedRepository) RootURL() string {
 	return s.repository.RootURL()
 }
 
+// SyncCache syncs the cache with the repository. Other processes can't read
+// the cache until it has finished, so they don't see it half synced.
 func (s *CachedRepository) SyncCache() error {
 	console.Debug("Syncing %s/%s to %s/%s", s.repository.RootURL(), s.cachePrefix, s.cacheRepository.RootURL(), s.cachePrefix)
-	return Sync(s.repository, s.cachePrefix, s.cacheRepository, s.cachePrefix)
+	return s.withCacheLock(true, func() error {
+		return Sync(s.repository, s.cachePrefix, s.cacheRepository, s.cachePrefix)
+	})
+}
+
+// ModTime returns when the object at p was last written, by the clock of the
+// storage it is in, or the zero time if the storage doesn't say. Metadata
+// that is cached locally is looked up in the repository it is cached from, so
+// this is when it was written there, not when it was cached.
+func ModTime(repo Repository, p string) (time.Time, error) {
+	if cachedRepo := FindCachedRepository(repo); cachedRepo != nil {
+		repo = cachedRepo.repository
+	}
+	p = path.Clean(p)
+	results := make(chan ListResult)
+	go repo.ListRecursive(results, path.Dir(p))
+	var modified time.Time
+	var listErr error
+	// drain the channel so ListRecursive doesn't block
+	for result := range results {
+		if result.Error != nil {
+			listErr = result.Error
+		} else if filepath.ToSlash(result.Path) == p {
+			modified = result.Modified
+		}
+	}
+	return modified, listErr
+}
+
+// GetFresh is Get, except that metadata that is cached locally is read from
+// the repository it is cached from, for objects that other machines write
+// and that have to be seen as soon as they are written
+func GetFresh(repo Repository, p string) ([]byte, error) {
+	if cachedRepo := FindCachedRepository(repo); cachedRepo != nil {
+		return cachedRepo.repository.Get(p)
+	}
+	return repo.Get(p)
 }
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Kinds of failure that ChaosRepository injects
+const (
+	// ChaosTimeout is a request that times out. Writes time out after they
+	// have succeeded half the time, like a response that is lost.
+	ChaosTimeout = "timeout"
+	// ChaosServerError is a 503 Service Unavailable response
+	ChaosServerError = "5xx"
+	// ChaosPartialRead is a download that ends before all the data is read
+	ChaosPartialRead = "partial"
+)
+
+var chaosFailures = []string{ChaosTimeout, ChaosServerError, ChaosPartialRead}
+
+// ChaosOptions configures the failures injected by ChaosRepository
+type ChaosOptions struct {
+	// Rate is the fraction of operations, between 0 and 1, that fail
+	Rate float64
+	// Failures are the kinds of failures to inject. Default: all of them
+	Failures []string
+	// Seed makes the failures happen in the same order every time. If it
+	// is 0, they are different every time.
+	Seed int64
+}
+
+// ParseChaosOptions parses the KEEPSAKE_CHAOS_RATE, KEEPSAKE_CHAOS_FAILURES,
+// and KEEPSAKE_CHAOS_SEED environment variables. It returns nil if rate is
+// empty, so nothing is injected.
+func ParseChaosOptions(rate string, failures string, seed string) (*ChaosOptions, error) {
+	if rate == "" {
+		return nil, nil
+	}
+	opts := &ChaosOptions{}
+	var err error
+	opts.Rate, err = strconv.ParseFloat(rate, 64)
+	if err != nil || opts.Rate < 0 || opts.Rate > 1 {
+		return nil, fmt.Errorf("KEEPSAKE_CHAOS_RATE must be a number between 0 and 1, not %q", rate)
+	}
+	if failures != "" {
+		for _, failure := range strings.Split(failures, ",") {
+			failure = strings.TrimSpace(failure)
+			if !isChaosFailure(failure) {
+				return nil, fmt.Errorf("Unknown failure %q in KEEPSAKE_CHAOS_FAILURES. It can be %s.", failure, strings.Join(chaosFailures, ", "))
+			}
+			opts.Failures = append(opts.Failures, failure)
+		}
+	}
+	if seed != "" {
+		opts.Seed, err = strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("KEEPSAKE_CHAOS_SEED must be an integer, not %q", seed)
+		}
+	}
+	return opts, nil
+}
+
+func isChaosFailure(failure string) bool {
+	for _, f := range chaosFailures {
+		if f == failure {
+			return true
+		}
+	}
+	return false
+}
+
+// ChaosRepository wraps a repository, making a fraction of operations fail
+// with timeouts, server errors, and partial reads, to check that retries and
+// interrupted transfers are handled properly. The errors are the ones the
+// real failures would cause.
+type ChaosRepository struct {
+	Repository
+	opts ChaosOptions
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewChaosRepository(repo Repository, opts ChaosOptions) *ChaosRepository {
+	if len(opts.Failures) == 0 {
+		opts.Failures = chaosFailures
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &ChaosRepository{Repository: repo, opts: opts, rand: rand.New(rand.NewSource(seed))}
+}
+
+// failure returns the kind of failure to inject into an operation, or "" if
+// it should succeed. Partial reads only happen to reads.
+func (s *ChaosRepository) failure(read bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rand.Float64() >= s.opts.Rate {
+		return ""
+	}
+	candidates := []string{}
+	for _, f := range s.opts.Failures {
+		if f != ChaosPartialRead || read {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[s.rand.Intn(len(candidates))]
+}
+
+func (s *ChaosRepository) coinFlip() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Intn(2) == 0
+}
+
+func chaosError(failure string, op string, p string, newError func(cause error, format string, a ...interface{}) error) error {
+	switch failure {
+	case ChaosTimeout:
+		return newError(context.DeadlineExceeded, "Failed to %s %s: %v (injected)", op, p, context.DeadlineExceeded)
+	case ChaosServerError:
+		cause := &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "Service Unavailable"}
+		return newError(cause, "Failed to %s %s: %v (injected)", op, p, cause)
+	case ChaosPartialRead:
+		return newError(io.ErrUnexpectedEOF, "Failed to %s %s: %v (injected)", op, p, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// read runs a read operation, unless a failure is injected instead
+func (s *ChaosRepository) read(op string, p string, fn func() error) error {
+	if failure := s.failure(true); failure != "" {
+		return chaosError(failure, op, p, readError)
+	}
+	return fn()
+}
+
+// write runs a write operation, unless a failure is injected instead. A
+// timeout happens after the operation half the time.
+func (s *ChaosRepository) write(op string, p string, fn func() error) error {
+	failure := s.failure(false)
+	if failure == "" {
+		return fn()
+	}
+	if failure == ChaosTimeout && s.coinFlip() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return chaosError(failure, op, p, writeError)
+}
+
+func (s *ChaosRepository) Get(p string) ([]byte, error) {
+	var data []byte
+	err := s.read("read", p, func() error {
+		var err error
+		data, err = s.Repository.Get(p)
+		return err
+	})
+	return data, err
+}
+
+func (s *ChaosRepository) GetPath(repoPath, localPath string) error {
+	return s.read("download", repoPath, func() error { return s.Repository.GetPath(repoPath, localPath) })
+}
+
+func (s *ChaosRepository) GetPathTar(tarPath, localPath string) error {
+	return s.read("download", tarPath, func() error { return s.Repository.GetPathTar(tarPath, localPath) })
+}
+
+func (s *ChaosRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	return s.read("download", tarPath, func() error { return s.Repository.GetPathItemTar(tarPath, itemPath, localPath) })
+}
+
+func (s *ChaosRepository) ListTarFile(tarPath string) ([]string, error) {
+	var files []string
+	err := s.read("read", tarPath, func() error {
+		var err error
+		files, err = s.Repository.ListTarFile(tarPath)
+		return err
+	})
+	return files, err
+}
+
+func (s *ChaosRepository) List(p string) ([]string, error) {
+	var paths []string
+	err := s.read("list", p, func() error {
+		var err error
+		paths, err = s.Repository.List(p)
+		return err
+	})
+	return paths, err
+}
+
+func (s *ChaosRepository) Put(p string, data []byte) error {
+	return s.write("write", p, func() error { return s.Repository.Put(p, data) })
+}
+
+func (s *ChaosRepository) PutPath(localPath, repoPath string) error {
+	return s.write("upload", repoPath, func() error { return s.Repository.PutPath(localPath, repoPath) })
+}
+
+func (s *ChaosRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	return s.write("upload", tarPath, func() error { return s.Repository.PutPathTar(localPath, tarPath, includePath) })
+}
+
+func (s *ChaosRepository) Delete(p string) error {
+	return s.write("delete", p, func() error { return s.Repository.Delete(p) })
+}
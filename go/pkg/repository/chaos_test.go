@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestParseChaosOptions(t *testing.T) {
+	opts, err := ParseChaosOptions("", "timeout", "1")
+	require.NoError(t, err)
+	require.Nil(t, opts)
+
+	opts, err = ParseChaosOptions("0.1", "timeout, 5xx", "42")
+	require.NoError(t, err)
+	require.Equal(t, &ChaosOptions{Rate: 0.1, Failures: []string{ChaosTimeout, ChaosServerError}, Seed: 42}, opts)
+
+	_, err = ParseChaosOptions("2", "", "")
+	require.Error(t, err)
+	_, err = ParseChaosOptions("0.1", "meteor", "")
+	require.Error(t, err)
+	_, err = ParseChaosOptions("0.1", "", "abc")
+	require.Error(t, err)
+}
+
+func TestChaosRepositoryFailures(t *testing.T) {
+	for _, tt := range []struct {
+		failure   string
+		retryable bool
+	}{
+		{ChaosTimeout, true},
+		{ChaosServerError, true},
+		{ChaosPartialRead, false},
+	} {
+		memoryRepo := NewMemoryRepository()
+		require.NoError(t, memoryRepo.Put("data", []byte("hello")))
+		repo := NewChaosRepository(memoryRepo, ChaosOptions{Rate: 1, Failures: []string{tt.failure}, Seed: 1})
+
+		_, err := repo.Get("data")
+		require.Error(t, err, tt.failure)
+		require.Equal(t, tt.retryable, errors.IsRetryable(err), tt.failure)
+
+		err = repo.Put("data", []byte("hello"))
+		if tt.failure == ChaosPartialRead {
+			// only reads can be partial
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err, tt.failure)
+			require.True(t, errors.IsRetryable(err), tt.failure)
+		}
+	}
+}
+
+func TestChaosRepositoryRetries(t *testing.T) {
+	transferRetryDelay = 0
+	memoryRepo := NewMemoryRepository()
+	chaosRepo := NewChaosRepository(memoryRepo, ChaosOptions{Rate: 0.3, Failures: []string{ChaosTimeout, ChaosServerError}, Seed: 1})
+	manifest := new(bytes.Buffer)
+	repo := NewTransferLogRepository(chaosRepo, manifest)
+
+	for i := 0; i < 50; i++ {
+		p := fmt.Sprintf("data/%d", i)
+		require.NoError(t, repo.Put(p, []byte(p)))
+		data, err := repo.Get(p)
+		require.NoError(t, err)
+		require.Equal(t, p, string(data))
+	}
+
+	retries := 0
+	for _, record := range readTransferRecords(t, manifest) {
+		retries += record.Retries
+	}
+	require.True(t, retries > 0, "no failures were injected")
+}
@@ -39,10 +39,29 @@ func (s *DiskRepository) Get(path string) ([]byte, error) {
 	return data, err
 }
 
+// Exists returns true if there is a file at path
+func (s *DiskRepository) Exists(path string) (bool, error) {
+	info, err := os.Stat(pathpkg.Join(s.rootDir, path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, readError(err, "Failed to read %s: %v", path, err)
+	}
+	return !info.IsDir(), nil
+}
+
 // GetPath recursively copies repoDir to localDir
 func (s *DiskRepository) GetPath(repoDir string, localDir string) error {
+	size, err := localSize(pathpkg.Join(s.rootDir, repoDir))
+	if err != nil {
+		return readError(err, "Failed to read %s: %v", repoDir, err)
+	}
+	if err := CheckDiskSpace(localDir, size, pathpkg.Join(s.rootDir, repoDir)); err != nil {
+		return err
+	}
 	if err := copy.Copy(pathpkg.Join(s.rootDir, repoDir), localDir); err != nil {
-		return errors.ReadError(fmt.Sprintf("Failed to copy directory from %s to %s: %v", repoDir, localDir, err))
+		return readError(err, "Failed to copy directory from %s to %s: %v", repoDir, localDir, err)
 	}
 	return nil
 }
@@ -82,10 +101,10 @@ func (s *DiskRepository) Put(path string, data []byte) error {
 	fullPath := pathpkg.Join(s.rootDir, path)
 	err := os.MkdirAll(filepath.Dir(fullPath), 0755)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	if err := ioutil.WriteFile(fullPath, data, 0644); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
@@ -94,16 +113,16 @@ func (s *DiskRepository) Put(path string, data []byte) error {
 func (s *DiskRepository) PutPath(localPath string, repoPath string) error {
 	files, err := getListOfFilesToPut(localPath, repoPath)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	for _, file := range files {
 		data, err := ioutil.ReadFile(file.Source)
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return writeError(err, "%v", err)
 		}
 		err = s.Put(file.Dest, data)
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return writeError(err, "%v", err)
 		}
 	}
 	return nil
@@ -121,12 +140,12 @@ func (s *DiskRepository) PutPathTar(localPath, tarPath, includePath string) erro
 	fullPath := pathpkg.Join(s.rootDir, tarPath)
 	err := os.MkdirAll(filepath.Dir(fullPath), 0755)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 
 	tarFile, err := os.Create(fullPath)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	defer tarFile.Close()
 
@@ -136,7 +155,7 @@ func (s *DiskRepository) PutPathTar(localPath, tarPath, includePath string) erro
 
 	// Explicitly call Close() on success to capture error
 	if err := tarFile.Close(); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
@@ -145,7 +164,7 @@ func (s *DiskRepository) PutPathTar(localPath, tarPath, includePath string) erro
 // all everything under path
 func (s *DiskRepository) Delete(pathToDelete string) error {
 	if err := os.RemoveAll(pathpkg.Join(s.rootDir, pathToDelete)); err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to delete %s/%s: %v", s.rootDir, pathToDelete, err))
+		return writeError(err, "Failed to delete %s/%s: %v", s.rootDir, pathToDelete, err)
 	}
 	return nil
 }
@@ -161,7 +180,7 @@ func (s *DiskRepository) List(path string) ([]string, error) {
 		if os.IsNotExist(err) {
 			return []string{}, nil
 		}
-		return nil, errors.ReadError(err.Error())
+		return nil, readError(err, "%v", err)
 	}
 	result := []string{}
 	for _, f := range files {
@@ -210,7 +229,7 @@ func (s *DiskRepository) ListRecursive(results chan<- ListResult, folder string)
 			if err != nil {
 				return err
 			}
-			results <- ListResult{Path: relPath, MD5: md5sum}
+			results <- ListResult{Path: relPath, MD5: md5sum, Size: info.Size(), Modified: info.ModTime()}
 		}
 		return nil
 	})
@@ -221,7 +240,7 @@ func (s *DiskRepository) ListRecursive(results chan<- ListResult, folder string)
 			close(results)
 			return
 		}
-		results <- ListResult{Error: errors.ReadError(err.Error())}
+		results <- ListResult{Error: readError(err, "%v", err)}
 	}
 	close(results)
 }
@@ -248,7 +267,7 @@ func (s *DiskRepository) MatchFilenamesRecursive(results chan<- ListResult, fold
 			return
 		}
 
-		results <- ListResult{Error: errors.ReadError(err.Error())}
+		results <- ListResult{Error: readError(err, "%v", err)}
 	}
 	close(results)
 }
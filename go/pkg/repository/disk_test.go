@@ -6,6 +6,7 @@ import (
 	"path"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -239,10 +240,14 @@ func TestDiskListRecursive(t *testing.T) {
 	require.NoError(t, repository.Put("experiments/def456.json", []byte("nope")))
 	results = make(chan ListResult)
 	go repository.ListRecursive(results, "checkpoints")
+	result := <-results
+	require.WithinDuration(t, time.Now(), result.Modified, time.Minute)
 	require.Equal(t, ListResult{
-		Path: "checkpoints/abc123.json",
-		MD5:  []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
-	}, <-results)
+		Path:     "checkpoints/abc123.json",
+		MD5:      []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
+		Size:     3,
+		Modified: result.Modified,
+	}, result)
 	require.Empty(t, <-results)
 }
 
@@ -259,3 +264,31 @@ func TestDiskMatchFilenamesRecursive(t *testing.T) {
 	v := <-results
 	require.Empty(t, v)
 }
+
+func TestModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewDiskRepository(path.Join(dir, "repository"))
+	require.NoError(t, err)
+	require.NoError(t, repo.Put("metadata/heartbeats/abc.json", []byte("{}")))
+	written := time.Now().Add(-time.Hour).Round(time.Second)
+	require.NoError(t, os.Chtimes(path.Join(dir, "repository/metadata/heartbeats/abc.json"), written, written))
+
+	modified, err := ModTime(repo, "metadata/heartbeats/abc.json")
+	require.NoError(t, err)
+	require.True(t, written.Equal(modified))
+
+	// it is when the object was written to the repository, not when it was
+	// cached
+	cachedRepo, err := NewCachedRepository(repo, "metadata", dir, path.Join(dir, "cache"))
+	require.NoError(t, err)
+	require.NoError(t, cachedRepo.SyncCache())
+	modified, err = ModTime(NewReadOnlyRepository(cachedRepo), "metadata/heartbeats/abc.json")
+	require.NoError(t, err)
+	require.True(t, written.Equal(modified))
+
+	modified, err = ModTime(repo, "metadata/heartbeats/does-not-exist.json")
+	require.NoError(t, err)
+	require.True(t, modified.IsZero())
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// DryRunRepository wraps a repository, reading from it as usual, but printing
+// what would be written or deleted instead of doing it. Data that would be
+// written with Put is kept in memory, and what would be deleted is hidden, so
+// later reads of metadata in the same dry run see the repository as it would
+// be. Files put with PutPath and PutPathTar aren't kept, because they can be
+// bigger than memory.
+type DryRunRepository struct {
+	Repository
+
+	overlay *MemoryRepository
+
+	mu      sync.Mutex
+	deleted []string
+}
+
+func NewDryRunRepository(repo Repository) *DryRunRepository {
+	return &DryRunRepository{Repository: repo, overlay: NewMemoryRepository()}
+}
+
+// isDeleted returns true if p would have been deleted, and not written since
+func (s *DryRunRepository) isDeleted(p string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryKey(p)
+	for _, prefix := range s.deleted {
+		if isUnderPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// inOverlay returns true if p would have been written
+func (s *DryRunRepository) inOverlay(p string) bool {
+	s.overlay.mu.RLock()
+	defer s.overlay.mu.RUnlock()
+	_, ok := s.overlay.objects[memoryKey(p)]
+	return ok
+}
+
+func (s *DryRunRepository) Get(p string) ([]byte, error) {
+	if s.inOverlay(p) {
+		return s.overlay.Get(p)
+	}
+	if s.isDeleted(p) {
+		return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %v", p))
+	}
+	return s.Repository.Get(p)
+}
+
+func (s *DryRunRepository) GetPath(repoPath, localPath string) error {
+	if !s.isDeleted(repoPath) {
+		if err := s.Repository.GetPath(repoPath, localPath); err != nil {
+			return err
+		}
+	}
+	return s.overlay.GetPath(repoPath, localPath)
+}
+
+func (s *DryRunRepository) GetPathTar(tarPath, localPath string) error {
+	if s.inOverlay(tarPath) {
+		return s.overlay.GetPathTar(tarPath, localPath)
+	}
+	if s.isDeleted(tarPath) {
+		return errors.DoesNotExist("Path does not exist: " + tarPath)
+	}
+	return s.Repository.GetPathTar(tarPath, localPath)
+}
+
+func (s *DryRunRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	if s.inOverlay(tarPath) {
+		return s.overlay.GetPathItemTar(tarPath, itemPath, localPath)
+	}
+	if s.isDeleted(tarPath) {
+		return errors.DoesNotExist("Path does not exist: " + tarPath)
+	}
+	return s.Repository.GetPathItemTar(tarPath, itemPath, localPath)
+}
+
+func (s *DryRunRepository) ListTarFile(tarPath string) ([]string, error) {
+	if s.inOverlay(tarPath) {
+		return s.overlay.ListTarFile(tarPath)
+	}
+	if s.isDeleted(tarPath) {
+		return nil, errors.DoesNotExist("Path does not exist: " + tarPath)
+	}
+	return s.Repository.ListTarFile(tarPath)
+}
+
+// List lists what is in the repository and hasn't been deleted, and what
+// would have been written
+func (s *DryRunRepository) List(p string) ([]string, error) {
+	paths, err := s.Repository.List(p)
+	if err != nil {
+		return nil, err
+	}
+	overlayPaths, err := s.overlay.List(p)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	result := []string{}
+	for _, p := range overlayPaths {
+		seen[p] = true
+		result = append(result, p)
+	}
+	for _, p := range paths {
+		if !seen[p] && !s.isDeleted(p) {
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (s *DryRunRepository) ListRecursive(results chan<- ListResult, folder string) {
+	s.mergeRecursive(results, func(r Repository, results chan<- ListResult) { r.ListRecursive(results, folder) })
+}
+
+func (s *DryRunRepository) MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string) {
+	s.mergeRecursive(results, func(r Repository, results chan<- ListResult) { r.MatchFilenamesRecursive(results, folder, filename) })
+}
+
+// mergeRecursive sends the results of list for the overlay, then the results
+// for the repository that weren't overwritten or deleted
+func (s *DryRunRepository) mergeRecursive(results chan<- ListResult, list func(r Repository, results chan<- ListResult)) {
+	defer close(results)
+	seen := map[string]bool{}
+	overlayResults := make(chan ListResult)
+	go list(s.overlay, overlayResults)
+	for result := range overlayResults {
+		seen[result.Path] = true
+		results <- result
+	}
+	repoResults := make(chan ListResult)
+	go list(s.Repository, repoResults)
+	for result := range repoResults {
+		if result.Error == nil {
+			p := filepath.ToSlash(strings.TrimPrefix(result.Path, "/"))
+			if seen[p] || s.isDeleted(p) {
+				continue
+			}
+		}
+		results <- result
+	}
+}
+
+func (s *DryRunRepository) Put(p string, data []byte) error {
+	console.Info("Would write %s/%s (%d bytes)", s.RootURL(), p, len(data))
+	return s.overlay.Put(p, data)
+}
+
+func (s *DryRunRepository) PutPath(localPath string, repoPath string) error {
+	files, err := getListOfFilesToPut(localPath, repoPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		console.Info("Would write %s/%s (copied from %s)", s.RootURL(), file.Dest, file.Source)
+	}
+	return nil
+}
+
+func (s *DryRunRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	console.Info("Would write %s/%s, containing:", s.RootURL(), tarPath)
+	err := filepath.Walk(filepath.Join(localPath, includePath), func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			relPath, err := filepath.Rel(localPath, currentPath)
+			if err != nil {
+				return err
+			}
+			console.Info("  %s (%d bytes)", filepath.ToSlash(relPath), info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list files in %s: %w", localPath, err)
+	}
+	return nil
+}
+
+// Delete prints each file that would be deleted, whether p is a file or a directory
+func (s *DryRunRepository) Delete(p string) error {
+	toDelete := map[string]bool{}
+
+	siblings, err := s.List(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	for _, sibling := range siblings {
+		if sibling == p {
+			toDelete[p] = true
+		}
+	}
+	results := make(chan ListResult)
+	go s.ListRecursive(results, p)
+	var listErr error
+	for result := range results {
+		if result.Error != nil {
+			listErr = result.Error
+			continue
+		}
+		toDelete[filepath.ToSlash(result.Path)] = true
+	}
+	if listErr != nil {
+		return listErr
+	}
+
+	paths := []string{}
+	for p := range toDelete {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		console.Info("Would delete %s/%s", s.RootURL(), strings.TrimPrefix(p, "/"))
+	}
+	s.mu.Lock()
+	s.deleted = append(s.deleted, memoryKey(p))
+	s.mu.Unlock()
+	return s.overlay.Delete(p)
+}
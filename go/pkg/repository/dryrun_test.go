@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestDryRunRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+
+	diskRepo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	require.NoError(t, diskRepo.Put("experiments/abc/file.txt", []byte("hello")))
+	require.NoError(t, ioutil.WriteFile(path.Join(localDir, "local.txt"), []byte("hello"), 0644))
+
+	repo := NewDryRunRepository(diskRepo)
+
+	// reads go through to the repository
+	content, err := repo.Get("experiments/abc/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), content)
+
+	// writes don't
+	require.NoError(t, repo.Put("new.txt", []byte("hello")))
+	require.NoError(t, repo.PutPath(localDir, "put-path"))
+	require.NoError(t, repo.PutPathTar(localDir, "put-path.tar.gz", ""))
+	for _, p := range []string{"new.txt", "put-path/local.txt", "put-path.tar.gz"} {
+		_, err := diskRepo.Get(p)
+		require.True(t, errors.IsDoesNotExist(err), p)
+	}
+
+	// nor do deletes, of files or directories
+	require.NoError(t, repo.Delete("experiments/abc/file.txt"))
+	require.NoError(t, repo.Delete("experiments"))
+	content, err = diskRepo.Get("experiments/abc/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), content)
+
+	// later reads see what would have been written and deleted
+	content, err = repo.Get("new.txt")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), content)
+	_, err = repo.Get("experiments/abc/file.txt")
+	require.True(t, errors.IsDoesNotExist(err))
+	paths, err := repo.List("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"new.txt"}, paths)
+	results := make(chan ListResult)
+	go repo.ListRecursive(results, "")
+	listed := []string{}
+	for result := range results {
+		require.NoError(t, result.Error)
+		listed = append(listed, result.Path)
+	}
+	require.Equal(t, []string{"new.txt"}, listed)
+}
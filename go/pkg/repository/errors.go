@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"google.golang.org/api/googleapi"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// readError returns an error for a failed read from a repository, with a code
+// that describes the cause if it is known (see classifyError), or a read error if not
+func readError(cause error, format string, a ...interface{}) error {
+	return classifiedError(cause, errors.ReadError, format, a...)
+}
+
+// writeError returns an error for a failed write to a repository, with a code
+// that describes the cause if it is known (see classifyError), or a write error if not
+func writeError(cause error, format string, a ...interface{}) error {
+	return classifiedError(cause, errors.WriteError, format, a...)
+}
+
+func classifiedError(cause error, fallback func(msg string) error, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if errors.Code(cause) != "" {
+		// already classified further down
+		return &wrappedError{msg: msg, err: cause}
+	}
+	if newError := classifyError(cause); newError != nil {
+		return newError(msg)
+	}
+	return fallback(msg)
+}
+
+// classifyError returns the constructor for the coded error that describes why
+// an S3, Google Cloud Storage, or filesystem operation failed, or nil if it isn't
+// a kind of failure that can be described any better than "read" or "write" error
+func classifyError(err error) func(msg string) error {
+	if err == nil {
+		return nil
+	}
+
+	var aerr awserr.Error
+	if goerrors.As(err, &aerr) {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NotFound":
+			return errors.DoesNotExist
+		case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+			return errors.PermissionDenied
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+			return errors.Throttled
+		case request.ErrCodeResponseTimeout:
+			return errors.NetworkTimeout
+		case request.CanceledErrorCode:
+			// the request's context ran out of time, or was cancelled on
+			// purpose, in which case it shouldn't be retried
+			if goerrors.Is(aerr.OrigErr(), context.DeadlineExceeded) {
+				return errors.NetworkTimeout
+			}
+			return nil
+		}
+	}
+	var rerr awserr.RequestFailure
+	if goerrors.As(err, &rerr) {
+		if newError := classifyHTTPStatus(rerr.StatusCode()); newError != nil {
+			return newError
+		}
+	}
+
+	if goerrors.Is(err, storage.ErrObjectNotExist) || goerrors.Is(err, storage.ErrBucketNotExist) {
+		return errors.DoesNotExist
+	}
+	var gerr *googleapi.Error
+	if goerrors.As(err, &gerr) {
+		if newError := classifyHTTPStatus(gerr.Code); newError != nil {
+			return newError
+		}
+	}
+
+	if goerrors.Is(err, context.DeadlineExceeded) {
+		return errors.NetworkTimeout
+	}
+	var nerr net.Error
+	if goerrors.As(err, &nerr) && nerr.Timeout() {
+		return errors.NetworkTimeout
+	}
+
+	if goerrors.Is(err, gzip.ErrHeader) || goerrors.Is(err, gzip.ErrChecksum) || goerrors.Is(err, tar.ErrHeader) || goerrors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.Corrupt
+	}
+
+	if os.IsPermission(err) {
+		return errors.PermissionDenied
+	}
+	if os.IsNotExist(err) {
+		return errors.DoesNotExist
+	}
+	return nil
+}
+
+func classifyHTTPStatus(status int) func(msg string) error {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.PermissionDenied
+	case http.StatusNotFound:
+		return errors.DoesNotExist
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return errors.Throttled
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return errors.NetworkTimeout
+	}
+	return nil
+}
+
+// tarError returns an error for a tarball that failed to be read. Archiver
+// doesn't wrap errors, so whether it is corrupt is determined from the message.
+func tarError(tarPath string, err error) error {
+	msg := err.Error()
+	for _, corruptMessage := range []string{"gzip: ", "unexpected EOF", "archive/tar: ", "reading file in tar archive", "opening tar archive for reading"} {
+		if strings.Contains(msg, corruptMessage) {
+			return errors.Corrupt(fmt.Sprintf("The tarball %s is corrupted or truncated: %v", filepath.Base(tarPath), err))
+		}
+	}
+	return readError(err, "Failed to extract %s: %v", filepath.Base(tarPath), err)
+}
+
+// wrappedError adds context to an error that already has a code, keeping the code
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestClassifiedErrors(t *testing.T) {
+	for _, tt := range []struct {
+		cause error
+		code  string
+	}{
+		{awserr.New("AccessDenied", "Access Denied", nil), errors.CodePermissionDenied},
+		{awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate", nil), http.StatusServiceUnavailable, "abc"), errors.CodeThrottled},
+		{awserr.NewRequestFailure(awserr.New("Unknown", "", nil), http.StatusForbidden, "abc"), errors.CodePermissionDenied},
+		{awserr.New("NoSuchKey", "The specified key does not exist", nil), errors.CodeDoesNotExist},
+		{&googleapi.Error{Code: http.StatusForbidden}, errors.CodePermissionDenied},
+		{fmt.Errorf("writing: %w", &googleapi.Error{Code: http.StatusTooManyRequests}), errors.CodeThrottled},
+		{storage.ErrObjectNotExist, errors.CodeDoesNotExist},
+		{context.DeadlineExceeded, errors.CodeNetworkTimeout},
+		{awserr.New(request.CanceledErrorCode, "request context canceled", context.DeadlineExceeded), errors.CodeNetworkTimeout},
+		{awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled), errors.CodeReadError},
+		{os.ErrPermission, errors.CodePermissionDenied},
+		{fmt.Errorf("something else"), errors.CodeReadError},
+	} {
+		err := readError(tt.cause, "Failed to read foo: %v", tt.cause)
+		require.Equal(t, tt.code, errors.Code(err), "%v", tt.cause)
+		require.Contains(t, err.Error(), "Failed to read foo")
+	}
+
+	require.Equal(t, errors.CodeWriteError, errors.Code(writeError(fmt.Errorf("something else"), "Failed to write foo")))
+
+	// errors that already have a code keep it
+	err := writeError(errors.Throttled("slow down"), "Failed to write foo")
+	require.True(t, errors.IsThrottled(err))
+	require.True(t, errors.IsRetryable(err))
+	require.Equal(t, "Failed to write foo", err.Error())
+}
+
+func TestCorruptTarball(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	sourceDir := path.Join(dir, "source")
+	require.NoError(t, os.MkdirAll(sourceDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(sourceDir, "weights"), make([]byte, 100000), 0644))
+	require.NoError(t, repository.PutPathTar(sourceDir, "checkpoints/abc.tar.gz", ""))
+
+	// truncate the tarball
+	tarPath := path.Join(dir, "checkpoints/abc.tar.gz")
+	data, err := ioutil.ReadFile(tarPath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(tarPath, data[:len(data)/2], 0644))
+
+	err = repository.GetPathTar("checkpoints/abc.tar.gz", path.Join(dir, "output"))
+	require.Error(t, err)
+	require.True(t, errors.IsCorrupt(err), err.Error())
+}
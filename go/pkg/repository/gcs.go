@@ -11,9 +11,6 @@ import (
 	"strings"
 
 	"cloud.google.com/go/storage"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
 
 	"github.com/replicate/keepsake/go/pkg/concurrency"
 	"github.com/replicate/keepsake/go/pkg/console"
@@ -29,18 +26,9 @@ type GCSRepository struct {
 }
 
 func NewGCSRepository(bucket, root string) (*GCSRepository, error) {
-	applicationCredentialsJSON := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON")
-	options := []option.ClientOption{}
-	if applicationCredentialsJSON != "" {
-		jwtConfig, err := google.JWTConfigFromJSON([]byte(applicationCredentialsJSON), storage.ScopeReadWrite)
-		if err != nil {
-			return nil, errors.RepositoryConfigurationError(err.Error())
-		}
-		options = append(options, option.WithTokenSource(jwtConfig.TokenSource(context.TODO())))
-	}
-	client, err := storage.NewClient(context.TODO(), options...)
+	client, err := gcsClient()
 	if err != nil {
-		return nil, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to Google Cloud Storage: %v", err))
+		return nil, err
 	}
 
 	return &GCSRepository{
@@ -63,33 +51,53 @@ func (s *GCSRepository) Get(path string) ([]byte, error) {
 	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, key)
 	bucket := s.client.Bucket(s.bucketName)
 	obj := bucket.Object(key)
-	reader, err := obj.NewReader(context.TODO())
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Metadata)
+	defer cancel()
+	reader, err := obj.NewReader(ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
 			return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %s", pathString))
 		}
-		return nil, errors.ReadError(fmt.Sprintf("Failed to open %s: %s", pathString, err))
+		return nil, readError(err, "Failed to open %s: %s", pathString, err)
 	}
 	// FIXME: unhandled error
 	defer reader.Close()
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return nil, errors.ReadError(fmt.Sprintf("Failed to read %s: %s", pathString, err))
+		return nil, readError(err, "Failed to read %s: %s", pathString, err)
 	}
 
 	return data, nil
 }
 
+// Exists returns true if there is an object at path
+func (s *GCSRepository) Exists(path string) (bool, error) {
+	key := filepath.Join(s.root, path)
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Metadata)
+	defer cancel()
+	_, err := s.client.Bucket(s.bucketName).Object(key).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, readError(err, "Failed to read gs://%s/%s: %s", s.bucketName, key, err)
+	}
+	return true, nil
+}
+
 // Delete deletes path. If path is a directory, it recursively deletes
 // all everything under path
 func (s *GCSRepository) Delete(path string) error {
 	console.Debug("Deleting %s/%s...", s.RootURL(), path)
 	prefix := filepath.Join(s.root, path)
-	err := s.applyRecursive(prefix, func(obj *storage.ObjectHandle) error {
-		return obj.Delete(context.TODO())
-	})
+	timeout := currentTimeouts().Metadata
+	err := s.applyRecursive(context.Background(), prefix, func(obj *storage.ObjectHandle) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return obj.Delete(ctx)
+	}, logProgress("Deleted", s.RootURL()+"/"+path))
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), path, err))
+		return writeError(err, "Failed to delete %s/%s: %v", s.RootURL(), path, err)
 	}
 	return nil
 }
@@ -100,27 +108,29 @@ func (s *GCSRepository) Put(path string, data []byte) error {
 	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, key)
 	bucket := s.client.Bucket(s.bucketName)
 	obj := bucket.Object(key)
-	writer := obj.NewWriter(context.TODO())
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Metadata)
+	defer cancel()
+	writer := s.newWriter(ctx, obj)
 	_, err := writer.Write(data)
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+		return writeError(err, "Failed to write %q: %v", pathString, err)
 	}
 	if err := writer.Close(); err != nil {
 		if strings.Contains(err.Error(), "notFound") {
 			if err := s.ensureBucketExists(); err != nil {
 				return err
 			}
-			writer := obj.NewWriter(context.TODO())
+			writer := s.newWriter(ctx, obj)
 			_, err := writer.Write(data)
 			if err != nil {
-				return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+				return writeError(err, "Failed to write %q: %v", pathString, err)
 			}
 			if err := writer.Close(); err != nil {
-				return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+				return writeError(err, "Failed to write %q: %v", pathString, err)
 			}
 			return nil
 		}
-		return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+		return writeError(err, "Failed to write %q: %v", pathString, err)
 	}
 	return nil
 }
@@ -132,11 +142,14 @@ func (s *GCSRepository) PutPath(localPath string, repoPath string) error {
 	}
 	bucket := s.client.Bucket(s.bucketName)
 	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	timeout := currentTimeouts().Transfer
 	for _, file := range files {
 		// Variables used in closure
 		file := file
 		err := queue.Go(func() error {
-			writer := bucket.Object(file.Dest).NewWriter(context.TODO())
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			writer := s.newWriter(ctx, bucket.Object(file.Dest))
 
 			reader, err := os.Open(file.Source)
 			if err != nil {
@@ -154,11 +167,11 @@ func (s *GCSRepository) PutPath(localPath string, repoPath string) error {
 			return nil
 		})
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return writeError(err, "%v", err)
 		}
 	}
 	if err := queue.Wait(); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
@@ -174,17 +187,30 @@ func (s *GCSRepository) PutPathTar(localPath, tarPath, includePath string) error
 	key := filepath.Join(s.root, tarPath)
 	bucket := s.client.Bucket(s.bucketName)
 	obj := bucket.Object(key)
-	writer := obj.NewWriter(context.TODO())
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Transfer)
+	defer cancel()
+	writer := s.newWriter(ctx, obj)
 
 	if err := putPathTar(localPath, writer, filepath.Base(tarPath), includePath); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	if err := writer.Close(); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
 
+// newWriter returns a writer for obj, with the attributes for its path. The
+// upload is abandoned if ctx is cancelled before the writer is closed.
+func (s *GCSRepository) newWriter(ctx context.Context, obj *storage.ObjectHandle) *storage.Writer {
+	attrs := attributesForPath(relativeToRoot(obj.ObjectName(), s.root))
+	writer := obj.NewWriter(ctx)
+	writer.ContentType = attrs.ContentType
+	writer.CacheControl = attrs.CacheControl
+	writer.Metadata = attrs.Metadata
+	return writer
+}
+
 // List files in a path non-recursively
 func (s *GCSRepository) List(dir string) ([]string, error) {
 	results := []string{}
@@ -197,25 +223,24 @@ func (s *GCSRepository) List(dir string) ([]string, error) {
 	prefix = strings.TrimPrefix(prefix, "/")
 
 	bucket := s.client.Bucket(s.bucketName)
-	it := bucket.Objects(context.TODO(), &storage.Query{
+	fetch := gcsPageFetcher(bucket, &storage.Query{
 		Prefix:    prefix,
 		Delimiter: "/",
 	})
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, errors.ReadError(fmt.Sprintf("Failed to list %s/%s: %s", s.RootURL(), dir, err))
-		}
-		p := attrs.Name
-		if s.root != "" {
-			p = strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
-		}
-		if p != "" {
-			results = append(results, p)
+	err := listPages(context.Background(), fetch, func(page []*storage.ObjectAttrs) error {
+		for _, attrs := range page {
+			p := attrs.Name
+			if s.root != "" {
+				p = strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
+			}
+			if p != "" {
+				results = append(results, p)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, readError(err, "Failed to list %s/%s: %s", s.RootURL(), dir, err)
 	}
 	return results, nil
 }
@@ -273,31 +298,23 @@ func (s *GCSRepository) listRecursive(results chan<- ListResult, dir string, fil
 	prefix = strings.TrimPrefix(prefix, "/")
 
 	bucket := s.client.Bucket(s.bucketName)
-	it := bucket.Objects(context.TODO(), &storage.Query{
-		Prefix: prefix,
-	})
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			// Treat non-existent buckets as empty
-			// Can't figure out how to check this error more strongly
-			if strings.Contains(err.Error(), "storage: bucket doesn't exist") {
-				break
-			}
-
-			results <- ListResult{Error: fmt.Errorf("Failed to list gs://%s/%s: %s", s.bucketName, prefix, err)}
-			break
-		}
-		if filter(attrs.Name) {
-			p := attrs.Name
-			if s.root != "" {
-				p = strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
+	fetch := gcsPageFetcher(bucket, &storage.Query{Prefix: prefix})
+	err := listPages(context.Background(), fetch, func(page []*storage.ObjectAttrs) error {
+		for _, attrs := range page {
+			if filter(attrs.Name) {
+				p := attrs.Name
+				if s.root != "" {
+					p = strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
+				}
+				results <- ListResult{Path: p, MD5: attrs.MD5, Size: attrs.Size, Modified: attrs.Updated}
 			}
-			results <- ListResult{Path: p, MD5: attrs.MD5}
 		}
+		return nil
+	})
+	// Treat non-existent buckets as empty
+	// Can't figure out how to check this error more strongly
+	if err != nil && !strings.Contains(err.Error(), "storage: bucket doesn't exist") {
+		results <- ListResult{Error: readError(err, "Failed to list gs://%s/%s: %s", s.bucketName, prefix, err)}
 	}
 	close(results)
 }
@@ -305,43 +322,70 @@ func (s *GCSRepository) listRecursive(results chan<- ListResult, dir string, fil
 // GetPath recursively copies repoDir to localDir
 func (s *GCSRepository) GetPath(repoDir string, localDir string) error {
 	prefix := filepath.Join(s.root, repoDir)
-	err := s.applyRecursive(prefix, func(obj *storage.ObjectHandle) error {
+	size, err := s.sizeUnderPrefix(context.Background(), prefix)
+	if err != nil {
+		return readError(err, "Failed to list gs://%s/%s: %v", s.bucketName, prefix, err)
+	}
+	if err := CheckDiskSpace(localDir, size, fmt.Sprintf("gs://%s/%s", s.bucketName, prefix)); err != nil {
+		return err
+	}
+	timeout := currentTimeouts().Transfer
+	err = s.applyRecursive(context.Background(), prefix, func(obj *storage.ObjectHandle) error {
+		if !isUnderPrefix(obj.ObjectName(), prefix) {
+			return nil
+		}
 		gcsPathString := fmt.Sprintf("gs://%s/%s", s.bucketName, obj.ObjectName())
-		reader, err := obj.NewReader(context.TODO())
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		reader, err := obj.NewReader(ctx)
 		if err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to open %s: %v", gcsPathString, err))
+			return readError(err, "Failed to open %s: %v", gcsPathString, err)
 		}
 		defer reader.Close()
 
 		relPath, err := filepath.Rel(prefix, obj.ObjectName())
 		if err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to determine directory of %s relative to %s: %v", obj.ObjectName(), repoDir, err))
+			return readError(err, "Failed to determine directory of %s relative to %s: %v", obj.ObjectName(), repoDir, err)
 		}
-		localPath := filepath.Join(localDir, relPath)
-		localDir := filepath.Dir(localPath)
-		if err := os.MkdirAll(localDir, 0755); err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to create directory %s: %v", localDir, err))
+		localPath, err := files.JoinWithin(localDir, filepath.ToSlash(relPath))
+		if err != nil {
+			return err
 		}
-
-		f, err := os.Create(localPath)
+		f, err := createDownloadFile(localPath)
 		if err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to create file %s: %v", localPath, err))
+			return readError(err, "%v", err)
 		}
-		defer f.Close()
 
 		console.Debug("Downloading %s to %s", gcsPathString, localPath)
 		if _, err := io.Copy(f, reader); err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to copy %s to %s: %v", gcsPathString, localPath, err))
+			f.Abort()
+			return readError(err, "Failed to copy %s to %s: %v", gcsPathString, localPath, err)
 		}
-		return nil
-	})
+		return f.Commit()
+	}, logProgress("Downloaded", s.RootURL()+"/"+repoDir))
 
 	if err != nil {
-		return fmt.Errorf("Failed to copy gs://%s/%s to %s: %v", s.bucketName, repoDir, localDir, err)
+		return readError(err, "Failed to copy gs://%s/%s to %s: %v", s.bucketName, repoDir, localDir, err)
 	}
 	return nil
 }
 
+// sizeUnderPrefix returns the total size of the objects that GetPath would
+// download
+func (s *GCSRepository) sizeUnderPrefix(ctx context.Context, prefix string) (int64, error) {
+	var size int64
+	fetch := gcsPageFetcher(s.client.Bucket(s.bucketName), &storage.Query{Prefix: prefix})
+	err := listPages(ctx, fetch, func(page []*storage.ObjectAttrs) error {
+		for _, attrs := range page {
+			if isUnderPrefix(attrs.Name, prefix) {
+				size += attrs.Size
+			}
+		}
+		return nil
+	})
+	return size, err
+}
+
 func (s *GCSRepository) GetPathTar(tarPath, localPath string) error {
 	// archiver doesn't let us use readers, so download to temporary file
 	// TODO: make a better tar implementation
@@ -388,14 +432,20 @@ func (s *GCSRepository) GetPathItemTar(tarPath, itemPath, localPath string) erro
 
 func (s *GCSRepository) bucketExists() (bool, error) {
 	bucket := s.client.Bucket(s.bucketName)
-	_, err := bucket.Attrs(context.TODO())
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Metadata)
+	defer cancel()
+	_, err := bucket.Attrs(ctx)
 	if err == nil {
 		return true, nil
 	}
 	if err == storage.ErrBucketNotExist {
 		return false, nil
 	}
-	return false, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to determine if bucket gs://%s exists: %v", s.bucketName, err))
+	msg := fmt.Sprintf("Failed to determine if bucket gs://%s exists: %v", s.bucketName, err)
+	if newError := classifyError(err); newError != nil {
+		return false, newError(msg)
+	}
+	return false, errors.RepositoryConfigurationError(msg)
 }
 
 func (s *GCSRepository) ensureBucketExists() error {
@@ -410,43 +460,63 @@ func (s *GCSRepository) ensureBucketExists() error {
 }
 
 func (s *GCSRepository) CreateBucket() error {
+	return s.createBucket(nil)
+}
+
+// CreateBucketIfNotExists creates the bucket in location with storageClass, if
+// it doesn't already exist. If location or storageClass are empty, the Google
+// Cloud Storage defaults are used.
+func (s *GCSRepository) CreateBucketIfNotExists(location, storageClass string) (created bool, err error) {
+	exists, err := s.bucketExists()
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	attrs := &storage.BucketAttrs{
+		Location:     location,
+		StorageClass: storageClass,
+	}
+	if err := s.createBucket(attrs); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *GCSRepository) createBucket(attrs *storage.BucketAttrs) error {
 	projectID, err := s.getProjectID()
 	if err != nil {
 		return err
 	}
 	bucket := s.client.Bucket(s.bucketName)
-	if err := bucket.Create(context.TODO(), projectID, nil); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Metadata)
+	defer cancel()
+	if err := bucket.Create(ctx, projectID, attrs); err != nil {
 		return fmt.Errorf("Failed to create bucket gs://%s: %v", s.bucketName, err)
 	}
 	return nil
 }
 
+// applyRecursive calls fn for each object under prefix, with a fixed pool of
+// maxWorkers workers. Objects are processed as each page of the listing is
+// fetched, rather than after the whole prefix has been listed, and listing
+// waits for the workers to catch up, so memory use doesn't grow with the
+// number of objects. onProgress, if not nil, is called periodically with how
+// many objects have been found and processed.
+//
 // Note: prefix does not include s.root
-func (s *GCSRepository) applyRecursive(prefix string, fn func(obj *storage.ObjectHandle) error) error {
-	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
-
+func (s *GCSRepository) applyRecursive(ctx context.Context, prefix string, fn func(obj *storage.ObjectHandle) error, onProgress func(ListProgress)) error {
 	bucket := s.client.Bucket(s.bucketName)
-	it := bucket.Objects(context.TODO(), &storage.Query{
-		Prefix: prefix,
-	})
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		err = queue.Go(func() error {
-			obj := bucket.Object(attrs.Name)
-			return fn(obj)
-		})
-		if err != nil {
-			return err
-		}
+	query := &storage.Query{Prefix: prefix}
+	// only the names are needed, which makes each page much smaller
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return err
 	}
-	return queue.Wait()
+	progress := newProgressReporter(gcsProgressInterval, onProgress)
+	return applyToPages(ctx, gcsPageFetcher(bucket, query), maxWorkers, func(name string) error {
+		return fn(bucket.Object(name))
+	}, progress)
 }
 
 // getProjectID shells out to gcloud config config-helper to get
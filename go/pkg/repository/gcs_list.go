@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/iterator"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// gcsListPageSize is how many objects are requested in each page of a listing
+const gcsListPageSize = 1000
+
+// gcsListRetries is how many times fetching a page of a listing is retried if
+// it fails with an error that may go away, like being rate limited
+const gcsListRetries = 5
+
+// gcsListRetryDelay is how long to wait before retrying a page for the first
+// time. It doubles for each retry after that.
+var gcsListRetryDelay = time.Second
+
+// gcsProgressInterval is how often progress is reported for long operations
+var gcsProgressInterval = 10 * time.Second
+
+// ListProgress is how many objects have been found by a listing so far, and
+// how many of them have been processed
+type ListProgress struct {
+	Discovered int
+	Processed  int
+}
+
+// fetchPageFunc fetches the page of a listing after pageToken, returning the
+// token for the next page, or an empty string if it is the last page
+type fetchPageFunc func(ctx context.Context, pageToken string) (page []*storage.ObjectAttrs, nextPageToken string, err error)
+
+// gcsPageFetcher returns a fetchPageFunc for the objects in bucket that match query
+func gcsPageFetcher(bucket *storage.BucketHandle, query *storage.Query) fetchPageFunc {
+	return func(ctx context.Context, pageToken string) ([]*storage.ObjectAttrs, string, error) {
+		page := []*storage.ObjectAttrs{}
+		pager := iterator.NewPager(bucket.Objects(ctx, query), gcsListPageSize, pageToken)
+		nextPageToken, err := pager.NextPage(&page)
+		return page, nextPageToken, err
+	}
+}
+
+// listPages calls fn with each page of a listing as soon as it is fetched, so
+// work on the first objects can start before the whole prefix has been listed.
+// Pages that fail with retryable errors are fetched again with exponential
+// backoff. It stops when ctx is cancelled.
+func listPages(ctx context.Context, fetch fetchPageFunc, fn func(page []*storage.ObjectAttrs) error) error {
+	pageToken := ""
+	for {
+		page, nextPageToken, err := fetchPageWithRetries(ctx, fetch, pageToken)
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if nextPageToken == "" {
+			return nil
+		}
+		pageToken = nextPageToken
+	}
+}
+
+// applyToPages calls fn with the name of each object in the listing fetched
+// by fetch, using a fixed pool of workers. Names are passed to the workers
+// through a channel that holds at most one name per worker, so fetching pages
+// waits while the workers are busy, and at most one page is held in memory at
+// a time. If fn fails, the listing and the other workers stop, and its error
+// is returned.
+func applyToPages(ctx context.Context, fetch fetchPageFunc, workers int, fn func(name string) error, progress *progressReporter) error {
+	group, ctx := errgroup.WithContext(ctx)
+	names := make(chan string, workers)
+	for i := 0; i < workers; i++ {
+		group.Go(func() error {
+			for name := range names {
+				if ctx.Err() != nil {
+					// a worker failed, so drop what is left
+					continue
+				}
+				err := fn(name)
+				progress.processed()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	listErr := listPages(ctx, fetch, func(page []*storage.ObjectAttrs) error {
+		progress.discovered(len(page))
+		for _, attrs := range page {
+			select {
+			case names <- attrs.Name:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	close(names)
+	// a failed worker cancels the listing, so its error is the interesting one
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return listErr
+}
+
+func fetchPageWithRetries(ctx context.Context, fetch fetchPageFunc, pageToken string) ([]*storage.ObjectAttrs, string, error) {
+	delay := gcsListRetryDelay
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, currentTimeouts().List)
+		page, nextPageToken, err := fetch(fetchCtx, pageToken)
+		timedOut := fetchCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if err == nil {
+			return page, nextPageToken, nil
+		}
+		// a page that hung is retried like any other page that failed
+		if attempt >= gcsListRetries || !(timedOut || isRetryableListError(err)) {
+			return nil, "", err
+		}
+		console.Debug("Failed to list a page of objects, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func isRetryableListError(err error) bool {
+	if errors.IsRetryable(err) {
+		return true
+	}
+	newError := classifyError(err)
+	return newError != nil && errors.IsRetryable(newError(err.Error()))
+}
+
+// progressReporter counts the objects discovered and processed by an
+// operation, and passes the counts to a callback at most every interval
+type progressReporter struct {
+	mu       sync.Mutex
+	progress ListProgress
+	last     time.Time
+	interval time.Duration
+	callback func(ListProgress)
+}
+
+func newProgressReporter(interval time.Duration, callback func(ListProgress)) *progressReporter {
+	return &progressReporter{last: time.Now(), interval: interval, callback: callback}
+}
+
+func (r *progressReporter) discovered(n int) {
+	r.update(func(p *ListProgress) { p.Discovered += n })
+}
+
+func (r *progressReporter) processed() {
+	r.update(func(p *ListProgress) { p.Processed++ })
+}
+
+func (r *progressReporter) update(f func(p *ListProgress)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.progress)
+	if r.callback != nil && time.Since(r.last) >= r.interval {
+		r.last = time.Now()
+		r.callback(r.progress)
+	}
+}
+
+// logProgress returns a progress callback that tells the user how far through
+// a long operation is. verb describes what is done to each object, e.g. "Deleted".
+func logProgress(verb string, url string) func(ListProgress) {
+	return func(p ListProgress) {
+		console.Info("%s %d of %d objects found so far in %s...", verb, p.Processed, p.Discovered, url)
+	}
+}
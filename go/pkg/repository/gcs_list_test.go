@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+// fakePages returns a fetchPageFunc for numPages pages of two objects each.
+// failures is how many times each page fails with err before it succeeds.
+func fakePages(numPages int, failures int, err error, fetched *[]string) fetchPageFunc {
+	attempts := map[string]int{}
+	return func(ctx context.Context, pageToken string) ([]*storage.ObjectAttrs, string, error) {
+		attempts[pageToken]++
+		if attempts[pageToken] <= failures {
+			return nil, "", err
+		}
+		*fetched = append(*fetched, pageToken)
+		i := 0
+		if pageToken != "" {
+			i, _ = strconv.Atoi(pageToken)
+		}
+		page := []*storage.ObjectAttrs{{Name: fmt.Sprintf("%d-a", i)}, {Name: fmt.Sprintf("%d-b", i)}}
+		next := ""
+		if i+1 < numPages {
+			next = strconv.Itoa(i + 1)
+		}
+		return page, next, nil
+	}
+}
+
+func TestListPages(t *testing.T) {
+	defer func(d time.Duration) { gcsListRetryDelay = d }(gcsListRetryDelay)
+	gcsListRetryDelay = time.Millisecond
+
+	// pages are passed on as they are fetched
+	fetched := []string{}
+	names := []string{}
+	err := listPages(context.Background(), fakePages(3, 0, nil, &fetched), func(page []*storage.ObjectAttrs) error {
+		require.Len(t, fetched, len(names)/2+1)
+		for _, attrs := range page {
+			names = append(names, attrs.Name)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0-a", "0-b", "1-a", "1-b", "2-a", "2-b"}, names)
+
+	// rate limited pages are retried
+	fetched = []string{}
+	throttled := &googleapi.Error{Code: http.StatusTooManyRequests}
+	err = listPages(context.Background(), fakePages(2, 2, throttled, &fetched), func(page []*storage.ObjectAttrs) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, []string{"", "1"}, fetched)
+
+	// ... but not forever
+	err = listPages(context.Background(), fakePages(2, gcsListRetries+1, throttled, &fetched), func(page []*storage.ObjectAttrs) error { return nil })
+	require.Equal(t, throttled, err)
+
+	// other errors aren't retried
+	fetched = []string{}
+	forbidden := &googleapi.Error{Code: http.StatusForbidden}
+	err = listPages(context.Background(), fakePages(2, 1, forbidden, &fetched), func(page []*storage.ObjectAttrs) error { return nil })
+	require.Equal(t, forbidden, err)
+	require.Empty(t, fetched)
+
+	// errors from the callback stop the listing
+	fetched = []string{}
+	err = listPages(context.Background(), fakePages(3, 0, nil, &fetched), func(page []*storage.ObjectAttrs) error { return fmt.Errorf("oops") })
+	require.EqualError(t, err, "oops")
+	require.Equal(t, []string{""}, fetched)
+
+	// pages that hang are abandoned and retried
+	defer ConfigureTimeouts(Timeouts{})
+	ConfigureTimeouts(Timeouts{List: 10 * time.Millisecond})
+	hangs := 1
+	fetched = []string{}
+	pages := fakePages(1, 0, nil, &fetched)
+	err = listPages(context.Background(), func(ctx context.Context, pageToken string) ([]*storage.ObjectAttrs, string, error) {
+		if hangs > 0 {
+			hangs--
+			<-ctx.Done()
+			return nil, "", ctx.Err()
+		}
+		return pages(ctx, pageToken)
+	}, func(page []*storage.ObjectAttrs) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, []string{""}, fetched)
+
+	// cancelling the context stops the listing
+	fetched = []string{}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = listPages(ctx, fakePages(3, 0, nil, &fetched), func(page []*storage.ObjectAttrs) error {
+		cancel()
+		return nil
+	})
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, []string{""}, fetched)
+}
+
+func TestApplyToPages(t *testing.T) {
+	// every object is processed, by no more than the number of workers at once
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	names := []string{}
+	fetched := []string{}
+	err := applyToPages(context.Background(), fakePages(50, 0, nil, &fetched), 4, func(name string) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		names = append(names, name)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}, newProgressReporter(time.Hour, nil))
+	require.NoError(t, err)
+	require.Len(t, names, 100)
+	require.LessOrEqual(t, maxRunning, 4)
+
+	// a failure stops the listing
+	fetched = []string{}
+	err = applyToPages(context.Background(), fakePages(50, 0, nil, &fetched), 2, func(name string) error {
+		return fmt.Errorf("failed to process %s", name)
+	}, newProgressReporter(time.Hour, nil))
+	require.Error(t, err)
+	require.Less(t, len(fetched), 50)
+
+	// listing errors are returned
+	fetched = []string{}
+	forbidden := &googleapi.Error{Code: http.StatusForbidden}
+	err = applyToPages(context.Background(), fakePages(2, 1, forbidden, &fetched), 2, func(name string) error {
+		return nil
+	}, newProgressReporter(time.Hour, nil))
+	require.Equal(t, forbidden, err)
+}
+
+func TestProgressReporter(t *testing.T) {
+	reports := []ListProgress{}
+	r := newProgressReporter(0, func(p ListProgress) { reports = append(reports, p) })
+	r.discovered(2)
+	r.processed()
+	r.processed()
+	require.Equal(t, []ListProgress{{2, 0}, {2, 1}, {2, 2}}, reports)
+
+	reports = []ListProgress{}
+	r = newProgressReporter(time.Hour, func(p ListProgress) { reports = append(reports, p) })
+	r.discovered(2)
+	r.processed()
+	require.Empty(t, reports)
+}
+
+func TestCollectVersions(t *testing.T) {
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	fetch := func(ctx context.Context, pageToken string) ([]*storage.ObjectAttrs, string, error) {
+		if pageToken == "" {
+			return []*storage.ObjectAttrs{
+				{Name: "root/metadata/experiments/abc.json", Generation: 2, Created: created.Add(time.Hour)},
+				{Name: "root/metadata/experiments/abc.json", Generation: 1, Created: created, Deleted: created.Add(time.Hour)},
+			}, "next", nil
+		}
+		return []*storage.ObjectAttrs{
+			{Name: "root/metadata/experiments-old/def.json", Generation: 3},
+			{Name: "root/metadata/experiments/def.json", Generation: 4, Metadata: map[string]string{"keepsake-experiment-id": "def"}},
+		}, "", nil
+	}
+	versions, err := collectVersions(context.Background(), fetch, "root", "root/metadata/experiments")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	require.Equal(t, "metadata/experiments/abc.json", versions[0].Path)
+	require.Equal(t, int64(1), versions[0].Generation)
+	require.False(t, versions[0].IsCurrent())
+	require.Equal(t, int64(2), versions[1].Generation)
+	require.True(t, versions[1].IsCurrent())
+	require.Equal(t, "metadata/experiments/def.json", versions[2].Path)
+	require.Equal(t, "def", versions[2].Metadata["keepsake-experiment-id"])
+}
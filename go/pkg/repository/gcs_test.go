@@ -161,6 +161,7 @@ func TestGCSRepository(t *testing.T) {
 		require.Equal(t, ListResult{
 			Path: "checkpoints/abc123.json",
 			MD5:  []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
+			Size: 3,
 		}, <-results)
 		require.Empty(t, <-results)
 
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// ObjectVersion is a generation of an object in a bucket with object
+// versioning turned on. Overwriting or deleting the object keeps the old
+// generation around as a noncurrent version until a lifecycle rule removes it.
+type ObjectVersion struct {
+	// Path is relative to the root of the repository
+	Path       string
+	Generation int64
+	Size       int64
+	MD5        []byte
+	// Created is when this generation was written
+	Created time.Time
+	// Deleted is when this generation stopped being the current one, because
+	// the object was overwritten or deleted. It is zero for the current one.
+	Deleted time.Time
+	// Metadata is the custom metadata it was uploaded with, e.g. the
+	// experiment ID
+	Metadata map[string]string
+}
+
+// IsCurrent returns true if this is the generation that is read by Get
+func (v *ObjectVersion) IsCurrent() bool {
+	return v.Deleted.IsZero()
+}
+
+// ListVersions returns every generation of p and everything under it,
+// including noncurrent ones, ordered by path then from oldest to newest.
+// Noncurrent generations are only kept if the bucket has object versioning
+// turned on.
+func (s *GCSRepository) ListVersions(p string) ([]*ObjectVersion, error) {
+	prefix := strings.TrimPrefix(filepath.Join(s.root, p), "/")
+	bucket := s.client.Bucket(s.bucketName)
+	fetch := gcsPageFetcher(bucket, &storage.Query{
+		Prefix:   prefix,
+		Versions: true,
+	})
+	versions, err := collectVersions(context.Background(), fetch, s.root, prefix)
+	if err != nil {
+		return nil, readError(err, "Failed to list versions of %s/%s: %s", s.RootURL(), p, err)
+	}
+	return versions, nil
+}
+
+// GetGeneration returns the data of a particular generation of p, which can
+// be a noncurrent one
+func (s *GCSRepository) GetGeneration(p string, generation int64) ([]byte, error) {
+	key := filepath.Join(s.root, p)
+	pathString := fmt.Sprintf("gs://%s/%s#%d", s.bucketName, key, generation)
+	obj := s.client.Bucket(s.bucketName).Object(key).Generation(generation)
+	ctx, cancel := context.WithTimeout(context.Background(), currentTimeouts().Metadata)
+	defer cancel()
+	reader, err := obj.NewReader(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, errors.DoesNotExist(fmt.Sprintf("GetGeneration: generation does not exist: %s", pathString))
+		}
+		return nil, readError(err, "Failed to open %s: %s", pathString, err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, readError(err, "Failed to read %s: %s", pathString, err)
+	}
+	return data, nil
+}
+
+// collectVersions lists the objects fetched by fetch that are prefix itself
+// or under it, as paths relative to root
+func collectVersions(ctx context.Context, fetch fetchPageFunc, root string, prefix string) ([]*ObjectVersion, error) {
+	versions := []*ObjectVersion{}
+	err := listPages(ctx, fetch, func(page []*storage.ObjectAttrs) error {
+		for _, attrs := range page {
+			if !isUnderPrefix(attrs.Name, prefix) {
+				continue
+			}
+			p := attrs.Name
+			if root != "" {
+				p = strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+			}
+			versions = append(versions, &ObjectVersion{
+				Path:       p,
+				Generation: attrs.Generation,
+				Size:       attrs.Size,
+				MD5:        attrs.MD5,
+				Created:    attrs.Created,
+				Deleted:    attrs.Deleted,
+				Metadata:   attrs.Metadata,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Path != versions[j].Path {
+			return versions[i].Path < versions[j].Path
+		}
+		return versions[i].Generation < versions[j].Generation
+	})
+	return versions, nil
+}
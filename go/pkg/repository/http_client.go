@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// HTTPOptions tunes the HTTP connections made to S3 and Google Cloud Storage.
+// Zero values use the defaults.
+type HTTPOptions struct {
+	// MaxIdleConnsPerHost is how many connections to each host are kept open
+	// between requests. Go's default of 2 means most of the connections opened
+	// by parallel uploads and downloads are thrown away after one request, so
+	// it defaults to the number of workers instead.
+	MaxIdleConnsPerHost int
+
+	// DisableHTTP2 makes requests over HTTP/1.1, with a connection for each
+	// request in flight, instead of multiplexing them over one connection
+	DisableHTTP2 bool
+
+	// DialTimeout is how long connecting can take. Default: 30 seconds
+	DialTimeout time.Duration
+
+	// ResponseHeaderTimeout is how long to wait for a response after sending a
+	// request. Default: no limit
+	ResponseHeaderTimeout time.Duration
+
+	// IdleConnTimeout is how long an idle connection is kept open. Default:
+	// 90 seconds
+	IdleConnTimeout time.Duration
+}
+
+// The clients are shared by every repository in the process, so connections
+// are reused between them, and between the commands run by the daemon
+var (
+	httpMu           sync.Mutex
+	httpOptions      HTTPOptions
+	sharedHTTPClient *http.Client
+	sharedGCSClient  *storage.Client
+	s3Sessions       = map[string]*session.Session{}
+)
+
+// ConfigureHTTP sets the options for connections made by repositories opened
+// after it is called. Repositories that are already open keep their clients.
+func ConfigureHTTP(opts HTTPOptions) {
+	httpMu.Lock()
+	defer httpMu.Unlock()
+	if opts == httpOptions {
+		return
+	}
+	httpOptions = opts
+	sharedHTTPClient = nil
+	sharedGCSClient = nil
+	s3Sessions = map[string]*session.Session{}
+}
+
+// newHTTPTransport returns a transport like http.DefaultTransport, with opts
+// applied
+func newHTTPTransport(opts HTTPOptions) *http.Transport {
+	dialTimeout := opts.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+	maxIdleConnsPerHost := opts.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost == 0 {
+		maxIdleConnsPerHost = maxWorkers
+	}
+	idleConnTimeout := opts.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = 90 * time.Second
+	}
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if opts.DisableHTTP2 {
+		// a non-nil, empty map turns off HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+// httpClient returns the shared HTTP client. httpMu must be held.
+func httpClient() *http.Client {
+	if sharedHTTPClient == nil {
+		sharedHTTPClient = &http.Client{Transport: newHTTPTransport(httpOptions)}
+	}
+	return sharedHTTPClient
+}
+
+// s3Session returns the shared session for S3 buckets in region
+func s3Session(region string) (*session.Session, error) {
+	httpMu.Lock()
+	defer httpMu.Unlock()
+	if sess, ok := s3Sessions[region]; ok {
+		return sess, nil
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region:                        aws.String(region),
+		CredentialsChainVerboseErrors: aws.Bool(true),
+		HTTPClient:                    httpClient(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s3Sessions[region] = sess
+	return sess, nil
+}
+
+// gcsClient returns the shared Google Cloud Storage client
+func gcsClient() (*storage.Client, error) {
+	httpMu.Lock()
+	defer httpMu.Unlock()
+	if sharedGCSClient != nil {
+		return sharedGCSClient, nil
+	}
+
+	// the client lasts as long as the process, so this can't time out
+	ctx := context.Background()
+	options := []option.ClientOption{option.WithScopes(storage.ScopeFullControl)}
+	if applicationCredentialsJSON := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON"); applicationCredentialsJSON != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(applicationCredentialsJSON), storage.ScopeReadWrite)
+		if err != nil {
+			return nil, errors.RepositoryConfigurationError(err.Error())
+		}
+		options = append(options, option.WithTokenSource(jwtConfig.TokenSource(ctx)))
+	}
+	// authenticate on top of the tuned transport, instead of the default one
+	transport, err := htransport.NewTransport(ctx, newHTTPTransport(httpOptions), options...)
+	if err != nil {
+		return nil, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to Google Cloud Storage: %v", err))
+	}
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to Google Cloud Storage: %v", err))
+	}
+	sharedGCSClient = client
+	return client, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	transport := newHTTPTransport(HTTPOptions{})
+	require.Equal(t, maxWorkers, transport.MaxIdleConnsPerHost)
+	require.True(t, transport.ForceAttemptHTTP2)
+	require.Nil(t, transport.TLSNextProto)
+	require.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+
+	transport = newHTTPTransport(HTTPOptions{MaxIdleConnsPerHost: 16, DisableHTTP2: true, ResponseHeaderTimeout: time.Minute})
+	require.Equal(t, 16, transport.MaxIdleConnsPerHost)
+	require.False(t, transport.ForceAttemptHTTP2)
+	require.NotNil(t, transport.TLSNextProto)
+	require.Equal(t, time.Minute, transport.ResponseHeaderTimeout)
+}
+
+func TestSharedS3Session(t *testing.T) {
+	defer ConfigureHTTP(HTTPOptions{})
+
+	sess, err := s3Session("us-east-1")
+	require.NoError(t, err)
+	again, err := s3Session("us-east-1")
+	require.NoError(t, err)
+	require.True(t, sess == again)
+	other, err := s3Session("eu-west-1")
+	require.NoError(t, err)
+	require.False(t, sess == other)
+
+	// configuring the same options keeps the clients, but new ones replace them
+	ConfigureHTTP(HTTPOptions{})
+	again, err = s3Session("us-east-1")
+	require.NoError(t, err)
+	require.True(t, sess == again)
+	ConfigureHTTP(HTTPOptions{DisableHTTP2: true})
+	again, err = s3Session("us-east-1")
+	require.NoError(t, err)
+	require.False(t, sess == again)
+}
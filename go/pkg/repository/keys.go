@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxKeyLength is the longest key, in bytes, that S3 and Google Cloud Storage
+// accept
+const MaxKeyLength = 1024
+
+// KeyProblems returns the reasons key would break on some repositories or
+// operating systems, e.g. when it is uploaded to S3 or checked out on
+// Windows. key is a slash-separated path.
+func KeyProblems(key string) []string {
+	problems := []string{}
+	if len(key) > MaxKeyLength {
+		problems = append(problems, "it is longer than 1024 bytes")
+	}
+	if strings.IndexFunc(key, unicode.IsControl) != -1 {
+		problems = append(problems, "it contains control characters")
+	}
+	if !utf8.ValidString(key) {
+		problems = append(problems, "it isn't valid UTF-8")
+	}
+	for _, component := range strings.Split(key, "/") {
+		if component != "." && component != ".." && strings.TrimRight(component, ". ") != component {
+			problems = append(problems, "a file or directory in it ends in a dot or space")
+			break
+		}
+	}
+	return problems
+}
+
+// SanitizeKey returns key with the problems KeyProblems finds fixed: control
+// characters and invalid UTF-8 are replaced with "_", as are dots and spaces
+// at the end of each file or directory, and the name of the file is shortened
+// if key is too long. Keys that are shortened end in a hash of the original
+// key, so different keys don't end up the same.
+func SanitizeKey(key string) string {
+	components := strings.Split(key, "/")
+	for i, component := range components {
+		component = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) || r == utf8.RuneError {
+				return '_'
+			}
+			return r
+		}, component)
+		if component != "." && component != ".." {
+			trimmed := strings.TrimRight(component, ". ")
+			component = trimmed + strings.Repeat("_", len(component)-len(trimmed))
+		}
+		components[i] = component
+	}
+	sanitized := strings.Join(components, "/")
+	if len(sanitized) <= MaxKeyLength {
+		return sanitized
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(hash[:])[:8]
+	dir, name := path.Split(sanitized)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	maxBase := MaxKeyLength - len(dir) - len(ext) - len(suffix)
+	if maxBase < 1 {
+		// the directories alone are too long, so there's nothing sensible
+		// to shorten it to
+		return sanitized
+	}
+	if len(base) > maxBase {
+		base = base[:maxBase]
+		// don't cut a character in half
+		for len(base) > 0 && !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+	}
+	return dir + base + suffix + ext
+}
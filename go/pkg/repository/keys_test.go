@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyProblems(t *testing.T) {
+	require.Empty(t, KeyProblems("model/weights.pth"))
+	require.Empty(t, KeyProblems("./model/../weights.pth"))
+	require.Equal(t, []string{"it contains control characters"}, KeyProblems("model/weights\n.pth"))
+	require.Equal(t, []string{"a file or directory in it ends in a dot or space"}, KeyProblems("model./weights.pth"))
+	require.Equal(t, []string{"a file or directory in it ends in a dot or space"}, KeyProblems("model/weights "))
+	require.Equal(t, []string{"it isn't valid UTF-8"}, KeyProblems("model/\xffweights.pth"))
+	require.Equal(t, []string{"it is longer than 1024 bytes"}, KeyProblems("model/"+strings.Repeat("a", 1020)+".pth"))
+}
+
+func TestSanitizeKey(t *testing.T) {
+	require.Equal(t, "model/weights.pth", SanitizeKey("model/weights.pth"))
+	require.Equal(t, "model/weights_.pth", SanitizeKey("model/weights\t.pth"))
+	require.Equal(t, "model_/weights__", SanitizeKey("model./weights. "))
+	require.Equal(t, "model/_weights.pth", SanitizeKey("model/\xffweights.pth"))
+
+	long := "model/" + strings.Repeat("a", 1020) + ".pth"
+	sanitized := SanitizeKey(long)
+	require.Len(t, sanitized, MaxKeyLength)
+	require.True(t, strings.HasPrefix(sanitized, "model/aaaa"))
+	require.True(t, strings.HasSuffix(sanitized, ".pth"))
+	require.Empty(t, KeyProblems(sanitized))
+	require.NotEqual(t, sanitized, SanitizeKey(long+"x"))
+
+	for _, key := range []string{"model/weights\t.pth", "model./weights. ", "model/\xffweights.pth"} {
+		require.Empty(t, KeyProblems(SanitizeKey(key)))
+	}
+}
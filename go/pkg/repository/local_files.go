@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
+)
+
+// partialPrefix is the prefix of the temporary files and directories that
+// downloads are written to before they are moved into place
+const partialPrefix = ".keepsake-partial-"
+
+// availableBytes is replaced in tests
+var availableBytes = files.AvailableBytes
+
+// checkDiskSpace returns an error if there isn't enough free space to
+// download needed bytes of what to localPath, so a download fails straight
+// away instead of when the disk is full
+func CheckDiskSpace(localPath string, needed int64, what string) error {
+	available, err := availableBytes(localPath)
+	if err != nil {
+		// it's only a check, so carry on and let the download fail if it must
+		console.Debug("Failed to check free disk space: %v", err)
+		return nil
+	}
+	if needed > 0 && uint64(needed) > available {
+		return errors.InsufficientDiskSpace(fmt.Sprintf("Not enough disk space to download %s to %s: it needs %s, but only %s is free.", what, localPath, console.FormatBytes(uint64(needed)), console.FormatBytes(available)))
+	}
+	return nil
+}
+
+// downloadFile is a file that is being downloaded to path. It is written to a
+// temporary file next to path, and only moved to path by Commit, so an
+// interrupted download never leaves a truncated file that looks complete.
+type downloadFile struct {
+	*os.File
+	path string
+}
+
+func createDownloadFile(path string) (*downloadFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create directory %s: %w", dir, err)
+	}
+	f, err := ioutil.TempFile(dir, partialPrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create file %s: %w", path, err)
+	}
+	// TempFile only lets the user read it, unlike os.Create
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("Failed to create file %s: %w", path, err)
+	}
+	return &downloadFile{File: f, path: path}, nil
+}
+
+// Commit moves the downloaded file to its path, syncing it to disk first if
+// --fsync is set
+func (f *downloadFile) Commit() error {
+	if global.FsyncDownloads {
+		if err := f.Sync(); err != nil {
+			f.Abort()
+			return fmt.Errorf("Failed to sync %s to disk: %w", f.path, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to write %s: %w", f.path, err)
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to move %s into place: %w", f.path, err)
+	}
+	return syncDir(filepath.Dir(f.path))
+}
+
+// Abort removes the partially downloaded file
+func (f *downloadFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// partialDir creates a temporary directory inside localPath to extract files
+// to before they are moved into place with moveFilesInto. It is inside
+// localPath so it is on the same filesystem, and the files can be renamed.
+func partialDir(localPath string) (string, error) {
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return "", fmt.Errorf("Failed to create directory %s: %w", localPath, err)
+	}
+	dir, err := ioutil.TempDir(localPath, partialPrefix)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create temporary directory in %s: %w", localPath, err)
+	}
+	return dir, nil
+}
+
+// moveFilesInto moves the files in srcDir to the same paths relative to
+// destDir, replacing files that are already there. If --fsync is set, each
+// file is synced to disk before it is moved.
+func moveFilesInto(srcDir string, destDir string) error {
+	return filepath.Walk(srcDir, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(srcDir, currentPath)
+		if err != nil {
+			return err
+		}
+		newPath, err := files.JoinWithin(destDir, filepath.ToSlash(relativePath))
+		if err != nil {
+			return err
+		}
+		dir := filepath.Dir(newPath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("Failed to create directory %q: %w", dir, err)
+		}
+		if global.FsyncDownloads && info.Mode().IsRegular() {
+			if err := syncFile(currentPath); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(currentPath, newPath); err != nil {
+			return err
+		}
+		return syncDir(dir)
+	})
+}
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("Failed to sync %s to disk: %w", path, err)
+	}
+	return nil
+}
+
+// syncDir syncs dir to disk if --fsync is set, so files that were renamed
+// into it are still there after a crash
+func syncDir(dir string) error {
+	if !global.FsyncDownloads {
+		return nil
+	}
+	return syncFile(dir)
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+	"github.com/replicate/keepsake/go/pkg/global"
+)
+
+func TestDownloadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, fsync := range []bool{false, true} {
+		global.FsyncDownloads = fsync
+		weightsPath := path.Join(dir, "model", "weights")
+
+		// nothing is at the path until it is committed
+		f, err := createDownloadFile(weightsPath)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("weights"))
+		require.NoError(t, err)
+		_, err = os.Stat(weightsPath)
+		require.True(t, os.IsNotExist(err))
+		require.NoError(t, f.Commit())
+		contents, err := ioutil.ReadFile(weightsPath)
+		require.NoError(t, err)
+		require.Equal(t, "weights", string(contents))
+		info, err := os.Stat(weightsPath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+		// an aborted download leaves the existing file alone, and cleans up
+		f, err = createDownloadFile(weightsPath)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("trunc"))
+		require.NoError(t, err)
+		f.Abort()
+		contents, err = ioutil.ReadFile(weightsPath)
+		require.NoError(t, err)
+		require.Equal(t, "weights", string(contents))
+		entries, err := ioutil.ReadDir(path.Join(dir, "model"))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		require.NoError(t, os.RemoveAll(weightsPath))
+	}
+	global.FsyncDownloads = false
+}
+
+func TestExtractTarCleansUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := NewDiskRepository(path.Join(dir, "repo"))
+	require.NoError(t, err)
+	sourceDir := path.Join(dir, "source")
+	require.NoError(t, os.MkdirAll(path.Join(sourceDir, "data"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(sourceDir, "data", "weights"), []byte("weights"), 0644))
+	require.NoError(t, repo.PutPathTar(sourceDir, "checkpoints/abc.tar.gz", ""))
+
+	outDir := path.Join(dir, "out")
+	require.NoError(t, repo.GetPathTar("checkpoints/abc.tar.gz", outDir))
+	require.NoError(t, repo.GetPathItemTar("checkpoints/abc.tar.gz", "data", path.Join(dir, "item")))
+	for _, d := range []string{outDir, path.Join(dir, "item")} {
+		contents, err := ioutil.ReadFile(path.Join(d, "data", "weights"))
+		require.NoError(t, err)
+		require.Equal(t, "weights", string(contents))
+		entries, err := ioutil.ReadDir(d)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "the temporary directory was removed")
+	}
+
+	// a truncated tarball doesn't leave any files behind
+	tarPath := path.Join(dir, "repo", "checkpoints", "abc.tar.gz")
+	data, err := ioutil.ReadFile(tarPath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "repo", "checkpoints", "truncated.tar.gz"), data[:len(data)/2], 0644))
+	truncatedOutDir := path.Join(dir, "truncated")
+	require.Error(t, repo.GetPathTar("checkpoints/truncated.tar.gz", truncatedOutDir))
+	entries, err := ioutil.ReadDir(truncatedOutDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the nearest parent that exists is used
+	available, err := files.AvailableBytes(path.Join(dir, "does", "not", "exist"))
+	require.NoError(t, err)
+	require.Greater(t, available, uint64(0))
+
+	defer func(f func(string) (uint64, error)) { availableBytes = f }(availableBytes)
+	availableBytes = func(string) (uint64, error) { return 1000, nil }
+
+	require.NoError(t, CheckDiskSpace(dir, 1000, "weights"))
+	err = CheckDiskSpace(dir, 2000, "weights")
+	require.True(t, errors.IsInsufficientDiskSpace(err))
+	require.Contains(t, err.Error(), "Not enough disk space to download weights")
+
+	// downloads fail before anything is written
+	repo, err := NewDiskRepository(path.Join(dir, "repo"))
+	require.NoError(t, err)
+	require.NoError(t, repo.Put("data/weights", make([]byte, 2000)))
+	outDir := path.Join(dir, "out")
+	err = repo.GetPath("data", outDir)
+	require.True(t, errors.IsInsufficientDiskSpace(err))
+	_, err = os.Stat(outDir)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/files"
+)
+
+// MemoryRepository is a repository that keeps everything in memory, for tests
+// that don't need a bucket, and for dry runs to keep track of what they would
+// have written. Latency and FailureRate can be set to simulate a slow or
+// unreliable bucket.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+
+	// Latency is added to every operation
+	Latency time.Duration
+
+	// FailureRate is the fraction of operations, between 0 and 1, that fail
+	// with a throttling error, which can be retried
+	FailureRate float64
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		objects: map[string][]byte{},
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Seed makes the failures injected by FailureRate happen in the same order
+// every time, for tests
+func (s *MemoryRepository) Seed(seed int64) {
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+	s.rand = rand.New(rand.NewSource(seed))
+}
+
+func (s *MemoryRepository) RootURL() string {
+	return "memory://"
+}
+
+// inject waits for Latency, and returns an error for FailureRate of calls
+func (s *MemoryRepository) inject(op string, p string) error {
+	if s.Latency > 0 {
+		time.Sleep(s.Latency)
+	}
+	if s.FailureRate > 0 {
+		s.randMu.Lock()
+		fail := s.rand.Float64() < s.FailureRate
+		s.randMu.Unlock()
+		if fail {
+			return errors.Throttled(fmt.Sprintf("%s %s/%s: injected failure", op, s.RootURL(), p))
+		}
+	}
+	return nil
+}
+
+// memoryKey normalizes p, so "a/b", "/a/b", and "a//b" are the same object
+func memoryKey(p string) string {
+	return strings.TrimPrefix(path.Join("/", p), "/")
+}
+
+// Get data at path
+func (s *MemoryRepository) Get(p string) ([]byte, error) {
+	if err := s.inject("Get", p); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.objects[memoryKey(p)]
+	if !ok {
+		return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %v", p))
+	}
+	return append([]byte{}, data...), nil
+}
+
+// GetPath recursively copies repoDir to localDir
+func (s *MemoryRepository) GetPath(repoDir string, localDir string) error {
+	if err := s.inject("GetPath", repoDir); err != nil {
+		return err
+	}
+	prefix := memoryKey(repoDir)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, data := range s.objects {
+		if !isUnderPrefix(key, prefix) {
+			continue
+		}
+		relPath := strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+		localPath, err := files.JoinWithin(localDir, relPath)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return readError(err, "Failed to create directory for %s: %v", localPath, err)
+		}
+		if err := ioutil.WriteFile(localPath, data, 0644); err != nil {
+			return readError(err, "Failed to write %s: %v", localPath, err)
+		}
+	}
+	return nil
+}
+
+// GetPathTar extracts tarball `tarPath` to `localPath`
+//
+// See repository.go for full documentation.
+func (s *MemoryRepository) GetPathTar(tarPath, localPath string) error {
+	return s.withTarFile(tarPath, func(tarFile string) error {
+		return extractTar(tarFile, localPath)
+	})
+}
+
+func (s *MemoryRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	return s.withTarFile(tarPath, func(tarFile string) error {
+		return extractTarItem(tarFile, itemPath, localPath)
+	})
+}
+
+// withTarFile writes the tarball at tarPath to a temporary file, for the
+// functions that read tarballs from disk
+func (s *MemoryRepository) withTarFile(tarPath string, fn func(tarFile string) error) error {
+	data, err := s.Get(tarPath)
+	if err != nil {
+		return err
+	}
+	tempDir, err := files.TempDir("memory-tar")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	tarFile := filepath.Join(tempDir, path.Base(tarPath))
+	if err := ioutil.WriteFile(tarFile, data, 0644); err != nil {
+		return err
+	}
+	return fn(tarFile)
+}
+
+// Put data at path
+func (s *MemoryRepository) Put(p string, data []byte) error {
+	if err := s.inject("Put", p); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[memoryKey(p)] = append([]byte{}, data...)
+	return nil
+}
+
+// PutPath recursively puts the local `localPath` directory into path `repoPath` in the repository
+func (s *MemoryRepository) PutPath(localPath string, repoPath string) error {
+	files, err := getListOfFilesToPut(localPath, repoPath)
+	if err != nil {
+		return writeError(err, "%v", err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file.Source)
+		if err != nil {
+			return writeError(err, "%v", err)
+		}
+		if err := s.Put(file.Dest, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutPathTar recursively puts the local `localPath` directory into a tar.gz file `tarPath` in the repository
+// If `includePath` is set, only that will be included.
+//
+// See repository.go for full documentation.
+func (s *MemoryRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	if !strings.HasSuffix(tarPath, ".tar.gz") {
+		return errors.WriteError("PutPathTar: tarPath must end with .tar.gz")
+	}
+	var buf bytes.Buffer
+	if err := putPathTar(localPath, &buf, path.Base(tarPath), includePath); err != nil {
+		return err
+	}
+	return s.Put(tarPath, buf.Bytes())
+}
+
+// Delete deletes path. If path is a directory, it recursively deletes
+// all everything under path
+func (s *MemoryRepository) Delete(p string) error {
+	if err := s.inject("Delete", p); err != nil {
+		return err
+	}
+	prefix := memoryKey(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.objects {
+		if isUnderPrefix(key, prefix) {
+			delete(s.objects, key)
+		}
+	}
+	return nil
+}
+
+// List files in a path non-recursively
+//
+// Returns a list of paths, prefixed with the given path, that can be passed straight to Get().
+// Directories are not listed.
+// If path does not exist, an empty list will be returned.
+func (s *MemoryRepository) List(p string) ([]string, error) {
+	if err := s.inject("List", p); err != nil {
+		return nil, err
+	}
+	dir := memoryKey(p)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := []string{}
+	for key := range s.objects {
+		parent := path.Dir(key)
+		if parent == "." {
+			parent = ""
+		}
+		if parent == dir {
+			result = append(result, path.Join(p, path.Base(key)))
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (s *MemoryRepository) ListTarFile(tarPath string) ([]string, error) {
+	var files []string
+	err := s.withTarFile(tarPath, func(tarFile string) error {
+		var err error
+		files, err = getListOfFilesInTar(tarFile)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tarname := path.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
+	for idx := range files {
+		files[idx] = strings.TrimPrefix(files[idx], tarname+"/")
+	}
+	return files, nil
+}
+
+// ListRecursive lists everything under folder, in order
+func (s *MemoryRepository) ListRecursive(results chan<- ListResult, folder string) {
+	s.listRecursive(results, folder, func(key string) bool { return true })
+}
+
+func (s *MemoryRepository) MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string) {
+	s.listRecursive(results, folder, func(key string) bool { return path.Base(key) == filename })
+}
+
+func (s *MemoryRepository) listRecursive(results chan<- ListResult, folder string, filter func(key string) bool) {
+	defer close(results)
+	if err := s.inject("ListRecursive", folder); err != nil {
+		results <- ListResult{Error: err}
+		return
+	}
+	prefix := memoryKey(folder)
+	s.mu.RLock()
+	listed := []ListResult{}
+	for key, data := range s.objects {
+		if isUnderPrefix(key, prefix) && filter(key) {
+			sum := md5.Sum(data)
+			listed = append(listed, ListResult{Path: key, MD5: sum[:], Size: int64(len(data))})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Path < listed[j].Path })
+	// sent after unlocking, so the reader can use the repository
+	for _, result := range listed {
+		results <- result
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("abc")))
+	require.NoError(t, repo.Put("/metadata/experiments/def.json", []byte("def")))
+	require.NoError(t, repo.Put("metadata/heartbeats/abc.json", []byte("abc")))
+	content, err := repo.Get("metadata/experiments/def.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("def"), content)
+	_, err = repo.Get("metadata/experiments/ghi.json")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	paths, err := repo.List("metadata/experiments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"metadata/experiments/abc.json", "metadata/experiments/def.json"}, paths)
+	paths, err = repo.List("metadata")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	results := make(chan ListResult)
+	go repo.ListRecursive(results, "metadata")
+	listed := []string{}
+	for result := range results {
+		require.NoError(t, result.Error)
+		listed = append(listed, result.Path)
+	}
+	require.Equal(t, []string{"metadata/experiments/abc.json", "metadata/experiments/def.json", "metadata/heartbeats/abc.json"}, listed)
+
+	require.NoError(t, repo.Delete("metadata/experiments"))
+	paths, err = repo.List("metadata/experiments")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+	_, err = repo.Get("metadata/heartbeats/abc.json")
+	require.NoError(t, err)
+}
+
+func TestMemoryRepositoryTarballs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(path.Join(dir, "data"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "data", "weights"), []byte("weights"), 0644))
+
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.PutPathTar(dir, "checkpoints/abc.tar.gz", ""))
+	files, err := repo.ListTarFile("checkpoints/abc.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, []string{"data/weights"}, files)
+
+	outDir := path.Join(dir, "out")
+	require.NoError(t, repo.GetPathTar("checkpoints/abc.tar.gz", outDir))
+	content, err := ioutil.ReadFile(path.Join(outDir, "data", "weights"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(content))
+
+	require.NoError(t, repo.PutPath(path.Join(dir, "data"), "files"))
+	outDir = path.Join(dir, "out-files")
+	require.NoError(t, repo.GetPath("files", outDir))
+	content, err = ioutil.ReadFile(path.Join(outDir, "weights"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(content))
+}
+
+func TestMemoryRepositoryFailures(t *testing.T) {
+	repo := NewMemoryRepository()
+	repo.Seed(1)
+	repo.FailureRate = 0.5
+
+	failures := 0
+	for i := 0; i < 100; i++ {
+		if err := repo.Put("file.txt", []byte("hello")); err != nil {
+			require.True(t, errors.IsRetryable(err))
+			failures++
+		}
+	}
+	require.True(t, failures > 25 && failures < 75, "%d failures", failures)
+
+	repo.FailureRate = 1
+	results := make(chan ListResult)
+	go repo.ListRecursive(results, "")
+	result := <-results
+	require.Error(t, result.Error)
+}
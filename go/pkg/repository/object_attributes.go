@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+const (
+	// cacheControlImmutable is for objects that are never changed after they
+	// are written, like checkpoint tarballs
+	cacheControlImmutable = "max-age=31536000, immutable"
+	// cacheControlNoCache is for metadata, which is rewritten as experiments
+	// run
+	cacheControlNoCache = "no-cache"
+
+	// metadataPrefix is the prefix of the custom metadata keys. S3 and GCS
+	// add their own prefix when they are sent as headers, e.g.
+	// x-amz-meta-keepsake-experiment-id.
+	metadataPrefix          = "keepsake-"
+	metadataKeyExperimentID = metadataPrefix + "experiment-id"
+	metadataKeyCheckpointID = metadataPrefix + "checkpoint-id"
+
+	contentTypeGzip    = "application/gzip"
+	contentTypeJSON    = "application/json"
+	contentTypeDefault = "application/octet-stream"
+)
+
+// objectAttributes are the HTTP headers and custom metadata that are set on
+// an object when it is uploaded
+type objectAttributes struct {
+	ContentType  string
+	CacheControl string
+	Metadata     map[string]string
+}
+
+// attributesForPath returns the attributes of the object at p, relative to
+// the root of the repository. The experiment or checkpoint ID is worked out
+// from where keepsake stores things, so an object found directly in the
+// bucket can be traced back to what wrote it.
+func attributesForPath(p string) objectAttributes {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	attrs := objectAttributes{
+		ContentType: contentType(p),
+		Metadata:    map[string]string{},
+	}
+
+	parts := strings.Split(p, "/")
+	base := parts[len(parts)-1]
+	switch {
+	case len(parts) == 2 && parts[0] == "checkpoints" && strings.HasSuffix(base, ".tar.gz"):
+		attrs.CacheControl = cacheControlImmutable
+		attrs.Metadata[metadataKeyCheckpointID] = strings.TrimSuffix(base, ".tar.gz")
+	case len(parts) == 2 && parts[0] == "experiments" && strings.HasSuffix(base, ".tar.gz"):
+		attrs.CacheControl = cacheControlImmutable
+		attrs.Metadata[metadataKeyExperimentID] = strings.TrimSuffix(base, ".tar.gz")
+	case len(parts) == 3 && parts[0] == "metadata" && strings.HasSuffix(base, ".json"):
+		// metadata/experiments, metadata/heartbeats, etc are all named
+		// after the experiment
+		attrs.CacheControl = cacheControlNoCache
+		attrs.Metadata[metadataKeyExperimentID] = strings.TrimSuffix(base, ".json")
+	case parts[0] == "metadata":
+		attrs.CacheControl = cacheControlNoCache
+	case parts[0] == "objects":
+		// deduplicated checkpoint files are named after their contents, so
+		// they never change, but they can be shared between checkpoints
+		attrs.CacheControl = cacheControlImmutable
+	}
+	return attrs
+}
+
+func contentType(p string) string {
+	switch {
+	case strings.HasSuffix(p, ".tar.gz"), strings.HasSuffix(p, ".tgz"):
+		return contentTypeGzip
+	case strings.HasSuffix(p, ".json"):
+		return contentTypeJSON
+	}
+	if t := mime.TypeByExtension(path.Ext(p)); t != "" {
+		return t
+	}
+	return contentTypeDefault
+}
+
+// relativeToRoot returns key, a full key in a bucket, relative to root
+func relativeToRoot(key string, root string) string {
+	if root == "" {
+		return key
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(key, strings.TrimSuffix(root, "/")), "/")
+}
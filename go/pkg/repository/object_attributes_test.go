@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributesForPath(t *testing.T) {
+	attrs := attributesForPath("checkpoints/1ccccccccc.tar.gz")
+	require.Equal(t, "application/gzip", attrs.ContentType)
+	require.Equal(t, cacheControlImmutable, attrs.CacheControl)
+	require.Equal(t, map[string]string{"keepsake-checkpoint-id": "1ccccccccc"}, attrs.Metadata)
+
+	attrs = attributesForPath("experiments/1eeeeeeeee.tar.gz")
+	require.Equal(t, "application/gzip", attrs.ContentType)
+	require.Equal(t, map[string]string{"keepsake-experiment-id": "1eeeeeeeee"}, attrs.Metadata)
+
+	attrs = attributesForPath("/metadata/heartbeats/1eeeeeeeee.json")
+	require.Equal(t, "application/json", attrs.ContentType)
+	require.Equal(t, cacheControlNoCache, attrs.CacheControl)
+	require.Equal(t, map[string]string{"keepsake-experiment-id": "1eeeeeeeee"}, attrs.Metadata)
+
+	attrs = attributesForPath("repository.json")
+	require.Equal(t, "application/json", attrs.ContentType)
+	require.Equal(t, "", attrs.CacheControl)
+	require.Empty(t, attrs.Metadata)
+
+	attrs = attributesForPath("objects/ab/abcdef")
+	require.Equal(t, "application/octet-stream", attrs.ContentType)
+	require.Equal(t, cacheControlImmutable, attrs.CacheControl)
+	require.Empty(t, attrs.Metadata)
+
+	attrs = attributesForPath("data/plot.png")
+	require.Equal(t, "image/png", attrs.ContentType)
+}
+
+func TestRelativeToRoot(t *testing.T) {
+	require.Equal(t, "checkpoints/abc.tar.gz", relativeToRoot("root/checkpoints/abc.tar.gz", "root"))
+	require.Equal(t, "checkpoints/abc.tar.gz", relativeToRoot("a/b/checkpoints/abc.tar.gz", "a/b/"))
+	require.Equal(t, "checkpoints/abc.tar.gz", relativeToRoot("checkpoints/abc.tar.gz", ""))
+}
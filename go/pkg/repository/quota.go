@@ -0,0 +1,28 @@
+package repository
+
+// Quota limits how many bytes of files experiments and checkpoints can save
+// to a repository. It is stored in the repository's spec, so it applies to
+// everyone who uses the repository. Zero means no limit.
+type Quota struct {
+	// The limit for the whole repository
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+
+	// The limit for each user, unless they have a limit in UserBytes
+	PerUserBytes int64 `json:"per_user_bytes,omitempty"`
+
+	// Limits for particular users, by username
+	UserBytes map[string]int64 `json:"user_bytes,omitempty"`
+}
+
+// UserLimit returns the limit for the user username, or 0 if they don't have one
+func (q *Quota) UserLimit(username string) int64 {
+	if limit, ok := q.UserBytes[username]; ok {
+		return limit
+	}
+	return q.PerUserBytes
+}
+
+// IsEmpty returns true if the quota doesn't limit anything
+func (q *Quota) IsEmpty() bool {
+	return q.TotalBytes == 0 && q.PerUserBytes == 0 && len(q.UserBytes) == 0
+}
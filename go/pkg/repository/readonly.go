@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// ReadOnlyRepository wraps a repository, reading from it as usual, but
+// failing with a ReadOnly error instead of writing or deleting anything
+type ReadOnlyRepository struct {
+	Repository
+}
+
+func NewReadOnlyRepository(repo Repository) *ReadOnlyRepository {
+	return &ReadOnlyRepository{Repository: repo}
+}
+
+func (s *ReadOnlyRepository) Put(p string, data []byte) error {
+	return s.readOnlyError("write", p)
+}
+
+func (s *ReadOnlyRepository) PutPath(localPath string, repoPath string) error {
+	return s.readOnlyError("write", repoPath)
+}
+
+func (s *ReadOnlyRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	return s.readOnlyError("write", tarPath)
+}
+
+func (s *ReadOnlyRepository) Delete(p string) error {
+	return s.readOnlyError("delete", p)
+}
+
+func (s *ReadOnlyRepository) readOnlyError(operation string, p string) error {
+	return errors.ReadOnly(fmt.Sprintf("Failed to %s %s/%s: the repository was opened read-only. Remove read_only from keepsake.yaml, or don't pass --read-only, to change it.", operation, s.RootURL(), p))
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestReadOnlyRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+
+	diskRepo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	require.NoError(t, diskRepo.Put("experiments/abc/file.txt", []byte("hello")))
+	require.NoError(t, ioutil.WriteFile(path.Join(localDir, "local.txt"), []byte("hello"), 0644))
+
+	repo := NewReadOnlyRepository(diskRepo)
+
+	content, err := repo.Get("experiments/abc/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), content)
+
+	err = repo.Put("new.txt", []byte("hello"))
+	require.True(t, errors.IsReadOnly(err))
+	require.Contains(t, err.Error(), "Failed to write file://"+dir+"/new.txt")
+	require.True(t, errors.IsReadOnly(repo.PutPath(localDir, "put-path")))
+	require.True(t, errors.IsReadOnly(repo.PutPathTar(localDir, "put-path.tar.gz", "")))
+	require.True(t, errors.IsReadOnly(repo.Delete("experiments/abc")))
+	for _, p := range []string{"new.txt", "put-path/local.txt", "put-path.tar.gz"} {
+		_, err := diskRepo.Get(p)
+		require.True(t, errors.IsDoesNotExist(err), p)
+	}
+	_, err = diskRepo.Get("experiments/abc/file.txt")
+	require.NoError(t, err)
+
+	// the metadata cache can still be found under it, so it can be synced
+	cachedRepo, err := NewCachedMetadataRepository(localDir, diskRepo)
+	require.NoError(t, err)
+	require.Equal(t, cachedRepo, FindCachedRepository(NewReadOnlyRepository(NewDryRunRepository(cachedRepo))))
+	require.Nil(t, FindCachedRepository(repo))
+}
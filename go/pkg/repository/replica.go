@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+// ReplicaRepository wraps a repository, reading the files saved with experiments and
+// checkpoints from replicas in preferred regions before falling back to the repository
+// itself. Everything else, including all writes, goes to the wrapped repository.
+//
+// Replicas may lag behind the repository, so if a file can't be read from a replica
+// the next one is tried.
+type ReplicaRepository struct {
+	Repository
+	replicas []Repository
+}
+
+// NewReplicaRepository returns a ReplicaRepository that reads from replicas in order
+func NewReplicaRepository(repo Repository, replicas []Repository) *ReplicaRepository {
+	return &ReplicaRepository{
+		Repository: repo,
+		replicas:   replicas,
+	}
+}
+
+func (s *ReplicaRepository) GetPathTar(tarPath, localPath string) error {
+	return s.readFromReplicas(tarPath, func(repo Repository) error {
+		return repo.GetPathTar(tarPath, localPath)
+	})
+}
+
+func (s *ReplicaRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	return s.readFromReplicas(tarPath, func(repo Repository) error {
+		return repo.GetPathItemTar(tarPath, itemPath, localPath)
+	})
+}
+
+func (s *ReplicaRepository) ListTarFile(tarPath string) ([]string, error) {
+	var paths []string
+	err := s.readFromReplicas(tarPath, func(repo Repository) error {
+		var err error
+		paths, err = repo.ListTarFile(tarPath)
+		return err
+	})
+	return paths, err
+}
+
+func (s *ReplicaRepository) readFromReplicas(p string, read func(repo Repository) error) error {
+	if !isArtifactPath(p) {
+		return read(s.Repository)
+	}
+	for _, replica := range s.replicas {
+		err := read(replica)
+		if err == nil {
+			console.Debug("Read %s from replica %s", p, replica.RootURL())
+			return nil
+		}
+		console.Debug("Failed to read %s from replica %s, trying the next one: %s", p, replica.RootURL(), err)
+	}
+	return read(s.Repository)
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sourceDir := path.Join(dir, "source")
+	require.NoError(t, os.MkdirAll(sourceDir, 0755))
+	writeTarball := func(repo Repository, content string) {
+		require.NoError(t, ioutil.WriteFile(path.Join(sourceDir, "weights"), []byte(content), 0644))
+		require.NoError(t, repo.PutPathTar(sourceDir, "checkpoints/abc.tar.gz", ""))
+	}
+
+	primary, err := NewDiskRepository(path.Join(dir, "primary"))
+	require.NoError(t, err)
+	nearReplica, err := NewDiskRepository(path.Join(dir, "near"))
+	require.NoError(t, err)
+	farReplica, err := NewDiskRepository(path.Join(dir, "far"))
+	require.NoError(t, err)
+
+	writeTarball(primary, "primary")
+	writeTarball(farReplica, "far")
+	repo := NewReplicaRepository(primary, []Repository{nearReplica, farReplica})
+
+	readWeights := func() string {
+		outputDir := path.Join(dir, "output")
+		require.NoError(t, os.RemoveAll(outputDir))
+		require.NoError(t, repo.GetPathTar("checkpoints/abc.tar.gz", outputDir))
+		content, err := ioutil.ReadFile(path.Join(outputDir, "weights"))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// Near replica hasn't got it yet, so it falls back to the far one
+	require.Equal(t, "far", readWeights())
+
+	writeTarball(nearReplica, "near")
+	require.Equal(t, "near", readWeights())
+
+	// Falls back to the primary if no replicas have it
+	require.NoError(t, nearReplica.Delete("checkpoints/abc.tar.gz"))
+	require.NoError(t, farReplica.Delete("checkpoints/abc.tar.gz"))
+	require.Equal(t, "primary", readWeights())
+
+	// Writes only go to the primary
+	require.NoError(t, repo.Put("metadata/experiments/def.json", []byte("{}")))
+	_, err = nearReplica.Get("metadata/experiments/def.json")
+	require.Error(t, err)
+	data, err := primary.Get("metadata/experiments/def.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("{}"), data)
+}
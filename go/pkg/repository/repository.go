@@ -4,11 +4,13 @@ import (
 	"archive/tar"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mholt/archiver/v3"
@@ -30,9 +32,13 @@ const (
 )
 
 type ListResult struct {
-	Path  string
-	MD5   []byte
-	Error error
+	Path string
+	MD5  []byte
+	Size int64
+	// Modified is when the object was last written, by the storage's clock,
+	// or the zero time if the storage doesn't say
+	Modified time.Time
+	Error    error
 }
 
 // Repository represents a blob store
@@ -99,6 +105,29 @@ type Repository interface {
 	MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string)
 }
 
+// existsChecker is implemented by repositories that can check whether there
+// is a file at a path without downloading it or listing its directory
+type existsChecker interface {
+	Exists(path string) (bool, error)
+}
+
+// exists returns true if there is a file at p in repo
+func exists(repo Repository, p string) (bool, error) {
+	if checker, ok := repo.(existsChecker); ok {
+		return checker.Exists(p)
+	}
+	paths, err := repo.List(path.Dir(p))
+	if err != nil {
+		return false, err
+	}
+	for _, listed := range paths {
+		if listed == p {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // SplitURL splits a repository URL into <scheme>://<path>
 func SplitURL(repositoryURL string) (scheme Scheme, bucket string, root string, err error) {
 	u, err := url.Parse(repositoryURL)
@@ -147,28 +176,79 @@ type fileToPut struct {
 	Info   os.FileInfo
 }
 
+// DefaultIgnorePatterns are left out of the files saved with experiments and
+// checkpoints, as well as the patterns in .keepsakeignore, because they are
+// caches and build artifacts that are rarely wanted and can be huge. They are
+// matched before the patterns in .keepsakeignore, so they can be included
+// again with "!", e.g. "!wandb/".
+var DefaultIgnorePatterns = []string{"__pycache__/", ".ipynb_checkpoints/", "node_modules/", "*.pyc", "wandb/", ".venv/"}
+
+var (
+	ignoreMu              sync.Mutex
+	defaultIgnoreDisabled bool
+)
+
+// ConfigureDefaultIgnore sets whether DefaultIgnorePatterns are left out of
+// the files saved with experiments and checkpoints
+func ConfigureDefaultIgnore(enabled bool) {
+	ignoreMu.Lock()
+	defer ignoreMu.Unlock()
+	defaultIgnoreDisabled = !enabled
+}
+
+// snapshotIgnorePatterns returns the default patterns to leave out of the
+// files in includePath, unless they have been turned off, or includePath is
+// one of them, so it was asked for explicitly
+func snapshotIgnorePatterns(includePath string) []string {
+	ignoreMu.Lock()
+	disabled := defaultIgnoreDisabled
+	ignoreMu.Unlock()
+	if disabled {
+		return nil
+	}
+	defaults, _ := gitignore.CompileIgnoreLines(DefaultIgnorePatterns...)
+	includePath = filepath.ToSlash(filepath.Clean(includePath))
+	if includePath != "." && (defaults.MatchesPath(includePath) || defaults.MatchesPath(includePath+"/")) {
+		return nil
+	}
+	return DefaultIgnorePatterns
+}
+
 func getListOfFilesToPut(localPath string, repoPath string) ([]fileToPut, error) {
+	return listFilesToPut(localPath, repoPath, nil)
+}
+
+// listFilesToPut returns the files in localPath that aren't ignored, and
+// where they go in repoPath. defaultPatterns are ignored as well as the
+// patterns in .keepsakeignore, which can include them again.
+func listFilesToPut(localPath string, repoPath string, defaultPatterns []string) ([]fileToPut, error) {
 	// Perhaps this should be configurable, or done at a higher-level? It seems odd this is done at such a low level.
-	var ignore *gitignore.GitIgnore
-	var err error
-	ignoreFilePath := filepath.Join(localPath, ".keepsakeignore")
-	deprecatedIgnoreFilePath := filepath.Join(localPath, ".replicateignore")
+	lines := append([]string{}, defaultPatterns...)
 	if isDir, _ := files.IsDir(localPath); isDir {
-		if exists, _ := files.FileExists(ignoreFilePath); exists {
-			ignore, err = gitignore.CompileIgnoreFile(ignoreFilePath)
-			if err != nil {
-				return nil, err
+		// .replicateignore is deprecated, and only read if there is no .keepsakeignore
+		for _, name := range []string{".keepsakeignore", ".replicateignore"} {
+			data, err := ioutil.ReadFile(filepath.Join(localPath, name))
+			if os.IsNotExist(err) {
+				continue
 			}
-		} else if exists, _ := files.FileExists(deprecatedIgnoreFilePath); exists {
-			ignore, err = gitignore.CompileIgnoreFile(deprecatedIgnoreFilePath)
 			if err != nil {
 				return nil, err
 			}
+			lines = append(lines, strings.Split(string(data), "\n")...)
+			break
 		}
 	}
+	var ignore *gitignore.GitIgnore
+	if len(lines) > 0 {
+		ignore, _ = gitignore.CompileIgnoreLines(lines...)
+	}
+	var defaults *gitignore.GitIgnore
+	if len(defaultPatterns) > 0 {
+		defaults, _ = gitignore.CompileIgnoreLines(defaultPatterns...)
+	}
 
 	result := []fileToPut{}
-	err = filepath.Walk(localPath, func(currentPath string, info os.FileInfo, err error) error {
+	err := filepath.Walk(localPath, func(currentPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -186,6 +266,18 @@ func getListOfFilesToPut(localPath string, repoPath string) ([]fileToPut, error)
 			if isVenv {
 				return filepath.SkipDir
 			}
+			// don't walk directories like node_modules at all, unless
+			// .keepsakeignore includes them again
+			if defaults != nil && currentPath != localPath {
+				relativePath, err := filepath.Rel(localPath, currentPath)
+				if err != nil {
+					return err
+				}
+				dirPath := filepath.ToSlash(relativePath) + "/"
+				if defaults.MatchesPath(dirPath) && ignore.MatchesPath(dirPath) {
+					return filepath.SkipDir
+				}
+			}
 
 			return nil
 		}
@@ -255,11 +347,32 @@ func putPathTar(localPath string, out io.Writer, tarFileName string, includePath
 	return nil
 }
 
+// extractTar extracts tarPath to a temporary directory, then moves the files
+// into localPath, so an interrupted extraction doesn't leave truncated files
+// in localPath
 func extractTar(tarPath, localPath string) error {
+	// the files will take up at least as much space as the compressed tarball
+	if info, err := os.Stat(tarPath); err == nil {
+		if err := CheckDiskSpace(localPath, info.Size(), "the files in "+filepath.Base(tarPath)); err != nil {
+			return err
+		}
+	}
+	tmpDir, err := partialDir(localPath)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := checkTarPaths(tarPath); err != nil {
+		return err
+	}
+
 	tar := archiver.NewTarGz()
 	tar.StripComponents = 1
 	tar.OverwriteExisting = true
-	return tar.Unarchive(tarPath, localPath)
+	if err := tar.Unarchive(tarPath, tmpDir); err != nil {
+		return tarError(tarPath, err)
+	}
+	return moveFilesInto(tmpDir, localPath)
 }
 
 func getListOfFilesInTar(tarPath string) ([]string, error) {
@@ -275,8 +388,64 @@ func getListOfFilesInTar(tarPath string) ([]string, error) {
 		result = append(result, th.Name)
 		return nil
 	})
+	if err != nil {
+		return nil, tarError(tarPath, err)
+	}
+	return result, nil
+}
 
-	return result, err
+// checkTarPaths returns an error if extracting tarPath would write outside
+// the directory it is extracted to, because an entry's path has "..", a hard
+// link's target is outside it, or an entry is inside a symlink that comes
+// before it in the tarball. Symlinks themselves can point anywhere, because
+// they are saved as they are, but nothing is written through them.
+func checkTarPaths(tarPath string) error {
+	symlinks := map[string]bool{}
+	// Walk doesn't keep the code of errors that are returned to it, so the
+	// walk is stopped and the error is returned afterwards
+	var unsafe error
+	t := archiver.NewTarGz()
+	err := t.Walk(tarPath, func(f archiver.File) error {
+		th, ok := f.Header.(*tar.Header)
+		if !ok {
+			return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+		}
+		// the first component is stripped when it is extracted
+		name := th.Name
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		if escapesDir(name) {
+			unsafe = errors.Corrupt(fmt.Sprintf("The tarball %s has the path %q, which is outside the directory it is extracted to", filepath.Base(tarPath), th.Name))
+			return archiver.ErrStopWalk
+		}
+		if th.Typeflag == tar.TypeLink && escapesDir(th.Linkname) {
+			unsafe = errors.Corrupt(fmt.Sprintf("The tarball %s has a hard link from %q to %q, which is outside the directory it is extracted to", filepath.Base(tarPath), th.Name, th.Linkname))
+			return archiver.ErrStopWalk
+		}
+		name = path.Clean(name)
+		for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				unsafe = errors.Corrupt(fmt.Sprintf("The tarball %s has the path %q, which is inside the symlink %q", filepath.Base(tarPath), th.Name, dir))
+				return archiver.ErrStopWalk
+			}
+		}
+		if th.Typeflag == tar.TypeSymlink {
+			symlinks[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return tarError(tarPath, err)
+	}
+	return unsafe
+}
+
+// escapesDir returns true if the slash-separated path p is absolute, or
+// leaves the directory it is relative to with ".."
+func escapesDir(p string) bool {
+	cleaned := path.Clean(p)
+	return path.IsAbs(p) || cleaned == ".." || strings.HasPrefix(cleaned, "../")
 }
 
 func extractTarItem(tarPath, itemPath, localPath string) error {
@@ -300,60 +469,32 @@ func extractTarItem(tarPath, itemPath, localPath string) error {
 	if !itemPathExists {
 		return errors.DoesNotExist("Path does not exist inside the tarfile: " + itemPath)
 	}
-
-	tmpDir, err := files.TempDir("temp-extract-dir")
+	tmpDir, err := partialDir(localPath)
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(tmpDir)
+	if err := checkTarPaths(tarPath); err != nil {
+		return err
+	}
 
 	tar := archiver.NewTarGz()
 	tar.StripComponents = 1
 	tar.OverwriteExisting = true
 	err = tar.Extract(tarPath, fullItemPath, tmpDir)
 	if err != nil {
-		return err
+		return tarError(tarPath, err)
 	}
 
-	walkPath := path.Join(tmpDir, tarBaseName)
-	err = filepath.Walk(walkPath, func(currentPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		relativePath, err := filepath.Rel(walkPath, currentPath)
-		if err != nil {
-			return err
-		}
-		newPath := path.Join(localPath, relativePath)
-
-		dir := filepath.Dir(newPath)
-
-		exists, err := files.FileExists(dir)
-		if err != nil {
-			return err
-		}
-
-		if !exists {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return fmt.Errorf("Failed to create directory %q: %w", dir, err)
-			}
-		}
-		err = os.Rename(currentPath, newPath)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
-
-	if err != nil {
-		return err
-	}
+	return moveFilesInto(path.Join(tmpDir, tarBaseName), localPath)
+}
 
-	return nil
+// isUnderPrefix returns true if key is prefix itself, or in the directory
+// prefix. Listing a prefix in a bucket also returns keys that just start with
+// it, e.g. "a/b.tar.gz.versions/c" for "a/b.tar.gz".
+func isUnderPrefix(key string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+"/")
 }
 
 // NeedsCaching returns true if the repository URL is slow and needs caching
@@ -380,6 +521,28 @@ func isVirtualenvDir(path string) (bool, error) {
 	return files.FileExists(filepath.Join(path, "pyvenv.cfg"))
 }
 
+// ListFilesToSave returns the paths, relative to localPath, of the files in
+// includePath that would be saved from localPath, i.e. leaving out the ones
+// that are ignored
+func ListFilesToSave(localPath string, includePath string) ([]string, error) {
+	includePath = filepath.Join(includePath)
+	filesToPut, err := listFilesToPut(localPath, "", snapshotIgnorePatterns(includePath))
+	if err != nil {
+		return nil, err
+	}
+	relPaths := []string{}
+	for _, file := range filesToPut {
+		relPath, err := filepath.Rel(localPath, file.Source)
+		if err != nil {
+			return nil, err
+		}
+		if includePath == "." || relPath == includePath || strings.HasPrefix(relPath, includePath+"/") {
+			relPaths = append(relPaths, relPath)
+		}
+	}
+	return relPaths, nil
+}
+
 func CopyToTempDir(localPath string, includePath string) (tempDir string, err error) {
 	// normalize path
 	includePath = filepath.Join(includePath)
@@ -395,7 +558,7 @@ func CopyToTempDir(localPath string, includePath string) (tempDir string, err er
 	// we first scan the whole repository to get the list of eligable files,
 	// then copy the ones that match the includePath.
 	// TODO(andreas): only scan files in the includePath
-	filesToCopy, err := getListOfFilesToPut(localPath, tempDir)
+	filesToCopy, err := listFilesToPut(localPath, tempDir, snapshotIgnorePatterns(includePath))
 	if err != nil {
 		return "", err
 	}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -40,6 +42,15 @@ Make sure your repository URL starts with either 'file://', 's3://', or 'gs://'.
 See the documentation for more details: https://keepsake.ai/docs/reference/yaml`)), shim(SplitURL("/foo/bar")))
 }
 
+func TestIsUnderPrefix(t *testing.T) {
+	require.True(t, isUnderPrefix("root/checkpoints/abc.tar.gz", "root/checkpoints/abc.tar.gz"))
+	require.True(t, isUnderPrefix("root/data/weights", "root/data"))
+	require.True(t, isUnderPrefix("root/data/weights", "root/data/"))
+	require.True(t, isUnderPrefix("anything", ""))
+	require.False(t, isUnderPrefix("root/checkpoints/abc.tar.gz.versions/1.tar.gz", "root/checkpoints/abc.tar.gz"))
+	require.False(t, isUnderPrefix("root/database", "root/data"))
+}
+
 func TestListOfFilesToPut(t *testing.T) {
 	tmpDir, err := files.TempDir("repository-test")
 	require.NoError(t, err)
@@ -92,6 +103,40 @@ func TestListOfFilesToPut(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestListFilesToSaveDefaultIgnore(t *testing.T) {
+	tmpDir, err := files.TempDir("repository-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	for _, p := range []string{"train.py", "__pycache__/train.cpython-38.pyc", "src/util.pyc", "node_modules/left-pad/index.js", "wandb/run-1/files.txt", "notebooks/.ipynb_checkpoints/a.ipynb", ".venv/bin/python"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, p)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, p), []byte("hello"), 0644))
+	}
+
+	paths, err := ListFilesToSave(tmpDir, ".")
+	require.NoError(t, err)
+	require.Equal(t, []string{"train.py"}, paths)
+
+	// paths that match the defaults are saved if they are asked for
+	paths, err = ListFilesToSave(tmpDir, "wandb")
+	require.NoError(t, err)
+	require.Equal(t, []string{"wandb/run-1/files.txt"}, paths)
+
+	// .keepsakeignore can include them again
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, ".keepsakeignore"), []byte("!wandb/\n"), 0644))
+	paths, err = ListFilesToSave(tmpDir, ".")
+	require.NoError(t, err)
+	sort.Strings(paths)
+	require.Equal(t, []string{".keepsakeignore", "train.py", "wandb/run-1/files.txt"}, paths)
+
+	// or they can be turned off
+	ConfigureDefaultIgnore(false)
+	defer ConfigureDefaultIgnore(true)
+	paths, err = ListFilesToSave(tmpDir, ".")
+	require.NoError(t, err)
+	require.Len(t, paths, 8)
+}
+
 func TestExtractTarItem(t *testing.T) {
 	dir, err := ioutil.TempDir("", "keepsake-test")
 	require.NoError(t, err)
@@ -152,6 +197,72 @@ func TestExtractTarItem(t *testing.T) {
 	require.True(t, errors.IsDoesNotExist(err))
 }
 
+func TestExtractTarPathTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTar := func(name string, headers ...*tar.Header) string {
+		// the first component of the paths in the tarball is its name
+		tarPath := path.Join(dir, name, "chk.tar.gz")
+		require.NoError(t, os.MkdirAll(path.Dir(tarPath), 0755))
+		f, err := os.Create(tarPath)
+		require.NoError(t, err)
+		defer f.Close()
+		gz := gzip.NewWriter(f)
+		tw := tar.NewWriter(gz)
+		for _, hdr := range headers {
+			if hdr.Typeflag == tar.TypeReg {
+				hdr.Mode = 0644
+				hdr.Size = int64(len("evil"))
+			}
+			require.NoError(t, tw.WriteHeader(hdr))
+			if hdr.Typeflag == tar.TypeReg {
+				_, err := tw.Write([]byte("evil"))
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+		return tarPath
+	}
+	outside := path.Join(dir, "outside")
+	require.NoError(t, os.MkdirAll(outside, 0755))
+
+	for _, tarPath := range []string{
+		writeTar("dotdot", &tar.Header{Name: "chk/../../outside/evil", Typeflag: tar.TypeReg}),
+		writeTar("hardlink", &tar.Header{Name: "chk/evil", Typeflag: tar.TypeLink, Linkname: "../../outside/evil"}),
+		writeTar("through-symlink",
+			&tar.Header{Name: "chk/link", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0777},
+			&tar.Header{Name: "chk/link/evil", Typeflag: tar.TypeReg}),
+	} {
+		err := extractTar(tarPath, path.Join(dir, "out"))
+		require.True(t, errors.IsCorrupt(err), "%s: %v", tarPath, err)
+		err = extractTarItem(tarPath, "", path.Join(dir, "item"))
+		require.True(t, errors.IsCorrupt(err), "%s: %v", tarPath, err)
+	}
+	entries, err := ioutil.ReadDir(outside)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// symlinks that point outside are saved as they are
+	tarPath := writeTar("symlink", &tar.Header{Name: "chk/data", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0777})
+	outDir := path.Join(dir, "symlink")
+	require.NoError(t, extractTar(tarPath, outDir))
+	target, err := os.Readlink(path.Join(outDir, "data"))
+	require.NoError(t, err)
+	require.Equal(t, outside, target)
+
+	// but nothing is moved into place through them
+	srcDir := path.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(path.Join(srcDir, "data"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(srcDir, "data", "evil"), []byte("evil"), 0644))
+	require.True(t, errors.IsCorrupt(moveFilesInto(srcDir, outDir)))
+	entries, err = ioutil.ReadDir(outside)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
 func TestCopyToTempDir(t *testing.T) {
 	dir, err := files.TempDir("test")
 	require.NoError(t, err)
@@ -0,0 +1,349 @@
+// Package repositorytest is a conformance test suite for implementations of
+// repository.Repository. A backend checks it behaves like the built-in ones
+// by running the suite against a fresh, empty repository:
+//
+//	func TestConformance(t *testing.T) {
+//	    repositorytest.Run(t, func(t *testing.T) repository.Repository {
+//	        return NewMyRepository(...)
+//	    })
+//	}
+package repositorytest
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+// NewRepositoryFunc returns a new, empty repository for a test. Anything it
+// creates can be cleaned up with t.Cleanup.
+type NewRepositoryFunc func(t *testing.T) repository.Repository
+
+// Run runs every conformance test as a subtest of t, each against its own
+// repository from newRepository
+func Run(t *testing.T, newRepository NewRepositoryFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo repository.Repository)
+	}{
+		{"PutGet", testPutGet},
+		{"GetDoesNotExist", testGetDoesNotExist},
+		{"EmptyObject", testEmptyObject},
+		{"UnicodeKeys", testUnicodeKeys},
+		{"List", testList},
+		{"ListRecursive", testListRecursive},
+		{"MatchFilenamesRecursive", testMatchFilenamesRecursive},
+		{"Delete", testDelete},
+		{"PutPathGetPath", testPutPathGetPath},
+		{"EmptyDirectory", testEmptyDirectory},
+		{"Tarballs", testTarballs},
+		{"ConcurrentWrites", testConcurrentWrites},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+// tempDir returns a local directory that is removed when t finishes
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func writeFile(t *testing.T, p string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+}
+
+func requireFileContent(t *testing.T, p string, content string) {
+	data, err := ioutil.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+}
+
+// listRecursive returns everything ListRecursive lists under folder, sorted by
+// path, because repositories don't have to list in order
+func listRecursive(t *testing.T, repo repository.Repository, folder string) []repository.ListResult {
+	results := make(chan repository.ListResult)
+	go repo.ListRecursive(results, folder)
+	return collect(t, results)
+}
+
+func collect(t *testing.T, results <-chan repository.ListResult) []repository.ListResult {
+	listed := []repository.ListResult{}
+	for result := range results {
+		require.NoError(t, result.Error)
+		listed = append(listed, result)
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Path < listed[j].Path })
+	return listed
+}
+
+func paths(results []repository.ListResult) []string {
+	ps := []string{}
+	for _, result := range results {
+		ps = append(ps, result.Path)
+	}
+	return ps
+}
+
+func testPutGet(t *testing.T, repo repository.Repository) {
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("hello")))
+	data, err := repo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	// overwriting replaces the whole object, even with shorter data
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("bye")))
+	data, err = repo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	require.Equal(t, "bye", string(data))
+}
+
+func testGetDoesNotExist(t *testing.T, repo repository.Repository) {
+	_, err := repo.Get("does-not-exist.json")
+	require.True(t, errors.IsDoesNotExist(err), "Get of a missing path should be a DoesNotExist error, not %v", err)
+
+	// nor does a path that is a prefix of something that does
+	require.NoError(t, repo.Put("dir/file.json", []byte("hello")))
+	_, err = repo.Get("dir/file")
+	require.True(t, errors.IsDoesNotExist(err), "Get of a missing path should be a DoesNotExist error, not %v", err)
+}
+
+func testEmptyObject(t *testing.T, repo repository.Repository) {
+	require.NoError(t, repo.Put("empty.json", []byte{}))
+	data, err := repo.Get("empty.json")
+	require.NoError(t, err)
+	require.Empty(t, data)
+
+	listed := listRecursive(t, repo, "")
+	require.Equal(t, []string{"empty.json"}, paths(listed))
+	require.Equal(t, int64(0), listed[0].Size)
+}
+
+func testUnicodeKeys(t *testing.T, repo repository.Repository) {
+	keys := []string{
+		"metadata/données/模型.json",
+		"metadata/données/with spaces.json",
+		"metadata/données/emoji-🚀.json",
+	}
+	for _, key := range keys {
+		require.NoError(t, repo.Put(key, []byte(key)))
+	}
+	for _, key := range keys {
+		data, err := repo.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, key, string(data))
+	}
+
+	listed, err := repo.List("metadata/données")
+	require.NoError(t, err)
+	sort.Strings(listed)
+	expected := append([]string{}, keys...)
+	sort.Strings(expected)
+	require.Equal(t, expected, listed)
+	require.Equal(t, expected, paths(listRecursive(t, repo, "metadata")))
+}
+
+func testList(t *testing.T, repo repository.Repository) {
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("abc")))
+	require.NoError(t, repo.Put("metadata/experiments/def.json", []byte("def")))
+	require.NoError(t, repo.Put("metadata/experiments/nested/ghi.json", []byte("ghi")))
+	require.NoError(t, repo.Put("metadata/experiments-other/jkl.json", []byte("jkl")))
+
+	// directories aren't listed, and neither is anything in them
+	listed, err := repo.List("metadata/experiments")
+	require.NoError(t, err)
+	sort.Strings(listed)
+	require.Equal(t, []string{"metadata/experiments/abc.json", "metadata/experiments/def.json"}, listed)
+
+	listed, err = repo.List("metadata")
+	require.NoError(t, err)
+	require.Empty(t, listed)
+
+	listed, err = repo.List("does-not-exist")
+	require.NoError(t, err)
+	require.Empty(t, listed)
+}
+
+func testListRecursive(t *testing.T, repo repository.Repository) {
+	require.Empty(t, listRecursive(t, repo, "checkpoints"))
+
+	require.NoError(t, repo.Put("checkpoints/abc.json", []byte("abc")))
+	require.NoError(t, repo.Put("checkpoints/nested/deeper/def.json", []byte("defg")))
+	require.NoError(t, repo.Put("checkpoints-other/ghi.json", []byte("ghi")))
+
+	listed := listRecursive(t, repo, "checkpoints")
+	require.Equal(t, []string{"checkpoints/abc.json", "checkpoints/nested/deeper/def.json"}, paths(listed))
+	// the storage doesn't have to say when objects were written, but if it
+	// does, it is around now by its clock
+	for i := range listed {
+		if !listed[i].Modified.IsZero() {
+			require.WithinDuration(t, time.Now(), listed[i].Modified, 24*time.Hour)
+		}
+		listed[i].Modified = time.Time{}
+	}
+	abcSum := md5.Sum([]byte("abc"))
+	require.Equal(t, repository.ListResult{Path: "checkpoints/abc.json", MD5: abcSum[:], Size: 3}, listed[0])
+	defSum := md5.Sum([]byte("defg"))
+	require.Equal(t, repository.ListResult{Path: "checkpoints/nested/deeper/def.json", MD5: defSum[:], Size: 4}, listed[1])
+}
+
+func testMatchFilenamesRecursive(t *testing.T, repo repository.Repository) {
+	results := make(chan repository.ListResult)
+	go repo.MatchFilenamesRecursive(results, "experiments", "keepsake-metadata.json")
+	require.Empty(t, collect(t, results))
+
+	require.NoError(t, repo.Put("experiments/abc/keepsake-metadata.json", []byte("abc")))
+	require.NoError(t, repo.Put("experiments/abc/other.json", []byte("abc")))
+	require.NoError(t, repo.Put("experiments/def/nested/keepsake-metadata.json", []byte("def")))
+	require.NoError(t, repo.Put("other/keepsake-metadata.json", []byte("other")))
+
+	results = make(chan repository.ListResult)
+	go repo.MatchFilenamesRecursive(results, "experiments", "keepsake-metadata.json")
+	require.Equal(t, []string{
+		"experiments/abc/keepsake-metadata.json",
+		"experiments/def/nested/keepsake-metadata.json",
+	}, paths(collect(t, results)))
+}
+
+func testDelete(t *testing.T, repo repository.Repository) {
+	require.NoError(t, repo.Put("dir/a.json", []byte("a")))
+	require.NoError(t, repo.Put("dir/nested/b.json", []byte("b")))
+	require.NoError(t, repo.Put("dir-other/c.json", []byte("c")))
+	require.NoError(t, repo.Put("file.json", []byte("d")))
+
+	// a single object
+	require.NoError(t, repo.Delete("file.json"))
+	_, err := repo.Get("file.json")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	// a directory, recursively, but not a sibling with the same prefix
+	require.NoError(t, repo.Delete("dir"))
+	require.Equal(t, []string{"dir-other/c.json"}, paths(listRecursive(t, repo, "")))
+
+	// deleting something that doesn't exist is not an error
+	require.NoError(t, repo.Delete("does-not-exist"))
+}
+
+func testPutPathGetPath(t *testing.T, repo repository.Repository) {
+	dir := tempDir(t)
+	writeFile(t, filepath.Join(dir, "in", "weights"), "weights")
+	writeFile(t, filepath.Join(dir, "in", "nested", "données.txt"), "data")
+
+	require.NoError(t, repo.PutPath(filepath.Join(dir, "in"), "files"))
+	require.Equal(t, []string{"files/nested/données.txt", "files/weights"}, paths(listRecursive(t, repo, "files")))
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, repo.GetPath("files", out))
+	requireFileContent(t, filepath.Join(out, "weights"), "weights")
+	requireFileContent(t, filepath.Join(out, "nested", "données.txt"), "data")
+
+	// a single file
+	require.NoError(t, repo.PutPath(filepath.Join(dir, "in", "weights"), "single/weights"))
+	data, err := repo.Get("single/weights")
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(data))
+}
+
+func testEmptyDirectory(t *testing.T, repo repository.Repository) {
+	dir := tempDir(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "in", "empty"), 0755))
+	writeFile(t, filepath.Join(dir, "in", "file.txt"), "hello")
+
+	// empty directories can't be stored in blob storage, so they aren't
+	// stored anywhere
+	require.NoError(t, repo.PutPath(filepath.Join(dir, "in"), "files"))
+	require.Equal(t, []string{"files/file.txt"}, paths(listRecursive(t, repo, "files")))
+
+	require.NoError(t, repo.PutPath(filepath.Join(dir, "in", "empty"), "empty"))
+	require.Empty(t, listRecursive(t, repo, "empty"))
+
+	// but they can be tarred
+	require.NoError(t, repo.PutPathTar(filepath.Join(dir, "in", "empty"), "empty.tar.gz", ""))
+	out := filepath.Join(dir, "out")
+	require.NoError(t, repo.GetPathTar("empty.tar.gz", out))
+	entries, err := ioutil.ReadDir(out)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func testTarballs(t *testing.T, repo repository.Repository) {
+	dir := tempDir(t)
+	writeFile(t, filepath.Join(dir, "in", "train.py"), "train")
+	writeFile(t, filepath.Join(dir, "in", "data", "weights"), "weights")
+
+	require.NoError(t, repo.PutPathTar(filepath.Join(dir, "in"), "checkpoints/abc.tar.gz", ""))
+	files, err := repo.ListTarFile("checkpoints/abc.tar.gz")
+	require.NoError(t, err)
+	sort.Strings(files)
+	require.Equal(t, []string{"data/weights", "train.py"}, files)
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, repo.GetPathTar("checkpoints/abc.tar.gz", out))
+	requireFileContent(t, filepath.Join(out, "train.py"), "train")
+	requireFileContent(t, filepath.Join(out, "data", "weights"), "weights")
+
+	out = filepath.Join(dir, "out-item")
+	require.NoError(t, repo.GetPathItemTar("checkpoints/abc.tar.gz", "data/weights", out))
+	requireFileContent(t, filepath.Join(out, "data", "weights"), "weights")
+
+	// includePath only includes that path
+	require.NoError(t, repo.PutPathTar(filepath.Join(dir, "in"), "checkpoints/def.tar.gz", "data"))
+	files, err = repo.ListTarFile("checkpoints/def.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, []string{"data/weights"}, files)
+
+	require.Error(t, repo.PutPathTar(filepath.Join(dir, "in"), "checkpoints/ghi.zip", ""))
+	err = repo.GetPathTar("checkpoints/does-not-exist.tar.gz", filepath.Join(dir, "out-missing"))
+	require.True(t, errors.IsDoesNotExist(err), "GetPathTar of a missing path should be a DoesNotExist error, not %v", err)
+}
+
+func testConcurrentWrites(t *testing.T, repo repository.Repository) {
+	const numWriters = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters*2)
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each writer writes its own object, and they all write the same one
+			errs <- repo.Put(fmt.Sprintf("concurrent/%02d.json", i), []byte(fmt.Sprintf("%d", i)))
+			errs <- repo.Put("shared.json", []byte(fmt.Sprintf("writer %02d", i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	listed := listRecursive(t, repo, "concurrent")
+	require.Len(t, listed, numWriters)
+	for i, result := range listed {
+		data, err := repo.Get(result.Path)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%d", i), string(data))
+	}
+
+	// the last write wins, whole, without interleaving with the others
+	data, err := repo.Get("shared.json")
+	require.NoError(t, err)
+	require.Regexp(t, `^writer \d\d$`, string(data))
+}
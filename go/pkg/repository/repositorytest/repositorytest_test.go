@@ -0,0 +1,23 @@
+package repositorytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/repository"
+)
+
+func TestDiskRepository(t *testing.T) {
+	Run(t, func(t *testing.T) repository.Repository {
+		repo, err := repository.NewDiskRepository(tempDir(t))
+		require.NoError(t, err)
+		return repo
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewMemoryRepository()
+	})
+}
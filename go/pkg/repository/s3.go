@@ -43,10 +43,7 @@ func NewS3Repository(bucket, root string) (*S3Repository, error) {
 		bucketName: bucket,
 		root:       root,
 	}
-	s.sess, err = session.NewSession(&aws.Config{
-		Region:                        aws.String(region),
-		CredentialsChainVerboseErrors: aws.Bool(true),
-	})
+	s.sess, err = s3Session(region)
 	if err != nil {
 		return nil, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to S3: %s", err))
 	}
@@ -66,25 +63,43 @@ func (s *S3Repository) RootURL() string {
 // Get data at path
 func (s *S3Repository) Get(path string) ([]byte, error) {
 	key := filepath.Join(s.root, path)
-	obj, err := s.svc.GetObject(&s3.GetObjectInput{
+	obj, err := s.svc.GetObjectWithContext(aws.BackgroundContext(), &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
-	})
+	}, s3RequestTimeout(currentTimeouts().Metadata))
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			if aerr.Code() == s3.ErrCodeNoSuchKey {
 				return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %v", path))
 			}
 		}
-		return nil, errors.ReadError(fmt.Sprintf("Failed to read %s/%s: %s", s.RootURL(), path, err))
+		return nil, readError(err, "Failed to read %s/%s: %s", s.RootURL(), path, err)
 	}
+	defer obj.Body.Close()
 	body, err := ioutil.ReadAll(obj.Body)
 	if err != nil {
-		return nil, errors.ReadError(fmt.Sprintf("Failed to read body from %s/%s: %s", s.RootURL(), path, err))
+		return nil, readError(err, "Failed to read body from %s/%s: %s", s.RootURL(), path, err)
 	}
 	return body, nil
 }
 
+// Exists returns true if there is an object at path
+func (s *S3Repository) Exists(path string) (bool, error) {
+	key := filepath.Join(s.root, path)
+	_, err := s.svc.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}, s3RequestTimeout(currentTimeouts().Metadata))
+	if err != nil {
+		// HEAD responses don't have a body, so there is only the status code
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+			return false, nil
+		}
+		return false, readError(err, "Failed to read %s/%s: %s", s.RootURL(), path, err)
+	}
+	return true, nil
+}
+
 func (s *S3Repository) Delete(path string) error {
 	console.Debug("Deleting %s/%s...", s.RootURL(), path)
 	key := filepath.Join(s.root, path)
@@ -93,7 +108,7 @@ func (s *S3Repository) Delete(path string) error {
 		Prefix: &key,
 	})
 	if err := s3manager.NewBatchDeleteWithClient(s.svc).Delete(aws.BackgroundContext(), iter); err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), path, err))
+		return writeError(err, "Failed to delete %s/%s: %v", s.RootURL(), path, err)
 	}
 	return nil
 }
@@ -102,13 +117,9 @@ func (s *S3Repository) Delete(path string) error {
 func (s *S3Repository) Put(path string, data []byte) error {
 	key := filepath.Join(s.root, path)
 	uploader := s3manager.NewUploader(s.sess)
-	_, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-		Body:   bytes.NewReader(data),
-	})
+	_, err := uploader.UploadWithContext(aws.BackgroundContext(), s.uploadInput(key, bytes.NewReader(data)), s3manager.WithUploaderRequestOptions(s3RequestTimeout(currentTimeouts().Metadata)))
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to upload to %s/%s: %v", s.RootURL(), path, err))
+		return writeError(err, "Unable to upload to %s/%s: %v", s.RootURL(), path, err)
 	}
 	return nil
 }
@@ -116,9 +127,10 @@ func (s *S3Repository) Put(path string, data []byte) error {
 func (s *S3Repository) PutPath(localPath string, destPath string) error {
 	files, err := getListOfFilesToPut(localPath, filepath.Join(s.root, destPath))
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	timeout := s3manager.WithUploaderRequestOptions(s3RequestTimeout(currentTimeouts().Transfer))
 
 	for _, file := range files {
 		// Variables used in closure
@@ -130,20 +142,16 @@ func (s *S3Repository) PutPath(localPath string, destPath string) error {
 			}
 
 			uploader := s3manager.NewUploader(s.sess)
-			_, err = uploader.Upload(&s3manager.UploadInput{
-				Bucket: aws.String(s.bucketName),
-				Key:    aws.String(file.Dest),
-				Body:   bytes.NewReader(data),
-			})
+			_, err = uploader.UploadWithContext(aws.BackgroundContext(), s.uploadInput(file.Dest, bytes.NewReader(data)), timeout)
 			return err
 		})
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return writeError(err, "%v", err)
 		}
 	}
 
 	if err := queue.Wait(); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
@@ -156,7 +164,7 @@ func (s *S3Repository) PutPathTar(localPath, tarPath, includePath string) error
 	reader, writer := io.Pipe()
 
 	// TODO: This doesn't cancel elegantly on error -- we should use the context returned here and check if it is done.
-	errs, _ := errgroup.WithContext(context.TODO())
+	errs, _ := errgroup.WithContext(context.Background())
 
 	errs.Go(func() error {
 		if err := putPathTar(localPath, writer, filepath.Base(tarPath), includePath); err != nil {
@@ -167,44 +175,66 @@ func (s *S3Repository) PutPathTar(localPath, tarPath, includePath string) error
 	errs.Go(func() error {
 		key := filepath.Join(s.root, tarPath)
 		uploader := s3manager.NewUploader(s.sess)
-		_, err := uploader.Upload(&s3manager.UploadInput{
-			Bucket: aws.String(s.bucketName),
-			Key:    aws.String(key),
-			Body:   reader,
-		})
+		_, err := uploader.UploadWithContext(aws.BackgroundContext(), s.uploadInput(key, reader), s3manager.WithUploaderRequestOptions(s3RequestTimeout(currentTimeouts().Transfer)))
 		return err
 	})
 	if err := errs.Wait(); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
 
+// uploadInput returns the input for uploading body to key, with the
+// attributes for its path
+func (s *S3Repository) uploadInput(key string, body io.Reader) *s3manager.UploadInput {
+	attrs := attributesForPath(relativeToRoot(key, s.root))
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(attrs.ContentType),
+		Metadata:    aws.StringMap(attrs.Metadata),
+	}
+	if attrs.CacheControl != "" {
+		input.CacheControl = aws.String(attrs.CacheControl)
+	}
+	return input
+}
+
 // GetPath recursively copies repoDir to localDir
 func (s *S3Repository) GetPath(remoteDir string, localDir string) error {
 	prefix := filepath.Join(s.root, remoteDir)
 	iter := new(s3manager.DownloadObjectsIterator)
-	files := []*os.File{}
+	downloads := []*downloadFile{}
+	committed := false
 	defer func() {
-		for _, f := range files {
-			if err := f.Close(); err != nil {
-				console.Warn("Failed to close file %s", f.Name())
+		if !committed {
+			for _, f := range downloads {
+				f.Abort()
 			}
 		}
 	}()
 
+	timeouts := currentTimeouts()
 	keys := []*string{}
+	var size int64
 	err := s.svc.ListObjectsV2PagesWithContext(aws.BackgroundContext(), &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucketName),
 		Prefix: aws.String(prefix),
 	}, func(output *s3.ListObjectsV2Output, last bool) bool {
 		for _, object := range output.Contents {
-			keys = append(keys, object.Key)
+			if isUnderPrefix(*object.Key, prefix) {
+				keys = append(keys, object.Key)
+				size += aws.Int64Value(object.Size)
+			}
 		}
 		return true
-	})
+	}, s3RequestTimeout(timeouts.List))
 	if err != nil {
-		return errors.ReadError(fmt.Sprintf("Failed to list objects in s3://%s/%s: %v", s.bucketName, prefix, err))
+		return readError(err, "Failed to list objects in s3://%s/%s: %v", s.bucketName, prefix, err)
+	}
+	if err := CheckDiskSpace(localDir, size, fmt.Sprintf("s3://%s/%s", s.bucketName, prefix)); err != nil {
+		return err
 	}
 
 	for _, key := range keys {
@@ -212,16 +242,15 @@ func (s *S3Repository) GetPath(remoteDir string, localDir string) error {
 		if err != nil {
 			return fmt.Errorf("Failed to determine directory of %s relative to %s: %v", *key, prefix, err)
 		}
-		localPath := filepath.Join(localDir, relPath)
-		localDir := filepath.Dir(localPath)
-		if err := os.MkdirAll(localDir, 0755); err != nil {
-			return fmt.Errorf("Failed to create directory %s: %v", localDir, err)
+		localPath, err := files.JoinWithin(localDir, filepath.ToSlash(relPath))
+		if err != nil {
+			return err
 		}
-
-		f, err := os.Create(localPath)
+		f, err := createDownloadFile(localPath)
 		if err != nil {
-			return fmt.Errorf("Failed to create file %s: %v", localPath, err)
+			return err
 		}
+		downloads = append(downloads, f)
 
 		console.Debug("Downloading %s to %s", *key, localPath)
 
@@ -232,12 +261,21 @@ func (s *S3Repository) GetPath(remoteDir string, localDir string) error {
 			},
 			Writer: f,
 		})
-		files = append(files, f)
 	}
 
 	downloader := s3manager.NewDownloader(s.sess)
-	if err := downloader.DownloadWithIterator(aws.BackgroundContext(), iter); err != nil {
-		return errors.ReadError(fmt.Sprintf("Failed to download s3://%s/%s to %s", s.bucketName, prefix, localDir))
+	if err := downloader.DownloadWithIterator(aws.BackgroundContext(), iter, s3manager.WithDownloaderRequestOptions(s3RequestTimeout(timeouts.Transfer))); err != nil {
+		return readError(err, "Failed to download s3://%s/%s to %s: %v", s.bucketName, prefix, localDir, err)
+	}
+	// only move files into place once they have all been downloaded
+	committed = true
+	for i, f := range downloads {
+		if err := f.Commit(); err != nil {
+			for _, f := range downloads[i+1:] {
+				f.Abort()
+			}
+			return err
+		}
 	}
 	return nil
 }
@@ -307,7 +345,7 @@ func (s *S3Repository) List(dir string) ([]string, error) {
 	}
 	prefix = strings.TrimPrefix(prefix, "/")
 
-	err := s.svc.ListObjectsPages(&s3.ListObjectsInput{
+	err := s.svc.ListObjectsPagesWithContext(aws.BackgroundContext(), &s3.ListObjectsInput{
 		Bucket:    aws.String(s.bucketName),
 		Prefix:    aws.String(prefix),
 		Delimiter: aws.String("/"),
@@ -321,9 +359,9 @@ func (s *S3Repository) List(dir string) ([]string, error) {
 			results = append(results, key)
 		}
 		return true
-	})
+	}, s3RequestTimeout(currentTimeouts().List))
 	if err != nil {
-		return nil, errors.ReadError(err.Error())
+		return nil, readError(err, "%v", err)
 	}
 	return results, nil
 }
@@ -371,11 +409,18 @@ func CreateS3Bucket(region, bucket string) (err error) {
 	}
 	svc := s3.New(sess)
 
-	_, err = svc.CreateBucket(&s3.CreateBucketInput{
+	input := &s3.CreateBucketInput{
 		Bucket: aws.String(bucket),
-	})
+	}
+	// us-east-1 is the default, and it is an error to pass it as a location constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+	_, err = svc.CreateBucket(input)
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to create bucket %q, %v", bucket, err))
+		return writeError(err, "Unable to create bucket %q, %v", bucket, err)
 	}
 
 	// Default max attempts is 20, but we hit this sometimes
@@ -383,7 +428,7 @@ func CreateS3Bucket(region, bucket string) (err error) {
 		Bucket: aws.String(bucket),
 	}, request.WithWaiterMaxAttempts(50))
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, "%v", err)
 	}
 	return nil
 }
@@ -403,13 +448,13 @@ func DeleteS3Bucket(region, bucket string) (err error) {
 	})
 
 	if err := s3manager.NewBatchDeleteWithClient(svc).Delete(aws.BackgroundContext(), iter); err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to delete objects from bucket %q, %v", bucket, err))
+		return writeError(err, "Unable to delete objects from bucket %q, %v", bucket, err)
 	}
 	_, err = svc.DeleteBucket(&s3.DeleteBucketInput{
 		Bucket: aws.String(bucket),
 	})
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to delete bucket %q, %v", bucket, err))
+		return writeError(err, "Unable to delete bucket %q, %v", bucket, err)
 	}
 	return nil
 }
@@ -422,7 +467,7 @@ func (s *S3Repository) listRecursive(results chan<- ListResult, dir string, filt
 	}
 	prefix = strings.TrimPrefix(prefix, "/")
 
-	err := s.svc.ListObjectsPages(&s3.ListObjectsInput{
+	err := s.svc.ListObjectsPagesWithContext(aws.BackgroundContext(), &s3.ListObjectsInput{
 		Bucket:  aws.String(s.bucketName),
 		Prefix:  aws.String(prefix),
 		MaxKeys: aws.Int64(1000),
@@ -436,13 +481,13 @@ func (s *S3Repository) listRecursive(results chan<- ListResult, dir string, filt
 				// If S3 gives us an empty/bad etag, then make it blank and cause sync instead of throwing error
 				// Also, the etag includes quotes for some reason
 				md5, _ := hex.DecodeString(strings.Replace(*value.ETag, "\"", "", -1))
-				results <- ListResult{Path: key, MD5: md5}
+				results <- ListResult{Path: key, MD5: md5, Size: aws.Int64Value(value.Size), Modified: aws.TimeValue(value.LastModified)}
 			}
 		}
 		return true
-	})
+	}, s3RequestTimeout(currentTimeouts().List))
 	if err != nil {
-		results <- ListResult{Error: fmt.Errorf("Failed to list objects in s3://%s: %s", s.bucketName, err)}
+		results <- ListResult{Error: readError(err, "Failed to list objects in s3://%s: %s", s.bucketName, err)}
 	}
 	close(results)
 }
@@ -457,6 +502,19 @@ func discoverBucketRegion(bucket string) (string, error) {
 	return region, nil
 }
 
+// CreateS3BucketIfNotExists creates bucket in region, if it doesn't already exist
+func CreateS3BucketIfNotExists(region, bucket string) (created bool, err error) {
+	if _, err := discoverBucketRegion(bucket); err == nil {
+		return false, nil
+	} else if aerr, ok := err.(awserr.Error); !ok || !strings.Contains(aerr.Error(), "NotFound") {
+		return false, fmt.Errorf("Failed to determine if bucket s3://%s exists: %s", bucket, err)
+	}
+	if err := CreateS3Bucket(region, bucket); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func getBucketRegionOrCreateBucket(bucket string) (string, error) {
 	// TODO (bfirsh): cache this
 	region, err := discoverBucketRegion(bucket)
@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/global"
+	"github.com/replicate/keepsake/go/pkg/version"
 )
 
 const Version = 1
@@ -12,6 +14,17 @@ const SpecPath = "repository.json"
 
 type Spec struct {
 	Version int `json:"version"`
+
+	// The oldest version of Keepsake that can use this repository, so people on
+	// older versions can't write metadata to it that newer versions don't understand
+	MinimumKeepsakeVersion string `json:"minimum_keepsake_version,omitempty"`
+
+	// Limits on how much storage the files saved with experiments can use
+	Quota *Quota `json:"quota,omitempty"`
+
+	// Nothing in the repository is overwritten or deleted. New versions are
+	// written instead. See WriteOnceRepository. It can't be turned off.
+	WriteOnce bool `json:"write_once,omitempty"`
 }
 
 // LoadSpec returns the repository spec, or nil if the repository doesn't have a spec file
@@ -29,14 +42,61 @@ func LoadSpec(r Repository) (*Spec, error) {
 		return nil, errors.CorruptedRepositorySpec(r.RootURL(), SpecPath, err)
 	}
 
+	// The spec in a write-once repository is updated by writing new versions
+	// of it, so read the latest one
+	if _, isWriteOnce := r.(*WriteOnceRepository); spec.WriteOnce && !isWriteOnce {
+		return LoadSpec(NewWriteOnceRepository(r))
+	}
+
 	return spec, nil
 }
 
 func WriteSpec(r Repository) error {
-	spec := Spec{Version: Version}
-	raw, err := json.Marshal(&spec)
+	return SaveSpec(r, &Spec{Version: Version})
+}
+
+// SaveSpec writes spec to the repository, replacing the existing one
+func SaveSpec(r Repository, spec *Spec) error {
+	raw, err := json.Marshal(spec)
 	if err != nil {
 		panic(err) // should never happen
 	}
 	return r.Put(SpecPath, raw)
 }
+
+// CheckCompatible returns an error if the repository can't be used with
+// keepsakeVersion, the version of Keepsake that is running. Development builds,
+// which don't have a version number, are assumed to be compatible with everything.
+func (s *Spec) CheckCompatible(rootURL string, keepsakeVersion string) error {
+	if s.Version > Version {
+		return errors.IncompatibleRepositoryVersion(rootURL)
+	}
+	if s.MinimumKeepsakeVersion == "" {
+		return nil
+	}
+	minimum, err := version.Parse(s.MinimumKeepsakeVersion)
+	if err != nil {
+		return errors.CorruptedRepositorySpec(rootURL, SpecPath, err)
+	}
+	current, err := version.Parse(keepsakeVersion)
+	if err != nil {
+		return nil
+	}
+	if current.Compare(minimum) < 0 {
+		return errors.KeepsakeVersionTooOld(rootURL, s.MinimumKeepsakeVersion, keepsakeVersion)
+	}
+	return nil
+}
+
+// CheckCompatible returns an error if the repository needs a newer version of
+// Keepsake than the one that is running
+func CheckCompatible(r Repository) error {
+	spec, err := LoadSpec(r)
+	if err != nil {
+		return err
+	}
+	if spec == nil {
+		return nil
+	}
+	return spec.CheckCompatible(r.RootURL(), global.Version)
+}
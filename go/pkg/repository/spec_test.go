@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestSpecCheckCompatible(t *testing.T) {
+	require.NoError(t, (&Spec{Version: Version}).CheckCompatible("file:///foo", "0.4.0"))
+
+	err := (&Spec{Version: Version + 1}).CheckCompatible("file:///foo", "0.4.0")
+	require.Equal(t, errors.CodeIncompatibleRepositoryVersion, errors.Code(err))
+
+	spec := &Spec{Version: Version, MinimumKeepsakeVersion: "0.5.0"}
+	require.NoError(t, spec.CheckCompatible("file:///foo", "0.5.0"))
+	require.NoError(t, spec.CheckCompatible("file:///foo", "1.0.0"))
+	// development builds can't be compared, so they are allowed
+	require.NoError(t, spec.CheckCompatible("file:///foo", "development"))
+
+	err = spec.CheckCompatible("file:///foo", "0.4.9")
+	require.Error(t, err)
+	require.Equal(t, errors.CodeIncompatibleRepositoryVersion, errors.Code(err))
+	require.Contains(t, err.Error(), "requires Keepsake 0.5.0 or later")
+	require.Contains(t, err.Error(), "pip install --upgrade keepsake")
+
+	err = (&Spec{Version: Version, MinimumKeepsakeVersion: "latest"}).CheckCompatible("file:///foo", "0.4.0")
+	require.Equal(t, errors.CodeCorruptedRepositorySpec, errors.Code(err))
+}
+
+func TestSaveSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	// minimum version is omitted so existing spec files don't change
+	require.NoError(t, WriteSpec(repo))
+	data, err := repo.Get(SpecPath)
+	require.NoError(t, err)
+	require.Equal(t, `{"version":1}`, string(data))
+
+	require.NoError(t, SaveSpec(repo, &Spec{Version: Version, MinimumKeepsakeVersion: "0.5.0"}))
+	spec, err := LoadSpec(repo)
+	require.NoError(t, err)
+	require.Equal(t, &Spec{Version: Version, MinimumKeepsakeVersion: "0.5.0"}, spec)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"strings"
+)
+
+// artifactPrefixes are the paths that hold the files saved with experiments and
+// checkpoints, either as tarballs or content-addressed objects
+var artifactPrefixes = []string{"experiments", "checkpoints", "objects"}
+
+// SplitRepository wraps two repositories, storing the tarballs of experiments and
+// checkpoints in one and everything else (metadata, heartbeats, etc) in the other.
+//
+// This lets artifacts be stored somewhere with a different storage class or region
+// to metadata, which is read much more often.
+type SplitRepository struct {
+	metadataRepository Repository
+	artifactRepository Repository
+}
+
+func NewSplitRepository(metadataRepo Repository, artifactRepo Repository) *SplitRepository {
+	return &SplitRepository{
+		metadataRepository: metadataRepo,
+		artifactRepository: artifactRepo,
+	}
+}
+
+// ForURLs returns a repository for repositoryURL. If artifactRepositoryURL is set,
+// the files saved with experiments and checkpoints are stored there instead.
+func ForURLs(repositoryURL string, artifactRepositoryURL string, projectDir string) (Repository, error) {
+	repo, err := ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if artifactRepositoryURL == "" || artifactRepositoryURL == repositoryURL {
+		return repo, nil
+	}
+	artifactRepo, err := ForURL(artifactRepositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return NewSplitRepository(repo, artifactRepo), nil
+}
+
+func (s *SplitRepository) repositoryForPath(p string) Repository {
+	if isArtifactPath(p) {
+		return s.artifactRepository
+	}
+	return s.metadataRepository
+}
+
+// isArtifactPath returns true if p is a file saved with an experiment or checkpoint
+func isArtifactPath(p string) bool {
+	p = strings.TrimPrefix(p, "/")
+	for _, prefix := range artifactPrefixes {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SplitRepository) Get(p string) ([]byte, error) {
+	return s.repositoryForPath(p).Get(p)
+}
+
+func (s *SplitRepository) Put(p string, data []byte) error {
+	return s.repositoryForPath(p).Put(p, data)
+}
+
+func (s *SplitRepository) GetPath(repoPath string, localPath string) error {
+	return s.repositoryForPath(repoPath).GetPath(repoPath, localPath)
+}
+
+func (s *SplitRepository) GetPathTar(tarPath, localPath string) error {
+	return s.repositoryForPath(tarPath).GetPathTar(tarPath, localPath)
+}
+
+func (s *SplitRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	return s.repositoryForPath(tarPath).GetPathItemTar(tarPath, itemPath, localPath)
+}
+
+func (s *SplitRepository) PutPath(localPath string, repoPath string) error {
+	return s.repositoryForPath(repoPath).PutPath(localPath, repoPath)
+}
+
+func (s *SplitRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	return s.repositoryForPath(tarPath).PutPathTar(localPath, tarPath, includePath)
+}
+
+func (s *SplitRepository) List(p string) ([]string, error) {
+	return s.repositoryForPath(p).List(p)
+}
+
+func (s *SplitRepository) ListTarFile(p string) ([]string, error) {
+	return s.repositoryForPath(p).ListTarFile(p)
+}
+
+func (s *SplitRepository) ListRecursive(results chan<- ListResult, path string) {
+	s.repositoryForPath(path).ListRecursive(results, path)
+}
+
+func (s *SplitRepository) MatchFilenamesRecursive(results chan<- ListResult, path string, filename string) {
+	s.repositoryForPath(path).MatchFilenamesRecursive(results, path, filename)
+}
+
+func (s *SplitRepository) Delete(p string) error {
+	return s.repositoryForPath(p).Delete(p)
+}
+
+// RootURL returns the URL of the metadata repository, which is what identifies the repository
+func (s *SplitRepository) RootURL() string {
+	return s.metadataRepository.RootURL()
+}
+
+// ArtifactRootURL returns the URL of the repository experiment and checkpoint files are stored in
+func (s *SplitRepository) ArtifactRootURL() string {
+	return s.artifactRepository.RootURL()
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/files"
+)
+
+func TestSplitRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	metadataDir := path.Join(dir, "metadata-repo")
+	artifactDir := path.Join(dir, "artifact-repo")
+	repo, err := ForURLs("file://"+metadataDir, "file://"+artifactDir, "")
+	require.NoError(t, err)
+	require.Equal(t, "file://"+metadataDir, repo.RootURL())
+
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("{}")))
+	require.NoError(t, repo.Put("repository.json", []byte("{}")))
+
+	sourceDir := path.Join(dir, "source")
+	require.NoError(t, os.MkdirAll(path.Join(sourceDir, "data"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(sourceDir, "data", "weights"), []byte("weights"), 0644))
+	require.NoError(t, repo.PutPathTar(sourceDir, "checkpoints/def.tar.gz", "data"))
+
+	exists, err := files.FileExists(path.Join(metadataDir, "metadata/experiments/abc.json"))
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = files.FileExists(path.Join(metadataDir, "repository.json"))
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = files.FileExists(path.Join(artifactDir, "checkpoints/def.tar.gz"))
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = files.FileExists(path.Join(metadataDir, "checkpoints/def.tar.gz"))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	outputDir := path.Join(dir, "output")
+	require.NoError(t, repo.GetPathTar("checkpoints/def.tar.gz", outputDir))
+	content, err := ioutil.ReadFile(path.Join(outputDir, "data", "weights"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(content))
+
+	paths, err := repo.List("checkpoints")
+	require.NoError(t, err)
+	require.Equal(t, []string{"checkpoints/def.tar.gz"}, paths)
+
+	// Without an artifact repository, everything is in one repository
+	repo, err = ForURLs("file://"+metadataDir, "", "")
+	require.NoError(t, err)
+	_, ok := repo.(*DiskRepository)
+	require.True(t, ok)
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Timeouts are how long each kind of request to S3 and Google Cloud Storage
+// can take before it is abandoned, so one hung request can't stall a whole
+// sync. Zero values use the defaults.
+type Timeouts struct {
+	// Metadata is how long reading or writing a small object, like an
+	// experiment's metadata, can take. Default: 1 minute
+	Metadata time.Duration
+
+	// Transfer is how long uploading or downloading one file can take. S3
+	// transfers large files in parts, so on S3 it is how long each part can
+	// take. Default: 1 hour
+	Transfer time.Duration
+
+	// List is how long fetching each page of a listing can take. Default: 2
+	// minutes
+	List time.Duration
+}
+
+var (
+	timeoutsMu         sync.Mutex
+	configuredTimeouts Timeouts
+)
+
+// ConfigureTimeouts sets the timeouts for requests made after it is called
+func ConfigureTimeouts(t Timeouts) {
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	configuredTimeouts = t
+}
+
+// currentTimeouts returns the configured timeouts, with defaults for the ones
+// that aren't set
+func currentTimeouts() Timeouts {
+	timeoutsMu.Lock()
+	t := configuredTimeouts
+	timeoutsMu.Unlock()
+	if t.Metadata == 0 {
+		t.Metadata = time.Minute
+	}
+	if t.Transfer == 0 {
+		t.Transfer = time.Hour
+	}
+	if t.List == 0 {
+		t.List = 2 * time.Minute
+	}
+	return t
+}
+
+// s3RequestTimeout is an option for S3 requests that abandons them if they
+// take longer than d, including retries. The body of an object that is being
+// downloaded is read after the request has completed, so for those it lasts
+// until the body is closed.
+func s3RequestTimeout(d time.Duration) request.Option {
+	return func(r *request.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		r.SetContext(ctx)
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if out, ok := r.Data.(*s3.GetObjectOutput); ok && r.Error == nil && out.Body != nil {
+				out.Body = &cancelOnClose{ReadCloser: out.Body, cancel: cancel}
+				return
+			}
+			cancel()
+		})
+	}
+}
+
+// cancelOnClose cancels a context when the reader is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
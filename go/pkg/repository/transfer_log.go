@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+// transferRetries is how many times a transfer is retried if it fails with an
+// error that may go away, like being rate limited
+const transferRetries = 5
+
+// transferRetryDelay is how long to wait before retrying a transfer for the
+// first time. It doubles for each retry after that.
+var transferRetryDelay = time.Second
+
+// TransferRecord is a line in a transfer manifest. It has everything needed
+// to replay the transfer.
+type TransferRecord struct {
+	Operation     string    `json:"operation"`
+	RepositoryURL string    `json:"repository_url"`
+	Path          string    `json:"path"`
+	LocalPath     string    `json:"local_path,omitempty"`
+	ItemPath      string    `json:"item_path,omitempty"`
+	Bytes         int64     `json:"bytes"`
+	Started       time.Time `json:"started"`
+	Duration      float64   `json:"duration_seconds"`
+	Retries       int       `json:"retries"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// TransferLogRepository wraps a repository, logging every object that is
+// uploaded, downloaded, or deleted, and writing a TransferRecord for each of
+// them as a line of JSON to a manifest. Transfers that fail with errors that
+// may go away are retried, and the number of retries is recorded.
+//
+// Sizes are of the files before they are compressed.
+type TransferLogRepository struct {
+	Repository
+	mu       sync.Mutex
+	manifest io.Writer
+}
+
+func NewTransferLogRepository(repo Repository, manifest io.Writer) *TransferLogRepository {
+	return &TransferLogRepository{Repository: repo, manifest: manifest}
+}
+
+func (s *TransferLogRepository) Get(p string) ([]byte, error) {
+	var data []byte
+	err := s.transfer(&TransferRecord{Operation: "get", Path: p}, func(record *TransferRecord) error {
+		var err error
+		data, err = s.Repository.Get(p)
+		record.Bytes = int64(len(data))
+		return err
+	})
+	return data, err
+}
+
+func (s *TransferLogRepository) GetPath(repoPath, localPath string) error {
+	return s.transfer(&TransferRecord{Operation: "get_path", Path: repoPath, LocalPath: localPath}, func(record *TransferRecord) error {
+		return measureDownload(record, localPath, func() error { return s.Repository.GetPath(repoPath, localPath) })
+	})
+}
+
+func (s *TransferLogRepository) GetPathTar(tarPath, localPath string) error {
+	return s.transfer(&TransferRecord{Operation: "get_path_tar", Path: tarPath, LocalPath: localPath}, func(record *TransferRecord) error {
+		return measureDownload(record, localPath, func() error { return s.Repository.GetPathTar(tarPath, localPath) })
+	})
+}
+
+func (s *TransferLogRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	return s.transfer(&TransferRecord{Operation: "get_path_item_tar", Path: tarPath, ItemPath: itemPath, LocalPath: localPath}, func(record *TransferRecord) error {
+		return measureDownload(record, localPath, func() error { return s.Repository.GetPathItemTar(tarPath, itemPath, localPath) })
+	})
+}
+
+func (s *TransferLogRepository) Put(p string, data []byte) error {
+	return s.transfer(&TransferRecord{Operation: "put", Path: p, Bytes: int64(len(data))}, func(record *TransferRecord) error {
+		return s.Repository.Put(p, data)
+	})
+}
+
+func (s *TransferLogRepository) PutPath(localPath, repoPath string) error {
+	return s.transfer(&TransferRecord{Operation: "put_path", Path: repoPath, LocalPath: localPath}, func(record *TransferRecord) error {
+		var err error
+		if record.Bytes, err = localSize(localPath); err != nil {
+			return err
+		}
+		return s.Repository.PutPath(localPath, repoPath)
+	})
+}
+
+func (s *TransferLogRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	return s.transfer(&TransferRecord{Operation: "put_path_tar", Path: tarPath, LocalPath: localPath, ItemPath: includePath}, func(record *TransferRecord) error {
+		var err error
+		if record.Bytes, err = localSize(filepath.Join(localPath, includePath)); err != nil {
+			return err
+		}
+		return s.Repository.PutPathTar(localPath, tarPath, includePath)
+	})
+}
+
+func (s *TransferLogRepository) Delete(p string) error {
+	return s.transfer(&TransferRecord{Operation: "delete", Path: p}, func(record *TransferRecord) error {
+		return s.Repository.Delete(p)
+	})
+}
+
+// transfer runs fn, retrying it if it fails with a retryable error, then
+// logs the transfer and writes it to the manifest
+func (s *TransferLogRepository) transfer(record *TransferRecord, fn func(record *TransferRecord) error) error {
+	record.RepositoryURL = s.RootURL()
+	record.Started = time.Now()
+	delay := transferRetryDelay
+	var err error
+	for {
+		err = fn(record)
+		if err == nil || record.Retries >= transferRetries || !errors.IsRetryable(err) {
+			break
+		}
+		console.Debug("Failed to %s %s, retrying in %s: %v", strings.Replace(record.Operation, "_", " ", -1), record.Path, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		record.Retries++
+	}
+	record.Duration = time.Since(record.Started).Seconds()
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	s.log(record)
+	if writeErr := s.writeRecord(record); writeErr != nil {
+		console.Warn("Failed to write to transfer manifest: %v", writeErr)
+	}
+	return err
+}
+
+func (s *TransferLogRepository) log(record *TransferRecord) {
+	verb := "Downloaded"
+	if strings.HasPrefix(record.Operation, "put") {
+		verb = "Uploaded"
+	} else if record.Operation == "delete" {
+		verb = "Deleted"
+	}
+	msg := fmt.Sprintf("%s %s/%s", verb, s.RootURL(), record.Path)
+	if record.ItemPath != "" {
+		msg += fmt.Sprintf(" (%s)", record.ItemPath)
+	}
+	if record.Operation != "delete" {
+		msg += ", " + console.FormatBytes(uint64(record.Bytes))
+	}
+	msg += fmt.Sprintf(", %.2fs", record.Duration)
+	if record.Retries == 1 {
+		msg += ", 1 retry"
+	} else if record.Retries > 1 {
+		msg += fmt.Sprintf(", %d retries", record.Retries)
+	}
+	if record.Error != "" {
+		console.Warn("Failed: %s: %s", msg, record.Error)
+		return
+	}
+	console.Info("%s", msg)
+}
+
+func (s *TransferLogRepository) writeRecord(record *TransferRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.manifest.Write(append(data, '\n'))
+	return err
+}
+
+// measureDownload runs download, and sets the record's size to how much the
+// files in localPath grew by
+func measureDownload(record *TransferRecord, localPath string, download func() error) error {
+	before, err := localSize(localPath)
+	if err != nil {
+		return err
+	}
+	err = download()
+	after, sizeErr := localSize(localPath)
+	if sizeErr == nil && after > before {
+		record.Bytes = after - before
+	}
+	return err
+}
+
+// localSize returns the total size of the regular files at p, which can be a
+// file or a directory, or 0 if it doesn't exist
+func localSize(p string) (int64, error) {
+	var size int64
+	err := filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
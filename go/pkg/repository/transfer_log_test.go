@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+type flakyRepository struct {
+	Repository
+	failures int
+}
+
+func (s *flakyRepository) Put(p string, data []byte) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.Throttled("slow down")
+	}
+	return s.Repository.Put(p, data)
+}
+
+func readTransferRecords(t *testing.T, manifest *bytes.Buffer) []*TransferRecord {
+	records := []*TransferRecord{}
+	for _, line := range strings.Split(strings.TrimSpace(manifest.String()), "\n") {
+		record := new(TransferRecord)
+		require.NoError(t, json.Unmarshal([]byte(line), record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestTransferLogRepository(t *testing.T) {
+	transferRetryDelay = 0
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+	require.NoError(t, ioutil.WriteFile(path.Join(localDir, "weights"), []byte("hello world"), 0644))
+
+	diskRepo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	manifest := new(bytes.Buffer)
+	repo := NewTransferLogRepository(&flakyRepository{Repository: diskRepo, failures: 2}, manifest)
+
+	require.NoError(t, repo.Put("data", []byte("hello")))
+	require.NoError(t, repo.PutPath(localDir, "files"))
+	outputDir := path.Join(localDir, "output")
+	require.NoError(t, repo.GetPath("files", outputDir))
+	_, err = repo.Get("does-not-exist")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	records := readTransferRecords(t, manifest)
+	require.Len(t, records, 4)
+
+	require.Equal(t, "put", records[0].Operation)
+	require.Equal(t, "data", records[0].Path)
+	require.Equal(t, diskRepo.RootURL(), records[0].RepositoryURL)
+	require.Equal(t, int64(5), records[0].Bytes)
+	require.Equal(t, 2, records[0].Retries)
+	require.Equal(t, "", records[0].Error)
+
+	require.Equal(t, "put_path", records[1].Operation)
+	require.Equal(t, localDir, records[1].LocalPath)
+	require.Equal(t, int64(11), records[1].Bytes)
+
+	require.Equal(t, "get_path", records[2].Operation)
+	require.Equal(t, outputDir, records[2].LocalPath)
+	require.Equal(t, int64(11), records[2].Bytes)
+
+	require.Equal(t, "get", records[3].Operation)
+	require.Equal(t, 0, records[3].Retries)
+	require.NotEqual(t, "", records[3].Error)
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+	"github.com/replicate/keepsake/go/pkg/hash"
+)
+
+const (
+	// versionsSuffix is added to a path to get the directory its later
+	// versions are written to
+	versionsSuffix = ".versions"
+	// deletedSuffix is the suffix of a version that marks a path as deleted
+	deletedSuffix = ".deleted"
+)
+
+// WriteOnceRepository wraps a repository so that nothing in it is ever
+// overwritten or deleted, for buckets with retention locks.
+//
+// The first time a path is written, it is written as usual. After that, new
+// versions of it are written to <path>.versions/, named so the latest one
+// sorts last. Deleting a path writes a version that marks it as deleted.
+// Reads and lists return the latest version of each path, so to everything
+// that uses the repository it looks like paths are overwritten and deleted
+// as usual.
+//
+// Old versions are never removed, so storage grows with every write. Paths
+// that are rewritten regularly, like heartbeats, add a version each time for
+// as long as an experiment runs.
+type WriteOnceRepository struct {
+	Repository
+}
+
+func NewWriteOnceRepository(repo Repository) *WriteOnceRepository {
+	return &WriteOnceRepository{Repository: repo}
+}
+
+func (s *WriteOnceRepository) Get(p string) ([]byte, error) {
+	current, err := s.current(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repository.Get(current)
+}
+
+func (s *WriteOnceRepository) GetPathTar(tarPath, localPath string) error {
+	current, err := s.current(tarPath)
+	if err != nil {
+		return err
+	}
+	return s.Repository.GetPathTar(current, localPath)
+}
+
+func (s *WriteOnceRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	current, err := s.current(tarPath)
+	if err != nil {
+		return err
+	}
+	return s.Repository.GetPathItemTar(current, itemPath, localPath)
+}
+
+func (s *WriteOnceRepository) ListTarFile(tarPath string) ([]string, error) {
+	current, err := s.current(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repository.ListTarFile(current)
+}
+
+// List lists the paths in dir that haven't been deleted.
+//
+// dir is listed recursively, so the versions of every path in it are found in
+// one listing rather than a listing per path. That listing still includes
+// every version ever written, so it gets slower as paths in dir are rewritten.
+func (s *WriteOnceRepository) List(dir string) ([]string, error) {
+	dir = path.Clean(dir)
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	results := make(chan ListResult)
+	go s.Repository.ListRecursive(results, dir)
+	paths := []string{}
+	// latest version of each path in dir, keyed by name
+	latest := map[string]string{}
+	var listErr error
+	for result := range results {
+		if result.Error != nil {
+			listErr = result.Error
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(result.Path, prefix), "/")
+		if len(parts) == 1 {
+			paths = append(paths, path.Join(dir, parts[0]))
+		} else if len(parts) == 2 && strings.HasSuffix(parts[0], versionsSuffix) {
+			name := strings.TrimSuffix(parts[0], versionsSuffix)
+			if parts[1] > latest[name] {
+				latest[name] = parts[1]
+			}
+		}
+	}
+	if listErr != nil {
+		return nil, listErr
+	}
+	sort.Strings(paths)
+	result := []string{}
+	for _, p := range paths {
+		if !strings.HasSuffix(latest[path.Base(p)], deletedSuffix) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (s *WriteOnceRepository) Put(p string, data []byte) error {
+	next, err := s.next(p, false)
+	if err != nil {
+		return err
+	}
+	return s.Repository.Put(next, data)
+}
+
+func (s *WriteOnceRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	next, err := s.next(tarPath, false)
+	if err != nil {
+		return err
+	}
+	return s.Repository.PutPathTar(localPath, next, includePath)
+}
+
+// PutPath puts localPath into repoPath, as long as nothing has been written
+// to repoPath before
+func (s *WriteOnceRepository) PutPath(localPath string, repoPath string) error {
+	results := make(chan ListResult)
+	go s.Repository.ListRecursive(results, repoPath)
+	for result := range results {
+		if result.Error != nil {
+			return result.Error
+		}
+		// drain the channel so ListRecursive doesn't block
+		for range results {
+		}
+		return errors.ReadOnly(fmt.Sprintf("Failed to write %s/%s: the repository is write-once, and files have already been written there", s.RootURL(), repoPath))
+	}
+	return s.Repository.PutPath(localPath, repoPath)
+}
+
+// Delete marks p as deleted, without deleting anything
+func (s *WriteOnceRepository) Delete(p string) error {
+	latest, err := s.latestVersion(p)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(latest, deletedSuffix) {
+		return nil
+	}
+	next, err := s.next(p, true)
+	if err != nil {
+		return err
+	}
+	return s.Repository.Put(next, []byte{})
+}
+
+// current returns the path the latest version of p is stored at, or a
+// DoesNotExist error if it has been deleted
+func (s *WriteOnceRepository) current(p string) (string, error) {
+	latest, err := s.latestVersion(p)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(latest, deletedSuffix) {
+		return "", errors.DoesNotExist(fmt.Sprintf("%s/%s has been deleted", s.RootURL(), p))
+	}
+	return latest, nil
+}
+
+// latestVersion returns the path of the latest version of p, which is p
+// itself if it has only been written once
+func (s *WriteOnceRepository) latestVersion(p string) (string, error) {
+	versions, err := s.Repository.List(p + versionsSuffix)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return p, nil
+	}
+	sort.Strings(versions)
+	return versions[len(versions)-1], nil
+}
+
+// next returns the path to write a new version of p to: p itself if it has
+// never been written, otherwise a new path in its versions directory
+func (s *WriteOnceRepository) next(p string, deleted bool) (string, error) {
+	versions, err := s.Repository.List(p + versionsSuffix)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 && !deleted {
+		written, err := exists(s.Repository, p)
+		if err != nil {
+			return "", err
+		}
+		if !written {
+			return p, nil
+		}
+	}
+	name := fmt.Sprintf("%020d-%s", time.Now().UTC().UnixNano(), hash.Random()[:8])
+	if deleted {
+		name += deletedSuffix
+	} else {
+		// keep the extension, so e.g. PutPathTar still gets a .tar.gz path
+		base := path.Base(p)
+		if i := strings.Index(base, "."); i > 0 {
+			name += base[i:]
+		}
+	}
+	return path.Join(p+versionsSuffix, name), nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/keepsake/go/pkg/errors"
+)
+
+func TestWriteOnceRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	diskRepo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	repo := NewWriteOnceRepository(diskRepo)
+
+	// the first version is written as usual
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("1")))
+	require.NoError(t, repo.Put("metadata/experiments/def.json", []byte("1")))
+	content, err := diskRepo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), content)
+
+	// later versions don't overwrite it
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("2")))
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("3")))
+	content, err = repo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("3"), content)
+	content, err = diskRepo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), content)
+	versions, err := diskRepo.List("metadata/experiments/abc.json.versions")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	paths, err := repo.List("metadata/experiments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"metadata/experiments/abc.json", "metadata/experiments/def.json"}, paths)
+
+	// deleting marks it as deleted, but doesn't delete anything
+	require.NoError(t, repo.Delete("metadata/experiments/abc.json"))
+	_, err = repo.Get("metadata/experiments/abc.json")
+	require.True(t, errors.IsDoesNotExist(err))
+	paths, err = repo.List("metadata/experiments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"metadata/experiments/def.json"}, paths)
+	_, err = diskRepo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	versions, err = diskRepo.List("metadata/experiments/abc.json.versions")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+
+	// it can be written again after it is deleted
+	require.NoError(t, repo.Put("metadata/experiments/abc.json", []byte("4")))
+	content, err = repo.Get("metadata/experiments/abc.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("4"), content)
+
+	// listing doesn't list each path's versions separately
+	counting := &listCountingRepository{Repository: diskRepo}
+	paths, err = NewWriteOnceRepository(counting).List("metadata/experiments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"metadata/experiments/abc.json", "metadata/experiments/def.json"}, paths)
+	require.Equal(t, 0, counting.lists)
+}
+
+type listCountingRepository struct {
+	Repository
+	lists int
+}
+
+func (r *listCountingRepository) List(dir string) ([]string, error) {
+	r.lists++
+	return r.Repository.List(dir)
+}
+
+func TestWriteOnceRepositoryTarballs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localDir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir)
+
+	diskRepo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	repo := NewWriteOnceRepository(diskRepo)
+
+	for _, contents := range []string{"first", "second"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(localDir, "weights"), []byte(contents), 0644))
+		require.NoError(t, repo.PutPathTar(localDir, "checkpoints/abc.tar.gz", ""))
+	}
+	outDir := path.Join(localDir, "out")
+	require.NoError(t, repo.GetPathTar("checkpoints/abc.tar.gz", outDir))
+	content, err := ioutil.ReadFile(path.Join(outDir, "weights"))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(content))
+
+	require.NoError(t, repo.Delete("checkpoints/abc.tar.gz"))
+	err = repo.GetPathTar("checkpoints/abc.tar.gz", path.Join(localDir, "deleted"))
+	require.True(t, errors.IsDoesNotExist(err))
+	_, err = diskRepo.ListTarFile("checkpoints/abc.tar.gz")
+	require.NoError(t, err)
+
+	// directories can't be written to again
+	require.NoError(t, repo.PutPath(localDir, "files"))
+	require.True(t, errors.IsReadOnly(repo.PutPath(localDir, "files")))
+
+	// tarballs aren't downloaded to check whether they have been written
+	require.NoError(t, repo.PutPathTar(localDir, "checkpoints/def.tar.gz", ""))
+	require.NoError(t, NewWriteOnceRepository(&noGetRepository{Repository: diskRepo}).PutPathTar(localDir, "checkpoints/def.tar.gz", ""))
+	versions, err := diskRepo.List("checkpoints/def.tar.gz.versions")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+}
+
+// noGetRepository fails instead of reading files. It doesn't have Exists, so
+// the existence of files is checked by listing them.
+type noGetRepository struct {
+	Repository
+}
+
+func (r *noGetRepository) Get(p string) ([]byte, error) {
+	return nil, fmt.Errorf("Unexpected read of %s", p)
+}
+
+func TestLoadWriteOnceSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	diskRepo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	require.NoError(t, SaveSpec(diskRepo, &Spec{Version: Version, WriteOnce: true}))
+	require.NoError(t, SaveSpec(NewWriteOnceRepository(diskRepo), &Spec{Version: Version, WriteOnce: true, Quota: &Quota{TotalBytes: 100}}))
+
+	// the latest version is loaded, even if it isn't loaded with a WriteOnceRepository
+	spec, err := LoadSpec(diskRepo)
+	require.NoError(t, err)
+	require.True(t, spec.WriteOnce)
+	require.Equal(t, int64(100), spec.Quota.TotalBytes)
+}
@@ -18,6 +18,9 @@ type UserSettings struct {
 	FirstRun         bool   `json:"first_run"` // Set after first run
 	AnalyticsEnabled bool   `json:"analytics_enabled"`
 	AnalyticsID      string `json:"analytics_id"`
+
+	// Opt-in telemetry about command durations and failures, on top of analytics
+	TelemetryEnabled bool `json:"telemetry_enabled"`
 }
 
 // LoadUserSettings loads the global user settings from disk, returning default struct
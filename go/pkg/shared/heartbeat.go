@@ -12,14 +12,23 @@ type HeartbeatProcess struct {
 	experimentID string
 	ticker       *time.Ticker
 	done         chan struct{}
+	onStop       func()
 }
 
 func StartHeartbeat(proj *project.Project, experimentID string) *HeartbeatProcess {
+	return StartHeartbeatWatchingForStop(proj, experimentID, nil)
+}
+
+// StartHeartbeatWatchingForStop starts a heartbeat that also checks whether
+// the experiment has been asked to stop with "keepsake stop", and calls
+// onStop the first time it has
+func StartHeartbeatWatchingForStop(proj *project.Project, experimentID string, onStop func()) *HeartbeatProcess {
 	h := &HeartbeatProcess{
 		project:      proj,
 		experimentID: experimentID,
 		ticker:       time.NewTicker(5 * time.Second),
 		done:         make(chan struct{}),
+		onStop:       onStop,
 	}
 	go func() {
 		for {
@@ -38,6 +47,19 @@ func (h *HeartbeatProcess) Refresh() {
 	if err := h.project.RefreshHeartbeat(h.experimentID); err != nil {
 		console.Error("Failed to refresh heartbeat: %v", err)
 	}
+	if h.onStop == nil {
+		return
+	}
+	requested, err := h.project.IsStopRequested(h.experimentID)
+	if err != nil {
+		console.Warn("%v", err)
+		return
+	}
+	if requested {
+		onStop := h.onStop
+		h.onStop = nil
+		onStop()
+	}
 }
 
 func (h *HeartbeatProcess) Kill() {
@@ -32,6 +32,7 @@ func checkpointFromPb(chkPb *servicepb.Checkpoint) *project.Checkpoint {
 		Step:          chkPb.Step,
 		Path:          chkPb.Path,
 		PrimaryMetric: primaryMetricFromPb(chkPb.PrimaryMetric),
+		NoStep:        chkPb.NoStep,
 	}
 }
 
@@ -164,6 +165,7 @@ func checkpointToPb(chk *project.Checkpoint) *servicepb.Checkpoint {
 		Metrics:       valueMapToPb(chk.Metrics),
 		Path:          chk.Path,
 		PrimaryMetric: primaryMetricToPb(chk.PrimaryMetric),
+		NoStep:        chk.NoStep,
 	}
 }
 
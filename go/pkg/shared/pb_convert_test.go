@@ -160,6 +160,15 @@ func TestConvertEmptyCheckpointFromPb(t *testing.T) {
 	require.Equal(t, expected, checkpointFromPb(chkPb))
 }
 
+func TestConvertCheckpointWithoutStep(t *testing.T) {
+	chk := emptyCheckpoint()
+	chk.NoStep = true
+	chkPb := emptyCheckpointPb()
+	chkPb.NoStep = true
+	require.Equal(t, chk, checkpointFromPb(chkPb))
+	require.Equal(t, chkPb, checkpointToPb(chk))
+}
+
 func TestConvertExperimentFromPb(t *testing.T) {
 	expPb := fullExperimentPb()
 	expected := fullExperiment()
@@ -0,0 +1,172 @@
+package shared
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+const gcpMetadataURL = "http://metadata.google.internal"
+const awsMetadataURL = "http://169.254.169.254"
+
+// preemptionChecker asks a cloud provider's metadata server whether this
+// instance is about to be reclaimed
+type preemptionChecker interface {
+	Provider() string
+	// Available returns true if this machine is running on this provider
+	Available() bool
+	Preempted() (bool, error)
+}
+
+type gcpPreemptionChecker struct {
+	client  *http.Client
+	baseURL string
+}
+
+func (c *gcpPreemptionChecker) Provider() string {
+	return "gcp"
+}
+
+func (c *gcpPreemptionChecker) Available() bool {
+	_, err := c.get("/computeMetadata/v1/instance/id")
+	return err == nil
+}
+
+func (c *gcpPreemptionChecker) Preempted() (bool, error) {
+	body, err := c.get("/computeMetadata/v1/instance/preempted")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(body) == "TRUE", nil
+}
+
+func (c *gcpPreemptionChecker) get(path string) (string, error) {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return doMetadataRequest(c.client, req)
+}
+
+// awsPreemptionChecker checks for spot instance interruption notices, using IMDSv2
+type awsPreemptionChecker struct {
+	client  *http.Client
+	baseURL string
+}
+
+func (c *awsPreemptionChecker) Provider() string {
+	return "aws"
+}
+
+func (c *awsPreemptionChecker) Available() bool {
+	_, err := c.token()
+	return err == nil
+}
+
+func (c *awsPreemptionChecker) Preempted() (bool, error) {
+	token, err := c.token()
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("GET", c.baseURL+"/latest/meta-data/spot/instance-action", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	// 404 means no interruption is scheduled
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (c *awsPreemptionChecker) token() (string, error) {
+	req, err := http.NewRequest("PUT", c.baseURL+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	return doMetadataRequest(c.client, req)
+}
+
+func doMetadataRequest(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s returned status %d", req.Method, req.URL, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// detectPreemptionChecker returns a checker for the cloud provider this
+// machine is running on, or nil if it isn't running on a supported provider
+func detectPreemptionChecker() preemptionChecker {
+	client := &http.Client{Timeout: 2 * time.Second}
+	checkers := []preemptionChecker{
+		&gcpPreemptionChecker{client: client, baseURL: gcpMetadataURL},
+		&awsPreemptionChecker{client: client, baseURL: awsMetadataURL},
+	}
+	for _, checker := range checkers {
+		if checker.Available() {
+			return checker
+		}
+	}
+	return nil
+}
+
+// PreemptionWatcher polls the cloud provider's metadata server and calls
+// onPreempted once if the instance is about to be reclaimed
+type PreemptionWatcher struct {
+	checker     preemptionChecker
+	onPreempted func(provider string)
+	ticker      *time.Ticker
+	done        chan struct{}
+}
+
+func StartPreemptionWatcher(checker preemptionChecker, interval time.Duration, onPreempted func(provider string)) *PreemptionWatcher {
+	w := &PreemptionWatcher{
+		checker:     checker,
+		onPreempted: onPreempted,
+		ticker:      time.NewTicker(interval),
+		done:        make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-w.ticker.C:
+				preempted, err := w.checker.Preempted()
+				if err != nil {
+					console.Debug("Failed to check for preemption: %s", err)
+					continue
+				}
+				if preempted {
+					w.ticker.Stop()
+					w.onPreempted(w.checker.Provider())
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+func (w *PreemptionWatcher) Kill() {
+	w.ticker.Stop()
+	close(w.done)
+}
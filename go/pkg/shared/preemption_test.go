@@ -0,0 +1,93 @@
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCPPreemptionChecker(t *testing.T) {
+	preempted := "FALSE"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("1234"))
+		case "/computeMetadata/v1/instance/preempted":
+			w.Write([]byte(preempted))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	checker := &gcpPreemptionChecker{client: server.Client(), baseURL: server.URL}
+	require.True(t, checker.Available())
+	isPreempted, err := checker.Preempted()
+	require.NoError(t, err)
+	require.False(t, isPreempted)
+
+	preempted = "TRUE"
+	isPreempted, err = checker.Preempted()
+	require.NoError(t, err)
+	require.True(t, isPreempted)
+}
+
+func TestAWSPreemptionChecker(t *testing.T) {
+	interrupted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/spot/instance-action" && interrupted:
+			w.Write([]byte(`{"action": "terminate", "time": "2021-03-01T08:22:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	checker := &awsPreemptionChecker{client: server.Client(), baseURL: server.URL}
+	require.True(t, checker.Available())
+	isPreempted, err := checker.Preempted()
+	require.NoError(t, err)
+	require.False(t, isPreempted)
+
+	interrupted = true
+	isPreempted, err = checker.Preempted()
+	require.NoError(t, err)
+	require.True(t, isPreempted)
+
+	// not available on other providers
+	gcpChecker := &gcpPreemptionChecker{client: server.Client(), baseURL: server.URL}
+	require.False(t, gcpChecker.Available())
+}
+
+type fakePreemptionChecker struct {
+	preempted bool
+}
+
+func (c *fakePreemptionChecker) Provider() string         { return "fake" }
+func (c *fakePreemptionChecker) Available() bool          { return true }
+func (c *fakePreemptionChecker) Preempted() (bool, error) { return c.preempted, nil }
+
+func TestPreemptionWatcher(t *testing.T) {
+	providers := make(chan string, 2)
+	watcher := StartPreemptionWatcher(&fakePreemptionChecker{preempted: true}, time.Millisecond, func(provider string) {
+		providers <- provider
+	})
+	defer watcher.Kill()
+	require.Equal(t, "fake", <-providers)
+
+	// only called once
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, providers)
+}
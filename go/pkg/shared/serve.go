@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,15 +23,34 @@ import (
 	"github.com/replicate/keepsake/go/pkg/servicepb"
 )
 
+// earlyStopFlushTimeout is how long to wait for uploads to finish before
+// stopping an experiment with early_stopping
+const earlyStopFlushTimeout = 10 * time.Minute
+
 type projectGetter func() (proj *project.Project, err error)
 
 type server struct {
 	servicepb.UnimplementedDaemonServer
 
-	workChan                 chan func() error
-	projectGetter            projectGetter
-	project                  *project.Project
+	workChan      chan func() error
+	projectGetter projectGetter
+	project       *project.Project
+
+	// The process that started the daemon, which runs the experiments
+	trainingPID int
+
+	// mu guards the fields below, which gRPC requests, the preemption
+	// watcher, and the signal handler all use from their own goroutines
+	mu                       sync.Mutex
 	heartbeatsByExperimentID map[string]*HeartbeatProcess
+
+	systemMetricsByExperimentID map[string]*SystemMetricsProcess
+
+	preemptionWatcherStarted bool
+	preemptionWatcher        *PreemptionWatcher
+
+	// IDs of experiments that are being stopped by early_stopping
+	stoppingEarly map[string]bool
 }
 
 func (s *server) CreateExperiment(ctx context.Context, req *servicepb.CreateExperimentRequest) (*servicepb.CreateExperimentReply, error) {
@@ -51,7 +71,19 @@ func (s *server) CreateExperiment(ctx context.Context, req *servicepb.CreateExpe
 		return nil, handleError(err)
 	}
 	if !req.DisableHeartbeat {
-		s.heartbeatsByExperimentID[exp.ID] = StartHeartbeat(s.project, exp.ID)
+		experimentID := exp.ID
+		s.mu.Lock()
+		s.heartbeatsByExperimentID[exp.ID] = StartHeartbeatWatchingForStop(s.project, exp.ID, func() {
+			go s.handleStopRequest(experimentID)
+		})
+		if interval := proj.SystemMetricsInterval(); interval > 0 {
+			s.systemMetricsByExperimentID[exp.ID] = StartSystemMetrics(proj, exp, interval)
+		}
+		if proj.Config().WatchForPreemption && !s.preemptionWatcherStarted {
+			s.preemptionWatcherStarted = true
+			go s.startPreemptionWatcher()
+		}
+		s.mu.Unlock()
 	}
 
 	pbRetExp := experimentToPb(exp)
@@ -65,6 +97,8 @@ func (s *server) CreateCheckpoint(ctx context.Context, req *servicepb.CreateChec
 		Metrics:       valueMapFromPb(pbReqChk.GetMetrics()),
 		PrimaryMetric: primaryMetricFromPb(pbReqChk.PrimaryMetric),
 		Step:          pbReqChk.GetStep(),
+		NoStep:        pbReqChk.GetNoStep(),
+		ExperimentID:  req.GetExperimentID(),
 	}
 	proj, err := s.getProject()
 	if err != nil {
@@ -90,14 +124,21 @@ func (s *server) SaveExperiment(ctx context.Context, req *servicepb.SaveExperime
 	if err != nil {
 		return nil, handleError(err)
 	}
+	s.checkEarlyStopping(proj, exp)
 	return &servicepb.SaveExperimentReply{Experiment: experimentToPb(exp)}, nil
 }
 
 func (s *server) StopExperiment(ctx context.Context, req *servicepb.StopExperimentRequest) (*servicepb.StopExperimentReply, error) {
+	s.mu.Lock()
 	if _, ok := s.heartbeatsByExperimentID[req.ExperimentID]; ok {
 		s.heartbeatsByExperimentID[req.ExperimentID].Kill()
 		delete(s.heartbeatsByExperimentID, req.ExperimentID)
 	}
+	if _, ok := s.systemMetricsByExperimentID[req.ExperimentID]; ok {
+		s.systemMetricsByExperimentID[req.ExperimentID].Kill()
+		delete(s.systemMetricsByExperimentID, req.ExperimentID)
+	}
+	s.mu.Unlock()
 	proj, err := s.getProject()
 	if err != nil {
 		return nil, handleError(err)
@@ -222,7 +263,11 @@ func Serve(projGetter projectGetter, socketPath string) error {
 		// upload at a lesser interval
 		workChan:                 make(chan func() error, 2),
 		projectGetter:            projGetter,
+		trainingPID:              os.Getppid(),
 		heartbeatsByExperimentID: make(map[string]*HeartbeatProcess),
+
+		systemMetricsByExperimentID: make(map[string]*SystemMetricsProcess),
+		stoppingEarly:               make(map[string]bool),
 	}
 	servicepb.RegisterDaemonServer(grpcServer, s)
 
@@ -238,7 +283,7 @@ func Serve(projGetter projectGetter, socketPath string) error {
 		syscall.SIGQUIT)
 
 	go func() {
-		<-sigc
+		sig := <-sigc
 		console.Debug("Exiting...")
 		s.workChan <- nil // nil is an exit sentinel
 
@@ -263,9 +308,23 @@ func Serve(projGetter projectGetter, socketPath string) error {
 			}
 		}
 
-		for _, hb := range s.heartbeatsByExperimentID {
+		// Python stops the daemon with SIGTERM when the training process
+		// exits. Ctrl-C sends SIGINT to the daemon too, because it is in the
+		// training process's process group.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for experimentID, hb := range s.heartbeatsByExperimentID {
+			if err := s.project.FinishExperiment(experimentID, sig == syscall.SIGINT); err != nil {
+				console.Error("Failed to record that experiment %s has finished: %v", experimentID[:7], err)
+			}
 			hb.Kill()
 		}
+		for _, m := range s.systemMetricsByExperimentID {
+			m.Kill()
+		}
+		if s.preemptionWatcher != nil {
+			s.preemptionWatcher.Kill()
+		}
 		grpcServer.Stop()
 	}()
 
@@ -273,6 +332,9 @@ func Serve(projGetter projectGetter, socketPath string) error {
 		for {
 			work := <-s.workChan
 			if work == nil {
+				if s.project != nil {
+					s.project.RemoveDeltaBases()
+				}
 				completedChan <- struct{}{}
 				return
 			}
@@ -303,3 +365,150 @@ func handleError(err error) error {
 	}
 	return status.Error(codes.Unknown, err.Error())
 }
+
+func (s *server) startPreemptionWatcher() {
+	checker := detectPreemptionChecker()
+	if checker == nil {
+		console.Warn("watch_for_preemption is set in keepsake.yaml, but this machine doesn't appear to be running on GCP or AWS, so Keepsake can't watch for preemption")
+		return
+	}
+	console.Debug("Watching for preemption on %s", checker.Provider())
+	watcher := StartPreemptionWatcher(checker, 5*time.Second, s.handlePreemption)
+	s.mu.Lock()
+	s.preemptionWatcher = watcher
+	s.mu.Unlock()
+}
+
+// handlePreemption marks running experiments as preempted, waits for
+// pending uploads to finish, then asks the training process to exit
+func (s *server) handlePreemption(provider string) {
+	console.Warn("This instance is being preempted by %s. Saving experiments and stopping...", provider)
+	for _, experimentID := range s.runningExperimentIDs() {
+		if err := s.project.MarkExperimentPreempted(experimentID, provider); err != nil {
+			console.Error("Failed to mark experiment %s as preempted: %v", experimentID, err)
+		}
+	}
+	// GCP gives 30 seconds of notice, so leave some time for the training process to exit
+	if !s.flush(20 * time.Second) {
+		console.Warn("Timed out waiting for uploads to finish before preemption")
+	}
+	s.signalTrainingProcess()
+}
+
+// runningExperimentIDs returns the IDs of the experiments this process is
+// sending heartbeats for
+func (s *server) runningExperimentIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.heartbeatsByExperimentID))
+	for id := range s.heartbeatsByExperimentID {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// checkEarlyStopping stops exp if it is running in this process and
+// early_stopping in keepsake.yaml says its metric has stopped improving
+func (s *server) checkEarlyStopping(proj *project.Project, exp *project.Experiment) {
+	conf := proj.Config().EarlyStopping
+	if conf == nil {
+		return
+	}
+	reason := project.EarlyStoppingReason(exp, conf)
+	if reason == "" {
+		return
+	}
+	s.mu.Lock()
+	_, running := s.heartbeatsByExperimentID[exp.ID]
+	stop := running && !s.stoppingEarly[exp.ID]
+	if stop {
+		s.stoppingEarly[exp.ID] = true
+	}
+	s.mu.Unlock()
+	if stop {
+		go s.handleEarlyStop(exp.ID, reason)
+	}
+}
+
+// handleEarlyStop records why an experiment is being stopped, then stops it
+func (s *server) handleEarlyStop(experimentID string, reason string) {
+	console.Warn("Stopping experiment %s early, because %s", experimentID[:7], reason)
+	if err := s.project.MarkExperimentStoppedEarly(experimentID, reason); err != nil {
+		console.Error("Failed to record why experiment %s was stopped: %v", experimentID[:7], err)
+	}
+	s.stopExperiment(experimentID)
+}
+
+// handleStopRequest stops an experiment that has been asked to stop with
+// "keepsake stop"
+func (s *server) handleStopRequest(experimentID string) {
+	console.Warn("Stopping experiment %s, because it was asked to stop with 'keepsake stop'", experimentID[:7])
+	s.stopExperiment(experimentID)
+}
+
+// stopExperiment waits for pending uploads to finish, then stops an
+// experiment running in this process. If it is the only one, the training
+// process is asked to exit. Otherwise the training process is left running
+// the others, and the experiment's heartbeat is stopped and it is recorded as
+// stopped.
+func (s *server) stopExperiment(experimentID string) {
+	if !s.flush(earlyStopFlushTimeout) {
+		console.Warn("Timed out waiting for uploads to finish before stopping")
+	}
+	s.mu.Lock()
+	_, running := s.heartbeatsByExperimentID[experimentID]
+	others := len(s.heartbeatsByExperimentID) - 1
+	if running && others > 0 {
+		s.heartbeatsByExperimentID[experimentID].Kill()
+		delete(s.heartbeatsByExperimentID, experimentID)
+		if m, ok := s.systemMetricsByExperimentID[experimentID]; ok {
+			m.Kill()
+			delete(s.systemMetricsByExperimentID, experimentID)
+		}
+	}
+	s.mu.Unlock()
+	if !running {
+		// it has already been stopped with StopExperiment
+		return
+	}
+	if others > 0 {
+		if err := s.project.FinishExperiment(experimentID, true); err != nil {
+			console.Error("Failed to record that experiment %s has stopped: %v", experimentID[:7], err)
+		}
+		console.Warn("Stopped experiment %s, but not the training process, because it is running %d other experiments", experimentID[:7], others)
+		return
+	}
+	s.signalTrainingProcess()
+}
+
+// signalTrainingProcess asks the training process to exit with SIGTERM, if it
+// is still running
+func (s *server) signalTrainingProcess() {
+	// if the training process has exited, the daemon has a new parent, and
+	// trainingPID may have been reused by an unrelated process
+	if os.Getppid() != s.trainingPID {
+		console.Debug("Training process %d has already exited", s.trainingPID)
+		return
+	}
+	if err := syscall.Kill(s.trainingPID, syscall.SIGTERM); err != nil {
+		console.Error("Failed to stop training process: %v", err)
+	}
+}
+
+// flush waits for everything queued for upload to be uploaded, returning
+// false if that takes longer than timeout
+func (s *server) flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	deadline := time.After(timeout)
+	select {
+	case s.workChan <- func() error { close(done); return nil }:
+	case <-deadline:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-deadline:
+		return false
+	}
+}
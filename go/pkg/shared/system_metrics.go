@@ -0,0 +1,68 @@
+package shared
+
+import (
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+	"github.com/replicate/keepsake/go/pkg/project"
+	"github.com/replicate/keepsake/go/pkg/sysmetrics"
+)
+
+// SystemMetricsProcess samples system utilization while an experiment is
+// running and saves the time series to the repository after each sample.
+// Only the chunk of the series the sample is in is saved each time.
+type SystemMetricsProcess struct {
+	project    *project.Project
+	experiment *project.Experiment
+	sampler    *sysmetrics.Sampler
+	// samples in the current chunk
+	chunk   int
+	samples []*sysmetrics.Sample
+	ticker  *time.Ticker
+	done    chan struct{}
+}
+
+func StartSystemMetrics(proj *project.Project, exp *project.Experiment, interval time.Duration) *SystemMetricsProcess {
+	m := &SystemMetricsProcess{
+		project:    proj,
+		experiment: exp,
+		sampler:    sysmetrics.NewSampler(),
+		samples:    []*sysmetrics.Sample{},
+		ticker:     time.NewTicker(interval),
+		// buffered, so Kill doesn't wait for a sample that is being saved
+		done: make(chan struct{}, 1),
+	}
+	// take an initial sample so CPU utilization is measured from the start of the experiment
+	m.sampler.Sample()
+	go func() {
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-m.ticker.C:
+				m.Sample()
+			}
+		}
+	}()
+	return m
+}
+
+func (m *SystemMetricsProcess) Sample() {
+	if len(m.samples) == project.SystemMetricsChunkSize {
+		m.chunk++
+		m.samples = []*sysmetrics.Sample{}
+	}
+	m.samples = append(m.samples, m.sampler.Sample())
+	if err := m.project.SaveSystemMetrics(m.experiment, m.chunk, m.samples); err != nil {
+		console.Error("Failed to save system metrics: %v", err)
+	}
+}
+
+// Kill stops sampling, without waiting for a sample that is being saved
+func (m *SystemMetricsProcess) Kill() {
+	m.ticker.Stop()
+	select {
+	case m.done <- struct{}{}:
+	default:
+	}
+}
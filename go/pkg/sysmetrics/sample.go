@@ -0,0 +1,251 @@
+// Package sysmetrics samples system utilization (CPU, RAM, GPUs) while an experiment is running
+package sysmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replicate/keepsake/go/pkg/console"
+)
+
+// Sample is a snapshot of system utilization at a point in time
+type Sample struct {
+	Time          time.Time    `json:"time"`
+	CPUPercent    float64      `json:"cpu_percent"`
+	MemoryPercent float64      `json:"memory_percent"`
+	MemoryUsed    uint64       `json:"memory_used"`
+	MemoryTotal   uint64       `json:"memory_total"`
+	GPUs          []*GPUSample `json:"gpus,omitempty"`
+}
+
+// GPUSample is the utilization of a single GPU
+type GPUSample struct {
+	Index       int     `json:"index"`
+	Utilization float64 `json:"utilization_percent"`
+	MemoryUsed  uint64  `json:"memory_used"`
+	MemoryTotal uint64  `json:"memory_total"`
+}
+
+// Sampler takes samples of system utilization. CPU utilization is measured
+// between consecutive calls to Sample(), so a Sampler should be reused.
+type Sampler struct {
+	prevCPUBusy  uint64
+	prevCPUTotal uint64
+	hasGPUs      bool
+}
+
+func NewSampler() *Sampler {
+	_, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		console.Debug("nvidia-smi not found, not sampling GPU utilization")
+	}
+	return &Sampler{hasGPUs: err == nil}
+}
+
+// Sample returns the current system utilization. Anything that can't be measured
+// on this system (e.g. /proc on macOS) is left as zero.
+func (s *Sampler) Sample() *Sample {
+	sample := &Sample{Time: time.Now().UTC()}
+
+	if data, err := ioutil.ReadFile("/proc/stat"); err == nil {
+		busy, total, err := parseProcStat(string(data))
+		if err != nil {
+			console.Debug("Failed to parse /proc/stat: %s", err)
+		} else if total > s.prevCPUTotal {
+			sample.CPUPercent = 100 * float64(busy-s.prevCPUBusy) / float64(total-s.prevCPUTotal)
+			s.prevCPUBusy, s.prevCPUTotal = busy, total
+		}
+	}
+
+	if data, err := ioutil.ReadFile("/proc/meminfo"); err == nil {
+		used, total, err := parseProcMeminfo(string(data))
+		if err != nil {
+			console.Debug("Failed to parse /proc/meminfo: %s", err)
+		} else {
+			sample.MemoryUsed, sample.MemoryTotal = used, total
+			if total > 0 {
+				sample.MemoryPercent = 100 * float64(used) / float64(total)
+			}
+		}
+	}
+
+	if s.hasGPUs {
+		// nvidia-smi is a thin wrapper around NVML, and means we don't need cgo
+		out, err := exec.Command("nvidia-smi", "--query-gpu=index,utilization.gpu,memory.used,memory.total", "--format=csv,noheader,nounits").Output()
+		if err != nil {
+			console.Debug("Failed to run nvidia-smi: %s", err)
+		} else if gpus, err := parseNvidiaSmi(strings.NewReader(string(out))); err != nil {
+			console.Debug("Failed to parse nvidia-smi output: %s", err)
+		} else {
+			sample.GPUs = gpus
+		}
+	}
+
+	return sample
+}
+
+// parseProcStat returns busy and total jiffies from the aggregate "cpu" line of /proc/stat
+func parseProcStat(data string) (busy uint64, total uint64, err error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		for i, field := range fields[1:] {
+			n, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			total += n
+			// idle and iowait
+			if i != 3 && i != 4 {
+				busy += n
+			}
+		}
+		return busy, total, nil
+	}
+	return 0, 0, fmt.Errorf("No cpu line found")
+}
+
+// parseProcMeminfo returns used and total memory in bytes
+func parseProcMeminfo(data string) (used uint64, total uint64, err error) {
+	values := map[string]uint64{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		// values are in kB
+		values[strings.TrimSuffix(fields[0], ":")] = n * 1024
+	}
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, 0, fmt.Errorf("MemTotal not found")
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	return total - available, total, nil
+}
+
+// parseNvidiaSmi parses the CSV output of nvidia-smi --query-gpu=index,utilization.gpu,memory.used,memory.total
+func parseNvidiaSmi(r io.Reader) ([]*GPUSample, error) {
+	gpus := []*GPUSample{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("Unexpected line: %q", line)
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		utilization, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		memoryUsed, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		memoryTotal, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		// memory is in MiB
+		gpus = append(gpus, &GPUSample{
+			Index:       index,
+			Utilization: utilization,
+			MemoryUsed:  memoryUsed * 1024 * 1024,
+			MemoryTotal: memoryTotal * 1024 * 1024,
+		})
+	}
+	return gpus, scanner.Err()
+}
+
+// Summary is the average and peak utilization over a series of samples
+type Summary struct {
+	NumSamples  int
+	Start       time.Time
+	End         time.Time
+	CPUMean     float64
+	CPUMax      float64
+	MemoryMax   uint64
+	MemoryTotal uint64
+	GPUs        []*GPUSummary
+}
+
+// GPUSummary is the average and peak utilization of a single GPU
+type GPUSummary struct {
+	Index           int
+	UtilizationMean float64
+	UtilizationMax  float64
+	MemoryMax       uint64
+	MemoryTotal     uint64
+}
+
+// Summarize returns the average and peak utilization over samples, or nil if
+// there are no samples
+func Summarize(samples []*Sample) *Summary {
+	if len(samples) == 0 {
+		return nil
+	}
+	summary := &Summary{
+		NumSamples: len(samples),
+		Start:      samples[0].Time,
+		End:        samples[len(samples)-1].Time,
+	}
+	gpusByIndex := map[int]*GPUSummary{}
+	gpuSampleCounts := map[int]int{}
+	for _, s := range samples {
+		summary.CPUMean += s.CPUPercent
+		if s.CPUPercent > summary.CPUMax {
+			summary.CPUMax = s.CPUPercent
+		}
+		if s.MemoryUsed > summary.MemoryMax {
+			summary.MemoryMax = s.MemoryUsed
+		}
+		summary.MemoryTotal = s.MemoryTotal
+		for _, g := range s.GPUs {
+			gs, ok := gpusByIndex[g.Index]
+			if !ok {
+				gs = &GPUSummary{Index: g.Index}
+				gpusByIndex[g.Index] = gs
+				summary.GPUs = append(summary.GPUs, gs)
+			}
+			gpuSampleCounts[g.Index]++
+			gs.UtilizationMean += g.Utilization
+			if g.Utilization > gs.UtilizationMax {
+				gs.UtilizationMax = g.Utilization
+			}
+			if g.MemoryUsed > gs.MemoryMax {
+				gs.MemoryMax = g.MemoryUsed
+			}
+			gs.MemoryTotal = g.MemoryTotal
+		}
+	}
+	summary.CPUMean /= float64(len(samples))
+	for _, gs := range summary.GPUs {
+		gs.UtilizationMean /= float64(gpuSampleCounts[gs.Index])
+	}
+	return summary
+}
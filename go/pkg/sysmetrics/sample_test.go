@@ -0,0 +1,69 @@
+package sysmetrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	busy, total, err := parseProcStat(`cpu  100 10 50 800 40 0 0 0 0 0
+cpu0 50 5 25 400 20 0 0 0 0 0
+intr 12345
+`)
+	require.NoError(t, err)
+	require.Equal(t, uint64(160), busy)
+	require.Equal(t, uint64(1000), total)
+
+	_, _, err = parseProcStat("intr 12345\n")
+	require.Error(t, err)
+}
+
+func TestParseProcMeminfo(t *testing.T) {
+	used, total, err := parseProcMeminfo(`MemTotal:       16000 kB
+MemFree:         2000 kB
+MemAvailable:    4000 kB
+`)
+	require.NoError(t, err)
+	require.Equal(t, uint64(12000*1024), used)
+	require.Equal(t, uint64(16000*1024), total)
+}
+
+func TestParseNvidiaSmi(t *testing.T) {
+	gpus, err := parseNvidiaSmi(strings.NewReader("0, 87, 10240, 16160\n1, 3, 0, 16160\n"))
+	require.NoError(t, err)
+	require.Equal(t, []*GPUSample{
+		{Index: 0, Utilization: 87, MemoryUsed: 10240 * 1024 * 1024, MemoryTotal: 16160 * 1024 * 1024},
+		{Index: 1, Utilization: 3, MemoryUsed: 0, MemoryTotal: 16160 * 1024 * 1024},
+	}, gpus)
+
+	_, err = parseNvidiaSmi(strings.NewReader("[Not Supported]\n"))
+	require.Error(t, err)
+}
+
+func TestSummarize(t *testing.T) {
+	require.Nil(t, Summarize([]*Sample{}))
+
+	start := time.Date(2020, 12, 7, 1, 13, 0, 0, time.UTC)
+	summary := Summarize([]*Sample{{
+		Time:        start,
+		CPUPercent:  20,
+		MemoryUsed:  100,
+		MemoryTotal: 1000,
+		GPUs:        []*GPUSample{{Index: 0, Utilization: 90, MemoryUsed: 50, MemoryTotal: 200}},
+	}, {
+		Time:        start.Add(30 * time.Second),
+		CPUPercent:  40,
+		MemoryUsed:  300,
+		MemoryTotal: 1000,
+		GPUs:        []*GPUSample{{Index: 0, Utilization: 10, MemoryUsed: 150, MemoryTotal: 200}},
+	}})
+	require.Equal(t, 2, summary.NumSamples)
+	require.Equal(t, 30*time.Second, summary.End.Sub(summary.Start))
+	require.Equal(t, 30.0, summary.CPUMean)
+	require.Equal(t, 40.0, summary.CPUMax)
+	require.Equal(t, uint64(300), summary.MemoryMax)
+	require.Equal(t, []*GPUSummary{{Index: 0, UtilizationMean: 50, UtilizationMax: 90, MemoryMax: 150, MemoryTotal: 200}}, summary.GPUs)
+}
@@ -0,0 +1,124 @@
+// Package table renders tables as CSV, Markdown, or HTML, for pasting into
+// spreadsheets, wikis, and papers
+package table
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatCSV      Format = "csv"
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+)
+
+// Formats is every format a table can be rendered in
+var Formats = []Format{FormatCSV, FormatMarkdown, FormatHTML}
+
+// Table is a heading row and rows of cells. Cells can contain newlines.
+type Table struct {
+	Headings []string
+	Rows     [][]string
+}
+
+// New returns a table with headings
+func New(headings ...string) *Table {
+	return &Table{Headings: headings}
+}
+
+// AddRow adds a row of cells to the table
+func (t *Table) AddRow(cells ...string) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// ParseFormat returns the format named s
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown table format: %q. It must be 'csv', 'md', or 'html'.", s)
+}
+
+// Write renders the table to w in format
+func (t *Table) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatCSV:
+		return t.writeCSV(w)
+	case FormatMarkdown:
+		return t.writeMarkdown(w)
+	case FormatHTML:
+		return t.writeHTML(w)
+	}
+	return fmt.Errorf("Unknown table format: %q", format)
+}
+
+func (t *Table) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Headings); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (t *Table) writeMarkdown(w io.Writer) error {
+	separators := make([]string, len(t.Headings))
+	for i := range separators {
+		separators[i] = "---"
+	}
+	lines := []string{markdownRow(t.Headings), markdownRow(separators)}
+	for _, row := range t.Rows {
+		lines = append(lines, markdownRow(row))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = MarkdownCell(cell)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
+
+// MarkdownCell escapes s so it can be put in a cell of a Markdown table
+func MarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func (t *Table) writeHTML(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("<table>\n<thead>\n")
+	writeHTMLRow(&sb, "th", t.Headings)
+	sb.WriteString("</thead>\n<tbody>\n")
+	for _, row := range t.Rows {
+		writeHTMLRow(&sb, "td", row)
+	}
+	sb.WriteString("</tbody>\n</table>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeHTMLRow(sb *strings.Builder, tag string, cells []string) {
+	sb.WriteString("<tr>")
+	for _, cell := range cells {
+		cell = strings.ReplaceAll(html.EscapeString(cell), "\n", "<br>")
+		fmt.Fprintf(sb, "<%s>%s</%s>", tag, cell, tag)
+	}
+	sb.WriteString("</tr>\n")
+}
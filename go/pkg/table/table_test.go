@@ -0,0 +1,38 @@
+package table
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTable() *Table {
+	t := New("name", "value")
+	t.AddRow("lr", "0.01")
+	t.AddRow("a|b, c", "<x>\n\"y\"")
+	return t
+}
+
+func TestWrite(t *testing.T) {
+	for _, tt := range []struct {
+		format   Format
+		expected string
+	}{
+		{FormatCSV, "name,value\nlr,0.01\n\"a|b, c\",\"<x>\n\"\"y\"\"\"\n"},
+		{FormatMarkdown, "| name | value |\n| --- | --- |\n| lr | 0.01 |\n| a\\|b, c | <x><br>\"y\" |\n"},
+		{FormatHTML, "<table>\n<thead>\n<tr><th>name</th><th>value</th></tr>\n</thead>\n<tbody>\n<tr><td>lr</td><td>0.01</td></tr>\n<tr><td>a|b, c</td><td>&lt;x&gt;<br>&#34;y&#34;</td></tr>\n</tbody>\n</table>\n"},
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, testTable().Write(&buf, tt.format))
+		require.Equal(t, tt.expected, buf.String(), tt.format)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("md")
+	require.NoError(t, err)
+	require.Equal(t, FormatMarkdown, format)
+	_, err = ParseFormat("xlsx")
+	require.Error(t, err)
+}
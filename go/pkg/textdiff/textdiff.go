@@ -0,0 +1,216 @@
+// Package textdiff finds the lines that differ between two texts, and groups
+// them into hunks for unified diffs
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is a line of a diff. Text includes the line's trailing newline, if it
+// has one.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Hunk is a run of changed lines, with the unchanged lines around them. Starts
+// are 1-based line numbers, as in unified diffs.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// SplitLines splits s into lines, keeping their trailing newlines so a missing
+// newline at the end of the text counts as a difference
+func SplitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines returns the shortest edit from a to b, as every line of a and b in
+// order, marked as equal, deleted from a, or inserted from b. It uses Myers'
+// algorithm, so it takes time and memory proportional to the number of changes.
+func Lines(a, b []string) []Line {
+	// the same lines at the start and end don't need to be searched
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	result := []Line{}
+	for _, text := range a[:prefix] {
+		result = append(result, Line{Equal, text})
+	}
+	result = append(result, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		result = append(result, Line{Equal, text})
+	}
+	return result
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	// v[offset+k] is the furthest x reached on diagonal k, and trace[d] is
+	// v before d edits were made, for walking back along the edit path
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	trace := [][]int{}
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	reversed := []Line{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Line{Insert, b[y-1]})
+			} else {
+				reversed = append(reversed, Line{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	result := make([]Line, len(reversed))
+	for i, line := range reversed {
+		result[len(reversed)-1-i] = line
+	}
+	return result
+}
+
+// Hunks groups the changes in lines into hunks, with up to context unchanged
+// lines around each change. Changes that are closer together than that share
+// a hunk.
+func Hunks(lines []Line, context int) []*Hunk {
+	hunks := []*Hunk{}
+	// line numbers before lines[i]
+	oldLine, newLine := 0, 0
+	i := 0
+	for i < len(lines) {
+		if lines[i].Op == Equal {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// find the last change that is close enough to the one before it
+		lastChange := i
+		for j := i; j < len(lines) && j-lastChange <= 2*context; j++ {
+			if lines[j].Op != Equal {
+				lastChange = j
+			}
+		}
+		end := lastChange + context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		h := &Hunk{
+			OldStart: oldLine - (i - start),
+			NewStart: newLine - (i - start),
+			Lines:    lines[start:end],
+		}
+		for _, line := range h.Lines {
+			if line.Op != Insert {
+				h.OldLines++
+			}
+			if line.Op != Delete {
+				h.NewLines++
+			}
+		}
+		// unified diffs number empty ranges from the line before them
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+		hunks = append(hunks, h)
+
+		for _, line := range lines[i:end] {
+			if line.Op != Insert {
+				oldLine++
+			}
+			if line.Op != Delete {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return hunks
+}
+
+// Header returns the hunk's "@@ -1,2 +1,3 @@" line, without a newline
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", formatRange(h.OldStart, h.OldLines), formatRange(h.NewStart, h.NewLines))
+}
+
+func formatRange(start int, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
@@ -0,0 +1,62 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitLines(t *testing.T) {
+	require.Equal(t, []string{}, SplitLines(""))
+	require.Equal(t, []string{"a\n", "b\n"}, SplitLines("a\nb\n"))
+	require.Equal(t, []string{"a\n", "b"}, SplitLines("a\nb"))
+}
+
+func TestLines(t *testing.T) {
+	for _, tt := range []struct {
+		a, b     string
+		expected string
+	}{
+		{"", "", ""},
+		{"a b c", "a b c", " a b c"},
+		{"", "a b", "+a+b"},
+		{"a b", "", "-a-b"},
+		{"a b c", "a x c", " a-b+x c"},
+		{"a b c d e", "b c x e f", "-a b c-d+x e+f"},
+	} {
+		lines := Lines(strings.Fields(tt.a), strings.Fields(tt.b))
+		actual := ""
+		for _, line := range lines {
+			actual += map[Op]string{Equal: " ", Delete: "-", Insert: "+"}[line.Op] + line.Text
+		}
+		require.Equal(t, tt.expected, actual, "%q -> %q", tt.a, tt.b)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	a := strings.Fields("1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20")
+	b := strings.Fields("1 x 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20")
+	// a change close to the start, and one in the middle
+	b[12] = "y"
+	hunks := Hunks(Lines(a, b), 3)
+	require.Len(t, hunks, 2)
+	require.Equal(t, "@@ -1,5 +1,5 @@", hunks[0].Header())
+	require.Equal(t, "1", hunks[0].Lines[0].Text)
+	require.Equal(t, "@@ -10,7 +10,7 @@", hunks[1].Header())
+
+	// changes within twice the context are in the same hunk
+	b = append([]string(nil), a...)
+	b[5] = "x"
+	b[11] = "y"
+	hunks = Hunks(Lines(a, b), 3)
+	require.Len(t, hunks, 1)
+	require.Equal(t, "@@ -3,13 +3,13 @@", hunks[0].Header())
+
+	// a new file
+	hunks = Hunks(Lines(nil, []string{"a"}), 3)
+	require.Len(t, hunks, 1)
+	require.Equal(t, "@@ -0,0 +1 @@", hunks[0].Header())
+
+	require.Len(t, Hunks(Lines(a, a), 3), 0)
+}
@@ -0,0 +1,178 @@
+// Package update downloads new releases of the Keepsake CLI and replaces the running binary with them
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Release is the JSON document at the release URL that describes the latest
+// release. The whole document is signed, so neither the version nor the
+// binary and checksum for each platform can be changed or swapped.
+type Release struct {
+	Version string `json:"version"`
+
+	// Binaries by platform, e.g. "linux-amd64"
+	Binaries map[string]*Binary `json:"binaries"`
+}
+
+// Binary is a downloadable keepsake binary for one platform
+type Binary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+var httpClient = &http.Client{
+	Timeout: 5 * time.Minute,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("Refusing to follow a redirect to %s, because releases must be downloaded over HTTPS", req.URL)
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("Stopped after 10 redirects")
+		}
+		return nil
+	},
+}
+
+// FetchRelease fetches the release document at releaseURL, and checks its
+// signature at SignatureURL(releaseURL) against publicKey, a base64-encoded
+// ed25519 public key. It fails if publicKey is empty, because nothing else
+// shows the release is genuine.
+func FetchRelease(releaseURL string, publicKey string) (*Release, error) {
+	if publicKey == "" {
+		return nil, fmt.Errorf("This build of Keepsake doesn't have a release public key, so it can't check that the release at %s is genuine", releaseURL)
+	}
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Invalid release public key")
+	}
+	data, err := get(releaseURL)
+	if err != nil {
+		return nil, err
+	}
+	signatureURL := SignatureURL(releaseURL)
+	encodedSignature, err := get(signatureURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download the signature of the release: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse the signature at %s: %w", signatureURL, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, signature) {
+		return nil, fmt.Errorf("The signature of the release at %s is invalid. It may have been tampered with.", releaseURL)
+	}
+
+	release := new(Release)
+	if err := json.Unmarshal(data, release); err != nil {
+		return nil, fmt.Errorf("Failed to parse release information from %s: %w", releaseURL, err)
+	}
+	if release.Version == "" {
+		return nil, fmt.Errorf("The release information at %s doesn't have a version", releaseURL)
+	}
+	return release, nil
+}
+
+// SignatureURL returns the URL of the signature of the release document at
+// releaseURL: the base64-encoded ed25519 signature of the document's bytes
+func SignatureURL(releaseURL string) string {
+	return releaseURL + ".sig"
+}
+
+// Binary returns the binary for the platform goos-goarch
+func (r *Release) Binary(goos, goarch string) (*Binary, error) {
+	platform := goos + "-" + goarch
+	binary, ok := r.Binaries[platform]
+	if !ok || binary.URL == "" {
+		return nil, fmt.Errorf("Keepsake %s isn't available for %s", r.Version, platform)
+	}
+	return binary, nil
+}
+
+// Download downloads the binary and checks its checksum
+func (b *Binary) Download() ([]byte, error) {
+	data, err := get(b.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Verify(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Verify checks data is the binary that was released. The checksum can be
+// trusted because it is part of the signed release document.
+func (b *Binary) Verify(data []byte) error {
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != b.SHA256 {
+		return fmt.Errorf("The checksum of %s doesn't match the release (expected %s, got %s). The download may have been corrupted or tampered with.", b.URL, b.SHA256, actual)
+	}
+	return nil
+}
+
+// ReplaceExecutable atomically replaces the executable at path with data, by
+// writing it to a temporary file in the same directory and renaming it over path
+func ReplaceExecutable(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+"-update-")
+	if err != nil {
+		return fmt.Errorf("Failed to write to %s: %w", dir, err)
+	}
+	tempPath := f.Name()
+	defer os.Remove(tempPath)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to write %s: %w", tempPath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", tempPath, err)
+	}
+	if err := os.Chmod(tempPath, info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("Failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+func get(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("Refusing to download %s, because releases must be downloaded over HTTPS", rawURL)
+	}
+	resp, err := httpClient.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to download %s: status %d", rawURL, resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %s: %w", rawURL, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,134 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRelease(t *testing.T) {
+	binaryData := []byte("#!/bin/sh\necho new keepsake\n")
+	sum := sha256.Sum256(binaryData)
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	encodedPublicKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	defer useTransport(server.Client().Transport)()
+	manifest := fmt.Sprintf(`{"version": "0.5.0", "binaries": {"linux-amd64": {"url": "%s/keepsake", "sha256": "%s"}}}`, server.URL, hex.EncodeToString(sum[:]))
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(manifest))) + "\n"
+	mux.HandleFunc("/latest.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, manifest)
+	})
+	mux.HandleFunc("/latest.json.sig", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, signature)
+	})
+	mux.HandleFunc("/keepsake", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(binaryData)
+	})
+
+	release, err := FetchRelease(server.URL+"/latest.json", encodedPublicKey)
+	require.NoError(t, err)
+	require.Equal(t, "0.5.0", release.Version)
+
+	_, err = release.Binary("windows", "amd64")
+	require.Error(t, err)
+	binary, err := release.Binary("linux", "amd64")
+	require.NoError(t, err)
+
+	data, err := binary.Download()
+	require.NoError(t, err)
+	require.Equal(t, binaryData, data)
+
+	err = binary.Verify([]byte("truncated"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum")
+
+	// without a public key, nothing is trusted
+	_, err = FetchRelease(server.URL+"/latest.json", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "public key")
+
+	otherPublicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, err = FetchRelease(server.URL+"/latest.json", base64.StdEncoding.EncodeToString(otherPublicKey))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature")
+
+	// the version is signed too, so an old release can't be passed off as a new one
+	manifest = strings.Replace(manifest, "0.5.0", "0.6.0", 1)
+	_, err = FetchRelease(server.URL+"/latest.json", encodedPublicKey)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature")
+
+	signature = ""
+	_, err = FetchRelease(server.URL+"/latest.json", encodedPublicKey)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature")
+}
+
+func TestDownloadRequiresHTTPS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": "0.5.0"}`)
+	}))
+	defer server.Close()
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	encodedPublicKey := base64.StdEncoding.EncodeToString(publicKey)
+	_, err = FetchRelease(server.URL+"/latest.json", encodedPublicKey)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "HTTPS")
+
+	// redirects from HTTPS to HTTP aren't followed either
+	redirect := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/latest.json", http.StatusFound)
+	}))
+	defer redirect.Close()
+	defer useTransport(redirect.Client().Transport)()
+	_, err = FetchRelease(redirect.URL+"/latest.json", encodedPublicKey)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "HTTPS")
+}
+
+// useTransport makes downloads use transport, e.g. to trust a test server's
+// certificate, and returns a function that restores the original
+func useTransport(transport http.RoundTripper) func() {
+	original := httpClient.Transport
+	httpClient.Transport = transport
+	return func() { httpClient.Transport = original }
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepsake-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keepsake")
+	require.NoError(t, ioutil.WriteFile(path, []byte("old"), 0755))
+	require.NoError(t, ReplaceExecutable(path, []byte("new")))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// no temporary files left behind
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
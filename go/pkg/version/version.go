@@ -0,0 +1,68 @@
+// Package version compares Keepsake version numbers
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed version number, like 1.2.3
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// Parse parses a version like "1.2.3". A "v" prefix and any suffix after "-" or
+// "+" (e.g. "1.2.3-dev") are ignored.
+func Parse(s string) (*Version, error) {
+	str := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(str, "-+"); i != -1 {
+		str = str[:i]
+	}
+	parts := strings.Split(str, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return nil, fmt.Errorf("Invalid version: %q", s)
+	}
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid version: %q", s)
+		}
+		nums[i] = n
+	}
+	return &Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+// Compare returns -1 if v is older than other, 0 if they are the same, and 1
+// if v is newer
+func (v *Version) Compare(other *Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] < pair[1] {
+			return -1
+		}
+		if pair[0] > pair[1] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v *Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// IsNewer returns true if version a is newer than version b
+func IsNewer(a, b string) (bool, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return false, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return false, err
+	}
+	return va.Compare(vb) > 0, nil
+}
@@ -0,0 +1,43 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse("1.2.3")
+	require.NoError(t, err)
+	require.Equal(t, &Version{1, 2, 3}, v)
+
+	v, err = Parse("v0.4.2-dev")
+	require.NoError(t, err)
+	require.Equal(t, "0.4.2", v.String())
+
+	v, err = Parse("2.1")
+	require.NoError(t, err)
+	require.Equal(t, &Version{2, 1, 0}, v)
+
+	_, err = Parse("development")
+	require.Error(t, err)
+	_, err = Parse("1.2.3.4")
+	require.Error(t, err)
+}
+
+func TestIsNewer(t *testing.T) {
+	for _, tt := range []struct {
+		a, b  string
+		newer bool
+	}{
+		{"0.4.3", "0.4.2", true},
+		{"0.10.0", "0.9.9", true},
+		{"1.0.0", "0.99.99", true},
+		{"0.4.2", "0.4.2-dev", false},
+		{"0.4.1", "0.4.2", false},
+	} {
+		newer, err := IsNewer(tt.a, tt.b)
+		require.NoError(t, err)
+		require.Equal(t, tt.newer, newer, "%s > %s", tt.a, tt.b)
+	}
+}
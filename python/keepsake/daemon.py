@@ -57,6 +57,20 @@ def handle_exception(code, details):
         return exceptions.CorruptedRepositorySpec(details)
     if code == "CONFIG_NOT_FOUND":
         return exceptions.ConfigNotFound(details)
+    if code == "PERMISSION_DENIED":
+        return exceptions.PermissionDenied(details)
+    if code == "THROTTLED":
+        return exceptions.Throttled(details)
+    if code == "CORRUPT":
+        return exceptions.Corrupt(details)
+    if code == "NETWORK_TIMEOUT":
+        return exceptions.NetworkTimeout(details)
+    if code == "QUOTA_EXCEEDED":
+        return exceptions.QuotaExceeded(details)
+    if code == "READ_ONLY":
+        return exceptions.ReadOnly(details)
+    if code == "INSUFFICIENT_DISK_SPACE":
+        return exceptions.InsufficientDiskSpace(details)
 
 
 def get_status_code(e, details):
@@ -178,9 +192,12 @@ class Daemon:
             path=path,
             primaryMetric=pb_primary_metric,
             step=step,
+            noStep=step is None,
         )
         ret = self.stub.CreateCheckpoint(
-            pb.CreateCheckpointRequest(checkpoint=pb_checkpoint, quiet=quiet)
+            pb.CreateCheckpointRequest(
+                checkpoint=pb_checkpoint, quiet=quiet, experimentID=experiment.id
+            )
         )
         return pb_convert.checkpoint_from_pb(experiment, ret.checkpoint)
 
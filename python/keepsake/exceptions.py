@@ -27,3 +27,31 @@ class CorruptedRepositorySpec(Exception):
 
 class ConfigNotFound(Exception):
     pass
+
+
+class PermissionDenied(Exception):
+    pass
+
+
+class Throttled(Exception):
+    pass
+
+
+class Corrupt(Exception):
+    pass
+
+
+class NetworkTimeout(Exception):
+    pass
+
+
+class QuotaExceeded(Exception):
+    pass
+
+
+class ReadOnly(Exception):
+    pass
+
+
+class InsufficientDiskSpace(Exception):
+    pass
@@ -51,7 +51,7 @@ def checkpoint_from_pb(experiment: Experiment, chk_pb: pb.Checkpoint) -> Checkpo
         id=chk_pb.id,
         created=timestamp_from_pb(chk_pb.created),
         path=noneable(chk_pb.path),
-        step=chk_pb.step,
+        step=None if chk_pb.noStep else chk_pb.step,
         metrics=value_map_from_pb(chk_pb.metrics),
         primary_metric=primary_metric_from_pb(chk_pb.primaryMetric),
     )
@@ -171,6 +171,7 @@ def checkpoint_to_pb(chk: Checkpoint) -> pb.Checkpoint:
         created=timestamp_to_pb(chk.created),
         path=chk.path,
         step=chk.step,
+        noStep=chk.step is None,
         metrics=value_map_to_pb(chk.metrics),
         primaryMetric=primary_metric_to_pb(chk.primary_metric),
     )
@@ -80,6 +80,7 @@ type___CreateExperimentReply = CreateExperimentReply
 class CreateCheckpointRequest(google___protobuf___message___Message):
     DESCRIPTOR: google___protobuf___descriptor___Descriptor = ...
     quiet: builtin___bool = ...
+    experimentID: typing___Text = ...
 
     @property
     def checkpoint(self) -> type___Checkpoint: ...
@@ -88,9 +89,10 @@ class CreateCheckpointRequest(google___protobuf___message___Message):
         *,
         checkpoint : typing___Optional[type___Checkpoint] = None,
         quiet : typing___Optional[builtin___bool] = None,
+        experimentID : typing___Optional[typing___Text] = None,
         ) -> None: ...
     def HasField(self, field_name: typing_extensions___Literal[u"checkpoint",b"checkpoint"]) -> builtin___bool: ...
-    def ClearField(self, field_name: typing_extensions___Literal[u"checkpoint",b"checkpoint",u"quiet",b"quiet"]) -> None: ...
+    def ClearField(self, field_name: typing_extensions___Literal[u"checkpoint",b"checkpoint",u"experimentID",b"experimentID",u"quiet",b"quiet"]) -> None: ...
 type___CreateCheckpointRequest = CreateCheckpointRequest
 
 class CreateCheckpointReply(google___protobuf___message___Message):
@@ -380,6 +382,7 @@ class Checkpoint(google___protobuf___message___Message):
     id: typing___Text = ...
     step: builtin___int = ...
     path: typing___Text = ...
+    noStep: builtin___bool = ...
 
     @property
     def created(self) -> google___protobuf___timestamp_pb2___Timestamp: ...
@@ -398,9 +401,10 @@ class Checkpoint(google___protobuf___message___Message):
         step : typing___Optional[builtin___int] = None,
         path : typing___Optional[typing___Text] = None,
         primaryMetric : typing___Optional[type___PrimaryMetric] = None,
+        noStep : typing___Optional[builtin___bool] = None,
         ) -> None: ...
     def HasField(self, field_name: typing_extensions___Literal[u"created",b"created",u"primaryMetric",b"primaryMetric"]) -> builtin___bool: ...
-    def ClearField(self, field_name: typing_extensions___Literal[u"created",b"created",u"id",b"id",u"metrics",b"metrics",u"path",b"path",u"primaryMetric",b"primaryMetric",u"step",b"step"]) -> None: ...
+    def ClearField(self, field_name: typing_extensions___Literal[u"created",b"created",u"id",b"id",u"metrics",b"metrics",u"noStep",b"noStep",u"path",b"path",u"primaryMetric",b"primaryMetric",u"step",b"step"]) -> None: ...
 type___Checkpoint = Checkpoint
 
 class PrimaryMetric(google___protobuf___message___Message):
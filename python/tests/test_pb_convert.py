@@ -187,6 +187,14 @@ def test_empty_checkpoint_to_pb():
     assert pb_convert.checkpoint_to_pb(chk) == expected
 
 
+def test_checkpoint_without_step_pb():
+    t = datetime.datetime(2020, 12, 7, 1, 13, 29, 192682)
+    chk = Checkpoint(id="foo", created=t, step=None)
+    chk_pb = pb.Checkpoint(id="foo", created=pb_convert.timestamp_to_pb(t), noStep=True)
+    assert pb_convert.checkpoint_to_pb(chk) == chk_pb
+    assert pb_convert.checkpoint_from_pb(None, chk_pb) == chk
+
+
 def test_experiment_to_pb():
     project = Project()
     exp = full_experiment(project)